@@ -5,6 +5,7 @@ import (
 	"sort" // Import the sort package
 
 	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/gate"
 	"github.com/kegliz/qcm/qc/simulator"
 	_ "github.com/kegliz/qcm/qc/simulator/itsu"
 	_ "github.com/kegliz/qcm/qc/simulator/qsim"
@@ -55,17 +56,17 @@ func simulateGrover2Qubit(shots int) {
 	b := builder.New(builder.Q(2), builder.C(2))
 
 	// — initial superposition —
-	b.H(0).H(1)
+	b.HAll()
 
 	// — oracle marks |11⟩ by phase flip (controlled‑Z) —
 	b.CZ(0, 1)
 
 	// — diffusion operator —
-	b.H(0).H(1)
-	b.X(0).X(1)
+	b.HAll()
+	b.ApplyAll(gate.X())
 	b.CZ(0, 1)
-	b.X(0).X(1)
-	b.H(0).H(1)
+	b.ApplyAll(gate.X())
+	b.HAll()
 
 	// — measurement —
 	b.Measure(0, 0).Measure(1, 1)
@@ -94,25 +95,39 @@ func simulateGrover2Qubit(shots int) {
 // simulateGrover3Qubit demonstrates optimal Grover iterations (2) on 3‑qubit search space
 // amplifying the |111⟩ state.
 func simulateGrover3Qubit(shots int) {
+	// — oracle marks |111⟩ by phase flip (CCZ) —
+	// Implement CCZ using H and Toffoli: H(target) Toffoli(c1, c2, target) H(target)
+	ccz, err := builder.BuildGate("CCZ", 3, func(g builder.Builder, q []int) {
+		g.H(q[2]).Toffoli(q[0], q[1], q[2]).H(q[2])
+	})
+	if err != nil {
+		fmt.Printf("Error defining CCZ gate: %v\n", err)
+		return
+	}
+
+	// — diffusion operator (3 qubits) —
+	// HHH - XXX - CCZ - XXX - HHH
+	diffusion, err := builder.BuildGate("Diffusion", 3, func(g builder.Builder, q []int) {
+		g.HAll()
+		g.ApplyAll(gate.X())
+		g.Apply(ccz, q...)
+		g.ApplyAll(gate.X())
+		g.HAll()
+	})
+	if err != nil {
+		fmt.Printf("Error defining diffusion gate: %v\n", err)
+		return
+	}
+
 	b := builder.New(builder.Q(3), builder.C(3))
 
 	// — initial superposition —
-	b.H(0).H(1).H(2)
+	b.HAll()
 
 	// Perform 2 Grover iterations (optimal for 3 qubits: π/4 * √8 ≈ 2.22)
 	for range 2 {
-		// — oracle marks |111⟩ by phase flip (CCZ) —
-		// Implement CCZ using H and Toffoli: H(target) Toffoli(c1, c2, target) H(target)
-		b.H(2).Toffoli(0, 1, 2).H(2)
-
-		// — diffusion operator (3 qubits) —
-		// HHH - XXX - CCZ - XXX - HHH
-		b.H(0).H(1).H(2)
-		b.X(0).X(1).X(2)
-		// CCZ
-		b.H(2).Toffoli(0, 1, 2).H(2)
-		b.X(0).X(1).X(2)
-		b.H(0).H(1).H(2)
+		b.Apply(ccz, 0, 1, 2)
+		b.Apply(diffusion, 0, 1, 2)
 	}
 
 	// — measurement —
@@ -143,37 +158,36 @@ func simulateGrover3Qubit(shots int) {
 // simulateGrover4Qubit demonstrates optimal Grover iterations (3) on 4‑qubit search space
 // amplifying the |1111⟩ state.
 func simulateGrover4Qubit(shots int) {
-	// This circuit uses a CCCZ gate
-	// so we need an ancilla qubit to implement the CCCZ gate with H and Toffoli gates.
-
-	b := builder.New(builder.Q(5), builder.C(4))
+	// This circuit uses a CCCZ gate, which needs an ancilla qubit to be
+	// implemented with H and Toffoli gates. The builder allocates it for us
+	// and checks that it is uncomputed before it is released.
+	b := builder.New(builder.Q(4), builder.C(4), builder.CheckAncillas())
+
+	// cccz flips the phase of |1111⟩: H(3) - CCCX - H(3), where CCCX is
+	// Toffoli(0,1,a) - Toffoli(2,a,3) - Toffoli(0,1,a) on a borrowed ancilla a.
+	cccz := func() {
+		b.H(3)
+		a := b.AllocAncilla()
+		b.Toffoli(0, 1, a).Toffoli(2, a, 3).Toffoli(0, 1, a)
+		b.FreeAncilla(a)
+		b.H(3)
+	}
 
 	// — initial superposition —
-	b.H(0).H(1).H(2).H(3)
+	b.HAll()
 
 	// Perform 3 Grover iterations (optimal for 4 qubits: π/4 * √16 ≈ 3.14)
 	for range 3 {
 		// — oracle marks |1111⟩ by phase flip (CCCZ) —
-		// CCCZ using H and Toffoli:  H(3) - CCCX - H(3)
-		b.H(3)
-		//  CCCX using ancilla qubit 4:
-		//  Toffoli(0,1,4) - Toffoli(2,4,3) - Toffoli(0,1,4)
-		b.Toffoli(0, 1, 4).Toffoli(2, 4, 3).Toffoli(0, 1, 4)
-		b.H(3)
+		cccz()
 
 		// — diffusion operator (4 qubits) —
 		// HHHH - XXXX - CCCZ - XXXX - HHHH
-		b.H(0).H(1).H(2).H(3)
-		b.X(0).X(1).X(2).X(3)
-		//  CCCZ using H and Toffoli:  H(3) - CCCX - H(3)
-		b.H(3)
-		// CCCX using ancilla qubit 4:
-		// Toffoli(0,1,4) - Toffoli(2,4,3) - Toffoli(0,1,4)
-		b.Toffoli(0, 1, 4).Toffoli(2, 4, 3).Toffoli(0, 1, 4)
-		b.H(3)
-
-		b.X(0).X(1).X(2).X(3)
-		b.H(0).H(1).H(2).H(3)
+		b.HAll()
+		b.ApplyAll(gate.X())
+		cccz()
+		b.ApplyAll(gate.X())
+		b.HAll()
 	}
 
 	// — measurement —
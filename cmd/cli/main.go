@@ -1 +1,266 @@
-package cli
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kegliz/qcm/qc/analysis"
+	"github.com/kegliz/qcm/qc/bench"
+	"github.com/kegliz/qcm/qc/dashboard"
+	"github.com/kegliz/qcm/qc/dsl"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/reference"
+
+	// Import the runner packages to register the plugins
+	_ "github.com/kegliz/qcm/qc/simulator/itsu"
+	_ "github.com/kegliz/qcm/qc/simulator/qsim"
+	_ "github.com/kegliz/qcm/qc/simulator/tensornet"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = runCmd(os.Args[2:])
+	case "fmt":
+		err = fmtCmd(os.Args[2:])
+	case "compare":
+		err = compareCmd(os.Args[2:])
+	case "gates":
+		err = gatesCmd(os.Args[2:])
+	case "frontier":
+		err = frontierCmd(os.Args[2:])
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("QCM command line")
+	fmt.Println("Usage: cli <command> [flags] <file.qcm>")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  run      Simulate a DSL program and print the histogram (-watch shows progress,")
+	fmt.Println("           -dry-run only validates it and estimates memory and time,")
+	fmt.Println("           -min-counts scales the shots with the number of measured bits,")
+	fmt.Println("           -verify checks the final state against an exact reference)")
+	fmt.Println("  fmt      Parse a DSL program and print it in canonical form")
+	fmt.Println("  compare  Compare two histograms printed by run; fails on significant drift")
+	fmt.Println("  gates    List the supported gates (-matrix prints their unitaries)")
+	fmt.Println("  frontier Grow GHZ and QFT circuits on every backend until it runs out of")
+	fmt.Println("           time or memory, and print the largest size each handled")
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	backend := fs.String("backend", "itsu", "registered runner to use")
+	shots := fs.Int("shots", 1024, "number of shots")
+	seed := fs.Int64("seed", 0, "seed for reproducible runs (0: unseeded)")
+	watch := fs.Bool("watch", false, "show live progress on stderr")
+	dryRun := fs.Bool("dry-run", false, "validate and estimate the run without running it")
+	minCounts := fs.Int("min-counts", 0, "raise the shots so every outcome of the measured bits is expected this often (0: off)")
+	verify := fs.Bool("verify", false, fmt.Sprintf("compare the final state with a %d-bit reference evaluation (up to %d qubits)", reference.DefaultPrecision, reference.MaxQubits))
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: cli run [-backend name] [-shots n] [-seed n] [-min-counts n] [-watch] [-dry-run] [-verify] <file.qcm>")
+	}
+
+	prog, err := dsl.ParseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	c, err := prog.Circuit()
+	if err != nil {
+		return err
+	}
+	sim, err := simulator.NewSimulatorWithRunner(*backend, simulator.SimulatorOptions{Shots: *shots, Seed: *seed, MinCounts: *minCounts})
+	if err != nil {
+		return err
+	}
+	if *minCounts > 0 {
+		plan := sim.PlanShots(c)
+		fmt.Fprintln(os.Stderr, plan)
+		sim.Shots, sim.MinCounts = plan.Shots, 0
+	}
+	if *dryRun {
+		report, err := sim.Validate(c)
+		fmt.Print(report)
+		return err
+	}
+	if *verify {
+		v, err := reference.Verify(sim, c, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, v)
+	}
+	var job *dashboard.Job
+	if *watch {
+		job = dashboard.New(os.Stderr).Job(fs.Arg(0), sim.Shots)
+		sim.Progress = job.Progress
+	}
+	hist, err := sim.Run(c)
+	if job != nil {
+		job.Finish(hist, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(hist))
+	for k := range hist {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s %d\n", k, hist[k])
+	}
+	return nil
+}
+
+func fmtCmd(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: cli fmt <file.qcm>")
+	}
+	prog, err := dsl.ParseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Print(prog.String())
+	return nil
+}
+
+func frontierCmd(args []string) error {
+	fs := flag.NewFlagSet("frontier", flag.ExitOnError)
+	runners := fs.String("backends", "", "comma-separated runners to measure (default: all)")
+	family := fs.String("family", "", "ghz or qft (default: both)")
+	budget := fs.Duration("time", 10*time.Second, "time budget of one run")
+	memory := fs.Int64("memory", 4<<30, "memory budget of one run in bytes")
+	maxQubits := fs.Int("max-qubits", 30, "largest size to try")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: cli frontier [-backends a,b] [-family ghz|qft] [-time d] [-memory n] [-max-qubits n]")
+	}
+	cfg := bench.Config{Time: *budget, Memory: *memory, MaxQubits: *maxQubits}
+	if *runners != "" {
+		cfg.Runners = strings.Split(*runners, ",")
+	}
+	switch *family {
+	case "":
+	case bench.GHZ.Name:
+		cfg.Families = []bench.Family{bench.GHZ}
+	case bench.QFT.Name:
+		cfg.Families = []bench.Family{bench.QFT}
+	default:
+		return fmt.Errorf("unknown family %q, want ghz or qft", *family)
+	}
+	fr, err := bench.Run(cfg)
+	if err != nil {
+		return err
+	}
+	return bench.Table(os.Stdout, fr)
+}
+
+func gatesCmd(args []string) error {
+	fs := flag.NewFlagSet("gates", flag.ExitOnError)
+	matrix := fs.Bool("matrix", false, "print each gate's unitary, qubit 0 the lowest bit")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: cli gates [-matrix]")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tQUBITS\tPARAMS\tSYMBOL\tALIASES")
+	for _, d := range gate.All() {
+		aliases := strings.Join(d.Aliases, ",")
+		if d.Custom {
+			aliases += " (custom)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", d.Name, d.Qubits, d.Params, d.Symbol, aliases)
+		if *matrix && d.Matrix != nil {
+			for _, row := range d.Matrix {
+				cells := make([]string, len(row))
+				for i, v := range row {
+					cells[i] = strconv.FormatComplex(v, 'g', 4, 128)
+				}
+				fmt.Fprintf(w, "\t\t\t\t%s\n", strings.Join(cells, " "))
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func compareCmd(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	alpha := fs.Float64("alpha", 0.01, "significance level of the drift test")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: cli compare [-alpha p] <baseline> <current>")
+	}
+	baseline, err := readHistogram(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	current, err := readHistogram(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d, err := analysis.CompareResults(baseline, current)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("shots     %d -> %d\n", d.BaselineShots, d.CurrentShots)
+	fmt.Printf("tvd       %.4f\n", d.TVD)
+	fmt.Printf("fidelity  %.4f\n", d.Fidelity)
+	fmt.Printf("chi2      %.4g (df %d)\n", d.ChiSquare, d.DF)
+	fmt.Printf("p-value   %.4g\n", d.PValue)
+	if d.Significant(*alpha) {
+		return fmt.Errorf("significant drift: p = %.4g < %g", d.PValue, *alpha)
+	}
+	return nil
+}
+
+// readHistogram reads "key count" lines as printed by run.
+func readHistogram(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hist := map[string]int{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"key count\"", path, line)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		hist[fields[0]] += n
+	}
+	return hist, sc.Err()
+}
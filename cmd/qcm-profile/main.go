@@ -0,0 +1,204 @@
+// Command qcm-profile runs a named circuit workload on a backend under CPU
+// and heap profiling, writes the pprof files and prints a summary, so that
+// backend performance regressions are investigated the same way every
+// time:
+//
+//	qcm-profile -workload qft -qubits 14 -backend qsim -out prof/
+//	go tool pprof -top prof/cpu.pprof
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dsl"
+	"github.com/kegliz/qcm/qc/simulator"
+
+	// Import the backends to register the plugins
+	_ "github.com/kegliz/qcm/qc/simulator/itsu"
+	_ "github.com/kegliz/qcm/qc/simulator/qsim"
+	_ "github.com/kegliz/qcm/qc/simulator/tensornet"
+)
+
+// workloads builds the named circuits on n qubits.
+var workloads = map[string]func(n int) (circuit.Circuit, error){
+	// ghz: H and a CNOT chain, measured; shallow and sampled from one state.
+	"ghz": func(n int) (circuit.Circuit, error) {
+		b := builder.New(builder.Q(n), builder.C(n)).H(0)
+		for q := range n - 1 {
+			b.CNOT(q, q+1)
+		}
+		return measureAll(b, n)
+	},
+	// qft: the quantum Fourier transform of a basis state, dominated by
+	// controlled phases.
+	"qft": func(n int) (circuit.Circuit, error) {
+		b := builder.New(builder.Q(n), builder.C(n))
+		for q := 0; q < n; q += 2 {
+			b.X(q)
+		}
+		for j := n - 1; j >= 0; j-- {
+			b.H(j)
+			for k := j - 1; k >= 0; k-- {
+				b.CP(math.Pi/float64(int(1)<<(j-k)), k, j)
+			}
+		}
+		for q := range n / 2 {
+			b.SWAP(q, n-1-q)
+		}
+		return measureAll(b, n)
+	},
+	// random: 2n layers of random rotations and a brick of CNOTs, with a
+	// fixed seed so every run builds the same circuit.
+	"random": func(n int) (circuit.Circuit, error) {
+		rng := rand.New(rand.NewSource(1))
+		b := builder.New(builder.Q(n), builder.C(n))
+		for layer := range 2 * n {
+			for q := range n {
+				b.RY(rng.Float64()*2*math.Pi, q).RZ(rng.Float64()*2*math.Pi, q)
+			}
+			for q := layer % 2; q+1 < n; q += 2 {
+				b.CNOT(q, q+1)
+			}
+		}
+		return measureAll(b, n)
+	},
+	// midmeasure: a mid-circuit measurement per qubit, which forces every
+	// shot to replay the circuit instead of sampling one final state.
+	"midmeasure": func(n int) (circuit.Circuit, error) {
+		b := builder.New(builder.Q(n), builder.C(n))
+		for q := range n {
+			b.H(q)
+			if q > 0 {
+				b.CNOT(q-1, q)
+			}
+			b.Measure(q, q).H(q)
+		}
+		return b.BuildCircuit()
+	},
+}
+
+func measureAll(b builder.Builder, n int) (circuit.Circuit, error) {
+	for q := range n {
+		b.Measure(q, q)
+	}
+	return b.BuildCircuit()
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	names := slices.Sorted(maps.Keys(workloads))
+	workload := flag.String("workload", "qft", "workload to run: "+strings.Join(names, ", "))
+	file := flag.String("file", "", "run a DSL program instead of a named workload")
+	qubits := flag.Int("qubits", 12, "width of the named workload")
+	backend := flag.String("backend", "qsim", "registered runner to use")
+	shots := flag.Int("shots", 1024, "shots per run")
+	repeat := flag.Int("repeat", 5, "number of runs")
+	seed := flag.Int64("seed", 0, "simulator seed (0: unseeded)")
+	out := flag.String("out", ".", "directory for cpu.pprof and heap.pprof")
+	flag.Parse()
+
+	c, label, err := load(*workload, *file, *qubits)
+	if err != nil {
+		return err
+	}
+	sim, err := simulator.NewSimulatorWithRunner(*backend, simulator.SimulatorOptions{Shots: *shots, Seed: *seed, Profile: true})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	cpuPath := filepath.Join(*out, "cpu.pprof")
+	cpu, err := os.Create(cpuPath)
+	if err != nil {
+		return err
+	}
+	defer cpu.Close()
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		return err
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	times := make([]time.Duration, 0, *repeat)
+	var last *simulator.Result
+	for range *repeat {
+		start := time.Now()
+		last, err = sim.RunResult(c)
+		if err != nil {
+			pprof.StopCPUProfile()
+			return err
+		}
+		times = append(times, time.Since(start))
+	}
+	runtime.ReadMemStats(&after)
+	pprof.StopCPUProfile()
+
+	heapPath := filepath.Join(*out, "heap.pprof")
+	heap, err := os.Create(heapPath)
+	if err != nil {
+		return err
+	}
+	defer heap.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(heap); err != nil {
+		return err
+	}
+
+	slices.Sort(times)
+	var total time.Duration
+	for _, d := range times {
+		total += d
+	}
+	runs := uint64(len(times))
+	fmt.Printf("workload   %s (%d qubits, %d operations, depth %d)\n", label, c.Qubits(), len(c.Operations()), c.Depth())
+	fmt.Printf("backend    %s, %d shots × %d runs\n", *backend, *shots, len(times))
+	fmt.Printf("time/run   min %v  median %v  max %v\n", times[0], times[len(times)/2], times[len(times)-1])
+	fmt.Printf("shots/s    %.0f\n", float64(*shots)*float64(len(times))/total.Seconds())
+	fmt.Printf("alloc/run  %d objects, %d bytes\n", (after.Mallocs-before.Mallocs)/runs, (after.TotalAlloc-before.TotalAlloc)/runs)
+	fmt.Printf("profiles   %s, %s\n", cpuPath, heapPath)
+	if last.Profile != nil {
+		fmt.Printf("\nlast run by operation:\n%s", last.Profile.Table())
+	}
+	return nil
+}
+
+// load returns the circuit to profile and a label for the summary.
+func load(workload, file string, qubits int) (circuit.Circuit, string, error) {
+	if file != "" {
+		prog, err := dsl.ParseFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+		c, err := prog.Circuit()
+		return c, file, err
+	}
+	build, ok := workloads[workload]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown workload %q", workload)
+	}
+	if qubits < 1 {
+		return nil, "", fmt.Errorf("workload needs at least one qubit, got %d", qubits)
+	}
+	c, err := build(qubits)
+	return c, workload, err
+}
@@ -36,6 +36,8 @@
 //   - gate: Comprehensive quantum gate library
 //   - renderer: PNG visualization for quantum circuits
 //   - dag: Directed Acyclic Graph for circuit dependency management
+//   - dsl: Line-oriented text format for circuits (parser and formatter)
+//   - algorithms: Ready-made algorithm circuits (e.g. iterative phase estimation)
 //
 // # Plugin System
 //
@@ -5,6 +5,7 @@ import (
 	"math/cmplx"
 	"testing"
 
+	"github.com/kegliz/qcm/qc/bitorder"
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/simulator"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +21,7 @@ func checkOracle(t *testing.T, nInput int, oracleFunc func(b builder.Builder), i
 	// Prepare input state |x⟩|0⟩.
 	// The input string is big-endian, but the qubits are little-endian.
 	// We need to reverse the input string to match the qubit order.
-	inputLE := reverseString(input)
+	inputLE := bitorder.Reverse(input)
 	for i, bit := range inputLE {
 		if bit == '1' {
 			b.X(i) // Little-endian qubit order
@@ -74,7 +75,7 @@ func TestBernsteinVaziraniOracles(t *testing.T) {
 
 	for _, tc := range testCases2Qubit {
 		t.Run(fmt.Sprintf("BV_2Qubit_%s", tc.name), func(t *testing.T) {
-			oracleFunc := func(b builder.Builder) { applyBVOracle2Qubit(b, tc.hiddenString) }
+			oracleFunc := func(b builder.Builder) { applyBVOracle(b, tc.hiddenString) }
 			output := checkOracle(t, 1, oracleFunc, tc.input)
 			assert.Equal(t, tc.expected, output)
 		})
@@ -99,7 +100,7 @@ func TestBernsteinVaziraniOracles(t *testing.T) {
 
 	for _, tc := range testCases3Qubit {
 		t.Run(fmt.Sprintf("BV_3Qubit_%s", tc.name), func(t *testing.T) {
-			oracleFunc := func(b builder.Builder) { applyBVOracle3Qubit(b, tc.hiddenString) }
+			oracleFunc := func(b builder.Builder) { applyBVOracle(b, tc.hiddenString) }
 			output := checkOracle(t, 2, oracleFunc, tc.input)
 			assert.Equal(t, tc.expected, output)
 		})
@@ -122,7 +123,7 @@ func TestBernsteinVaziraniOracles(t *testing.T) {
 
 	for _, tc := range testCases4Qubit {
 		t.Run(fmt.Sprintf("BV_4Qubit_%s", tc.name), func(t *testing.T) {
-			oracleFunc := func(b builder.Builder) { applyBVOracle4Qubit(b, tc.hiddenString) }
+			oracleFunc := func(b builder.Builder) { applyBVOracle(b, tc.hiddenString) }
 			output := checkOracle(t, 3, oracleFunc, tc.input)
 			assert.Equal(t, tc.expected, output)
 		})
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/report"
 	"github.com/kegliz/qcm/qc/simulator"
 	_ "github.com/kegliz/qcm/qc/simulator/qsim"
 )
@@ -12,126 +14,80 @@ func main() {
 	shots := 1024
 
 	fmt.Println("\n--- Deutsch-Jozsa Algorithm Demonstrations ---")
-	deutschJozsaDemo(shots)
-}
-
-// deutschJozsaDemo demonstrates the Deutsch-Jozsa algorithm with different oracle functions
-func deutschJozsaDemo(shots int) {
-	fmt.Println("\n=== 2-Qubit Deutsch-Jozsa Algorithm ===")
-
-	// Test constant function f(x) = 0
-	fmt.Println("\n1. Testing constant function f(x) = 0:")
-	deutschJozsa2Qubit(shots, "constant_0")
-
-	// Test constant function f(x) = 1
-	fmt.Println("\n2. Testing constant function f(x) = 1:")
-	deutschJozsa2Qubit(shots, "constant_1")
-
-	// Test balanced function f(0) = 0, f(1) = 1 (identity)
-	fmt.Println("\n3. Testing balanced function f(x) = x:")
-	deutschJozsa2Qubit(shots, "balanced_identity")
-
-	// Test balanced function f(0) = 1, f(1) = 0 (NOT)
-	fmt.Println("\n4. Testing balanced function f(x) = NOT x:")
-	deutschJozsa2Qubit(shots, "balanced_not")
-
-	fmt.Println("\n=== 3-Qubit Deutsch-Jozsa Algorithm ===")
-
-	// Test constant function f(x) = 0
-	fmt.Println("\n5. Testing constant function f(x) = 0 (3-qubit):")
-	deutschJozsa3Qubit(shots, "constant_0")
-
-	// Test balanced function - XOR of first two bits
-	fmt.Println("\n6. Testing balanced function f(x1,x2) = x1 ⊕ x2 (3-qubit):")
-	deutschJozsa3Qubit(shots, "balanced_xor")
-}
-
-// deutschJozsa2Qubit implements the 2-qubit Deutsch-Jozsa algorithm
-// Uses 2 qubits: 1 input qubit + 1 ancilla qubit for the oracle
-func deutschJozsa2Qubit(shots int, oracleType string) {
-	// 2 qubits: qubit 0 (input), qubit 1 (ancilla)
-	// 1 classical bit to measure the result
-	b := builder.New(builder.Q(2), builder.C(1))
-
-	// Initialize ancilla qubit in |1⟩ state
-	b.X(1)
-
-	// Apply Hadamard to both qubits
-	b.H(0).H(1)
-
-	// Apply oracle function based on type
-	applyOracle2Qubit(b, oracleType)
-
-	// Apply Hadamard to input qubit
-	b.H(0)
-
-	// Measure input qubit
-	b.Measure(0, 0)
-
-	c, err := b.BuildCircuit()
-	if err != nil {
-		fmt.Printf("Error building Deutsch-Jozsa circuit: %v\n", err)
-		return
-	}
-
 	sim, err := simulator.NewSimulatorWithRunner("qsim", simulator.SimulatorOptions{Shots: shots})
 	if err != nil {
 		fmt.Printf("Error creating simulator: %v\n", err)
 		return
 	}
-
-	hist, err := sim.Run(c)
-	if err != nil {
-		fmt.Printf("Error running Deutsch-Jozsa simulation: %v\n", err)
-		return
-	}
-
-	// Analyze results
-	analyzeResults(hist, shots, oracleType)
+	deutschJozsaDemo(sim, report.New(os.Stdout, report.Options{Intervals: true}))
 }
 
-// deutschJozsa3Qubit implements the 3-qubit Deutsch-Jozsa algorithm
-// Uses 3 qubits: 2 input qubits + 1 ancilla qubit
-func deutschJozsa3Qubit(shots int, oracleType string) {
-	// 3 qubits: qubit 0,1 (input), qubit 2 (ancilla)
-	// 2 classical bits to measure the results
-	b := builder.New(builder.Q(3), builder.C(2))
-
-	// Initialize ancilla qubit in |1⟩ state
-	b.X(2)
-
-	// Apply Hadamard to all qubits
-	b.H(0).H(1).H(2)
-
-	// Apply oracle function based on type
-	applyOracle3Qubit(b, oracleType)
-
-	// Apply Hadamard to input qubits
-	b.H(0).H(1)
-
-	// Measure input qubits
-	b.Measure(0, 0).Measure(1, 1)
-
-	c, err := b.BuildCircuit()
-	if err != nil {
-		fmt.Printf("Error building 3-qubit Deutsch-Jozsa circuit: %v\n", err)
-		return
-	}
+// oracleCase is one oracle to test, with the heading printed before it.
+type oracleCase struct {
+	title, oracleType string
+}
 
-	sim, err := simulator.NewSimulatorWithRunner("qsim", simulator.SimulatorOptions{Shots: shots})
-	if err != nil {
-		fmt.Printf("Error creating simulator: %v\n", err)
-		return
-	}
+// deutschJozsaDemo demonstrates the Deutsch-Jozsa algorithm with different oracle functions
+func deutschJozsaDemo(sim *simulator.Simulator, rep *report.Reporter) {
+	rep.Section("2-Qubit Deutsch-Jozsa Algorithm")
+	// 2 qubits: qubit 0 (input), qubit 1 (ancilla); 1 classical bit for the result
+	deutschJozsa(sim, rep, 1, applyOracle2Qubit, []oracleCase{
+		{"1. Testing constant function f(x) = 0:", "constant_0"},
+		{"2. Testing constant function f(x) = 1:", "constant_1"},
+		{"3. Testing balanced function f(x) = x:", "balanced_identity"},
+		{"4. Testing balanced function f(x) = NOT x:", "balanced_not"},
+	})
+
+	rep.Section("3-Qubit Deutsch-Jozsa Algorithm")
+	// 3 qubits: qubits 0,1 (input), qubit 2 (ancilla); 2 classical bits
+	deutschJozsa(sim, rep, 2, applyOracle3Qubit, []oracleCase{
+		{"5. Testing constant function f(x) = 0 (3-qubit):", "constant_0"},
+		{"6. Testing balanced function f(x1,x2) = x1 ⊕ x2 (3-qubit):", "balanced_xor"},
+	})
+}
 
-	hist, err := sim.Run(c)
-	if err != nil {
-		fmt.Printf("Error running 3-qubit Deutsch-Jozsa simulation: %v\n", err)
-		return
+// deutschJozsa runs the algorithm with n input qubits and one ancilla
+// (qubit n) for every oracle. The state preparation is built once and
+// forked, so each case only adds its oracle and the final layer.
+func deutschJozsa(sim *simulator.Simulator, rep *report.Reporter, n int,
+	applyOracle func(builder.Builder, string),
+	cases []oracleCase) {
+	prep := builder.New(builder.Q(n+1), builder.C(n))
+	// Initialize the ancilla in |1⟩, then put every qubit into superposition
+	prep.X(n).HAll()
+
+	for _, tc := range cases {
+		fmt.Println("\n" + tc.title)
+
+		b := prep.Fork()
+		applyOracle(b, tc.oracleType)
+		// Apply Hadamard to the input qubits and measure them
+		for q := range n {
+			b.H(q).Measure(q, q)
+		}
+
+		c, err := b.BuildCircuit()
+		if err != nil {
+			fmt.Printf("Error building Deutsch-Jozsa circuit: %v\n", err)
+			return
+		}
+		res, err := sim.RunResult(c)
+		if err != nil {
+			fmt.Printf("Error running Deutsch-Jozsa simulation: %v\n", err)
+			return
+		}
+		// An ideal run measures all zeros for constant oracles and never
+		// for balanced ones, so the verdict tests P(0…0) against 1/2.
+		zeros := fmt.Sprintf("%0*d", n, 0)
+		rep.Case(report.Case{
+			Title:    fmt.Sprintf("Results for %s:", tc.oracleType),
+			Result:   res,
+			Expected: []string{zeros},
+			Success:  "Function is CONSTANT (measured |" + zeros + "⟩)",
+			Failure:  "Function is BALANCED (measured non-|" + zeros + "⟩)",
+			Classify: true,
+		})
 	}
-
-	// Analyze results
-	analyzeResults3Qubit(hist, shots, oracleType)
 }
 
 // applyOracle2Qubit applies the oracle function for 2-qubit Deutsch-Jozsa
@@ -166,52 +122,3 @@ func applyOracle3Qubit(b builder.Builder, oracleType string) {
 		b.CNOT(0, 2).CNOT(1, 2)
 	}
 }
-
-// analyzeResults analyzes and displays the results for 2-qubit Deutsch-Jozsa
-func analyzeResults(hist map[string]int, shots int, oracleType string) {
-	zeroCount := hist["0"]
-	oneCount := hist["1"]
-
-	fmt.Printf("Results for %s:\n", oracleType)
-	fmt.Printf("  |0⟩: %d counts (%.2f%%)\n", zeroCount, float64(zeroCount)/float64(shots)*100)
-	fmt.Printf("  |1⟩: %d counts (%.2f%%)\n", oneCount, float64(oneCount)/float64(shots)*100)
-
-	// Determine if function is constant or balanced
-	threshold := int(float64(shots) * 0.9)
-	if zeroCount > threshold {
-		fmt.Printf("  → Function is CONSTANT (measured |0⟩)\n")
-	} else if oneCount > threshold {
-		fmt.Printf("  → Function is BALANCED (measured |1⟩)\n")
-	} else {
-		fmt.Printf("  → Inconclusive result (noise or error)\n")
-	}
-}
-
-// analyzeResults3Qubit analyzes and displays the results for 3-qubit Deutsch-Jozsa
-func analyzeResults3Qubit(hist map[string]int, shots int, oracleType string) {
-	zeroZeroCount := hist["00"]
-	otherCount := shots - zeroZeroCount
-
-	fmt.Printf("Results for %s:\n", oracleType)
-	fmt.Printf("  |00⟩: %d counts (%.2f%%)\n", zeroZeroCount, float64(zeroZeroCount)/float64(shots)*100)
-	fmt.Printf("  Other states: %d counts (%.2f%%)\n", otherCount, float64(otherCount)/float64(shots)*100)
-
-	// Determine if function is constant or balanced
-	threshold := int(float64(shots) * 0.9)
-	if zeroZeroCount > threshold {
-		fmt.Printf("  → Function is CONSTANT (measured |00⟩)\n")
-	} else if otherCount > threshold {
-		fmt.Printf("  → Function is BALANCED (measured non-|00⟩)\n")
-	} else {
-		fmt.Printf("  → Inconclusive result (noise or error)\n")
-	}
-}
-
-// reverseString reverses a string to handle bit ordering
-func reverseString(s string) string {
-	runes := []rune(s)
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
-	}
-	return string(runes)
-}
@@ -5,6 +5,7 @@ import (
 	"math/cmplx"
 	"testing"
 
+	"github.com/kegliz/qcm/qc/bitorder"
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/simulator"
 	"github.com/stretchr/testify/assert"
@@ -20,7 +21,7 @@ func checkOracle(t *testing.T, nInput int, oracleFunc func(b builder.Builder), i
 	// Prepare input state |x⟩|0⟩.
 	// The input string is big-endian, but the qubits are little-endian.
 	// We need to reverse the input string to match the qubit order.
-	inputLE := reverseString(input)
+	inputLE := bitorder.Reverse(input)
 	for i, bit := range inputLE {
 		if bit == '1' {
 			b.X(i) // Little-endian qubit order
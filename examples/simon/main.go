@@ -3,10 +3,13 @@ package main
 import (
 	"fmt"
 	"math/cmplx"
+	"os"
 	"strconv"
 	"strings"
 
+	"github.com/kegliz/qcm/qc/analysis"
 	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/report"
 	"github.com/kegliz/qcm/qc/simulator"
 	_ "github.com/kegliz/qcm/qc/simulator/qsim"
 )
@@ -19,36 +22,37 @@ func main() {
 	// First demonstrate oracle mappings
 	demonstrateOracleMappings()
 
-	// Then run the algorithm
-	simonDemo(shots)
+	// Then run the algorithm; secret strings are big-endian, and so are
+	// the reported outcomes.
+	simonDemo(shots, report.New(os.Stdout, report.Options{Keys: simulator.KeyFormat{Order: simulator.MSBFirst}}))
 }
 
-func simonDemo(shots int) {
-	fmt.Println("\n=== 2-Qubit Simon's Algorithm ===")
+func simonDemo(shots int, rep *report.Reporter) {
+	rep.Section("2-Qubit Simon's Algorithm")
 	fmt.Println("\n1. Testing function with no secret (s=\"00\"):")
-	simonAlgorithm2Qubit(shots, "00")
+	simonAlgorithm2Qubit(shots, rep, "00")
 	fmt.Println("\n2. Testing function with secret string s = \"01\":")
-	simonAlgorithm2Qubit(shots, "01")
+	simonAlgorithm2Qubit(shots, rep, "01")
 	fmt.Println("\n3. Testing function with secret string s = \"10\":")
-	simonAlgorithm2Qubit(shots, "10")
+	simonAlgorithm2Qubit(shots, rep, "10")
 	fmt.Println("\n4. Testing function with secret string s = \"11\":")
-	simonAlgorithm2Qubit(shots, "11")
+	simonAlgorithm2Qubit(shots, rep, "11")
 
-	fmt.Println("\n=== 3-Qubit Simon's Algorithm ===")
+	rep.Section("3-Qubit Simon's Algorithm")
 	fmt.Println("\n5. Testing function with no secret (s=\"000\"):")
-	simonAlgorithm3Qubit(shots, "000")
+	simonAlgorithm3Qubit(shots, rep, "000")
 	fmt.Println("\n6. Testing function with secret string s = \"110\":")
-	simonAlgorithm3Qubit(shots, "110")
+	simonAlgorithm3Qubit(shots, rep, "110")
 	fmt.Println("\n7. Testing function with secret string s = \"101\":")
-	simonAlgorithm3Qubit(shots, "101")
+	simonAlgorithm3Qubit(shots, rep, "101")
 	fmt.Println("\n8. Testing function with secret string s = \"011\":")
-	simonAlgorithm3Qubit(shots, "011")
+	simonAlgorithm3Qubit(shots, rep, "011")
 }
 
 // simonAlgorithm2Qubit runs Simon's algorithm for 2 qubits with the given secret string
 // Uses 4 qubits: 2 input qubits + 2 ancilla qubits
 // secretString is the hidden string s in big-endian format
-func simonAlgorithm2Qubit(shots int, secretString string) {
+func simonAlgorithm2Qubit(shots int, rep *report.Reporter, secretString string) {
 	b := builder.New(builder.Q(4), builder.C(2))
 	b.H(0).H(1)
 	applySimonOracle2Qubit(b, secretString)
@@ -56,14 +60,14 @@ func simonAlgorithm2Qubit(shots int, secretString string) {
 	b.Measure(0, 0).Measure(1, 1)
 	c, _ := b.BuildCircuit()
 	sim, _ := simulator.NewSimulatorWithRunner("qsim", simulator.SimulatorOptions{Shots: shots})
-	hist, _ := sim.Run(c)
-	analyzeSimonResults(2, hist, shots, secretString)
+	res, _ := sim.RunResult(c)
+	analyzeSimonResults(rep, 2, res, secretString)
 }
 
 // simonAlgorithm3Qubit runs Simon's algorithm for 3 qubits with the given secret string
 // Uses 6 qubits: 3 input qubits + 3 ancilla qubits
 // secretString is the hidden string s in big-endian format
-func simonAlgorithm3Qubit(shots int, secretString string) {
+func simonAlgorithm3Qubit(shots int, rep *report.Reporter, secretString string) {
 	b := builder.New(builder.Q(6), builder.C(3))
 	b.H(0).H(1).H(2)
 	applySimonOracle3Qubit(b, secretString)
@@ -71,8 +75,8 @@ func simonAlgorithm3Qubit(shots int, secretString string) {
 	b.Measure(0, 0).Measure(1, 1).Measure(2, 2)
 	c, _ := b.BuildCircuit()
 	sim, _ := simulator.NewSimulatorWithRunner("qsim", simulator.SimulatorOptions{Shots: shots})
-	hist, _ := sim.Run(c)
-	analyzeSimonResults(3, hist, shots, secretString)
+	res, _ := sim.RunResult(c)
+	analyzeSimonResults(rep, 3, res, secretString)
 }
 
 // applySimonOracle2Qubit applies the Simon oracle for 2 qubits
@@ -111,34 +115,39 @@ func applySimonOracle3Qubit(b builder.Builder, secretString string) {
 	}
 }
 
-func analyzeSimonResults(n int, hist map[string]int, shots int, secretString string) {
-	fmt.Printf("Results for secret string \"%s\":\n", secretString)
-	for state, count := range hist {
-		percentage := float64(count) / float64(shots) * 100
-		fmt.Printf("  |%s⟩: %d counts (%.2f%%)\n", state, count, percentage)
+// analyzeSimonResults reports the measured y, which must satisfy
+// y·s = 0 mod 2, and the secret solved from them over GF(2).
+func analyzeSimonResults(rep *report.Reporter, n int, res *simulator.Result, secretString string) {
+	sVal, _ := strconv.ParseInt(secretString, 2, 64)
+	var notes []string
+	if sVal == 0 {
+		notes = append(notes, "Function is one-to-one (no secret string)")
+	} else {
+		notes = append(notes, fmt.Sprintf("Function has secret string %q", secretString))
 	}
-
-	s_val, _ := strconv.ParseInt(secretString, 2, 64)
-	if s_val == 0 {
-		fmt.Printf("  → Function is one-to-one (no secret string)\n")
+	// Solve y·s = 0 over GF(2) for the measured y instead of trusting the
+	// expected states; bit i of s is qubit i, so %b prints it big-endian.
+	if s, err := analysis.SimonSecret(res.Counts); err != nil {
+		notes = append(notes, fmt.Sprintf("Could not solve for s: %v", err))
 	} else {
-		fmt.Printf("  → Function has secret string \"%s\"\n", secretString)
-		var expectedStates []string
-		// secretString is BE, y in the loop is BE. Dot product needs consistent endianness.
-		for i := 0; i < (1 << n); i++ {
-			y_str := fmt.Sprintf(fmt.Sprintf("%%0%db", n), i)
-			dot := 0
-			for j := range n {
-				if y_str[j] == '1' && secretString[j] == '1' {
-					dot++
-				}
-			}
-			if dot%2 == 0 {
-				expectedStates = append(expectedStates, y_str)
-			}
+		notes = append(notes, fmt.Sprintf("Recovered secret string from samples: \"%0*b\"", n, s))
+	}
+
+	var expected []string
+	for y := range 1 << n {
+		if dot := int64(y) & sVal; strings.Count(strconv.FormatInt(dot, 2), "1")%2 == 0 {
+			expected = append(expected, fmt.Sprintf("%0*b", n, y))
 		}
-		fmt.Printf("  → Expected states (y where y·s = 0 mod 2): %v\n", expectedStates)
 	}
+	rep.Case(report.Case{
+		Title:        fmt.Sprintf("Results for secret string %q:", secretString),
+		Result:       res,
+		Expected:     expected,
+		ListExpected: true,
+		Success:      "Measured y satisfy y·s = 0 mod 2",
+		Failure:      "Measured y do not satisfy y·s = 0 mod 2",
+		Notes:        notes,
+	})
 }
 
 // demonstrateOracleMappings shows explicit f(x) mappings for all Simon oracles
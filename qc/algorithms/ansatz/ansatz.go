@@ -0,0 +1,226 @@
+// Package ansatz generates the parameterized state preparations variational
+// algorithms start from. A Template plugs into gradient.Estimator as its
+// Ansatz, or is bound to concrete angles with Bind.
+package ansatz
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Entanglement selects the qubit pairs of an entangling layer.
+type Entanglement int
+
+const (
+	// Linear entangles neighbours (0,1), (1,2), ….
+	Linear Entanglement = iota
+	// Circular is Linear plus the pair (n-1, 0) closing the ring.
+	Circular
+	// Full entangles every pair i < j.
+	Full
+)
+
+func (e Entanglement) String() string {
+	switch e {
+	case Circular:
+		return "Circular"
+	case Full:
+		return "Full"
+	}
+	return "Linear"
+}
+
+// pairs lists the (control, target) pairs of a layer on n qubits.
+func (e Entanglement) pairs(n int) [][2]int {
+	var ps [][2]int
+	switch e {
+	case Full:
+		for i := range n {
+			for j := i + 1; j < n; j++ {
+				ps = append(ps, [2]int{i, j})
+			}
+		}
+	default:
+		for i := range n - 1 {
+			ps = append(ps, [2]int{i, i + 1})
+		}
+		if e == Circular && n > 2 {
+			ps = append(ps, [2]int{n - 1, 0})
+		}
+	}
+	return ps
+}
+
+// Options shape the layered ansätze.
+type Options struct {
+	Qubits int
+	// Reps is the number of entangling layers; each is followed by a
+	// rotation layer, and one more rotation layer comes first.
+	Reps         int
+	Entanglement Entanglement
+}
+
+func (o Options) validate() error {
+	if o.Qubits < 1 {
+		return fmt.Errorf("ansatz: need at least one qubit, got %d", o.Qubits)
+	}
+	if o.Reps < 0 {
+		return fmt.Errorf("ansatz: negative reps %d", o.Reps)
+	}
+	return nil
+}
+
+// Template is a parameterized state preparation. Apply reads exactly
+// Params angles from theta.
+type Template struct {
+	Name   string
+	Qubits int
+	Params int
+	Apply  gradient.Ansatz
+}
+
+// Bind returns the preparation for the given angles as a circuit without
+// classical bits, e.g. for rendering.
+func (t *Template) Bind(theta []float64) (circuit.Circuit, error) {
+	if len(theta) != t.Params {
+		return nil, fmt.Errorf("ansatz: %s takes %d parameters, got %d", t.Name, t.Params, len(theta))
+	}
+	b := builder.New(builder.Q(t.Qubits))
+	t.Apply(b, theta)
+	return b.BuildCircuit()
+}
+
+// RealAmplitudes alternates RY layers with CNOT layers, Reps+1 rotation
+// layers in all, so it prepares states with real amplitudes and takes
+// Qubits·(Reps+1) parameters. Angle k·Qubits+q rotates qubit q in layer k.
+func RealAmplitudes(o Options) (*Template, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	pairs := o.Entanglement.pairs(o.Qubits)
+	return &Template{
+		Name:   "RealAmplitudes",
+		Qubits: o.Qubits,
+		Params: o.Qubits * (o.Reps + 1),
+		Apply: func(b builder.Builder, theta []float64) {
+			for k := range o.Reps + 1 {
+				if k > 0 {
+					for _, p := range pairs {
+						b.CNOT(p[0], p[1])
+					}
+				}
+				for q := range o.Qubits {
+					b.RY(theta[k*o.Qubits+q], q)
+				}
+			}
+		},
+	}, nil
+}
+
+// HardwareEfficient alternates layers of RY then RZ on every qubit with
+// layers of CZ, the native entangler of many devices. It takes
+// 2·Qubits·(Reps+1) parameters; in layer k, angle 2(k·Qubits+q) is qubit
+// q's RY and the next one its RZ.
+func HardwareEfficient(o Options) (*Template, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	pairs := o.Entanglement.pairs(o.Qubits)
+	return &Template{
+		Name:   "HardwareEfficient",
+		Qubits: o.Qubits,
+		Params: 2 * o.Qubits * (o.Reps + 1),
+		Apply: func(b builder.Builder, theta []float64) {
+			for k := range o.Reps + 1 {
+				if k > 0 {
+					for _, p := range pairs {
+						b.CZ(p[0], p[1])
+					}
+				}
+				for q := range o.Qubits {
+					i := 2 * (k*o.Qubits + q)
+					b.RY(theta[i], q).RZ(theta[i+1], q)
+				}
+			}
+		},
+	}, nil
+}
+
+// UCCSDLite is a particle-conserving, unitary-coupled-cluster-like ansatz:
+// from the Hartree-Fock state with qubits 0..electrons-1 occupied it
+// applies one Givens rotation per single excitation i→a and one per double
+// excitation ij→ab, rotating |…1_i…0_a…⟩ into |…0_i…1_a…⟩ and
+// |1_i1_j0_a0_b⟩ into |0_i0_j1_a1_b⟩. It is "lite" because the
+// excitations carry no Jordan-Wigner parity strings and are applied once,
+// not Trotterised. Parameters are the singles in (i, a) order, then the
+// doubles in (i, j, a, b) order.
+//
+// The rotations have three distinct generator eigenvalues, so the
+// two-term parameter-shift rule of gradient.Estimator is not exact for
+// this ansatz; prefer a gradient-free optimizer such as SPSA or COBYLA.
+func UCCSDLite(qubits, electrons int) (*Template, error) {
+	if electrons < 1 || electrons >= qubits {
+		return nil, fmt.Errorf("ansatz: UCCSD needs 0 < electrons < qubits, got %d electrons on %d qubits", electrons, qubits)
+	}
+	type excitation struct{ from, to []int }
+	var exs []excitation
+	for i := range electrons {
+		for a := electrons; a < qubits; a++ {
+			exs = append(exs, excitation{[]int{i}, []int{a}})
+		}
+	}
+	for i := range electrons {
+		for j := i + 1; j < electrons; j++ {
+			for a := electrons; a < qubits; a++ {
+				for bb := a + 1; bb < qubits; bb++ {
+					exs = append(exs, excitation{[]int{i, j}, []int{a, bb}})
+				}
+			}
+		}
+	}
+	return &Template{
+		Name:   "UCCSDLite",
+		Qubits: qubits,
+		Params: len(exs),
+		Apply: func(b builder.Builder, theta []float64) {
+			for i := range electrons {
+				b.X(i)
+			}
+			for k, ex := range exs {
+				if len(ex.from) == 1 {
+					single(b, theta[k], ex.from[0], ex.to[0])
+				} else {
+					double(b, theta[k], ex.from[0], ex.from[1], ex.to[0], ex.to[1])
+				}
+			}
+		},
+	}, nil
+}
+
+// single rotates |1_i 0_a⟩ towards |0_i 1_a⟩ by θ: the CNOT maps both onto
+// a = 1, where a controlled RY on i mixes them.
+func single(b builder.Builder, theta float64, i, a int) {
+	cry, err := decompose.Controlled(gate.RY(theta), 1)
+	if err != nil {
+		panic(err) // RY is always controllable
+	}
+	b.CNOT(i, a).Apply(cry, a, i).CNOT(i, a)
+}
+
+// double rotates |1_i 1_j 0_a 0_b⟩ towards |0_i 0_j 1_a 1_b⟩ by θ: the
+// CNOTs from i map both onto j,a,b = 0,1,1, which no other basis state
+// reaches, and an RY on i controlled on that pattern mixes them.
+func double(b builder.Builder, theta float64, i, j, a, bb int) {
+	cry, err := decompose.Controlled(gate.RY(theta), 3)
+	if err != nil {
+		panic(err) // RY is always controllable
+	}
+	b.CNOT(i, j).CNOT(i, a).CNOT(i, bb).X(j)
+	b.Apply(cry, j, a, bb, i)
+	b.X(j).CNOT(i, bb).CNOT(i, a).CNOT(i, j)
+}
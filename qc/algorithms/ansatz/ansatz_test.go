@@ -0,0 +1,105 @@
+package ansatz
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// measureAll runs t at theta with every qubit measured.
+func measureAll(t *testing.T, tmpl *Template, theta []float64) map[string]int {
+	t.Helper()
+	b := builder.New(builder.Q(tmpl.Qubits), builder.C(tmpl.Qubits))
+	tmpl.Apply(b, theta)
+	for q := range tmpl.Qubits {
+		b.Measure(q, q)
+	}
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 256, Runner: qsim.NewQSimRunner()})
+	hist, err := sim.Run(c)
+	require.NoError(t, err)
+	return hist
+}
+
+func TestLayered(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.Len(Linear.pairs(4), 3)
+	assert.Len(Circular.pairs(4), 4)
+	assert.Len(Full.pairs(4), 6)
+	assert.Len(Circular.pairs(2), 1, "a two-qubit ring is just the one pair")
+
+	ra, err := RealAmplitudes(Options{Qubits: 3, Reps: 2, Entanglement: Circular})
+	require.NoError(err)
+	assert.Equal(9, ra.Params)
+	he, err := HardwareEfficient(Options{Qubits: 3, Reps: 2, Entanglement: Full})
+	require.NoError(err)
+	assert.Equal(18, he.Params)
+
+	// All-zero angles leave |000⟩ alone; RY(π) on qubit 1 in the last
+	// layer flips it after the entanglers.
+	assert.Equal(map[string]int{"000": 256}, measureAll(t, ra, make([]float64, 9)))
+	theta := make([]float64, 9)
+	theta[7] = math.Pi
+	assert.Equal(map[string]int{"010": 256}, measureAll(t, ra, theta))
+
+	c, err := he.Bind(make([]float64, 18))
+	require.NoError(err)
+	assert.Equal(3, c.Qubits())
+	_, err = he.Bind(make([]float64, 3))
+	assert.Error(err)
+
+	_, err = RealAmplitudes(Options{Qubits: 0})
+	assert.Error(err)
+}
+
+func TestUCCSDLite(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	u, err := UCCSDLite(4, 2)
+	require.NoError(err)
+	assert.Equal(4+1, u.Params, "four singles and one double")
+
+	assert.Equal(map[string]int{"1100": 256}, measureAll(t, u, make([]float64, 5)), "Hartree-Fock state")
+	theta := make([]float64, 5)
+	theta[4] = math.Pi
+	assert.Equal(map[string]int{"0011": 256}, measureAll(t, u, theta), "the double excitation moves both electrons")
+
+	rng := rand.New(rand.NewSource(1))
+	for i := range theta {
+		theta[i] = rng.Float64() * 2 * math.Pi
+	}
+	hist := measureAll(t, u, theta)
+	assert.Greater(len(hist), 1)
+	for key := range hist {
+		assert.Equal(2, strings.Count(key, "1"), "particle number is conserved: %s", key)
+	}
+
+	_, err = UCCSDLite(2, 2)
+	assert.Error(err)
+}
+
+func TestWithEstimator(t *testing.T) {
+	ra, err := RealAmplitudes(Options{Qubits: 2, Reps: 1})
+	require.NoError(t, err)
+	est := &gradient.Estimator{
+		Sim:         simulator.NewSimulator(simulator.SimulatorOptions{Shots: 512, Runner: qsim.NewQSimRunner(), Seed: 1}),
+		Qubits:      ra.Qubits,
+		Ansatz:      ra.Apply,
+		Hamiltonian: gradient.Hamiltonian{{Coeff: 1, Paulis: "ZZ"}},
+	}
+	grad, err := est.Gradient(make([]float64, ra.Params))
+	require.NoError(t, err)
+	assert.Len(t, grad, ra.Params)
+}
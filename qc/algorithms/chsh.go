@@ -0,0 +1,90 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// CHSHAngles are the measurement directions, in the X-Z plane and measured
+// from Z, of Alice (A0, A1) and Bob (B0, B1).
+type CHSHAngles struct {
+	A0, A1, B0, B1 float64
+}
+
+// OptimalCHSHAngles reach Tsirelson's bound S = 2√2 on the Bell state.
+var OptimalCHSHAngles = CHSHAngles{A0: 0, A1: math.Pi / 2, B0: math.Pi / 4, B1: -math.Pi / 4}
+
+// settings lists the four (Alice, Bob) pairs in the order of CHSHResult.
+func (a CHSHAngles) settings() [4][2]float64 {
+	return [4][2]float64{{a.A0, a.B0}, {a.A0, a.B1}, {a.A1, a.B0}, {a.A1, a.B1}}
+}
+
+// CHSHCircuits returns one circuit per setting: prepare (|00⟩+|11⟩)/√2,
+// rotate each qubit so that its direction maps onto Z, and measure Alice's
+// qubit 0 into cbit 0 and Bob's qubit 1 into cbit 1.
+func CHSHCircuits(a CHSHAngles) ([4]circuit.Circuit, error) {
+	var cs [4]circuit.Circuit
+	for i, s := range a.settings() {
+		b := builder.New(builder.Q(2), builder.C(2))
+		b.H(0).CNOT(0, 1).RY(-s[0], 0).RY(-s[1], 1).Measure(0, 0).Measure(1, 1)
+		c, err := b.BuildCircuit()
+		if err != nil {
+			return cs, fmt.Errorf("algorithms: CHSH setting %d: %w", i, err)
+		}
+		cs[i] = c
+	}
+	return cs, nil
+}
+
+// CHSHResult holds the measured correlations of the four settings, in the
+// order (A0,B0), (A0,B1), (A1,B0), (A1,B1), with their standard errors.
+type CHSHResult struct {
+	Correlations [4]float64
+	Errors       [4]float64
+	// S = E(A0,B0) + E(A0,B1) + E(A1,B0) - E(A1,B1). Local hidden-variable
+	// models give |S| ≤ 2.
+	S, SError float64
+}
+
+// Violates reports whether |S| exceeds the classical bound 2 by more than
+// k standard errors.
+func (r *CHSHResult) Violates(k float64) bool {
+	return math.Abs(r.S)-k*r.SError > 2
+}
+
+// RunCHSH builds the four CHSH circuits, runs each on sim and computes S.
+// The correlation of a setting is E = P(equal) - P(different) with
+// standard error √((1-E²)/shots).
+func RunCHSH(sim *simulator.Simulator, a CHSHAngles) (*CHSHResult, error) {
+	cs, err := CHSHCircuits(a)
+	if err != nil {
+		return nil, err
+	}
+	res := &CHSHResult{}
+	variance := 0.0
+	for i, c := range cs {
+		hist, err := sim.Run(c)
+		if err != nil {
+			return nil, fmt.Errorf("algorithms: CHSH setting %d: %w", i, err)
+		}
+		same, shots := hist["00"]+hist["11"], 0
+		for _, n := range hist {
+			shots += n
+		}
+		if shots == 0 {
+			return nil, fmt.Errorf("algorithms: CHSH setting %d produced no shots", i)
+		}
+		e := float64(2*same-shots) / float64(shots)
+		v := (1 - e*e) / float64(shots)
+		res.Correlations[i], res.Errors[i] = e, math.Sqrt(v)
+		variance += v
+	}
+	e := res.Correlations
+	res.S = e[0] + e[1] + e[2] - e[3]
+	res.SError = math.Sqrt(variance)
+	return res, nil
+}
@@ -0,0 +1,33 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCHSH(t *testing.T) {
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 4000, Runner: qsim.NewQSimRunner()})
+
+	res, err := RunCHSH(sim, OptimalCHSHAngles)
+	require.NoError(t, err)
+	for i, e := range res.Correlations {
+		want := math.Sqrt2 / 2
+		if i == 3 {
+			want = -want
+		}
+		assert.InDelta(t, want, e, 6*res.Errors[i], "setting %d", i)
+	}
+	assert.InDelta(t, 2*math.Sqrt2, res.S, 6*res.SError)
+	assert.True(t, res.Violates(5), "S = %.3f ± %.3f", res.S, res.SError)
+
+	// Aligned directions are perfectly correlated and stay classical: S = 2.
+	res, err = RunCHSH(sim, CHSHAngles{})
+	require.NoError(t, err)
+	assert.InDelta(t, 2, res.S, 1e-12)
+	assert.False(t, res.Violates(0))
+}
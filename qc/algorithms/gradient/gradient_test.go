@@ -0,0 +1,51 @@
+package gradient
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGradient(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// RY(a)|0⟩ ⊗ RX(b)|0⟩ has ⟨Z⊗I⟩ = cos a and ⟨I⊗Y⟩ = −sin b, so
+	// ⟨H⟩ = 1 + cos a − ½ sin b and ∇⟨H⟩ = (−sin a, −½ cos b).
+	est := &Estimator{
+		Sim:    simulator.NewSimulator(simulator.SimulatorOptions{Shots: 20000, Runner: qsim.NewQSimRunner(), Seed: 3}),
+		Qubits: 2,
+		Ansatz: func(b builder.Builder, theta []float64) {
+			b.RY(theta[0], 0).RX(theta[1], 1)
+		},
+		Hamiltonian: Hamiltonian{{Coeff: 1, Paulis: "II"}, {Coeff: 1, Paulis: "Z"}, {Coeff: 0.5, Paulis: "IY"}},
+		Workers:     3,
+	}
+	theta := []float64{0.7, -1.1}
+
+	v, err := est.Expectation(theta)
+	require.NoError(err)
+	assert.InDelta(1+math.Cos(0.7)-0.5*math.Sin(-1.1), v, 0.03)
+
+	grad, err := est.Gradient(theta)
+	require.NoError(err)
+	require.Len(grad, 2)
+	assert.InDelta(-math.Sin(0.7), grad[0], 0.03)
+	assert.InDelta(-0.5*math.Cos(-1.1), grad[1], 0.03)
+
+	again, err := est.Gradient(theta)
+	require.NoError(err)
+	assert.Equal(grad, again, "seeded runs are reproducible whatever the scheduling")
+
+	est.Hamiltonian = Hamiltonian{{Coeff: 1, Paulis: "ZZZ"}}
+	_, err = est.Gradient(theta)
+	assert.Error(err)
+	est.Hamiltonian = Hamiltonian{{Coeff: 1, Paulis: "ZA"}}
+	_, err = est.Expectation(theta)
+	assert.Error(err)
+}
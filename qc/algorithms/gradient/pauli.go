@@ -0,0 +1,83 @@
+package gradient
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Term is one weighted Pauli string of a Hamiltonian. Paulis[q] is the
+// factor on qubit q, one of 'I', 'X', 'Y' and 'Z'; qubits past the end of
+// the string carry I.
+type Term struct {
+	Coeff  float64
+	Paulis string
+}
+
+// Hamiltonian is a real linear combination of Pauli strings.
+type Hamiltonian []Term
+
+// validate checks every term against the width of the ansatz.
+func (h Hamiltonian) validate(qubits int) error {
+	for i, t := range h {
+		if len(t.Paulis) > qubits {
+			return fmt.Errorf("gradient: term %d %q acts on %d qubits, ansatz has %d", i, t.Paulis, len(t.Paulis), qubits)
+		}
+		if strings.Trim(t.Paulis, "IXYZ") != "" {
+			return fmt.Errorf("gradient: term %d %q is not a Pauli string", i, t.Paulis)
+		}
+	}
+	return nil
+}
+
+// identity reports whether t is a multiple of the identity, which needs no
+// circuit to evaluate.
+func (t Term) identity() bool {
+	return strings.Trim(t.Paulis, "I") == ""
+}
+
+// measurement builds ansatz(theta) followed by the basis change that maps
+// t's Pauli factors onto Z, and measures each non-identity qubit into the
+// next cbit. The parity of the outcome is then the eigenvalue of t.
+func (t Term) measurement(qubits int, ansatz Ansatz, theta []float64) (circuit.Circuit, error) {
+	var measured []int
+	for q, p := range t.Paulis {
+		if p != 'I' {
+			measured = append(measured, q)
+		}
+	}
+	b := builder.New(builder.Q(qubits), builder.C(len(measured)))
+	ansatz(b, theta)
+	for i, q := range measured {
+		switch t.Paulis[q] {
+		case 'X':
+			b.H(q)
+		case 'Y':
+			// RX(π/2)† Z RX(π/2) = Y.
+			b.RX(math.Pi/2, q)
+		}
+		b.Measure(q, i)
+	}
+	return b.BuildCircuit()
+}
+
+// parity returns the mean eigenvalue, in [-1, 1], of a parity histogram.
+func parity(hist map[string]int) (float64, error) {
+	sum, shots := 0, 0
+	for key, n := range hist {
+		key, _, _ = strings.Cut(key, "|")
+		if strings.Count(key, "1")%2 == 0 {
+			sum += n
+		} else {
+			sum -= n
+		}
+		shots += n
+	}
+	if shots == 0 {
+		return 0, fmt.Errorf("gradient: run produced no shots")
+	}
+	return float64(sum) / float64(shots), nil
+}
@@ -0,0 +1,249 @@
+// Package hhl builds the Harrow-Hassidim-Lloyd linear-system algorithm for
+// toy 2×2 and 4×4 real symmetric systems Ax = b. It is a demonstration:
+// the controlled evolutions e^{iAt·2^j} are synthesised from the classical
+// eigendecomposition of A, which a real application would not have.
+//
+// The circuit prepares |b⟩, estimates the eigenvalues of A into a clock
+// register with phase estimation, rotates an ancilla by C/λ conditioned on
+// every clock value, and uncomputes the phase estimation. Measuring the
+// ancilla as 1 leaves the system register in |x⟩ ∝ A⁻¹b.
+package hhl
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/synth"
+)
+
+// Options describe the system and the phase-estimation precision.
+type Options struct {
+	// A is a real symmetric, non-singular 2×2 or 4×4 matrix.
+	A [][]float64
+	// B is the right-hand side; only its direction matters.
+	B []float64
+	// ClockBits is the width of the eigenvalue register; 0 means 4. It
+	// holds signed values, so eigenvalues up to (2^(ClockBits-1) − 1)
+	// times the smallest one in magnitude are told apart.
+	ClockBits int
+	// Time is the evolution time t. 0 picks t = 2π/(2^ClockBits·|λ_min|),
+	// so the smallest eigenvalue reads as clock value ±1 and estimation is
+	// exact when all eigenvalues are integer multiples of it.
+	Time float64
+}
+
+// HHL is a built solver circuit. Qubit 0 is the ancilla, measured into
+// cbit 0; qubits 1..ClockBits the clock; the system qubits follow, system
+// qubit i measured into cbit 1+i.
+type HHL struct {
+	Circuit     circuit.Circuit
+	Eigenvalues []float64 // of A, ascending
+	Time        float64
+	// C is the rotation constant: the ancilla turns by arcsin(C/λ̃) for an
+	// estimated eigenvalue λ̃.
+	C float64
+
+	system int // system qubits
+}
+
+// Build constructs the HHL circuit for opts.
+func Build(opts Options) (*HHL, error) {
+	n, err := check(opts)
+	if err != nil {
+		return nil, err
+	}
+	clock := opts.ClockBits
+	if clock == 0 {
+		clock = 4
+	}
+	if clock < 2 {
+		return nil, fmt.Errorf("hhl: need at least 2 clock bits, got %d", clock)
+	}
+	vals, vecs := jacobi(opts.A)
+	minAbs, maxAbs := math.Inf(1), 0.0
+	for _, l := range vals {
+		minAbs, maxAbs = min(minAbs, math.Abs(l)), max(maxAbs, math.Abs(l))
+	}
+	if minAbs < 1e-9*maxAbs || maxAbs == 0 {
+		return nil, fmt.Errorf("hhl: matrix is singular")
+	}
+	t := opts.Time
+	if t == 0 {
+		t = 2 * math.Pi / (float64(int(1)<<clock) * minAbs)
+	}
+	if limit := float64(int(1)<<(clock-1)) - 1; maxAbs*t*float64(int(1)<<clock)/(2*math.Pi) > limit+0.5 {
+		return nil, fmt.Errorf("hhl: eigenvalue %g overflows %d clock bits at t=%g", maxAbs, clock, t)
+	}
+
+	anc, clk, sys := 0, span(1, clock), span(1+clock, n)
+	var qpe program
+	for _, q := range clk {
+		qpe.add(gate.H(), gate.H(), q)
+	}
+	for j, q := range clk {
+		p := float64(int(1) << j)
+		cu, err := controlledEvolution(vals, vecs, t*p)
+		if err != nil {
+			return nil, err
+		}
+		cuInv, err := controlledEvolution(vals, vecs, -t*p)
+		if err != nil {
+			return nil, err
+		}
+		qpe.add(cu, cuInv, append([]int{q}, sys...)...)
+	}
+	qpe.inverseQFT(clk)
+
+	b := builder.New(builder.Q(1+clock+n), builder.C(1+n))
+	amps := make([]complex128, len(opts.B))
+	norm := 0.0
+	for _, v := range opts.B {
+		norm += v * v
+	}
+	for i, v := range opts.B {
+		amps[i] = complex(v/math.Sqrt(norm), 0)
+	}
+	b.Initialize(amps, sys...)
+	qpe.apply(b)
+
+	// The smallest estimate in magnitude is one clock step, so C/λ̃ = 1/k
+	// for the signed clock value k.
+	for k := 1; k < 1<<clock; k++ {
+		signed := k
+		if k >= 1<<(clock-1) {
+			signed -= 1 << clock
+		}
+		cry, err := decompose.Controlled(gate.RY(2*math.Asin(1/float64(signed))), clock)
+		if err != nil {
+			return nil, fmt.Errorf("hhl: %w", err)
+		}
+		// Fire on clock == k by flipping the bits that must be 0.
+		for i, q := range clk {
+			if k&(1<<i) == 0 {
+				b.X(q)
+			}
+		}
+		b.Apply(cry, append(append([]int(nil), clk...), anc)...)
+		for i, q := range clk {
+			if k&(1<<i) == 0 {
+				b.X(q)
+			}
+		}
+	}
+
+	qpe.applyInverse(b)
+	b.Measure(anc, 0)
+	for i, q := range sys {
+		b.Measure(q, 1+i)
+	}
+	c, err := b.BuildCircuit()
+	if err != nil {
+		return nil, fmt.Errorf("hhl: %w", err)
+	}
+	return &HHL{
+		Circuit:     c,
+		Eigenvalues: vals,
+		Time:        t,
+		C:           2 * math.Pi / (float64(int(1)<<clock) * t),
+		system:      n,
+	}, nil
+}
+
+// Decode turns a histogram of the circuit into the estimated |x_i|², from
+// the shots whose ancilla read 1, and the fraction of such shots.
+func (h *HHL) Decode(hist map[string]int) (probs []float64, success float64, err error) {
+	probs = make([]float64, 1<<h.system)
+	kept, shots := 0, 0
+	for key, n := range hist {
+		if len(key) < 1+h.system {
+			return nil, 0, fmt.Errorf("hhl: key %q is shorter than %d bits", key, 1+h.system)
+		}
+		shots += n
+		if key[0] != '1' {
+			continue
+		}
+		i := 0
+		for bit := range h.system {
+			if key[1+bit] == '1' {
+				i |= 1 << bit
+			}
+		}
+		probs[i] += float64(n)
+		kept += n
+	}
+	if kept == 0 {
+		return nil, 0, fmt.Errorf("hhl: no shot flagged success")
+	}
+	for i := range probs {
+		probs[i] /= float64(kept)
+	}
+	return probs, float64(kept) / float64(shots), nil
+}
+
+// check validates opts and returns the number of system qubits.
+func check(opts Options) (int, error) {
+	n := 0
+	switch len(opts.A) {
+	case 2:
+		n = 1
+	case 4:
+		n = 2
+	default:
+		return 0, fmt.Errorf("hhl: matrix must be 2×2 or 4×4, got %d rows", len(opts.A))
+	}
+	for i, row := range opts.A {
+		if len(row) != len(opts.A) {
+			return 0, fmt.Errorf("hhl: row %d has %d entries, want %d", i, len(row), len(opts.A))
+		}
+		for j := range i {
+			if math.Abs(row[j]-opts.A[j][i]) > 1e-9 {
+				return 0, fmt.Errorf("hhl: matrix is not symmetric at (%d,%d)", i, j)
+			}
+		}
+	}
+	if len(opts.B) != len(opts.A) {
+		return 0, fmt.Errorf("hhl: right-hand side has %d entries, want %d", len(opts.B), len(opts.A))
+	}
+	for _, v := range opts.B {
+		if v != 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("hhl: right-hand side is zero")
+}
+
+// controlledEvolution returns e^{iAt} controlled on its first qubit, A
+// given by its eigendecomposition.
+func controlledEvolution(vals []float64, vecs [][]float64, t float64) (gate.Gate, error) {
+	d := len(vals)
+	u := make([][]complex128, d)
+	for r := range d {
+		u[r] = make([]complex128, d)
+		for c := range d {
+			for k, l := range vals {
+				u[r][c] += complex(vecs[r][k]*vecs[c][k], 0) * complex(math.Cos(l*t), math.Sin(l*t))
+			}
+		}
+	}
+	g, err := synth.Decompose(u, synth.RotationBasis)
+	if err != nil {
+		return nil, fmt.Errorf("hhl: %w", err)
+	}
+	cg, err := decompose.Controlled(g, 1)
+	if err != nil {
+		return nil, fmt.Errorf("hhl: %w", err)
+	}
+	return cg, nil
+}
+
+func span(from, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = from + i
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package hhl
+
+import (
+	"testing"
+
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// solve solves a x = b by Gaussian elimination with partial pivoting.
+func solve(a [][]float64, b []float64) []float64 {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range n {
+		m[i] = append(append([]float64(nil), a[i]...), b[i])
+	}
+	for col := range n {
+		piv := col
+		for r := col + 1; r < n; r++ {
+			if abs(m[r][col]) > abs(m[piv][col]) {
+				piv = r
+			}
+		}
+		m[col], m[piv] = m[piv], m[col]
+		for r := range n {
+			if r != col {
+				f := m[r][col] / m[col][col]
+				for k := col; k <= n; k++ {
+					m[r][k] -= f * m[col][k]
+				}
+			}
+		}
+	}
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = m[i][n] / m[i][i]
+	}
+	return x
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestHHL(t *testing.T) {
+	cases := map[string]Options{
+		"2x2": {A: [][]float64{{1.5, 0.5}, {0.5, 1.5}}, B: []float64{1, 0}, ClockBits: 3},
+		// Eigenvalues 3, −1, 3 and 1, so the clock must hold signed values.
+		"4x4": {A: [][]float64{{1, 2, 0, 0}, {2, 1, 0, 0}, {0, 0, 2, 1}, {0, 0, 1, 2}}, B: []float64{1, 1, 1, 0}},
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 8000, Runner: qsim.NewQSimRunner(), Seed: 11})
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			h, err := Build(opts)
+			require.NoError(err)
+			hist, err := sim.Run(h.Circuit)
+			require.NoError(err)
+			probs, success, err := h.Decode(hist)
+			require.NoError(err)
+			assert.Positive(success)
+
+			x := solve(opts.A, opts.B)
+			norm := 0.0
+			for _, v := range x {
+				norm += v * v
+			}
+			for i, v := range x {
+				assert.InDelta(v*v/norm, probs[i], 0.03, "|x_%d|²", i)
+			}
+		})
+	}
+}
+
+func TestJacobi(t *testing.T) {
+	a := [][]float64{{4, 1, 0, 2}, {1, 3, 1, 0}, {0, 1, 2, 1}, {2, 0, 1, 5}}
+	vals, vecs := jacobi(a)
+	for k, l := range vals {
+		for r := range a {
+			av := 0.0
+			for c := range a {
+				av += a[r][c] * vecs[c][k]
+			}
+			assert.InDelta(t, l*vecs[r][k], av, 1e-9)
+		}
+		if k > 0 {
+			assert.LessOrEqual(t, vals[k-1], l)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"size":       {A: [][]float64{{1}}, B: []float64{1}},
+		"asymmetric": {A: [][]float64{{1, 2}, {0, 1}}, B: []float64{1, 0}},
+		"singular":   {A: [][]float64{{1, 1}, {1, 1}}, B: []float64{1, 0}},
+		"zero b":     {A: [][]float64{{1, 0}, {0, 2}}, B: []float64{0, 0}},
+		"overflow":   {A: [][]float64{{1, 0}, {0, 9}}, B: []float64{1, 1}, ClockBits: 3},
+	} {
+		_, err := Build(opts)
+		assert.Error(t, err, name)
+	}
+}
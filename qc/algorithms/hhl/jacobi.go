@@ -0,0 +1,73 @@
+package hhl
+
+import (
+	"math"
+	"sort"
+)
+
+// jacobi diagonalises the real symmetric matrix a with cyclic Jacobi
+// rotations. It returns the eigenvalues in ascending order and the matrix
+// whose column k is the eigenvector of eigenvalue k.
+func jacobi(a [][]float64) ([]float64, [][]float64) {
+	n := len(a)
+	m := make([][]float64, n)
+	v := make([][]float64, n)
+	for i := range n {
+		m[i] = append([]float64(nil), a[i]...)
+		v[i] = make([]float64, n)
+		v[i][i] = 1
+	}
+	for range 100 {
+		off := 0.0
+		for i := range n {
+			for j := i + 1; j < n; j++ {
+				off += m[i][j] * m[i][j]
+			}
+		}
+		if off < 1e-24 {
+			break
+		}
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				if m[p][q] == 0 {
+					continue
+				}
+				// Choose the rotation that zeroes m[p][q].
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := range n {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p], m[k][q] = c*mkp-s*mkq, s*mkp+c*mkq
+				}
+				for k := range n {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k], m[q][k] = c*mpk-s*mqk, s*mpk+c*mqk
+				}
+				for k := range n {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return m[order[i]][order[i]] < m[order[j]][order[j]] })
+	vals := make([]float64, n)
+	vecs := make([][]float64, n)
+	for r := range n {
+		vecs[r] = make([]float64, n)
+	}
+	for k, o := range order {
+		vals[k] = m[o][o]
+		for r := range n {
+			vecs[r][k] = v[r][o]
+		}
+	}
+	return vals, vecs
+}
@@ -0,0 +1,54 @@
+package hhl
+
+import (
+	"math"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// step is one gate together with its inverse.
+type step struct {
+	g, inv gate.Gate
+	qs     []int
+}
+
+// program records gates so that they can be played forwards, or inverted
+// by playing the inverses backwards to uncompute them.
+type program []step
+
+func (p *program) add(g, inv gate.Gate, qs ...int) {
+	*p = append(*p, step{g, inv, qs})
+}
+
+func (p program) apply(b builder.Builder) {
+	for _, s := range p {
+		b.Apply(s.g, s.qs...)
+	}
+}
+
+func (p program) applyInverse(b builder.Builder) {
+	for i := len(p) - 1; i >= 0; i-- {
+		b.Apply(p[i].inv, p[i].qs...)
+	}
+}
+
+// inverseQFT records the inverse QFT on qs, qs[i] holding bit i of the
+// result. Phase estimation leaves qs[j] with phase 2π·k·2^j/2^n, whose
+// top fractional bit is bit n-1-j of k; the highest qubit is read first
+// and the lower bits it carries are cancelled with controlled phases, and
+// the swaps put the bits back in little-endian order.
+func (p *program) inverseQFT(qs []int) {
+	n := len(qs)
+	for j := n - 1; j >= 0; j-- {
+		// qs[j] carries bits m < n-1-j of k, already read into qs[n-1-m].
+		for m := range n - 1 - j {
+			theta := -2 * math.Pi / float64(int(1)<<(n-m-j))
+			p.add(gate.CP(theta), gate.CP(-theta), qs[n-1-m], qs[j])
+		}
+		p.add(gate.H(), gate.H(), qs[j])
+	}
+	for i := range n / 2 {
+		p.add(gate.Swap(), gate.Swap(), qs[i], qs[n-1-i])
+	}
+}
@@ -0,0 +1,102 @@
+// Package algorithms collects ready-made circuit constructions for common
+// quantum algorithms, built on top of the builder package.
+package algorithms
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// IPEOptions describes the unitary U whose eigenphase is estimated.
+type IPEOptions struct {
+	// Bits is the number of phase bits to extract.
+	Bits int
+	// Targets is the width of the register holding the eigenstate.
+	Targets int
+	// Prepare puts the target register into an eigenstate of U. It may be nil
+	// when |0…0⟩ already is one.
+	Prepare func(b builder.Builder, targets []int)
+	// ControlledPower applies U^power to targets, controlled on ctrl.
+	ControlledPower func(b builder.Builder, ctrl int, targets []int, power int)
+}
+
+// ControlledPowerOf returns an IPEOptions.ControlledPower for an arbitrary
+// gate u, e.g. one made with builder.DefineGate: its controlled form, see
+// decompose.Controlled, is applied power times.
+func ControlledPowerOf(u gate.Gate) (func(b builder.Builder, ctrl int, targets []int, power int), error) {
+	cu, err := decompose.Controlled(u, 1)
+	if err != nil {
+		return nil, fmt.Errorf("algorithms: %w", err)
+	}
+	return func(b builder.Builder, ctrl int, targets []int, power int) {
+		qs := append([]int{ctrl}, targets...)
+		for range power {
+			b.Apply(cu, qs...)
+		}
+	}, nil
+}
+
+// IterativePhaseEstimation builds Kitaev-style iterative phase estimation:
+// a single ancilla (qubit 0) is reused for every bit, from the least
+// significant one up. Each round applies controlled-U^(2^k), undoes the
+// phase contributed by the bits already measured with classically
+// controlled P gates, measures, and resets the ancilla with a conditional X.
+//
+// Only Targets+1 qubits are simulated, against Bits+Targets for textbook
+// QPE. Classical bit i holds bit i of the integer estimate, so the phase is
+// that integer divided by 2^Bits; see PhaseFromKey.
+func IterativePhaseEstimation(opts IPEOptions) (circuit.Circuit, error) {
+	if opts.Bits < 1 {
+		return nil, fmt.Errorf("algorithms: IPE needs at least one bit, got %d", opts.Bits)
+	}
+	if opts.Targets < 1 {
+		return nil, fmt.Errorf("algorithms: IPE needs at least one target qubit, got %d", opts.Targets)
+	}
+	if opts.ControlledPower == nil {
+		return nil, fmt.Errorf("algorithms: IPE needs a ControlledPower function")
+	}
+
+	const anc = 0
+	targets := make([]int, opts.Targets)
+	for i := range targets {
+		targets[i] = i + 1
+	}
+
+	b := builder.New(builder.Q(opts.Targets+1), builder.C(opts.Bits))
+	if opts.Prepare != nil {
+		opts.Prepare(b, targets)
+	}
+
+	// Round k extracts bit k (cbit k), starting from the least significant.
+	for k := range opts.Bits {
+		b.H(anc)
+		opts.ControlledPower(b, anc, targets, 1<<(opts.Bits-1-k))
+		for j := range k {
+			// Bit j contributes 2π·2^(j-k-1) to this round's phase.
+			angle := -2 * math.Pi / float64(int(1)<<(k-j+1))
+			b.If(builder.Bit(j), func(b builder.Builder) { b.P(angle, anc) })
+		}
+		b.H(anc).Measure(anc, k)
+		if k < opts.Bits-1 {
+			b.If(builder.Bit(k), func(b builder.Builder) { b.X(anc) })
+		}
+	}
+	return b.BuildCircuit()
+}
+
+// PhaseFromKey decodes an IPE histogram key, written with classical bit 0
+// first as the simulator reports it, into a phase in [0, 1).
+func PhaseFromKey(key string) float64 {
+	v := 0
+	for i, ch := range key {
+		if ch == '1' {
+			v |= 1 << i
+		}
+	}
+	return float64(v) / float64(int(1)<<len(key))
+}
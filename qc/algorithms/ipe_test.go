@@ -0,0 +1,85 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/itsu"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterativePhaseEstimation(t *testing.T) {
+	const shots = 64
+	phaseGate := func(phi float64) IPEOptions {
+		return IPEOptions{
+			Bits:    4,
+			Targets: 1,
+			Prepare: func(b builder.Builder, q []int) { b.X(q[0]) },
+			ControlledPower: func(b builder.Builder, ctrl int, q []int, power int) {
+				b.CP(2*math.Pi*phi*float64(power), ctrl, q[0])
+			},
+		}
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: shots, Runner: itsu.NewItsuOneShotRunner()})
+
+	t.Run("Exact", func(t *testing.T) {
+		c, err := IterativePhaseEstimation(phaseGate(11.0 / 16))
+		require.NoError(t, err)
+		assert.Equal(t, 2, c.Qubits(), "one ancilla plus the target")
+
+		hist, err := sim.Run(c)
+		require.NoError(t, err)
+		require.Len(t, hist, 1, "a phase with an exact 4-bit expansion is found deterministically")
+		for key := range hist {
+			assert.Equal(t, "1101", key)
+			assert.Equal(t, 11.0/16, PhaseFromKey(key))
+		}
+	})
+
+	t.Run("Approximate", func(t *testing.T) {
+		c, err := IterativePhaseEstimation(phaseGate(0.3))
+		require.NoError(t, err)
+		hist, err := sim.Run(c)
+		require.NoError(t, err)
+
+		best, bestCount := "", 0
+		for key, n := range hist {
+			if n > bestCount {
+				best, bestCount = key, n
+			}
+		}
+		assert.InDelta(t, 0.3, PhaseFromKey(best), 1.0/16)
+	})
+
+	_, err := IterativePhaseEstimation(IPEOptions{Bits: 0, Targets: 1})
+	assert.Error(t, err)
+}
+
+func TestIterativePhaseEstimation_DefinedGate(t *testing.T) {
+	// |11⟩ is an eigenstate of U with phase 3π/4, i.e. 3/8 of a turn.
+	u, err := builder.BuildGate("U", 2, func(b builder.Builder, q []int) {
+		b.SWAP(q[0], q[1]).CP(math.Pi/2, q[0], q[1]).P(math.Pi/4, q[1])
+	})
+	require.NoError(t, err)
+	power, err := ControlledPowerOf(u)
+	require.NoError(t, err)
+
+	c, err := IterativePhaseEstimation(IPEOptions{
+		Bits:            3,
+		Targets:         2,
+		Prepare:         func(b builder.Builder, q []int) { b.X(q[0]).X(q[1]) },
+		ControlledPower: power,
+	})
+	require.NoError(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 32, Runner: qsim.NewQSimRunner()})
+	hist, err := sim.Run(c)
+	require.NoError(t, err)
+	require.Len(t, hist, 1)
+	for key := range hist {
+		assert.Equal(t, 3.0/8, PhaseFromKey(key))
+	}
+}
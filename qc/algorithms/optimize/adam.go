@@ -0,0 +1,81 @@
+package optimize
+
+import (
+	"fmt"
+	"math"
+)
+
+// Adam is gradient descent with bias-corrected first and second moment
+// estimates (Kingma & Ba). It needs an exact or unbiased gradient, such as
+// the parameter-shift one; Step.Value is f at the new point, so every
+// iteration costs one objective evaluation besides the gradient.
+type Adam struct {
+	Gradient     Gradient
+	LearningRate float64 // 0 means 0.05
+	Beta1        float64 // 0 means 0.9
+	Beta2        float64 // 0 means 0.999
+	Epsilon      float64 // 0 means 1e-8
+}
+
+func (a *Adam) Minimize(f Objective, x0 []float64, opts Options) (*Result, error) {
+	if err := check(x0); err != nil {
+		return nil, err
+	}
+	if a.Gradient == nil {
+		return nil, fmt.Errorf("optimize: Adam needs a gradient")
+	}
+	lr, b1, b2, eps := a.LearningRate, a.Beta1, a.Beta2, a.Epsilon
+	if lr == 0 {
+		lr = 0.05
+	}
+	if b1 == 0 {
+		b1 = 0.9
+	}
+	if b2 == 0 {
+		b2 = 0.999
+	}
+	if eps == 0 {
+		eps = 1e-8
+	}
+
+	fc := &counter{f: f}
+	x := append([]float64(nil), x0...)
+	m := make([]float64, len(x))
+	v := make([]float64, len(x))
+	step := make([]float64, len(x))
+	res := &Result{}
+	value, err := fc.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	for k := range opts.maxIter() {
+		g, err := a.Gradient(x)
+		if err != nil {
+			return nil, fmt.Errorf("optimize: gradient at iteration %d: %w", k+1, err)
+		}
+		if len(g) != len(x) {
+			return nil, fmt.Errorf("optimize: gradient has %d components, want %d", len(g), len(x))
+		}
+		t := float64(k + 1)
+		for i := range x {
+			m[i] = b1*m[i] + (1-b1)*g[i]
+			v[i] = b2*v[i] + (1-b2)*g[i]*g[i]
+			mHat := m[i] / (1 - math.Pow(b1, t))
+			vHat := v[i] / (1 - math.Pow(b2, t))
+			step[i] = lr * mHat / (math.Sqrt(vHat) + eps)
+			x[i] -= step[i]
+		}
+		if value, err = fc.eval(x); err != nil {
+			return nil, err
+		}
+		res.Iterations = k + 1
+		if opts.Tol > 0 && norm(step) < opts.Tol {
+			res.Converged = true
+		}
+		if !opts.report(k+1, x, value, fc.evals) || res.Converged {
+			break
+		}
+	}
+	res.X, res.Value, res.Evals = x, value, fc.evals
+	return res, nil
+}
@@ -0,0 +1,158 @@
+package optimize
+
+import (
+	"math"
+	"slices"
+)
+
+// COBYLA is a derivative-free trust-region method in the style of Powell's
+// COBYLA, without constraints. It keeps a simplex of len(x)+1 points, fits
+// the linear model through them and steps from the best point by the trust
+// radius against the model's gradient. A step that improves on the best
+// point replaces the worst one; otherwise the radius is halved and the
+// simplex rebuilt around the best point. It is deterministic, so
+// Options.Seed is unused, and Step.Value is f at Step.X.
+type COBYLA struct {
+	RhoBegin float64 // initial trust radius; 0 means 0.5
+}
+
+func (o *COBYLA) Minimize(f Objective, x0 []float64, opts Options) (*Result, error) {
+	if err := check(x0); err != nil {
+		return nil, err
+	}
+	rho := o.RhoBegin
+	if rho <= 0 {
+		rho = 0.5
+	}
+
+	fc := &counter{f: f}
+	n := len(x0)
+	pts := make([][]float64, n+1)
+	vals := make([]float64, n+1)
+	pts[0] = slices.Clone(x0)
+	var err error
+	if vals[0], err = fc.eval(pts[0]); err != nil {
+		return nil, err
+	}
+	// rebuild spans a fresh simplex of size rho around vertex 0.
+	rebuild := func() error {
+		for i := 1; i <= n; i++ {
+			pts[i] = slices.Clone(pts[0])
+			pts[i][i-1] += rho
+			if vals[i], err = fc.eval(pts[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := rebuild(); err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	for k := range opts.maxIter() {
+		best := argmin(vals)
+		moved := false
+		if g, ok := linearModel(pts, vals, best, rho); ok {
+			if gn := norm(g); gn > 0 {
+				trial := slices.Clone(pts[best])
+				for i := range trial {
+					trial[i] -= rho * g[i] / gn
+				}
+				ft, err := fc.eval(trial)
+				if err != nil {
+					return nil, err
+				}
+				if ft < vals[best] {
+					worst := argmax(vals)
+					pts[worst], vals[worst] = trial, ft
+					moved = true
+				}
+			}
+		}
+		if !moved {
+			rho /= 2
+			pts[0], pts[best] = pts[best], pts[0]
+			vals[0], vals[best] = vals[best], vals[0]
+			if err := rebuild(); err != nil {
+				return nil, err
+			}
+		}
+		res.Iterations = k + 1
+		if opts.Tol > 0 && rho < opts.Tol {
+			res.Converged = true
+		}
+		best = argmin(vals)
+		if !opts.report(k+1, pts[best], vals[best], fc.evals) || res.Converged {
+			break
+		}
+	}
+	best := argmin(vals)
+	res.X, res.Value, res.Evals = pts[best], vals[best], fc.evals
+	return res, nil
+}
+
+// linearModel returns the gradient g of the affine function through the
+// simplex, solving (pts[i]-pts[b])·g = vals[i]-vals[b] by Gaussian
+// elimination. It reports false when the simplex has collapsed.
+func linearModel(pts [][]float64, vals []float64, b int, rho float64) ([]float64, bool) {
+	n := len(pts[b])
+	m := make([][]float64, 0, n)
+	for i, p := range pts {
+		if i == b {
+			continue
+		}
+		row := make([]float64, n+1)
+		for j := range n {
+			row[j] = p[j] - pts[b][j]
+		}
+		row[n] = vals[i] - vals[b]
+		m = append(m, row)
+	}
+	for col := range n {
+		piv := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[piv][col]) {
+				piv = r
+			}
+		}
+		if math.Abs(m[piv][col]) < 1e-10*rho {
+			return nil, false
+		}
+		m[col], m[piv] = m[piv], m[col]
+		for r := range n {
+			if r == col {
+				continue
+			}
+			factor := m[r][col] / m[col][col]
+			for j := col; j <= n; j++ {
+				m[r][j] -= factor * m[col][j]
+			}
+		}
+	}
+	g := make([]float64, n)
+	for i := range g {
+		g[i] = m[i][n] / m[i][i]
+	}
+	return g, true
+}
+
+func argmin(v []float64) int {
+	best := 0
+	for i, x := range v {
+		if x < v[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func argmax(v []float64) int {
+	worst := 0
+	for i, x := range v {
+		if x > v[worst] {
+			worst = i
+		}
+	}
+	return worst
+}
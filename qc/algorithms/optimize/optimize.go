@@ -0,0 +1,102 @@
+// Package optimize holds small classical minimizers for variational
+// algorithms: SPSA, a COBYLA-style trust-region method and Adam. They share
+// one Optimizer interface and Options, so a driver can swap them freely, and
+// they work on any objective, quantum or not.
+package optimize
+
+import (
+	"fmt"
+	"math"
+)
+
+// Objective is the function to minimize, e.g. an estimated ⟨H⟩.
+type Objective func(x []float64) (float64, error)
+
+// Gradient returns ∇f at x, e.g. gradient.Estimator.Gradient.
+type Gradient func(x []float64) ([]float64, error)
+
+// Step describes one finished iteration.
+type Step struct {
+	Iter  int       // 1-based iteration number
+	X     []float64 // parameters after the iteration; copy to keep them
+	Value float64   // objective at X, or an estimate of it, see each optimizer
+	Evals int       // objective evaluations so far
+}
+
+// Options control the iteration common to all optimizers.
+type Options struct {
+	// MaxIter bounds the iterations; 0 means 100.
+	MaxIter int
+	// Tol stops the run, as converged, once a step moves x by less than Tol
+	// (COBYLA: once the trust radius drops below Tol). 0 runs MaxIter
+	// iterations.
+	Tol float64
+	// Seed makes stochastic optimizers reproducible; 0 picks a random seed.
+	Seed int64
+	// Callback, if set, is called after every iteration. Returning false
+	// stops the run.
+	Callback func(Step) bool
+}
+
+func (o Options) maxIter() int {
+	if o.MaxIter <= 0 {
+		return 100
+	}
+	return o.MaxIter
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	X          []float64
+	Value      float64 // objective at X
+	Iterations int
+	Evals      int
+	Converged  bool // Tol was reached, rather than MaxIter or a callback stop
+}
+
+// Optimizer minimizes an objective from a starting point.
+type Optimizer interface {
+	Minimize(f Objective, x0 []float64, opts Options) (*Result, error)
+}
+
+var (
+	_ Optimizer = (*SPSA)(nil)
+	_ Optimizer = (*COBYLA)(nil)
+	_ Optimizer = (*Adam)(nil)
+)
+
+// counter counts objective evaluations.
+type counter struct {
+	f     Objective
+	evals int
+}
+
+func (c *counter) eval(x []float64) (float64, error) {
+	c.evals++
+	v, err := c.f(x)
+	if err != nil {
+		return 0, fmt.Errorf("optimize: evaluation %d: %w", c.evals, err)
+	}
+	return v, nil
+}
+
+// report calls the callback, if any, and reports whether to go on.
+func (o Options) report(iter int, x []float64, value float64, evals int) bool {
+	return o.Callback == nil || o.Callback(Step{Iter: iter, X: x, Value: value, Evals: evals})
+}
+
+func check(x0 []float64) error {
+	if len(x0) == 0 {
+		return fmt.Errorf("optimize: empty starting point")
+	}
+	return nil
+}
+
+// norm returns the Euclidean norm of v.
+func norm(v []float64) float64 {
+	s := 0.0
+	for _, x := range v {
+		s += x * x
+	}
+	return math.Sqrt(s)
+}
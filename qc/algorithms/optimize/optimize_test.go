@@ -0,0 +1,61 @@
+package optimize
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bowl is (x-1)² + 2(y+0.5)², minimal at (1, -0.5).
+func bowl(x []float64) (float64, error) {
+	return (x[0]-1)*(x[0]-1) + 2*(x[1]+0.5)*(x[1]+0.5), nil
+}
+
+func bowlGrad(x []float64) ([]float64, error) {
+	return []float64{2 * (x[0] - 1), 4 * (x[1] + 0.5)}, nil
+}
+
+func TestMinimize(t *testing.T) {
+	optimizers := map[string]Optimizer{
+		"SPSA":   &SPSA{},
+		"COBYLA": &COBYLA{},
+		"Adam":   &Adam{Gradient: bowlGrad, LearningRate: 0.1},
+	}
+	for name, opt := range optimizers {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			res, err := opt.Minimize(bowl, []float64{-1, 1}, Options{MaxIter: 500, Tol: 1e-4, Seed: 5})
+			require.NoError(err)
+			assert.InDelta(1, res.X[0], 0.05)
+			assert.InDelta(-0.5, res.X[1], 0.05)
+			assert.InDelta(0, res.Value, 0.01)
+			assert.Positive(res.Evals)
+
+			again, err := opt.Minimize(bowl, []float64{-1, 1}, Options{MaxIter: 500, Tol: 1e-4, Seed: 5})
+			require.NoError(err)
+			assert.Equal(res, again, "seeded runs are reproducible")
+
+			steps := 0
+			res, err = opt.Minimize(bowl, []float64{-1, 1}, Options{Seed: 5, Callback: func(s Step) bool {
+				steps++
+				assert.Equal(steps, s.Iter)
+				return s.Iter < 3
+			}})
+			require.NoError(err)
+			assert.Equal(3, steps, "returning false stops the run")
+			assert.Equal(3, res.Iterations)
+			assert.False(res.Converged)
+
+			boom := errors.New("boom")
+			_, err = opt.Minimize(func([]float64) (float64, error) { return 0, boom }, []float64{0, 0}, Options{})
+			assert.ErrorIs(err, boom)
+		})
+	}
+
+	_, err := (&Adam{}).Minimize(bowl, []float64{0, 0}, Options{})
+	assert.Error(t, err, "Adam needs a gradient")
+}
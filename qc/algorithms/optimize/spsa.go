@@ -0,0 +1,82 @@
+package optimize
+
+import (
+	"math"
+	"math/rand"
+)
+
+// SPSA is simultaneous perturbation stochastic approximation. Each
+// iteration perturbs every parameter at once by ±c_k and estimates the
+// gradient from just two evaluations, whatever the dimension, which makes
+// it robust to shot noise. The gains follow Spall's schedules
+// a_k = A/(k+1+S)^0.602 and c_k = C/(k+1)^0.101 with S = MaxIter/10.
+// Step.Value is the mean of the two perturbed evaluations.
+type SPSA struct {
+	A float64 // step gain; 0 means 0.2
+	C float64 // perturbation size; 0 means 0.1
+}
+
+func (s *SPSA) Minimize(f Objective, x0 []float64, opts Options) (*Result, error) {
+	if err := check(x0); err != nil {
+		return nil, err
+	}
+	a, c := s.A, s.C
+	if a == 0 {
+		a = 0.2
+	}
+	if c == 0 {
+		c = 0.1
+	}
+	seed := rand.Int63()
+	if opts.Seed != 0 {
+		seed = opts.Seed
+	}
+	rng := rand.New(rand.NewSource(seed))
+	maxIter := opts.maxIter()
+	stability := float64(maxIter) / 10
+
+	fc := &counter{f: f}
+	x := append([]float64(nil), x0...)
+	plus := make([]float64, len(x))
+	minus := make([]float64, len(x))
+	delta := make([]float64, len(x))
+	step := make([]float64, len(x))
+	res := &Result{}
+	for k := range maxIter {
+		ak := a / math.Pow(float64(k+1)+stability, 0.602)
+		ck := c / math.Pow(float64(k+1), 0.101)
+		for i := range x {
+			delta[i] = 1
+			if rng.Intn(2) == 0 {
+				delta[i] = -1
+			}
+			plus[i] = x[i] + ck*delta[i]
+			minus[i] = x[i] - ck*delta[i]
+		}
+		fp, err := fc.eval(plus)
+		if err != nil {
+			return nil, err
+		}
+		fm, err := fc.eval(minus)
+		if err != nil {
+			return nil, err
+		}
+		for i := range x {
+			step[i] = ak * (fp - fm) / (2 * ck * delta[i])
+			x[i] -= step[i]
+		}
+		res.Iterations = k + 1
+		if opts.Tol > 0 && norm(step) < opts.Tol {
+			res.Converged = true
+		}
+		if !opts.report(k+1, x, (fp+fm)/2, fc.evals) || res.Converged {
+			break
+		}
+	}
+	v, err := fc.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	res.X, res.Value, res.Evals = x, v, fc.evals
+	return res, nil
+}
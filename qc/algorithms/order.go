@@ -0,0 +1,126 @@
+package algorithms
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// maxOrderMultiple bounds the multiples of a convergent's denominator
+// FindOrder tries: a measured phase s/r with gcd(s, r) > 1 only reveals a
+// divisor of r.
+const maxOrderMultiple = 8
+
+// Fraction is a non-negative rational Num/Den.
+type Fraction struct {
+	Num, Den uint64
+}
+
+// Convergents returns the convergents of the continued fraction expansion
+// of num/den, from the coarsest to num/den itself in lowest terms. Each
+// is the best approximation of num/den by a fraction with a denominator
+// no larger.
+func Convergents(num, den uint64) ([]Fraction, error) {
+	if den == 0 {
+		return nil, fmt.Errorf("algorithms: continued fraction of %d/0", num)
+	}
+	var out []Fraction
+	// h and k hold the two previous numerators and denominators.
+	h0, h1 := uint64(0), uint64(1)
+	k0, k1 := uint64(1), uint64(0)
+	for den != 0 {
+		a := num / den
+		num, den = den, num%den
+		h0, h1 = h1, a*h1+h0
+		k0, k1 = k1, a*k1+k0
+		out = append(out, Fraction{Num: h1, Den: k1})
+	}
+	return out, nil
+}
+
+// FindOrder recovers the order r of a modulo n, the least r > 0 with
+// a^r ≡ 1 (mod n), from one measurement y of the bits-qubit phase register
+// of order finding: y/2^bits approximates s/r for an unknown s. It tries
+// the denominators of the convergents of y/2^bits below n, and a few of
+// their multiples, checking each classically. It fails for unlucky
+// measurements such as y = 0; the caller then samples again.
+func FindOrder(a, n, y uint64, bits int) (uint64, error) {
+	if n < 2 {
+		return 0, fmt.Errorf("algorithms: order modulo %d", n)
+	}
+	if bits < 1 || bits > 63 {
+		return 0, fmt.Errorf("algorithms: phase register of %d bits, want 1 to 63", bits)
+	}
+	if y>>bits != 0 {
+		return 0, fmt.Errorf("algorithms: measurement %d does not fit in %d bits", y, bits)
+	}
+	if gcd(a%n, n) != 1 {
+		return 0, fmt.Errorf("algorithms: %d shares a factor with %d and has no order", a, n)
+	}
+	cs, err := Convergents(y, 1<<bits)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range cs {
+		if c.Den >= n {
+			break
+		}
+		if c.Num == 0 {
+			continue // s = 0 says nothing about r
+		}
+		for m := uint64(1); m <= maxOrderMultiple && m*c.Den < n; m++ {
+			if modPow(a, m*c.Den, n) == 1 {
+				return m * c.Den, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("algorithms: measurement %d/2^%d reveals no order of %d modulo %d", y, bits, a, n)
+}
+
+// FactorFromOrder splits n using the order r of a modulo n, as in Shor's
+// algorithm: for even r with a^(r/2) ≢ -1 (mod n), gcd(a^(r/2) ± 1, n) are
+// non-trivial factors. It returns them in ascending order, and fails when
+// r does not qualify; the caller then picks another a.
+func FactorFromOrder(a, r, n uint64) (uint64, uint64, error) {
+	if n < 2 || r == 0 || modPow(a, r, n) != 1 {
+		return 0, 0, fmt.Errorf("algorithms: %d is not the order of %d modulo %d", r, a, n)
+	}
+	if r%2 != 0 {
+		return 0, 0, fmt.Errorf("algorithms: order %d of %d modulo %d is odd", r, a, n)
+	}
+	x := modPow(a, r/2, n)
+	if x == n-1 {
+		return 0, 0, fmt.Errorf("algorithms: %d^(%d/2) ≡ -1 modulo %d", a, r, n)
+	}
+	p := gcd(x+n-1, n) // x-1 without wrapping below 0
+	if p == 1 || p == n {
+		p = gcd(x+1, n)
+	}
+	if p == 1 || p == n {
+		return 0, 0, fmt.Errorf("algorithms: order %d of %d gives no factor of %d", r, a, n)
+	}
+	return min(p, n/p), max(p, n/p), nil
+}
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// modPow returns a^e mod n without overflowing 64 bits.
+func modPow(a, e, n uint64) uint64 {
+	mulMod := func(x, y uint64) uint64 {
+		hi, lo := bits.Mul64(x, y)
+		return bits.Rem64(hi, lo, n)
+	}
+	r, a := uint64(1)%n, a%n
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			r = mulMod(r, a)
+		}
+		a = mulMod(a, a)
+	}
+	return r
+}
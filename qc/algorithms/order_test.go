@@ -0,0 +1,71 @@
+package algorithms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvergents(t *testing.T) {
+	// 415/93 = [4; 2, 6, 7].
+	cs, err := Convergents(415, 93)
+	require.NoError(t, err)
+	assert.Equal(t, []Fraction{{4, 1}, {9, 2}, {58, 13}, {415, 93}}, cs)
+
+	cs, err = Convergents(64, 256)
+	require.NoError(t, err)
+	assert.Equal(t, Fraction{1, 4}, cs[len(cs)-1], "in lowest terms")
+
+	cs, err = Convergents(0, 8)
+	require.NoError(t, err)
+	assert.Equal(t, []Fraction{{0, 1}}, cs)
+
+	_, err = Convergents(1, 0)
+	assert.Error(t, err)
+}
+
+func TestFindOrder(t *testing.T) {
+	// 7 has order 4 modulo 15: exact phases s/4 in 8 bits.
+	r, err := FindOrder(7, 15, 64, 8)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), r)
+	r, err = FindOrder(7, 15, 128, 8)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), r, "s/r = 2/4 only shows 1/2; a multiple finds r")
+
+	// 2 has order 6 modulo 21: 1/6 and 5/6 are only approximated in 9 bits.
+	for _, y := range []uint64{85, 86, 427} {
+		r, err = FindOrder(2, 21, y, 9)
+		require.NoError(t, err, "y = %d", y)
+		assert.Equal(t, uint64(6), r, "y = %d", y)
+	}
+
+	_, err = FindOrder(7, 15, 0, 8)
+	assert.ErrorContains(t, err, "reveals no order")
+	_, err = FindOrder(6, 15, 64, 8)
+	assert.ErrorContains(t, err, "shares a factor")
+	_, err = FindOrder(7, 15, 256, 8)
+	assert.Error(t, err)
+	_, err = FindOrder(7, 1, 0, 8)
+	assert.Error(t, err)
+}
+
+func TestFactorFromOrder(t *testing.T) {
+	p, q, err := FactorFromOrder(7, 4, 15)
+	require.NoError(t, err)
+	assert.Equal(t, [2]uint64{3, 5}, [2]uint64{p, q})
+	p, q, err = FactorFromOrder(2, 6, 21)
+	require.NoError(t, err)
+	assert.Equal(t, [2]uint64{3, 7}, [2]uint64{p, q})
+
+	_, _, err = FactorFromOrder(2, 3, 7)
+	assert.ErrorContains(t, err, "odd")
+	_, _, err = FactorFromOrder(14, 2, 15)
+	assert.ErrorContains(t, err, "-1")
+	_, _, err = FactorFromOrder(7, 2, 15)
+	assert.ErrorContains(t, err, "not the order")
+
+	// Large moduli do not overflow.
+	assert.Equal(t, uint64(1), modPow(3, 1<<62-58, 1<<62-57))
+}
@@ -0,0 +1,131 @@
+// Package problems encodes combinatorial optimization problems, Max-Cut,
+// Ising models and QUBOs, as diagonal Pauli Hamiltonians whose ground
+// states are the optimal assignments, builds the matching QAOA circuits and
+// decodes measured keys back into objective values.
+//
+// Variable or node i is qubit i and, as the simulator reports keys with
+// classical bit 0 first, character i of a key when qubit i is measured
+// into cbit i. Bit 1 means Z = -1.
+package problems
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+)
+
+// Edge is a weighted undirected edge, or an Ising coupling.
+type Edge struct {
+	U, V   int
+	Weight float64
+}
+
+// Graph is a weighted graph on nodes 0..Nodes-1.
+type Graph struct {
+	Nodes int
+	Edges []Edge
+}
+
+func (g Graph) validate() error {
+	if g.Nodes < 1 {
+		return fmt.Errorf("problems: graph needs at least one node, got %d", g.Nodes)
+	}
+	for i, e := range g.Edges {
+		if e.U < 0 || e.U >= g.Nodes || e.V < 0 || e.V >= g.Nodes || e.U == e.V {
+			return fmt.Errorf("problems: edge %d (%d,%d) is not between two distinct nodes of %d", i, e.U, e.V, g.Nodes)
+		}
+	}
+	return nil
+}
+
+// terms accumulates Pauli strings of a fixed width.
+type terms struct {
+	n      int
+	coeffs map[string]float64
+}
+
+func newTerms(n int) *terms { return &terms{n: n, coeffs: make(map[string]float64)} }
+
+// add adds c·Z_qs, the identity when qs is empty.
+func (t *terms) add(c float64, qs ...int) {
+	p := []byte(strings.Repeat("I", t.n))
+	for _, q := range qs {
+		p[q] = 'Z'
+	}
+	t.coeffs[string(p)] += c
+}
+
+// hamiltonian returns the non-zero terms sorted by Pauli string.
+func (t *terms) hamiltonian() gradient.Hamiltonian {
+	var h gradient.Hamiltonian
+	for _, p := range slices.Sorted(maps.Keys(t.coeffs)) {
+		if c := t.coeffs[p]; c != 0 {
+			h = append(h, gradient.Term{Coeff: c, Paulis: p})
+		}
+	}
+	return h
+}
+
+// MaxCut returns H = Σ w/2·(Z_u Z_v − 1) over the edges, so that ⟨H⟩ is
+// minus the expected cut weight and the ground states are maximum cuts.
+func MaxCut(g Graph) (gradient.Hamiltonian, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	t := newTerms(g.Nodes)
+	for _, e := range g.Edges {
+		t.add(e.Weight/2, e.U, e.V)
+		t.add(-e.Weight / 2)
+	}
+	return t.hamiltonian(), nil
+}
+
+// Ising returns H = Σ J_uv Z_u Z_v + Σ h_i Z_i on len(fields) spins, the
+// couplings J given as the weights of the edges.
+func Ising(fields []float64, couplings []Edge) (gradient.Hamiltonian, error) {
+	g := Graph{Nodes: len(fields), Edges: couplings}
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	t := newTerms(len(fields))
+	for i, h := range fields {
+		t.add(h, i)
+	}
+	for _, e := range couplings {
+		t.add(e.Weight, e.U, e.V)
+	}
+	return t.hamiltonian(), nil
+}
+
+// QUBO returns the Hamiltonian of min xᵀQx over x ∈ {0,1}ⁿ, substituting
+// x_i = (1 − Z_i)/2; its eigenvalue on a basis state is the objective of
+// that assignment. Q must be square; it need not be symmetric.
+func QUBO(q [][]float64) (gradient.Hamiltonian, error) {
+	n := len(q)
+	if n == 0 {
+		return nil, fmt.Errorf("problems: empty QUBO matrix")
+	}
+	for i, row := range q {
+		if len(row) != n {
+			return nil, fmt.Errorf("problems: QUBO row %d has %d entries, want %d", i, len(row), n)
+		}
+	}
+	t := newTerms(n)
+	for i := range n {
+		// x_i² = x_i = (1 − Z_i)/2
+		t.add(q[i][i] / 2)
+		t.add(-q[i][i]/2, i)
+		for j := i + 1; j < n; j++ {
+			// x_i x_j = (1 − Z_i − Z_j + Z_i Z_j)/4
+			w := (q[i][j] + q[j][i]) / 4
+			t.add(w)
+			t.add(-w, i)
+			t.add(-w, j)
+			t.add(w, i, j)
+		}
+	}
+	return t.hamiltonian(), nil
+}
@@ -0,0 +1,102 @@
+package problems
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/algorithms/optimize"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keys lists all n-bit keys.
+func keys(n int) []string {
+	var ks []string
+	for v := range 1 << n {
+		ks = append(ks, fmt.Sprintf("%0*b", n, v))
+	}
+	return ks
+}
+
+var square = Graph{Nodes: 4, Edges: []Edge{{0, 1, 1}, {1, 2, 1}, {2, 3, 1}, {3, 0, 1}}}
+
+func TestEncoders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	g := Graph{Nodes: 3, Edges: []Edge{{0, 1, 1}, {1, 2, 2}, {0, 2, 0.5}}}
+	h, err := MaxCut(g)
+	require.NoError(err)
+	for _, k := range keys(3) {
+		cut, err := CutValue(g, k)
+		require.NoError(err)
+		e, err := Energy(h, k)
+		require.NoError(err)
+		assert.InDelta(-cut, e, 1e-12, k)
+	}
+
+	q := [][]float64{{1, -2, 0}, {0, 3, 1}, {4, 0, -5}}
+	h, err = QUBO(q)
+	require.NoError(err)
+	for _, k := range keys(3) {
+		want := 0.0
+		for i := range 3 {
+			for j := range 3 {
+				if k[i] == '1' && k[j] == '1' {
+					want += q[i][j]
+				}
+			}
+		}
+		e, err := Energy(h, k)
+		require.NoError(err)
+		assert.InDelta(want, e, 1e-12, k)
+	}
+
+	h, err = Ising([]float64{0.5, 0}, []Edge{{0, 1, -1}})
+	require.NoError(err)
+	assert.Equal(gradient.Hamiltonian{{Coeff: 0.5, Paulis: "ZI"}, {Coeff: -1, Paulis: "ZZ"}}, h)
+
+	_, err = MaxCut(Graph{Nodes: 2, Edges: []Edge{{0, 0, 1}}})
+	assert.Error(err, "self-loop")
+	_, err = QUBO([][]float64{{1, 2}})
+	assert.Error(err, "not square")
+	_, err = Energy(gradient.Hamiltonian{{Coeff: 1, Paulis: "X"}}, "0")
+	assert.Error(err)
+	err = CostLayer(builder.New(builder.Q(3)), gradient.Hamiltonian{{Coeff: 1, Paulis: "ZZZ"}}, 1)
+	assert.Error(err)
+}
+
+func TestQAOAMaxCut(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h, err := MaxCut(square)
+	require.NoError(err)
+	tmpl, err := QAOA(h, square.Nodes, 1)
+	require.NoError(err)
+	assert.Equal(2, tmpl.Params)
+
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 1024, Runner: qsim.NewQSimRunner(), Seed: 2})
+	est := &gradient.Estimator{Sim: sim, Qubits: tmpl.Qubits, Ansatz: tmpl.Apply, Hamiltonian: h}
+	res, err := (&optimize.COBYLA{RhoBegin: 0.3}).Minimize(est.Expectation, []float64{0.4, 0.4}, optimize.Options{MaxIter: 40})
+	require.NoError(err)
+	assert.Less(res.Value, -2.5, "p=1 QAOA reaches ⟨C⟩ = 3 on the 4-cycle")
+
+	b := builder.New(builder.Q(4), builder.C(4))
+	tmpl.Apply(b, res.X)
+	for q := range 4 {
+		b.Measure(q, q)
+	}
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+	hist, err := sim.Run(c)
+	require.NoError(err)
+	key, cut, err := BestCut(square, hist)
+	require.NoError(err)
+	assert.Equal(4.0, cut)
+	assert.Contains([]string{"0101", "1010"}, key)
+}
@@ -0,0 +1,142 @@
+package problems
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/algorithms/ansatz"
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/builder"
+)
+
+// zs returns the qubits a diagonal term acts on, or an error if it is not
+// diagonal or couples more than two qubits.
+func zs(t gradient.Term) ([]int, error) {
+	var qs []int
+	for q, p := range t.Paulis {
+		switch p {
+		case 'I':
+		case 'Z':
+			qs = append(qs, q)
+		default:
+			return nil, fmt.Errorf("problems: term %q is not diagonal", t.Paulis)
+		}
+	}
+	if len(qs) > 2 {
+		return nil, fmt.Errorf("problems: term %q couples more than two qubits", t.Paulis)
+	}
+	return qs, nil
+}
+
+// CostLayer appends exp(−iγH) for a Hamiltonian of I, Z and ZZ terms,
+// dropping the global phase of the identity terms.
+func CostLayer(b builder.Builder, h gradient.Hamiltonian, gamma float64) error {
+	for _, t := range h {
+		qs, err := zs(t)
+		if err != nil {
+			return err
+		}
+		switch len(qs) {
+		case 1:
+			b.RZ(2*gamma*t.Coeff, qs[0])
+		case 2:
+			b.CNOT(qs[0], qs[1]).RZ(2*gamma*t.Coeff, qs[1]).CNOT(qs[0], qs[1])
+		}
+	}
+	return nil
+}
+
+// QAOA returns the depth-layers QAOA ansatz for h on qubits qubits: H on
+// every qubit, then per layer k the cost layer exp(−iγ_k H) and the mixer
+// RX(2β_k) on every qubit. Parameters are γ_0, β_0, γ_1, β_1, …. Every
+// angle drives several gates, so gradient.Estimator's parameter-shift rule
+// does not apply; use a gradient-free optimizer such as COBYLA.
+func QAOA(h gradient.Hamiltonian, qubits, layers int) (*ansatz.Template, error) {
+	if layers < 1 {
+		return nil, fmt.Errorf("problems: QAOA needs at least one layer, got %d", layers)
+	}
+	for _, t := range h {
+		if len(t.Paulis) > qubits {
+			return nil, fmt.Errorf("problems: term %q is wider than %d qubits", t.Paulis, qubits)
+		}
+		if _, err := zs(t); err != nil {
+			return nil, err
+		}
+	}
+	return &ansatz.Template{
+		Name:   "QAOA",
+		Qubits: qubits,
+		Params: 2 * layers,
+		Apply: func(b builder.Builder, theta []float64) {
+			b.HAll()
+			for k := range layers {
+				_ = CostLayer(b, h, theta[2*k]) // h was checked above
+				for q := range qubits {
+					b.RX(2*theta[2*k+1], q)
+				}
+			}
+		},
+	}, nil
+}
+
+// Energy returns the eigenvalue of a diagonal Hamiltonian on the basis
+// state a key names, e.g. the QUBO objective of that assignment.
+func Energy(h gradient.Hamiltonian, key string) (float64, error) {
+	key, _, _ = strings.Cut(key, "|")
+	e := 0.0
+	for _, t := range h {
+		if len(t.Paulis) > len(key) {
+			return 0, fmt.Errorf("problems: key %q is shorter than term %q", key, t.Paulis)
+		}
+		sign := 1.0
+		for q, p := range t.Paulis {
+			switch {
+			case p == 'I':
+			case p != 'Z':
+				return 0, fmt.Errorf("problems: term %q is not diagonal", t.Paulis)
+			case key[q] == '1':
+				sign = -sign
+			}
+		}
+		e += sign * t.Coeff
+	}
+	return e, nil
+}
+
+// CutValue returns the total weight of the edges a key cuts, node i being
+// on the side named by character i.
+func CutValue(g Graph, key string) (float64, error) {
+	if err := g.validate(); err != nil {
+		return 0, err
+	}
+	key, _, _ = strings.Cut(key, "|")
+	if len(key) < g.Nodes {
+		return 0, fmt.Errorf("problems: key %q is shorter than %d nodes", key, g.Nodes)
+	}
+	cut := 0.0
+	for _, e := range g.Edges {
+		if key[e.U] != key[e.V] {
+			cut += e.Weight
+		}
+	}
+	return cut, nil
+}
+
+// BestCut returns the sampled key with the largest cut and its value; keys
+// tie-break lexicographically so the result does not depend on map order.
+func BestCut(g Graph, hist map[string]int) (string, float64, error) {
+	best, bestCut := "", 0.0
+	for key := range hist {
+		cut, err := CutValue(g, key)
+		if err != nil {
+			return "", 0, err
+		}
+		if best == "" || cut > bestCut || cut == bestCut && key < best {
+			best, bestCut = key, cut
+		}
+	}
+	if best == "" {
+		return "", 0, fmt.Errorf("problems: empty histogram")
+	}
+	return best, bestCut, nil
+}
@@ -0,0 +1,47 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// BlochVector is the Bloch vector (⟨X⟩, ⟨Y⟩, ⟨Z⟩) of a single-qubit state,
+// whose density matrix is (I + xX + yY + zZ)/2.
+type BlochVector struct {
+	X, Y, Z float64
+}
+
+// Length returns |r|: 1 for a pure qubit, less when it is entangled with
+// the others, 0 for the maximally mixed state.
+func (b BlochVector) Length() float64 {
+	return math.Sqrt(b.X*b.X + b.Y*b.Y + b.Z*b.Z)
+}
+
+// BlochVectors returns the Bloch vector of every qubit's reduced state of
+// sv, indexed like a statevector (qubit q is bit q).
+func BlochVectors(sv []complex128) ([]BlochVector, error) {
+	n := bits.Len(uint(len(sv))) - 1
+	if len(sv) == 0 || 1<<n != len(sv) {
+		return nil, fmt.Errorf("analysis: statevector length %d is not a power of two", len(sv))
+	}
+	out := make([]BlochVector, n)
+	for q := range n {
+		mask := 1 << q
+		// ρ01 = ⟨0|ρ_q|1⟩ = (x − iy)/2.
+		var rho01 complex128
+		z := 0.0
+		for m, a := range sv {
+			p := real(a)*real(a) + imag(a)*imag(a)
+			if m&mask != 0 {
+				z -= p
+				continue
+			}
+			z += p
+			b := sv[m|mask]
+			rho01 += a * complex(real(b), -imag(b))
+		}
+		out[q] = BlochVector{X: 2 * real(rho01), Y: -2 * imag(rho01), Z: z}
+	}
+	return out, nil
+}
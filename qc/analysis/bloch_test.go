@@ -0,0 +1,40 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlochVectors(t *testing.T) {
+	const theta, phi = 0.8, 1.9
+	// Qubit 0: RY(θ) then RZ(φ) points at (sin θ cos φ, sin θ sin φ, cos θ).
+	// Qubit 1: |−i⟩. Qubits 2 and 3: a Bell pair, each maximally mixed.
+	sv := state(t, builder.New(builder.Q(4), builder.C(0)).
+		RY(theta, 0).RZ(phi, 0).
+		H(1).S(1).Z(1).
+		H(2).CNOT(2, 3))
+	vs, err := BlochVectors(sv)
+	require.NoError(t, err)
+	require.Len(t, vs, 4)
+
+	want := []BlochVector{
+		{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)},
+		{0, -1, 0},
+		{0, 0, 0},
+		{0, 0, 0},
+	}
+	for q, w := range want {
+		assert.InDelta(t, w.X, vs[q].X, 1e-9, "qubit %d x", q)
+		assert.InDelta(t, w.Y, vs[q].Y, 1e-9, "qubit %d y", q)
+		assert.InDelta(t, w.Z, vs[q].Z, 1e-9, "qubit %d z", q)
+	}
+	assert.InDelta(t, 1, vs[0].Length(), 1e-9)
+	assert.InDelta(t, 0, vs[3].Length(), 1e-9)
+
+	_, err = BlochVectors(sv[:3])
+	assert.Error(t, err)
+}
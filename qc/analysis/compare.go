@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+)
+
+// Drift is how far a histogram has moved from a baseline.
+type Drift struct {
+	// TVD is the total variation distance between the two empirical
+	// distributions: 0 for identical, 1 for disjoint.
+	TVD float64
+	// Fidelity is the classical (Bhattacharyya) fidelity (Σ√(p·q))²: 1 for
+	// identical, 0 for disjoint.
+	Fidelity float64
+	// ChiSquare is the two-sample chi-square statistic over the outcomes
+	// seen in either histogram, with DF degrees of freedom. PValue is the
+	// probability of a statistic at least as large from shot noise alone,
+	// i.e. if both histograms sampled the same distribution.
+	ChiSquare float64
+	DF        int
+	PValue    float64
+
+	BaselineShots, CurrentShots int
+}
+
+// Significant reports whether the drift is unlikely to be shot noise at
+// significance level alpha, e.g. 0.01.
+func (d Drift) Significant(alpha float64) bool {
+	return d.PValue < alpha
+}
+
+// CompareResults compares the histogram current against baseline, each
+// normalised by its own shot count, so runs of different sizes compare.
+// The chi-square test tells real drift from shot noise: a small TVD
+// between large runs can be significant, a large one between small runs
+// not. Like any chi-square test it is approximate when outcomes have only
+// a few counts.
+func CompareResults(baseline, current map[string]int) (Drift, error) {
+	var d Drift
+	for k, n := range baseline {
+		if n < 0 {
+			return Drift{}, fmt.Errorf("analysis: baseline count of %q is negative", k)
+		}
+		d.BaselineShots += n
+	}
+	for k, n := range current {
+		if n < 0 {
+			return Drift{}, fmt.Errorf("analysis: current count of %q is negative", k)
+		}
+		d.CurrentShots += n
+	}
+	if d.BaselineShots == 0 || d.CurrentShots == 0 {
+		return Drift{}, fmt.Errorf("analysis: cannot compare an empty histogram")
+	}
+
+	keys := map[string]bool{}
+	for k, n := range baseline {
+		keys[k] = n > 0
+	}
+	for k, n := range current {
+		keys[k] = keys[k] || n > 0
+	}
+	na, nb := float64(d.BaselineShots), float64(d.CurrentShots)
+	ra, rb := math.Sqrt(nb/na), math.Sqrt(na/nb)
+	bc := 0.0
+	for k, seen := range keys {
+		if !seen {
+			continue
+		}
+		a, b := float64(baseline[k]), float64(current[k])
+		p, q := a/na, b/nb
+		d.TVD += math.Abs(p - q)
+		bc += math.Sqrt(p * q)
+		x := ra*a - rb*b
+		d.ChiSquare += x * x / (a + b)
+		d.DF++
+	}
+	d.TVD /= 2
+	d.Fidelity = bc * bc
+	d.DF--
+	d.PValue = 1
+	if d.DF > 0 {
+		d.PValue = gammaQ(float64(d.DF)/2, d.ChiSquare/2)
+	}
+	return d, nil
+}
+
+// gammaQ is the regularised upper incomplete gamma function Q(a, x), the
+// chi-square survival function at 2x for 2a degrees of freedom: a series
+// below x = a+1, a continued fraction (modified Lentz) above.
+func gammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(a*math.Log(x) - x - lg)
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1.0; n < 1000; n++ {
+			term *= x / (a + n)
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return max(0, 1-sum*front)
+	}
+	const tiny = 1e-300
+	b := x + 1 - a
+	c, dd := 1/tiny, 1/b
+	h := dd
+	for i := 1.0; i < 1000; i++ {
+		an := -i * (i - a)
+		b += 2
+		dd = an*dd + b
+		if math.Abs(dd) < tiny {
+			dd = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		dd = 1 / dd
+		delta := dd * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return front * h
+}
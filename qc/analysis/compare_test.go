@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGammaQ(t *testing.T) {
+	// Chi-square survival values: df 1 at 3.841 and df 4 at 9.488 are the
+	// 5% critical values; df 2 is exp(-x/2).
+	assert.InDelta(t, 0.05, gammaQ(0.5, 3.841/2), 1e-4)
+	assert.InDelta(t, 0.05, gammaQ(2, 9.488/2), 1e-4)
+	assert.InDelta(t, math.Exp(-0.7), gammaQ(1, 0.7), 1e-12)
+	assert.InDelta(t, math.Exp(-30), gammaQ(1, 30), 1e-20)
+	assert.Equal(t, 1.0, gammaQ(3, 0))
+}
+
+func TestCompareResults(t *testing.T) {
+	sample := func(rng *rand.Rand, p float64, shots int) map[string]int {
+		h := map[string]int{}
+		for range shots {
+			if rng.Float64() < p {
+				h["11"]++
+			} else {
+				h["00"]++
+			}
+		}
+		return h
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	// The same distribution drifts only by shot noise, even between runs
+	// of different sizes.
+	d, err := CompareResults(sample(rng, 0.5, 4000), sample(rng, 0.5, 1000))
+	require.NoError(t, err)
+	assert.Equal(t, 1, d.DF)
+	assert.Equal(t, 4000, d.BaselineShots)
+	assert.False(t, d.Significant(0.01), "%+v", d)
+	assert.Greater(t, d.Fidelity, 0.99)
+
+	// A 5% shift is invisible in 100 shots and clear in 20000.
+	d, err = CompareResults(sample(rng, 0.5, 100), sample(rng, 0.55, 100))
+	require.NoError(t, err)
+	assert.False(t, d.Significant(0.001), "%+v", d)
+	d, err = CompareResults(sample(rng, 0.5, 20000), sample(rng, 0.55, 20000))
+	require.NoError(t, err)
+	assert.True(t, d.Significant(0.001), "%+v", d)
+	assert.InDelta(t, 0.05, d.TVD, 0.015)
+
+	// Disjoint outcomes.
+	d, err = CompareResults(map[string]int{"0": 10}, map[string]int{"1": 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, d.TVD)
+	assert.Equal(t, 0.0, d.Fidelity)
+	assert.True(t, d.Significant(0.01))
+
+	d, err = CompareResults(map[string]int{"0": 10, "1": 0}, map[string]int{"0": 3})
+	require.NoError(t, err)
+	assert.Equal(t, 0, d.DF, "a single outcome")
+	assert.Equal(t, 1.0, d.PValue)
+	assert.InDelta(t, 0, d.TVD, 1e-12)
+
+	_, err = CompareResults(map[string]int{}, map[string]int{"0": 1})
+	assert.ErrorContains(t, err, "empty histogram")
+	_, err = CompareResults(map[string]int{"0": -1}, map[string]int{"0": 1})
+	assert.ErrorContains(t, err, "negative")
+}
@@ -0,0 +1,85 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Expectation returns ⟨ψ|h|ψ⟩ exactly for the statevector sv (qubit q is
+// bit q), with no shot noise.
+func Expectation(sv []complex128, h gradient.Hamiltonian) (float64, error) {
+	n := bits.Len(uint(len(sv))) - 1
+	if len(sv) == 0 || 1<<n != len(sv) {
+		return 0, fmt.Errorf("analysis: statevector length %d is not a power of two", len(sv))
+	}
+	total := 0.0
+	for i, t := range h {
+		if len(t.Paulis) > n {
+			return 0, fmt.Errorf("analysis: term %d %q acts on %d qubits, state has %d", i, t.Paulis, len(t.Paulis), n)
+		}
+		var x, z, y int
+		for q, p := range t.Paulis {
+			switch p {
+			case 'I':
+			case 'X':
+				x |= 1 << q
+			case 'Y':
+				x |= 1 << q
+				z |= 1 << q
+				y++
+			case 'Z':
+				z |= 1 << q
+			default:
+				return 0, fmt.Errorf("analysis: term %d %q is not a Pauli string", i, t.Paulis)
+			}
+		}
+		// P|m⟩ = i^y (−1)^|m∧z| |m⊕x⟩, as Y = iXZ.
+		var sum complex128
+		for m, a := range sv {
+			if a == 0 {
+				continue
+			}
+			v := complex(real(sv[m^x]), -imag(sv[m^x])) * a
+			if bits.OnesCount(uint(m&z))%2 == 1 {
+				v = -v
+			}
+			sum += v
+		}
+		for range y % 4 {
+			sum *= 1i
+		}
+		total += t.Coeff * real(sum)
+	}
+	return total, nil
+}
+
+// ExpectationTrace returns ⟨h⟩ after every layer (TimeStep) of c, the time
+// series of a Trotterized evolution: element 0 is the initial state,
+// element k the state after k layers. It evolves one statevector through
+// the circuit with a simulator.Stepper on the simulator's runner, so the
+// whole trace costs a single pass. Measurements are skipped and must be
+// terminal; a layer of measurements only repeats the value before it.
+func ExpectationTrace(sim *simulator.Simulator, c circuit.Circuit, h gradient.Hamiltonian) ([]float64, error) {
+	st, err := sim.Stepper(c)
+	if err != nil {
+		return nil, err
+	}
+	trace := make([]float64, 0, st.Layers()+1)
+	for {
+		v, err := Expectation(st.Statevector(), h)
+		if err != nil {
+			return nil, err
+		}
+		trace = append(trace, v)
+		if _, err := st.Step(); errors.Is(err, simulator.ErrStepperDone) {
+			return trace, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
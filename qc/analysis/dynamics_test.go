@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectation(t *testing.T) {
+	r := 1 / math.Sqrt2
+	// (|00⟩ + i|11⟩)/√2: ⟨ZZ⟩ = 1, ⟨XY⟩ = ⟨YX⟩ = 1, ⟨XX⟩ = ⟨YY⟩ = 0.
+	sv := []complex128{complex(r, 0), 0, 0, complex(0, r)}
+	for paulis, want := range map[string]float64{"ZZ": 1, "XY": 1, "YX": 1, "XX": 0, "YY": 0, "ZI": 0, "II": 1, "": 1} {
+		got, err := Expectation(sv, gradient.Hamiltonian{{Coeff: 1, Paulis: paulis}})
+		require.NoError(t, err, paulis)
+		assert.InDelta(t, want, got, 1e-12, paulis)
+	}
+
+	// |+⟩ ⊗ |1⟩, qubit 0 first in the strings.
+	sv = []complex128{0, 0, complex(r, 0), complex(r, 0)}
+	got, err := Expectation(sv, gradient.Hamiltonian{{Coeff: 0.5, Paulis: "X"}, {Coeff: 2, Paulis: "IZ"}, {Coeff: 3, Paulis: "Y"}})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5-2, got, 1e-12)
+
+	_, err = Expectation(sv, gradient.Hamiltonian{{Coeff: 1, Paulis: "ZZZ"}})
+	assert.Error(t, err)
+	_, err = Expectation(sv, gradient.Hamiltonian{{Coeff: 1, Paulis: "A"}})
+	assert.ErrorContains(t, err, "not a Pauli string")
+	_, err = Expectation(sv[:3], nil)
+	assert.Error(t, err)
+}
+
+func TestExpectationTrace(t *testing.T) {
+	// Larmor precession: each Trotter layer rotates about X by θ, so ⟨Z⟩
+	// after k layers is cos(kθ) and ⟨Y⟩ is −sin(kθ).
+	const theta, steps = 0.3, 12
+	b := builder.New(builder.Q(1), builder.C(1))
+	for range steps {
+		b.RX(theta, 0)
+	}
+	b.Measure(0, 0)
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Runner: qsim.NewQSimRunner()})
+
+	z, err := ExpectationTrace(sim, c, gradient.Hamiltonian{{Coeff: 1, Paulis: "Z"}})
+	require.NoError(t, err)
+	y, err := ExpectationTrace(sim, c, gradient.Hamiltonian{{Coeff: 1, Paulis: "Y"}})
+	require.NoError(t, err)
+	require.Len(t, z, steps+2, "the measurement is a layer of its own")
+	assert.Equal(t, z[steps], z[steps+1])
+	for k := range steps + 1 {
+		assert.InDelta(t, math.Cos(float64(k)*theta), z[k], 1e-12, "layer %d", k)
+		assert.InDelta(t, -math.Sin(float64(k)*theta), y[k], 1e-12, "layer %d", k)
+	}
+
+	mid, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).H(0).BuildCircuit()
+	require.NoError(t, err)
+	_, err = ExpectationTrace(sim, mid, gradient.Hamiltonian{{Coeff: 1, Paulis: "Z"}})
+	assert.ErrorContains(t, err, "terminal")
+}
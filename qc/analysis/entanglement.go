@@ -0,0 +1,182 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// SchmidtCoefficients returns the Schmidt coefficients λ_i of the pure
+// state sv across the cut between qubits subsystem and the rest, in
+// descending order: sv = Σ λ_i |a_i⟩|b_i⟩ with Σ λ_i² = 1. sv is indexed
+// like a statevector (qubit q is bit q). They are the square roots of the
+// eigenvalues of the smaller side's reduced density matrix, so the cost is
+// cubic in the dimension of that side.
+func SchmidtCoefficients(sv []complex128, subsystem []int) ([]float64, error) {
+	n := bits.Len(uint(len(sv))) - 1
+	if len(sv) == 0 || 1<<n != len(sv) {
+		return nil, fmt.Errorf("analysis: statevector length %d is not a power of two", len(sv))
+	}
+	inA := make([]bool, n)
+	for _, q := range subsystem {
+		if q < 0 || q >= n {
+			return nil, fmt.Errorf("analysis: invalid qubit %d for %d-qubit state", q, n)
+		}
+		if inA[q] {
+			return nil, fmt.Errorf("analysis: qubit %d is listed twice", q)
+		}
+		inA[q] = true
+	}
+	// Reduce onto the smaller side: ρ[a][a'] = Σ_b ψ(a,b)·ψ*(a',b).
+	var side, rest []int
+	for q := range n {
+		if inA[q] == (2*len(subsystem) <= n) {
+			side = append(side, q)
+		} else {
+			rest = append(rest, q)
+		}
+	}
+	index := func(a, b int) int {
+		i := 0
+		for k, q := range side {
+			i |= (a >> k & 1) << q
+		}
+		for k, q := range rest {
+			i |= (b >> k & 1) << q
+		}
+		return i
+	}
+	da, db := 1<<len(side), 1<<len(rest)
+	rho := make([][]complex128, da)
+	for a := range da {
+		rho[a] = make([]complex128, da)
+	}
+	for b := range db {
+		for a := range da {
+			x := sv[index(a, b)]
+			if x == 0 {
+				continue
+			}
+			for a2 := range da {
+				y := sv[index(a2, b)]
+				rho[a][a2] += x * complex(real(y), -imag(y))
+			}
+		}
+	}
+	// The real embedding [[Re, −Im], [Im, Re]] of a Hermitian matrix has
+	// each of its eigenvalues twice.
+	emb := make([][]float64, 2*da)
+	for i := range emb {
+		emb[i] = make([]float64, 2*da)
+	}
+	for i, row := range rho {
+		for j, v := range row {
+			emb[i][j], emb[i+da][j+da] = real(v), real(v)
+			emb[i][j+da], emb[i+da][j] = -imag(v), imag(v)
+		}
+	}
+	vals := eigenvalues(emb)
+	coeffs := make([]float64, da)
+	for i := range coeffs {
+		coeffs[i] = math.Sqrt(max(vals[2*i], 0))
+	}
+	slices.Reverse(coeffs)
+	return coeffs, nil
+}
+
+// EntanglementEntropy returns the von Neumann entropy −Σ λ_i² log₂ λ_i²,
+// in bits, of the reduced state of subsystem.
+func EntanglementEntropy(sv []complex128, subsystem []int) (float64, error) {
+	coeffs, err := SchmidtCoefficients(sv, subsystem)
+	if err != nil {
+		return 0, err
+	}
+	s := 0.0
+	for _, l := range coeffs {
+		if p := l * l; p > 1e-15 {
+			s -= p * math.Log2(p)
+		}
+	}
+	return s, nil
+}
+
+// SchmidtRank returns the number of Schmidt coefficients above tol; 0
+// selects 1e-9.
+func SchmidtRank(sv []complex128, subsystem []int, tol float64) (int, error) {
+	coeffs, err := SchmidtCoefficients(sv, subsystem)
+	if err != nil {
+		return 0, err
+	}
+	if tol <= 0 {
+		tol = 1e-9
+	}
+	rank := 0
+	for _, l := range coeffs {
+		if l > tol {
+			rank++
+		}
+	}
+	return rank, nil
+}
+
+// BondDimensions returns the Schmidt rank across each cut of the qubit
+// line, entry k for qubits 0…k against k+1…n−1. These are the bond
+// dimensions a matrix product state needs to hold sv exactly, so small
+// values mean an MPS representation is cheap.
+func BondDimensions(sv []complex128, tol float64) ([]int, error) {
+	n := bits.Len(uint(len(sv))) - 1
+	dims := make([]int, max(n-1, 0))
+	left := []int{}
+	for k := range dims {
+		left = append(left, k)
+		r, err := SchmidtRank(sv, left, tol)
+		if err != nil {
+			return nil, err
+		}
+		dims[k] = r
+	}
+	return dims, nil
+}
+
+// eigenvalues returns the eigenvalues of the real symmetric matrix a in
+// ascending order, by cyclic Jacobi rotations; a is overwritten.
+func eigenvalues(a [][]float64) []float64 {
+	n := len(a)
+	for range 100 {
+		off := 0.0
+		for i := range n {
+			for j := i + 1; j < n; j++ {
+				off += a[i][j] * a[i][j]
+			}
+		}
+		if off < 1e-26 {
+			break
+		}
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := range n {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := range n {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+			}
+		}
+	}
+	vals := make([]float64, n)
+	for i := range vals {
+		vals[i] = a[i][i]
+	}
+	slices.Sort(vals)
+	return vals
+}
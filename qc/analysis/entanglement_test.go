@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func state(t *testing.T, b builder.Builder) []complex128 {
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+	return sv
+}
+
+func TestSchmidt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// GHZ on 4 qubits: two equal coefficients across any cut.
+	ghz := state(t, builder.New(builder.Q(4), builder.C(0)).H(0).CNOT(0, 1).CNOT(1, 2).CNOT(2, 3))
+	for _, cut := range [][]int{{0}, {1, 3}, {0, 1, 2}} {
+		coeffs, err := SchmidtCoefficients(ghz, cut)
+		require.NoError(err)
+		assert.InDelta(1/math.Sqrt2, coeffs[0], 1e-9)
+		assert.InDelta(1/math.Sqrt2, coeffs[1], 1e-9)
+		s, err := EntanglementEntropy(ghz, cut)
+		require.NoError(err)
+		assert.InDelta(1, s, 1e-9)
+	}
+
+	// RY(θ) then CNOT: coefficients cos(θ/2) and sin(θ/2), with a complex
+	// phase on one branch; qubit 2 stays a product.
+	const theta = 1.1
+	sv := state(t, builder.New(builder.Q(3), builder.C(0)).RY(theta, 0).S(0).CNOT(0, 1).H(2))
+	coeffs, err := SchmidtCoefficients(sv, []int{1})
+	require.NoError(err)
+	assert.InDelta(math.Cos(theta/2), coeffs[0], 1e-9)
+	assert.InDelta(math.Sin(theta/2), coeffs[1], 1e-9)
+	rank, err := SchmidtRank(sv, []int{2}, 0)
+	require.NoError(err)
+	assert.Equal(1, rank)
+	s, err := EntanglementEntropy(sv, []int{2})
+	require.NoError(err)
+	assert.InDelta(0, s, 1e-9)
+
+	dims, err := BondDimensions(sv, 0)
+	require.NoError(err)
+	assert.Equal([]int{2, 1}, dims)
+
+	_, err = SchmidtCoefficients(sv[:5], []int{0})
+	assert.Error(err)
+	_, err = SchmidtCoefficients(sv, []int{0, 0})
+	assert.Error(err)
+	_, err = SchmidtCoefficients(sv, []int{3})
+	assert.Error(err)
+}
@@ -0,0 +1,175 @@
+// Package analysis characterises states and executions: how closely a
+// noisy execution reproduces the ideal one, through average gate
+// fidelities of process matrices for the smallest systems and direct
+// fidelity estimation from a handful of Pauli measurements where process
+// tomography is out of reach, whether a histogram drifted from a baseline
+// beyond shot noise, how entangled a pure state is across a bipartition
+// and how an observable evolves layer by layer; plus the GF(2) linear
+// algebra behind Simon's algorithm.
+package analysis
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/bits"
+	"math/rand"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// MaxDirectFidelityQubits bounds DirectFidelity: the ideal state's 4^n
+// Pauli expectations are computed classically before sampling.
+const MaxDirectFidelityQubits = 12
+
+// AverageGateFidelity returns the fidelity of noisy with the unitary
+// channel ideal averaged over pure input states, both computed with
+// Simulator.Process.
+func AverageGateFidelity(ideal, noisy *simulator.Process) (float64, error) {
+	return noisy.AverageGateFidelity(ideal)
+}
+
+// DFEOptions configures DirectFidelity.
+type DFEOptions struct {
+	// Sim runs the noisy circuits, with its own shot count per Pauli; its
+	// runner must implement StatevectorGetter for the ideal state.
+	Sim     *simulator.Simulator
+	Circuit circuit.Circuit
+	Noise   simulator.NoiseModel
+	Samples int   // Pauli operators drawn; 0 means 50
+	Seed    int64 // seeds the draw; 0 draws from the global source
+}
+
+// DFEResult is a direct fidelity estimate.
+type DFEResult struct {
+	Fidelity float64
+	StdErr   float64 // of the mean over the drawn Paulis
+	Paulis   int     // distinct non-identity Paulis measured
+}
+
+// DirectFidelity estimates ⟨ψ|ρ|ψ⟩ for the ideal state ψ that Circuit
+// prepares and the state ρ it prepares under Noise, by direct fidelity
+// estimation (Flammia and Liu, 2011): Pauli operators P are drawn with
+// probability ⟨P⟩_ψ²/2^n and the ratios ⟨P⟩_ρ/⟨P⟩_ψ averaged, each ⟨P⟩_ρ
+// measured with a gradient.Estimator. The number of Paulis needed depends
+// on the precision wanted, not on the width; for a stabilizer state every
+// ratio lies in [−1, 1]. Noise also acts on the basis changes that measure
+// each P, so measurement errors lower the estimate. Measurements in
+// Circuit are ignored and control flow is rejected.
+func DirectFidelity(o DFEOptions) (DFEResult, error) {
+	if o.Sim == nil || o.Circuit == nil {
+		return DFEResult{}, fmt.Errorf("analysis: direct fidelity needs a simulator and a circuit")
+	}
+	c := o.Circuit
+	n := c.Qubits()
+	if n > MaxDirectFidelityQubits {
+		return DFEResult{}, fmt.Errorf("analysis: direct fidelity of %d qubits exceeds the maximum of %d", n, MaxDirectFidelityQubits)
+	}
+	if circuit.HasControlFlow(c) {
+		return DFEResult{}, fmt.Errorf("analysis: circuits with classical control flow are not supported")
+	}
+	sv, err := o.Sim.GetStatevector(c)
+	if err != nil {
+		return DFEResult{}, fmt.Errorf("analysis: ideal state: %w", err)
+	}
+	samples := o.Samples
+	if samples <= 0 {
+		samples = 50
+	}
+	rng := rand.New(rand.NewSource(rand.Int63()))
+	if o.Seed != 0 {
+		rng = rand.New(rand.NewSource(o.Seed))
+	}
+
+	// Draw Pauli indices from the characteristic distribution.
+	char := characteristic(sv, n)
+	var support []int
+	var cum []float64
+	total := 0.0
+	for k, v := range char {
+		if w := v * v; w > 1e-12 {
+			total += w
+			support = append(support, k)
+			cum = append(cum, total)
+		}
+	}
+	drawn := map[int]int{}
+	for range samples {
+		i, _ := slices.BinarySearch(cum, rng.Float64()*total)
+		drawn[support[min(i, len(support)-1)]]++
+	}
+
+	ansatz := func(b builder.Builder, _ []float64) {
+		for _, op := range c.OpsIter() {
+			if op.G.Name() != "MEASURE" {
+				b.Apply(op.G, op.Qubits...)
+			}
+		}
+	}
+	var sum, sumSq float64
+	res := DFEResult{}
+	for _, k := range slices.Sorted(maps.Keys(drawn)) {
+		x := 1.0 // ⟨I⟩ is 1 in every state
+		if k != 0 {
+			est := &gradient.Estimator{
+				Sim:         o.Sim,
+				Qubits:      n,
+				Ansatz:      ansatz,
+				Hamiltonian: gradient.Hamiltonian{{Coeff: 1, Paulis: simulator.PauliLabel(k, n)}},
+				Noise:       o.Noise,
+			}
+			v, err := est.Expectation(nil)
+			if err != nil {
+				return DFEResult{}, fmt.Errorf("analysis: measuring %s: %w", simulator.PauliLabel(k, n), err)
+			}
+			x = v / char[k]
+			res.Paulis++
+		}
+		m := float64(drawn[k])
+		sum += m * x
+		sumSq += m * x * x
+	}
+	l := float64(samples)
+	res.Fidelity = sum / l
+	if samples > 1 {
+		variance := (sumSq - sum*sum/l) / (l - 1)
+		res.StdErr = math.Sqrt(max(variance, 0) / l)
+	}
+	return res, nil
+}
+
+// characteristic returns ⟨ψ|P_k|ψ⟩ for every Pauli index k (see
+// simulator.PauliLabel). Writing P = i^|x∧z|·X^x·Z^z, the expectations of
+// one X part x for all Z parts z are the Walsh–Hadamard transform of
+// ψ*(m⊕x)·ψ(m), so the whole table costs O(n·4^n).
+func characteristic(sv []complex128, n int) []float64 {
+	d := len(sv)
+	out := make([]float64, d*d)
+	v := make([]complex128, d)
+	for x := range d {
+		for m := range d {
+			v[m] = complex(real(sv[m^x]), -imag(sv[m^x])) * sv[m]
+		}
+		for h := 1; h < d; h *= 2 {
+			for i := 0; i < d; i += 2 * h {
+				for j := i; j < i+h; j++ {
+					v[j], v[j+h] = v[j]+v[j+h], v[j]-v[j+h]
+				}
+			}
+		}
+		for z := range d {
+			k := 0
+			for q := range n {
+				digit := [2][2]int{{0, 3}, {1, 2}}[x>>q&1][z>>q&1]
+				k |= digit << (2 * q)
+			}
+			val := v[z] * [4]complex128{1, 1i, -1, -1i}[bits.OnesCount(uint(x&z))%4]
+			out[k] = real(val)
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package analysis
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharacteristic(t *testing.T) {
+	c, err := builder.New(builder.Q(3), builder.C(0)).RY(0.8, 0).H(1).CNOT(1, 2).S(2).RX(0.3, 0).CZ(0, 1).BuildCircuit()
+	require.NoError(t, err)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+	char := characteristic(sv, 3)
+	for k, got := range char {
+		// ⟨ψ|P|ψ⟩ by applying P to ψ directly.
+		var sum complex128
+		label := simulator.PauliLabel(k, 3)
+		for m, a := range sv {
+			j, ph := m, complex(1, 0)
+			for q, f := range label {
+				bit := m >> q & 1
+				switch f {
+				case 'X':
+					j ^= 1 << q
+				case 'Y':
+					j ^= 1 << q
+					ph *= [2]complex128{1i, -1i}[bit]
+				case 'Z':
+					ph *= [2]complex128{1, -1}[bit]
+				}
+			}
+			sum += cmplx.Conj(sv[j]) * ph * a
+		}
+		assert.InDelta(t, real(sum), got, 1e-12, label)
+	}
+}
+
+func TestAverageGateFidelity(t *testing.T) {
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 1, Runner: qsim.NewQSimRunner()})
+	c, err := builder.New(builder.Q(1), builder.C(0)).X(0).BuildCircuit()
+	require.NoError(t, err)
+	ideal, err := sim.Process(c, simulator.NoiseModel{})
+	require.NoError(t, err)
+	noisy, err := sim.Process(c, simulator.NoiseModel{Depolarizing: 0.12})
+	require.NoError(t, err)
+	f, err := AverageGateFidelity(ideal, noisy)
+	require.NoError(t, err)
+	assert.InDelta(t, 1-2*0.12/3, f, 1e-12)
+}
+
+func TestDirectFidelity(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 4000, Runner: qsim.NewQSimRunner(), Seed: 7})
+	c, err := builder.New(builder.Q(3), builder.C(3)).H(0).CNOT(0, 1).CNOT(1, 2).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	require.NoError(err)
+
+	res, err := DirectFidelity(DFEOptions{Sim: sim, Circuit: c, Samples: 40, Seed: 1})
+	require.NoError(err)
+	assert.InDelta(1, res.Fidelity, 0.03)
+	assert.Positive(res.Paulis)
+
+	// The basis changes of the measurements suffer the noise too, so the
+	// estimate converges to Σ_k ⟨P_k⟩_ψ·⟨P_k⟩_k / 2^n, where ⟨P_k⟩_k is the
+	// parity of the noisy measurement circuit of P_k, read off the process
+	// matrix of that circuit applied to |000⟩⟨000| (coefficient 1 on every
+	// Z string).
+	nm := simulator.NoiseModel{Depolarizing: 0.06}
+	sv, err := sim.GetStatevector(c)
+	require.NoError(err)
+	char := characteristic(sv, 3)
+	want := 0.0
+	for k, b := range char {
+		if b == 0 {
+			continue
+		}
+		label := simulator.PauliLabel(k, 3)
+		mb := builder.New(builder.Q(3), builder.C(0)).H(0).CNOT(0, 1).CNOT(1, 2)
+		zs := 0
+		for q, f := range label {
+			switch f {
+			case 'X':
+				mb.H(q)
+			case 'Y':
+				mb.RX(math.Pi/2, q)
+			}
+			if f != 'I' {
+				zs |= 3 << (2 * q)
+			}
+		}
+		mc, err := mb.BuildCircuit()
+		require.NoError(err)
+		proc, err := sim.Process(mc, nm)
+		require.NoError(err)
+		parity := 0.0
+		for j, r := range proc.PTM[zs] {
+			if !strings.ContainsAny(simulator.PauliLabel(j, 3), "XY") {
+				parity += r
+			}
+		}
+		want += b * parity / 8
+	}
+
+	res, err = DirectFidelity(DFEOptions{Sim: sim, Circuit: c, Noise: nm, Samples: 200, Seed: 2})
+	require.NoError(err)
+	assert.InDelta(want, res.Fidelity, math.Max(0.04, 3*res.StdErr))
+	assert.Less(res.Fidelity, 0.95)
+}
+
+func TestDirectFidelityErrors(t *testing.T) {
+	_, err := DirectFidelity(DFEOptions{})
+	assert.Error(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 10, Runner: qsim.NewQSimRunner()})
+	cf, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).
+		If(builder.Bit(0), func(b builder.Builder) { b.X(0) }).BuildCircuit()
+	require.NoError(t, err)
+	_, err = DirectFidelity(DFEOptions{Sim: sim, Circuit: cf})
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package analysis
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Vectors over GF(2) are bit masks: coordinate i is bit i, as cbit i is
+// bit i of a simulator outcome.
+
+// RowReduceGF2 returns the reduced row echelon form of rows over GF(2):
+// the independent rows, each with a pivot column (its lowest set bit) that
+// is clear in every other row, in ascending pivot order.
+func RowReduceGF2(rows []uint64) (reduced []uint64, pivots []int) {
+	for _, r := range rows {
+		// Clear the existing pivots from r, then r's own pivot from them.
+		for i, p := range pivots {
+			if r>>p&1 == 1 {
+				r ^= reduced[i]
+			}
+		}
+		if r == 0 {
+			continue
+		}
+		p := bits.TrailingZeros64(r)
+		for i := range reduced {
+			if reduced[i]>>p&1 == 1 {
+				reduced[i] ^= r
+			}
+		}
+		at := len(pivots)
+		for at > 0 && pivots[at-1] > p {
+			at--
+		}
+		reduced = append(reduced[:at], append([]uint64{r}, reduced[at:]...)...)
+		pivots = append(pivots[:at], append([]int{p}, pivots[at:]...)...)
+	}
+	return reduced, pivots
+}
+
+// NullSpaceGF2 returns a basis of the vectors s of n bits with r·s = 0
+// (mod 2) for every row r, one vector per free column in ascending
+// order; none if only s = 0 solves them.
+func NullSpaceGF2(rows []uint64, n int) ([]uint64, error) {
+	if n < 1 || n > 64 {
+		return nil, fmt.Errorf("analysis: GF(2) vectors of %d bits, want 1 to 64", n)
+	}
+	for _, r := range rows {
+		if n < 64 && r>>n != 0 {
+			return nil, fmt.Errorf("analysis: row %b has more than %d bits", r, n)
+		}
+	}
+	reduced, pivots := RowReduceGF2(rows)
+	isPivot := make([]bool, n)
+	for _, p := range pivots {
+		isPivot[p] = true
+	}
+	var basis []uint64
+	for f := range n {
+		if isPivot[f] {
+			continue
+		}
+		s := uint64(1) << f
+		for i, r := range reduced {
+			if r>>f&1 == 1 {
+				s |= 1 << pivots[i]
+			}
+		}
+		basis = append(basis, s)
+	}
+	return basis, nil
+}
+
+// SimonSecret solves Simon's problem from the histogram of the measured
+// input register: every outcome y satisfies y·s = 0, so s spans the null
+// space of the outcomes. Keys hold one bit per input qubit, qubit 0
+// first; bit i of s is qubit i. It returns 0 when the outcomes span the
+// whole space (f is one-to-one) and fails while they leave more than one
+// candidate, i.e. more shots are needed. A single wrong outcome, e.g.
+// from noise, makes the answer 0.
+func SimonSecret(hist map[string]int) (uint64, error) {
+	n := -1
+	var ys []uint64
+	for key, count := range hist {
+		if n < 0 {
+			n = len(key)
+		}
+		if len(key) != n {
+			return 0, fmt.Errorf("analysis: key %q has %d bits, want %d", key, len(key), n)
+		}
+		if count <= 0 {
+			continue
+		}
+		y := uint64(0)
+		for i := range key {
+			switch key[i] {
+			case '1':
+				y |= 1 << i
+			case '0':
+			default:
+				return 0, fmt.Errorf("analysis: key %q is not binary", key)
+			}
+		}
+		ys = append(ys, y)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("analysis: cannot solve Simon's problem from an empty histogram")
+	}
+	basis, err := NullSpaceGF2(ys, n)
+	if err != nil {
+		return 0, err
+	}
+	switch len(basis) {
+	case 0:
+		return 0, nil
+	case 1:
+		return basis[0], nil
+	}
+	return 0, fmt.Errorf("analysis: outcomes leave %d candidate secrets; take more shots", 1<<len(basis)-1)
+}
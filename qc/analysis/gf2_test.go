@@ -0,0 +1,65 @@
+package analysis
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowReduceGF2(t *testing.T) {
+	// 011 and 110 span 101; 000 and the repeat add nothing.
+	reduced, pivots := RowReduceGF2([]uint64{0b110, 0b011, 0b101, 0, 0b110})
+	assert.Equal(t, []uint64{0b101, 0b110}, reduced)
+	assert.Equal(t, []int{0, 1}, pivots)
+
+	reduced, pivots = RowReduceGF2(nil)
+	assert.Empty(t, reduced)
+	assert.Empty(t, pivots)
+}
+
+func TestNullSpaceGF2(t *testing.T) {
+	rows := []uint64{0b0110, 0b0011}
+	basis, err := NullSpaceGF2(rows, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0b0111, 0b1000}, basis)
+	for _, s := range basis {
+		for _, r := range rows {
+			assert.Zero(t, bits.OnesCount64(r&s)%2, "row %b, s %b", r, s)
+		}
+	}
+
+	basis, err = NullSpaceGF2([]uint64{0b01, 0b10}, 2)
+	require.NoError(t, err)
+	assert.Empty(t, basis)
+	basis, err = NullSpaceGF2(nil, 64)
+	require.NoError(t, err)
+	assert.Len(t, basis, 64)
+
+	_, err = NullSpaceGF2([]uint64{0b100}, 2)
+	assert.ErrorContains(t, err, "more than 2 bits")
+	_, err = NullSpaceGF2(nil, 0)
+	assert.Error(t, err)
+}
+
+func TestSimonSecret(t *testing.T) {
+	// Keys are qubit 0 first: "100" is y = 0b001 and "011" is y = 0b110,
+	// both orthogonal to s = 0b110; unseen outcomes do not count.
+	s, err := SimonSecret(map[string]int{"000": 5, "100": 3, "010": 0, "011": 2})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0b110), s)
+
+	s, err = SimonSecret(map[string]int{"10": 1, "01": 1, "11": 1})
+	require.NoError(t, err)
+	assert.Zero(t, s, "one-to-one")
+
+	_, err = SimonSecret(map[string]int{"000": 5, "100": 3})
+	assert.ErrorContains(t, err, "3 candidate")
+	_, err = SimonSecret(map[string]int{})
+	assert.ErrorContains(t, err, "empty")
+	_, err = SimonSecret(map[string]int{"01": 1, "1": 1})
+	assert.ErrorContains(t, err, "bits")
+	_, err = SimonSecret(map[string]int{"0x": 1})
+	assert.ErrorContains(t, err, "not binary")
+}
@@ -0,0 +1,233 @@
+// Package bench finds how large a circuit each registered backend can
+// simulate: it grows benchmark circuits qubit by qubit until a backend
+// runs out of its time or memory budget, and records where that happened,
+// the data behind a "which backend for which size" table.
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Family is a benchmark circuit family, one circuit per qubit count.
+type Family struct {
+	Name  string
+	Build func(qubits int) (circuit.Circuit, error)
+}
+
+// GHZ prepares (|0…0⟩ + |1…1⟩)/√2 with a CNOT chain and measures every
+// qubit: shallow and entangling, cheap for structure-aware backends.
+var GHZ = Family{Name: "ghz", Build: func(n int) (circuit.Circuit, error) {
+	b := builder.New(builder.Q(n), builder.C(n))
+	b.H(0)
+	for q := 1; q < n; q++ {
+		b.CNOT(q-1, q)
+	}
+	for q := range n {
+		b.Measure(q, q)
+	}
+	return b.BuildCircuit()
+}}
+
+// QFT applies the quantum Fourier transform to an alternating basis state
+// and measures every qubit: n²/2 controlled phases that spread the state
+// over every amplitude.
+var QFT = Family{Name: "qft", Build: func(n int) (circuit.Circuit, error) {
+	b := builder.New(builder.Q(n), builder.C(n))
+	for q := 0; q < n; q += 2 {
+		b.X(q)
+	}
+	for j := n - 1; j >= 0; j-- {
+		b.H(j)
+		for k := j - 1; k >= 0; k-- {
+			b.CP(math.Pi/float64(int64(1)<<(j-k)), k, j)
+		}
+	}
+	for q := range n / 2 {
+		b.SWAP(q, n-1-q)
+	}
+	for q := range n {
+		b.Measure(q, q)
+	}
+	return b.BuildCircuit()
+}}
+
+// Config bounds a frontier search. Zero fields take the defaults.
+type Config struct {
+	Families []Family // GHZ and QFT by default
+	Runners  []string // every registered runner, without aliases, by default
+	// Start and MaxQubits are the first and the last size tried; 2 and
+	// 30 by default.
+	Start, MaxQubits int
+	Shots            int           // per run; 100 by default
+	Workers          int           // per run; runtime.NumCPU() by default
+	Time             time.Duration // per run; 10s by default
+	// Memory bounds the peak estimated by simulator.EstimateMemory, which
+	// assumes statevectors; 4 GiB by default.
+	Memory int64
+}
+
+func (c Config) withDefaults() Config {
+	if len(c.Families) == 0 {
+		c.Families = []Family{GHZ, QFT}
+	}
+	if len(c.Runners) == 0 {
+		c.Runners = distinctRunners()
+	}
+	if c.Start <= 0 {
+		c.Start = 2
+	}
+	if c.MaxQubits <= 0 {
+		c.MaxQubits = 30
+	}
+	if c.Shots <= 0 {
+		c.Shots = 100
+	}
+	if c.Workers <= 0 {
+		c.Workers = runtime.NumCPU()
+	}
+	if c.Time <= 0 {
+		c.Time = 10 * time.Second
+	}
+	if c.Memory <= 0 {
+		c.Memory = 4 << 30
+	}
+	return c
+}
+
+// distinctRunners lists the registered runners, one name per runner type,
+// so aliases such as "default" are measured once.
+func distinctRunners() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range simulator.ListRunners() {
+		r, err := simulator.CreateRunner(name)
+		if err != nil {
+			continue
+		}
+		if t := fmt.Sprintf("%T", r); !seen[t] {
+			seen[t] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Point is one size a backend ran.
+type Point struct {
+	Qubits int
+	Time   time.Duration
+	Memory int64 // estimated peak, see simulator.EstimateMemory
+}
+
+// Frontier is how far one backend got with one family.
+type Frontier struct {
+	Runner, Family string
+	// MaxQubits is the largest size that ran within the budget, 0 if none.
+	MaxQubits int
+	// Limit says why the search stopped, e.g. "time", "memory" or the
+	// runner's error at the next size; "max qubits" if it never did.
+	Limit  string
+	Points []Point
+}
+
+// Run measures the frontier of every runner on every family, in that
+// order. A backend stops growing at the first size that fails Validate
+// (unsupported features, statevector width), whose estimated memory or
+// time exceeds the budget, whose run fails, or whose run takes longer
+// than the budget. Before running a size it extrapolates the time from
+// the last two, so it does not start a run that would take far too long.
+func Run(cfg Config) ([]Frontier, error) {
+	cfg = cfg.withDefaults()
+	var out []Frontier
+	for _, name := range cfg.Runners {
+		for _, fam := range cfg.Families {
+			f, err := frontier(cfg, name, fam)
+			if err != nil {
+				return out, err
+			}
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func frontier(cfg Config, name string, fam Family) (Frontier, error) {
+	f := Frontier{Runner: name, Family: fam.Name, Limit: "max qubits"}
+	sim, err := simulator.NewSimulatorWithRunner(name, simulator.SimulatorOptions{
+		Shots: cfg.Shots, Workers: cfg.Workers,
+	})
+	if err != nil {
+		return f, fmt.Errorf("bench: %w", err)
+	}
+	sim.SetVerbose(false)
+	for n := cfg.Start; n <= cfg.MaxQubits; n++ {
+		c, err := fam.Build(n)
+		if err != nil {
+			return f, fmt.Errorf("bench: building %s on %d qubits: %w", fam.Name, n, err)
+		}
+		mem, stop := budget(cfg, sim, c, f.Points)
+		if stop != "" {
+			f.Limit = stop
+			return f, nil
+		}
+		start := time.Now()
+		_, err = sim.Run(c)
+		elapsed := time.Since(start)
+		if err != nil {
+			f.Limit = err.Error()
+			return f, nil
+		}
+		if elapsed > cfg.Time {
+			f.Limit = "time"
+			return f, nil
+		}
+		f.Points = append(f.Points, Point{Qubits: n, Time: elapsed, Memory: mem})
+		f.MaxQubits = n
+	}
+	return f, nil
+}
+
+// budget returns the estimated memory of running c and why it should not
+// be run, "" if it fits.
+func budget(cfg Config, sim *simulator.Simulator, c circuit.Circuit, done []Point) (int64, string) {
+	rep, err := sim.Validate(c)
+	switch {
+	case err != nil:
+		return rep.Memory, err.Error()
+	case rep.Memory > cfg.Memory:
+		return rep.Memory, "memory"
+	case rep.Time > cfg.Time:
+		return rep.Memory, "time"
+	}
+	if k := len(done); k >= 2 && done[k-2].Time > 0 {
+		growth := float64(done[k-1].Time) / float64(done[k-2].Time)
+		if float64(done[k-1].Time)*growth > float64(cfg.Time) {
+			return rep.Memory, "time"
+		}
+	}
+	return rep.Memory, ""
+}
+
+// Table writes frontiers as a table of backends by family: the largest
+// size each ran, its time and what stopped it.
+func Table(w io.Writer, fs []Frontier) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUNNER\tFAMILY\tMAX QUBITS\tTIME\tLIMIT")
+	for _, f := range fs {
+		t := "-"
+		if len(f.Points) > 0 {
+			t = f.Points[len(f.Points)-1].Time.Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", f.Runner, f.Family, f.MaxQubits, t, f.Limit)
+	}
+	return tw.Flush()
+}
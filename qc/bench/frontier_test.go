@@ -0,0 +1,53 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFamilies(t *testing.T) {
+	for _, f := range []Family{GHZ, QFT} {
+		c, err := f.Build(5)
+		require.NoError(t, err, f.Name)
+		assert.Equal(t, 5, c.Qubits(), f.Name)
+		assert.Equal(t, 5, c.Clbits(), f.Name)
+	}
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, err := Run(Config{Runners: []string{"qsim"}, Families: []Family{GHZ, QFT}, MaxQubits: 6, Workers: 1})
+	require.NoError(err)
+	require.Len(fs, 2)
+	for _, f := range fs {
+		assert.Equal("qsim", f.Runner)
+		assert.Equal(6, f.MaxQubits, f.Family)
+		assert.Equal("max qubits", f.Limit, f.Family)
+		require.Len(f.Points, 5, f.Family)
+		assert.Equal(2, f.Points[0].Qubits)
+	}
+
+	// A statevector of 2^n amplitudes outgrows 1 KiB within a few qubits.
+	fs, err = Run(Config{Runners: []string{"qsim"}, Families: []Family{GHZ}, Memory: 1 << 10, Workers: 1})
+	require.NoError(err)
+	assert.Equal("memory", fs[0].Limit)
+	assert.Less(fs[0].MaxQubits, 10)
+	for _, p := range fs[0].Points {
+		assert.LessOrEqual(p.Memory, int64(1<<10))
+	}
+
+	var sb strings.Builder
+	require.NoError(Table(&sb, fs))
+	assert.Contains(sb.String(), "RUNNER")
+	assert.Contains(sb.String(), "qsim")
+	assert.Contains(sb.String(), "memory")
+
+	_, err = Run(Config{Runners: []string{"no-such-runner"}})
+	assert.Error(err)
+}
@@ -0,0 +1,107 @@
+// Package bitorder converts between the bit order qcm uses everywhere and
+// the big-endian order of textbooks and most other toolkits.
+//
+// qcm is little-endian: qubit q is bit q of a statevector index, and
+// histogram keys list classical bit 0 first. Written as a binary number,
+// as OpenQASM results, Qiskit counts and ket labels are, the same value
+// reads the other way round: the key "110" (cbit 0 = 1, cbit 1 = 1,
+// cbit 2 = 0) is the number 0b011 = 3 and the ket |011⟩.
+package bitorder
+
+import "fmt"
+
+// Order is the order of the bits in a key or bit string.
+type Order int
+
+const (
+	// LSBFirst writes bit 0 first; qcm's raw keys use it.
+	LSBFirst Order = iota
+	// MSBFirst writes the highest bit first, so strings read as binary
+	// numbers.
+	MSBFirst
+)
+
+func (o Order) String() string {
+	if o == MSBFirst {
+		return "MSBFirst"
+	}
+	return "LSBFirst"
+}
+
+// Reverse reverses a bit string, converting it from one order to the other.
+func Reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// Convert rewrites a bit string written in order from to order to.
+func Convert(s string, from, to Order) string {
+	if from == to {
+		return s
+	}
+	return Reverse(s)
+}
+
+// Value returns the number a bit string written in order o encodes.
+func Value(s string, o Order) (uint64, error) {
+	if len(s) > 64 {
+		return 0, fmt.Errorf("bitorder: %d bits do not fit in a uint64", len(s))
+	}
+	var v uint64
+	for i := range len(s) {
+		ch := s[i]
+		if o == MSBFirst {
+			ch = s[len(s)-1-i]
+		}
+		switch ch {
+		case '1':
+			v |= 1 << i
+		case '0':
+		default:
+			return 0, fmt.Errorf("bitorder: %q is not a bit string", s)
+		}
+	}
+	return v, nil
+}
+
+// Format writes the low width bits of v in order o.
+func Format(v uint64, width int, o Order) string {
+	b := make([]byte, width)
+	for i := range width {
+		b[i] = '0' + byte(v>>i&1)
+	}
+	if o == MSBFirst {
+		return Reverse(string(b))
+	}
+	return string(b)
+}
+
+// ReverseIndex maps a basis-state index over width qubits from one order
+// to the other: bit q moves to bit width-1-q.
+func ReverseIndex(i, width int) int {
+	r := 0
+	for q := range width {
+		if i&(1<<q) != 0 {
+			r |= 1 << (width - 1 - q)
+		}
+	}
+	return r
+}
+
+// Statevector returns a copy of sv with its indices reversed, turning a
+// big-endian statevector (qubit 0 in the most significant bit) into
+// qcm's order or back. len(sv) must be a power of two.
+func Statevector(sv []complex128) []complex128 {
+	width := 0
+	for 1<<width < len(sv) {
+		width++
+	}
+	out := make([]complex128, len(sv))
+	for i, a := range sv {
+		out[ReverseIndex(i, width)] = a
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package bitorder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// cbit 0 = 1, cbit 1 = 1, cbit 2 = 0 is the number 3.
+	v, err := Value("110", LSBFirst)
+	require.NoError(err)
+	assert.Equal(uint64(3), v)
+	assert.Equal("011", Convert("110", LSBFirst, MSBFirst))
+	assert.Equal("110", Convert("110", LSBFirst, LSBFirst))
+
+	for width := range 7 {
+		for x := range uint64(1) << width {
+			for _, o := range []Order{LSBFirst, MSBFirst} {
+				s := Format(x, width, o)
+				got, err := Value(s, o)
+				require.NoError(err)
+				assert.Equal(x, got, "%s %s", s, o)
+			}
+			assert.Equal(Format(x, width, MSBFirst), Reverse(Format(x, width, LSBFirst)))
+		}
+	}
+
+	_, err = Value("01x", LSBFirst)
+	assert.Error(err)
+	_, err = Value(Format(0, 65, LSBFirst), LSBFirst)
+	assert.Error(err)
+}
+
+func TestStatevector(t *testing.T) {
+	assert := assert.New(t)
+
+	for width := range 5 {
+		for i := range 1 << width {
+			assert.Equal(i, ReverseIndex(ReverseIndex(i, width), width))
+		}
+	}
+	// |q0 q1 q2⟩ = |100⟩ big-endian is index 4; in qcm's order it is 1.
+	be := make([]complex128, 8)
+	be[4] = 1
+	le := Statevector(be)
+	assert.Equal(complex128(1), le[1])
+	assert.Equal(be, Statevector(le))
+}
@@ -0,0 +1,160 @@
+package builder
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// maxCheckedInputs bounds the classical uncompute check, which enumerates
+// every basis input of the ancilla's light cone.
+const maxCheckedInputs = 16
+
+// ancillaPool tracks which work qubits are handed out and which are free
+// for reuse. Freed qubits are reused LIFO so hot ancillas stay hot.
+type ancillaPool struct {
+	free []int
+	live map[int]int // qubit -> index into b.log at allocation time
+}
+
+func newAncillaPool() ancillaPool {
+	return ancillaPool{live: make(map[int]int)}
+}
+
+// liveQubits returns the allocated-but-not-freed ancillas in ascending order.
+func (p *ancillaPool) liveQubits() []int {
+	qs := make([]int, 0, len(p.live))
+	for q := range p.live {
+		qs = append(qs, q)
+	}
+	slices.Sort(qs)
+	return qs
+}
+
+// AllocAncilla returns a qubit in |0⟩ reserved for scratch work.
+// Freed ancillas are reused first; otherwise the circuit grows by one qubit.
+// It returns -1 if the builder is already in an error state.
+func (b *b) AllocAncilla() int {
+	if b.checkState() {
+		return -1
+	}
+	if n := len(b.ancillas.free); n > 0 {
+		q := b.ancillas.free[n-1]
+		b.ancillas.free = b.ancillas.free[:n-1]
+		b.ancillas.live[q] = len(b.log)
+		return q
+	}
+	q := b.dagBuilder.Qubits()
+	if err := b.dagBuilder.AddQubits(1); err != nil {
+		b.bail(err)
+		return -1
+	}
+	b.ancillas.live[q] = len(b.log)
+	return q
+}
+
+// FreeAncilla returns q to the pool. With CheckAncillas enabled the
+// operations since allocation are verified to leave q in |0⟩.
+func (b *b) FreeAncilla(q int) Builder {
+	if b.checkState() {
+		return b
+	}
+	start, ok := b.ancillas.live[q]
+	if !ok {
+		return b.bail(fmt.Errorf("%w: %d", ErrNotAncilla, q))
+	}
+	if b.cfg.checkAncillas {
+		if err := b.verifyUncomputed(q, start); err != nil {
+			return b.bail(err)
+		}
+	}
+	delete(b.ancillas.live, q)
+	b.ancillas.free = append(b.ancillas.free, q)
+	return b
+}
+
+// verifyUncomputed checks that the operations recorded since start return
+// ancilla q to |0⟩. Only the ancilla's backward light cone is considered and
+// it must consist of classical reversible gates (permutations, optionally with
+// diagonal phases); by linearity, restoring |0⟩ on every basis input then
+// restores it on any superposition. Other qubits are treated as arbitrary
+// inputs.
+func (b *b) verifyUncomputed(q, start int) error {
+	inCone := map[int]bool{q: true}
+	var cone []entry
+	for i := len(b.log) - 1; i >= start; i-- {
+		e := b.log[i]
+		if !slices.ContainsFunc(e.qubits, func(x int) bool { return inCone[x] }) {
+			continue
+		}
+		for _, x := range e.qubits {
+			inCone[x] = true
+		}
+		cone = append(cone, e)
+	}
+	slices.Reverse(cone)
+
+	inputs := make([]int, 0, len(inCone))
+	for x := range inCone {
+		if x != q {
+			inputs = append(inputs, x)
+		}
+	}
+	slices.Sort(inputs)
+	if len(inputs) > maxCheckedInputs {
+		return fmt.Errorf("builder: cannot verify ancilla %d: light cone spans %d qubits (max %d)",
+			q, len(inputs), maxCheckedInputs)
+	}
+
+	bits := make(map[int]bool, len(inCone))
+	for mask := 0; mask < 1<<len(inputs); mask++ {
+		for i, x := range inputs {
+			bits[x] = mask&(1<<i) != 0
+		}
+		bits[q] = false
+		for _, e := range cone {
+			if err := applyClassical(bits, e); err != nil {
+				return fmt.Errorf("builder: cannot verify ancilla %d: %w", q, err)
+			}
+		}
+		if bits[q] {
+			return fmt.Errorf("%w: qubit %d ends in |1⟩ for input %v=%0*b",
+				ErrAncillaDirty, q, inputs, len(inputs), mask)
+		}
+	}
+	return nil
+}
+
+// applyClassical evolves a computational basis state through e, expanding
+// composite gates into their primitive steps.
+func applyClassical(bits map[int]bool, e entry) error {
+	if e.cond != nil {
+		return fmt.Errorf("conditional %s on qubits %v depends on measurement results", e.g.Name(), e.qubits)
+	}
+	return gate.Expand(e.g, e.qubits, func(g gate.Gate, qs []int) error {
+		switch g.Name() {
+		case "X", "Y":
+			bits[qs[0]] = !bits[qs[0]]
+		case "CNOT":
+			if bits[qs[0]] {
+				bits[qs[1]] = !bits[qs[1]]
+			}
+		case "TOFFOLI":
+			if bits[qs[0]] && bits[qs[1]] {
+				bits[qs[2]] = !bits[qs[2]]
+			}
+		case "SWAP":
+			bits[qs[0]], bits[qs[1]] = bits[qs[1]], bits[qs[0]]
+		case "FREDKIN":
+			if bits[qs[0]] {
+				bits[qs[1]], bits[qs[2]] = bits[qs[2]], bits[qs[1]]
+			}
+		case "Z", "S", "CZ", "P", "CP", "RZ":
+			// diagonal: only phases change
+		default:
+			return fmt.Errorf("gate %s on qubits %v is not classical reversible", g.Name(), qs)
+		}
+		return nil
+	})
+}
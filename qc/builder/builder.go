@@ -2,13 +2,17 @@ package builder
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/kegliz/qcm/qc/circuit"
 	"github.com/kegliz/qcm/qc/dag"
 	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/synth"
 )
 
 // Builder implements a *fluent* declarative DSL for building quantum circuits.
+// A Builder is not safe for concurrent use; see ConcurrentBuilder.
 type Builder interface {
 	// Single-qubit gates
 	H(q int) Builder
@@ -16,6 +20,10 @@ type Builder interface {
 	Y(q int) Builder
 	S(q int) Builder
 	Z(q int) Builder
+	P(theta float64, q int) Builder // phase diag(1, e^{iθ})
+	RX(theta float64, q int) Builder
+	RY(theta float64, q int) Builder
+	RZ(theta float64, q int) Builder
 
 	// Multi-qubit gates
 	CNOT(ctrl, tgt int) Builder
@@ -23,10 +31,81 @@ type Builder interface {
 	SWAP(q1, q2 int) Builder
 	Toffoli(c1, c2, tgt int) Builder
 	Fredkin(ctrl, t1, t2 int) Builder
+	CP(theta float64, ctrl, tgt int) Builder
+
+	// Apply adds any gate, including composites from DefineGate, on the
+	// given qubits in the gate's own argument order.
+	Apply(g gate.Gate, qs ...int) Builder
+	// Apply1, Apply2 and Apply3 take built-in gates of that span, so a
+	// wrong number of qubits is a compile error; see gate.SingleQubitGate.
+	Apply1(g gate.SingleQubitGate, q int) Builder
+	Apply2(g gate.TwoQubitGate, q0, q1 int) Builder
+	Apply3(g gate.ThreeQubitGate, q0, q1, q2 int) Builder
+
+	// Initialize prepares the untouched qubits qs in the state with the
+	// given amplitudes, qs[i] being bit i of the index, using ordinary gates
+	// (see synth.PrepareState) so any backend can run it.
+	Initialize(amplitudes []complex128, qs ...int) Builder
+
+	// Append splices a template instance (see NewTemplate) into the circuit.
+	Append(in Instance) Builder
+
+	// Combinators
+	HAll() Builder                                  // H on every data qubit
+	ApplyAll(g gate.Gate) Builder                   // single-qubit g on every data qubit
+	ApplyToRange(g gate.Gate, from, to int) Builder // single-qubit g on qubits [from, to)
+	Map(qs []int, fn func(b Builder, q int)) Builder
+	CNOTLadder(qs ...int) Builder // CNOT(q0,q1), CNOT(q1,q2), …
 
 	// Measurement
 	Measure(q, cbit int) Builder
 
+	// Annotate attaches opaque backend metadata, e.g. a pulse calibration
+	// ID, to the operation added last (the last step of an inlined
+	// composite). qcm keeps it through every pass and serialisation
+	// without interpreting it; see dag.Meta.
+	Annotate(meta map[string]string) Builder
+
+	// Typed handles
+	// Qubits and Cbits return handles for every wire declared so far and
+	// RegBits those of a classical register added with CReg. MeasureTo is
+	// Measure with the arguments typed, so they cannot be swapped.
+	Qubits() []Qubit
+	Cbits() []Cbit
+	RegBits(name string) []Cbit
+	MeasureTo(q Qubit, c Cbit) Builder
+
+	// Classical control flow
+	// If plays then only in shots where cond holds at run time; IfElse
+	// plays els in the others. Blocks cannot be nested and may not measure
+	// into the bits of their own condition.
+	If(cond Condition, then func(b Builder)) Builder
+	IfElse(cond Condition, then, els func(b Builder)) Builder
+	// RepeatUntil plays body, then replays it while until does not hold,
+	// at most max times in total.
+	RepeatUntil(until Condition, max int, body func(b Builder)) Builder
+
+	// Ancilla management
+	// AllocAncilla returns a work qubit in |0⟩, growing the circuit if the
+	// pool is empty. FreeAncilla hands it back; the caller must have
+	// uncomputed it first.
+	AllocAncilla() int
+	FreeAncilla(q int) Builder
+
+	// Fork returns an independent builder that starts from everything added
+	// so far. Operations added to either one afterwards are not seen by the
+	// other, so a common prefix (e.g. state preparation) is written only
+	// once. The fork is a clone: its DAG is copied with DAG.Clone, in time
+	// proportional to the prefix.
+	Fork() Builder
+
+	// Usage report
+	UsedQubits() []int
+	UnusedQubits() []int
+	// Warnings lists unused qubits and classical bits and overwritten,
+	// never-read measurements; see the Strict option.
+	Warnings() []error
+
 	// Finalise
 	// BuildDAG returns a validated DAGReader interface.
 	// It returns an error if the DAG is invalid.
@@ -43,6 +122,21 @@ type b struct {
 	dagBuilder dag.DAGBuilder
 	err        error
 	built      bool
+
+	log      []entry // every operation added so far, in program order
+	ancillas ancillaPool
+	cfg      config
+	cond     *dag.Condition // condition of the If block being recorded
+}
+
+// entry records one operation as it was handed to the DAG.
+type entry struct {
+	g      gate.Gate
+	qubits []int
+	cbit   int            // -1 if none
+	cond   *dag.Condition // nil if unconditional
+	loop   *dag.Loop      // set for LOOP entries only
+	meta   dag.Meta       // nil if none
 }
 
 func newBuilder(opts ...Option) *b {
@@ -50,7 +144,17 @@ func newBuilder(opts ...Option) *b {
 	for _, o := range opts {
 		o(&cfg)
 	}
-	return &b{dagBuilder: dag.New(cfg.qubits, cfg.clbits)}
+	nb := &b{
+		dagBuilder: dag.New(cfg.qubits, cfg.clbits),
+		ancillas:   newAncillaPool(),
+		cfg:        cfg,
+	}
+	if len(cfg.cregs) > 0 {
+		if err := nb.dagBuilder.SetCRegs(cfg.cregs); err != nil {
+			nb.err = err
+		}
+	}
+	return nb
 }
 
 // helper: bail-out pattern
@@ -66,27 +170,118 @@ func (b *b) checkState() bool {
 	return b.built || b.err != nil
 }
 
-func (b *b) H(q int) Builder               { return b.add1(gate.H(), q) }
-func (b *b) X(q int) Builder               { return b.add1(gate.X(), q) }
-func (b *b) Y(q int) Builder               { return b.add1(gate.Y(), q) }
-func (b *b) S(q int) Builder               { return b.add1(gate.S(), q) }
-func (b *b) Z(q int) Builder               { return b.add1(gate.Z(), q) }
-func (b *b) CNOT(c, t int) Builder         { return b.add2(gate.CNOT(), c, t) }
-func (b *b) CZ(c, t int) Builder           { return b.add2(gate.CZ(), c, t) }
-func (b *b) SWAP(q1, q2 int) Builder       { return b.add2(gate.Swap(), q1, q2) }
-func (b *b) Toffoli(a, bq, t int) Builder  { return b.add3(gate.Toffoli(), a, bq, t) }
-func (b *b) Fredkin(c, t1, t2 int) Builder { return b.add3(gate.Fredkin(), c, t1, t2) }
+func (b *b) H(q int) Builder                    { return b.add1(gate.H(), q) }
+func (b *b) X(q int) Builder                    { return b.add1(gate.X(), q) }
+func (b *b) Y(q int) Builder                    { return b.add1(gate.Y(), q) }
+func (b *b) S(q int) Builder                    { return b.add1(gate.S(), q) }
+func (b *b) Z(q int) Builder                    { return b.add1(gate.Z(), q) }
+func (b *b) P(theta float64, q int) Builder     { return b.add1(gate.P(theta), q) }
+func (b *b) RX(theta float64, q int) Builder    { return b.add1(gate.RX(theta), q) }
+func (b *b) RY(theta float64, q int) Builder    { return b.add1(gate.RY(theta), q) }
+func (b *b) RZ(theta float64, q int) Builder    { return b.add1(gate.RZ(theta), q) }
+func (b *b) CNOT(c, t int) Builder              { return b.add2(gate.CNOT(), c, t) }
+func (b *b) CZ(c, t int) Builder                { return b.add2(gate.CZ(), c, t) }
+func (b *b) SWAP(q1, q2 int) Builder            { return b.add2(gate.Swap(), q1, q2) }
+func (b *b) Toffoli(a, bq, t int) Builder       { return b.add3(gate.Toffoli(), a, bq, t) }
+func (b *b) Fredkin(c, t1, t2 int) Builder      { return b.add3(gate.Fredkin(), c, t1, t2) }
+func (b *b) CP(theta float64, c, t int) Builder { return b.add2(gate.CP(theta), c, t) }
+
+func (b *b) Apply1(g gate.SingleQubitGate, q int) Builder   { return b.Apply(g, q) }
+func (b *b) Apply2(g gate.TwoQubitGate, q0, q1 int) Builder { return b.Apply(g, q0, q1) }
+func (b *b) Apply3(g gate.ThreeQubitGate, q0, q1, q2 int) Builder {
+	return b.Apply(g, q0, q1, q2)
+}
+
+func (b *b) Apply(g gate.Gate, qs ...int) Builder {
+	if b.checkState() {
+		return b
+	}
+	if g == nil {
+		return b.bail(fmt.Errorf("builder: Apply called with nil gate"))
+	}
+	if _, ok := g.(*gate.Composite); ok && b.cfg.inline {
+		if len(qs) != g.QubitSpan() {
+			return b.bail(dag.ErrSpan)
+		}
+		gate.Expand(g, qs, func(p gate.Gate, pq []int) error {
+			b.addGate(p, pq)
+			return b.err
+		})
+		return b
+	}
+	return b.addGate(g, append([]int(nil), qs...))
+}
+
+func (b *b) Initialize(amplitudes []complex128, qs ...int) Builder {
+	if b.checkState() {
+		return b
+	}
+	if len(amplitudes) != 1<<len(qs) {
+		return b.bail(fmt.Errorf("builder: Initialize needs %d amplitudes for %d qubit(s), got %d",
+			1<<len(qs), len(qs), len(amplitudes)))
+	}
+	used, _ := b.usage()
+	for _, q := range qs {
+		if _, ok := slices.BinarySearch(used, q); ok {
+			return b.bail(fmt.Errorf("builder: Initialize on qubit %d, which is no longer in |0⟩", q))
+		}
+	}
+	g, err := synth.PrepareState(amplitudes)
+	if err != nil {
+		return b.bail(err)
+	}
+	return b.Apply(g, qs...)
+}
 
 func (b *b) Measure(q, cbit int) Builder {
 	if b.checkState() {
 		return b
 	}
-	if err := b.dagBuilder.AddMeasure(q, cbit); err != nil {
+	return b.emit(entry{g: gate.Measure(), qubits: []int{q}, cbit: cbit})
+}
+
+func (b *b) Annotate(meta map[string]string) Builder {
+	if b.checkState() {
+		return b
+	}
+	if len(b.log) == 0 {
+		return b.bail(fmt.Errorf("builder: Annotate called before any operation"))
+	}
+	if err := b.dagBuilder.AnnotateLast(meta); err != nil {
 		return b.bail(err)
 	}
+	e := b.log[len(b.log)-1]
+	e.meta = maps.Clone(e.meta)
+	if e.meta == nil {
+		e.meta = dag.Meta{}
+	}
+	maps.Copy(e.meta, meta)
+	// Re-slicing copies the journal, which a Fork may share.
+	b.log = append(b.log[:len(b.log)-1:len(b.log)-1], e)
 	return b
 }
 
+func (parent *b) Fork() Builder {
+	f := &b{
+		dagBuilder: parent.dagBuilder.Clone(),
+		err:        parent.err,
+		built:      parent.built,
+		// Capping the capacity makes the fork's first append copy, so the
+		// shared prefix is never overwritten.
+		log:  parent.log[:len(parent.log):len(parent.log)],
+		cfg:  parent.cfg,
+		cond: parent.cond,
+		ancillas: ancillaPool{
+			free: slices.Clone(parent.ancillas.free),
+			live: maps.Clone(parent.ancillas.live),
+		},
+	}
+	if f.built {
+		f.bail(fmt.Errorf("builder: Fork after BuildDAG or BuildCircuit: %w", dag.ErrBuild))
+	}
+	return f
+}
+
 // BuildDAG validates the internal DAG and returns it as a DAGReader.
 // The builder becomes invalid after this call.
 func (b *b) BuildDAG() (dag.DAGReader, error) {
@@ -96,6 +291,14 @@ func (b *b) BuildDAG() (dag.DAGReader, error) {
 	if b.err != nil {
 		return nil, b.err
 	}
+	if live := b.ancillas.liveQubits(); len(live) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrAncillaLeak, live)
+	}
+	if b.cfg.strict {
+		if ws := b.Warnings(); len(ws) > 0 {
+			return nil, ws[0]
+		}
+	}
 
 	// Validate the DAG
 	if err := b.dagBuilder.Validate(); err != nil {
@@ -130,39 +333,91 @@ func (b *b) add1(g gate.Gate, q int) Builder {
 	if b.checkState() {
 		return b
 	}
-	if err := b.dagBuilder.AddGate(g, []int{q}); err != nil {
-		return b.bail(err)
-	}
-	return b
+	return b.addGate(g, []int{q})
 }
 
 func (b *b) add2(g gate.Gate, q0, q1 int) Builder {
 	if b.checkState() {
 		return b
 	}
-	if err := b.dagBuilder.AddGate(g, []int{q0, q1}); err != nil {
-		return b.bail(err)
-	}
-	return b
+	return b.addGate(g, []int{q0, q1})
 }
 
 func (b *b) add3(g gate.Gate, q0, q1, q2 int) Builder {
 	if b.checkState() {
 		return b
 	}
-	if err := b.dagBuilder.AddGate(g, []int{q0, q1, q2}); err != nil {
+	return b.addGate(g, []int{q0, q1, q2})
+}
+
+func (b *b) addGate(g gate.Gate, qs []int) Builder {
+	return b.emit(entry{g: g, qubits: qs, cbit: -1})
+}
+
+// emit hands one gate or measurement to the DAG, attaching the condition
+// of the enclosing If block, and journals it.
+func (b *b) emit(e entry) Builder {
+	if b.cond != nil {
+		if e.cond != nil {
+			return b.bail(ErrNestedCondition)
+		}
+		e.cond = b.cond
+	}
+	var err error
+	switch {
+	case e.cond != nil:
+		if slices.Contains(e.cond.Cbits, e.cbit) {
+			return b.bail(fmt.Errorf("builder: measurement into cbit %d inside a block conditioned on it", e.cbit))
+		}
+		err = b.dagBuilder.AddConditional(e.g, e.qubits, e.cbit, *e.cond)
+	case e.g.Name() == "MEASURE":
+		err = b.dagBuilder.AddMeasure(e.qubits[0], e.cbit)
+	default:
+		err = b.dagBuilder.AddGate(e.g, e.qubits)
+	}
+	if err == nil && e.meta != nil {
+		err = b.dagBuilder.AnnotateLast(e.meta)
+	}
+	if err != nil {
 		return b.bail(err)
 	}
+	b.log = append(b.log, e)
 	return b
 }
 
 // ------------------------- options -----------------------------------
 
 type config struct {
-	qubits int
-	clbits int
+	qubits        int
+	clbits        int
+	cregs         []dag.Register
+	checkAncillas bool
+	inline        bool
+	strict        bool
 }
 type Option func(*config)
 
 func Q(n int) Option { return func(c *config) { c.qubits = n } }
 func C(n int) Option { return func(c *config) { c.clbits = n } }
+
+// CReg appends a named classical register of the given size after the
+// classical bits declared so far. Registers are used to group histogram
+// keys, e.g. simulator.Result.Format.
+func CReg(name string, size int) Option {
+	return func(c *config) {
+		c.cregs = append(c.cregs, dag.Register{Name: name, Start: c.clbits, Size: size})
+		c.clbits += max(size, 0) // bad sizes are reported by the DAG
+	}
+}
+
+// CheckAncillas makes FreeAncilla verify that the ancilla was uncomputed
+// back to |0⟩ instead of trusting the caller.
+func CheckAncillas() Option { return func(c *config) { c.checkAncillas = true } }
+
+// Strict makes BuildDAG fail on the first of Warnings, e.g. a declared
+// qubit that is never used.
+func Strict() Option { return func(c *config) { c.strict = true } }
+
+// InlineComposites makes Apply expand composite gates into their primitive
+// steps instead of adding a single boxed operation.
+func InlineComposites() Option { return func(c *config) { c.inline = true } }
@@ -0,0 +1,471 @@
+package builder_test
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAncilla_GrowsAndReuses(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3), builder.C(1))
+	a := b.AllocAncilla()
+	assert.Equal(3, a, "first ancilla should be appended after the declared qubits")
+	b.Toffoli(0, 1, a).CNOT(a, 2).Toffoli(0, 1, a)
+	b.FreeAncilla(a)
+
+	again := b.AllocAncilla()
+	assert.Equal(a, again, "freed ancilla should be reused")
+	other := b.AllocAncilla()
+	assert.Equal(4, other, "pool should grow when empty")
+	b.FreeAncilla(again).FreeAncilla(other)
+
+	c, err := b.Measure(2, 0).BuildCircuit()
+	require.NoError(err)
+	assert.Equal(5, c.Qubits())
+}
+
+func TestAncilla_LeakAndMisuse(t *testing.T) {
+	b := builder.New(builder.Q(2))
+	b.AllocAncilla()
+	_, err := b.BuildCircuit()
+	assert.ErrorIs(t, err, builder.ErrAncillaLeak)
+
+	b = builder.New(builder.Q(2))
+	b.FreeAncilla(1)
+	_, err = b.BuildCircuit()
+	assert.ErrorIs(t, err, builder.ErrNotAncilla)
+
+	b = builder.New(builder.Q(2))
+	a := b.AllocAncilla()
+	b.FreeAncilla(a).FreeAncilla(a)
+	_, err = b.BuildCircuit()
+	assert.ErrorIs(t, err, builder.ErrNotAncilla, "double free should be rejected")
+}
+
+func TestAncilla_UncomputeCheck(t *testing.T) {
+	t.Run("Clean", func(t *testing.T) {
+		b := builder.New(builder.Q(4), builder.CheckAncillas())
+		b.H(0).H(1).H(2)
+		a := b.AllocAncilla()
+		b.Toffoli(0, 1, a).Toffoli(2, a, 3).Toffoli(0, 1, a)
+		b.FreeAncilla(a)
+		_, err := b.BuildCircuit()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Dirty", func(t *testing.T) {
+		b := builder.New(builder.Q(3), builder.CheckAncillas())
+		a := b.AllocAncilla()
+		b.Toffoli(0, 1, a).Toffoli(2, a, 0)
+		b.FreeAncilla(a)
+		_, err := b.BuildCircuit()
+		assert.ErrorIs(t, err, builder.ErrAncillaDirty)
+	})
+
+	t.Run("NotClassical", func(t *testing.T) {
+		b := builder.New(builder.Q(1), builder.CheckAncillas())
+		a := b.AllocAncilla()
+		b.H(a).H(a)
+		b.FreeAncilla(a)
+		_, err := b.BuildCircuit()
+		assert.ErrorContains(t, err, "not classical reversible")
+	})
+
+	t.Run("UncheckedTrustsCaller", func(t *testing.T) {
+		b := builder.New(builder.Q(1))
+		a := b.AllocAncilla()
+		b.X(a)
+		b.FreeAncilla(a)
+		_, err := b.BuildCircuit()
+		assert.NoError(t, err)
+	})
+}
+
+func TestDefineGate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	body := func(g builder.Builder, q []int) {
+		g.H(q[0]).CNOT(q[0], q[1])
+	}
+	bell, err := builder.DefineGate("BellPair", 2, body)
+	require.NoError(err)
+	defer gate.Unregister("BellPair")
+
+	byName, err := gate.Factory("bellpair")
+	require.NoError(err)
+	assert.Same(bell, byName)
+
+	c, err := builder.New(builder.Q(3)).Apply(bell, 2, 0).BuildCircuit()
+	require.NoError(err)
+	ops := c.Operations()
+	require.Len(ops, 1, "composite should stay a single operation")
+	assert.Equal("BellPair", ops[0].G.Name())
+	assert.Equal([]int{2, 0}, ops[0].Qubits)
+
+	c, err = builder.New(builder.Q(3), builder.InlineComposites()).Apply(bell, 2, 0).BuildCircuit()
+	require.NoError(err)
+	ops = c.Operations()
+	require.Len(ops, 2, "inlined composite should expand into its steps")
+	assert.Equal(gate.H(), ops[0].G)
+	assert.Equal([]int{2}, ops[0].Qubits)
+	assert.Equal(gate.CNOT(), ops[1].G)
+	assert.Equal([]int{2, 0}, ops[1].Qubits)
+
+	_, err = builder.New(builder.Q(3)).Apply(bell, 0).BuildCircuit()
+	assert.ErrorIs(err, dag.ErrSpan)
+
+	_, err = builder.BuildGate("Measuring", 1, func(g builder.Builder, q []int) {
+		g.Measure(q[0], 0)
+	})
+	assert.Error(err, "measurements are not allowed in gate bodies")
+}
+
+func TestCombinators(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(4))
+	a := b.AllocAncilla()
+	b.FreeAncilla(a)
+	b.HAll().ApplyToRange(gate.X(), 1, 3).CNOTLadder(0, 1, 2, 3)
+	b.Map([]int{3, 0}, func(b builder.Builder, q int) { b.Z(q) })
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	counts := map[string][]int{}
+	for _, op := range c.Operations() {
+		counts[op.G.Name()] = append(counts[op.G.Name()], op.Qubits...)
+	}
+	assert.ElementsMatch([]int{0, 1, 2, 3}, counts["H"], "HAll should skip the pooled ancilla")
+	assert.ElementsMatch([]int{1, 2}, counts["X"], "ApplyToRange is half-open")
+	assert.ElementsMatch([]int{0, 1, 1, 2, 2, 3}, counts["CNOT"])
+	assert.ElementsMatch([]int{3, 0}, counts["Z"])
+
+	_, err = builder.New(builder.Q(2)).ApplyAll(gate.CNOT()).BuildCircuit()
+	assert.ErrorIs(err, dag.ErrSpan, "ApplyAll only takes single-qubit gates")
+	_, err = builder.New(builder.Q(2)).ApplyToRange(gate.H(), 2, 1).BuildCircuit()
+	assert.Error(err)
+}
+
+func TestTemplate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Parity check gadget: data qubits 0,1 onto syndrome qubit 2, measured.
+	parity, err := builder.NewTemplate(3, 1, func(b builder.Builder, q, c []int) {
+		b.CNOT(q[0], q[2]).CNOT(q[1], q[2]).Measure(q[2], c[0])
+	})
+	require.NoError(err)
+	assert.Equal(3, parity.Qubits())
+	assert.Equal(1, parity.Clbits())
+
+	b := builder.New(builder.Q(5), builder.C(2))
+	b.Append(parity.Instantiate(0, 1, 3).Cbits(0))
+	b.Append(parity.Instantiate(1, 2, 4).Cbits(1))
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	var measured [][2]int
+	var cnots [][]int
+	for _, op := range c.Operations() {
+		switch op.G {
+		case gate.Measure():
+			measured = append(measured, [2]int{op.Qubits[0], op.Cbit})
+		case gate.CNOT():
+			cnots = append(cnots, op.Qubits)
+		}
+	}
+	assert.ElementsMatch([][2]int{{3, 0}, {4, 1}}, measured)
+	assert.ElementsMatch([][]int{{0, 3}, {1, 3}, {1, 4}, {2, 4}}, cnots)
+
+	_, err = builder.New(builder.Q(5), builder.C(1)).Append(parity.Instantiate(0, 1)).BuildCircuit()
+	assert.ErrorContains(err, "template takes 3 qubit(s) and 1 cbit(s)")
+	_, err = builder.New(builder.Q(2), builder.C(1)).Append(parity.Instantiate(0, 1, 2).Cbits(0)).BuildCircuit()
+	assert.ErrorIs(err, dag.ErrBadQubit)
+}
+
+func TestControlFlow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.H(0).Measure(0, 0)
+	b.IfElse(builder.Bit(0),
+		func(b builder.Builder) { b.X(1) },
+		func(b builder.Builder) { b.Z(1).Y(1) })
+	b.RepeatUntil(builder.Bit(1), 10, func(b builder.Builder) {
+		b.H(1).Measure(1, 1)
+	})
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	var conds []string
+	var loop *circuit.Loop
+	for _, op := range c.Operations() {
+		if op.Cond != nil {
+			conds = append(conds, fmt.Sprintf("%s:%v", op.G.Name(), op.Cond.Negate))
+		}
+		if op.Loop != nil {
+			loop = op.Loop
+		}
+	}
+	assert.ElementsMatch([]string{"X:false", "Z:true", "Y:true"}, conds)
+	require.NotNil(loop)
+	assert.Len(loop.Body, 2)
+	assert.Equal(10, loop.Max)
+	assert.True(circuit.HasControlFlow(c))
+
+	_, err = builder.New(builder.Q(1), builder.C(1)).If(builder.Bit(0), func(b builder.Builder) {
+		b.If(builder.Bit(0), func(b builder.Builder) { b.X(0) })
+	}).BuildCircuit()
+	assert.ErrorIs(err, builder.ErrNestedCondition)
+
+	_, err = builder.New(builder.Q(1), builder.C(1)).If(builder.Bit(0), func(b builder.Builder) {
+		b.Measure(0, 0)
+	}).BuildCircuit()
+	assert.ErrorContains(err, "conditioned on it")
+
+	_, err = builder.New(builder.Q(1), builder.C(1)).If(builder.Bits(1, 3), func(b builder.Builder) {
+		b.X(0)
+	}).BuildCircuit()
+	assert.ErrorIs(err, dag.ErrBadClbit)
+}
+
+func TestUsageReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(4), builder.C(3))
+	b.H(0).CNOT(0, 2).Measure(0, 0).Measure(2, 0)
+	assert.Equal([]int{0, 2}, b.UsedQubits())
+	assert.Equal([]int{1, 3}, b.UnusedQubits())
+
+	ws := b.Warnings()
+	require.Len(ws, 3)
+	assert.ErrorIs(ws[0], builder.ErrUnusedQubit)
+	assert.ErrorIs(ws[1], builder.ErrUnusedClbit)
+	assert.Contains(ws[1].Error(), "[1 2]")
+	assert.ErrorIs(ws[2], builder.ErrCbitOverwritten)
+	assert.Contains(ws[2].Error(), "cbit 0 (measuring qubit 2)")
+	_, err := b.BuildCircuit()
+	assert.NoError(err, "warnings do not fail a lenient build")
+
+	// Reading a cbit between measurements, as mid-circuit reset does, is fine.
+	b = builder.New(builder.Q(2), builder.C(1), builder.Strict())
+	b.H(0).Measure(0, 0).If(builder.Bit(0), func(b builder.Builder) { b.X(0) })
+	b.H(1).CNOT(1, 0).Measure(0, 0)
+	assert.Empty(b.Warnings())
+	_, err = b.BuildCircuit()
+	assert.NoError(err)
+
+	b = builder.New(builder.Q(2), builder.C(1), builder.Strict())
+	b.H(0).Measure(0, 0)
+	_, err = b.BuildCircuit()
+	assert.ErrorIs(err, builder.ErrUnusedQubit, "strict mode rejects the first warning")
+}
+
+func TestFork(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	prefix := builder.New(builder.Q(2), builder.C(2))
+	prefix.H(0).H(1)
+
+	x := prefix.Fork()
+	x.X(1).Measure(0, 0).Measure(1, 1)
+	z := prefix.Fork()
+	z.CZ(0, 1).Measure(0, 0).Measure(1, 1)
+	prefix.CNOT(0, 1)
+
+	names := func(b builder.Builder) []string {
+		c, err := b.BuildCircuit()
+		require.NoError(err)
+		var out []string
+		for _, op := range c.Operations() {
+			out = append(out, op.G.Name())
+		}
+		return out
+	}
+	assert.ElementsMatch([]string{"H", "H", "X", "MEASURE", "MEASURE"}, names(x))
+	assert.ElementsMatch([]string{"H", "H", "CZ", "MEASURE", "MEASURE"}, names(z))
+	assert.ElementsMatch([]string{"H", "H", "CNOT"}, names(prefix))
+
+	// Ancilla state is forked too.
+	b := builder.New(builder.Q(1))
+	a := b.AllocAncilla()
+	f := b.Fork()
+	f.FreeAncilla(a)
+	_, err := f.BuildCircuit()
+	assert.NoError(err)
+	_, err = b.BuildCircuit()
+	assert.ErrorIs(err, builder.ErrAncillaLeak, "freeing in the fork must not free in the parent")
+
+	_, err = x.Fork().BuildCircuit()
+	assert.ErrorIs(err, dag.ErrBuild, "a built builder cannot be forked")
+}
+
+func TestInitialize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h := complex(1/math.Sqrt2, 0)
+	c, err := builder.New(builder.Q(3), builder.C(2)).
+		Initialize([]complex128{h, 0, 0, h}, 2, 0).Measure(0, 0).Measure(2, 1).BuildCircuit()
+	require.NoError(err)
+	op := c.Operations()[0]
+	assert.Equal("INIT", op.G.Name())
+	assert.Equal([]int{2, 0}, op.Qubits)
+
+	_, err = builder.New(builder.Q(2)).Initialize([]complex128{1, 0}, 0, 1).BuildCircuit()
+	assert.ErrorContains(err, "needs 4 amplitudes")
+	_, err = builder.New(builder.Q(2)).H(1).Initialize([]complex128{h, h}, 1).BuildCircuit()
+	assert.ErrorContains(err, "qubit 1")
+	_, err = builder.New(builder.Q(1)).Initialize([]complex128{1, 1}, 0).BuildCircuit()
+	assert.ErrorContains(err, "normalised")
+}
+
+func TestTypedHandles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(1), builder.CReg("out", 2))
+	qs, out := b.Qubits(), b.RegBits("out")
+	assert.Equal([]builder.Qubit{0, 1}, qs)
+	assert.Equal([]builder.Cbit{1, 2}, out)
+	assert.Equal([]builder.Cbit{0, 1, 2}, b.Cbits())
+
+	b.H(int(qs[0])).CNOT(int(qs[0]), int(qs[1])).MeasureTo(qs[0], out[0]).MeasureTo(qs[1], out[1])
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+	var measured [][2]int
+	for _, op := range c.Operations() {
+		if op.G.Name() == "MEASURE" {
+			measured = append(measured, [2]int{op.Qubits[0], op.Cbit})
+		}
+	}
+	assert.ElementsMatch([][2]int{{0, 1}, {1, 2}}, measured)
+
+	b = builder.New(builder.Q(1), builder.C(1))
+	assert.Nil(b.RegBits("missing"))
+	_, err = b.BuildCircuit()
+	assert.ErrorContains(err, `"missing"`)
+}
+
+func TestTypedApply(t *testing.T) {
+	require := require.New(t)
+
+	typed, err := builder.New(builder.Q(3)).
+		Apply1(gate.RY(0.3), 0).Apply2(gate.CP(0.7), 0, 1).Apply3(gate.Toffoli(), 0, 1, 2).BuildCircuit()
+	require.NoError(err)
+	plain, err := builder.New(builder.Q(3)).
+		RY(0.3, 0).CP(0.7, 0, 1).Toffoli(0, 1, 2).BuildCircuit()
+	require.NoError(err)
+	require.Equal(plain.Operations(), typed.Operations())
+}
+
+func TestConcurrentBuilder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const parts = 4
+	ghz := func(b builder.Builder, base int) {
+		b.H(base).CNOT(base, base+1).CNOT(base+1, base+2)
+		b.If(builder.Bit(base), func(b builder.Builder) { b.X(base + 2) })
+	}
+
+	cb := builder.NewConcurrent(builder.Q(3*parts), builder.C(3*parts))
+	regions := make([]builder.Builder, parts)
+	for i := range regions {
+		base := 3 * i
+		r, err := cb.Region([]int{base, base + 1, base + 2}, []int{base, base + 1, base + 2})
+		require.NoError(err)
+		regions[i] = r
+	}
+	var wg sync.WaitGroup
+	for i, r := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			base := 3 * i
+			r.Measure(base+1, base)
+			ghz(r, base)
+		}()
+	}
+	wg.Wait()
+	got, err := cb.BuildCircuit()
+	require.NoError(err)
+
+	seq := builder.New(builder.Q(3*parts), builder.C(3*parts))
+	for i := range parts {
+		seq.Measure(3*i+1, 3*i)
+		ghz(seq, 3*i)
+	}
+	want, err := seq.BuildCircuit()
+	require.NoError(err)
+	assert.Equal(want.Operations(), got.Operations())
+
+	_, err = cb.BuildCircuit()
+	assert.ErrorIs(err, dag.ErrBuild)
+
+	cb = builder.NewConcurrent(builder.Q(4), builder.C(1))
+	_, err = cb.Region([]int{0, 1}, nil)
+	require.NoError(err)
+	_, err = cb.Region([]int{1, 2}, nil)
+	assert.ErrorContains(err, "qubit 1 already belongs")
+
+	r, err := cb.Region([]int{2, 3}, nil)
+	require.NoError(err)
+	r.CNOT(2, 0)
+	_, err = cb.BuildCircuit()
+	assert.ErrorContains(err, "qubit 0 outside the region")
+}
+
+func TestAnnotate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tpl, err := builder.NewTemplate(1, 0, func(b builder.Builder, q, _ []int) {
+		b.X(q[0]).Annotate(map[string]string{"cal": "x_v2"})
+	})
+	require.NoError(err)
+	b := builder.New(builder.Q(2), builder.C(1))
+	b.H(0).Annotate(map[string]string{"cal": "h_v1"}).Annotate(map[string]string{"amp": "0.9"})
+	f := b.Fork()
+	f.Annotate(map[string]string{"cal": "forked"})
+	b.Append(tpl.Instantiate(1)).Measure(0, 0).Annotate(map[string]string{"kernel": "boxcar"})
+	b.RepeatUntil(builder.Bit(0), 3, func(b builder.Builder) {
+		b.H(0).Annotate(map[string]string{"cal": "h_loop"}).Measure(0, 0)
+	}).Annotate(map[string]string{"loop": "rus"})
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	ops := c.Operations()
+	require.Len(ops, 4)
+	assert.Equal(circuit.Meta{"cal": "h_v1", "amp": "0.9"}, ops[0].Meta)
+	assert.Equal(circuit.Meta{"cal": "x_v2"}, ops[1].Meta)
+	assert.Equal(circuit.Meta{"kernel": "boxcar"}, ops[2].Meta)
+	assert.Equal(circuit.Meta{"loop": "rus"}, ops[3].Meta)
+	assert.Equal(circuit.Meta{"cal": "h_loop"}, ops[3].Loop.Body[0].Meta)
+	assert.Nil(ops[3].Loop.Body[1].Meta)
+
+	fc, err := f.BuildCircuit()
+	require.NoError(err)
+	assert.Equal(circuit.Meta{"cal": "forked", "amp": "0.9"}, fc.Operations()[0].Meta)
+
+	_, err = builder.New(builder.Q(1)).Annotate(map[string]string{"a": "b"}).BuildCircuit()
+	assert.ErrorContains(err, "before any operation")
+	_, err = builder.New(builder.Q(1)).X(0).Annotate(map[string]string{"a": "b c"}).BuildCircuit()
+	assert.ErrorContains(err, "forbidden character")
+}
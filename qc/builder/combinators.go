@@ -0,0 +1,67 @@
+package builder
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// HAll applies H to every data qubit (ancillas are skipped).
+func (b *b) HAll() Builder { return b.ApplyAll(gate.H()) }
+
+// ApplyAll applies the single-qubit gate g to every data qubit.
+func (b *b) ApplyAll(g gate.Gate) Builder {
+	if b.checkState() {
+		return b
+	}
+	for _, q := range b.dataQubits() {
+		b.add1(g, q)
+	}
+	return b
+}
+
+// ApplyToRange applies the single-qubit gate g to qubits from..to-1.
+func (b *b) ApplyToRange(g gate.Gate, from, to int) Builder {
+	if b.checkState() {
+		return b
+	}
+	if from > to {
+		return b.bail(fmt.Errorf("builder: ApplyToRange: empty range [%d, %d)", from, to))
+	}
+	for q := from; q < to; q++ {
+		b.add1(g, q)
+	}
+	return b
+}
+
+// Map calls fn once per qubit in qs, in order, on this builder.
+func (b *b) Map(qs []int, fn func(b Builder, q int)) Builder {
+	for _, q := range qs {
+		if b.checkState() {
+			break
+		}
+		fn(b, q)
+	}
+	return b
+}
+
+// CNOTLadder entangles qs in a chain: CNOT(q0,q1), CNOT(q1,q2), …
+func (b *b) CNOTLadder(qs ...int) Builder {
+	for i := 1; i < len(qs); i++ {
+		b.add2(gate.CNOT(), qs[i-1], qs[i])
+	}
+	return b
+}
+
+// dataQubits lists the qubits that are not managed by the ancilla pool.
+func (b *b) dataQubits() []int {
+	qs := make([]int, 0, b.dagBuilder.Qubits())
+	for q := range b.dagBuilder.Qubits() {
+		if _, live := b.ancillas.live[q]; live || slices.Contains(b.ancillas.free, q) {
+			continue
+		}
+		qs = append(qs, q)
+	}
+	return qs
+}
@@ -0,0 +1,155 @@
+package builder
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// ConcurrentBuilder assembles one circuit from parts built by several
+// goroutines. A Builder itself is not safe for concurrent use; instead each
+// goroutine takes its own Builder from Region, restricted to qubits and
+// classical bits no other region owns. Building splices the regions in the
+// order they were reserved, so the circuit does not depend on scheduling.
+type ConcurrentBuilder struct {
+	mu      sync.Mutex
+	opts    []Option
+	qubits  map[int]bool
+	cbits   map[int]bool
+	regions []*region
+	built   bool
+}
+
+type region struct {
+	b      *b
+	qubits []int
+	cbits  []int
+}
+
+// NewConcurrent returns a ConcurrentBuilder for a circuit declared by opts,
+// as for New.
+func NewConcurrent(opts ...Option) *ConcurrentBuilder {
+	return &ConcurrentBuilder{opts: opts, qubits: map[int]bool{}, cbits: map[int]bool{}}
+}
+
+// Region reserves qubits and cbits and returns a Builder for them, to be
+// used by a single goroutine. Operations on any other wire, and ancilla
+// allocation, are reported when the circuit is built.
+func (c *ConcurrentBuilder) Region(qubits, cbits []int) (Builder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.built {
+		return nil, fmt.Errorf("%w: concurrent builder already built", dag.ErrBuild)
+	}
+	rb := newBuilder(c.opts...)
+	for _, q := range qubits {
+		if q < 0 || q >= rb.dagBuilder.Qubits() {
+			return nil, fmt.Errorf("builder: region qubit %d out of range", q)
+		}
+		if c.qubits[q] {
+			return nil, fmt.Errorf("builder: qubit %d already belongs to another region", q)
+		}
+	}
+	for _, cb := range cbits {
+		if cb < 0 || cb >= rb.dagBuilder.Clbits() {
+			return nil, fmt.Errorf("builder: region cbit %d out of range", cb)
+		}
+		if c.cbits[cb] {
+			return nil, fmt.Errorf("builder: cbit %d already belongs to another region", cb)
+		}
+	}
+	for _, q := range qubits {
+		c.qubits[q] = true
+	}
+	for _, cb := range cbits {
+		c.cbits[cb] = true
+	}
+	r := &region{b: rb, qubits: slices.Clone(qubits), cbits: slices.Clone(cbits)}
+	c.regions = append(c.regions, r)
+	return rb, nil
+}
+
+// BuildDAG splices the regions into one builder and builds it. No region
+// Builder may be in use any more.
+func (c *ConcurrentBuilder) BuildDAG() (dag.DAGReader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.built {
+		return nil, fmt.Errorf("%w: concurrent builder already built", dag.ErrBuild)
+	}
+	c.built = true
+	out := newBuilder(c.opts...)
+	for i, r := range c.regions {
+		if err := r.check(out.dagBuilder.Qubits()); err != nil {
+			return nil, fmt.Errorf("builder: region %d: %w", i, err)
+		}
+		for _, e := range r.b.log {
+			if e.loop != nil {
+				body := make([]*dag.Node, len(e.loop.Body))
+				for j, n := range e.loop.Body {
+					body[j] = &dag.Node{G: n.G, Qubits: n.Qubits, Cbit: n.Cbit, Cond: n.Cond, Loop: n.Loop, Meta: n.Meta}
+				}
+				if err := out.dagBuilder.AddLoop(body, e.loop.Until, e.loop.Max); err != nil {
+					return nil, err
+				}
+				if e.meta != nil {
+					if err := out.dagBuilder.AnnotateLast(e.meta); err != nil {
+						return nil, err
+					}
+				}
+				out.log = append(out.log, entry{g: e.g, qubits: e.qubits, cbit: -1, meta: e.meta,
+					loop: &dag.Loop{Body: body, Until: e.loop.Until, Max: e.loop.Max}})
+				continue
+			}
+			if out.emit(e); out.err != nil {
+				return nil, out.err
+			}
+		}
+	}
+	return out.BuildDAG()
+}
+
+// BuildCircuit is BuildDAG wrapped as a circuit.
+func (c *ConcurrentBuilder) BuildCircuit() (circuit.Circuit, error) {
+	d, err := c.BuildDAG()
+	if err != nil {
+		return nil, err
+	}
+	return circuit.FromDAG(d), nil
+}
+
+// check verifies that the region stayed on its own wires.
+func (r *region) check(width int) error {
+	if r.b.err != nil {
+		return r.b.err
+	}
+	if r.b.dagBuilder.Qubits() != width || len(r.b.ancillas.live) > 0 {
+		return fmt.Errorf("ancillas are not allowed here")
+	}
+	for _, e := range r.b.log {
+		qs, cs := e.qubits, []int{}
+		if e.cbit >= 0 {
+			cs = append(cs, e.cbit)
+		}
+		if e.cond != nil {
+			cs = append(cs, e.cond.Cbits...)
+		}
+		if e.loop != nil {
+			cs = append(cs, e.loop.Cbits()...)
+		}
+		for _, q := range qs {
+			if !slices.Contains(r.qubits, q) {
+				return fmt.Errorf("%s uses qubit %d outside the region", e.g.Name(), q)
+			}
+		}
+		for _, cb := range cs {
+			if !slices.Contains(r.cbits, cb) {
+				return fmt.Errorf("%s uses cbit %d outside the region", e.g.Name(), cb)
+			}
+		}
+	}
+	return nil
+}
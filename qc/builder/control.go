@@ -0,0 +1,73 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Condition is a run-time test on measured classical bits.
+type Condition = dag.Condition
+
+// Bit is the condition "cbit c was measured as 1". Use Bit(c).Not() for 0.
+func Bit(c int) Condition { return Condition{Cbits: []int{c}, Value: 1} }
+
+// Bits is the condition "cbits cs, read with cs[0] as the least significant
+// bit, equal value".
+func Bits(value int, cs ...int) Condition {
+	return Condition{Cbits: append([]int(nil), cs...), Value: value}
+}
+
+func (b *b) If(cond Condition, then func(b Builder)) Builder {
+	return b.IfElse(cond, then, nil)
+}
+
+func (b *b) IfElse(cond Condition, then, els func(b Builder)) Builder {
+	if b.checkState() {
+		return b
+	}
+	if b.cond != nil {
+		return b.bail(ErrNestedCondition)
+	}
+	for _, branch := range []struct {
+		cond Condition
+		body func(Builder)
+	}{{cond, then}, {cond.Not(), els}} {
+		if branch.body == nil {
+			continue
+		}
+		c := branch.cond
+		b.cond = &c
+		branch.body(b)
+		b.cond = nil
+		if b.err != nil {
+			break
+		}
+	}
+	return b
+}
+
+func (b *b) RepeatUntil(until Condition, max int, body func(b Builder)) Builder {
+	if b.checkState() {
+		return b
+	}
+	if b.cond != nil {
+		return b.bail(fmt.Errorf("builder: loops cannot be placed inside a conditional block"))
+	}
+	log, err := record(b.dagBuilder.Qubits(), b.dagBuilder.Clbits(), body)
+	if err != nil {
+		return b.bail(fmt.Errorf("builder: recording loop body: %w", err))
+	}
+	nodes := make([]*dag.Node, len(log))
+	for i, e := range log {
+		nodes[i] = &dag.Node{G: e.g, Qubits: e.qubits, Cbit: e.cbit, Cond: e.cond, Loop: e.loop, Meta: e.meta}
+	}
+	if err := b.dagBuilder.AddLoop(nodes, until, max); err != nil {
+		return b.bail(err)
+	}
+	l := &dag.Loop{Body: nodes, Until: until, Max: max}
+	qs := l.Qubits()
+	b.log = append(b.log, entry{g: gate.Loop(len(qs)), qubits: qs, cbit: -1, loop: l})
+	return b
+}
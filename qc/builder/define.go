@@ -0,0 +1,40 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// BuildGate records body, played on n fresh qubits, as a composite gate.
+// The qubit slice handed to body is simply 0..n-1. Measurements and
+// ancilla allocation are not allowed inside a definition.
+func BuildGate(name string, n int, body func(b Builder, q []int)) (*gate.Composite, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("builder: gate %s must act on at least one qubit, got %d", name, n)
+	}
+	log, err := record(n, 0, func(sb Builder) { body(sb, span(n)) })
+	if err != nil {
+		return nil, fmt.Errorf("builder: defining gate %s: %w", name, err)
+	}
+
+	steps := make([]gate.Step, len(log))
+	for i, e := range log {
+		steps[i] = gate.Step{G: e.g, Qubits: e.qubits}
+	}
+	return gate.NewComposite(name, n, steps)
+}
+
+// DefineGate is BuildGate plus gate.Register, so the composite can also be
+// resolved by name through gate.Factory. gate.Define also takes a render
+// symbol and a matrix for runners to apply natively.
+func DefineGate(name string, n int, body func(b Builder, q []int)) (gate.Gate, error) {
+	g, err := BuildGate(name, n, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := gate.Register(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
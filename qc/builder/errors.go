@@ -0,0 +1,16 @@
+package builder
+
+import "fmt"
+
+// Public error helpers so callers can assert specific failures.
+var (
+	ErrNotAncilla   = fmt.Errorf("builder: qubit is not a live ancilla")
+	ErrAncillaLeak  = fmt.Errorf("builder: ancillas still allocated at build time")
+	ErrAncillaDirty = fmt.Errorf("builder: ancilla not returned to |0⟩")
+
+	ErrNestedCondition = fmt.Errorf("builder: conditional blocks cannot be nested")
+
+	ErrUnusedQubit     = fmt.Errorf("builder: declared qubits never used")
+	ErrUnusedClbit     = fmt.Errorf("builder: declared classical bits never used")
+	ErrCbitOverwritten = fmt.Errorf("builder: measurement overwrites an unread classical bit")
+)
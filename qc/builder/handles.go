@@ -0,0 +1,46 @@
+package builder
+
+import "fmt"
+
+// Qubit and Cbit are typed wire indices. Only MeasureTo takes them, as
+// distinct types, so swapping the qubit and the classical bit of that
+// measurement does not compile. The gate methods and Measure still take
+// plain ints; pass them a handle as int(q).
+type (
+	Qubit int
+	Cbit  int
+)
+
+func (b *b) Qubits() []Qubit {
+	qs := make([]Qubit, b.dagBuilder.Qubits())
+	for i := range qs {
+		qs[i] = Qubit(i)
+	}
+	return qs
+}
+
+func (b *b) Cbits() []Cbit {
+	return cbitRange(0, b.dagBuilder.Clbits())
+}
+
+func (b *b) RegBits(name string) []Cbit {
+	for _, r := range b.cfg.cregs {
+		if r.Name == name {
+			return cbitRange(r.Start, r.Size)
+		}
+	}
+	b.bail(fmt.Errorf("builder: no classical register named %q", name))
+	return nil
+}
+
+func (b *b) MeasureTo(q Qubit, c Cbit) Builder {
+	return b.Measure(int(q), int(c))
+}
+
+func cbitRange(from, n int) []Cbit {
+	cs := make([]Cbit, n)
+	for i := range cs {
+		cs[i] = Cbit(from + i)
+	}
+	return cs
+}
@@ -0,0 +1,114 @@
+package builder
+
+import "fmt"
+
+// Template is a reusable circuit fragment recorded against placeholder
+// wires. Unlike a composite gate it is spliced into the target builder
+// operation by operation, may contain measurements, and keeps no identity
+// of its own once instantiated.
+type Template struct {
+	qubits int
+	clbits int
+	ops    []entry
+}
+
+// NewTemplate records body against placeholder qubits q = 0..qubits-1 and
+// classical bits c = 0..clbits-1.
+func NewTemplate(qubits, clbits int, body func(b Builder, q, c []int)) (*Template, error) {
+	if qubits < 1 || clbits < 0 {
+		return nil, fmt.Errorf("builder: template needs at least one qubit and non-negative clbits, got %d/%d", qubits, clbits)
+	}
+	ops, err := record(qubits, clbits, func(b Builder) { body(b, span(qubits), span(clbits)) })
+	if err != nil {
+		return nil, fmt.Errorf("builder: recording template: %w", err)
+	}
+	return &Template{qubits: qubits, clbits: clbits, ops: ops}, nil
+}
+
+// Qubits returns the number of placeholder qubits.
+func (t *Template) Qubits() int { return t.qubits }
+
+// Clbits returns the number of placeholder classical bits.
+func (t *Template) Clbits() int { return t.clbits }
+
+// Instantiate binds the placeholder qubits, in order, to concrete indices.
+// Templates with classical bits also need Cbits.
+func (t *Template) Instantiate(qs ...int) Instance {
+	return Instance{t: t, qubits: append([]int(nil), qs...)}
+}
+
+// Instance is a template bound to concrete wires, ready for Builder.Append.
+type Instance struct {
+	t      *Template
+	qubits []int
+	cbits  []int
+}
+
+// Cbits binds the placeholder classical bits, in order.
+func (i Instance) Cbits(cs ...int) Instance {
+	i.cbits = append([]int(nil), cs...)
+	return i
+}
+
+// Append splices an instantiated template into the builder.
+func (b *b) Append(in Instance) Builder {
+	if b.checkState() {
+		return b
+	}
+	if in.t == nil {
+		return b.bail(fmt.Errorf("builder: Append called with an uninstantiated template"))
+	}
+	if len(in.qubits) != in.t.qubits || len(in.cbits) != in.t.clbits {
+		return b.bail(fmt.Errorf("builder: template takes %d qubit(s) and %d cbit(s), got %d and %d",
+			in.t.qubits, in.t.clbits, len(in.qubits), len(in.cbits)))
+	}
+	for _, e := range in.t.ops {
+		qs := make([]int, len(e.qubits))
+		for i, q := range e.qubits {
+			qs[i] = in.qubits[q]
+		}
+		if e.loop != nil {
+			return b.bail(fmt.Errorf("builder: loops inside templates are not supported"))
+		}
+		out := entry{g: e.g, qubits: qs, cbit: -1, meta: e.meta}
+		if e.cbit >= 0 {
+			out.cbit = in.cbits[e.cbit]
+		}
+		if e.cond != nil {
+			c := *e.cond
+			c.Cbits = make([]int, len(e.cond.Cbits))
+			for i, cb := range e.cond.Cbits {
+				c.Cbits[i] = in.cbits[cb]
+			}
+			out.cond = &c
+		}
+		if b.emit(out); b.err != nil {
+			break
+		}
+	}
+	return b
+}
+
+// record plays body on a scratch builder of the given width and returns
+// its journal. Ancilla allocation is rejected because the recorded ops
+// could not be mapped back onto the caller's wires.
+func record(qubits, clbits int, body func(b Builder)) ([]entry, error) {
+	sb := newBuilder(Q(qubits), C(clbits))
+	body(sb)
+	if sb.err != nil {
+		return nil, sb.err
+	}
+	if sb.dagBuilder.Qubits() != qubits || len(sb.ancillas.live) > 0 {
+		return nil, fmt.Errorf("ancillas are not allowed here")
+	}
+	return sb.log, nil
+}
+
+// span returns 0..n-1.
+func span(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
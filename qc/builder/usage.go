@@ -0,0 +1,107 @@
+package builder
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// UsedQubits returns, in ascending order, the qubits touched by at least
+// one operation so far.
+func (b *b) UsedQubits() []int {
+	used, _ := b.usage()
+	return used
+}
+
+// UnusedQubits returns the declared qubits no operation has touched yet.
+func (b *b) UnusedQubits() []int {
+	used, _ := b.usage()
+	var unused []int
+	for q := range b.dagBuilder.Qubits() {
+		if !slices.Contains(used, q) {
+			unused = append(unused, q)
+		}
+	}
+	return unused
+}
+
+// Warnings reports likely indexing mistakes: declared qubits or classical
+// bits that are never used, and measurements that overwrite a classical
+// bit nothing has read since its previous measurement. With the Strict
+// option BuildDAG fails with the first of them instead.
+func (b *b) Warnings() []error {
+	var ws []error
+	if qs := b.UnusedQubits(); len(qs) > 0 {
+		ws = append(ws, fmt.Errorf("%w: %v", ErrUnusedQubit, qs))
+	}
+	_, cbits := b.usage()
+	var unusedC []int
+	for c := range b.dagBuilder.Clbits() {
+		if !slices.Contains(cbits, c) {
+			unusedC = append(unusedC, c)
+		}
+	}
+	if len(unusedC) > 0 {
+		ws = append(ws, fmt.Errorf("%w: %v", ErrUnusedClbit, unusedC))
+	}
+	return append(ws, b.overwrites()...)
+}
+
+// usage collects the qubits and classical bits (written or read) of the
+// log, loop bodies included.
+func (b *b) usage() (qubits, cbits []int) {
+	for _, e := range b.log {
+		qubits = append(qubits, e.qubits...)
+		if e.cbit >= 0 {
+			cbits = append(cbits, e.cbit)
+		}
+		if e.cond != nil {
+			cbits = append(cbits, e.cond.Cbits...)
+		}
+		if e.loop != nil {
+			cbits = append(cbits, e.loop.Cbits()...)
+		}
+	}
+	slices.Sort(qubits)
+	slices.Sort(cbits)
+	return slices.Compact(qubits), slices.Compact(cbits)
+}
+
+// overwrites replays the classical data flow of the log and reports every
+// measurement into a cbit whose previous value was never read.
+func (b *b) overwrites() []error {
+	var ws []error
+	unread := map[int]bool{}
+	read := func(c *dag.Condition) {
+		if c != nil {
+			for _, cb := range c.Cbits {
+				delete(unread, cb)
+			}
+		}
+	}
+	write := func(g string, qs []int, cb int) {
+		if g != "MEASURE" {
+			return
+		}
+		if unread[cb] {
+			ws = append(ws, fmt.Errorf("%w: cbit %d (measuring qubit %d)", ErrCbitOverwritten, cb, qs[0]))
+		}
+		unread[cb] = true
+	}
+	for _, e := range b.log {
+		read(e.cond)
+		if e.loop == nil {
+			write(e.g.Name(), e.qubits, e.cbit)
+			continue
+		}
+		// A loop body runs before its exit condition reads the bits.
+		for _, n := range e.loop.Body {
+			read(n.Cond)
+			write(n.G.Name(), n.Qubits, n.Cbit)
+		}
+		until := e.loop.Until
+		read(&until)
+	}
+	return ws
+}
@@ -1,6 +1,8 @@
 package circuit
 
 import (
+	"iter"
+	"slices"
 	"sort"
 
 	"github.com/kegliz/qcm/qc/dag"
@@ -13,27 +15,84 @@ type Operation struct {
 	Cbit     int   // Absolute classical bit index (-1 if none)
 	TimeStep int   // Calculated layout column (starting at 0)
 	Line     int   // Calculated layout primary line (usually min qubit index)
+
+	Cond *Condition // run-time classical condition; nil if unconditional
+	Loop *Loop      // repeat-until-success block; set only on LOOP operations
+	Meta Meta       // opaque backend data (see dag.Meta); nil if none
+}
+
+// Register names a contiguous range of classical bits.
+type Register = dag.Register
+
+// Condition gates an operation on measured classical bits.
+type Condition = dag.Condition
+
+// Meta is opaque backend data attached to an operation.
+type Meta = dag.Meta
+
+// Loop is a bounded repeat-until-success block. Body operations are in
+// program order; their TimeStep is their index within the body.
+type Loop struct {
+	Body  []Operation
+	Until Condition
+	Max   int
+}
+
+// HasControlFlow reports whether any operation of c is conditional or a loop,
+// i.e. whether running it needs a runner with the "control_flow" capability.
+func HasControlFlow(c Circuit) bool {
+	for _, op := range c.OpsIter() {
+		if op.Cond != nil || op.Loop != nil {
+			return true
+		}
+	}
+	return false
 }
 
 type Circuit interface {
 	Qubits() int
 	Clbits() int
+	CRegs() []Register       // named classical registers; may be empty
 	Operations() []Operation // topological order with layout info
-	Depth() int              // Max TimeStep + 1
-	MaxStep() int            // Max TimeStep
+	// OpsIter and OpAt read the same operations without copying the slice.
+	OpsIter() iter.Seq2[int, Operation]
+	OpAt(i int) Operation // panics if i is out of range, like indexing
+	NumOps() int
+	Depth() int   // Max TimeStep + 1
+	MaxStep() int // Max TimeStep
 }
 
 type circuit struct {
 	qubits  int
 	clbits  int
+	cregs   []Register
 	ops     []Operation // Cached operations with layout info
 	depth   int         // Number of layers (MaxStep + 1)
 	maxStep int         // Max timestep index
 }
 
+// LayoutOptions tunes how FromDAGWithLayout assigns TimeSteps. The zero
+// value is the as-soon-as-possible layout of FromDAG.
+type LayoutOptions struct {
+	// AlignMeasurements moves every terminal measurement (one nothing
+	// depends on) into a shared final column after all other operations.
+	AlignMeasurements bool
+	// RightAlign schedules single-qubit gates as late as their successors
+	// allow, so they sit next to the gates they feed; gates with no
+	// successor keep their step.
+	RightAlign bool
+}
+
 // FromDAG creates an immutable Circuit from a validated DAGReader.
 // It calculates the layout (TimeStep, Line) for each operation.
 func FromDAG(dr dag.DAGReader) Circuit {
+	return FromDAGWithLayout(dr, LayoutOptions{})
+}
+
+// FromDAGWithLayout is FromDAG with a layout chosen by opts. Only TimeSteps
+// differ, so every layout runs the same: operations stay in a topological
+// order.
+func FromDAGWithLayout(dr dag.DAGReader, opts LayoutOptions) Circuit {
 	// Get topologically sorted nodes
 	nodes := dr.Operations()
 	if len(nodes) == 0 {
@@ -41,18 +100,16 @@ func FromDAG(dr dag.DAGReader) Circuit {
 		return &circuit{
 			qubits:  dr.Qubits(),
 			clbits:  dr.Clbits(),
+			cregs:   dr.CRegs(),
 			ops:     []Operation{},
 			depth:   0,
 			maxStep: -1,
 		}
 	}
 
-	ops := make([]Operation, len(nodes))
 	// Store calculated timestep for each node ID
 	nodeTimeStep := make(map[dag.NodeID]int)
-
-	maxStep := -1
-	for i, n := range nodes {
+	for _, n := range nodes {
 		// Calculate TimeStep based on parents' timesteps
 		currentMaxParentStep := -1
 		for _, pID := range n.Parents() {
@@ -62,31 +119,21 @@ func FromDAG(dr dag.DAGReader) Circuit {
 		}
 
 		// Node's timestep is 1 greater than its latest-finishing parent
-		step := currentMaxParentStep + 1
-		nodeTimeStep[n.ID] = step
-
-		if step > maxStep {
-			maxStep = step
-		}
-
-		// Calculate Line (minimum qubit index)
-		minQubit := -1
-		if len(n.Qubits) > 0 {
-			minQubit = n.Qubits[0]
-			for _, q := range n.Qubits[1:] {
-				if q < minQubit {
-					minQubit = q
-				}
-			}
-		}
+		nodeTimeStep[n.ID] = currentMaxParentStep + 1
+	}
+	if opts.AlignMeasurements {
+		alignMeasurements(nodes, nodeTimeStep)
+	}
+	if opts.RightAlign {
+		rightAlign(nodes, nodeTimeStep)
+	}
 
-		ops[i] = Operation{
-			G:        n.G,
-			Qubits:   append([]int(nil), n.Qubits...), // Copy slice
-			Cbit:     n.Cbit,
-			TimeStep: step,
-			Line:     minQubit,
-		}
+	ops := make([]Operation, len(nodes))
+	maxStep := -1
+	for i, n := range nodes {
+		step := nodeTimeStep[n.ID]
+		maxStep = max(maxStep, step)
+		ops[i] = operation(n, step)
 	}
 
 	// Sort operations by TimeStep, then by Line for consistent rendering
@@ -100,12 +147,92 @@ func FromDAG(dr dag.DAGReader) Circuit {
 	return &circuit{
 		qubits:  dr.Qubits(),
 		clbits:  dr.Clbits(),
+		cregs:   dr.CRegs(),
 		ops:     ops,
 		depth:   maxStep + 1,
 		maxStep: maxStep,
 	}
 }
 
+func terminalMeasurement(n *dag.Node) bool {
+	return n.G.Name() == "MEASURE" && len(n.Children()) == 0
+}
+
+// alignMeasurements moves the terminal measurements one step past every
+// other node. Nothing depends on them, so no other step changes.
+func alignMeasurements(nodes []*dag.Node, steps map[dag.NodeID]int) {
+	last := -1
+	for _, n := range nodes {
+		if !terminalMeasurement(n) {
+			last = max(last, steps[n.ID])
+		}
+	}
+	for _, n := range nodes {
+		if terminalMeasurement(n) {
+			steps[n.ID] = last + 1
+		}
+	}
+}
+
+// rightAlign delays single-qubit gates to one step before their earliest
+// child, visiting nodes in reverse topological order so that children
+// have already moved.
+func rightAlign(nodes []*dag.Node, steps map[dag.NodeID]int) {
+	for _, n := range slices.Backward(nodes) {
+		if len(n.Qubits) != 1 || n.Loop != nil || n.G.Name() == "MEASURE" {
+			continue
+		}
+		children := n.Children()
+		if len(children) == 0 {
+			continue
+		}
+		earliest := steps[children[0]]
+		for _, c := range children[1:] {
+			earliest = min(earliest, steps[c])
+		}
+		steps[n.ID] = earliest - 1
+	}
+}
+
+// operation converts one node, including any loop body, to an Operation.
+func operation(n *dag.Node, step int) Operation {
+	// Calculate Line (minimum qubit index)
+	minQubit := -1
+	if len(n.Qubits) > 0 {
+		minQubit = n.Qubits[0]
+		for _, q := range n.Qubits[1:] {
+			if q < minQubit {
+				minQubit = q
+			}
+		}
+	}
+	op := Operation{
+		G:        n.G,
+		Qubits:   append([]int(nil), n.Qubits...), // Copy slice
+		Cbit:     n.Cbit,
+		TimeStep: step,
+		Line:     minQubit,
+		Meta:     n.Meta, // never modified once attached, so it can be shared
+	}
+	if n.Cond != nil {
+		c := copyCond(*n.Cond)
+		op.Cond = &c
+	}
+	if n.Loop != nil {
+		l := &Loop{Until: copyCond(n.Loop.Until), Max: n.Loop.Max}
+		for i, b := range n.Loop.Body {
+			l.Body = append(l.Body, operation(b, i))
+		}
+		op.Loop = l
+	}
+	return op
+}
+
+func copyCond(c Condition) Condition {
+	c.Cbits = append([]int(nil), c.Cbits...)
+	return c
+}
+
 // ---------------- interface methods --------------------
 // Qubits returns the number of qubits in the circuit.
 func (c *circuit) Qubits() int { return c.qubits }
@@ -113,6 +240,9 @@ func (c *circuit) Qubits() int { return c.qubits }
 // Clbits returns the number of classical bits in the circuit.
 func (c *circuit) Clbits() int { return c.clbits }
 
+// CRegs returns the named classical registers.
+func (c *circuit) CRegs() []Register { return append([]Register(nil), c.cregs...) }
+
 // Depth returns the number of layers in the circuit (MaxStep + 1).
 // This is the maximum number of time steps plus one.
 func (c *circuit) Depth() int {
@@ -135,3 +265,13 @@ func (c *circuit) Operations() []Operation {
 	copy(result, c.ops)
 	return result
 }
+
+// OpsIter ranges over the operations in the order of Operations, with
+// their index, without copying them first.
+func (c *circuit) OpsIter() iter.Seq2[int, Operation] { return slices.All(c.ops) }
+
+// OpAt returns operation i in the order of Operations.
+func (c *circuit) OpAt(i int) Operation { return c.ops[i] }
+
+// NumOps returns the number of operations.
+func (c *circuit) NumOps() int { return len(c.ops) }
@@ -1,12 +1,15 @@
 package circuit_test
 
 import (
+	"fmt"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"testing"
 
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
 	"github.com/kegliz/qcm/qc/gate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -166,6 +169,71 @@ func TestCircuit_Layout(t *testing.T) {
 	assert.Equal(0, cz01.Line, "CZ(0, 1) line")
 }
 
+func TestCircuit_LayoutOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3), builder.C(3))
+	b.H(0) // ASAP 0
+	b.X(2) // ASAP 0, feeds CNOT(1,2) only
+	b.Measure(0, 0)
+	b.H(1).H(1)  // ASAP 0, 1
+	b.CNOT(1, 2) // ASAP 2
+	b.Measure(1, 1).Measure(2, 2)
+	dr, err := b.BuildDAG()
+	require.NoError(err)
+
+	steps := func(c circuit.Circuit) []string {
+		var out []string
+		for _, op := range c.OpsIter() {
+			out = append(out, fmt.Sprintf("%s%v@%d", op.G.Name(), op.Qubits, op.TimeStep))
+		}
+		return out
+	}
+
+	asap := circuit.FromDAG(dr)
+	assert.Equal(asap.Operations(), circuit.FromDAGWithLayout(dr, circuit.LayoutOptions{}).Operations())
+	assert.Contains(steps(asap), "MEASURE[0]@1")
+
+	aligned := circuit.FromDAGWithLayout(dr, circuit.LayoutOptions{AlignMeasurements: true})
+	assert.Equal(asap.Depth(), aligned.Depth())
+	got := steps(aligned)
+	for _, m := range []string{"MEASURE[0]@3", "MEASURE[1]@3", "MEASURE[2]@3"} {
+		assert.Contains(got, m)
+	}
+	assert.Contains(got, "X[2]@0", "single-qubit gates stay left without RightAlign")
+
+	both := circuit.FromDAGWithLayout(dr, circuit.LayoutOptions{AlignMeasurements: true, RightAlign: true})
+	got = steps(both)
+	assert.Contains(got, "X[2]@1")
+	assert.Contains(got, "H[0]@2", "H(0) moves up to the measurement column")
+	assert.Contains(got, "H[1]@0")
+	assert.Contains(got, "H[1]@1")
+	assert.Equal(4, both.Depth())
+
+	// The layouts only move operations, never reorder dependent ones.
+	for _, c := range []circuit.Circuit{aligned, both} {
+		last := map[int]int{}
+		for i, op := range c.OpsIter() {
+			for _, q := range op.Qubits {
+				if j, ok := last[q]; ok {
+					assert.Less(c.OpAt(j).TimeStep, op.TimeStep)
+				}
+				last[q] = i
+			}
+		}
+	}
+
+	// A measurement feeding a condition is not terminal.
+	b = builder.New(builder.Q(2), builder.C(1))
+	b.H(0).Measure(0, 0).H(1).H(1).H(1)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(1) })
+	dr, err = b.BuildDAG()
+	require.NoError(err)
+	got = steps(circuit.FromDAGWithLayout(dr, circuit.LayoutOptions{AlignMeasurements: true}))
+	assert.Contains(got, "MEASURE[0]@1")
+}
+
 func TestCircuit_Empty(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -270,3 +338,184 @@ func TestYGateIntegration(t *testing.T) {
 	assert.Equal(3, directCircuit.Qubits(), "Direct circuit qubit count mismatch")
 	assert.Equal(0, directCircuit.Clbits(), "Direct circuit classical bit count mismatch")
 }
+
+func TestIncremental_MatchesFromDAG(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3), builder.C(2))
+	b.H(0).X(2).CNOT(0, 1).H(2).CNOT(1, 2).Measure(1, 0).Measure(2, 1)
+	want, err := b.BuildCircuit()
+	require.NoError(err)
+
+	inc := circuit.NewIncremental(3, 2)
+	assert.Equal(0, inc.Depth())
+	assert.Empty(inc.Operations())
+
+	ops := []dag.Op{
+		{G: gate.H(), Qubits: []int{0}},
+		{G: gate.X(), Qubits: []int{2}},
+		{G: gate.CNOT(), Qubits: []int{0, 1}},
+		{G: gate.H(), Qubits: []int{2}},
+		{G: gate.CNOT(), Qubits: []int{1, 2}},
+		{G: gate.Measure(), Qubits: []int{1}, Cbit: 0},
+		{G: gate.Measure(), Qubits: []int{2}, Cbit: 1},
+	}
+	for i, op := range ops {
+		got, err := inc.Append(op)
+		require.NoError(err, "op %d", i)
+		assert.Equal(op.G.Name(), got.G.Name())
+	}
+	_, err = inc.Append(dag.Op{G: gate.X(), Qubits: []int{7}})
+	assert.Error(err)
+
+	assert.Equal(want.Depth(), inc.Depth())
+	assert.Equal(want.MaxStep(), inc.MaxStep())
+	layout := func(c circuit.Circuit) []string {
+		var out []string
+		for _, op := range c.Operations() {
+			out = append(out, fmt.Sprintf("%d/%d/%s/%d", op.TimeStep, op.Line, op.G.Name(), op.Cbit))
+		}
+		return out
+	}
+	assert.Equal(layout(want), layout(inc))
+	assert.Equal(want.Depth(), inc.DAG().Depth())
+}
+
+func TestStream_FileStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3), builder.C(2))
+	b.H(0).RY(0.3, 2).CNOT(0, 1).CP(1.5, 2, 0).CNOT(1, 2).Measure(1, 0).Measure(2, 1)
+	want, err := b.BuildCircuit()
+	require.NoError(err)
+
+	store, err := circuit.NewFileStore(filepath.Join(t.TempDir(), "ops"))
+	require.NoError(err)
+	defer store.Close()
+	s := circuit.NewStream(3, 2, store)
+	ops := []dag.Op{
+		{G: gate.H(), Qubits: []int{0}},
+		{G: gate.RY(0.3), Qubits: []int{2}},
+		{G: gate.CNOT(), Qubits: []int{0, 1}, Meta: dag.Meta{"cal": "cx01"}},
+		{G: gate.CP(1.5), Qubits: []int{2, 0}},
+		{G: gate.CNOT(), Qubits: []int{1, 2}},
+		{G: gate.Measure(), Qubits: []int{1}, Cbit: 0},
+		{G: gate.Measure(), Qubits: []int{2}, Cbit: 1},
+	}
+	for i, op := range ops {
+		_, err := s.Append(op)
+		require.NoError(err, "op %d", i)
+	}
+	_, err = s.Append(dag.Op{G: gate.X(), Qubits: []int{7}})
+	assert.ErrorIs(err, dag.ErrBadQubit)
+	_, err = s.Append(dag.Op{G: gate.Measure(), Qubits: []int{0}, Cbit: 5})
+	assert.ErrorIs(err, dag.ErrBadClbit)
+	unknown, err := gate.NewComposite("UNREGISTERED", 1, []gate.Step{{G: gate.H(), Qubits: []int{0}}})
+	require.NoError(err)
+	_, err = s.Append(dag.Op{G: unknown, Qubits: []int{0}})
+	assert.ErrorContains(err, "cannot store gate UNREGISTERED")
+
+	// Native gates keep their exact angles.
+	native, err := circuit.NewFileStore(filepath.Join(t.TempDir(), "native"))
+	require.NoError(err)
+	defer native.Close()
+	ns := circuit.NewStream(2, 0, native)
+	for _, g := range []gate.Gate{gate.GPI(0.12345678), gate.GPI2(-1), gate.MS(0.5, 0.25)} {
+		qs := []int{0, 1}[:g.QubitSpan()]
+		_, err := ns.Append(dag.Op{G: g, Qubits: qs})
+		require.NoError(err, g.Name())
+	}
+	var params [][]float64
+	for op, err := range ns.Ops() {
+		require.NoError(err)
+		params = append(params, op.G.(gate.Parametric).Params())
+	}
+	assert.Equal([][]float64{{0.12345678}, {-1}, {0.5, 0.25}}, params)
+
+	assert.Equal(len(ops), s.NumOps())
+	assert.Equal(want.Depth(), s.Depth())
+	assert.True(s.TerminalMeasurements())
+	assert.False(s.HasControlFlow())
+	assert.Equal(map[int][]int{1: {0}, 2: {1}}, s.Measurements())
+	assert.Equal([]int{1, 2}, s.CbitSources())
+
+	// Twice, to check the store replays from the start.
+	for range 2 {
+		var got []string
+		for op, err := range s.Ops() {
+			require.NoError(err)
+			p := ""
+			if pg, ok := op.G.(gate.Parametric); ok {
+				p = fmt.Sprint(pg.Params())
+			}
+			if op.Meta != nil {
+				p += fmt.Sprint(op.Meta)
+			}
+			got = append(got, fmt.Sprintf("%d/%d/%s%s/%d", op.TimeStep, op.Line, op.G.Name(), p, op.Cbit))
+		}
+		assert.Equal([]string{
+			"0/0/H/-1", "0/2/RY[0.3]/-1", "1/0/CNOTmap[cal:cx01]/-1", "2/0/CP[1.5]/-1",
+			"3/1/CNOT/-1", "4/1/MEASURE/0", "4/2/MEASURE/1",
+		}, got)
+	}
+
+	_, err = s.Append(dag.Op{G: gate.X(), Qubits: []int{2}})
+	require.NoError(err)
+	assert.False(s.TerminalMeasurements())
+	_, err = s.Append(dag.Op{G: gate.X(), Qubits: []int{0}, Cond: &dag.Condition{Cbits: []int{0}, Value: 1}})
+	require.NoError(err)
+	assert.True(s.HasControlFlow())
+}
+
+func TestOpsIter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := builder.New(builder.Q(3), builder.C(1)).H(0).CNOT(0, 1).X(2).Measure(1, 0).BuildCircuit()
+	require.NoError(err)
+	inc := circuit.NewIncremental(2, 0)
+	_, err = inc.Append(dag.Op{G: gate.H(), Qubits: []int{1}})
+	require.NoError(err)
+
+	for _, c := range []circuit.Circuit{c, inc} {
+		want := c.Operations()
+		assert.Equal(len(want), c.NumOps())
+		var got []circuit.Operation
+		for i, op := range c.OpsIter() {
+			assert.Equal(op, c.OpAt(i))
+			got = append(got, op)
+		}
+		assert.Equal(want, got)
+	}
+}
+
+func TestLint(t *testing.T) {
+	b := builder.New(builder.Q(4), builder.C(4))
+	b.CNOT(1, 2)
+	b.If(builder.Bit(3), func(b builder.Builder) { b.Z(2) })
+	b.H(0).Measure(0, 0).X(0).Measure(0, 1).H(0)
+	// A reset: feedback on the measurement clears the qubit for reuse.
+	b.Measure(2, 2).If(builder.Bit(2), func(b builder.Builder) { b.X(2) }).H(2).Measure(2, 3)
+	b.Measure(1, 3)
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+
+	var got []string
+	for _, w := range circuit.Lint(c) {
+		got = append(got, w.Kind.String()+": "+w.Msg)
+	}
+	assert.ElementsMatch(t, []string{
+		"suspicious-control: CNOT is controlled by qubit 1, which is still |0>",
+		"suspicious-control: Z is conditioned on cbit 3 before any measurement writes it",
+		"reused-after-measure: X acts on qubit 0 after its measurement into cbit 0 without a reset",
+		"dead-gate: H acts after the final measurement of qubit(s) [0]",
+		"remeasured: cbit 3 is measured again, overwriting its earlier outcome",
+		"unmeasured: qubit 3 is never measured",
+	}, got)
+
+	clean, err := builder.New(builder.Q(2), builder.C(2)).H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(t, err)
+	assert.Empty(t, circuit.Lint(clean))
+}
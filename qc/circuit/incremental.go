@@ -0,0 +1,67 @@
+package circuit
+
+import (
+	"iter"
+	"slices"
+	"sort"
+
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// Incremental is a Circuit that grows one operation at a time. Each Append
+// lays out only the new operation (its TimeStep follows from its parents),
+// so REPLs and editors can show the circuit after every gate without
+// rebuilding it. It satisfies Circuit at every point and is not safe for
+// concurrent use.
+type Incremental struct {
+	d       *dag.DAG
+	ops     []Operation // sorted by TimeStep, then Line
+	maxStep int
+}
+
+// NewIncremental starts an empty circuit of the given width.
+func NewIncremental(qubits, clbits int) *Incremental {
+	d := dag.New(qubits, clbits)
+	d.Validate() // an empty DAG is always valid; from here on Append keeps it so
+	return &Incremental{d: d, maxStep: -1}
+}
+
+// Append adds op after everything already on its wires and returns it with
+// its layout filled in.
+func (c *Incremental) Append(op dag.Op) (Operation, error) {
+	id, err := c.d.Append(op)
+	if err != nil {
+		return Operation{}, err
+	}
+	n, _ := c.d.Node(id)
+	step, _ := c.d.Level(id)
+	out := operation(n, step)
+
+	// Insert after every op that sorts before or equal to it.
+	i := sort.Search(len(c.ops), func(i int) bool {
+		o := c.ops[i]
+		return o.TimeStep > out.TimeStep || (o.TimeStep == out.TimeStep && o.Line > out.Line)
+	})
+	c.ops = append(c.ops, Operation{})
+	copy(c.ops[i+1:], c.ops[i:])
+	c.ops[i] = out
+	c.maxStep = max(c.maxStep, step)
+	return out, nil
+}
+
+// DAG exposes the underlying validated DAG, e.g. for analysis.
+func (c *Incremental) DAG() dag.DAGReader { return c.d }
+
+func (c *Incremental) Qubits() int       { return c.d.Qubits() }
+func (c *Incremental) Clbits() int       { return c.d.Clbits() }
+func (c *Incremental) CRegs() []Register { return c.d.CRegs() }
+func (c *Incremental) Depth() int        { return c.maxStep + 1 }
+func (c *Incremental) MaxStep() int      { return c.maxStep }
+func (c *Incremental) Operations() []Operation {
+	return append([]Operation(nil), c.ops...)
+}
+func (c *Incremental) OpsIter() iter.Seq2[int, Operation] { return slices.All(c.ops) }
+func (c *Incremental) OpAt(i int) Operation               { return c.ops[i] }
+func (c *Incremental) NumOps() int                        { return len(c.ops) }
+
+var _ Circuit = (*Incremental)(nil)
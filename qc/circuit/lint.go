@@ -0,0 +1,181 @@
+package circuit
+
+import (
+	"fmt"
+	"slices"
+)
+
+// LintKind classifies a Lint warning.
+type LintKind int
+
+const (
+	// ReusedAfterMeasure: a gate acts on a measured qubit that was not
+	// reset (by a gate conditioned on its measurement) and is measured
+	// again later, so the later measurement sees the collapsed state.
+	ReusedAfterMeasure LintKind = iota
+	// Remeasured: a classical bit is written by a second measurement,
+	// overwriting the first outcome.
+	Remeasured
+	// DeadGate: a gate acts only on qubits that have been measured for the
+	// last time, so it cannot change any outcome.
+	DeadGate
+	// Unmeasured: a qubit is never measured.
+	Unmeasured
+	// SuspiciousControl: a gate is controlled by a qubit no operation has
+	// touched yet, so it never fires, or conditioned on a classical bit no
+	// measurement has written yet, so it reads a constant 0.
+	SuspiciousControl
+)
+
+func (k LintKind) String() string {
+	switch k {
+	case ReusedAfterMeasure:
+		return "reused-after-measure"
+	case Remeasured:
+		return "remeasured"
+	case DeadGate:
+		return "dead-gate"
+	case Unmeasured:
+		return "unmeasured"
+	case SuspiciousControl:
+		return "suspicious-control"
+	}
+	return fmt.Sprintf("LintKind(%d)", int(k))
+}
+
+// Warning is one finding of Lint. Op is the index of the operation in
+// c.Operations(), or -1 for findings about a qubit as a whole; for
+// operations inside a loop body it is the index of the loop.
+type Warning struct {
+	Kind  LintKind
+	Op    int
+	Qubit int // -1 if the warning is about a classical bit
+	Cbit  int // -1 if the warning is about a qubit
+	Msg   string
+}
+
+func (w Warning) String() string {
+	if w.Op < 0 {
+		return fmt.Sprintf("%s: %s", w.Kind, w.Msg)
+	}
+	return fmt.Sprintf("op %d: %s: %s", w.Op, w.Kind, w.Msg)
+}
+
+// Lint checks c for patterns that are legal but usually mistakes, as
+// often made by circuit generators. Warnings are ordered by operation,
+// with qubit-wide findings last. Loop bodies are checked as if they ran
+// once.
+func Lint(c Circuit) []Warning {
+	l := &linter{
+		touched:  make([]bool, c.Qubits()),
+		measured: make([]bool, c.Qubits()),
+		pending:  make([]int, c.Qubits()),
+		lastMeas: make([]int, c.Qubits()),
+		written:  make([]bool, c.Clbits()),
+	}
+	for q := range l.pending {
+		l.pending[q], l.lastMeas[q] = -1, -1
+	}
+	// The final measurement of each qubit, in the flattened order visit
+	// walks, tells dead gates from ones a later measurement still sees.
+	pos := 0
+	for _, op := range c.OpsIter() {
+		forEach(op, func(o Operation) {
+			if o.G.Name() == "MEASURE" {
+				l.lastMeas[o.Qubits[0]] = pos
+			}
+			pos++
+		})
+	}
+	for i, op := range c.OpsIter() {
+		forEach(op, func(o Operation) { l.visit(i, o) })
+	}
+	for q, m := range l.measured {
+		if !m {
+			l.warn(Unmeasured, -1, q, -1, "qubit %d is never measured", q)
+		}
+	}
+	return l.warnings
+}
+
+// forEach calls f with op, or with the body of a loop in program order.
+func forEach(op Operation, f func(Operation)) {
+	if op.Loop == nil {
+		f(op)
+		return
+	}
+	for _, b := range op.Loop.Body {
+		forEach(b, f)
+	}
+}
+
+type linter struct {
+	pos      int    // flattened index of the operation being visited
+	touched  []bool // qubit acted on by an earlier operation
+	measured []bool // qubit measured by an earlier operation
+	pending  []int  // cbit of the qubit's latest measurement, -1 once reset
+	lastMeas []int  // flattened index of the qubit's final measurement
+	written  []bool // cbit written by an earlier measurement
+	warnings []Warning
+}
+
+func (l *linter) warn(k LintKind, op, q, cb int, format string, args ...any) {
+	l.warnings = append(l.warnings, Warning{Kind: k, Op: op, Qubit: q, Cbit: cb, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) visit(i int, op Operation) {
+	defer func() { l.pos++ }()
+	name := op.G.Name()
+	if op.Cond != nil {
+		for _, cb := range op.Cond.Cbits {
+			if !l.written[cb] {
+				l.warn(SuspiciousControl, i, -1, cb, "%s is conditioned on cbit %d before any measurement writes it", name, cb)
+			}
+		}
+	}
+	if name == "MEASURE" {
+		q, cb := op.Qubits[0], op.Cbit
+		if l.written[cb] {
+			l.warn(Remeasured, i, -1, cb, "cbit %d is measured again, overwriting its earlier outcome", cb)
+		}
+		l.written[cb] = true
+		l.measured[q], l.pending[q] = true, cb
+		l.touched[q] = true
+		return
+	}
+
+	for _, c := range op.G.Controls() {
+		if q := op.Qubits[c]; !l.touched[q] {
+			l.warn(SuspiciousControl, i, q, -1, "%s is controlled by qubit %d, which is still |0>", name, q)
+		}
+	}
+	dead := true
+	for _, q := range op.Qubits {
+		if !l.measured[q] || l.lastMeas[q] > l.pos {
+			dead = false
+		}
+	}
+	if dead {
+		l.warn(DeadGate, i, op.Qubits[0], -1, "%s acts after the final measurement of qubit(s) %v", name, op.Qubits)
+	} else {
+		for _, q := range op.Qubits {
+			cb := l.pending[q]
+			switch {
+			case cb < 0:
+			case feedback(op, cb):
+				l.pending[q] = -1
+			case l.lastMeas[q] > l.pos:
+				l.warn(ReusedAfterMeasure, i, q, -1, "%s acts on qubit %d after its measurement into cbit %d without a reset", name, q, cb)
+			}
+		}
+	}
+	for _, q := range op.Qubits {
+		l.touched[q] = true
+	}
+}
+
+// feedback reports whether op is conditioned on the measurement into cb,
+// as the conditional X of a reset is.
+func feedback(op Operation, cb int) bool {
+	return op.Cond != nil && slices.Contains(op.Cond.Cbits, cb)
+}
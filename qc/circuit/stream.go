@@ -0,0 +1,275 @@
+package circuit
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// OpStore holds the operations of a Stream in program order. Ops must be
+// replayable: every call starts again at the first operation, and several
+// iterations may run at once.
+type OpStore interface {
+	Append(op Operation) error
+	Ops() iter.Seq2[Operation, error]
+}
+
+// Stream builds a circuit too large to hold in memory. Operations go
+// straight to an OpStore, such as a FileStore on disk, and are read back
+// lazily; the Stream itself only keeps a few counters per wire. Layout is
+// computed as for FromDAG, but operations stay in program order. Streams
+// hold gates, measurements and conditionals, but no loops.
+//
+// A Stream is not a Circuit, since Operations would load the whole store;
+// Simulator.RunStream and runners implementing simulator.StreamRunner
+// consume it instead.
+type Stream struct {
+	qubits, clbits int
+	store          OpStore
+	last           []int // latest TimeStep on each qubit, then on each cbit
+	maxStep        int
+	n              int
+
+	measured    map[int][]int // qubit -> cbits it is measured into
+	sources     []int         // cbit -> qubit last measured into it, or -1
+	terminal    bool
+	controlFlow bool
+}
+
+// NewStream starts an empty circuit of the given width writing to store.
+func NewStream(qubits, clbits int, store OpStore) *Stream {
+	last := make([]int, qubits+clbits)
+	for i := range last {
+		last[i] = -1
+	}
+	sources := make([]int, clbits)
+	for i := range sources {
+		sources[i] = -1
+	}
+	return &Stream{qubits: qubits, clbits: clbits, store: store, last: last,
+		maxStep: -1, measured: map[int][]int{}, sources: sources, terminal: true}
+}
+
+// Append checks op as dag.DAG.Append would, lays it out after everything
+// already on its wires and writes it to the store.
+func (s *Stream) Append(op dag.Op) (Operation, error) {
+	if err := dag.CheckOp(op, s.qubits, s.clbits); err != nil {
+		return Operation{}, err
+	}
+	if op.G.Name() == "LOOP" {
+		return Operation{}, fmt.Errorf("circuit: streams cannot hold loops")
+	}
+	out := Operation{G: op.G, Qubits: slices.Clone(op.Qubits), Cbit: -1, Line: slices.Min(op.Qubits),
+		Meta: maps.Clone(op.Meta)}
+	wires := slices.Clone(op.Qubits)
+	if op.G.Name() == "MEASURE" {
+		out.Cbit = op.Cbit
+		wires = append(wires, s.qubits+op.Cbit)
+	}
+	if op.Cond != nil {
+		c := copyCond(*op.Cond)
+		out.Cond = &c
+		for _, cb := range c.Cbits {
+			wires = append(wires, s.qubits+cb)
+		}
+	}
+	for _, w := range wires {
+		out.TimeStep = max(out.TimeStep, s.last[w]+1)
+	}
+	if err := s.store.Append(out); err != nil {
+		return Operation{}, err
+	}
+	for _, w := range wires {
+		s.last[w] = out.TimeStep
+	}
+	s.maxStep = max(s.maxStep, out.TimeStep)
+	s.n++
+
+	switch {
+	case out.Cond != nil:
+		s.controlFlow, s.terminal = true, false
+	case out.Cbit >= 0:
+		s.measured[out.Qubits[0]] = append(s.measured[out.Qubits[0]], out.Cbit)
+		s.sources[out.Cbit] = out.Qubits[0]
+	case slices.ContainsFunc(out.Qubits, func(q int) bool { return len(s.measured[q]) > 0 }):
+		s.terminal = false
+	}
+	return out, nil
+}
+
+// Ops iterates over the operations in program order, reading the store.
+func (s *Stream) Ops() iter.Seq2[Operation, error] { return s.store.Ops() }
+
+func (s *Stream) Qubits() int  { return s.qubits }
+func (s *Stream) Clbits() int  { return s.clbits }
+func (s *Stream) NumOps() int  { return s.n }
+func (s *Stream) Depth() int   { return s.maxStep + 1 }
+func (s *Stream) MaxStep() int { return s.maxStep }
+
+// HasControlFlow reports whether any operation is conditional.
+func (s *Stream) HasControlFlow() bool { return s.controlFlow }
+
+// TerminalMeasurements reports whether every measurement comes after the
+// last gate on its qubit and there is no control flow, so that all shots
+// can be drawn from one final state.
+func (s *Stream) TerminalMeasurements() bool { return s.terminal }
+
+// Measurements maps each measured qubit to the cbits it is measured into.
+func (s *Stream) Measurements() map[int][]int {
+	out := make(map[int][]int, len(s.measured))
+	for q, cbs := range s.measured {
+		out[q] = slices.Clone(cbs)
+	}
+	return out
+}
+
+// CbitSources maps each cbit to the qubit whose measurement writes it
+// last, or -1, as simulator.CbitSources does for circuits.
+func (s *Stream) CbitSources() []int { return slices.Clone(s.sources) }
+
+// FileStore is an OpStore backed by a file, written through a buffer and
+// read back from the start on every Ops call. Gates are stored by name
+// and angle, so custom gates must be known to gate.Factory (see
+// gate.Register).
+type FileStore struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *gob.Encoder
+	n   int
+}
+
+// record is the on-disk form of an Operation.
+type record struct {
+	Name           string
+	Params         []float64
+	Qubits         []int
+	Cbit           int
+	TimeStep, Line int
+	Cond           *Condition
+	Meta           Meta
+}
+
+// NewFileStore creates (or truncates) the file at path.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &FileStore{f: f, w: w, enc: gob.NewEncoder(w)}, nil
+}
+
+func (fs *FileStore) Append(op Operation) error {
+	if op.Loop != nil {
+		return fmt.Errorf("circuit: file store cannot hold loops")
+	}
+	r := record{Name: op.G.Name(), Qubits: op.Qubits, Cbit: op.Cbit,
+		TimeStep: op.TimeStep, Line: op.Line, Cond: op.Cond, Meta: op.Meta}
+	if p, ok := op.G.(gate.Parametric); ok {
+		r.Params = p.Params()
+	}
+	if _, err := storedGate(r.Name, r.Params); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.enc.Encode(&r); err != nil {
+		return err
+	}
+	fs.n++
+	return nil
+}
+
+func (fs *FileStore) Ops() iter.Seq2[Operation, error] {
+	return func(yield func(Operation, error) bool) {
+		size, n, err := fs.flush()
+		if err != nil {
+			yield(Operation{}, err)
+			return
+		}
+		dec := gob.NewDecoder(bufio.NewReader(io.NewSectionReader(fs.f, 0, size)))
+		for range n {
+			var r record
+			if err := dec.Decode(&r); err != nil {
+				yield(Operation{}, err)
+				return
+			}
+			g, err := storedGate(r.Name, r.Params)
+			if err != nil {
+				yield(Operation{}, err)
+				return
+			}
+			op := Operation{G: g, Qubits: r.Qubits, Cbit: r.Cbit, TimeStep: r.TimeStep, Line: r.Line,
+				Cond: r.Cond, Meta: r.Meta}
+			if !yield(op, nil) {
+				return
+			}
+		}
+	}
+}
+
+// flush writes out the buffer and returns the file size and record count.
+func (fs *FileStore) flush() (int64, int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.w.Flush(); err != nil {
+		return 0, 0, err
+	}
+	info, err := fs.f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Size(), fs.n, nil
+}
+
+// Close closes the file; the store cannot be used afterwards.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.w.Flush(); err != nil {
+		fs.f.Close()
+		return err
+	}
+	return fs.f.Close()
+}
+
+// storedCtors rebuild the gates with angles, by name.
+var storedCtors = map[string]struct {
+	arity int
+	make  func(p []float64) gate.Gate
+}{
+	"P":    {1, func(p []float64) gate.Gate { return gate.P(p[0]) }},
+	"CP":   {1, func(p []float64) gate.Gate { return gate.CP(p[0]) }},
+	"RX":   {1, func(p []float64) gate.Gate { return gate.RX(p[0]) }},
+	"RY":   {1, func(p []float64) gate.Gate { return gate.RY(p[0]) }},
+	"RZ":   {1, func(p []float64) gate.Gate { return gate.RZ(p[0]) }},
+	"GPI":  {1, func(p []float64) gate.Gate { return gate.GPI(p[0]) }},
+	"GPI2": {1, func(p []float64) gate.Gate { return gate.GPI2(p[0]) }},
+	"MS":   {2, func(p []float64) gate.Gate { return gate.MS(p[0], p[1]) }},
+}
+
+// storedGate rebuilds a gate from its name and angles.
+func storedGate(name string, params []float64) (gate.Gate, error) {
+	ctor, ok := storedCtors[name]
+	switch {
+	case ok && len(params) == ctor.arity:
+		return ctor.make(params), nil
+	case ok || len(params) > 0:
+		return nil, fmt.Errorf("circuit: cannot store gate %s with %d parameter(s)", name, len(params))
+	}
+	g, err := gate.Factory(name)
+	if err != nil {
+		return nil, fmt.Errorf("circuit: cannot store gate %s: %w", name, err)
+	}
+	return g, nil
+}
@@ -0,0 +1,234 @@
+// Package circuitcut splits a circuit that is too wide for one backend into
+// narrower fragments by cutting qubit wires and two-qubit gates, runs the
+// fragments independently, possibly on different simulators, and
+// recombines their histograms into the distribution of the whole circuit.
+//
+// A wire cut replaces the identity channel on a wire by its Pauli
+// decomposition ρ = ½ Σ_P Tr(Pρ)·P: the fragment upstream of the cut
+// measures the wire in the X, Y or Z basis and the fragment downstream
+// starts it in an eigenstate of that Pauli. A gate cut replaces a CZ (or a
+// CNOT, a CZ between Hadamards on the target) by the quasi-probability
+// decomposition
+//
+//	CZ = ½ S⊗S + ½ S†⊗S† + ½ I⊗M − ½ Z⊗M + ½ M⊗I − ½ M⊗Z
+//
+// where M is a Z measurement whose outcome m weighs the shot by (−1)^m.
+// k wire and g gate cuts cost 4^k·6^g fragment combinations and a
+// sampling overhead that grows as 4^k·3^g, so cuts should be few.
+package circuitcut
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// WireCut cuts the wire of Qubit just before operation Before, an index
+// into c.Operations() of an operation that acts on Qubit.
+type WireCut struct {
+	Qubit, Before int
+}
+
+// GateCut cuts operation Op, an index into c.Operations() of a CZ or CNOT.
+type GateCut struct {
+	Op int
+}
+
+// portKind says what a fragment does at a cut.
+type portKind int
+
+const (
+	measurePort portKind = iota // upstream end of a wire cut
+	preparePort                 // downstream end of a wire cut
+	gatePort                    // one side of a cut gate
+)
+
+// port is one fragment's end of a cut.
+type port struct {
+	kind  portKind
+	cut   int // index into Plan.labels
+	qubit int // local qubit
+	side  int // gate cuts: 0 for the first qubit of the gate, 1 for the second
+	cnot  bool
+}
+
+// step is one entry of a fragment program: an operation of the original
+// circuit on local wires, or the port with index port.
+type step struct {
+	op   circuit.Operation
+	port int // -1 for operations
+}
+
+// Fragment is an independently runnable piece of a cut circuit.
+type Fragment struct {
+	Qubits int   // width of the fragment's circuits
+	Cbits  []int // classical bits of the original circuit it measures, ascending
+	steps  []step
+	ports  []port
+}
+
+// Plan is a cut circuit ready to run.
+type Plan struct {
+	Fragments []*Fragment
+	// labels is the number of terms of every cut: 4 for wire cuts, 6 for
+	// gate cuts. Wire cuts come first.
+	labels []int
+	cbits  []int // measured cbits of the original circuit, ascending
+}
+
+// Cut splits c at the given cuts. Circuits with classical control flow
+// cannot be cut, as their conditions would read bits across fragments.
+func Cut(c circuit.Circuit, wires []WireCut, gates []GateCut) (*Plan, error) {
+	if circuit.HasControlFlow(c) {
+		return nil, fmt.Errorf("circuitcut: circuits with classical control flow cannot be cut")
+	}
+	ops := c.Operations()
+	wireAt := map[int][]int{}
+	for j, w := range wires {
+		if w.Before < 0 || w.Before >= len(ops) || !slices.Contains(ops[w.Before].Qubits, w.Qubit) {
+			return nil, fmt.Errorf("circuitcut: wire cut %d: operation %d does not act on qubit %d", j, w.Before, w.Qubit)
+		}
+		for _, k := range wireAt[w.Before] {
+			if wires[k].Qubit == w.Qubit {
+				return nil, fmt.Errorf("circuitcut: wire cut %d duplicates cut %d", j, k)
+			}
+		}
+		wireAt[w.Before] = append(wireAt[w.Before], j)
+	}
+	gateAt := map[int]int{}
+	for j, g := range gates {
+		if g.Op < 0 || g.Op >= len(ops) {
+			return nil, fmt.Errorf("circuitcut: gate cut %d: no operation %d", j, g.Op)
+		}
+		if name := ops[g.Op].G.Name(); name != "CZ" && name != "CNOT" {
+			return nil, fmt.Errorf("circuitcut: gate cut %d: cannot cut %s, only CZ and CNOT", j, name)
+		}
+		if _, dup := gateAt[g.Op]; dup {
+			return nil, fmt.Errorf("circuitcut: operation %d is cut twice", g.Op)
+		}
+		gateAt[g.Op] = len(wires) + j
+	}
+
+	// Pass 1: split the wires into segments, one per qubit plus one per
+	// wire cut, and join the segments that an uncut operation connects.
+	segs := c.Qubits() + len(wires)
+	cur := make([]int, c.Qubits())
+	parent := make([]int, segs)
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(x int) int {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	// walk replays the cuts in operation order, calling visit with the
+	// current segment of every qubit of each operation.
+	walk := func(visit func(i int, op circuit.Operation, at []int, up, down map[int]int)) {
+		for q := range cur {
+			cur[q] = q
+		}
+		next := c.Qubits()
+		for i, op := range ops {
+			up, down := map[int]int{}, map[int]int{}
+			for _, j := range wireAt[i] {
+				q := wires[j].Qubit
+				up[j] = cur[q]
+				cur[q] = next
+				next++
+				down[j] = cur[q]
+			}
+			at := make([]int, len(op.Qubits))
+			for k, q := range op.Qubits {
+				at[k] = cur[q]
+			}
+			visit(i, op, at, up, down)
+		}
+	}
+	walk(func(i int, _ circuit.Operation, at []int, _, _ map[int]int) {
+		if _, cut := gateAt[i]; cut {
+			return
+		}
+		for _, s := range at[1:] {
+			parent[find(s)] = find(at[0])
+		}
+	})
+
+	// Group segments into fragments, ordered by their first segment.
+	frag := make([]int, segs)
+	local := make([]int, segs)
+	rootFrag := map[int]int{}
+	p := &Plan{}
+	for s := range segs {
+		r := find(s)
+		f, ok := rootFrag[r]
+		if !ok {
+			f = len(p.Fragments)
+			rootFrag[r] = f
+			p.Fragments = append(p.Fragments, &Fragment{})
+		}
+		frag[s], local[s] = f, p.Fragments[f].Qubits
+		p.Fragments[f].Qubits++
+	}
+
+	// Pass 2: write each fragment's program.
+	owner := map[int]int{}
+	var err error
+	walk(func(i int, op circuit.Operation, at []int, up, down map[int]int) {
+		if err != nil {
+			return
+		}
+		for _, j := range slices.Sorted(maps.Keys(up)) {
+			p.addPort(frag[up[j]], port{kind: measurePort, cut: j, qubit: local[up[j]]})
+			p.addPort(frag[down[j]], port{kind: preparePort, cut: j, qubit: local[down[j]]})
+		}
+		if j, cut := gateAt[i]; cut {
+			cnot := op.G.Name() == "CNOT"
+			p.addPort(frag[at[0]], port{kind: gatePort, cut: j, qubit: local[at[0]], side: 0})
+			p.addPort(frag[at[1]], port{kind: gatePort, cut: j, qubit: local[at[1]], side: 1, cnot: cnot})
+			return
+		}
+		f := p.Fragments[frag[at[0]]]
+		lop := op
+		lop.Qubits = make([]int, len(at))
+		for k, s := range at {
+			lop.Qubits[k] = local[s]
+		}
+		if op.G.Name() == "MEASURE" {
+			if o, ok := owner[op.Cbit]; ok && o != frag[at[0]] {
+				err = fmt.Errorf("circuitcut: cbit %d is measured in fragments %d and %d", op.Cbit, o, frag[at[0]])
+				return
+			}
+			owner[op.Cbit] = frag[at[0]]
+			if !slices.Contains(f.Cbits, op.Cbit) {
+				f.Cbits = append(f.Cbits, op.Cbit)
+			}
+		}
+		f.steps = append(f.steps, step{op: lop, port: -1})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range p.Fragments {
+		slices.Sort(f.Cbits)
+		p.cbits = append(p.cbits, f.Cbits...)
+	}
+	slices.Sort(p.cbits)
+	for range wires {
+		p.labels = append(p.labels, 4)
+	}
+	for range gates {
+		p.labels = append(p.labels, 6)
+	}
+	return p, nil
+}
+
+func (p *Plan) addPort(f int, pt port) {
+	fr := p.Fragments[f]
+	fr.steps = append(fr.steps, step{port: len(fr.ports)})
+	fr.ports = append(fr.ports, pt)
+}
@@ -0,0 +1,118 @@
+package circuitcut
+
+import (
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opIndex finds the operation of c named name on qubits qs.
+func opIndex(t *testing.T, c circuit.Circuit, name string, qs ...int) int {
+	t.Helper()
+	for i, op := range c.Operations() {
+		if op.G.Name() == name && assert.ObjectsAreEqual(op.Qubits, qs) {
+			return i
+		}
+	}
+	t.Fatalf("no %s on %v", name, qs)
+	return -1
+}
+
+func newSim(seed int64) *simulator.Simulator {
+	return simulator.NewSimulator(simulator.SimulatorOptions{Shots: 20000, Runner: qsim.NewQSimRunner(), Seed: seed})
+}
+
+// assertClose compares a reconstruction with a direct run of c.
+func assertClose(t *testing.T, c circuit.Circuit, got map[string]float64) {
+	t.Helper()
+	direct, err := newSim(99).Run(c)
+	require.NoError(t, err)
+	total := 0
+	for _, n := range direct {
+		total += n
+	}
+	sum := 0.0
+	for k, v := range got {
+		assert.InDelta(t, float64(direct[k])/float64(total), v, 0.04, k)
+		sum += v
+	}
+	for k, n := range direct {
+		if float64(n)/float64(total) > 0.02 {
+			assert.Contains(t, got, k)
+		}
+	}
+	assert.InDelta(t, 1, sum, 0.02)
+}
+
+func TestWireCut(t *testing.T) {
+	c, err := builder.New(builder.Q(4), builder.C(4)).
+		H(0).CNOT(0, 1).CNOT(1, 2).CNOT(2, 3).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).Measure(3, 3).BuildCircuit()
+	require.NoError(t, err)
+
+	plan, err := Cut(c, []WireCut{{Qubit: 1, Before: opIndex(t, c, "CNOT", 1, 2)}}, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.Fragments, 2)
+	assert.Equal(t, 2, plan.Fragments[0].Qubits)
+	assert.Equal(t, 3, plan.Fragments[1].Qubits)
+	assert.Equal(t, []int{0}, plan.Fragments[0].Cbits)
+	assert.Equal(t, []int{1, 2, 3}, plan.Fragments[1].Cbits)
+
+	got, err := plan.Run(newSim(1), newSim(2))
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, got["0000"], 0.04)
+	assert.InDelta(t, 0.5, got["1111"], 0.04)
+	assertClose(t, c, got)
+}
+
+func TestGateCut(t *testing.T) {
+	c, err := builder.New(builder.Q(4), builder.C(4)).
+		RY(0.7, 0).RX(1.9, 1).CNOT(0, 1).RY(1.2, 2).H(3).
+		CNOT(1, 2).
+		CZ(2, 3).RY(0.4, 1).RX(0.8, 2).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).Measure(3, 3).BuildCircuit()
+	require.NoError(t, err)
+
+	plan, err := Cut(c, nil, []GateCut{{Op: opIndex(t, c, "CNOT", 1, 2)}})
+	require.NoError(t, err)
+	require.Len(t, plan.Fragments, 2)
+	got, err := plan.Run(newSim(3))
+	require.NoError(t, err)
+	assertClose(t, c, got)
+
+	// A wire cut and a gate cut together, with the Y basis exercised by a
+	// phase on the cut wire.
+	c, err = builder.New(builder.Q(3), builder.C(3)).
+		H(0).S(0).CNOT(0, 1).RX(0.6, 1).CZ(1, 2).H(1).H(2).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	require.NoError(t, err)
+	plan, err = Cut(c, []WireCut{{Qubit: 1, Before: opIndex(t, c, "RX", 1)}}, []GateCut{{Op: opIndex(t, c, "CZ", 1, 2)}})
+	require.NoError(t, err)
+	assert.Len(t, plan.Fragments, 3)
+	got, err = plan.Run(newSim(4))
+	require.NoError(t, err)
+	assertClose(t, c, got)
+}
+
+func TestCutErrors(t *testing.T) {
+	c, err := builder.New(builder.Q(2), builder.C(2)).H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(t, err)
+
+	_, err = Cut(c, []WireCut{{Qubit: 1, Before: opIndex(t, c, "H", 0)}}, nil)
+	assert.Error(t, err, "operation does not act on the qubit")
+	_, err = Cut(c, nil, []GateCut{{Op: opIndex(t, c, "H", 0)}})
+	assert.Error(t, err, "only CZ and CNOT")
+	_, err = Cut(c, nil, []GateCut{{Op: 1}, {Op: 1}})
+	assert.Error(t, err)
+
+	cf, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).
+		If(builder.Bit(0), func(b builder.Builder) { b.X(0) }).BuildCircuit()
+	require.NoError(t, err)
+	_, err = Cut(cf, nil, nil)
+	assert.Error(t, err)
+}
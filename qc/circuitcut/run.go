@@ -0,0 +1,345 @@
+package circuitcut
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Local operations of the two sides of a gate-cut term.
+const (
+	opI = iota
+	opS
+	opSdg
+	opZ
+	opM // Z measurement weighted by (−1)^m
+)
+
+// gateTerms is the decomposition of CZ: coefficient and the local
+// operation on each side.
+var gateTerms = [6]struct {
+	coeff float64
+	ops   [2]int
+}{
+	{0.5, [2]int{opS, opS}},
+	{0.5, [2]int{opSdg, opSdg}},
+	{0.5, [2]int{opI, opM}},
+	{-0.5, [2]int{opZ, opM}},
+	{0.5, [2]int{opM, opI}},
+	{-0.5, [2]int{opM, opZ}},
+}
+
+// Wire-cut labels, the Pauli a term of ρ = ½ Σ_P Tr(Pρ)·P carries.
+const (
+	pauliI = iota
+	pauliX
+	pauliY
+	pauliZ
+)
+
+// Measurement bases and prepared states of wire cuts.
+const (
+	basisZ = iota
+	basisX
+	basisY
+)
+
+const (
+	prep0 = iota
+	prep1
+	prepPlus
+	prepMinus
+	prepPlusI
+	prepMinusI
+)
+
+// preps lists, per Pauli label, the two eigenstates whose difference (sum
+// for I) is that Pauli.
+var preps = [4]struct {
+	a, b  int
+	signB float64
+}{
+	pauliI: {prep0, prep1, 1},
+	pauliX: {prepPlus, prepMinus, -1},
+	pauliY: {prepPlusI, prepMinusI, -1},
+	pauliZ: {prep0, prep1, -1},
+}
+
+// variant returns the circuit of f with every port set: the basis of a
+// measure port, the state of a prepare port or the operation of a gate
+// port. Own cbits come first, then one cbit per port that measures, in
+// port order.
+func (f *Fragment) variant(settings []int) (circuit.Circuit, error) {
+	extra := 0
+	for i, pt := range f.ports {
+		if pt.kind == measurePort || pt.kind == gatePort && settings[i] == opM {
+			extra++
+		}
+	}
+	localCbit := make(map[int]int, len(f.Cbits))
+	for i, cb := range f.Cbits {
+		localCbit[cb] = i
+	}
+	out := circuit.NewIncremental(f.Qubits, len(f.Cbits)+extra)
+	next := len(f.Cbits)
+	var err error
+	add := func(g gate.Gate, q, cbit int) {
+		if err == nil {
+			_, err = out.Append(dag.Op{G: g, Qubits: []int{q}, Cbit: cbit})
+		}
+	}
+	for _, s := range f.steps {
+		if s.port < 0 {
+			cbit := -1
+			if s.op.G.Name() == "MEASURE" {
+				cbit = localCbit[s.op.Cbit]
+			}
+			if err == nil {
+				_, err = out.Append(dag.Op{G: s.op.G, Qubits: s.op.Qubits, Cbit: cbit, Meta: s.op.Meta})
+			}
+			continue
+		}
+		pt, set := f.ports[s.port], settings[s.port]
+		q := pt.qubit
+		switch pt.kind {
+		case measurePort:
+			switch set {
+			case basisX:
+				add(gate.H(), q, -1)
+			case basisY:
+				add(gate.P(-math.Pi/2), q, -1)
+				add(gate.H(), q, -1)
+			}
+			add(gate.Measure(), q, next)
+			next++
+		case preparePort:
+			if set == prep1 || set == prepMinus || set == prepMinusI {
+				add(gate.X(), q, -1)
+			}
+			if set >= prepPlus {
+				add(gate.H(), q, -1)
+			}
+			if set >= prepPlusI {
+				add(gate.S(), q, -1)
+			}
+		case gatePort:
+			if pt.cnot {
+				add(gate.H(), q, -1)
+			}
+			switch set {
+			case opS:
+				add(gate.S(), q, -1)
+			case opSdg:
+				add(gate.P(-math.Pi/2), q, -1)
+			case opZ:
+				add(gate.Z(), q, -1)
+			case opM:
+				add(gate.Measure(), q, next)
+				next++
+			}
+			if pt.cnot {
+				add(gate.H(), q, -1)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("circuitcut: %w", err)
+	}
+	return out, nil
+}
+
+// fragmentRun evaluates one fragment on one simulator, caching the
+// histogram of every variant it needs.
+type fragmentRun struct {
+	f      *Fragment
+	sim    *simulator.Simulator
+	hists  map[string]map[string]float64 // by settings, normalised
+	tables map[string]map[string]float64 // by labels
+}
+
+func (r *fragmentRun) hist(settings []int) (map[string]float64, error) {
+	key := fmt.Sprint(settings)
+	if h, ok := r.hists[key]; ok {
+		return h, nil
+	}
+	c, err := r.f.variant(settings)
+	if err != nil {
+		return nil, err
+	}
+	h := map[string]float64{}
+	if c.Clbits() == 0 {
+		h[""] = 1
+	} else {
+		counts, err := r.sim.Run(c)
+		if err != nil {
+			return nil, fmt.Errorf("circuitcut: %w", err)
+		}
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		for k, n := range counts {
+			k, _, _ = strings.Cut(k, "|")
+			h[k] += float64(n) / float64(total)
+		}
+	}
+	r.hists[key] = h
+	return h, nil
+}
+
+// table returns the fragment's term for the given cut labels: its
+// distribution over its own cbits with the prepare ports expanded into
+// their eigenstates and every measuring port weighting shots by (−1)^m
+// where the label asks for it.
+func (r *fragmentRun) table(labels []int) (map[string]float64, error) {
+	f := r.f
+	key := ""
+	for _, pt := range f.ports {
+		key += strconv.Itoa(labels[pt.cut])
+	}
+	if t, ok := r.tables[key]; ok {
+		return t, nil
+	}
+
+	settings := make([]int, len(f.ports))
+	var prepares []int
+	signed := make([]bool, len(f.ports))
+	for i, pt := range f.ports {
+		l := labels[pt.cut]
+		switch pt.kind {
+		case measurePort:
+			settings[i] = [4]int{pauliI: basisZ, pauliX: basisX, pauliY: basisY, pauliZ: basisZ}[l]
+			signed[i] = l != pauliI
+		case preparePort:
+			prepares = append(prepares, i)
+		case gatePort:
+			settings[i] = gateTerms[l].ops[pt.side]
+			signed[i] = settings[i] == opM
+		}
+	}
+
+	t := map[string]float64{}
+	own := len(f.Cbits)
+	for choice := range 1 << len(prepares) {
+		weight := 1.0
+		for k, i := range prepares {
+			p := preps[labels[f.ports[i].cut]]
+			settings[i] = p.a
+			if choice&(1<<k) != 0 {
+				settings[i] = p.b
+				weight *= p.signB
+			}
+		}
+		h, err := r.hist(settings)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range h {
+			if len(k) < own {
+				return nil, fmt.Errorf("circuitcut: fragment key %q is shorter than its %d cbits", k, own)
+			}
+			w, bit := weight, own
+			for i, pt := range f.ports {
+				if pt.kind == measurePort || pt.kind == gatePort && settings[i] == opM {
+					if signed[i] && k[bit] == '1' {
+						w = -w
+					}
+					bit++
+				}
+			}
+			t[k[:own]] += w * v
+		}
+	}
+	r.tables[key] = t
+	return t, nil
+}
+
+// Run executes every fragment variant and reconstructs the distribution
+// of the original circuit's measured cbits, keyed like Simulator.Run.
+// Fragment i runs on sims[i], or on the last simulator when there are
+// fewer simulators than fragments. The result is a quasi-distribution:
+// shot noise can leave small negative entries, which callers may clip.
+func (p *Plan) Run(sims ...*simulator.Simulator) (map[string]float64, error) {
+	if len(sims) == 0 {
+		return nil, fmt.Errorf("circuitcut: Run needs a simulator")
+	}
+	runs := make([]*fragmentRun, len(p.Fragments))
+	for i, f := range p.Fragments {
+		runs[i] = &fragmentRun{f: f, sim: sims[min(i, len(sims)-1)], hists: map[string]map[string]float64{}, tables: map[string]map[string]float64{}}
+	}
+
+	// Position of each fragment's own cbits in the final key.
+	pos := make(map[int]int, len(p.cbits))
+	for i, cb := range p.cbits {
+		pos[cb] = i
+	}
+
+	total := map[string]float64{}
+	labels := make([]int, len(p.labels))
+	for {
+		coeff := 1.0
+		for j, l := range labels {
+			if p.labels[j] == 4 {
+				coeff *= 0.5
+			} else {
+				coeff *= gateTerms[l].coeff
+			}
+		}
+		acc := map[string]float64{"": coeff}
+		for _, r := range runs {
+			t, err := r.table(labels)
+			if err != nil {
+				return nil, err
+			}
+			next := make(map[string]float64, len(acc)*len(t))
+			for k1, v1 := range acc {
+				for k2, v2 := range t {
+					if v2 != 0 {
+						next[k1+k2] += v1 * v2
+					}
+				}
+			}
+			acc = next
+		}
+		for k, v := range acc {
+			total[k] += v
+		}
+		if !nextLabels(labels, p.labels) {
+			break
+		}
+	}
+
+	// Reorder concatenated fragment keys into cbit order.
+	out := make(map[string]float64, len(total))
+	key := make([]byte, len(p.cbits))
+	for k, v := range total {
+		i := 0
+		for _, f := range p.Fragments {
+			for _, cb := range f.Cbits {
+				key[pos[cb]] = k[i]
+				i++
+			}
+		}
+		out[string(key)] += v
+	}
+	return out, nil
+}
+
+// nextLabels advances labels like an odometer with the given radices and
+// reports false after the last combination.
+func nextLabels(labels, radix []int) bool {
+	for j := range labels {
+		labels[j]++
+		if labels[j] < radix[j] {
+			return true
+		}
+		labels[j] = 0
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package dag
+
+// levels returns each node's ASAP layer, or nil if the DAG is not
+// validated. The map is cached by Validate and kept current by edits.
+func (d *DAG) levels() map[NodeID]int {
+	if !d.valid {
+		return nil
+	}
+	return d.level
+}
+
+// CriticalPath returns one longest chain of dependent operations, in
+// execution order. Its length equals Depth(); every op on it delays the
+// whole circuit if it is slowed down. Requires Validate().
+func (d *DAG) CriticalPath() []*Node {
+	lv := d.levels()
+	if len(lv) == 0 {
+		return nil
+	}
+	// Start from a node in the last layer and walk back through parents
+	// that sit exactly one layer earlier.
+	var cur *Node
+	for _, n := range d.topoOrder {
+		if lv[n.ID] == d.depth-1 {
+			cur = n
+			break
+		}
+	}
+	path := make([]*Node, d.depth)
+	for i := d.depth - 1; i >= 0; i-- {
+		path[i] = cur
+		for _, p := range cur.parents {
+			if lv[p] == i-1 {
+				cur = d.nodes[p]
+				break
+			}
+		}
+	}
+	return path
+}
+
+// LayerWidths returns how many operations fall into each ASAP layer, i.e.
+// how many could run in parallel at each time step. Requires Validate().
+func (d *DAG) LayerWidths() []int {
+	lv := d.levels()
+	if lv == nil {
+		return nil
+	}
+	widths := make([]int, d.depth)
+	for _, l := range lv {
+		widths[l]++
+	}
+	return widths
+}
+
+// Parallelism is the average layer width: operations divided by depth.
+// 1 means fully sequential; 0 means the DAG is empty or not validated.
+func (d *DAG) Parallelism() float64 {
+	if !d.valid || d.depth == 0 {
+		return 0
+	}
+	return float64(len(d.topoOrder)) / float64(d.depth)
+}
@@ -0,0 +1,182 @@
+package dag
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Condition is a classical predicate over measured bits. It holds when the
+// listed cbits, read as an integer with Cbits[0] as the least significant
+// bit, equal Value (or differ from it when Negate is set). An operation
+// with a condition is ordered after every earlier write to the registers
+// its cbits fall in, not only to the cbits themselves.
+type Condition struct {
+	Cbits  []int
+	Value  int
+	Negate bool
+}
+
+// Not returns the complement of c, used for else branches.
+func (c Condition) Not() Condition {
+	return Condition{Cbits: append([]int(nil), c.Cbits...), Value: c.Value, Negate: !c.Negate}
+}
+
+// Eval evaluates c against the current classical state; bit reports
+// whether a cbit is set.
+func (c Condition) Eval(bit func(int) bool) bool {
+	v := 0
+	for i, cb := range c.Cbits {
+		if bit(cb) {
+			v |= 1 << i
+		}
+	}
+	return (v == c.Value) != c.Negate
+}
+
+// Loop is a bounded repeat-until-success block: Body runs once, then again
+// while Until does not hold, at most Max times in total.
+type Loop struct {
+	Body  []*Node // nodes are owned by the loop and are not part of the DAG
+	Until Condition
+	Max   int
+}
+
+// Qubits returns the sorted set of qubits touched by the loop body.
+func (l *Loop) Qubits() []int {
+	seen := map[int]bool{}
+	var qs []int
+	walk(l.Body, func(n *Node) {
+		for _, q := range n.Qubits {
+			if !seen[q] {
+				seen[q] = true
+				qs = append(qs, q)
+			}
+		}
+	})
+	slices.Sort(qs)
+	return qs
+}
+
+// Cbits returns the sorted set of cbits read or written by the loop,
+// including its exit condition.
+func (l *Loop) Cbits() []int {
+	seen := map[int]bool{}
+	var cs []int
+	add := func(c int) {
+		if c >= 0 && !seen[c] {
+			seen[c] = true
+			cs = append(cs, c)
+		}
+	}
+	for _, c := range l.Until.Cbits {
+		add(c)
+	}
+	walk(l.Body, func(n *Node) {
+		add(n.Cbit)
+		if n.Cond != nil {
+			for _, c := range n.Cond.Cbits {
+				add(c)
+			}
+		}
+	})
+	slices.Sort(cs)
+	return cs
+}
+
+// walk visits nodes depth-first, descending into nested loops.
+func walk(nodes []*Node, fn func(*Node)) {
+	for _, n := range nodes {
+		fn(n)
+		if n.Loop != nil {
+			walk(n.Loop.Body, fn)
+		}
+	}
+}
+
+// AddConditional adds a gate (or a measurement into cbit when g is
+// gate.Measure()) that only executes when cond holds at run time.
+func (d *DAG) AddConditional(g gate.Gate, qs []int, cbit int, cond Condition) error {
+	if d.valid {
+		return ErrValidated
+	}
+	if err := d.checkCondition(cond); err != nil {
+		return err
+	}
+	n, err := d.newNode(g, qs, cbit)
+	if err != nil {
+		return err
+	}
+	c := cond
+	c.Cbits = append([]int(nil), cond.Cbits...)
+	n.Cond = &c
+	d.link(n, n.Qubits, d.cbitWires(n))
+	return nil
+}
+
+// AddLoop adds a bounded repeat-until-success block. The body nodes are
+// checked against the register sizes but are not linked into the DAG; the
+// loop itself becomes a single node spanning everything the body touches.
+func (d *DAG) AddLoop(body []*Node, until Condition, max int) error {
+	if d.valid {
+		return ErrValidated
+	}
+	if max < 1 {
+		return fmt.Errorf("dag: loop bound must be positive, got %d", max)
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("dag: empty loop body")
+	}
+	if err := d.checkCondition(until); err != nil {
+		return err
+	}
+	var err error
+	walk(body, func(n *Node) {
+		if err != nil || n.Loop != nil {
+			return
+		}
+		if n.G.Name() == "MEASURE" {
+			_, err = d.newNode(n.G, n.Qubits, n.Cbit)
+		} else {
+			err = d.checkGate(n.G, n.Qubits)
+		}
+		if err == nil && n.Cond != nil {
+			err = d.checkCondition(*n.Cond)
+		}
+		if err == nil {
+			err = checkMeta(n.Meta)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	l := &Loop{Body: body, Until: until, Max: max}
+	l.Until.Cbits = append([]int(nil), until.Cbits...)
+	qs := l.Qubits()
+	n := &Node{ID: nextID(), G: gate.Loop(len(qs)), Qubits: qs, Cbit: -1, Loop: l}
+	d.link(n, qs, d.cbitWires(n))
+	return nil
+}
+
+// maxCondCbits is the widest condition whose value fits in an int.
+const maxCondCbits = 62
+
+func (d *DAG) checkCondition(c Condition) error {
+	if len(c.Cbits) == 0 {
+		return fmt.Errorf("dag: condition reads no classical bits")
+	}
+	for _, cb := range c.Cbits {
+		if cb < 0 || cb >= d.clbits {
+			return ErrBadClbit
+		}
+	}
+	if len(c.Cbits) > maxCondCbits {
+		return fmt.Errorf("dag: condition reads %d classical bits, more than the %d its value can hold", len(c.Cbits), maxCondCbits)
+	}
+	if c.Value < 0 || c.Value >= 1<<len(c.Cbits) {
+		return fmt.Errorf("dag: condition value %d does not fit in %d bit(s)", c.Value, len(c.Cbits))
+	}
+	return nil
+}
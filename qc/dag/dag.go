@@ -2,6 +2,8 @@ package dag
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"sync/atomic"
 
 	"github.com/kegliz/qcm/qc/gate"
@@ -14,11 +16,16 @@ var idCtr uint64 // atomic counter for NodeIDs
 
 // Node holds one DAG vertex = Gate or Measure op.
 // It contains the gate, its qubit targets, and its classical target.
+// Control flow is carried alongside: Cond gates the op on classical bits,
+// and Loop (set on LOOP nodes only) holds a repeat-until-success block.
 type Node struct {
 	ID     NodeID
 	G      gate.Gate
-	Qubits []int // logical qubit indices       (len = G.QubitSpan())
-	Cbit   int   // classical target; -1 if none
+	Qubits []int      // logical qubit indices       (len = G.QubitSpan())
+	Cbit   int        // classical target; -1 if none
+	Cond   *Condition // nil for unconditional ops
+	Loop   *Loop      // nil unless G is a loop
+	Meta   Meta       // opaque backend data; nil if none
 	// Fast adjacency
 	parents  []NodeID
 	children []NodeID
@@ -31,11 +38,60 @@ func (n *Node) Parents() []NodeID {
 	return result
 }
 
+// Children returns a copy of the child node IDs.
+func (n *Node) Children() []NodeID {
+	return append([]NodeID(nil), n.children...)
+}
+
+// Cbits returns the classical bits n reads or writes: its measurement
+// target, its condition and, for loops, everything the body touches.
+func (n *Node) Cbits() []int {
+	var cs []int
+	if n.Cbit >= 0 {
+		cs = append(cs, n.Cbit)
+	}
+	if n.Cond != nil {
+		cs = append(cs, n.Cond.Cbits...)
+	}
+	if n.Loop != nil {
+		cs = append(cs, n.Loop.Cbits()...)
+	}
+	slices.Sort(cs)
+	return slices.Compact(cs)
+}
+
+// cbitWires returns the classical wires n is linked on: its Cbits and,
+// when n is conditional or a loop, every bit of each register those bits
+// fall in. A hybrid run's callback may rewrite a whole register after a
+// measurement into any of its bits, so a condition on one bit must follow
+// every earlier write to the register, and later writes must follow it.
+func (d *DAG) cbitWires(n *Node) []int {
+	cs := n.Cbits()
+	if n.Cond == nil && n.Loop == nil {
+		return cs
+	}
+	for _, r := range d.cregs {
+		if slices.ContainsFunc(cs, func(c int) bool { return c >= r.Start && c < r.Start+r.Size }) {
+			for c := r.Start; c < r.Start+r.Size; c++ {
+				cs = append(cs, c)
+			}
+		}
+	}
+	slices.Sort(cs)
+	return slices.Compact(cs)
+}
+
 // DAGBuilder defines the interface for constructing a DAG.
 type DAGBuilder interface {
 	AddGate(g gate.Gate, qs []int) error
 	AddMeasure(q, c int) error
+	AddConditional(g gate.Gate, qs []int, cbit int, cond Condition) error
+	AddLoop(body []*Node, until Condition, max int) error
+	AnnotateLast(m Meta) error
+	AddQubits(n int) error
+	SetCRegs(regs []Register) error
 	Validate() error
+	Clone() *DAG
 	Qubits() int
 	Clbits() int
 }
@@ -46,6 +102,19 @@ type DAGReader interface {
 	Depth() int          // Returns the circuit depth
 	Qubits() int
 	Clbits() int
+	CRegs() []Register // Named classical registers, possibly empty
+
+	// Scheduling analysis (see analysis.go)
+	CriticalPath() []*Node // A longest dependency chain, first op first
+	LayerWidths() []int    // Number of ops in each ASAP layer
+	Parallelism() float64  // Ops per layer on average (ops / depth)
+}
+
+// Register names a contiguous range of classical bits.
+type Register struct {
+	Name  string
+	Start int // index of element 0
+	Size  int
 }
 
 // DAG is *mutable* until Validate() is called; then considered frozen.
@@ -57,12 +126,18 @@ type DAG struct {
 	nodes map[NodeID]*Node // all vertices
 	byQ   [][]NodeID       // per-qubit chronological list
 	last  []NodeID         // last op on each qubit (for hazards)
+	lastC []NodeID         // last op reading or writing each cbit
+	byC   [][]NodeID       // per-cbit chronological list
+	cregs []Register       // named classical registers
+	// lastNode is the node linked most recently, for AnnotateLast.
+	lastNode NodeID
 
 	valid bool // set by Validate()
 
 	// Cached results after validation
 	topoOrder []*Node
 	depth     int
+	level     map[NodeID]int // 0-based ASAP layer of each node
 }
 
 // New creates a new DAG with the specified number of qubits and classical bits.
@@ -73,10 +148,46 @@ func New(qb, cb int) *DAG {
 		nodes:  make(map[NodeID]*Node),
 		byQ:    make([][]NodeID, qb),
 		last:   make([]NodeID, qb),
+		lastC:  make([]NodeID, cb),
+		byC:    make([][]NodeID, cb),
 		depth:  -1, // Initialize depth as uncalculated
 	}
 }
 
+// Clone returns an independent deep copy: changes to either DAG, including
+// appends after validation, do not affect the other. Node IDs are kept.
+// Every node, wire list and cache is copied, so Clone takes time
+// proportional to the DAG; loop bodies and conditions are immutable and
+// therefore shared.
+func (d *DAG) Clone() *DAG {
+	c := *d
+	c.nodes = make(map[NodeID]*Node, len(d.nodes))
+	for id, n := range d.nodes {
+		cn := *n
+		cn.parents = slices.Clone(n.parents)
+		cn.children = slices.Clone(n.children)
+		c.nodes[id] = &cn
+	}
+	cloneWires := func(ws [][]NodeID) [][]NodeID {
+		out := make([][]NodeID, len(ws))
+		for i, w := range ws {
+			out[i] = slices.Clone(w)
+		}
+		return out
+	}
+	c.byQ, c.byC = cloneWires(d.byQ), cloneWires(d.byC)
+	c.last, c.lastC = slices.Clone(d.last), slices.Clone(d.lastC)
+	c.cregs = slices.Clone(d.cregs)
+	if d.topoOrder != nil {
+		c.topoOrder = make([]*Node, len(d.topoOrder))
+		for i, n := range d.topoOrder {
+			c.topoOrder[i] = c.nodes[n.ID]
+		}
+	}
+	c.level = maps.Clone(d.level)
+	return &c
+}
+
 // nextID generates a new unique NodeID.
 func nextID() NodeID { return NodeID(atomic.AddUint64(&idCtr, 1)) }
 
@@ -86,36 +197,63 @@ func (d *DAG) Qubits() int { return d.qubits }
 // Clbits returns the number of classical bits.
 func (d *DAG) Clbits() int { return d.clbits }
 
-// AddGate adds a gate operation to the DAG.
-func (d *DAG) AddGate(g gate.Gate, qs []int) error {
+// CRegs returns a copy of the named classical registers.
+func (d *DAG) CRegs() []Register { return append([]Register(nil), d.cregs...) }
+
+// SetCRegs names ranges of classical bits. Registers must have unique,
+// non-empty names and must not overlap; bits outside every register stay
+// anonymous.
+func (d *DAG) SetCRegs(regs []Register) error {
 	if d.valid {
 		return ErrValidated
 	}
-	if err := d.checkGate(g, qs); err != nil {
-		return err
+	used := make([]bool, d.clbits)
+	names := map[string]bool{}
+	for _, r := range regs {
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("dag: classical register name %q is empty or duplicated", r.Name)
+		}
+		names[r.Name] = true
+		if r.Size < 1 || r.Start < 0 || r.Start+r.Size > d.clbits {
+			return fmt.Errorf("dag: classical register %s [%d,%d) outside %d clbits: %w",
+				r.Name, r.Start, r.Start+r.Size, d.clbits, ErrBadClbit)
+		}
+		for i := r.Start; i < r.Start+r.Size; i++ {
+			if used[i] {
+				return fmt.Errorf("dag: classical register %s overlaps cbit %d", r.Name, i)
+			}
+			used[i] = true
+		}
 	}
-	n := &Node{
-		ID:     nextID(),
-		G:      g,
-		Qubits: append([]int(nil), qs...),
-		Cbit:   -1,
+	d.cregs = append([]Register(nil), regs...)
+	return nil
+}
+
+// AddQubits widens the register by n fresh qubits appended after the
+// existing ones. It is used by the builder to grow ancilla pools.
+func (d *DAG) AddQubits(n int) error {
+	if d.valid {
+		return ErrValidated
 	}
-	d.nodes[n.ID] = n
+	if n < 0 {
+		return ErrBadQubit
+	}
+	d.qubits += n
+	d.byQ = append(d.byQ, make([][]NodeID, n)...)
+	d.last = append(d.last, make([]NodeID, n)...)
+	return nil
+}
 
-	// Build edges: parent = last op on each incident qubit.
-	// Use a set to prevent duplicate parents if a gate touches the same qubit twice
-	parentSet := make(map[NodeID]struct{})
-	for _, q := range qs {
-		if prev := d.last[q]; prev != 0 {
-			if _, exists := parentSet[prev]; !exists {
-				parentSet[prev] = struct{}{}
-				n.parents = append(n.parents, prev)
-				d.nodes[prev].children = append(d.nodes[prev].children, n.ID)
-			}
-		}
-		d.last[q] = n.ID
-		d.byQ[q] = append(d.byQ[q], n.ID)
+// AddGate adds a gate operation to the DAG.
+func (d *DAG) AddGate(g gate.Gate, qs []int) error {
+	if d.valid {
+		return ErrValidated
+	}
+	n, err := d.newNode(g, qs, -1)
+	if err != nil {
+		return err
 	}
+	d.link(n, n.Qubits, nil)
 	return nil
 }
 
@@ -124,26 +262,115 @@ func (d *DAG) AddMeasure(q, c int) error {
 	if d.valid {
 		return ErrValidated
 	}
-	if q < 0 || q >= d.qubits {
-		return ErrBadQubit
+	n, err := d.newNode(gate.Measure(), []int{q}, c)
+	if err != nil {
+		return err
 	}
-	if c < 0 || c >= d.clbits {
-		return ErrBadClbit
+	d.link(n, n.Qubits, []int{c})
+	return nil
+}
+
+// Append adds op after everything already on its wires. Unlike AddGate and
+// AddMeasure it also works on a validated DAG: the new node has no
+// children, so the cached topological order, layers and depth are extended
+// in place instead of being recomputed. Interactive tools use it to grow a
+// circuit one gate at a time.
+func (d *DAG) Append(op Op) (NodeID, error) {
+	if op.G == nil {
+		return 0, fmt.Errorf("dag: Append called with nil gate")
 	}
-	n := &Node{
-		ID:     nextID(),
-		G:      gate.Measure(),
-		Qubits: []int{q},
-		Cbit:   c,
+	cb := -1
+	if op.G.Name() == "MEASURE" {
+		cb = op.Cbit
+	}
+	n, err := d.newNode(op.G, op.Qubits, cb)
+	if err != nil {
+		return 0, err
+	}
+	if op.Cond != nil {
+		if err := d.checkCondition(*op.Cond); err != nil {
+			return 0, err
+		}
+		c := *op.Cond
+		c.Cbits = append([]int(nil), op.Cond.Cbits...)
+		n.Cond = &c
+	}
+	if err := checkMeta(op.Meta); err != nil {
+		return 0, err
+	}
+	n.Meta = maps.Clone(op.Meta)
+	d.link(n, n.Qubits, d.cbitWires(n))
+	if d.valid {
+		l := 0
+		for _, p := range n.parents {
+			l = max(l, d.level[p]+1)
+		}
+		d.level[n.ID] = l
+		d.depth = max(d.depth, l+1)
+		d.topoOrder = append(d.topoOrder, n)
 	}
+	return n.ID, nil
+}
+
+// Level returns the 0-based ASAP layer of a node in a validated DAG.
+func (d *DAG) Level(id NodeID) (int, bool) {
+	l, ok := d.level[id]
+	return l, ok && d.valid
+}
+
+// newNode validates one gate or measurement and returns it as an unlinked node.
+func (d *DAG) newNode(g gate.Gate, qs []int, cbit int) (*Node, error) {
+	if g.Name() == "MEASURE" {
+		if len(qs) != 1 || qs[0] < 0 || qs[0] >= d.qubits {
+			return nil, ErrBadQubit
+		}
+		if cbit < 0 || cbit >= d.clbits {
+			return nil, ErrBadClbit
+		}
+	} else {
+		if err := d.checkGate(g, qs); err != nil {
+			return nil, err
+		}
+		cbit = -1
+	}
+	return &Node{
+		ID:     nextID(),
+		G:      g,
+		Qubits: append([]int(nil), qs...),
+		Cbit:   cbit,
+	}, nil
+}
+
+// link stores n and builds its edges: parent = last op on each incident
+// qubit and on each classical bit it reads or writes.
+func (d *DAG) link(n *Node, qs, cs []int) {
 	d.nodes[n.ID] = n
-	if prev := d.last[q]; prev != 0 {
-		n.parents = []NodeID{prev}
-		d.nodes[prev].children = append(d.nodes[prev].children, n.ID)
+	d.lastNode = n.ID
+	// Use a set to prevent duplicate parents if an op touches the same wire twice
+	parentSet := make(map[NodeID]struct{})
+	addParent := func(prev NodeID) {
+		if prev == 0 {
+			return
+		}
+		if _, exists := parentSet[prev]; !exists {
+			parentSet[prev] = struct{}{}
+			n.parents = append(n.parents, prev)
+			d.nodes[prev].children = append(d.nodes[prev].children, n.ID)
+		}
+	}
+	for _, q := range qs {
+		addParent(d.last[q])
+		d.last[q] = n.ID
+		d.byQ[q] = append(d.byQ[q], n.ID)
+	}
+	for _, c := range cs {
+		if c < 0 || d.lastC[c] == n.ID {
+			continue
+		}
+		addParent(d.lastC[c])
+		d.lastC[c] = n.ID
+		d.byC[c] = append(d.byC[c], n.ID)
 	}
-	d.last[q] = n.ID
-	d.byQ[q] = append(d.byQ[q], n.ID)
-	return nil
 }
 
 // Validate checks if the DAG is acyclic, calculates topological order and depth,
@@ -220,6 +447,7 @@ func (d *DAG) calculateTopoSort() []*Node {
 			queue = append(queue, id)
 		}
 	}
+	slices.Sort(queue) // deterministic order for independent roots
 
 	order := make([]*Node, 0, len(d.nodes))
 	for len(queue) > 0 {
@@ -249,8 +477,10 @@ func (d *DAG) calculateTopoSort() []*Node {
 	return order
 }
 
-// calculateDepth calculates the circuit depth (number of layers).
+// calculateDepth calculates the circuit depth (number of layers) and caches
+// each node's 0-based layer in d.level.
 func (d *DAG) calculateDepth() int {
+	d.level = make(map[NodeID]int, len(d.topoOrder))
 	if len(d.topoOrder) == 0 {
 		return 0 // Empty DAG has depth 0
 	}
@@ -270,6 +500,7 @@ func (d *DAG) calculateDepth() int {
 		depth++ // Add 1 for this node's layer
 
 		nodeDepth[node.ID] = depth
+		d.level[node.ID] = depth - 1
 		if depth > maxDepth {
 			maxDepth = depth
 		}
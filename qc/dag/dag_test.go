@@ -1,6 +1,7 @@
 package dag
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/kegliz/qcm/qc/gate"
@@ -13,6 +14,7 @@ func TestInterfaces(t *testing.T) {
 	// Compile-time checks
 	var _ DAGBuilder = (*DAG)(nil)
 	var _ DAGReader = (*DAG)(nil)
+	var _ DAGEditor = (*DAG)(nil)
 }
 
 func TestDAG_New(t *testing.T) {
@@ -292,3 +294,227 @@ func TestCycleDetect(t *testing.T) {
 	assert.Contains(err.Error(), "cycle detected", "Error message should mention cycle")
 	assert.False(d.valid, "DAG should remain invalid after cycle detection")
 }
+
+func TestDAG_ControlFlow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cond := Condition{Cbits: []int{0, 1}, Value: 2}
+	bits := map[int]bool{1: true}
+	assert.True(cond.Eval(func(c int) bool { return bits[c] }))
+	assert.False(cond.Not().Eval(func(c int) bool { return bits[c] }))
+
+	d := New(3, 2)
+	require.NoError(d.AddGate(gate.H(), []int{0}))
+	require.NoError(d.AddMeasure(0, 0))
+	// X on an untouched qubit must still wait for the measurement it reads.
+	require.NoError(d.AddConditional(gate.X(), []int{2}, -1, Condition{Cbits: []int{0}, Value: 1}))
+	body := []*Node{
+		{G: gate.H(), Qubits: []int{1}, Cbit: -1},
+		{G: gate.Measure(), Qubits: []int{1}, Cbit: 1},
+	}
+	require.NoError(d.AddLoop(body, Condition{Cbits: []int{1}, Value: 1}, 5))
+	require.NoError(d.Validate())
+
+	ops := d.Operations()
+	require.Len(ops, 4)
+	names := make([]string, len(ops))
+	for i, n := range ops {
+		names[i] = n.G.Name()
+	}
+	assert.Less(slices.Index(names, "MEASURE"), slices.Index(names, "X"))
+	assert.Equal(3, d.Depth(), "H, MEASURE and the conditional X form a chain through cbit 0")
+
+	loop := ops[slices.Index(names, "LOOP")]
+	require.NotNil(loop.Loop)
+	assert.Equal([]int{1}, loop.Qubits)
+	assert.Equal([]int{1}, loop.Loop.Cbits())
+	assert.Equal(5, loop.Loop.Max)
+
+	d = New(1, 1)
+	assert.ErrorIs(d.AddConditional(gate.X(), []int{0}, -1, Condition{Cbits: []int{1}}), ErrBadClbit)
+	assert.Error(d.AddConditional(gate.X(), []int{0}, -1, Condition{Cbits: []int{0}, Value: 2}))
+	assert.Error(d.AddLoop(body[:1], Condition{Cbits: []int{0}, Value: 1}, 0))
+	assert.ErrorIs(d.AddLoop(body, Condition{Cbits: []int{0}, Value: 1}, 1), ErrBadQubit)
+
+	// A condition over more cbits than an int holds is rejected, not wrapped.
+	d = New(1, 64)
+	wide := make([]int, 64)
+	for i := range wide {
+		wide[i] = i
+	}
+	assert.Error(d.AddConditional(gate.X(), []int{0}, -1, Condition{Cbits: wide}))
+	assert.NoError(d.AddConditional(gate.X(), []int{0}, -1, Condition{Cbits: wide[:62]}))
+
+	// A condition on one bit of a register follows every write to the
+	// register, as a callback may rewrite all of it, and later writes
+	// follow the condition; anonymous bits are not affected.
+	d = New(3, 4)
+	require.NoError(d.SetCRegs([]Register{{Name: "m", Start: 0, Size: 3}}))
+	require.NoError(d.AddMeasure(0, 0))
+	require.NoError(d.AddConditional(gate.X(), []int{1}, -1, Condition{Cbits: []int{1}, Value: 1}))
+	require.NoError(d.AddMeasure(2, 2))
+	require.NoError(d.AddConditional(gate.X(), []int{0}, -1, Condition{Cbits: []int{3}, Value: 1}))
+	require.NoError(d.Validate())
+	levels := map[string][]int{}
+	for _, n := range d.Operations() {
+		l, _ := d.Level(n.ID)
+		levels[n.G.Name()] = append(levels[n.G.Name()], l)
+	}
+	assert.Equal([]int{0, 2}, levels["MEASURE"])
+	assert.ElementsMatch([]int{1, 1}, levels["X"], "the X on cbit 3 waits only for qubit 0")
+}
+
+func TestDAG_Edit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// H(0) CNOT(0,1) X(1) MEASURE(1->0)
+	d := New(2, 1)
+	require.NoError(d.AddGate(gate.H(), []int{0}))
+	require.NoError(d.AddGate(gate.CNOT(), []int{0, 1}))
+	require.NoError(d.AddGate(gate.X(), []int{1}))
+	require.NoError(d.AddMeasure(1, 0))
+	require.NoError(d.Validate())
+	require.Equal(4, d.Depth())
+
+	byName := func(name string) *Node {
+		for _, n := range d.Operations() {
+			if n.G.Name() == name {
+				return n
+			}
+		}
+		return nil
+	}
+	h, cx, x, m := byName("H"), byName("CNOT"), byName("X"), byName("MEASURE")
+
+	// Removing X links CNOT straight to the measurement.
+	require.NoError(d.Remove(x.ID))
+	assert.Equal([]NodeID{cx.ID}, m.Parents())
+	assert.Equal(3, d.Depth(), "edits keep a validated DAG's caches current")
+	assert.ErrorIs(d.Remove(x.ID), ErrNoNode)
+
+	// CNOT(0,1) -> H(1) CZ(0,1) H(1)
+	ids, err := d.Replace(cx.ID, []Op{
+		{G: gate.H(), Qubits: []int{1}},
+		{G: gate.CZ(), Qubits: []int{0, 1}, Meta: Meta{"cal": "cz01"}},
+		{G: gate.H(), Qubits: []int{1}},
+	})
+	require.NoError(err)
+	require.Len(ids, 3)
+	cz, _ := d.Node(ids[1])
+	assert.Equal(Meta{"cal": "cz01"}, cz.Meta)
+
+	// Metadata can be set on a validated DAG and does not leak into clones.
+	clone := d.Clone()
+	require.NoError(d.SetMeta(h.ID, Meta{"cal": "h1"}))
+	ch, _ := clone.Node(h.ID)
+	assert.Nil(ch.Meta)
+	assert.Equal(Meta{"cal": "h1"}, h.Meta)
+	assert.Error(d.SetMeta(h.ID, Meta{"": "x"}))
+	assert.ErrorIs(d.SetMeta(0, Meta{"a": "b"}), ErrNoNode)
+	assert.ElementsMatch([]NodeID{h.ID, ids[0]}, cz.Parents())
+	assert.Equal([]NodeID{ids[2]}, m.Parents())
+	assert.Len(d.Operations(), 5)
+
+	// Inserting on the measurement's wires only.
+	zID, err := d.InsertBefore(m.ID, Op{G: gate.Z(), Qubits: []int{1}})
+	require.NoError(err)
+	assert.Equal([]NodeID{zID}, m.Parents())
+	_, err = d.InsertAfter(m.ID, Op{G: gate.X(), Qubits: []int{1}, Cond: &Condition{Cbits: []int{0}, Value: 1}})
+	require.NoError(err)
+	assert.Equal(6, d.Depth())
+
+	_, err = d.InsertBefore(m.ID, Op{G: gate.X(), Qubits: []int{0}})
+	assert.ErrorContains(err, "outside node")
+	_, err = d.Replace(cz.ID, []Op{{G: gate.Measure(), Qubits: []int{0}, Cbit: 0}})
+	assert.ErrorContains(err, "cbit 0 outside")
+}
+
+func TestDAG_Analysis(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// H(0) H(1) H(2) | CNOT(0,1) | CNOT(1,2) ; X(0) runs beside CNOT(1,2)
+	d := New(3, 0)
+	assert.Nil(d.CriticalPath(), "analysis needs a validated DAG")
+	for q := range 3 {
+		require.NoError(d.AddGate(gate.H(), []int{q}))
+	}
+	require.NoError(d.AddGate(gate.CNOT(), []int{0, 1}))
+	require.NoError(d.AddGate(gate.CNOT(), []int{1, 2}))
+	require.NoError(d.AddGate(gate.X(), []int{0}))
+	require.NoError(d.Validate())
+
+	path := d.CriticalPath()
+	require.Len(path, d.Depth())
+	names := make([]string, len(path))
+	for i, n := range path {
+		names[i] = n.G.Name()
+	}
+	assert.Equal([]string{"H", "CNOT", "CNOT"}, names)
+	assert.Equal([]int{1}, path[1].Qubits[1:], "second step is CNOT(0,1)")
+	assert.Equal([]int{3, 1, 2}, d.LayerWidths())
+	assert.InDelta(2.0, d.Parallelism(), 1e-12)
+}
+
+func TestDAG_Append(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := New(2, 1)
+	require.NoError(d.AddGate(gate.H(), []int{0}))
+	require.NoError(d.Validate())
+	assert.ErrorIs(d.AddGate(gate.X(), []int{1}), ErrValidated)
+
+	x, err := d.Append(Op{G: gate.X(), Qubits: []int{1}})
+	require.NoError(err)
+	cx, err := d.Append(Op{G: gate.CNOT(), Qubits: []int{0, 1}})
+	require.NoError(err)
+	m, err := d.Append(Op{G: gate.Measure(), Qubits: []int{1}, Cbit: 0})
+	require.NoError(err)
+	_, err = d.Append(Op{G: gate.Measure(), Qubits: []int{1}, Cbit: 5})
+	assert.ErrorIs(err, ErrBadClbit)
+
+	for id, want := range map[NodeID]int{x: 0, cx: 1, m: 2} {
+		l, ok := d.Level(id)
+		assert.True(ok)
+		assert.Equal(want, l, "level of node %d", id)
+	}
+	assert.Equal(3, d.Depth())
+	require.Len(d.Operations(), 4)
+	assert.Equal([]int{2, 1, 1}, d.LayerWidths(), "layers are updated incrementally")
+
+	// A full recompute must agree with the incremental bookkeeping.
+	order := d.Operations()
+	d.relink()
+	assert.Equal(3, d.Depth())
+	assert.Equal(len(order), len(d.Operations()))
+}
+
+func TestDAG_Clone(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := New(2, 1)
+	require.NoError(d.AddGate(gate.H(), []int{0}))
+	require.NoError(d.AddGate(gate.CNOT(), []int{0, 1}))
+	c := d.Clone()
+
+	require.NoError(c.AddMeasure(1, 0))
+	require.NoError(d.AddGate(gate.X(), []int{1}))
+	require.NoError(d.Validate())
+	require.NoError(c.Validate())
+	assert.Len(d.Operations(), 3)
+	assert.Len(c.Operations(), 3)
+	assert.Equal("X", d.Operations()[2].G.Name())
+	assert.Equal("MEASURE", c.Operations()[2].G.Name())
+	assert.Len(d.Operations()[1].Children(), 1, "the original's edges are untouched")
+
+	// Clones of validated DAGs keep growing independently.
+	v := d.Clone()
+	_, err := v.Append(Op{G: gate.Z(), Qubits: []int{0}})
+	require.NoError(err)
+	assert.Len(v.Operations(), 4)
+	assert.Len(d.Operations(), 3)
+}
@@ -0,0 +1,225 @@
+package dag
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// DAGEditor lets optimisation passes rewrite a DAG in place. Every edit
+// keeps the per-wire order of the untouched operations and repairs the
+// dependency edges, so a validated DAG stays validated (its topological
+// order and depth are recomputed).
+type DAGEditor interface {
+	DAGReader
+	Node(id NodeID) (*Node, bool)
+	Remove(id NodeID) error
+	Replace(id NodeID, ops []Op) ([]NodeID, error)
+	InsertBefore(id NodeID, op Op) (NodeID, error)
+	InsertAfter(id NodeID, op Op) (NodeID, error)
+	SetMeta(id NodeID, m Meta) error
+}
+
+// Op describes an operation handed to the editing methods. Cbit is only
+// read for measurements; Cond and Meta are optional.
+type Op struct {
+	G      gate.Gate
+	Qubits []int
+	Cbit   int
+	Cond   *Condition
+	Meta   Meta
+}
+
+// CheckOp applies the checks of Append to op for a circuit of the given
+// width, without a DAG. Streaming writers use it to reject what a DAG
+// would.
+func CheckOp(op Op, qubits, clbits int) error {
+	if op.G == nil {
+		return fmt.Errorf("dag: Append called with nil gate")
+	}
+	d := &DAG{qubits: qubits, clbits: clbits}
+	if op.G.Name() == "MEASURE" {
+		if len(op.Qubits) != 1 || op.Qubits[0] < 0 || op.Qubits[0] >= qubits {
+			return ErrBadQubit
+		}
+		if op.Cbit < 0 || op.Cbit >= clbits {
+			return ErrBadClbit
+		}
+	} else if err := d.checkGate(op.G, op.Qubits); err != nil {
+		return err
+	}
+	if op.Cond != nil {
+		if err := d.checkCondition(*op.Cond); err != nil {
+			return err
+		}
+	}
+	return checkMeta(op.Meta)
+}
+
+// ErrNoNode is returned when an edit names a node that is not in the DAG.
+var ErrNoNode = fmt.Errorf("dag: no such node")
+
+// Node looks up a node by ID.
+func (d *DAG) Node(id NodeID) (*Node, bool) {
+	n, ok := d.nodes[id]
+	return n, ok
+}
+
+// Remove deletes a node; its predecessor and successor on each wire become
+// directly dependent.
+func (d *DAG) Remove(id NodeID) error {
+	_, err := d.Replace(id, nil)
+	return err
+}
+
+// Replace substitutes a node with a sequence of operations, which take its
+// place on every wire in the given order. The operations may only use the
+// qubits and classical bits of the node they replace; this is what keeps
+// the rewrite free of new dependencies and cycles. It returns the IDs of
+// the new nodes.
+func (d *DAG) Replace(id NodeID, ops []Op) ([]NodeID, error) {
+	old, ok := d.nodes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrNoNode, id)
+	}
+	seq, err := d.opNodes(old, ops)
+	if err != nil {
+		return nil, err
+	}
+	d.splice(old, seq)
+	ids := make([]NodeID, len(seq))
+	for i, n := range seq {
+		ids[i] = n.ID
+	}
+	return ids, nil
+}
+
+// InsertBefore adds op immediately before node id on the wires op uses,
+// which must be a subset of the node's wires.
+func (d *DAG) InsertBefore(id NodeID, op Op) (NodeID, error) { return d.insert(id, op, true) }
+
+// InsertAfter adds op immediately after node id; see InsertBefore.
+func (d *DAG) InsertAfter(id NodeID, op Op) (NodeID, error) { return d.insert(id, op, false) }
+
+func (d *DAG) insert(id NodeID, op Op, before bool) (NodeID, error) {
+	anchor, ok := d.nodes[id]
+	if !ok {
+		return 0, fmt.Errorf("%w: %d", ErrNoNode, id)
+	}
+	seq, err := d.opNodes(anchor, []Op{op})
+	if err != nil {
+		return 0, err
+	}
+	n := seq[0]
+	if before {
+		d.splice(anchor, []*Node{n, anchor})
+	} else {
+		d.splice(anchor, []*Node{anchor, n})
+	}
+	return n.ID, nil
+}
+
+// opNodes validates ops against the wires of the node they are anchored at
+// and turns them into unlinked nodes.
+func (d *DAG) opNodes(anchor *Node, ops []Op) ([]*Node, error) {
+	cbits := d.cbitWires(anchor)
+	seq := make([]*Node, 0, len(ops))
+	for i, op := range ops {
+		if op.G == nil {
+			return nil, fmt.Errorf("dag: op %d has no gate", i)
+		}
+		cb := -1
+		if op.G.Name() == "MEASURE" {
+			cb = op.Cbit
+		}
+		n, err := d.newNode(op.G, op.Qubits, cb)
+		if err != nil {
+			return nil, err
+		}
+		if op.Cond != nil {
+			if err := d.checkCondition(*op.Cond); err != nil {
+				return nil, err
+			}
+			c := *op.Cond
+			c.Cbits = append([]int(nil), op.Cond.Cbits...)
+			n.Cond = &c
+		}
+		if err := checkMeta(op.Meta); err != nil {
+			return nil, err
+		}
+		n.Meta = maps.Clone(op.Meta)
+		for _, q := range n.Qubits {
+			if !slices.Contains(anchor.Qubits, q) {
+				return nil, fmt.Errorf("dag: op %d (%s) uses qubit %d outside node %d's wires %v",
+					i, op.G.Name(), q, anchor.ID, anchor.Qubits)
+			}
+		}
+		for _, c := range d.cbitWires(n) {
+			if !slices.Contains(cbits, c) {
+				return nil, fmt.Errorf("dag: op %d (%s) uses cbit %d outside node %d's wires %v",
+					i, op.G.Name(), c, anchor.ID, cbits)
+			}
+		}
+		seq = append(seq, n)
+	}
+	return seq, nil
+}
+
+// splice puts seq (which may contain old itself) in old's place on every
+// wire of old, then rebuilds the edges.
+func (d *DAG) splice(old *Node, seq []*Node) {
+	replaceOn := func(list []NodeID, onWire func(*Node) bool) []NodeID {
+		i := slices.Index(list, old.ID)
+		var mid []NodeID
+		for _, n := range seq {
+			if onWire(n) {
+				mid = append(mid, n.ID)
+			}
+		}
+		return slices.Concat(list[:i], mid, list[i+1:])
+	}
+	for _, q := range old.Qubits {
+		d.byQ[q] = replaceOn(d.byQ[q], func(n *Node) bool { return slices.Contains(n.Qubits, q) })
+	}
+	for _, c := range d.cbitWires(old) {
+		d.byC[c] = replaceOn(d.byC[c], func(n *Node) bool { return slices.Contains(d.cbitWires(n), c) })
+	}
+	delete(d.nodes, old.ID)
+	for _, n := range seq {
+		d.nodes[n.ID] = n
+	}
+	d.relink()
+}
+
+// relink rebuilds every edge from the per-wire orders and, for a validated
+// DAG, the cached topological order and depth.
+func (d *DAG) relink() {
+	for _, n := range d.nodes {
+		n.parents, n.children = nil, nil
+	}
+	edge := func(list []NodeID) NodeID {
+		for i := 1; i < len(list); i++ {
+			p, c := d.nodes[list[i-1]], d.nodes[list[i]]
+			if !slices.Contains(c.parents, p.ID) {
+				c.parents = append(c.parents, p.ID)
+				p.children = append(p.children, c.ID)
+			}
+		}
+		if len(list) == 0 {
+			return 0
+		}
+		return list[len(list)-1]
+	}
+	for q, list := range d.byQ {
+		d.last[q] = edge(list)
+	}
+	for c, list := range d.byC {
+		d.lastC[c] = edge(list)
+	}
+	if d.valid {
+		d.topoOrder = d.calculateTopoSort()
+		d.depth = d.calculateDepth()
+	}
+}
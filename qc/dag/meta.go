@@ -0,0 +1,56 @@
+package dag
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Meta is opaque backend data attached to one operation, e.g. a pulse
+// calibration ID. qcm never interprets it, but every pass that copies or
+// rewrites an operation keeps it and the text and file formats store it,
+// so hardware backends get back what they put in. Keys and values must not
+// contain white space or '#', and keys no '='. An attached Meta is never
+// modified; SetMeta replaces it.
+type Meta map[string]string
+
+// checkMeta rejects metadata that the text format could not round-trip.
+func checkMeta(m Meta) error {
+	for k, v := range m {
+		if k == "" || strings.ContainsAny(k, " \t\n\r#=") || strings.ContainsAny(v, " \t\n\r#") {
+			return fmt.Errorf("dag: metadata %q=%q has an empty key or a forbidden character", k, v)
+		}
+	}
+	return nil
+}
+
+// SetMeta attaches m to node id, keeping any keys it already has that m
+// does not override. Metadata leaves the structure untouched, so a
+// validated DAG accepts it too.
+func (d *DAG) SetMeta(id NodeID, m Meta) error {
+	n, ok := d.nodes[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrNoNode, id)
+	}
+	if err := checkMeta(m); err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	merged := maps.Clone(n.Meta)
+	if merged == nil {
+		merged = make(Meta, len(m))
+	}
+	maps.Copy(merged, m)
+	n.Meta = merged
+	return nil
+}
+
+// AnnotateLast is SetMeta on the node added most recently.
+func (d *DAG) AnnotateLast(m Meta) error {
+	if d.lastNode == 0 {
+		return fmt.Errorf("dag: no operation to annotate")
+	}
+	return d.SetMeta(d.lastNode, m)
+}
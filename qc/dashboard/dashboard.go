@@ -0,0 +1,181 @@
+// Package dashboard draws live progress of running simulations in a
+// terminal: a progress bar per job with its rate, ETA and current most
+// frequent outcomes. Jobs are fed from SimulatorOptions.Progress, which
+// reports the chunks of a run as they complete.
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Dashboard redraws its jobs in place on a terminal. It is safe for
+// concurrent use.
+type Dashboard struct {
+	mu       sync.Mutex
+	w        io.Writer
+	jobs     []*Job
+	drawn    int // lines written by the last draw
+	last     time.Time
+	now      func() time.Time
+	Interval time.Duration // minimum time between redraws on progress
+	Width    int           // progress bar width in characters
+	Top      int           // outcomes listed per job
+}
+
+// New returns a dashboard writing to w, which should be a terminal that
+// understands ANSI cursor movement.
+func New(w io.Writer) *Dashboard {
+	return &Dashboard{w: w, now: time.Now, Interval: 100 * time.Millisecond, Width: 30, Top: 3}
+}
+
+// Job is one run on the dashboard.
+type Job struct {
+	d       *Dashboard
+	name    string
+	shots   int
+	done    int
+	counts  map[string]int
+	start   time.Time
+	elapsed time.Duration // set when finished
+	err     error
+	over    bool
+}
+
+// Job adds a run of the given number of shots and starts its clock.
+func (d *Dashboard) Job(name string, shots int) *Job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	j := &Job{d: d, name: name, shots: shots, counts: map[string]int{}, start: d.now()}
+	d.jobs = append(d.jobs, j)
+	return j
+}
+
+// Progress records a finished chunk; it has the signature of
+// SimulatorOptions.Progress. The dashboard redraws at most once per
+// Interval.
+func (j *Job) Progress(ch simulator.ChunkResult) {
+	d := j.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	j.done += ch.Shots
+	for k, n := range ch.Counts {
+		j.counts[k] += n
+	}
+	if now := d.now(); now.Sub(d.last) >= d.Interval {
+		d.draw(now)
+	}
+}
+
+// Finish marks the job done with its final histogram (which replaces the
+// counts gathered from chunks, as some runs report none) or its error, and
+// redraws.
+func (j *Job) Finish(hist map[string]int, err error) {
+	d := j.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	j.over, j.err = true, err
+	j.elapsed = d.now().Sub(j.start)
+	if err == nil {
+		j.counts = maps.Clone(hist)
+		j.done = 0
+		for _, n := range hist {
+			j.done += n
+		}
+	}
+	d.draw(d.now())
+}
+
+// Draw redraws every job now.
+func (d *Dashboard) Draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draw(d.now())
+}
+
+func (d *Dashboard) draw(now time.Time) {
+	d.last = now
+	var sb strings.Builder
+	if d.drawn > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", d.drawn) // back to the first line
+	}
+	sb.WriteString("\x1b[J") // clear to the end of the screen
+	for _, j := range d.jobs {
+		sb.WriteString(j.line(now))
+		sb.WriteByte('\n')
+	}
+	d.drawn = len(d.jobs)
+	io.WriteString(d.w, sb.String())
+}
+
+// line renders one job:
+//
+//	name [#######.......]  48% 4928/10240  9.8k shots/s  ETA 0.5s  01 50.1%  10 49.9%
+func (j *Job) line(now time.Time) string {
+	d := j.d
+	frac := 0.0
+	if j.shots > 0 {
+		frac = min(float64(j.done)/float64(j.shots), 1)
+	}
+	filled := int(frac * float64(d.Width))
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", d.Width-filled)
+
+	elapsed := now.Sub(j.start)
+	if j.over {
+		elapsed = j.elapsed
+	}
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(j.done) / elapsed.Seconds()
+	}
+	status := "ETA -"
+	switch {
+	case j.err != nil:
+		status = "FAILED: " + j.err.Error()
+	case j.over:
+		status = "done in " + round(elapsed).String()
+	case rate > 0:
+		status = "ETA " + round(time.Duration(float64(j.shots-j.done)/rate*float64(time.Second))).String()
+	}
+
+	out := fmt.Sprintf("%s [%s] %3.0f%% %d/%d  %s shots/s  %s", j.name, bar, 100*frac, j.done, j.shots, si(rate), status)
+	if j.err == nil && j.done > 0 {
+		keys := slices.SortedFunc(maps.Keys(j.counts), func(a, b string) int {
+			if j.counts[a] != j.counts[b] {
+				return j.counts[b] - j.counts[a]
+			}
+			return strings.Compare(a, b)
+		})
+		for _, k := range keys[:min(d.Top, len(keys))] {
+			out += fmt.Sprintf("  %s %.1f%%", k, 100*float64(j.counts[k])/float64(j.done))
+		}
+	}
+	return out
+}
+
+// round keeps durations readable: milliseconds below a minute, seconds
+// above.
+func round(d time.Duration) time.Duration {
+	if d < time.Minute {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+// si formats a rate with a k or M suffix.
+func si(v float64) string {
+	switch {
+	case v >= 1e6:
+		return fmt.Sprintf("%.1fM", v/1e6)
+	case v >= 1e3:
+		return fmt.Sprintf("%.1fk", v/1e3)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
@@ -0,0 +1,68 @@
+package dashboard
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	d := New(&out)
+	d.Width = 10
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return clock }
+
+	bell := d.Job("bell", 1000)
+	ghz := d.Job("ghz", 100)
+	clock = clock.Add(time.Second)
+	bell.Progress(simulator.ChunkResult{Shots: 500, Counts: map[string]int{"00": 240, "11": 260}})
+	assert.Equal("\x1b[J"+
+		"bell [#####.....]  50% 500/1000  500 shots/s  ETA 1s  11 52.0%  00 48.0%\n"+
+		"ghz [..........]   0% 0/100  0 shots/s  ETA -\n", out.String())
+
+	// Progress within Interval of the last draw only updates the counts.
+	out.Reset()
+	clock = clock.Add(10 * time.Millisecond)
+	bell.Progress(simulator.ChunkResult{Shots: 250, Counts: map[string]int{"00": 250}})
+	assert.Empty(out.String())
+
+	clock = clock.Add(490 * time.Millisecond)
+	ghz.Finish(nil, errors.New("boom"))
+	bell.Finish(map[string]int{"00": 600, "11": 400}, nil)
+	lines := strings.Split(out.String(), "\x1b[2A\x1b[J")
+	assert.Len(lines, 3, "each redraw moves back over both jobs")
+	assert.Equal("bell [##########] 100% 1000/1000  667 shots/s  done in 1.5s  00 60.0%  11 40.0%\n"+
+		"ghz [..........]   0% 0/100  0 shots/s  FAILED: boom\n", lines[2])
+}
+
+func TestDashboard_Simulator(t *testing.T) {
+	b := builder.New(builder.Q(2), builder.C(2))
+	// A conditional gate keeps the run off the statevector sampling path,
+	// so the shots run in seeded chunks.
+	b.H(0).Measure(0, 0).If(builder.Bit(0), func(b builder.Builder) { b.X(1) }).Measure(1, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	d := New(&out)
+	d.Interval = 0
+	job := d.Job("bell", 256)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 256, Runner: qsim.NewQSimRunner(),
+		Seed: 7, NoShortcut: true, Progress: job.Progress})
+	hist, err := sim.RunParallelChan(c)
+	job.Finish(hist, err)
+	require.NoError(t, err)
+	assert.Equal(t, 256/64+1, strings.Count(out.String(), "\x1b[J"), "one draw per chunk and one at the end")
+	assert.Contains(t, out.String(), "256/256")
+}
@@ -0,0 +1,94 @@
+package decompose
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Controlled returns g controlled on nControls extra qubits, as a composite
+// acting on the controls 0..nControls-1 followed by g's own qubits. Every
+// primitive inside g is replaced by its controlled form, expanded without
+// ancillas as in MCX with the Recursive strategy, so the result runs on any
+// backend. Composite gates, e.g. from builder.DefineGate, are controlled
+// step by step.
+func Controlled(g gate.Gate, nControls int) (*gate.Composite, error) {
+	if nControls < 1 {
+		return nil, fmt.Errorf("decompose: %s needs at least one control, got %d", g.Name(), nControls)
+	}
+	controls := span(0, nControls)
+	var e emitter
+	err := gate.Expand(g, span(nControls, g.QubitSpan()), func(p gate.Gate, qs []int) error {
+		return e.controlled(controls, p, qs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	name := strings.Repeat("C", nControls) + g.Name()
+	if gate.Reserved(name) {
+		// CX, CZ, CCX, CSWAP, … name built-in gates.
+		name = fmt.Sprintf("C%d-%s", nControls, g.Name())
+	}
+	return gate.NewComposite(name, nControls+g.QubitSpan(), e.steps)
+}
+
+// controlled emits primitive g on qs controlled on controls. Uncontrolled
+// basis changes around a controlled core cancel when the controls are off.
+func (e *emitter) controlled(controls []int, g gate.Gate, qs []int) error {
+	with := func(extra ...int) []int {
+		return append(append([]int(nil), controls...), extra...)
+	}
+	angle := func() float64 { return g.(gate.Parametric).Params()[0] }
+
+	switch g.Name() {
+	case "X", "CNOT", "TOFFOLI":
+		e.mcx(with(qs[:len(qs)-1]...), qs[len(qs)-1])
+	case "Z", "CZ":
+		e.mcp(math.Pi, with(qs...))
+	case "S":
+		e.mcp(math.Pi/2, with(qs...))
+	case "P", "CP":
+		e.mcp(angle(), with(qs...))
+	case "Y":
+		// Y = S·X·S†
+		t := qs[0]
+		e.add(gate.P(-math.Pi/2), t)
+		e.mcx(controls, t)
+		e.add(gate.S(), t)
+	case "H":
+		// H = RY(π/4)·Z·RY(-π/4)
+		t := qs[0]
+		e.add(gate.RY(-math.Pi/4), t)
+		e.mcp(math.Pi, with(t))
+		e.add(gate.RY(math.Pi/4), t)
+	case "RY", "RZ":
+		// X·R(-θ/2)·X = R(θ/2) for rotations about Y and Z.
+		t, theta := qs[0], angle()
+		rot := gate.RY
+		if g.Name() == "RZ" {
+			rot = gate.RZ
+		}
+		e.add(rot(theta/2), t)
+		e.mcx(controls, t)
+		e.add(rot(-theta/2), t)
+		e.mcx(controls, t)
+	case "RX":
+		t := qs[0]
+		e.add(gate.H(), t)
+		if err := e.controlled(controls, gate.RZ(angle()), qs); err != nil {
+			return err
+		}
+		e.add(gate.H(), t)
+	case "SWAP", "FREDKIN":
+		// A controlled swap is a CNOT sandwich around a Toffoli-like core.
+		a, b := qs[len(qs)-2], qs[len(qs)-1]
+		e.add(gate.CNOT(), b, a)
+		e.mcx(with(append(qs[:len(qs)-2:len(qs)-2], a)...), b)
+		e.add(gate.CNOT(), b, a)
+	default:
+		return fmt.Errorf("decompose: cannot control gate %s", g.Name())
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package decompose rewrites high-level gates into the primitive gate set
+// understood by every runner.
+package decompose
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Strategy selects how MCX trades ancilla qubits for gate count.
+type Strategy int
+
+const (
+	// VChain computes the AND of the controls into n-2 clean ancillas with a
+	// ladder of Toffolis, flips the target and uncomputes the ladder. It uses
+	// only classical reversible gates, so builder.CheckAncillas can verify it.
+	VChain Strategy = iota
+	// RelativePhase is VChain with the ladder built from relative-phase
+	// Toffolis (three CNOTs each instead of six). Their phases cancel on
+	// uncompute, so the result is still exact.
+	RelativePhase
+	// Recursive needs no ancillas. The controls are split recursively and
+	// the idle wires of each step are borrowed as dirty ancillas, for
+	// O(n²) gates.
+	Recursive
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case VChain:
+		return "v-chain"
+	case RelativePhase:
+		return "relative-phase"
+	case Recursive:
+		return "recursive"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// Ancillas returns the number of clean ancillas MCX needs for nControls
+// controls with strategy s.
+func Ancillas(nControls int, s Strategy) int {
+	if s == Recursive || nControls < 3 {
+		return 0
+	}
+	return nControls - 2
+}
+
+// Choose picks the cheapest strategy for nControls controls given the
+// number of clean ancillas available.
+func Choose(nControls, ancillas int) Strategy {
+	if ancillas >= Ancillas(nControls, RelativePhase) {
+		return RelativePhase
+	}
+	return Recursive
+}
+
+// MCX returns an X gate controlled on nControls qubits as a composite of
+// X, H, P, CNOT, CP and Toffoli gates. The composite acts on the controls
+// 0..nControls-1, the target nControls and then Ancillas(nControls, s)
+// ancillas, which must start in |0⟩ and are returned to it.
+func MCX(nControls int, s Strategy) (*gate.Composite, error) {
+	if nControls < 0 {
+		return nil, fmt.Errorf("decompose: MCX needs a non-negative number of controls, got %d", nControls)
+	}
+	controls := span(0, nControls)
+	target := nControls
+	ancillas := span(nControls+1, Ancillas(nControls, s))
+
+	var e emitter
+	switch s {
+	case VChain:
+		e.vchain(controls, target, ancillas, toffoli)
+	case RelativePhase:
+		e.vchain(controls, target, ancillas, rccx)
+	case Recursive:
+		e.mcx(controls, target)
+	default:
+		return nil, fmt.Errorf("decompose: unknown MCX strategy %v", s)
+	}
+	return gate.NewComposite("MCX", nControls+1+len(ancillas), e.steps)
+}
+
+// emitter accumulates composite steps.
+type emitter struct {
+	steps []gate.Step
+}
+
+func (e *emitter) add(g gate.Gate, qs ...int) {
+	e.steps = append(e.steps, gate.Step{G: g, Qubits: qs})
+}
+
+func toffoli(e *emitter, a, b, t int) { e.add(gate.Toffoli(), a, b, t) }
+
+// rccx is a Toffoli up to phases on the control states, which cancel when
+// it is undone by a second rccx (it is its own inverse).
+func rccx(e *emitter, a, b, t int) {
+	e.add(gate.H(), t)
+	e.add(gate.P(math.Pi/4), t)
+	e.add(gate.CNOT(), b, t)
+	e.add(gate.P(-math.Pi/4), t)
+	e.add(gate.CNOT(), a, t)
+	e.add(gate.P(math.Pi/4), t)
+	e.add(gate.CNOT(), b, t)
+	e.add(gate.P(-math.Pi/4), t)
+	e.add(gate.H(), t)
+}
+
+// small emits X, CNOT or Toffoli for at most two controls and reports
+// whether it did.
+func (e *emitter) small(controls []int, target int) bool {
+	switch len(controls) {
+	case 0:
+		e.add(gate.X(), target)
+	case 1:
+		e.add(gate.CNOT(), controls[0], target)
+	case 2:
+		e.add(gate.Toffoli(), controls[0], controls[1], target)
+	default:
+		return false
+	}
+	return true
+}
+
+// vchain computes the AND of controls into the clean ancillas with ladder,
+// applies the final Toffoli onto target and uncomputes the ladder.
+func (e *emitter) vchain(controls []int, target int, ancillas []int, ladder func(*emitter, int, int, int)) {
+	if e.small(controls, target) {
+		return
+	}
+	n := len(controls)
+	ladder(e, controls[0], controls[1], ancillas[0])
+	for i := 2; i < n-1; i++ {
+		ladder(e, controls[i], ancillas[i-2], ancillas[i-1])
+	}
+	e.add(gate.Toffoli(), controls[n-1], ancillas[n-3], target)
+	// Both ladder gates are their own inverse.
+	for i := n - 2; i >= 2; i-- {
+		ladder(e, controls[i], ancillas[i-2], ancillas[i-1])
+	}
+	ladder(e, controls[0], controls[1], ancillas[0])
+}
+
+// dirty flips target when all controls are 1 using len(controls)-2 borrowed
+// qubits in any state, which are restored (Barenco et al., Lemma 7.2).
+func (e *emitter) dirty(controls []int, target int, borrowed []int) {
+	if e.small(controls, target) {
+		return
+	}
+	n := len(controls)
+	down := func() {
+		for i := n - 2; i >= 2; i-- {
+			e.add(gate.Toffoli(), controls[i], borrowed[i-2], borrowed[i-1])
+		}
+	}
+	up := func() {
+		for i := 2; i <= n-2; i++ {
+			e.add(gate.Toffoli(), controls[i], borrowed[i-2], borrowed[i-1])
+		}
+	}
+	for range 2 {
+		e.add(gate.Toffoli(), controls[n-1], borrowed[n-3], target)
+		down()
+		e.add(gate.Toffoli(), controls[0], controls[1], borrowed[0])
+		up()
+	}
+}
+
+// borrowed flips target when all controls are 1 using a single borrowed
+// qubit spare, by splitting the controls in two halves that each borrow
+// the other half's wires (Barenco et al., Lemma 7.3).
+func (e *emitter) borrowed(controls []int, target, spare int) {
+	if e.small(controls, target) {
+		return
+	}
+	m := (len(controls) + 1) / 2
+	lo, hi := controls[:m], controls[m:]
+	loFree := append(append([]int(nil), hi...), target)
+	hiCtrl := append(append([]int(nil), hi...), spare)
+	for range 2 {
+		e.dirty(lo, spare, loFree)
+		e.dirty(hiCtrl, target, lo)
+	}
+}
+
+// mcx flips target when all controls are 1 without ancillas.
+func (e *emitter) mcx(controls []int, target int) {
+	if e.small(controls, target) {
+		return
+	}
+	e.add(gate.H(), target)
+	e.mcp(math.Pi, append(append([]int(nil), controls...), target))
+	e.add(gate.H(), target)
+}
+
+// mcp applies the phase e^{iθ} when all qubits are 1 (Barenco et al.,
+// Lemma 7.5, with the square roots of X written as phases).
+func (e *emitter) mcp(theta float64, qubits []int) {
+	k := len(qubits)
+	switch k {
+	case 1:
+		e.add(gate.P(theta), qubits[0])
+		return
+	case 2:
+		e.add(gate.CP(theta), qubits[0], qubits[1])
+		return
+	}
+	rest, b, t := qubits[:k-2], qubits[k-2], qubits[k-1]
+	e.add(gate.CP(theta/2), b, t)
+	e.borrowed(rest, b, t)
+	e.add(gate.CP(-theta/2), b, t)
+	e.borrowed(rest, b, t)
+	e.mcp(theta/2, append(append([]int(nil), rest...), t))
+}
+
+// span returns from..from+n-1.
+func span(from, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = from + i
+	}
+	return s
+}
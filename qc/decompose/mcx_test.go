@@ -0,0 +1,203 @@
+package decompose
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apply evolves a dense statevector (qubit i is bit i of the index) through
+// a primitive gate.
+func apply(t *testing.T, sv []complex128, g gate.Gate, qs []int) {
+	bit := func(i, q int) bool { return i&(1<<q) != 0 }
+	on := func(i int, ctrls []int) bool {
+		for _, c := range ctrls {
+			if !bit(i, c) {
+				return false
+			}
+		}
+		return true
+	}
+	if g.Name() == "SWAP" || g.Name() == "FREDKIN" {
+		a, b := qs[len(qs)-2], qs[len(qs)-1]
+		for i := range sv {
+			if on(i, qs[:len(qs)-2]) && bit(i, a) && !bit(i, b) {
+				j := i ^ (1 << a) ^ (1 << b)
+				sv[i], sv[j] = sv[j], sv[i]
+			}
+		}
+		return
+	}
+
+	var ctrls []int
+	for _, c := range g.Controls() {
+		ctrls = append(ctrls, qs[c])
+	}
+	tq := qs[g.Targets()[0]]
+	var theta float64
+	if p, ok := g.(gate.Parametric); ok {
+		theta = p.Params()[0]
+	}
+	c, s := complex(math.Cos(theta/2), 0), complex(math.Sin(theta/2), 0)
+	var m [2][2]complex128
+	switch g.Name() {
+	case "H":
+		m = [2][2]complex128{{1 / math.Sqrt2, 1 / math.Sqrt2}, {1 / math.Sqrt2, -1 / math.Sqrt2}}
+	case "X", "CNOT", "TOFFOLI":
+		m = [2][2]complex128{{0, 1}, {1, 0}}
+	case "Y":
+		m = [2][2]complex128{{0, -1i}, {1i, 0}}
+	case "Z", "CZ":
+		m = [2][2]complex128{{1, 0}, {0, -1}}
+	case "S":
+		m = [2][2]complex128{{1, 0}, {0, 1i}}
+	case "P", "CP":
+		m = [2][2]complex128{{1, 0}, {0, cmplx.Exp(complex(0, theta))}}
+	case "RX":
+		m = [2][2]complex128{{c, -1i * s}, {-1i * s, c}}
+	case "RY":
+		m = [2][2]complex128{{c, -s}, {s, c}}
+	case "RZ":
+		m = [2][2]complex128{{cmplx.Exp(complex(0, -theta/2)), 0}, {0, cmplx.Exp(complex(0, theta/2))}}
+	default:
+		t.Fatalf("unexpected gate %s", g.Name())
+	}
+	for i := range sv {
+		if !bit(i, tq) && on(i, ctrls) {
+			j := i | 1<<tq
+			a, b := sv[i], sv[j]
+			sv[i], sv[j] = m[0][0]*a+m[0][1]*b, m[1][0]*a+m[1][1]*b
+		}
+	}
+}
+
+// run applies g, expanded to primitives, to the basis state in of a w-qubit
+// register.
+func run(t *testing.T, g gate.Gate, qs []int, w, in int) []complex128 {
+	sv := make([]complex128, 1<<w)
+	sv[in] = 1
+	require.NoError(t, gate.Expand(g, qs, func(p gate.Gate, pq []int) error {
+		apply(t, sv, p, pq)
+		return nil
+	}))
+	return sv
+}
+
+// checkMCX runs every basis input of the controls and target through g with
+// the ancillas in |0⟩ and expects exactly the flipped basis state back.
+func checkMCX(t *testing.T, g *gate.Composite, n int) {
+	w := g.QubitSpan()
+	all := 1<<(n+1) - 1
+	for in := range 1 << (n + 1) {
+		sv := run(t, g, span(0, w), w, in)
+		want := in
+		if in|1<<n == all {
+			want ^= 1 << n
+		}
+		for i, a := range sv {
+			exp := complex(0, 0)
+			if i == want {
+				exp = 1
+			}
+			if cmplx.Abs(a-exp) > 1e-9 {
+				t.Fatalf("input %0*b: amplitude of %0*b is %v, want %v", n+1, in, w, i, a, exp)
+			}
+		}
+	}
+}
+
+func TestMCX(t *testing.T) {
+	for _, s := range []Strategy{VChain, RelativePhase, Recursive} {
+		for n := range 7 {
+			t.Run(fmt.Sprintf("%v/%d", s, n), func(t *testing.T) {
+				g, err := MCX(n, s)
+				require.NoError(t, err)
+				assert.Equal(t, n+1+Ancillas(n, s), g.QubitSpan())
+				checkMCX(t, g, n)
+			})
+		}
+	}
+}
+
+func TestMCX_Strategies(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0, Ancillas(2, VChain))
+	assert.Equal(3, Ancillas(5, VChain))
+	assert.Equal(3, Ancillas(5, RelativePhase))
+	assert.Equal(0, Ancillas(5, Recursive))
+
+	assert.Equal(RelativePhase, Choose(5, 3))
+	assert.Equal(Recursive, Choose(5, 2))
+	assert.Equal(RelativePhase, Choose(2, 0))
+
+	count := func(s Strategy, name string) int {
+		g, err := MCX(5, s)
+		require.NoError(t, err)
+		k := 0
+		for _, st := range g.Steps() {
+			if st.G.Name() == name {
+				k++
+			}
+		}
+		return k
+	}
+	assert.Equal(7, count(VChain, "TOFFOLI"))
+	assert.Equal(1, count(RelativePhase, "TOFFOLI"), "only the middle Toffoli stays exact")
+	assert.Equal(0, count(Recursive, "H")%2)
+
+	_, err := MCX(-1, VChain)
+	assert.Error(err)
+	_, err = MCX(3, Strategy(9))
+	assert.ErrorContains(err, "Strategy(9)")
+}
+
+func TestControlled(t *testing.T) {
+	qft2, err := gate.NewComposite("QFT2", 2, []gate.Step{
+		{G: gate.H(), Qubits: []int{1}},
+		{G: gate.CP(math.Pi / 2), Qubits: []int{0, 1}},
+		{G: gate.H(), Qubits: []int{0}},
+		{G: gate.Swap(), Qubits: []int{0, 1}},
+	})
+	require.NoError(t, err)
+	gates := []gate.Gate{
+		gate.H(), gate.X(), gate.Y(), gate.Z(), gate.S(), gate.P(0.7),
+		gate.RX(1.1), gate.RY(-0.4), gate.RZ(2.3),
+		gate.CNOT(), gate.CZ(), gate.CP(-1.3), gate.Swap(), gate.Toffoli(), gate.Fredkin(),
+		qft2,
+	}
+	for _, g := range gates {
+		for _, n := range []int{1, 3} {
+			t.Run(fmt.Sprintf("%s/%d", g.Name(), n), func(t *testing.T) {
+				cg, err := Controlled(g, n)
+				require.NoError(t, err)
+				require.False(t, gate.Reserved(cg.Name()), "%s must not play as a built-in gate", cg.Name())
+				w := n + g.QubitSpan()
+				require.Equal(t, w, cg.QubitSpan())
+				for in := range 1 << w {
+					got := run(t, cg, span(0, w), w, in)
+					want := make([]complex128, 1<<w)
+					want[in] = 1
+					if in&(1<<n-1) == 1<<n-1 {
+						want = run(t, g, span(n, g.QubitSpan()), w, in)
+					}
+					for i := range got {
+						if cmplx.Abs(got[i]-want[i]) > 1e-9 {
+							t.Fatalf("input %0*b: amplitude of %0*b is %v, want %v", w, in, w, i, got[i], want[i])
+						}
+					}
+				}
+			})
+		}
+	}
+
+	_, err = Controlled(gate.H(), 0)
+	assert.Error(t, err)
+	_, err = Controlled(gate.Measure(), 1)
+	assert.ErrorContains(t, err, "MEASURE")
+}
@@ -0,0 +1,325 @@
+// Package dsl implements a small line-oriented text format for circuits.
+//
+// One statement per line; '#' starts a comment:
+//
+//	# Bell pair
+//	qreg q 2
+//	creg c 2
+//	h q[0]
+//	cx q[0] q[1]
+//	measure q[0] -> c[0]
+//	measure q[1] -> c[1]
+//
+// Statements:
+//
+//	qreg <name> <size>      declare a quantum register (registers are laid out in order)
+//	creg <name> <size>      declare a classical register
+//	include "<path>"        splice another file in place (paths are relative to the includer)
+//	<gate> <q>...           apply any gate known to gate.Factory
+//	measure <q> -> <c>      measure a qubit into a classical bit
+//
+// Operands are either register references (q[1]) or absolute indices (1).
+// Gates and measurements may end with @key=value fields, kept as opaque
+// backend metadata (see builder.Builder.Annotate):
+//
+//	x q[0] @cal=x_q0_v2
+package dsl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Register is a named, contiguous slice of the qubit or classical bit space.
+type Register struct {
+	Name  string
+	Start int // absolute index of element 0
+	Size  int
+}
+
+// Instruction is one parsed gate or measurement with absolute indices.
+type Instruction struct {
+	G      gate.Gate
+	Qubits []int
+	Cbit   int               // -1 unless G is a measurement
+	Meta   map[string]string // @key=value fields; nil if none
+	Pos    string            // "file:line" the instruction came from
+}
+
+// Program is the parsed form of a DSL source.
+type Program struct {
+	QRegs []Register
+	CRegs []Register
+	Ops   []Instruction
+}
+
+// Qubits returns the total width of all quantum registers.
+func (p *Program) Qubits() int { return total(p.QRegs) }
+
+// Clbits returns the total width of all classical registers.
+func (p *Program) Clbits() int { return total(p.CRegs) }
+
+// Builder replays the program into a fresh builder, so callers can keep
+// adding operations before building. Classical registers keep their names.
+func (p *Program) Builder() builder.Builder {
+	opts := []builder.Option{builder.Q(p.Qubits())}
+	for _, r := range p.CRegs {
+		opts = append(opts, builder.CReg(r.Name, r.Size))
+	}
+	b := builder.New(opts...)
+	for _, in := range p.Ops {
+		if in.G.Name() == "MEASURE" {
+			b.Measure(in.Qubits[0], in.Cbit)
+		} else {
+			b.Apply(in.G, in.Qubits...)
+		}
+		if in.Meta != nil {
+			b.Annotate(in.Meta)
+		}
+	}
+	return b
+}
+
+// Circuit builds the program into an immutable circuit.
+func (p *Program) Circuit() (circuit.Circuit, error) { return p.Builder().BuildCircuit() }
+
+// ParseError locates a syntax or semantic error in the source.
+type ParseError struct {
+	Pos string // "file:line"
+	Msg string
+}
+
+func (e *ParseError) Error() string { return "dsl: " + e.Pos + ": " + e.Msg }
+
+// Parse reads a program from r. Include statements are resolved against the
+// current working directory.
+func Parse(r io.Reader) (*Program, error) {
+	return parse(os.DirFS("."), "<input>", r)
+}
+
+// ParseFile reads the program stored at name on the local filesystem.
+func ParseFile(name string) (*Program, error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	return ParseFS(os.DirFS(dir), base)
+}
+
+// ParseFS reads the program stored at name inside fsys; includes are
+// resolved inside the same file system.
+func ParseFS(fsys fs.FS, name string) (*Program, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("dsl: %w", err)
+	}
+	defer f.Close()
+	return parse(fsys, name, f)
+}
+
+// ParseString is Parse for in-memory sources.
+func ParseString(src string) (*Program, error) { return Parse(strings.NewReader(src)) }
+
+// ---------------------------- parser ---------------------------------
+
+type parser struct {
+	fsys   fs.FS
+	prog   *Program
+	active map[string]bool // files currently being parsed, for cycle detection
+}
+
+func parse(fsys fs.FS, name string, r io.Reader) (*Program, error) {
+	p := &parser{fsys: fsys, prog: &Program{}, active: map[string]bool{}}
+	if err := p.file(name, r); err != nil {
+		return nil, err
+	}
+	return p.prog, nil
+}
+
+func (p *parser) file(name string, r io.Reader) error {
+	p.active[name] = true
+	defer delete(p.active, name)
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		pos := name + ":" + strconv.Itoa(line)
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := p.statement(name, pos, fields); err != nil {
+			if _, ok := err.(*ParseError); ok {
+				return err
+			}
+			return &ParseError{Pos: pos, Msg: err.Error()}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("dsl: reading %s: %w", name, err)
+	}
+	return nil
+}
+
+func (p *parser) statement(file, pos string, f []string) error {
+	switch strings.ToLower(f[0]) {
+	case "qreg", "creg":
+		return p.declare(strings.ToLower(f[0]), f[1:])
+	case "include":
+		return p.include(file, f[1:])
+	}
+
+	meta := map[string]string(nil)
+	for len(f) > 1 && strings.HasPrefix(f[len(f)-1], "@") {
+		k, v, ok := strings.Cut(f[len(f)-1][1:], "=")
+		if !ok || k == "" {
+			return fmt.Errorf("bad metadata %q, want @key=value", f[len(f)-1])
+		}
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		if _, dup := meta[k]; !dup {
+			meta[k] = v // the rightmost field wins
+		}
+		f = f[:len(f)-1]
+	}
+	n := len(p.prog.Ops)
+	var err error
+	switch strings.ToLower(f[0]) {
+	case "measure", "meas", "m":
+		err = p.measure(pos, f[1:])
+	default:
+		err = p.gate(pos, f)
+	}
+	if err == nil && meta != nil {
+		p.prog.Ops[n].Meta = meta
+	}
+	return err
+}
+
+func (p *parser) gate(pos string, f []string) error {
+	g, err := gate.Factory(f[0])
+	if err != nil {
+		return err
+	}
+	args := f[1:]
+	if len(args) != g.QubitSpan() {
+		return fmt.Errorf("%s takes %d qubit(s), got %d", g.Name(), g.QubitSpan(), len(args))
+	}
+	qs := make([]int, len(args))
+	for i, a := range args {
+		if qs[i], err = resolve(a, p.prog.QRegs); err != nil {
+			return err
+		}
+	}
+	p.prog.Ops = append(p.prog.Ops, Instruction{G: g, Qubits: qs, Cbit: -1, Pos: pos})
+	return nil
+}
+
+func (p *parser) declare(kind string, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s <name> <size>", kind)
+	}
+	name := args[0]
+	size, err := strconv.Atoi(args[1])
+	if err != nil || size < 1 {
+		return fmt.Errorf("%s %s: size must be a positive integer, got %q", kind, name, args[1])
+	}
+	regs := &p.prog.QRegs
+	if kind == "creg" {
+		regs = &p.prog.CRegs
+	}
+	for _, r := range *regs {
+		if r.Name == name {
+			return fmt.Errorf("%s %s declared twice", kind, name)
+		}
+	}
+	*regs = append(*regs, Register{Name: name, Start: total(*regs), Size: size})
+	return nil
+}
+
+func (p *parser) include(file string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(`usage: include "<path>"`)
+	}
+	target, err := strconv.Unquote(args[0])
+	if err != nil {
+		target = args[0]
+	}
+	target = path.Join(path.Dir(file), target)
+	if p.active[target] {
+		return fmt.Errorf("include cycle through %s", target)
+	}
+	f, err := p.fsys.Open(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.file(target, f)
+}
+
+func (p *parser) measure(pos string, args []string) error {
+	if len(args) == 3 && args[1] == "->" {
+		args = []string{args[0], args[2]}
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: measure <qubit> -> <cbit>")
+	}
+	q, err := resolve(args[0], p.prog.QRegs)
+	if err != nil {
+		return err
+	}
+	c, err := resolve(args[1], p.prog.CRegs)
+	if err != nil {
+		return err
+	}
+	p.prog.Ops = append(p.prog.Ops, Instruction{G: gate.Measure(), Qubits: []int{q}, Cbit: c, Pos: pos})
+	return nil
+}
+
+// resolve turns "name[i]" or "i" into an absolute index within regs.
+func resolve(arg string, regs []Register) (int, error) {
+	name, rest, indexed := strings.Cut(arg, "[")
+	if !indexed {
+		i, err := strconv.Atoi(arg)
+		if err != nil || i < 0 {
+			return 0, fmt.Errorf("bad operand %q", arg)
+		}
+		if i >= total(regs) {
+			return 0, fmt.Errorf("index %d out of range (%d declared)", i, total(regs))
+		}
+		return i, nil
+	}
+	idx, err := strconv.Atoi(strings.TrimSuffix(rest, "]"))
+	if err != nil || !strings.HasSuffix(rest, "]") {
+		return 0, fmt.Errorf("bad operand %q", arg)
+	}
+	for _, r := range regs {
+		if r.Name == name {
+			if idx < 0 || idx >= r.Size {
+				return 0, fmt.Errorf("%s out of range (size %d)", arg, r.Size)
+			}
+			return r.Start + idx, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown register %q", name)
+}
+
+func total(regs []Register) int {
+	n := 0
+	for _, r := range regs {
+		n += r.Size
+	}
+	return n
+}
@@ -0,0 +1,238 @@
+package dsl
+
+import (
+	"math/rand"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kegliz/qcm/qc/bitorder"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+	_ "github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bellSrc = `
+# Bell pair with named registers
+qreg data 2
+qreg anc 1
+creg out 2
+
+h data[0]
+cx data[0] data[1]   # entangle
+x 2
+measure data[0] -> out[0]
+measure data[1] out[1]
+`
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p, err := ParseString(bellSrc)
+	require.NoError(err)
+	assert.Equal(3, p.Qubits())
+	assert.Equal(2, p.Clbits())
+	assert.Equal([]Register{{"data", 0, 2}, {"anc", 2, 1}}, p.QRegs)
+	require.Len(p.Ops, 5)
+	assert.Same(gate.CNOT(), p.Ops[1].G)
+	assert.Equal([]int{0, 1}, p.Ops[1].Qubits)
+	assert.Equal([]int{2}, p.Ops[2].Qubits)
+	assert.Equal(1, p.Ops[4].Cbit)
+	assert.Equal("<input>:8", p.Ops[1].Pos)
+
+	c, err := p.Circuit()
+	require.NoError(err)
+	assert.Equal(3, c.Qubits())
+	assert.Len(c.Operations(), 5)
+	assert.Equal("out", c.CRegs()[0].Name, "classical register names survive into the circuit")
+	src, err := Format(c)
+	require.NoError(err)
+	assert.Contains(src, "creg out 2\n")
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"UnknownGate", "qreg q 1\nfoo q[0]", "<input>:2: qcircuit: unknown gate foo"},
+		{"Arity", "qreg q 2\ncx q[0]", "CNOT takes 2 qubit(s), got 1"},
+		{"UnknownRegister", "qreg q 1\nh r[0]", `unknown register "r"`},
+		{"OutOfRange", "qreg q 1\nh q[1]", "q[1] out of range"},
+		{"AbsoluteOutOfRange", "qreg q 1\nh 3", "index 3 out of range"},
+		{"Redeclared", "qreg q 1\nqreg q 2", "declared twice"},
+		{"BadSize", "qreg q zero", "size must be a positive integer"},
+		{"MeasureSyntax", "qreg q 1\ncreg c 1\nmeasure q[0] => c[0]", "usage: measure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseString(tt.src)
+			var perr *ParseError
+			require.ErrorAs(t, err, &perr)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestParse_Include(t *testing.T) {
+	require := require.New(t)
+	fsys := fstest.MapFS{
+		"main.qcm":       {Data: []byte("include \"lib/regs.qcm\"\nh q[0]\ninclude \"lib/ent.qcm\"\n")},
+		"lib/regs.qcm":   {Data: []byte("qreg q 2\ncreg c 2\n")},
+		"lib/ent.qcm":    {Data: []byte("cx q[0] q[1]\n")},
+		"loop.qcm":       {Data: []byte("include \"loop2.qcm\"\n")},
+		"loop2.qcm":      {Data: []byte("include \"loop.qcm\"\n")},
+		"missing.qcm":    {Data: []byte("include \"nope.qcm\"\n")},
+		"lib/nested.qcm": {Data: []byte("include \"ent.qcm\"\n")},
+	}
+
+	p, err := ParseFS(fsys, "main.qcm")
+	require.NoError(err)
+	require.Len(p.Ops, 2)
+	assert.Equal(t, "lib/ent.qcm:1", p.Ops[1].Pos)
+
+	_, err = ParseFS(fsys, "loop.qcm")
+	assert.ErrorContains(t, err, "include cycle")
+
+	_, err = ParseFS(fsys, "missing.qcm")
+	assert.ErrorContains(t, err, "missing.qcm:1")
+}
+
+func TestFormat_RoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3), builder.C(2))
+	b.H(0).CNOT(0, 1).Toffoli(0, 1, 2).SWAP(1, 2).Measure(2, 1).Measure(0, 0)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	src, err := Format(c)
+	require.NoError(err)
+	p, err := ParseString(src)
+	require.NoError(err, "formatted source should parse:\n%s", src)
+	c2, err := p.Circuit()
+	require.NoError(err)
+
+	ops, ops2 := c.Operations(), c2.Operations()
+	require.Len(ops2, len(ops))
+	for i := range ops {
+		assert.Same(t, ops[i].G, ops2[i].G)
+		assert.Equal(t, ops[i].Qubits, ops2[i].Qubits)
+		assert.Equal(t, ops[i].Cbit, ops2[i].Cbit)
+	}
+	assert.Equal(t, src, p.String(), "formatting should be a fixed point")
+}
+
+func TestFormat_Edges(t *testing.T) {
+	require := require.New(t)
+
+	// Width 0 round-trips through a program without registers.
+	empty, err := builder.New(builder.Q(0)).BuildCircuit()
+	require.NoError(err)
+	src, err := Format(empty)
+	require.NoError(err)
+	require.Empty(src)
+	p, err := ParseString(src)
+	require.NoError(err)
+	c, err := p.Circuit()
+	require.NoError(err)
+	require.Zero(c.Qubits())
+	require.Zero(c.Clbits())
+
+	flow, err := builder.New(builder.Q(1), builder.C(1)).
+		Measure(0, 0).If(builder.Bit(0), func(b builder.Builder) { b.X(0) }).BuildCircuit()
+	require.NoError(err)
+	_, err = Format(flow)
+	require.ErrorContains(err, "control flow")
+}
+
+// TestFormat_RoundTripRandom checks on random circuits that formatting and
+// parsing back preserves every operand, so no qubit or cbit is reordered,
+// and that a parsed program keeps qcm's little-endian keys.
+func TestFormat_RoundTripRandom(t *testing.T) {
+	require := require.New(t)
+	rng := rand.New(rand.NewSource(1))
+	gates := []struct {
+		add   func(b builder.Builder, qs []int)
+		arity int
+	}{
+		{func(b builder.Builder, qs []int) { b.H(qs[0]) }, 1},
+		{func(b builder.Builder, qs []int) { b.X(qs[0]) }, 1},
+		{func(b builder.Builder, qs []int) { b.S(qs[0]) }, 1},
+		{func(b builder.Builder, qs []int) { b.CNOT(qs[0], qs[1]) }, 2},
+		{func(b builder.Builder, qs []int) { b.CZ(qs[0], qs[1]) }, 2},
+		{func(b builder.Builder, qs []int) { b.SWAP(qs[0], qs[1]) }, 2},
+		{func(b builder.Builder, qs []int) { b.Toffoli(qs[0], qs[1], qs[2]) }, 3},
+	}
+	for range 50 {
+		n := 3 + rng.Intn(4)
+		b := builder.New(builder.Q(n), builder.C(n))
+		for range 1 + rng.Intn(20) {
+			g := gates[rng.Intn(len(gates))]
+			g.add(b, rng.Perm(n)[:g.arity])
+		}
+		for q, cb := range rng.Perm(n)[:1+rng.Intn(n)] {
+			b.Measure(q, cb)
+		}
+		c, err := b.BuildCircuit()
+		require.NoError(err)
+
+		src, err := Format(c)
+		require.NoError(err)
+		p, err := ParseString(src)
+		require.NoError(err, src)
+		c2, err := p.Circuit()
+		require.NoError(err)
+		require.Equal(c.Qubits(), c2.Qubits())
+		require.Equal(c.Clbits(), c2.Clbits())
+		ops, ops2 := c.Operations(), c2.Operations()
+		require.Len(ops2, len(ops), src)
+		for i := range ops {
+			require.Equal(ops[i].G.Name(), ops2[i].G.Name(), src)
+			require.Equal(ops[i].Qubits, ops2[i].Qubits, src)
+			require.Equal(ops[i].Cbit, ops2[i].Cbit, src)
+		}
+		src2, err := Format(c2)
+		require.NoError(err)
+		require.Equal(src, src2)
+	}
+
+	// x on data[0] sets out[0]: the raw key lists it first, the MSBFirst
+	// key (as other toolkits print it) last.
+	p, err := ParseString("qreg data 2\ncreg out 2\nx data[0]\nmeasure data[0] -> out[0]\nmeasure data[1] -> out[1]\n")
+	require.NoError(err)
+	c, err := p.Circuit()
+	require.NoError(err)
+	sim, err := simulator.NewSimulatorWithRunner("qsim", simulator.SimulatorOptions{Shots: 10})
+	require.NoError(err)
+	res, err := sim.RunResult(c)
+	require.NoError(err)
+	assert.Equal(t, map[string]int{"10": 10}, res.Counts)
+	assert.Equal(t, map[string]int{"01": 10}, res.Format(simulator.KeyFormat{Order: bitorder.MSBFirst}))
+	v, err := bitorder.Value("01", bitorder.MSBFirst)
+	require.NoError(err)
+	assert.Equal(t, uint64(1), v)
+}
+
+func TestMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p, err := ParseString("qreg q 2\ncreg c 1\nx q[0] @cal=x_v2 @amp=0.9  # calibrated\nmeasure q[0] -> c[0] @kernel=boxcar\n")
+	require.NoError(err)
+	assert.Equal(map[string]string{"cal": "x_v2", "amp": "0.9"}, p.Ops[0].Meta)
+	c, err := p.Circuit()
+	require.NoError(err)
+	ops := c.Operations()
+	assert.Equal(circuit.Meta{"cal": "x_v2", "amp": "0.9"}, ops[0].Meta)
+	assert.Equal(circuit.Meta{"kernel": "boxcar"}, ops[1].Meta)
+	src, err := Format(c)
+	require.NoError(err)
+	assert.Equal("qreg q 2\ncreg c 1\nx q[0] @amp=0.9 @cal=x_v2\nmeasure q[0] -> c[0] @kernel=boxcar\n", src)
+
+	_, err = ParseString("qreg q 1\nx q[0] @cal\n")
+	assert.ErrorContains(err, "bad metadata")
+}
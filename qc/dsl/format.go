@@ -0,0 +1,88 @@
+package dsl
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Format renders c as DSL source using one quantum register "q" and the
+// circuit's classical registers (or a single register "c" when some bits
+// are anonymous). Composite gates are written by name, so they can
+// only be parsed back if they were registered with gate.Register. The DSL
+// has no control flow, so circuits using it are an error.
+func Format(c circuit.Circuit) (string, error) {
+	var sb strings.Builder
+	if err := Write(&sb, c); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// Write is Format to an io.Writer.
+func Write(w io.Writer, c circuit.Circuit) error {
+	if circuit.HasControlFlow(c) {
+		return fmt.Errorf("dsl: classical control flow cannot be written")
+	}
+	p := &Program{QRegs: []Register{{Name: "q", Size: c.Qubits()}}}
+	for _, r := range c.CRegs() {
+		p.CRegs = append(p.CRegs, Register{Name: r.Name, Start: r.Start, Size: r.Size})
+	}
+	if total(p.CRegs) != c.Clbits() {
+		// Anonymous classical bits: fall back to one register covering all.
+		p.CRegs = []Register{{Name: "c", Size: c.Clbits()}}
+	}
+	for _, op := range c.OpsIter() {
+		p.Ops = append(p.Ops, Instruction{G: op.G, Qubits: op.Qubits, Cbit: op.Cbit, Meta: op.Meta})
+	}
+	_, err := io.WriteString(w, p.String())
+	return err
+}
+
+// String renders the program back to DSL source. Includes are already
+// flattened, and operands are written against the declared registers.
+// Empty registers, which the parser rejects, are left out: a program
+// without registers has width 0.
+func (p *Program) String() string {
+	var sb strings.Builder
+	for _, r := range p.QRegs {
+		if r.Size > 0 {
+			fmt.Fprintf(&sb, "qreg %s %d\n", r.Name, r.Size)
+		}
+	}
+	for _, r := range p.CRegs {
+		if r.Size > 0 {
+			fmt.Fprintf(&sb, "creg %s %d\n", r.Name, r.Size)
+		}
+	}
+	for _, in := range p.Ops {
+		if in.G.Name() == "MEASURE" {
+			fmt.Fprintf(&sb, "measure %s -> %s", operand(in.Qubits[0], p.QRegs), operand(in.Cbit, p.CRegs))
+		} else {
+			sb.WriteString(strings.ToLower(in.G.Name()))
+			for _, q := range in.Qubits {
+				sb.WriteByte(' ')
+				sb.WriteString(operand(q, p.QRegs))
+			}
+		}
+		for _, k := range slices.Sorted(maps.Keys(in.Meta)) {
+			fmt.Fprintf(&sb, " @%s=%s", k, in.Meta[k])
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// operand is the inverse of resolve.
+func operand(i int, regs []Register) string {
+	for _, r := range regs {
+		if i >= r.Start && i < r.Start+r.Size {
+			return fmt.Sprintf("%s[%d]", r.Name, i-r.Start)
+		}
+	}
+	return fmt.Sprint(i)
+}
@@ -0,0 +1,230 @@
+// Package experiment records simulation runs so that they can be
+// reproduced exactly, and sweeps them over grids of parameters, backends
+// and shot counts.
+package experiment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/interop"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// ManifestVersion is the version of the manifest format written by Save.
+const ManifestVersion = 1
+
+// Manifest is everything needed to run an experiment again: the circuit,
+// the backend and every option that affects the outcome. The circuit is
+// stored as OpenQASM 2 (see interop.QASM2), so angles are kept in full
+// precision; CircuitHash is the SHA-256 of that text.
+type Manifest struct {
+	Version     int                   `json:"version"`
+	Created     time.Time             `json:"created"`
+	Circuit     string                `json:"circuit"`
+	CircuitHash string                `json:"circuit_hash"`
+	Backend     Backend               `json:"backend"`
+	Shots       int                   `json:"shots"`
+	Seed        int64                 `json:"seed"`
+	ChunkShots  int                   `json:"chunk_shots,omitempty"`
+	Noise       *simulator.NoiseModel `json:"noise,omitempty"`
+	Transpile   Transpile             `json:"transpile"`
+	Build       Build                 `json:"build"`
+}
+
+// Backend identifies the runner by its registry name and, when it
+// describes itself, the version it reports.
+type Backend struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Transpile lists the simulator options that rewrite the circuit or the
+// shots before they are counted.
+type Transpile struct {
+	NoTaper      bool        `json:"no_taper,omitempty"`
+	NoLightCone  bool        `json:"no_light_cone,omitempty"`
+	NoShortcut   bool        `json:"no_shortcut,omitempty"`
+	UniformNoise float64     `json:"uniform_noise,omitempty"`
+	PostSelect   map[int]int `json:"post_select,omitempty"`
+}
+
+// Build describes the binary that produced the manifest, from its build
+// information; the VCS fields are empty when it was not built from a
+// checkout (go test, go run of a file).
+type Build struct {
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+	Version   string `json:"module_version,omitempty"`
+	Revision  string `json:"vcs_revision,omitempty"`
+	Time      string `json:"vcs_time,omitempty"`
+	Modified  bool   `json:"vcs_modified,omitempty"`
+}
+
+// NewManifest describes running c on the registered runner backend with
+// opts and, if noise is not nil, under noise. Results are only
+// reproducible when seeded, so a zero opts.Seed is replaced with a random
+// one, which Run then uses.
+func NewManifest(c circuit.Circuit, backend string, opts simulator.SimulatorOptions, noise *simulator.NoiseModel) (*Manifest, error) {
+	src, err := interop.QASM2(c)
+	if err != nil {
+		return nil, fmt.Errorf("experiment: %w", err)
+	}
+	runner, err := simulator.CreateRunner(backend)
+	if err != nil {
+		return nil, fmt.Errorf("experiment: %w", err)
+	}
+	m := &Manifest{
+		Version:     ManifestVersion,
+		Created:     time.Now().UTC(),
+		Circuit:     src,
+		CircuitHash: hash(src),
+		Backend:     Backend{Name: backend},
+		Shots:       opts.Shots,
+		Seed:        opts.Seed,
+		ChunkShots:  opts.ChunkShots,
+		Transpile: Transpile{
+			NoTaper:      opts.NoTaper,
+			NoLightCone:  opts.NoLightCone,
+			NoShortcut:   opts.NoShortcut,
+			UniformNoise: opts.UniformNoise,
+			PostSelect:   opts.PostSelect,
+		},
+		Build: buildInfo(),
+	}
+	if info := simulator.GetBackendInfo(runner); info != nil {
+		m.Backend.Version = info.Version
+	}
+	if m.Shots <= 0 {
+		m.Shots = 1024 // as NewSimulator
+	}
+	for m.Seed == 0 {
+		m.Seed = rand.Int63()
+	}
+	if noise != nil {
+		nm := *noise
+		m.Noise = &nm
+	}
+	return m, nil
+}
+
+func hash(src string) string {
+	sum := sha256.Sum256([]byte(src))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func buildInfo() Build {
+	b := Build{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Module, b.Version = bi.Main.Path, bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// LoadCircuit parses the stored circuit after checking it against
+// CircuitHash.
+func (m *Manifest) LoadCircuit() (circuit.Circuit, error) {
+	if h := hash(m.Circuit); h != m.CircuitHash {
+		return nil, fmt.Errorf("experiment: circuit hash %s does not match the manifest's %s", h, m.CircuitHash)
+	}
+	c, err := interop.FromQASM2(m.Circuit)
+	if err != nil {
+		return nil, fmt.Errorf("experiment: %w", err)
+	}
+	return c, nil
+}
+
+// Simulator creates the manifest's runner and a simulator with its
+// options. A runner that now reports a different version is an error, as
+// its results may differ.
+func (m *Manifest) Simulator() (*simulator.Simulator, error) {
+	runner, err := simulator.CreateRunner(m.Backend.Name)
+	if err != nil {
+		return nil, fmt.Errorf("experiment: %w", err)
+	}
+	if info := simulator.GetBackendInfo(runner); info != nil && info.Version != m.Backend.Version {
+		return nil, fmt.Errorf("experiment: backend %s is version %s, the manifest was recorded with %s",
+			m.Backend.Name, info.Version, m.Backend.Version)
+	}
+	return simulator.NewSimulator(simulator.SimulatorOptions{
+		Shots:        m.Shots,
+		Runner:       runner,
+		Seed:         m.Seed,
+		ChunkShots:   m.ChunkShots,
+		NoTaper:      m.Transpile.NoTaper,
+		NoLightCone:  m.Transpile.NoLightCone,
+		NoShortcut:   m.Transpile.NoShortcut,
+		UniformNoise: m.Transpile.UniformNoise,
+		PostSelect:   m.Transpile.PostSelect,
+	}), nil
+}
+
+// Run runs the experiment the manifest describes.
+func (m *Manifest) Run() (map[string]int, error) {
+	c, err := m.LoadCircuit()
+	if err != nil {
+		return nil, err
+	}
+	sim, err := m.Simulator()
+	if err != nil {
+		return nil, err
+	}
+	if m.Noise != nil {
+		return sim.RunNoisy(c, *m.Noise)
+	}
+	return sim.Run(c)
+}
+
+// Run records a manifest for running c on backend with opts and noise (see
+// NewManifest) and runs it, so that the counts returned are the ones
+// Manifest.Run reproduces.
+func Run(c circuit.Circuit, backend string, opts simulator.SimulatorOptions, noise *simulator.NoiseModel) (map[string]int, *Manifest, error) {
+	m, err := NewManifest(c, backend, opts, noise)
+	if err != nil {
+		return nil, nil, err
+	}
+	counts, err := m.Run()
+	if err != nil {
+		return nil, m, err
+	}
+	return counts, m, nil
+}
+
+// Save writes m as indented JSON.
+func (m *Manifest) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// LoadManifest reads a manifest written by Save.
+func LoadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("experiment: manifest: %w", err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("experiment: manifest version %d is not supported", m.Version)
+	}
+	return &m, nil
+}
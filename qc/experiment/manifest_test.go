@@ -0,0 +1,51 @@
+package experiment
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	_ "github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.RY(math.Pi/3, 0).CNOT(0, 1).Measure(0, 0).Measure(1, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	noise := &simulator.NoiseModel{Depolarizing: 0.02, Readout: 0.01}
+	counts, m, err := Run(c, "qsim", simulator.SimulatorOptions{Shots: 500}, noise)
+	require.NoError(err)
+	assert.NotZero(m.Seed, "an unseeded run gets a seed")
+	assert.Equal(Backend{Name: "qsim", Version: "v1.0.0"}, m.Backend)
+	assert.Equal(500, m.Shots)
+	assert.True(strings.HasPrefix(m.CircuitHash, "sha256:"))
+	assert.NotEmpty(m.Build.GoVersion)
+
+	var buf bytes.Buffer
+	require.NoError(m.Save(&buf))
+	loaded, err := LoadManifest(&buf)
+	require.NoError(err)
+	assert.Equal(m.Noise, loaded.Noise)
+	again, err := loaded.Run()
+	require.NoError(err)
+	assert.Equal(counts, again, "a reloaded manifest reproduces the counts")
+
+	loaded.Circuit = strings.Replace(loaded.Circuit, "cx", "cz", 1)
+	_, err = loaded.Run()
+	assert.ErrorContains(err, "does not match")
+
+	_, err = LoadManifest(strings.NewReader(`{"version": 99}`))
+	assert.ErrorContains(err, "version 99")
+	_, err = NewManifest(c, "nope", simulator.SimulatorOptions{}, nil)
+	assert.Error(err)
+}
@@ -0,0 +1,203 @@
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Generator builds a circuit for one point of a sweep's parameter grid.
+type Generator func(params map[string]float64) (circuit.Circuit, error)
+
+// Circuit is a named generator.
+type Circuit struct {
+	Name  string
+	Build Generator
+}
+
+// Sweep runs every combination of circuit, grid point, backend and shot
+// count. Each combination is a cell; cells run concurrently and fail
+// independently, so one bad cell does not stop the others.
+type Sweep struct {
+	Circuits []Circuit
+	// Grid maps parameter names to the values to try; cells cover every
+	// combination. An empty grid is a single point with no parameters.
+	Grid     map[string][]float64
+	Backends []string // registry names
+	Shots    []int
+	// Options are the simulator options of every cell; their Shots is
+	// replaced by the cell's. A zero Seed gives each cell a seed of its
+	// own, recorded in its manifest.
+	Options simulator.SimulatorOptions
+	Noise   *simulator.NoiseModel
+	Workers int // cells run at once (0 => NumCPU)
+}
+
+// Cell is the outcome of one combination. Err is set, and Counts nil, when
+// building or running the circuit failed.
+type Cell struct {
+	Circuit  string             `json:"circuit"`
+	Params   map[string]float64 `json:"params,omitempty"`
+	Backend  string             `json:"backend"`
+	Shots    int                `json:"shots"`
+	Counts   map[string]int     `json:"counts,omitempty"`
+	Manifest *Manifest          `json:"manifest,omitempty"`
+	Elapsed  time.Duration      `json:"elapsed_ns"`
+	Err      string             `json:"error,omitempty"`
+}
+
+// Table is the aggregated result of a sweep, one cell per combination in
+// the order circuits, grid points, backends, shots.
+type Table struct {
+	Cells []Cell `json:"cells"`
+}
+
+// points expands the grid into its combinations, parameter names in
+// sorted order with the last varying fastest.
+func (s Sweep) points() []map[string]float64 {
+	points := []map[string]float64{{}}
+	for _, name := range slices.Sorted(maps.Keys(s.Grid)) {
+		var next []map[string]float64
+		for _, p := range points {
+			for _, v := range s.Grid[name] {
+				q := maps.Clone(p)
+				q[name] = v
+				next = append(next, q)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// Run runs every cell. A cancelled ctx stops cells that have not started,
+// which report the context's error; it does not interrupt running ones.
+func (s Sweep) Run(ctx context.Context) *Table {
+	t := &Table{}
+	for _, c := range s.Circuits {
+		for _, p := range s.points() {
+			for _, b := range s.Backends {
+				for _, n := range s.Shots {
+					t.Cells = append(t.Cells, Cell{Circuit: c.Name, Params: p, Backend: b, Shots: n})
+				}
+			}
+		}
+	}
+	builders := map[string]Generator{}
+	for _, c := range s.Circuits {
+		builders[c.Name] = c.Build
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan *Cell)
+	var wg sync.WaitGroup
+	for range min(workers, len(t.Cells)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cell := range jobs {
+				if err := ctx.Err(); err != nil {
+					cell.Err = err.Error()
+					continue
+				}
+				s.runCell(cell, builders[cell.Circuit])
+			}
+		}()
+	}
+	for i := range t.Cells {
+		jobs <- &t.Cells[i]
+	}
+	close(jobs)
+	wg.Wait()
+	return t
+}
+
+// runCell fills in cell, turning a panic in the generator or runner into
+// the cell's error.
+func (s Sweep) runCell(cell *Cell, build Generator) {
+	start := time.Now()
+	defer func() {
+		cell.Elapsed = time.Since(start)
+		if r := recover(); r != nil {
+			cell.Counts, cell.Err = nil, fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	c, err := build(maps.Clone(cell.Params))
+	if err != nil {
+		cell.Err = fmt.Sprintf("building circuit: %v", err)
+		return
+	}
+	opts := s.Options
+	opts.Shots = cell.Shots
+	counts, m, err := Run(c, cell.Backend, opts, s.Noise)
+	cell.Manifest = m
+	if err != nil {
+		cell.Err = err.Error()
+		return
+	}
+	cell.Counts = counts
+}
+
+// Failed returns the cells that failed.
+func (t *Table) Failed() []Cell {
+	var out []Cell
+	for _, c := range t.Cells {
+		if c.Err != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// WriteJSON writes t as indented JSON, manifests included.
+func (t *Table) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+// WriteText writes t as an aligned table with one row per cell, showing
+// the most frequent outcome and its share of the shots, or the error.
+func (t *Table) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CIRCUIT\tPARAMS\tBACKEND\tSHOTS\tTOP\tP(TOP)\tTIME\tERROR")
+	for _, c := range t.Cells {
+		var params []string
+		for _, k := range slices.Sorted(maps.Keys(c.Params)) {
+			params = append(params, fmt.Sprintf("%s=%g", k, c.Params[k]))
+		}
+		top, share := "-", "-"
+		if key, n, ok := mostFrequent(c.Counts); ok {
+			top, share = key, fmt.Sprintf("%.3f", float64(n)/float64(c.Shots))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", c.Circuit, strings.Join(params, ","),
+			c.Backend, c.Shots, top, share, c.Elapsed.Round(time.Microsecond), c.Err)
+	}
+	return tw.Flush()
+}
+
+// mostFrequent returns the key with the highest count, the smallest such
+// key on ties.
+func mostFrequent(counts map[string]int) (string, int, bool) {
+	best, bestN := "", -1
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		if counts[k] > bestN {
+			best, bestN = k, counts[k]
+		}
+	}
+	return best, bestN, bestN >= 0
+}
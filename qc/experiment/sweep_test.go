@@ -0,0 +1,76 @@
+package experiment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	_ "github.com/kegliz/qcm/qc/simulator/itsu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweep(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rotation := func(p map[string]float64) (circuit.Circuit, error) {
+		b := builder.New(builder.Q(1), builder.C(1))
+		b.RY(p["theta"], 0).Measure(0, 0)
+		return b.BuildCircuit()
+	}
+	s := Sweep{
+		Circuits: []Circuit{
+			{Name: "ry", Build: rotation},
+			{Name: "broken", Build: func(map[string]float64) (circuit.Circuit, error) {
+				return nil, fmt.Errorf("no such circuit")
+			}},
+			{Name: "panics", Build: func(map[string]float64) (circuit.Circuit, error) { panic("boom") }},
+		},
+		Grid:     map[string][]float64{"theta": {0, math.Pi}},
+		Backends: []string{"qsim", "itsu", "missing"},
+		Shots:    []int{50},
+		Workers:  4,
+	}
+	table := s.Run(context.Background())
+	require.Len(table.Cells, 3*2*3)
+
+	// ry cells come first: theta=0 on each backend, then theta=π.
+	for i, want := range []string{"0", "0", "", "1", "1", ""} {
+		cell := table.Cells[i]
+		assert.Equal("ry", cell.Circuit)
+		if want == "" {
+			assert.Equal("missing", cell.Backend)
+			assert.NotEmpty(cell.Err)
+			continue
+		}
+		assert.Empty(cell.Err)
+		assert.Equal(map[string]int{want: 50}, cell.Counts, "cell %d", i)
+		require.NotNil(cell.Manifest)
+		assert.Equal(cell.Backend, cell.Manifest.Backend.Name)
+	}
+	assert.Equal("building circuit: no such circuit", table.Cells[6].Err)
+	assert.Equal("panic: boom", table.Cells[12].Err)
+	assert.Len(table.Failed(), 2+6+6)
+
+	var text bytes.Buffer
+	require.NoError(table.WriteText(&text))
+	assert.Contains(text.String(), "CIRCUIT")
+	assert.Regexp(`ry\s+theta=3.14159\d*\s+qsim\s+50\s+1\s+1.000`, text.String())
+
+	var js bytes.Buffer
+	require.NoError(table.WriteJSON(&js))
+	var back Table
+	require.NoError(json.Unmarshal(js.Bytes(), &back))
+	assert.Equal(table.Cells[3].Counts, back.Cells[3].Counts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	table = s.Run(ctx)
+	assert.Len(table.Failed(), len(table.Cells), "a cancelled sweep starts no cell")
+}
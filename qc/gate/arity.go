@@ -0,0 +1,28 @@
+package gate
+
+// SingleQubitGate, TwoQubitGate and ThreeQubitGate are implemented by the
+// built-in gates of that span. Their constructors return them, so typed
+// entry points such as builder.Apply2 catch a wrong number of qubits at
+// compile time. Composites and user gates only have a span at run time and
+// remain plain Gates.
+type (
+	SingleQubitGate interface {
+		Gate
+		singleQubit()
+	}
+	TwoQubitGate interface {
+		Gate
+		twoQubit()
+	}
+	ThreeQubitGate interface {
+		Gate
+		threeQubit()
+	}
+)
+
+func (u1) singleQubit()       {}
+func (rotation) singleQubit() {}
+func (phase1) singleQubit()   {}
+func (u2) twoQubit()          {}
+func (phase2) twoQubit()      {}
+func (u3) threeQubit()        {}
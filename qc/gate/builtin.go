@@ -44,6 +44,22 @@ func (meas) DrawSymbol() string { return "M" }
 func (meas) Targets() []int     { return []int{0} } // Target is the only qubit
 func (meas) Controls() []int    { return []int{} }  // No controls
 
+// repeat-until-success block marker; the body lives on the DAG node, so the
+// gate itself only records how many qubits the block spans.
+type loop struct{ span int }
+
+func (g loop) Name() string       { return "LOOP" }
+func (g loop) QubitSpan() int     { return g.span }
+func (g loop) DrawSymbol() string { return "↻" }
+func (g loop) Targets() []int {
+	t := make([]int, g.span)
+	for i := range t {
+		t[i] = i
+	}
+	return t
+}
+func (g loop) Controls() []int { return []int{} }
+
 // ---------- constructors (singletons) --------------------------------
 
 var (
@@ -62,14 +78,18 @@ var (
 
 // Public accessors return the shared immutable value.
 // (Reduces allocations and supports pointer equality tricks in passes.)
-func H() Gate       { return hGate }
-func X() Gate       { return xGate }
-func Y() Gate       { return yGate }
-func S() Gate       { return sGate }
-func Z() Gate       { return zGate }
-func Swap() Gate    { return swapG }
-func CNOT() Gate    { return cnotG }
-func CZ() Gate      { return czGate } // Added CZ accessor
-func Toffoli() Gate { return toffG }
-func Fredkin() Gate { return fredG }
-func Measure() Gate { return measG }
+func H() SingleQubitGate      { return hGate }
+func X() SingleQubitGate      { return xGate }
+func Y() SingleQubitGate      { return yGate }
+func S() SingleQubitGate      { return sGate }
+func Z() SingleQubitGate      { return zGate }
+func Swap() TwoQubitGate      { return swapG }
+func CNOT() TwoQubitGate      { return cnotG }
+func CZ() TwoQubitGate        { return czGate } // Added CZ accessor
+func Toffoli() ThreeQubitGate { return toffG }
+func Fredkin() ThreeQubitGate { return fredG }
+func Measure() Gate           { return measG }
+
+// Loop returns the marker gate for a control-flow loop spanning n qubits.
+// It is not a unitary and cannot be applied on its own.
+func Loop(n int) Gate { return loop{span: n} }
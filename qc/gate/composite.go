@@ -0,0 +1,163 @@
+package gate
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Step is one operation inside a composite gate. Qubits are relative to the
+// composite's span, i.e. 0 ≤ q < QubitSpan().
+type Step struct {
+	G      Gate
+	Qubits []int
+}
+
+// Composite is a named gate defined by a sequence of other gates.
+// Renderers draw it as a single box; runners play its steps in order.
+type Composite struct {
+	name  string
+	span  int
+	steps []Step
+
+	symbol string         // drawn instead of the name; see Define
+	matrix [][]complex128 // the unitary of steps, if known; see Define
+	params []float64      // the angles of native gates; see Params
+}
+
+// NewComposite validates steps against span and returns the composite gate.
+// Names of built-in gates are taken: runners, passes and validation
+// recognise built-in gates by name, so such a composite would be played as
+// the built-in gate rather than by its steps.
+func NewComposite(name string, span int, steps []Step) (*Composite, error) {
+	if norm(name) == "" {
+		return nil, fmt.Errorf("gate: composite name cannot be empty")
+	}
+	if Reserved(name) {
+		return nil, fmt.Errorf("gate: composite %s shadows a built-in gate", name)
+	}
+	return newComposite(name, span, steps)
+}
+
+// newComposite is NewComposite without the name check, for the built-in
+// composites themselves.
+func newComposite(name string, span int, steps []Step) (*Composite, error) {
+	if span < 1 {
+		return nil, fmt.Errorf("gate: composite %s must span at least one qubit, got %d", name, span)
+	}
+	own := make([]Step, len(steps))
+	for i, s := range steps {
+		if s.G == nil {
+			return nil, fmt.Errorf("gate: composite %s step %d has no gate", name, i)
+		}
+		if s.G.Name() == "MEASURE" {
+			return nil, fmt.Errorf("gate: composite %s step %d: measurement is not allowed", name, i)
+		}
+		if len(s.Qubits) != s.G.QubitSpan() {
+			return nil, fmt.Errorf("gate: composite %s step %d: %s spans %d qubits, got %d",
+				name, i, s.G.Name(), s.G.QubitSpan(), len(s.Qubits))
+		}
+		for _, q := range s.Qubits {
+			if q < 0 || q >= span {
+				return nil, fmt.Errorf("gate: composite %s step %d: qubit %d outside span %d", name, i, q, span)
+			}
+		}
+		own[i] = Step{G: s.G, Qubits: append([]int(nil), s.Qubits...)}
+	}
+	return &Composite{name: name, span: span, steps: own}, nil
+}
+
+func (c *Composite) Name() string    { return c.name }
+func (c *Composite) QubitSpan() int  { return c.span }
+func (c *Composite) Controls() []int { return []int{} }
+
+// DrawSymbol returns the symbol given to Define, or else the name.
+func (c *Composite) DrawSymbol() string {
+	if c.symbol != "" {
+		return c.symbol
+	}
+	return c.name
+}
+
+// Targets reports every qubit in the span; a composite has no distinguished
+// control wires.
+func (c *Composite) Targets() []int {
+	t := make([]int, c.span)
+	for i := range t {
+		t[i] = i
+	}
+	return t
+}
+
+// Params returns the angles of the native gates that take them, GPI, GPI2
+// and MS, and nil for every other composite.
+func (c *Composite) Params() []float64 { return append([]float64(nil), c.params...) }
+
+// Steps returns a copy of the definition.
+func (c *Composite) Steps() []Step {
+	out := make([]Step, len(c.steps))
+	for i, s := range c.steps {
+		out[i] = Step{G: s.G, Qubits: append([]int(nil), s.Qubits...)}
+	}
+	return out
+}
+
+// Expand resolves a composite applied to absolute qubits into primitive
+// (non-composite) gates on absolute qubits, recursing through nested
+// definitions. fn is called once per primitive in program order.
+func Expand(g Gate, qubits []int, fn func(g Gate, qubits []int) error) error {
+	c, ok := g.(*Composite)
+	if !ok {
+		return fn(g, qubits)
+	}
+	for _, s := range c.steps {
+		abs := make([]int, len(s.Qubits))
+		for i, q := range s.Qubits {
+			abs[i] = qubits[q]
+		}
+		if err := Expand(s.G, abs, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------- user registry ---------------------------------------------
+
+var (
+	regMu      sync.RWMutex
+	registered = map[string]Gate{}
+)
+
+// Register makes g resolvable through Factory by its (case-insensitive) name.
+// Built-in names and already registered names cannot be redefined.
+func Register(g Gate) error {
+	key := norm(g.Name())
+	if Reserved(key) {
+		return fmt.Errorf("gate: %s shadows a built-in gate", g.Name())
+	}
+	regMu.Lock()
+	defer regMu.Unlock()
+	if _, exists := registered[key]; exists {
+		return fmt.Errorf("gate: %s is already registered", g.Name())
+	}
+	registered[key] = g
+	return nil
+}
+
+// Unregister removes a user gate. It reports whether the name was known.
+// This is primarily useful for testing.
+func Unregister(name string) bool {
+	regMu.Lock()
+	defer regMu.Unlock()
+	key := norm(name)
+	_, ok := registered[key]
+	delete(registered, key)
+	return ok
+}
+
+func lookup(key string) (Gate, bool) {
+	regMu.RLock()
+	defer regMu.RUnlock()
+	g, ok := registered[key]
+	return g, ok
+}
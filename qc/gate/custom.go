@@ -0,0 +1,102 @@
+package gate
+
+import (
+	"fmt"
+	"math/cmplx"
+)
+
+// DefaultTolerance is how closely a Custom's Steps must reproduce its
+// Matrix when Custom.Tolerance is 0.
+const DefaultTolerance = 1e-8
+
+// Custom describes a user-defined gate for Define.
+type Custom struct {
+	Name string
+	// Symbol is drawn by renderers; the name if empty.
+	Symbol string
+	Qubits int
+	// Steps decompose the gate into other gates, e.g. from
+	// builder.BuildGate or synth.Decompose. Every runner and exporter
+	// works from them.
+	Steps []Step
+	// Matrix is the gate's unitary, indexed as Matrix returns it, and may
+	// be nil. Runners that apply dense matrices, such as qsim, apply it in
+	// one go instead of playing Steps. Steps must reproduce it exactly,
+	// global phase included, so controlled forms agree.
+	Matrix [][]complex128
+	// Tolerance bounds the entrywise difference between Matrix and the
+	// product of Steps; 0 => DefaultTolerance. Loosen it for steps
+	// synthesised to limited accuracy, tighten it for deep definitions.
+	Tolerance float64
+}
+
+// Define makes the user gate c a composite and registers it, so it is
+// resolved by name through Factory, listed by All, applied with
+// builder.Apply, drawn with its symbol, exported to OpenQASM as a gate
+// definition and simulated by every runner.
+func Define(c Custom) (*Composite, error) {
+	g, err := NewComposite(c.Name, c.Qubits, c.Steps)
+	if err != nil {
+		return nil, err
+	}
+	g.symbol = c.Symbol
+	if c.Tolerance < 0 {
+		return nil, fmt.Errorf("gate: %s has negative tolerance %v", c.Name, c.Tolerance)
+	}
+	if c.Matrix != nil {
+		tol := c.Tolerance
+		if tol == 0 {
+			tol = DefaultTolerance
+		}
+		if g.matrix, err = checkMatrix(g, c.Matrix, tol); err != nil {
+			return nil, err
+		}
+	}
+	if err := Register(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Unitary returns a copy of the matrix given to Define, or nil.
+func (c *Composite) Unitary() [][]complex128 {
+	if c.matrix == nil {
+		return nil
+	}
+	out := make([][]complex128, len(c.matrix))
+	for i, row := range c.matrix {
+		out[i] = append([]complex128(nil), row...)
+	}
+	return out
+}
+
+// checkMatrix returns a copy of m after checking that the steps of g
+// implement it to within tol.
+func checkMatrix(g *Composite, m [][]complex128, tol float64) ([][]complex128, error) {
+	dim := 1 << g.span
+	if len(m) != dim {
+		return nil, fmt.Errorf("gate: %s on %d qubits needs a %d×%d matrix, got %d rows", g.name, g.span, dim, dim, len(m))
+	}
+	for i, row := range m {
+		if len(row) != dim {
+			return nil, fmt.Errorf("gate: %s matrix row %d has %d entries, want %d", g.name, i, len(row), dim)
+		}
+	}
+	steps, err := Matrix(g)
+	if err != nil {
+		return nil, err
+	}
+	for i := range m {
+		for j := range m[i] {
+			if cmplx.Abs(m[i][j]-steps[i][j]) > tol {
+				return nil, fmt.Errorf("gate: %s steps do not implement its matrix at [%d][%d]: %v, want %v",
+					g.name, i, j, steps[i][j], m[i][j])
+			}
+		}
+	}
+	out := make([][]complex128, dim)
+	for i, row := range m {
+		out[i] = append([]complex128(nil), row...)
+	}
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package gate
+
+import (
+	"maps"
+	"slices"
+)
+
+// Descriptor describes a supported gate, for tools that list them: CLIs,
+// documentation generators, editors.
+type Descriptor struct {
+	Name string
+	// Aliases are the names Factory resolves the gate by, lower case.
+	// Gates with parameters have none; their constructors make them.
+	Aliases []string
+	Qubits  int
+	Params  int
+	Symbol  string
+	// Matrix is the gate's unitary as Matrix returns it; nil for the
+	// measurement, gates with parameters and gates on more than
+	// MaxMatrixQubits qubits.
+	Matrix [][]complex128
+	// Custom marks gates added with Register.
+	Custom bool
+}
+
+// parametric describes the built-in gates with parameters.
+var parametric = []Descriptor{
+	{Name: "P", Qubits: 1, Params: 1, Symbol: "P"},
+	{Name: "CP", Qubits: 2, Params: 1, Symbol: "P"},
+	{Name: "RX", Qubits: 1, Params: 1, Symbol: "RX"},
+	{Name: "RY", Qubits: 1, Params: 1, Symbol: "RY"},
+	{Name: "RZ", Qubits: 1, Params: 1, Symbol: "RZ"},
+	{Name: "GPI", Qubits: 1, Params: 1, Symbol: "GPI"},
+	{Name: "GPI2", Qubits: 1, Params: 1, Symbol: "GPI2"},
+	{Name: "MS", Qubits: 2, Params: 2, Symbol: "MS"},
+}
+
+// All describes every supported gate: the built-in gates resolved by
+// Factory, then the built-in gates with parameters, then the gates added
+// with Register, by name. Descriptors are fresh copies.
+func All() []Descriptor {
+	var out []Descriptor
+	for _, b := range builtins {
+		d := describe(b.gate)
+		d.Aliases = slices.Clone(b.aliases)
+		out = append(out, d)
+	}
+	out = append(out, parametric...)
+
+	regMu.RLock()
+	keys := slices.Sorted(maps.Keys(registered))
+	custom := make([]Gate, len(keys))
+	for i, k := range keys {
+		custom[i] = registered[k]
+	}
+	regMu.RUnlock()
+	for i, g := range custom {
+		d := describe(g)
+		d.Aliases = []string{keys[i]}
+		d.Custom = true
+		out = append(out, d)
+	}
+	return out
+}
+
+// describe fills in what g reports about itself.
+func describe(g Gate) Descriptor {
+	d := Descriptor{Name: g.Name(), Qubits: g.QubitSpan(), Symbol: g.DrawSymbol()}
+	if p, ok := g.(Parametric); ok {
+		d.Params = len(p.Params())
+	}
+	if m, err := Matrix(g); err == nil {
+		d.Matrix = m
+	}
+	return d
+}
@@ -1,6 +1,9 @@
 package gate
 
-import "strings"
+import (
+	"slices"
+	"strings"
+)
 
 // Gate is the *minimal* contract each quantum gate must fulfil.
 // The interface is tiny on purpose so optimisers and simulators
@@ -16,34 +19,50 @@ type Gate interface {
 // Factory returns an immutable gate by many common aliases.
 //
 //	g, _ := gate.Factory("cx")  // -> same instance as CNOT()
+//
+// Gates added with Register are resolved after the built-in aliases.
 func Factory(name string) (Gate, error) {
-	switch norm(name) {
-	case "h":
-		return H(), nil
-	case "x":
-		return X(), nil
-	case "y":
-		return Y(), nil
-	case "z": // Added Z alias for completeness, assuming it exists or will be added
-		return Z(), nil // Now Z gate exists
-	case "s":
-		return S(), nil
-	case "swap":
-		return Swap(), nil
-	case "cx", "cnot":
-		return CNOT(), nil
-	case "cz": // Added CZ alias
-		return CZ(), nil
-	case "t", "toffoli", "ccx":
-		return Toffoli(), nil
-	case "fredkin", "cswap":
-		return Fredkin(), nil
-	case "m", "measure", "meas":
-		return Measure(), nil
+	if g, err := builtin(norm(name)); err == nil {
+		return g, nil
+	}
+	if g, ok := lookup(norm(name)); ok {
+		return g, nil
 	}
 	return nil, ErrUnknownGate{name}
 }
 
+// builtins lists the built-in singletons with the normalised aliases
+// Factory resolves them by.
+var builtins = []struct {
+	aliases []string
+	gate    Gate
+}{
+	{[]string{"h"}, hGate},
+	{[]string{"x"}, xGate},
+	{[]string{"y"}, yGate},
+	{[]string{"z"}, zGate},
+	{[]string{"s"}, sGate},
+	{[]string{"swap"}, swapG},
+	{[]string{"cx", "cnot"}, cnotG},
+	{[]string{"cz"}, czGate},
+	{[]string{"t", "toffoli", "ccx"}, toffG},
+	{[]string{"fredkin", "cswap"}, fredG},
+	{[]string{"sx"}, sxGate},
+	{[]string{"ecr"}, ecrGate},
+	{[]string{"iswap"}, iswapGate},
+	{[]string{"m", "measure", "meas"}, measG},
+}
+
+// builtin resolves a normalised alias to one of the built-in singletons.
+func builtin(key string) (Gate, error) {
+	for _, b := range builtins {
+		if slices.Contains(b.aliases, key) {
+			return b.gate, nil
+		}
+	}
+	return nil, ErrUnknownGate{key}
+}
+
 // ErrUnknownGate is returned by Factory when the label isn't recognised.
 type ErrUnknownGate struct{ Name string }
 
@@ -51,4 +70,19 @@ func (e ErrUnknownGate) Error() string { return "qcircuit: unknown gate " + e.Na
 
 // helpers --------------------------------------------------------------
 
+// paramNames are the names of the parametric built-in gates, which
+// Factory does not resolve since they need an angle.
+var paramNames = []string{"p", "cp", "rx", "ry", "rz", "gpi", "gpi2", "ms"}
+
+// Reserved reports whether name is taken by a built-in gate: an alias
+// Factory resolves or the name of a parametric gate. NewComposite and
+// Register refuse such names.
+func Reserved(name string) bool {
+	key := norm(name)
+	if _, err := builtin(key); err == nil {
+		return true
+	}
+	return slices.Contains(paramNames, key)
+}
+
 func norm(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
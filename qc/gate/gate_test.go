@@ -71,6 +71,9 @@ func TestFactory(t *testing.T) {
 		{"m", Measure()},
 		{"measure", Measure()},
 		{"meas", Measure()},
+		{"sx", SX()},
+		{"ECR", ECR()},
+		{"iswap", ISWAP()},
 	}
 
 	for _, tc := range testCases {
@@ -104,3 +107,244 @@ func TestFactory_NonExistentGate(t *testing.T) {
 	assert.ErrorIs(err, ErrUnknownGate{nonExistentGate}, "Error type should be ErrUnknownGate")
 	assert.Contains(err.Error(), nonExistentGate, "Error message should contain the non-existent gate name")
 }
+
+func TestComposite(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bell, err := NewComposite("Bell", 2, []Step{
+		{G: H(), Qubits: []int{0}},
+		{G: CNOT(), Qubits: []int{0, 1}},
+	})
+	require.NoError(err)
+	assert.Equal("Bell", bell.Name())
+	assert.Equal(2, bell.QubitSpan())
+	assert.Equal([]int{0, 1}, bell.Targets())
+	assert.Empty(bell.Controls())
+
+	nested, err := NewComposite("Outer", 3, []Step{
+		{G: bell, Qubits: []int{2, 0}},
+		{G: X(), Qubits: []int{1}},
+	})
+	require.NoError(err)
+
+	var names []string
+	var qubits [][]int
+	err = Expand(nested, []int{5, 6, 7}, func(g Gate, qs []int) error {
+		names = append(names, g.Name())
+		qubits = append(qubits, qs)
+		return nil
+	})
+	require.NoError(err)
+	assert.Equal([]string{"H", "CNOT", "X"}, names)
+	assert.Equal([][]int{{7}, {7, 5}, {6}}, qubits)
+
+	_, err = NewComposite("Bad", 1, []Step{{G: CNOT(), Qubits: []int{0, 1}}})
+	assert.Error(err, "step outside span should be rejected")
+	_, err = NewComposite("Bad", 1, []Step{{G: Measure(), Qubits: []int{0}}})
+	assert.Error(err, "measurement should be rejected")
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	g, err := NewComposite("MyGate", 1, []Step{{G: X(), Qubits: []int{0}}})
+	require.NoError(err)
+	require.NoError(Register(g))
+	defer Unregister("MyGate")
+
+	got, err := Factory(" mygate ")
+	require.NoError(err)
+	assert.Same(g, got)
+
+	assert.Error(Register(g), "duplicate registration should fail")
+	assert.Error(Register(CNOT()), "built-in names cannot be shadowed")
+	for _, name := range []string{"H", "cx", "Toffoli", "RZ", "cp"} {
+		_, err := NewComposite(name, 2, nil)
+		assert.ErrorContains(err, "shadows a built-in gate", name)
+	}
+}
+
+func TestParametric(t *testing.T) {
+	assert := assert.New(t)
+
+	p, ok := P(0.25).(Parametric)
+	assert.True(ok)
+	assert.Equal("P", p.Name())
+	assert.Equal([]float64{0.25}, p.Params())
+
+	cp := CP(1.5)
+	assert.Equal(2, cp.QubitSpan())
+	assert.Equal([]int{0}, cp.Controls())
+	assert.Equal([]int{1}, cp.Targets())
+
+	for _, g := range []Gate{RX(0.5), RY(0.5), RZ(0.5)} {
+		r, ok := g.(Parametric)
+		assert.True(ok, g.Name())
+		assert.Equal(1, r.QubitSpan())
+		assert.Equal([]float64{0.5}, r.Params())
+	}
+
+	_, ok = H().(Parametric)
+	assert.False(ok, "fixed gates carry no parameters")
+}
+
+func TestNative(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("SX", SX().Name())
+	assert.Equal(2, ECR().QubitSpan())
+	assert.Equal("GPI", GPI(0.785398).Name())
+	assert.Equal([]float64{0.785398}, GPI(0.785398).(Parametric).Params())
+	assert.Equal([]float64{0, 1.5708}, MS(0, 1.5708).(Parametric).Params())
+	assert.Equal(2, MS(0, 0).QubitSpan())
+	assert.Empty(SX().(Parametric).Params())
+	assert.True(Reserved("gpi2"), "native gates with angles cannot be redefined")
+
+	// GPI2 is RX(π/2) between opposite phases.
+	var names []string
+	assert.NoError(Expand(GPI2(0), []int{3}, func(g Gate, qs []int) error {
+		names = append(names, g.Name())
+		assert.Equal([]int{3}, qs)
+		return nil
+	}))
+	assert.Equal([]string{"P", "RX", "P"}, names)
+}
+
+func TestArity(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, g := range []Gate{H(), X(), Y(), S(), Z(), P(1), RX(1), RY(1), RZ(1), Swap(), CNOT(), CZ(), CP(1), Toffoli(), Fredkin()} {
+		_, one := g.(SingleQubitGate)
+		_, two := g.(TwoQubitGate)
+		_, three := g.(ThreeQubitGate)
+		assert.Equal(g.QubitSpan() == 1, one, g.Name())
+		assert.Equal(g.QubitSpan() == 2, two, g.Name())
+		assert.Equal(g.QubitSpan() == 3, three, g.Name())
+	}
+	_, ok := Measure().(SingleQubitGate)
+	assert.False(ok, "measurement is not a unitary gate")
+}
+
+func TestMatrix(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	near := func(want, got [][]complex128, msg string) {
+		require.Len(got, len(want), msg)
+		for i := range want {
+			for j := range want[i] {
+				assert.InDelta(real(want[i][j]), real(got[i][j]), 1e-12, "%s [%d][%d]", msg, i, j)
+				assert.InDelta(imag(want[i][j]), imag(got[i][j]), 1e-12, "%s [%d][%d]", msg, i, j)
+			}
+		}
+	}
+
+	// Qubit 0 is bit 0: CNOT flips bit 1 where bit 0 is set.
+	m, err := Matrix(CNOT())
+	require.NoError(err)
+	near([][]complex128{{1, 0, 0, 0}, {0, 0, 0, 1}, {0, 0, 1, 0}, {0, 1, 0, 0}}, m, "CNOT")
+
+	m, err = Matrix(SX())
+	require.NoError(err)
+	near([][]complex128{{0.5 + 0.5i, 0.5 - 0.5i}, {0.5 - 0.5i, 0.5 + 0.5i}}, m, "SX")
+
+	m, err = Matrix(ISWAP())
+	require.NoError(err)
+	near([][]complex128{{1, 0, 0, 0}, {0, 0, 1i, 0}, {0, 1i, 0, 0}, {0, 0, 0, 1}}, m, "ISWAP")
+
+	m, err = Matrix(Toffoli())
+	require.NoError(err)
+	assert.Equal(complex(1, 0), m[7][3], "|011⟩ → |111⟩")
+	m, err = Matrix(Fredkin())
+	require.NoError(err)
+	assert.Equal(complex(1, 0), m[5][3], "|011⟩ → |101⟩")
+
+	_, err = Matrix(Measure())
+	assert.Error(err)
+}
+
+func TestAll(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	g, err := NewComposite("Flip", 1, []Step{{G: X(), Qubits: []int{0}}})
+	require.NoError(err)
+	require.NoError(Register(g))
+	defer Unregister("Flip")
+
+	byName := map[string]Descriptor{}
+	for _, d := range All() {
+		_, dup := byName[d.Name]
+		assert.False(dup, d.Name)
+		byName[d.Name] = d
+		for _, a := range d.Aliases {
+			f, err := Factory(a)
+			if assert.NoError(err, a) {
+				assert.Equal(d.Name, f.Name(), a)
+			}
+		}
+	}
+
+	cnot := byName["CNOT"]
+	assert.Equal([]string{"cx", "cnot"}, cnot.Aliases)
+	assert.Equal(2, cnot.Qubits)
+	assert.Equal("⊕", cnot.Symbol)
+	assert.Len(cnot.Matrix, 4)
+	assert.False(cnot.Custom)
+
+	assert.Nil(byName["MEASURE"].Matrix)
+	assert.Equal(2, byName["MS"].Params)
+	assert.Empty(byName["RZ"].Aliases)
+
+	flip := byName["Flip"]
+	assert.True(flip.Custom)
+	assert.Equal([]string{"flip"}, flip.Aliases)
+	assert.Equal([][]complex128{{0, 1}, {1, 0}}, flip.Matrix)
+}
+
+func TestDefine(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	u, err := Matrix(ISWAP())
+	require.NoError(err)
+	g, err := Define(Custom{Name: "MySwap", Symbol: "iS", Qubits: 2, Steps: ISWAP().(*Composite).Steps(), Matrix: u})
+	require.NoError(err)
+	defer Unregister("MySwap")
+
+	assert.Equal("iS", g.DrawSymbol())
+	assert.Equal(u, g.Unitary())
+	got, err := Factory("myswap")
+	require.NoError(err)
+	assert.Same(g, got)
+	m, err := Matrix(g)
+	require.NoError(err)
+	assert.Equal(u, m)
+
+	plain, err := Define(Custom{Name: "Plain", Qubits: 1, Steps: []Step{{G: X(), Qubits: []int{0}}}})
+	require.NoError(err)
+	defer Unregister("Plain")
+	assert.Equal("Plain", plain.DrawSymbol())
+	assert.Nil(plain.Unitary())
+
+	steps := []Step{{G: H(), Qubits: []int{0}}}
+	_, err = Define(Custom{Name: "Wrong", Qubits: 1, Steps: steps, Matrix: [][]complex128{{0, 1}, {1, 0}}})
+	assert.ErrorContains(err, "do not implement")
+	// A matrix rounded to 6 digits needs a looser tolerance.
+	r := complex(0.707107, 0)
+	rounded := [][]complex128{{r, r}, {r, -r}}
+	_, err = Define(Custom{Name: "Rounded", Qubits: 1, Steps: steps, Matrix: rounded})
+	assert.ErrorContains(err, "do not implement")
+	_, err = Define(Custom{Name: "Rounded", Qubits: 1, Steps: steps, Matrix: rounded, Tolerance: 1e-6})
+	assert.NoError(err)
+	defer Unregister("Rounded")
+	_, err = Define(Custom{Name: "Negative", Qubits: 1, Steps: steps, Tolerance: -1})
+	assert.ErrorContains(err, "negative tolerance")
+	_, err = Define(Custom{Name: "Small", Qubits: 1, Steps: steps, Matrix: [][]complex128{{1}}})
+	assert.ErrorContains(err, "2×2")
+	_, err = Define(Custom{Name: "Plain", Qubits: 1, Steps: steps})
+	assert.ErrorContains(err, "already registered")
+	_, ok := lookup("wrong")
+	assert.False(ok, "failed definitions are not registered")
+}
@@ -0,0 +1,151 @@
+package gate
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// MaxMatrixQubits bounds Matrix: the unitary of a gate on n qubits has
+// 4^n entries.
+const MaxMatrixQubits = 10
+
+// Matrix returns the unitary of g as a 2^n×2^n matrix indexed [row][col],
+// n = g.QubitSpan(), with qubit q of the span bit q of the indices, as
+// synth.Decompose takes it. Composites are multiplied out from their
+// steps unless Define gave them a matrix. Measurements and loops have no
+// unitary.
+func Matrix(g Gate) ([][]complex128, error) {
+	if c, ok := g.(*Composite); ok && c.matrix != nil {
+		return c.Unitary(), nil
+	}
+	n := g.QubitSpan()
+	if n > MaxMatrixQubits {
+		return nil, fmt.Errorf("gate: matrix of %s on %d qubits, more than %d", g.Name(), n, MaxMatrixQubits)
+	}
+	qubits := make([]int, n)
+	for i := range qubits {
+		qubits[i] = i
+	}
+	m := make([][]complex128, 1<<n)
+	for i := range m {
+		m[i] = make([]complex128, 1<<n)
+	}
+	// Column c is the image of basis state c.
+	for c := range 1 << n {
+		v := make([]complex128, 1<<n)
+		v[c] = 1
+		err := Expand(g, qubits, func(p Gate, qs []int) error {
+			u, err := primitive(p)
+			if err != nil {
+				return err
+			}
+			applyLocal(v, u, qs)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for r := range v {
+			m[r][c] = v[r]
+		}
+	}
+	return m, nil
+}
+
+// primitive returns the row-major unitary of a built-in gate on its own
+// qubits, qubit i bit i.
+func primitive(g Gate) ([]complex128, error) {
+	angle := func() float64 { return g.(Parametric).Params()[0] }
+	permutation := func(k int, f func(int) int) []complex128 {
+		m := make([]complex128, 1<<(2*k))
+		for in := range 1 << k {
+			m[f(in)<<k|in] = 1
+		}
+		return m
+	}
+	r := complex(1/math.Sqrt2, 0)
+	switch g.Name() {
+	case "H":
+		return []complex128{r, r, r, -r}, nil
+	case "X":
+		return []complex128{0, 1, 1, 0}, nil
+	case "Y":
+		return []complex128{0, -1i, 1i, 0}, nil
+	case "Z":
+		return []complex128{1, 0, 0, -1}, nil
+	case "S":
+		return []complex128{1, 0, 0, 1i}, nil
+	case "P":
+		return []complex128{1, 0, 0, cmplx.Exp(complex(0, angle()))}, nil
+	case "RX":
+		c, s := complex(math.Cos(angle()/2), 0), math.Sin(angle()/2)
+		return []complex128{c, complex(0, -s), complex(0, -s), c}, nil
+	case "RY":
+		c, s := complex(math.Cos(angle()/2), 0), math.Sin(angle()/2)
+		return []complex128{c, complex(-s, 0), complex(s, 0), c}, nil
+	case "RZ":
+		return []complex128{cmplx.Exp(complex(0, -angle()/2)), 0, 0, cmplx.Exp(complex(0, angle()/2))}, nil
+	case "CNOT":
+		return permutation(2, func(b int) int {
+			if b&1 != 0 {
+				return b ^ 2
+			}
+			return b
+		}), nil
+	case "CZ":
+		return []complex128{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, -1}, nil
+	case "CP":
+		return []complex128{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, cmplx.Exp(complex(0, angle()))}, nil
+	case "SWAP":
+		return permutation(2, func(b int) int { return b>>1 | (b&1)<<1 }), nil
+	case "TOFFOLI":
+		return permutation(3, func(b int) int {
+			if b&3 == 3 {
+				return b ^ 4
+			}
+			return b
+		}), nil
+	case "FREDKIN":
+		return permutation(3, func(b int) int {
+			if b&1 != 0 {
+				return b&1 | (b&2)<<1 | (b&4)>>1
+			}
+			return b
+		}), nil
+	}
+	return nil, fmt.Errorf("gate: %s has no matrix", g.Name())
+}
+
+// applyLocal multiplies the amplitudes of v on qubits qs by the row-major
+// unitary u, qs[i] bit i of u's indices.
+func applyLocal(v []complex128, u []complex128, qs []int) {
+	k := len(qs)
+	mask := 0
+	for _, q := range qs {
+		mask |= 1 << q
+	}
+	idx := make([]int, 1<<k)
+	in := make([]complex128, 1<<k)
+	for base := range v {
+		if base&mask != 0 {
+			continue
+		}
+		for j := range idx {
+			idx[j] = base
+			for i, q := range qs {
+				if j>>i&1 == 1 {
+					idx[j] |= 1 << q
+				}
+			}
+			in[j] = v[idx[j]]
+		}
+		for row := range idx {
+			var s complex128
+			for col, a := range in {
+				s += u[row<<k|col] * a
+			}
+			v[idx[row]] = s
+		}
+	}
+}
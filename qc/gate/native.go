@@ -0,0 +1,73 @@
+package gate
+
+import "math"
+
+// Native gates of common hardware. They are composites of the built-in
+// gates, exact up to global phase, so every backend runs them; renderers
+// and exporters show them by name. Gates with angles report them through
+// Params, as the parametric built-in gates do. Angles are in radians.
+
+var (
+	sxGate    = mustComposite("SX", 1, []Step{{hGate, []int{0}}, {sGate, []int{0}}, {hGate, []int{0}}})
+	ecrGate   = mustComposite("ECR", 2, ecrSteps())
+	iswapGate = mustComposite("ISWAP", 2, []Step{
+		{sGate, []int{0}}, {sGate, []int{1}}, {hGate, []int{0}},
+		{cnotG, []int{0, 1}}, {cnotG, []int{1, 0}}, {hGate, []int{1}},
+	})
+)
+
+// SX returns the square root of X, RX(π/2) up to global phase.
+func SX() Gate { return sxGate }
+
+// ECR returns the echoed cross-resonance gate (X⊗I − Y⊗X)/√2, qubit 0 the
+// control.
+func ECR() Gate { return ecrGate }
+
+// ISWAP returns the gate swapping |01⟩ and |10⟩ with a phase of i.
+func ISWAP() Gate { return iswapGate }
+
+func ecrSteps() []Step {
+	// exp(iπ/4 Z⊗X)·(X⊗I); the ZZ rotation is conjugated by H on qubit 1.
+	return []Step{
+		{xGate, []int{0}}, {hGate, []int{1}},
+		{cnotG, []int{0, 1}}, {RZ(-math.Pi / 2), []int{1}}, {cnotG, []int{0, 1}},
+		{hGate, []int{1}},
+	}
+}
+
+// GPI returns IonQ's π rotation about the axis at angle φ in the XY plane.
+func GPI(phi float64) Gate {
+	return withParams(mustComposite("GPI", 1, []Step{{P(-phi), []int{0}}, {xGate, []int{0}}, {P(phi), []int{0}}}), phi)
+}
+
+// GPI2 returns IonQ's π/2 rotation about the axis at angle φ in the XY
+// plane.
+func GPI2(phi float64) Gate {
+	return withParams(mustComposite("GPI2", 1, []Step{{P(-phi), []int{0}}, {RX(math.Pi / 2), []int{0}}, {P(phi), []int{0}}}), phi)
+}
+
+// MS returns IonQ's fully entangling Mølmer–Sørensen gate
+// exp(-iπ/4 σ(φ0)⊗σ(φ1)), σ(φ) = cos φ X + sin φ Y.
+func MS(phi0, phi1 float64) Gate {
+	return withParams(mustComposite("MS", 2, []Step{
+		{P(-phi0), []int{0}}, {P(-phi1), []int{1}},
+		{hGate, []int{0}}, {hGate, []int{1}},
+		{cnotG, []int{0, 1}}, {RZ(math.Pi / 2), []int{1}}, {cnotG, []int{0, 1}},
+		{hGate, []int{0}}, {hGate, []int{1}},
+		{P(phi0), []int{0}}, {P(phi1), []int{1}},
+	}), phi0, phi1)
+}
+
+// withParams records the angles c was built from.
+func withParams(c *Composite, params ...float64) *Composite {
+	c.params = params
+	return c
+}
+
+func mustComposite(name string, span int, steps []Step) *Composite {
+	c, err := newComposite(name, span, steps)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
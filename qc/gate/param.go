@@ -0,0 +1,63 @@
+package gate
+
+// Parametric is implemented by gates that carry continuous angles. It is
+// kept apart from Gate so passes that only care about wiring never see it.
+// Composites implement it too, with no angles unless they are native
+// gates that take them.
+type Parametric interface {
+	Gate
+	Params() []float64
+}
+
+// phase is diag(1, e^{iθ}) on the target, optionally controlled.
+type phase struct {
+	name, symbol      string
+	span              int
+	theta             float64
+	targets, controls []int
+}
+
+func (g phase) Name() string       { return g.name }
+func (g phase) QubitSpan() int     { return g.span }
+func (g phase) DrawSymbol() string { return g.symbol }
+func (g phase) Targets() []int     { return g.targets }
+func (g phase) Controls() []int    { return g.controls }
+func (g phase) Params() []float64  { return []float64{g.theta} }
+
+// phase1 and phase2 give P and CP distinct types for their arity.
+type (
+	phase1 struct{ phase }
+	phase2 struct{ phase }
+)
+
+// P returns the single-qubit phase gate diag(1, e^{iθ}).
+func P(theta float64) SingleQubitGate {
+	return phase1{phase{name: "P", symbol: "P", span: 1, theta: theta, targets: []int{0}, controls: []int{}}}
+}
+
+// CP returns the controlled phase gate: e^{iθ} on |11⟩. Control 0, target 1.
+func CP(theta float64) TwoQubitGate {
+	return phase2{phase{name: "CP", symbol: "P", span: 2, theta: theta, targets: []int{1}, controls: []int{0}}}
+}
+
+// rotation is exp(-iθσ/2) about one Pauli axis.
+type rotation struct {
+	name  string
+	theta float64
+}
+
+func (g rotation) Name() string       { return g.name }
+func (g rotation) QubitSpan() int     { return 1 }
+func (g rotation) DrawSymbol() string { return g.name }
+func (g rotation) Targets() []int     { return []int{0} }
+func (g rotation) Controls() []int    { return []int{} }
+func (g rotation) Params() []float64  { return []float64{g.theta} }
+
+// RX returns the rotation by θ about the X axis.
+func RX(theta float64) SingleQubitGate { return rotation{"RX", theta} }
+
+// RY returns the rotation by θ about the Y axis.
+func RY(theta float64) SingleQubitGate { return rotation{"RY", theta} }
+
+// RZ returns the rotation by θ about the Z axis, diag(e^{-iθ/2}, e^{iθ/2}).
+func RZ(theta float64) SingleQubitGate { return rotation{"RZ", theta} }
@@ -0,0 +1,331 @@
+// Package interop converts circuits to and from the formats of other
+// quantum toolkits.
+package interop
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// qelib maps built-in gates to their qelib1.inc names. P and CP are
+// written as u1 and cu1, which are the same matrices.
+var qelib = map[string]string{
+	"H": "h", "X": "x", "Y": "y", "Z": "z", "S": "s",
+	"P": "u1", "RX": "rx", "RY": "ry", "RZ": "rz",
+	"CNOT": "cx", "CZ": "cz", "CP": "cu1", "TOFFOLI": "ccx",
+}
+
+// reserved are the keywords and qelib1.inc gates; user definitions must
+// not reuse them.
+var reserved = map[string]bool{
+	"measure": true, "reset": true, "barrier": true, "gate": true,
+	"opaque": true, "if": true, "pi": true, "qreg": true, "creg": true,
+	"u3": true, "u2": true, "u1": true, "cx": true, "id": true, "u0": true,
+	"x": true, "y": true, "z": true, "h": true, "s": true, "sdg": true,
+	"t": true, "tdg": true, "rx": true, "ry": true, "rz": true, "cz": true,
+	"cy": true, "ch": true, "ccx": true, "crz": true, "cu1": true, "cu3": true,
+	"U": true, "CX": true,
+}
+
+// QASM2 renders c as OpenQASM 2.0 against qelib1.inc, the format Qiskit
+// loads directly with qiskit.qasm2.loads or QuantumCircuit.from_qasm_str.
+// It stands in for QPY, whose binary layout changes with Qiskit releases,
+// and for Qiskit's JSON (Qobj) form, which recent Qiskit no longer loads
+// into a circuit. See WriteQASM2.
+func QASM2(c circuit.Circuit) (string, error) {
+	var sb strings.Builder
+	if err := WriteQASM2(&sb, c); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// WriteQASM2 is QASM2 to an io.Writer. The output uses one quantum
+// register "q" and the circuit's classical registers (or a single register
+// "c" when some bits are anonymous). Angles are written in full precision,
+// so parameterized gates survive the round trip exactly. Composite gates
+// become gate definitions and Opaque gates opaque declarations; SWAP and
+// FREDKIN, which qelib1.inc lacks, are written as their CNOT/Toffoli
+// decompositions. A condition becomes if(creg==value) and must therefore
+// read a whole register, in order, and not be negated. Loops have no
+// OpenQASM 2 form and are rejected.
+func WriteQASM2(w io.Writer, c circuit.Circuit) error {
+	qw := &qasmWriter{defined: map[*gate.Composite]string{}, used: map[string]bool{}, wrapped: map[string]*gate.Composite{}, opaques: map[string]string{}}
+	regs := c.CRegs()
+	covered := 0
+	for _, r := range regs {
+		covered += r.Size
+	}
+	if covered != c.Clbits() {
+		regs = []circuit.Register{{Name: "c", Size: c.Clbits()}}
+	}
+	if c.Clbits() == 0 {
+		regs = nil
+	}
+	// Gates and registers share one namespace.
+	qw.used["q"] = true
+	for _, r := range regs {
+		qw.used[r.Name] = true
+	}
+
+	var body strings.Builder
+	for i, op := range c.OpsIter() {
+		if op.Loop != nil {
+			return fmt.Errorf("interop: operation %d: loops cannot be written as OpenQASM 2", i)
+		}
+		if op.Cond != nil {
+			cond, err := qasmCondition(*op.Cond, regs)
+			if err != nil {
+				return fmt.Errorf("interop: operation %d: %w", i, err)
+			}
+			body.WriteString(cond)
+		}
+		if op.G.Name() == "MEASURE" {
+			fmt.Fprintf(&body, "measure q[%d] -> %s;\n", op.Qubits[0], qasmBit(op.Cbit, regs))
+			continue
+		}
+		args := make([]string, len(op.Qubits))
+		for j, q := range op.Qubits {
+			args[j] = fmt.Sprintf("q[%d]", q)
+		}
+		if op.Cond != nil && (op.G.Name() == "SWAP" || op.G.Name() == "FREDKIN") {
+			// if() covers a single statement, so the decomposition
+			// needs a gate of its own.
+			name, err := qw.define(qw.wrap(op.G))
+			if err != nil {
+				return fmt.Errorf("interop: operation %d: %w", i, err)
+			}
+			fmt.Fprintf(&body, "%s %s;\n", name, strings.Join(args, ","))
+			continue
+		}
+		if err := qw.apply(&body, op.G, args); err != nil {
+			return fmt.Errorf("interop: operation %d: %w", i, err)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("OPENQASM 2.0;\ninclude \"qelib1.inc\";\n")
+	sb.WriteString(qw.defs.String())
+	fmt.Fprintf(&sb, "qreg q[%d];\n", c.Qubits())
+	for _, r := range regs {
+		fmt.Fprintf(&sb, "creg %s[%d];\n", r.Name, r.Size)
+	}
+	sb.WriteString(body.String())
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type qasmWriter struct {
+	defs    strings.Builder
+	defined map[*gate.Composite]string
+	used    map[string]bool
+	wrapped map[string]*gate.Composite
+	opaques map[string]string
+}
+
+// wrap turns a lone SWAP or FREDKIN into a composite of itself, so that it
+// can be defined as a gate.
+func (qw *qasmWriter) wrap(g gate.Gate) *gate.Composite {
+	if c, ok := qw.wrapped[g.Name()]; ok {
+		return c
+	}
+	qs := make([]int, g.QubitSpan())
+	for i := range qs {
+		qs[i] = i
+	}
+	c, _ := gate.NewComposite("qcm_"+strings.ToLower(g.Name()), g.QubitSpan(), []gate.Step{{G: g, Qubits: qs}})
+	qw.wrapped[g.Name()] = c
+	return c
+}
+
+// apply writes g on args (already formatted operands) to sb, defining any
+// composite it needs first.
+func (qw *qasmWriter) apply(sb *strings.Builder, g gate.Gate, args []string) error {
+	switch g.Name() {
+	case "SWAP":
+		a, b := args[0], args[1]
+		fmt.Fprintf(sb, "cx %s,%s;\ncx %s,%s;\ncx %s,%s;\n", a, b, b, a, a, b)
+		return nil
+	case "FREDKIN":
+		c, a, b := args[0], args[1], args[2]
+		fmt.Fprintf(sb, "cx %s,%s;\nccx %s,%s,%s;\ncx %s,%s;\n", b, a, c, a, b, b, a)
+		return nil
+	}
+	if op, ok := g.(*Opaque); ok {
+		call, err := qw.declareOpaque(op)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(sb, "%s %s;\n", call, strings.Join(args, ","))
+		return nil
+	}
+	if comp, ok := g.(*gate.Composite); ok {
+		name, err := qw.define(comp)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(sb, "%s %s;\n", name, strings.Join(args, ","))
+		return nil
+	}
+	name, ok := qelib[g.Name()]
+	if !ok {
+		return fmt.Errorf("gate %s has no OpenQASM 2 equivalent", g.Name())
+	}
+	if pg, ok := g.(gate.Parametric); ok {
+		ps := make([]string, len(pg.Params()))
+		for i, p := range pg.Params() {
+			s, err := qasmReal(p)
+			if err != nil {
+				return fmt.Errorf("gate %s: %w", g.Name(), err)
+			}
+			ps[i] = s
+		}
+		name += "(" + strings.Join(ps, ",") + ")"
+	}
+	fmt.Fprintf(sb, "%s %s;\n", name, strings.Join(args, ","))
+	return nil
+}
+
+// define writes a gate definition for c, and for the composites it uses,
+// once, and returns the name it was given.
+func (qw *qasmWriter) define(c *gate.Composite) (string, error) {
+	if name, ok := qw.defined[c]; ok {
+		return name, nil
+	}
+	params := make([]string, c.QubitSpan())
+	for i := range params {
+		params[i] = fmt.Sprintf("a%d", i)
+	}
+	var body strings.Builder
+	for _, s := range c.Steps() {
+		args := make([]string, len(s.Qubits))
+		for i, q := range s.Qubits {
+			args[i] = params[q]
+		}
+		body.WriteString("  ")
+		var line strings.Builder
+		if err := qw.apply(&line, s.G, args); err != nil {
+			return "", fmt.Errorf("composite %s: %w", c.Name(), err)
+		}
+		// Decompositions span several lines; indent each.
+		body.WriteString(strings.ReplaceAll(strings.TrimSuffix(line.String(), "\n"), "\n", "\n  "))
+		body.WriteByte('\n')
+	}
+	name := qw.identifier(c.Name())
+	qw.defined[c] = name
+	fmt.Fprintf(&qw.defs, "gate %s %s {\n%s}\n", name, strings.Join(params, ","), body.String())
+	return name, nil
+}
+
+// declareOpaque writes an opaque declaration for g's name, once, and
+// returns the call that applies g, parameters included.
+func (qw *qasmWriter) declareOpaque(g *Opaque) (string, error) {
+	name, ok := qw.opaques[g.Name()]
+	if !ok {
+		name = qw.identifier(g.Name())
+		qw.opaques[g.Name()] = name
+		decl := name
+		if len(g.params) > 0 {
+			ps := make([]string, len(g.params))
+			for i := range ps {
+				ps[i] = fmt.Sprintf("p%d", i)
+			}
+			decl += "(" + strings.Join(ps, ",") + ")"
+		}
+		qs := make([]string, g.span)
+		for i := range qs {
+			qs[i] = fmt.Sprintf("a%d", i)
+		}
+		fmt.Fprintf(&qw.defs, "opaque %s %s;\n", decl, strings.Join(qs, ","))
+	}
+	if len(g.params) == 0 {
+		return name, nil
+	}
+	ps := make([]string, len(g.params))
+	for i, p := range g.params {
+		s, err := qasmReal(p)
+		if err != nil {
+			return "", fmt.Errorf("gate %s: %w", g.Name(), err)
+		}
+		ps[i] = s
+	}
+	return name + "(" + strings.Join(ps, ",") + ")", nil
+}
+
+// identifier makes a valid, unused OpenQASM 2 gate name from name.
+func (qw *qasmWriter) identifier(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	id := sb.String()
+	if id == "" || id[0] < 'a' || id[0] > 'z' {
+		id = "g" + id
+	}
+	base := id
+	for i := 2; reserved[id] || qw.used[id]; i++ {
+		id = fmt.Sprintf("%s_%d", base, i)
+	}
+	qw.used[id] = true
+	return id
+}
+
+// qasmReal formats v so that it parses back to the same float64. OpenQASM
+// 2 reals need a decimal point.
+func qasmReal(v float64) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", fmt.Errorf("angle %v is not finite", v)
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".") {
+		mant, exp, hasExp := strings.Cut(s, "e")
+		s = mant + ".0"
+		if hasExp {
+			s += "e" + exp
+		}
+	}
+	return s, nil
+}
+
+func qasmBit(cb int, regs []circuit.Register) string {
+	for _, r := range regs {
+		if cb >= r.Start && cb < r.Start+r.Size {
+			return fmt.Sprintf("%s[%d]", r.Name, cb-r.Start)
+		}
+	}
+	return fmt.Sprintf("c[%d]", cb)
+}
+
+// qasmCondition returns the if( ) prefix for cond, which must compare a
+// whole register.
+func qasmCondition(cond circuit.Condition, regs []circuit.Register) (string, error) {
+	if cond.Negate {
+		return "", fmt.Errorf("negated conditions cannot be written as OpenQASM 2")
+	}
+	for _, r := range regs {
+		if r.Size != len(cond.Cbits) {
+			continue
+		}
+		whole := true
+		for i, cb := range cond.Cbits {
+			if cb != r.Start+i {
+				whole = false
+				break
+			}
+		}
+		if whole {
+			return fmt.Sprintf("if(%s==%d) ", r.Name, cond.Value), nil
+		}
+	}
+	return "", fmt.Errorf("condition on bits %v does not cover a whole classical register", cond.Cbits)
+}
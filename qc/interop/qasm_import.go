@@ -0,0 +1,947 @@
+package interop
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// qelib1 is the standard qelib1.inc. Gates with a built-in equivalent (see
+// qelibNative) are played as that gate; the others are built from these
+// definitions.
+const qelib1 = `
+gate u3(theta,phi,lambda) q { U(theta,phi,lambda) q; }
+gate u2(phi,lambda) q { U(pi/2,phi,lambda) q; }
+gate u1(lambda) q { U(0,0,lambda) q; }
+gate cx c,t { CX c,t; }
+gate id a { U(0,0,0) a; }
+gate u0(gamma) q { U(0,0,0) q; }
+gate u(theta,phi,lambda) q { U(theta,phi,lambda) q; }
+gate p(lambda) q { U(0,0,lambda) q; }
+gate x a { u3(pi,0,pi) a; }
+gate y a { u3(pi,pi/2,pi/2) a; }
+gate z a { u1(pi) a; }
+gate h a { u2(0,pi) a; }
+gate s a { u1(pi/2) a; }
+gate sdg a { u1(-pi/2) a; }
+gate t a { u1(pi/4) a; }
+gate tdg a { u1(-pi/4) a; }
+gate rx(theta) a { u3(theta,-pi/2,pi/2) a; }
+gate ry(theta) a { u3(theta,0,0) a; }
+gate rz(phi) a { u1(phi) a; }
+gate sx a { sdg a; h a; sdg a; }
+gate sxdg a { s a; h a; s a; }
+gate cz a,b { h b; cx a,b; h b; }
+gate cy a,b { sdg b; cx a,b; s b; }
+gate swap a,b { cx a,b; cx b,a; cx a,b; }
+gate ch a,b { h b; sdg b; cx a,b; h b; t b; cx a,b; t b; h b; s b; x b; s a; }
+gate ccx a,b,c {
+  h c; cx b,c; tdg c; cx a,c; t c; cx b,c; tdg c; cx a,c;
+  t b; t c; h c; cx a,b; t a; tdg b; cx a,b;
+}
+gate cswap a,b,c { cx c,b; ccx a,b,c; cx c,b; }
+gate crx(lambda) a,b { u1(pi/2) b; cx a,b; u3(-lambda/2,0,0) b; cx a,b; u3(lambda/2,-pi/2,0) b; }
+gate cry(lambda) a,b { ry(lambda/2) b; cx a,b; ry(-lambda/2) b; cx a,b; }
+gate crz(lambda) a,b { rz(lambda/2) b; cx a,b; rz(-lambda/2) b; cx a,b; }
+gate cu1(lambda) a,b { u1(lambda/2) a; cx a,b; u1(-lambda/2) b; cx a,b; u1(lambda/2) b; }
+gate cp(lambda) a,b { p(lambda/2) a; cx a,b; p(-lambda/2) b; cx a,b; p(lambda/2) b; }
+gate cu3(theta,phi,lambda) c,t {
+  u1((lambda+phi)/2) c; u1((lambda-phi)/2) t; cx c,t;
+  u3(-theta/2,0,-(phi+lambda)/2) t; cx c,t; u3(theta/2,phi,0) t;
+}
+gate csx a,b { h b; cu1(pi/2) a,b; h b; }
+gate cu(theta,phi,lambda,gamma) c,t {
+  p(gamma) c; p((lambda+phi)/2) c; p((lambda-phi)/2) t; cx c,t;
+  u(-theta/2,0,-(phi+lambda)/2) t; cx c,t; u(theta/2,phi,0) t;
+}
+gate rxx(theta) a,b { u3(pi/2,theta,0) a; h b; cx a,b; u1(-theta) b; cx a,b; h b; u2(-pi,pi-theta) a; }
+gate rzz(theta) a,b { cx a,b; u1(theta) b; cx a,b; }
+gate rccx a,b,c { u2(0,pi) c; u1(pi/4) c; cx b,c; u1(-pi/4) c; cx a,c; u1(pi/4) c; cx b,c; u1(-pi/4) c; u2(0,pi) c; }
+`
+
+// qelibNative maps the qelib1.inc gates that have a built-in equivalent
+// to it. All are the same matrix except rz, which qelib1.inc defines as
+// u1 and so differs from RZ by a global phase; Qiskit reads rz as RZ too.
+// A nil gate is the identity.
+var qelibNative = map[string]func(p []float64) gate.Gate{
+	"id":    func([]float64) gate.Gate { return nil },
+	"h":     func([]float64) gate.Gate { return gate.H() },
+	"x":     func([]float64) gate.Gate { return gate.X() },
+	"y":     func([]float64) gate.Gate { return gate.Y() },
+	"z":     func([]float64) gate.Gate { return gate.Z() },
+	"s":     func([]float64) gate.Gate { return gate.S() },
+	"u1":    func(p []float64) gate.Gate { return gate.P(p[0]) },
+	"p":     func(p []float64) gate.Gate { return gate.P(p[0]) },
+	"rx":    func(p []float64) gate.Gate { return gate.RX(p[0]) },
+	"ry":    func(p []float64) gate.Gate { return gate.RY(p[0]) },
+	"rz":    func(p []float64) gate.Gate { return gate.RZ(p[0]) },
+	"cx":    func([]float64) gate.Gate { return gate.CNOT() },
+	"cz":    func([]float64) gate.Gate { return gate.CZ() },
+	"cu1":   func(p []float64) gate.Gate { return gate.CP(p[0]) },
+	"cp":    func(p []float64) gate.Gate { return gate.CP(p[0]) },
+	"swap":  func([]float64) gate.Gate { return gate.Swap() },
+	"ccx":   func([]float64) gate.Gate { return gate.Toffoli() },
+	"cswap": func([]float64) gate.Gate { return gate.Fredkin() },
+}
+
+// Opaque is a gate declared with OpenQASM's opaque statement: a name, a
+// span and its parameters, with no definition. Renderers draw it and
+// exporters write it back, but runners cannot play it.
+type Opaque struct {
+	name   string
+	span   int
+	params []float64
+}
+
+func (g *Opaque) Name() string       { return g.name }
+func (g *Opaque) QubitSpan() int     { return g.span }
+func (g *Opaque) DrawSymbol() string { return g.name }
+func (g *Opaque) Controls() []int    { return []int{} }
+func (g *Opaque) Params() []float64  { return append([]float64(nil), g.params...) }
+
+// Targets reports every qubit in the span.
+func (g *Opaque) Targets() []int {
+	t := make([]int, g.span)
+	for i := range t {
+		t[i] = i
+	}
+	return t
+}
+
+// FromQASM2 parses an OpenQASM 2.0 program.
+//
+// Quantum registers are laid out one after another in declaration order,
+// and classical registers become the circuit's named registers. U and CX
+// are built in; include "qelib1.inc" adds the standard library, whose
+// gates map to the built-in gate of the same matrix where there is one (h
+// to H, cu1 to CP, ccx to TOFFOLI, …) and are otherwise built from their
+// qelib1.inc definitions. Each gate definition becomes a composite gate,
+// one per distinct set of parameters, named after the definition and its
+// parameters. An opaque gate resolves to a gate registered with
+// gate.Register under the same name and span when there is one, and is an
+// Opaque placeholder otherwise. Statements on whole registers are
+// broadcast. barrier is skipped; reset, which has no equivalent, and
+// includes other than qelib1.inc are errors.
+func FromQASM2(src string) (circuit.Circuit, error) {
+	toks, err := qasmTokens(src)
+	if err != nil {
+		return nil, fmt.Errorf("interop: qasm: %w", err)
+	}
+	p := &qasmProgram{defs: map[string]*qasmDef{}, regs: map[string]qasmReg{}, instances: map[string]gate.Gate{}}
+	if err := p.parse(&qasmParser{toks: toks}, false); err != nil {
+		return nil, fmt.Errorf("interop: qasm: %w", err)
+	}
+
+	opts := []builder.Option{builder.Q(max(p.qubits, 1))}
+	for _, r := range p.cregs {
+		opts = append(opts, builder.CReg(r.name, r.size))
+	}
+	b := builder.New(opts...)
+	for _, s := range p.stmts {
+		if err := p.play(b, s); err != nil {
+			return nil, fmt.Errorf("interop: qasm: line %d: %w", s.line, err)
+		}
+	}
+	c, err := b.BuildCircuit()
+	if err != nil {
+		return nil, fmt.Errorf("interop: qasm: %w", err)
+	}
+	return c, nil
+}
+
+// ---------- tokens ----------------------------------------------------
+
+type qasmToken struct {
+	text string
+	kind byte // 'i' identifier, 'n' number, 's' string, 'p' punctuation
+	line int
+}
+
+func qasmTokens(src string) ([]qasmToken, error) {
+	var toks []qasmToken
+	rs := []rune(src)
+	line := 1
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+				i++
+			}
+			toks = append(toks, qasmToken{string(rs[start:i]), 'i', line})
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.') {
+				i++
+			}
+			if i < len(rs) && (rs[i] == 'e' || rs[i] == 'E') {
+				i++
+				if i < len(rs) && (rs[i] == '+' || rs[i] == '-') {
+					i++
+				}
+				for i < len(rs) && unicode.IsDigit(rs[i]) {
+					i++
+				}
+			}
+			toks = append(toks, qasmToken{string(rs[start:i]), 'n', line})
+		case r == '"':
+			end := i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			if end == len(rs) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			toks = append(toks, qasmToken{string(rs[i+1 : end]), 's', line})
+			i = end + 1
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '>', r == '=' && i+1 < len(rs) && rs[i+1] == '=':
+			toks = append(toks, qasmToken{string(rs[i : i+2]), 'p', line})
+			i += 2
+		case strings.ContainsRune(";,()[]{}+-*/^", r):
+			toks = append(toks, qasmToken{string(r), 'p', line})
+			i++
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", line, r)
+		}
+	}
+	return toks, nil
+}
+
+type qasmParser struct {
+	toks []qasmToken
+	pos  int
+}
+
+func (ps *qasmParser) done() bool { return ps.pos >= len(ps.toks) }
+
+func (ps *qasmParser) peek() qasmToken {
+	if ps.done() {
+		return qasmToken{}
+	}
+	return ps.toks[ps.pos]
+}
+
+func (ps *qasmParser) line() int {
+	if ps.done() {
+		if len(ps.toks) == 0 {
+			return 1
+		}
+		return ps.toks[len(ps.toks)-1].line
+	}
+	return ps.toks[ps.pos].line
+}
+
+func (ps *qasmParser) next() qasmToken {
+	t := ps.peek()
+	ps.pos++
+	return t
+}
+
+// accept consumes the next token if its text is s.
+func (ps *qasmParser) accept(s string) bool {
+	if !ps.done() && ps.toks[ps.pos].text == s && ps.toks[ps.pos].kind != 's' {
+		ps.pos++
+		return true
+	}
+	return false
+}
+
+func (ps *qasmParser) expect(s string) error {
+	if !ps.accept(s) {
+		return fmt.Errorf("line %d: expected %q, got %q", ps.line(), s, ps.peek().text)
+	}
+	return nil
+}
+
+func (ps *qasmParser) ident() (string, error) {
+	t := ps.next()
+	if t.kind != 'i' {
+		return "", fmt.Errorf("line %d: expected a name, got %q", ps.line(), t.text)
+	}
+	return t.text, nil
+}
+
+func (ps *qasmParser) integer() (int, error) {
+	t := ps.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != 'n' || err != nil || n < 0 {
+		return 0, fmt.Errorf("line %d: expected a non-negative integer, got %q", t.line, t.text)
+	}
+	return n, nil
+}
+
+// idents reads a comma-separated list of names up to, not including, end.
+func (ps *qasmParser) idents(end string) ([]string, error) {
+	var out []string
+	for !ps.done() && ps.peek().text != end {
+		if len(out) > 0 {
+			if err := ps.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		id, err := ps.ident()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// exprs reads the comma-separated expressions of a parenthesised list,
+// after its "(", through its ")".
+func (ps *qasmParser) exprs() ([][]qasmToken, error) {
+	var out [][]qasmToken
+	var cur []qasmToken
+	depth := 0
+	for {
+		if ps.done() {
+			return nil, fmt.Errorf("line %d: missing )", ps.line())
+		}
+		t := ps.next()
+		switch {
+		case t.text == "(" && t.kind == 'p':
+			depth++
+		case t.text == ")" && t.kind == 'p' && depth == 0:
+			if len(cur) > 0 || len(out) > 0 {
+				out = append(out, cur)
+			}
+			return out, nil
+		case t.text == ")" && t.kind == 'p':
+			depth--
+		case t.text == "," && depth == 0:
+			out = append(out, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, t)
+	}
+}
+
+// ---------- program ---------------------------------------------------
+
+type qasmReg struct {
+	name        string
+	start, size int
+	classical   bool
+}
+
+// qasmArg is a register operand: a whole register (index -1) or one bit.
+// Inside a gate definition it names a formal argument.
+type qasmArg struct {
+	reg   string
+	index int
+}
+
+type qasmStmt struct {
+	line    int
+	name    string // gate name, or "measure"
+	params  [][]qasmToken
+	args    []qasmArg
+	cond    *qasmArg // the register compared by if(), with condValue
+	condVal int
+}
+
+type qasmDef struct {
+	name   string
+	params []string
+	qargs  []string
+	body   []qasmStmt
+	opaque bool
+	qelib  bool // defined by qelib1.inc
+}
+
+type qasmProgram struct {
+	defs      map[string]*qasmDef
+	qelib     bool
+	regs      map[string]qasmReg
+	cregs     []qasmReg
+	qubits    int
+	stmts     []qasmStmt
+	instances map[string]gate.Gate
+}
+
+// parse reads statements until the tokens run out. lib marks the
+// definitions of qelib1.inc.
+func (p *qasmProgram) parse(ps *qasmParser, lib bool) error {
+	if ps.accept("OPENQASM") {
+		v := ps.next()
+		if !strings.HasPrefix(v.text, "2") {
+			return fmt.Errorf("line %d: OpenQASM %s is not supported, only 2.0", v.line, v.text)
+		}
+		if err := ps.expect(";"); err != nil {
+			return err
+		}
+	}
+	for !ps.done() {
+		if err := p.statement(ps, lib); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *qasmProgram) statement(ps *qasmParser, lib bool) error {
+	line := ps.line()
+	switch {
+	case ps.accept("include"):
+		f := ps.next()
+		if f.kind != 's' {
+			return fmt.Errorf("line %d: include wants a file name", line)
+		}
+		if err := ps.expect(";"); err != nil {
+			return err
+		}
+		if f.text != "qelib1.inc" {
+			return fmt.Errorf("line %d: cannot include %q; only qelib1.inc is known", line, f.text)
+		}
+		if p.qelib {
+			return nil
+		}
+		p.qelib = true
+		toks, _ := qasmTokens(qelib1)
+		return p.parse(&qasmParser{toks: toks}, true)
+	case ps.accept("qreg"), ps.accept("creg"):
+		classical := ps.toks[ps.pos-1].text == "creg"
+		name, err := ps.ident()
+		if err != nil {
+			return err
+		}
+		if err := ps.expect("["); err != nil {
+			return err
+		}
+		size, err := ps.integer()
+		if err != nil {
+			return err
+		}
+		if err := p.declare(name, line); err != nil {
+			return err
+		}
+		r := qasmReg{name: name, size: size, classical: classical}
+		if classical {
+			for _, c := range p.cregs {
+				r.start += c.size
+			}
+			p.cregs = append(p.cregs, r)
+		} else {
+			r.start = p.qubits
+			p.qubits += size
+		}
+		p.regs[name] = r
+		if err := ps.expect("]"); err != nil {
+			return err
+		}
+		return ps.expect(";")
+	case ps.accept("gate"), ps.accept("opaque"):
+		return p.define(ps, ps.toks[ps.pos-1].text == "opaque", lib)
+	case ps.accept("reset"):
+		return fmt.Errorf("line %d: reset is not supported", line)
+	case ps.accept("if"):
+		if err := ps.expect("("); err != nil {
+			return err
+		}
+		reg, err := ps.ident()
+		if err != nil {
+			return err
+		}
+		if err := ps.expect("=="); err != nil {
+			return err
+		}
+		v, err := ps.integer()
+		if err != nil {
+			return err
+		}
+		if err := ps.expect(")"); err != nil {
+			return err
+		}
+		s, err := p.operation(ps)
+		if err != nil {
+			return err
+		}
+		s.cond, s.condVal = &qasmArg{reg: reg, index: -1}, v
+		p.stmts = append(p.stmts, s)
+		return nil
+	}
+	s, err := p.operation(ps)
+	if err != nil {
+		return err
+	}
+	if s.name != "barrier" {
+		p.stmts = append(p.stmts, s)
+	}
+	return nil
+}
+
+// declare claims name for a register or gate.
+func (p *qasmProgram) declare(name string, line int) error {
+	if _, ok := p.regs[name]; ok {
+		return fmt.Errorf("line %d: %s is already declared", line, name)
+	}
+	if _, ok := p.defs[name]; ok || name == "U" || name == "CX" {
+		return fmt.Errorf("line %d: %s is already declared", line, name)
+	}
+	return nil
+}
+
+// operation reads a gate call, measure or barrier.
+func (p *qasmProgram) operation(ps *qasmParser) (qasmStmt, error) {
+	s := qasmStmt{line: ps.line()}
+	name, err := ps.ident()
+	if err != nil {
+		return s, err
+	}
+	s.name = name
+	if name == "measure" {
+		src, err := qasmOperand(ps)
+		if err != nil {
+			return s, err
+		}
+		if err := ps.expect("->"); err != nil {
+			return s, err
+		}
+		dst, err := qasmOperand(ps)
+		if err != nil {
+			return s, err
+		}
+		s.args = []qasmArg{src, dst}
+		return s, ps.expect(";")
+	}
+	if ps.accept("(") {
+		if s.params, err = ps.exprs(); err != nil {
+			return s, err
+		}
+	}
+	for !ps.accept(";") {
+		if ps.done() {
+			return s, fmt.Errorf("line %d: missing ;", s.line)
+		}
+		if len(s.args) > 0 {
+			if err := ps.expect(","); err != nil {
+				return s, err
+			}
+		}
+		a, err := qasmOperand(ps)
+		if err != nil {
+			return s, err
+		}
+		s.args = append(s.args, a)
+	}
+	return s, nil
+}
+
+func qasmOperand(ps *qasmParser) (qasmArg, error) {
+	reg, err := ps.ident()
+	if err != nil {
+		return qasmArg{}, err
+	}
+	a := qasmArg{reg: reg, index: -1}
+	if ps.accept("[") {
+		if a.index, err = ps.integer(); err != nil {
+			return a, err
+		}
+		if err := ps.expect("]"); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// define reads a gate or opaque declaration after its keyword.
+func (p *qasmProgram) define(ps *qasmParser, opaque, lib bool) error {
+	line := ps.line()
+	name, err := ps.ident()
+	if err != nil {
+		return err
+	}
+	if err := p.declare(name, line); err != nil {
+		return err
+	}
+	d := &qasmDef{name: name, opaque: opaque, qelib: lib}
+	if ps.accept("(") {
+		if d.params, err = ps.idents(")"); err != nil {
+			return err
+		}
+		if err := ps.expect(")"); err != nil {
+			return err
+		}
+	}
+	end := "{"
+	if opaque {
+		end = ";"
+	}
+	if d.qargs, err = ps.idents(end); err != nil {
+		return err
+	}
+	if len(d.qargs) == 0 {
+		return fmt.Errorf("line %d: gate %s has no qubit arguments", line, name)
+	}
+	if err := ps.expect(end); err != nil {
+		return err
+	}
+	if opaque {
+		p.defs[name] = d
+		return nil
+	}
+	for !ps.accept("}") {
+		if ps.done() {
+			return fmt.Errorf("line %d: gate %s is not closed", line, name)
+		}
+		s, err := p.operation(ps)
+		if err != nil {
+			return err
+		}
+		if s.name == "measure" {
+			return fmt.Errorf("line %d: gate %s: measure is not allowed in a gate", s.line, name)
+		}
+		if s.name == "barrier" {
+			continue
+		}
+		if _, ok := p.defs[s.name]; !ok && s.name != "U" && s.name != "CX" {
+			return fmt.Errorf("line %d: gate %s uses undefined gate %s", s.line, name, s.name)
+		}
+		for _, a := range s.args {
+			if a.index >= 0 || !slices.Contains(d.qargs, a.reg) {
+				return fmt.Errorf("line %d: gate %s: %q is not one of its arguments", s.line, name, a.reg)
+			}
+		}
+		d.body = append(d.body, s)
+	}
+	p.defs[name] = d
+	return nil
+}
+
+// ---------- playing ---------------------------------------------------
+
+// play adds a top-level statement to b, broadcasting over registers.
+func (p *qasmProgram) play(b builder.Builder, s qasmStmt) error {
+	regs := make([][]int, len(s.args))
+	width := 1
+	for i, a := range s.args {
+		r, ok := p.regs[a.reg]
+		if !ok {
+			return fmt.Errorf("undeclared register %s", a.reg)
+		}
+		if wantClassical := s.name == "measure" && i == 1; r.classical != wantClassical {
+			return fmt.Errorf("%s is not a %s register", a.reg, map[bool]string{true: "classical", false: "quantum"}[wantClassical])
+		}
+		if a.index >= r.size {
+			return fmt.Errorf("%s[%d] is out of range", a.reg, a.index)
+		}
+		if a.index >= 0 {
+			regs[i] = []int{r.start + a.index}
+			continue
+		}
+		regs[i] = make([]int, r.size)
+		for j := range regs[i] {
+			regs[i][j] = r.start + j
+		}
+		if width > 1 && r.size != width {
+			return fmt.Errorf("registers of different sizes")
+		}
+		width = r.size
+	}
+
+	var cond *builder.Condition
+	if s.cond != nil {
+		r, ok := p.regs[s.cond.reg]
+		if !ok || !r.classical {
+			return fmt.Errorf("if() wants a classical register, got %s", s.cond.reg)
+		}
+		bits := make([]int, r.size)
+		for i := range bits {
+			bits[i] = r.start + i
+		}
+		c := builder.Bits(s.condVal, bits...)
+		cond = &c
+	}
+
+	params := make([]float64, len(s.params))
+	for i, e := range s.params {
+		v, err := qasmEval(e, nil)
+		if err != nil {
+			return err
+		}
+		params[i] = v
+	}
+	var err error
+	for k := range width {
+		qs := make([]int, len(regs))
+		for i, r := range regs {
+			qs[i] = r[min(k, len(r)-1)]
+		}
+		apply := func(b builder.Builder) {
+			if s.name == "measure" {
+				b.Measure(qs[0], qs[1])
+				return
+			}
+			if e := p.call(b, s.name, params, qs); e != nil && err == nil {
+				err = e
+			}
+		}
+		if cond != nil {
+			b.If(*cond, apply)
+		} else {
+			apply(b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call applies the gate name to qs.
+func (p *qasmProgram) call(b builder.Builder, name string, params []float64, qs []int) error {
+	want := func(np, nq int) error {
+		if len(params) != np || len(qs) != nq {
+			return fmt.Errorf("%s takes %d parameters and %d qubits, got %d and %d", name, np, nq, len(params), len(qs))
+		}
+		return nil
+	}
+	switch name {
+	case "U":
+		if err := want(3, 1); err != nil {
+			return err
+		}
+		// U(θ,φ,λ) = P(φ)·RY(θ)·P(λ) exactly.
+		b.P(params[2], qs[0]).RY(params[0], qs[0]).P(params[1], qs[0])
+		return nil
+	case "CX":
+		if err := want(0, 2); err != nil {
+			return err
+		}
+		b.CNOT(qs[0], qs[1])
+		return nil
+	}
+	d, ok := p.defs[name]
+	if !ok {
+		return fmt.Errorf("undefined gate %s", name)
+	}
+	if err := want(len(d.params), len(d.qargs)); err != nil {
+		return err
+	}
+	if native, ok := qelibNative[name]; ok && d.qelib {
+		if g := native(params); g != nil {
+			b.Apply(g, qs...)
+		}
+		return nil
+	}
+	g, err := p.instance(d, params)
+	if err != nil {
+		return err
+	}
+	b.Apply(g, qs...)
+	return nil
+}
+
+// instance returns the gate for d with the given parameters, building it
+// once.
+func (p *qasmProgram) instance(d *qasmDef, params []float64) (gate.Gate, error) {
+	key := fmt.Sprint(d.name, params)
+	if g, ok := p.instances[key]; ok {
+		return g, nil
+	}
+	label := d.name
+	if gate.Reserved(label) {
+		// qelib1.inc's t and sx, say, are not the built-in gates of those
+		// names (TOFFOLI and the SX composite).
+		label = "qasm_" + label
+	}
+	if len(params) > 0 {
+		ps := make([]string, len(params))
+		for i, v := range params {
+			ps[i] = strconv.FormatFloat(v, 'g', 4, 64)
+		}
+		label += "(" + strings.Join(ps, ",") + ")"
+	}
+
+	var g gate.Gate
+	if d.opaque {
+		g = &Opaque{name: d.name, span: len(d.qargs), params: append([]float64(nil), params...)}
+		if reg, err := gate.Factory(d.name); err == nil && reg.QubitSpan() == len(d.qargs) && len(params) == 0 {
+			g = reg
+		}
+	} else {
+		env := map[string]float64{}
+		for i, name := range d.params {
+			env[name] = params[i]
+		}
+		var bodyErr error
+		comp, err := builder.BuildGate(label, len(d.qargs), func(b builder.Builder, q []int) {
+			for _, s := range d.body {
+				bodyErr = p.playBody(b, d, s, env, q)
+				if bodyErr != nil {
+					return
+				}
+			}
+		})
+		if bodyErr != nil {
+			return nil, fmt.Errorf("gate %s: %w", d.name, bodyErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		g = comp
+	}
+	p.instances[key] = g
+	return g, nil
+}
+
+// playBody applies one statement of d's body to the definition's qubits.
+func (p *qasmProgram) playBody(b builder.Builder, d *qasmDef, s qasmStmt, env map[string]float64, q []int) error {
+	params := make([]float64, len(s.params))
+	for i, e := range s.params {
+		v, err := qasmEval(e, env)
+		if err != nil {
+			return err
+		}
+		params[i] = v
+	}
+	qs := make([]int, len(s.args))
+	for i, a := range s.args {
+		qs[i] = q[slices.Index(d.qargs, a.reg)]
+	}
+	return p.call(b, s.name, params, qs)
+}
+
+// ---------- expressions -----------------------------------------------
+
+// qasmEval evaluates an expression over pi, the parameters in env, + - *
+// / ^, and the functions sin, cos, tan, exp, ln and sqrt.
+func qasmEval(toks []qasmToken, env map[string]float64) (float64, error) {
+	if len(toks) == 0 {
+		return 0, fmt.Errorf("empty expression")
+	}
+	e := &qasmExpr{toks: toks, env: env}
+	v, err := e.sum()
+	if err == nil && e.pos < len(toks) {
+		err = fmt.Errorf("unexpected %q", toks[e.pos].text)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("expression: %w", err)
+	}
+	return v, nil
+}
+
+type qasmExpr struct {
+	toks []qasmToken
+	pos  int
+	env  map[string]float64
+}
+
+func (e *qasmExpr) peek() string {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos].text
+	}
+	return ""
+}
+
+func (e *qasmExpr) sum() (float64, error) {
+	v, err := e.product()
+	for err == nil && (e.peek() == "+" || e.peek() == "-") {
+		op := e.toks[e.pos].text
+		e.pos++
+		var w float64
+		if w, err = e.product(); op == "+" {
+			v += w
+		} else {
+			v -= w
+		}
+	}
+	return v, err
+}
+
+func (e *qasmExpr) product() (float64, error) {
+	v, err := e.unary()
+	for err == nil && (e.peek() == "*" || e.peek() == "/") {
+		op := e.toks[e.pos].text
+		e.pos++
+		var w float64
+		if w, err = e.unary(); op == "*" {
+			v *= w
+		} else {
+			v /= w
+		}
+	}
+	return v, err
+}
+
+func (e *qasmExpr) unary() (float64, error) {
+	if e.peek() == "-" {
+		e.pos++
+		v, err := e.unary()
+		return -v, err
+	}
+	if e.peek() == "+" {
+		e.pos++
+		return e.unary()
+	}
+	v, err := e.primary()
+	if err == nil && e.peek() == "^" {
+		e.pos++
+		var x float64
+		if x, err = e.unary(); err == nil {
+			v = math.Pow(v, x)
+		}
+	}
+	return v, err
+}
+
+var qasmFuncs = map[string]func(float64) float64{
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"exp": math.Exp, "ln": math.Log, "sqrt": math.Sqrt,
+}
+
+func (e *qasmExpr) primary() (float64, error) {
+	if e.pos >= len(e.toks) {
+		return 0, fmt.Errorf("unexpected end")
+	}
+	t := e.toks[e.pos]
+	e.pos++
+	switch {
+	case t.text == "(":
+		v, err := e.sum()
+		if err != nil {
+			return 0, err
+		}
+		if e.peek() != ")" {
+			return 0, fmt.Errorf("missing )")
+		}
+		e.pos++
+		return v, nil
+	case t.kind == 'n':
+		return strconv.ParseFloat(t.text, 64)
+	case t.text == "pi":
+		return math.Pi, nil
+	case t.kind == 'i':
+		if f, ok := qasmFuncs[t.text]; ok {
+			if e.peek() != "(" {
+				return 0, fmt.Errorf("%s wants (", t.text)
+			}
+			v, err := e.primary()
+			return f(v), err
+		}
+		if v, ok := e.env[t.text]; ok {
+			return v, nil
+		}
+		return 0, fmt.Errorf("unknown name %q", t.text)
+	}
+	return 0, fmt.Errorf("unexpected %q", t.text)
+}
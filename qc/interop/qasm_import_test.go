@@ -0,0 +1,189 @@
+package interop
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/bitorder"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func qasmState(t *testing.T, src string) []complex128 {
+	t.Helper()
+	c, err := FromQASM2(src)
+	require.NoError(t, err)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+	return sv
+}
+
+func TestFromQASM2(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := FromQASM2(`OPENQASM 2.0;
+include "qelib1.inc";
+// two registers, laid out a then b
+qreg a[2];
+qreg b[1];
+creg m[2];
+creg flag[1];
+gate bell x,y { h x; cx x,y; }
+gate tilt(theta) x { ry(theta/2) x; barrier x; }
+h a;
+bell a[1],b[0];
+tilt(pi) b[0];
+tilt(-pi) b[0];
+tilt(pi) a[0];
+measure a -> m;
+if(m==3) x b[0];
+measure b[0] -> flag[0];
+`)
+	require.NoError(err)
+	assert.Equal(3, c.Qubits())
+	assert.Equal(3, c.Clbits())
+	assert.Equal([]circuit.Register{{Name: "m", Start: 0, Size: 2}, {Name: "flag", Start: 2, Size: 1}}, c.CRegs())
+
+	var names []string
+	tilts := map[gate.Gate]bool{}
+	for _, op := range c.OpsIter() {
+		names = append(names, op.G.Name())
+		if op.G.Name()[:1] == "t" {
+			tilts[op.G] = true
+		}
+		if op.Cond != nil {
+			assert.Equal(builder.Bits(3, 0, 1), *op.Cond)
+		}
+	}
+	assert.ElementsMatch([]string{"H", "H", "bell", "tilt(3.142)", "tilt(-3.142)", "tilt(3.142)",
+		"MEASURE", "MEASURE", "X", "MEASURE"}, names)
+	assert.Len(tilts, 2, "one composite per distinct parameter")
+}
+
+func TestFromQASM2_Qelib(t *testing.T) {
+	h := complex(1/math.Sqrt2, 0)
+	const lib = "OPENQASM 2.0;\ninclude \"qelib1.inc\";\n"
+	const one, two = lib + "qreg q[1];\n", lib + "qreg q[2];\n"
+
+	// Gates without a built-in equivalent are built from their qelib1.inc
+	// definitions, global phase included.
+	assertState(t, []complex128{h, complex(0.5, 0.5)}, qasmState(t, one+"h q[0];\nt q[0];\n"))
+	assertState(t, []complex128{h, complex(0, -1) * h}, qasmState(t, one+"h q[0];\nsdg q[0];\n"))
+	// qelib1.inc's sx is sdg·h·sdg, e^{-iπ/4} times the square root of X.
+	assertState(t, []complex128{h, -1i * h}, qasmState(t, one+"sx q[0];\n"))
+	// With q[0] the control: crz(π) on |1⟩|0⟩ gives −i|1⟩|0⟩, as rz is
+	// read as RZ, and cy gives i|1⟩|1⟩.
+	assertState(t, []complex128{0, -1i, 0, 0}, qasmState(t, two+"x q[0];\ncrz(pi) q[0],q[1];\n"))
+	assertState(t, []complex128{0, 0, 0, 1i}, qasmState(t, two+"x q[0];\ncy q[0],q[1];\n"))
+	// cu3(π,0,π) is a CNOT.
+	assertState(t, []complex128{0, 0, 0, 1}, qasmState(t, two+"x q[0];\ncu3(pi,0,pi) q[0],q[1];\n"))
+
+	// U alone needs no include.
+	assertState(t, []complex128{h, h}, qasmState(t, "OPENQASM 2.0;\nqreg q[1];\nU(pi/2,0,pi) q[0];\n"))
+}
+
+func TestFromQASM2_RoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bell, err := builder.BuildGate("Bell Pair", 2, func(b builder.Builder, q []int) {
+		b.H(q[0]).CNOT(q[0], q[1])
+	})
+	require.NoError(err)
+	b := builder.New(builder.Q(3))
+	b.RX(math.Pi/3, 0).P(1e-5, 0).CP(-2, 0, 1).RZ(0.25, 2)
+	b.Apply(bell, 1, 2).Fredkin(0, 1, 2).Toffoli(2, 1, 0)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	src, err := QASM2(c)
+	require.NoError(err)
+	back, err := FromQASM2(src)
+	require.NoError(err)
+	assert.Equal(c.NumOps()+2, back.NumOps(), "FREDKIN comes back as its three gates")
+	want, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(err)
+	got, err := qsim.NewQSimRunner().GetStatevector(back)
+	require.NoError(err)
+	assertState(t, want, got)
+
+	// Register values read c[0] as their low bit, as Condition.Value and
+	// qcm keys do, so measured keys need bitorder only to be compared with
+	// the MSB-first strings other toolkits print.
+	measured, err := FromQASM2(`OPENQASM 2.0;
+include "qelib1.inc";
+qreg q[3];
+creg c[3];
+x q[0];
+measure q[0] -> c[0];
+if(c==1) x q[1];
+measure q -> c;
+`)
+	require.NoError(err)
+	src, err = QASM2(measured)
+	require.NoError(err)
+	back, err = FromQASM2(src)
+	require.NoError(err)
+	for _, m := range []circuit.Circuit{measured, back} {
+		key, err := qsim.NewQSimRunner().RunOnce(m)
+		require.NoError(err)
+		assert.Equal("110", key)
+		assert.Equal("011", bitorder.Convert(key, bitorder.LSBFirst, bitorder.MSBFirst))
+		v, err := bitorder.Value(key, bitorder.LSBFirst)
+		require.NoError(err)
+		assert.Equal(uint64(3), v)
+	}
+
+	// Opaque gates are kept as placeholders and written back as declared.
+	const opaque = `OPENQASM 2.0;
+include "qelib1.inc";
+opaque kick(theta,phi) a,b;
+qreg q[2];
+kick(0.5,pi) q[1],q[0];
+`
+	c, err = FromQASM2(opaque)
+	require.NoError(err)
+	op := c.OpAt(0)
+	require.IsType(&Opaque{}, op.G)
+	assert.Equal("kick", op.G.Name())
+	assert.Equal([]float64{0.5, math.Pi}, op.G.(gate.Parametric).Params())
+	assert.Equal([]int{1, 0}, op.Qubits)
+	out, err := QASM2(c)
+	require.NoError(err)
+	assert.Contains(out, "opaque kick(p0,p1) a0,a1;\n")
+	assert.Contains(out, "kick(0.5,3.141592653589793) q[1],q[0];\n")
+}
+
+func TestFromQASM2_Errors(t *testing.T) {
+	for _, tc := range []struct{ src, err string }{
+		{`include "mylib.inc";`, "only qelib1.inc"},
+		{"qreg q[1];\nreset q[0];", "line 2: reset is not supported"},
+		{"qreg q[1];\nh q[0];", "undefined gate h"},
+		{"gate g a { h a; }", "uses undefined gate h"},
+		{"qreg q[1];\ngate g(t) a { U(t,0,nope) a; }\ng(1) q[0];", `unknown name "nope"`},
+		{"qreg q[2];\nCX q[0];", "CX takes 0 parameters and 2 qubits"},
+		{"qreg q[1];\nqreg q[2];", "q is already declared"},
+		{"OPENQASM 3.0;", "only 2.0"},
+		{"qreg q[1];\ncreg c[1];\nmeasure c[0] -> q[0];", "c is not a quantum register"},
+	} {
+		_, err := FromQASM2(tc.src)
+		assert.ErrorContains(t, err, tc.err, tc.src)
+	}
+
+	// Errors while playing statements name their line once.
+	for _, tc := range []struct{ src, err string }{
+		{"qreg q[1];\n\nU(0,0,nope) q[0];", `interop: qasm: line 3: expression: unknown name "nope"`},
+		{"qreg q[1];\ngate g(t) a { U(t,0,nope) a; }\ng(1) q[0];", `interop: qasm: line 3: gate g: expression: unknown name "nope"`},
+		{"qreg q[2];\nqreg r[3];\nCX q, r;", "interop: qasm: line 3: registers of different sizes"},
+	} {
+		_, err := FromQASM2(tc.src)
+		if assert.Error(t, err, tc.src) {
+			assert.Equal(t, tc.err, err.Error(), tc.src)
+		}
+	}
+}
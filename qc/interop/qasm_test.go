@@ -0,0 +1,122 @@
+package interop
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQASM2(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bell, err := builder.BuildGate("Bell Pair", 2, func(b builder.Builder, q []int) {
+		b.H(q[0]).CNOT(q[0], q[1])
+	})
+	require.NoError(err)
+	wrapped, err := builder.BuildGate("ch", 2, func(b builder.Builder, q []int) {
+		b.Apply(bell, q[1], q[0]).SWAP(q[0], q[1])
+	})
+	require.NoError(err)
+
+	b := builder.New(builder.Q(3), builder.CReg("m", 1), builder.CReg("out", 2))
+	b.RX(math.Pi/3, 0).P(1e-5, 0).CP(-2, 0, 1)
+	b.Apply(bell, 1, 2).Apply(wrapped, 2, 0)
+	b.Fredkin(0, 1, 2)
+	b.Measure(0, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.SWAP(1, 2) })
+	b.Measure(1, 1).Measure(2, 2)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	out, err := QASM2(c)
+	require.NoError(err)
+	assert.Equal(`OPENQASM 2.0;
+include "qelib1.inc";
+gate bell_pair a0,a1 {
+  h a0;
+  cx a0,a1;
+}
+gate ch_2 a0,a1 {
+  bell_pair a1,a0;
+  cx a0,a1;
+  cx a1,a0;
+  cx a0,a1;
+}
+gate qcm_swap a0,a1 {
+  cx a0,a1;
+  cx a1,a0;
+  cx a0,a1;
+}
+qreg q[3];
+creg m[1];
+creg out[2];
+rx(`+strconv.FormatFloat(math.Pi/3, 'g', -1, 64)+`) q[0];
+u1(1.0e-05) q[0];
+cu1(-2.0) q[0],q[1];
+bell_pair q[1],q[2];
+ch_2 q[2],q[0];
+cx q[2],q[1];
+ccx q[0],q[1],q[2];
+cx q[2],q[1];
+measure q[0] -> m[0];
+if(m==1) qcm_swap q[1],q[2];
+measure q[1] -> out[0];
+measure q[2] -> out[1];
+`, out)
+
+	// Conditions must compare a whole register.
+	b = builder.New(builder.Q(1), builder.CReg("c", 2))
+	b.Measure(0, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(0) })
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	_, err = QASM2(c)
+	assert.ErrorContains(err, "whole classical register")
+
+	b = builder.New(builder.Q(1), builder.C(1))
+	b.Measure(0, 0)
+	b.If(builder.Bit(0).Not(), func(b builder.Builder) { b.X(0) })
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	_, err = QASM2(c)
+	assert.ErrorContains(err, "negated")
+
+	b = builder.New(builder.Q(1), builder.C(1))
+	b.RepeatUntil(builder.Bit(0), 3, func(b builder.Builder) { b.H(0).Measure(0, 0) })
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	_, err = QASM2(c)
+	assert.ErrorContains(err, "loops")
+
+	// Anonymous bits fall back to one register c.
+	b = builder.New(builder.Q(1), builder.C(1))
+	b.H(0).Measure(0, 0)
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	out, err = QASM2(c)
+	require.NoError(err)
+	assert.True(strings.HasSuffix(out, "creg c[1];\nh q[0];\nmeasure q[0] -> c[0];\n"), out)
+}
+
+func TestQASMReal(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, v := range []float64{0, 1, -2.5, math.Pi, 1e-300, -6.02e23} {
+		s, err := qasmReal(v)
+		assert.NoError(err)
+		assert.Contains(s, ".", s)
+		back, err := strconv.ParseFloat(s, 64)
+		assert.NoError(err)
+		assert.Equal(v, back)
+	}
+	_, err := qasmReal(math.NaN())
+	assert.Error(err)
+	_, err = qasmReal(math.Inf(1))
+	assert.Error(err)
+}
@@ -0,0 +1,485 @@
+package interop
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// quirkCircuit is Quirk's JSON encoding: a list of columns, each listing
+// one entry per qubit from the top wire down, plus custom gates.
+type quirkCircuit struct {
+	Cols  [][]json.RawMessage `json:"cols"`
+	Gates []quirkGate         `json:"gates"`
+}
+
+type quirkGate struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Circuit *quirkCircuit `json:"circuit"`
+}
+
+// quirkEntry is one cell of a column: a gate id with an optional formula.
+type quirkEntry struct {
+	ID  string
+	Arg any
+}
+
+func (e *quirkEntry) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		e.ID = id
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(data, &n); err == nil {
+		// 1 is Quirk's identity placeholder.
+		e.ID = strconv.FormatFloat(n, 'g', -1, 64)
+		return nil
+	}
+	var obj struct {
+		ID  string `json:"id"`
+		Arg any    `json:"arg"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("unrecognised entry %s", data)
+	}
+	e.ID, e.Arg = obj.ID, obj.Arg
+	return nil
+}
+
+// FromQuirk parses a circuit in Quirk's JSON format, either the JSON itself
+// or a whole Quirk URL ending in "#circuit=…".
+//
+// Columns are played left to right, so operations keep Quirk's order; the
+// circuit's TimeSteps are then computed as for any other circuit, packing
+// gates left where Quirk leaves them idle. Within a column, "•" and "◦"
+// control every other gate of the column (on |1⟩ and |0⟩ respectively);
+// controlled gates become CNOT, CZ, CP, TOFFOLI or FREDKIN where possible
+// and decompose.Controlled otherwise. "Measure" measures a qubit into the
+// classical bit of the same index. Supported gates are H, X, Y, Z, their
+// ±½ and ±¼ powers, Swap, the formula rotations Rxft, Ryft and Rzft
+// (radians, constant formulas only), the powers X^ft, Y^ft and Z^ft, and
+// custom gates defined in "gates". Display gates (Bloch, Amps, Chance, …)
+// do not act on the state and are skipped; anything else is an error.
+func FromQuirk(data string) (circuit.Circuit, error) {
+	data = strings.TrimSpace(data)
+	if _, frag, ok := strings.Cut(data, "circuit="); ok && !strings.HasPrefix(data, "{") {
+		s, err := url.QueryUnescape(frag)
+		if err != nil {
+			return nil, fmt.Errorf("interop: quirk URL: %w", err)
+		}
+		data = s
+	}
+	var qc quirkCircuit
+	if err := json.Unmarshal([]byte(data), &qc); err != nil {
+		return nil, fmt.Errorf("interop: quirk: %w", err)
+	}
+	custom := map[string]*gate.Composite{}
+	for _, g := range qc.Gates {
+		if g.Circuit == nil {
+			return nil, fmt.Errorf("interop: quirk gate %s: only circuit gates are supported", g.ID)
+		}
+		cols, err := decodeCols(g.Circuit.Cols)
+		if err != nil {
+			return nil, fmt.Errorf("interop: quirk gate %s: %w", g.ID, err)
+		}
+		name := g.Name
+		if name == "" {
+			name = strings.TrimPrefix(g.ID, "~")
+		}
+		var playErr error
+		comp, err := builder.BuildGate(name, max(width(cols, custom), 1), func(b builder.Builder, _ []int) {
+			playErr = playQuirk(b, cols, custom, false)
+		})
+		if playErr != nil {
+			return nil, fmt.Errorf("interop: quirk gate %s: %w", g.ID, playErr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("interop: quirk gate %s: %w", g.ID, err)
+		}
+		custom[g.ID] = comp
+	}
+
+	cols, err := decodeCols(qc.Cols)
+	if err != nil {
+		return nil, fmt.Errorf("interop: quirk: %w", err)
+	}
+	n := max(width(cols, custom), 1)
+	clbits := 0
+	for _, col := range cols {
+		for _, e := range col {
+			if e.ID == "Measure" {
+				clbits = n
+			}
+		}
+	}
+	b := builder.New(builder.Q(n), builder.C(clbits))
+	if err := playQuirk(b, cols, custom, true); err != nil {
+		return nil, fmt.Errorf("interop: quirk: %w", err)
+	}
+	c, err := b.BuildCircuit()
+	if err != nil {
+		return nil, fmt.Errorf("interop: quirk: %w", err)
+	}
+	return c, nil
+}
+
+func decodeCols(raw [][]json.RawMessage) ([][]quirkEntry, error) {
+	cols := make([][]quirkEntry, len(raw))
+	for i, col := range raw {
+		cols[i] = make([]quirkEntry, len(col))
+		for j, cell := range col {
+			if err := json.Unmarshal(cell, &cols[i][j]); err != nil {
+				return nil, fmt.Errorf("column %d, wire %d: %w", i, j, err)
+			}
+		}
+	}
+	return cols, nil
+}
+
+// width returns the number of wires the columns need, counting the wires
+// covered by custom gates.
+func width(cols [][]quirkEntry, custom map[string]*gate.Composite) int {
+	n := 0
+	for _, col := range cols {
+		for q, e := range col {
+			if g, ok := custom[e.ID]; ok {
+				n = max(n, q+g.QubitSpan())
+			} else if !idle(e.ID) {
+				n = max(n, q+1)
+			}
+		}
+	}
+	return n
+}
+
+func idle(id string) bool {
+	return id == "1" || id == "…" || id == ""
+}
+
+// quirkDisplays are prefixes of Quirk's display gates, which only show
+// the state.
+var quirkDisplays = []string{"Amps", "Chance", "Density", "Bloch", "Sample"}
+
+// playQuirk adds the columns to b.
+func playQuirk(b builder.Builder, cols [][]quirkEntry, custom map[string]*gate.Composite, measure bool) error {
+	for i, col := range cols {
+		if err := playColumn(b, col, custom, measure); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func playColumn(b builder.Builder, col []quirkEntry, custom map[string]*gate.Composite, measure bool) error {
+	var controls, anti, swaps []int
+	type placed struct {
+		g  gate.Gate
+		qs []int
+	}
+	var gates []placed
+	for q, e := range col {
+		switch {
+		case idle(e.ID):
+		case e.ID == "•":
+			controls = append(controls, q)
+		case e.ID == "◦":
+			controls = append(controls, q)
+			anti = append(anti, q)
+		case e.ID == "Swap":
+			swaps = append(swaps, q)
+		case e.ID == "Measure":
+			if !measure {
+				return fmt.Errorf("wire %d: measurement inside a custom gate", q)
+			}
+			b.Measure(q, q)
+		case isDisplay(e.ID):
+		default:
+			if g, ok := custom[e.ID]; ok {
+				qs := make([]int, g.QubitSpan())
+				for i := range qs {
+					qs[i] = q + i
+				}
+				gates = append(gates, placed{g, qs})
+				continue
+			}
+			g, err := quirkGateFor(e)
+			if err != nil {
+				return fmt.Errorf("wire %d: %w", q, err)
+			}
+			gates = append(gates, placed{g, []int{q}})
+		}
+	}
+	switch len(swaps) {
+	case 0:
+	case 2:
+		gates = append(gates, placed{gate.Swap(), swaps})
+	default:
+		return fmt.Errorf("%d Swap entries, want 2", len(swaps))
+	}
+	if len(controls) > 0 && len(gates) == 0 {
+		return nil // controls on nothing
+	}
+
+	for _, q := range anti {
+		b.X(q)
+	}
+	for _, p := range gates {
+		if len(controls) == 0 {
+			b.Apply(p.g, p.qs...)
+			continue
+		}
+		if err := applyControlled(b, p.g, controls, p.qs); err != nil {
+			return err
+		}
+	}
+	for _, q := range anti {
+		b.X(q)
+	}
+	return nil
+}
+
+func isDisplay(id string) bool {
+	for _, p := range quirkDisplays {
+		if strings.HasPrefix(id, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyControlled adds g on qs controlled on controls, using a native gate
+// when there is one.
+func applyControlled(b builder.Builder, g gate.Gate, controls, qs []int) error {
+	switch {
+	case len(controls) == 1 && g.Name() == "X":
+		b.CNOT(controls[0], qs[0])
+		return nil
+	case len(controls) == 2 && g.Name() == "X":
+		b.Toffoli(controls[0], controls[1], qs[0])
+		return nil
+	case len(controls) == 1 && g.Name() == "Z":
+		b.CZ(controls[0], qs[0])
+		return nil
+	case len(controls) == 1 && g.Name() == "P":
+		b.CP(g.(gate.Parametric).Params()[0], controls[0], qs[0])
+		return nil
+	case len(controls) == 1 && g.Name() == "SWAP":
+		b.Fredkin(controls[0], qs[0], qs[1])
+		return nil
+	}
+	cg, err := decompose.Controlled(g, len(controls))
+	if err != nil {
+		return err
+	}
+	b.Apply(cg, append(append([]int(nil), controls...), qs...)...)
+	return nil
+}
+
+// quirkGateFor returns the single-qubit gate for a Quirk entry.
+func quirkGateFor(e quirkEntry) (gate.Gate, error) {
+	switch e.ID {
+	case "H":
+		return gate.H(), nil
+	case "X":
+		return gate.X(), nil
+	case "Y":
+		return gate.Y(), nil
+	case "Z":
+		return gate.Z(), nil
+	case "Z^½":
+		return gate.S(), nil
+	case "Rxft", "Ryft", "Rzft":
+		theta, err := quirkArg(e)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]gate.Gate{"Rxft": gate.RX(theta), "Ryft": gate.RY(theta), "Rzft": gate.RZ(theta)}[e.ID], nil
+	case "X^ft", "Y^ft", "Z^ft":
+		t, err := quirkArg(e)
+		if err != nil {
+			return nil, err
+		}
+		return axisPower(e.ID[:1], t)
+	}
+	powers := map[string]float64{"^½": 0.5, "^-½": -0.5, "^¼": 0.25, "^-¼": -0.25}
+	if len(e.ID) > 1 && strings.Contains("XYZ", e.ID[:1]) {
+		if t, ok := powers[e.ID[1:]]; ok {
+			return axisPower(e.ID[:1], t)
+		}
+	}
+	return nil, fmt.Errorf("unsupported Quirk gate %q", e.ID)
+}
+
+// axisPower returns the Pauli power σ^t exactly, global phase included:
+// Z^t = P(πt), X^t = H·Z^t·H and Y^t = S·X^t·S†.
+func axisPower(axis string, t float64) (gate.Gate, error) {
+	if axis == "Z" {
+		return gate.P(math.Pi * t), nil
+	}
+	name := fmt.Sprintf("%s^%s", axis, strconv.FormatFloat(t, 'g', -1, 64))
+	return builder.BuildGate(name, 1, func(b builder.Builder, q []int) {
+		if axis == "Y" {
+			b.P(-math.Pi/2, q[0])
+		}
+		b.H(q[0]).P(math.Pi*t, q[0]).H(q[0])
+		if axis == "Y" {
+			b.S(q[0])
+		}
+	})
+}
+
+// quirkArg evaluates an entry's formula, which must be constant.
+func quirkArg(e quirkEntry) (float64, error) {
+	switch a := e.Arg.(type) {
+	case float64:
+		return a, nil
+	case string:
+		p := &formula{src: []rune(a)}
+		v, err := p.expr()
+		if err == nil && p.skipSpace() < len(p.src) {
+			err = fmt.Errorf("unexpected %q", string(p.src[p.pos:]))
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s formula %q: %w", e.ID, a, err)
+		}
+		return v, nil
+	case nil:
+		return 0, fmt.Errorf("%s needs an arg", e.ID)
+	default:
+		return 0, fmt.Errorf("%s: unsupported arg %v", e.ID, a)
+	}
+}
+
+// formula parses Quirk's constant arithmetic: numbers, pi (or π), + - * /
+// ^, parentheses and implicit multiplication as in "2 pi".
+type formula struct {
+	src []rune
+	pos int
+}
+
+func (f *formula) skipSpace() int {
+	for f.pos < len(f.src) && unicode.IsSpace(f.src[f.pos]) {
+		f.pos++
+	}
+	return f.pos
+}
+
+func (f *formula) peek() rune {
+	if f.skipSpace() < len(f.src) {
+		return f.src[f.pos]
+	}
+	return 0
+}
+
+func (f *formula) expr() (float64, error) {
+	v, err := f.term()
+	for err == nil {
+		switch f.peek() {
+		case '+', '-':
+			op := f.src[f.pos]
+			f.pos++
+			var w float64
+			if w, err = f.term(); op == '+' {
+				v += w
+			} else {
+				v -= w
+			}
+		default:
+			return v, nil
+		}
+	}
+	return 0, err
+}
+
+func (f *formula) term() (float64, error) {
+	v, err := f.unary()
+	for err == nil {
+		r := f.peek()
+		var w float64
+		switch {
+		case r == '*' || r == '/':
+			f.pos++
+			if w, err = f.unary(); r == '*' {
+				v *= w
+			} else {
+				v /= w
+			}
+		case r == '(' || r == 'π' || unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.':
+			w, err = f.unary()
+			v *= w
+		default:
+			return v, nil
+		}
+	}
+	return 0, err
+}
+
+func (f *formula) unary() (float64, error) {
+	if f.peek() == '-' {
+		f.pos++
+		v, err := f.unary()
+		return -v, err
+	}
+	v, err := f.primary()
+	if err == nil && f.peek() == '^' {
+		f.pos++
+		var e float64
+		if e, err = f.unary(); err == nil {
+			v = math.Pow(v, e)
+		}
+	}
+	return v, err
+}
+
+func (f *formula) primary() (float64, error) {
+	r := f.peek()
+	switch {
+	case r == 0:
+		return 0, fmt.Errorf("unexpected end")
+	case r == '(':
+		f.pos++
+		v, err := f.expr()
+		if err != nil {
+			return 0, err
+		}
+		if f.peek() != ')' {
+			return 0, fmt.Errorf("missing )")
+		}
+		f.pos++
+		return v, nil
+	case r == 'π':
+		f.pos++
+		return math.Pi, nil
+	case unicode.IsDigit(r) || r == '.':
+		start := f.pos
+		for f.pos < len(f.src) && (unicode.IsDigit(f.src[f.pos]) || f.src[f.pos] == '.') {
+			f.pos++
+		}
+		return strconv.ParseFloat(string(f.src[start:f.pos]), 64)
+	case unicode.IsLetter(r):
+		start := f.pos
+		for f.pos < len(f.src) && unicode.IsLetter(f.src[f.pos]) {
+			f.pos++
+		}
+		switch name := string(f.src[start:f.pos]); name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		default:
+			return 0, fmt.Errorf("unsupported name %q (time-dependent formulas cannot be imported)", name)
+		}
+	}
+	return 0, fmt.Errorf("unexpected %q", string(r))
+}
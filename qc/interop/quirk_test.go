@@ -0,0 +1,123 @@
+package interop
+
+import (
+	"math"
+	"math/cmplx"
+	"net/url"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// quirkState imports src and returns its final statevector.
+func quirkState(t *testing.T, src string) []complex128 {
+	t.Helper()
+	c, err := FromQuirk(src)
+	require.NoError(t, err)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+	return sv
+}
+
+func assertState(t *testing.T, want, got []complex128) {
+	t.Helper()
+	require.Len(t, got, len(want))
+	for i := range want {
+		assert.InDelta(t, 0, cmplx.Abs(want[i]-got[i]), 1e-9, "amplitude %d: want %v, got %v", i, want[i], got[i])
+	}
+}
+
+func TestFromQuirk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const bell = `{"cols":[["H"],["•","X"],["Measure","Measure"]]}`
+	c, err := FromQuirk(bell)
+	require.NoError(err)
+	assert.Equal(2, c.Qubits())
+	assert.Equal(2, c.Clbits())
+	var names []string
+	for _, op := range c.OpsIter() {
+		names = append(names, op.G.Name())
+	}
+	assert.Equal([]string{"H", "CNOT", "MEASURE", "MEASURE"}, names)
+	assert.Equal(2, c.MaxStep(), "one timestep per column")
+
+	fromURL, err := FromQuirk("https://algassert.com/quirk#circuit=" + url.QueryEscape(bell))
+	require.NoError(err)
+	assert.Equal(c.Operations(), fromURL.Operations())
+}
+
+func TestFromQuirk_Gates(t *testing.T) {
+	h := complex(1/math.Sqrt2, 0)
+
+	// Square roots of Paulis, global phase included: X^½|0⟩ = ((1+i)|0⟩ +
+	// (1−i)|1⟩)/2 and Y^½|0⟩ = (1+i)(|0⟩ + |1⟩)/2.
+	assertState(t, []complex128{(1 + 1i) / 2, (1 - 1i) / 2}, quirkState(t, `{"cols":[["X^½"]]}`))
+	assertState(t, []complex128{(1 + 1i) / 2, (1 + 1i) / 2}, quirkState(t, `{"cols":[["Y^½"]]}`))
+	assertState(t, []complex128{h, h * cmplx.Exp(1i*math.Pi/4)}, quirkState(t, `{"cols":[["H"],["Z^¼"]]}`))
+	assertState(t, []complex128{h, h * cmplx.Exp(-0.3i*math.Pi)}, quirkState(t, `{"cols":[["H"],[{"id":"Z^ft","arg":"-0.3"}]]}`))
+
+	// Formula rotations match the builder's.
+	b := builder.New(builder.Q(2))
+	b.RY(-2*math.Pi/5, 0).RX(math.Pi/3, 1).RZ(1.5, 1)
+	ref, err := b.BuildCircuit()
+	require.NoError(t, err)
+	want, err := qsim.NewQSimRunner().GetStatevector(ref)
+	require.NoError(t, err)
+	assertState(t, want, quirkState(t,
+		`{"cols":[[{"id":"Ryft","arg":"-2 pi / 5"},{"id":"Rxft","arg":"π/3"}],[1,{"id":"Rzft","arg":1.5}]]}`))
+
+	// Anti-controls fire on |0⟩; controls on several wires.
+	assertState(t, []complex128{0, 0, 1, 0}, quirkState(t, `{"cols":[["◦","X"]]}`))
+	assertState(t, []complex128{0, 0, 0, h, 0, 0, 0, h}, quirkState(t, `{"cols":[["X","X"],["•","•","H"]]}`))
+	assertState(t, []complex128{0, 0, 0, 0, 0, 1, 0, 0}, quirkState(t, `{"cols":[["X","X"],["•","Swap","Swap"]]}`))
+	// Displays do not act.
+	assertState(t, []complex128{0, 1}, quirkState(t, `{"cols":[["X"],["Bloch"],["Chance"]]}`))
+
+	// Custom gates span several wires.
+	assertState(t, []complex128{h, 0, 0, 0, 0, 0, h, 0}, quirkState(t, `{
+		"cols":[[1,"~bell"]],
+		"gates":[{"id":"~bell","name":"Bell","circuit":{"cols":[["H"],["•","X"]]}}]}`))
+}
+
+func TestFromQuirk_Errors(t *testing.T) {
+	for name, src := range map[string]string{
+		"json":        `{"cols":[`,
+		"unsupported": `{"cols":[["QFT3"]]}`,
+		"time":        `{"cols":[[{"id":"Rzft","arg":"pi t"}]]}`,
+		"no arg":      `{"cols":[[{"id":"Rzft"}]]}`,
+		"one swap":    `{"cols":[["Swap","X"]]}`,
+		"custom measure": `{"cols":[["~m"]],
+			"gates":[{"id":"~m","circuit":{"cols":[["Measure"]]}}]}`,
+		"matrix gate": `{"cols":[["~u"]],"gates":[{"id":"~u","matrix":"{{1,0},{0,1}}"}]}`,
+	} {
+		_, err := FromQuirk(src)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestFormula(t *testing.T) {
+	for src, want := range map[string]float64{
+		"1":          1,
+		"pi":         math.Pi,
+		"-pi/4":      -math.Pi / 4,
+		"2 pi / 3":   2 * math.Pi / 3,
+		"2*(1+0.5)":  3,
+		"2^3 - 1":    7,
+		" π ":        math.Pi,
+		"-(1 - 3)/4": 0.5,
+	} {
+		got, err := quirkArg(quirkEntry{ID: "Rzft", Arg: src})
+		if assert.NoError(t, err, src) {
+			assert.InDelta(t, want, got, 1e-12, src)
+		}
+	}
+	for _, src := range []string{"", "pi +", "(1", "1)", "sin(t)", "2 $"} {
+		_, err := quirkArg(quirkEntry{ID: "Rzft", Arg: src})
+		assert.Error(t, err, src)
+	}
+}
@@ -0,0 +1,509 @@
+package interop
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// StimAnnotations are Stim's error-correction annotations, given in terms
+// of classical bits. Both refer to the value a bit holds at the end of the
+// circuit, which is what runners report.
+type StimAnnotations struct {
+	Detectors   [][]int // each detector checks the parity of these bits
+	Observables [][]int // logical observable k is the parity of Observables[k]
+}
+
+// Stim renders c in Stim's circuit format. See WriteStim.
+func Stim(c circuit.Circuit, ann StimAnnotations) (string, error) {
+	var sb strings.Builder
+	if err := WriteStim(&sb, c, ann); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// WriteStim is Stim to an io.Writer. The circuit must be Clifford after
+// expanding composites: H, S, X, Y, Z, CNOT, CZ and SWAP, and P, CP, RX,
+// RY and RZ at multiples of π/2 (π for CP). Stim does not track global
+// phase, so rotations are written as the Clifford they equal up to one.
+// Each timestep ends with a TICK. A condition must test a single bit for
+// 1 and guard X, Y or Z, which become Stim's classically controlled CX,
+// CY or CZ on the latest measurement into that bit. Detectors and
+// observables are written after the last operation; every bit they name
+// must have been measured.
+func WriteStim(w io.Writer, c circuit.Circuit, ann StimAnnotations) error {
+	var sb strings.Builder
+	rec := map[int]int{} // cbit -> index of its latest measurement record
+	records := 0
+	step := -1
+	for i, op := range c.OpsIter() {
+		if op.Loop != nil {
+			return fmt.Errorf("interop: operation %d: loops cannot be written as Stim", i)
+		}
+		if step >= 0 && op.TimeStep != step {
+			sb.WriteString("TICK\n")
+		}
+		step = op.TimeStep
+		if op.G.Name() == "MEASURE" {
+			fmt.Fprintf(&sb, "M %d\n", op.Qubits[0])
+			rec[op.Cbit] = records
+			records++
+			continue
+		}
+		if op.Cond != nil {
+			line, err := stimConditional(op, rec, records)
+			if err != nil {
+				return fmt.Errorf("interop: operation %d: %w", i, err)
+			}
+			sb.WriteString(line)
+			continue
+		}
+		err := gate.Expand(op.G, op.Qubits, func(g gate.Gate, qs []int) error {
+			name, err := stimGate(g)
+			if err != nil || name == "" {
+				return err
+			}
+			args := make([]string, len(qs))
+			for j, q := range qs {
+				args[j] = strconv.Itoa(q)
+			}
+			fmt.Fprintf(&sb, "%s %s\n", name, strings.Join(args, " "))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("interop: operation %d: %w", i, err)
+		}
+	}
+
+	targets := func(bits []int) (string, error) {
+		var ts strings.Builder
+		for _, cb := range bits {
+			r, ok := rec[cb]
+			if !ok {
+				return "", fmt.Errorf("cbit %d is never measured", cb)
+			}
+			fmt.Fprintf(&ts, " rec[%d]", r-records)
+		}
+		return ts.String(), nil
+	}
+	for i, d := range ann.Detectors {
+		ts, err := targets(d)
+		if err != nil {
+			return fmt.Errorf("interop: detector %d: %w", i, err)
+		}
+		fmt.Fprintf(&sb, "DETECTOR%s\n", ts)
+	}
+	for k, o := range ann.Observables {
+		ts, err := targets(o)
+		if err != nil {
+			return fmt.Errorf("interop: observable %d: %w", k, err)
+		}
+		fmt.Fprintf(&sb, "OBSERVABLE_INCLUDE(%d)%s\n", k, ts)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// stimGate returns Stim's name for a primitive Clifford gate, or "" for
+// one that is the identity up to global phase.
+func stimGate(g gate.Gate) (string, error) {
+	switch g.Name() {
+	case "H", "S", "X", "Y", "Z", "CZ", "SWAP":
+		return g.Name(), nil
+	case "CNOT":
+		return "CX", nil
+	}
+	pg, ok := g.(gate.Parametric)
+	if !ok {
+		return "", fmt.Errorf("gate %s is not a Clifford gate", g.Name())
+	}
+	theta := pg.Params()[0]
+	quarter := math.Round(theta / (math.Pi / 2))
+	if math.IsNaN(theta) || math.Abs(theta-quarter*math.Pi/2) > cliffordTol {
+		return "", fmt.Errorf("gate %s(%v) is not a Clifford gate", g.Name(), theta)
+	}
+	k := int(quarter) & 3 // θ = kπ/2 mod 2π
+	switch g.Name() {
+	case "P", "RZ":
+		return [4]string{"", "S", "Z", "S_DAG"}[k], nil
+	case "RX":
+		return [4]string{"", "SQRT_X", "X", "SQRT_X_DAG"}[k], nil
+	case "RY":
+		return [4]string{"", "SQRT_Y", "Y", "SQRT_Y_DAG"}[k], nil
+	case "CP":
+		switch k {
+		case 0:
+			return "", nil
+		case 2:
+			return "CZ", nil
+		}
+	}
+	return "", fmt.Errorf("gate %s(%v) is not a Clifford gate", g.Name(), theta)
+}
+
+// cliffordTol is how far an angle may be from a multiple of π/2 and still
+// be written as a Clifford gate.
+const cliffordTol = 1e-9
+
+// stimConditional writes a Pauli on one qubit conditioned on one bit as a
+// classically controlled gate.
+func stimConditional(op circuit.Operation, rec map[int]int, records int) (string, error) {
+	cond := op.Cond
+	if cond.Negate || len(cond.Cbits) != 1 || cond.Value != 1 {
+		return "", fmt.Errorf("only conditions on a single bit being 1 can be written as Stim")
+	}
+	var name string
+	switch op.G.Name() {
+	case "X":
+		name = "CX"
+	case "Y":
+		name = "CY"
+	case "Z":
+		name = "CZ"
+	default:
+		return "", fmt.Errorf("conditional %s cannot be written as Stim; only X, Y and Z can", op.G.Name())
+	}
+	r, ok := rec[cond.Cbits[0]]
+	if !ok {
+		return "", fmt.Errorf("condition reads cbit %d before it is measured", cond.Cbits[0])
+	}
+	return fmt.Sprintf("%s rec[%d] %d\n", name, r-records, op.Qubits[0]), nil
+}
+
+// stimInstr is one parsed Stim instruction.
+type stimInstr struct {
+	line    int
+	name    string
+	args    []float64
+	targets []string
+}
+
+// FromStim parses a circuit in Stim's format. Measurement record k becomes
+// classical bit k, so the circuit has one bit per measurement, and
+// detectors and observables are returned as the bits they combine.
+//
+// Supported instructions are the Clifford gates H, S, S_DAG, SQRT_X,
+// SQRT_X_DAG, SQRT_Y, SQRT_Y_DAG, X, Y, Z, I, CX, CY, CZ and SWAP (with
+// their ZCX, ZCY, ZCZ, CNOT, SQRT_Z, SQRT_Z_DAG and H_XZ aliases), CX, CY
+// and CZ controlled by a measurement record, M and MZ, MR and MRZ
+// (measure, then flip the qubit back to |0⟩ if the result was 1), R and
+// RZ on qubits that have not been touched yet, REPEAT blocks, which are
+// unrolled, DETECTOR and OBSERVABLE_INCLUDE. TICK and coordinate
+// annotations are skipped. Gates keep their global phase as Stim
+// defines them. Noise channels, inverted targets and mid-circuit resets
+// without a measurement have no equivalent and are errors.
+func FromStim(src string) (circuit.Circuit, StimAnnotations, error) {
+	lines := strings.Split(src, "\n")
+	pos := 0
+	prog, err := parseStimBlock(lines, &pos, false)
+	if err != nil {
+		return nil, StimAnnotations{}, fmt.Errorf("interop: stim: %w", err)
+	}
+
+	n, records := 0, 0
+	for _, in := range prog {
+		if isStimMeasure(in.name) {
+			records += len(in.targets)
+		}
+		for _, t := range in.targets {
+			if q, err := strconv.Atoi(t); err == nil {
+				n = max(n, q+1)
+			}
+		}
+	}
+	b := builder.New(builder.Q(max(n, 1)), builder.C(records))
+	sp := &stimPlayer{b: b, touched: make([]bool, max(n, 1))}
+	for _, in := range prog {
+		if err := sp.play(in); err != nil {
+			return nil, StimAnnotations{}, fmt.Errorf("interop: stim: line %d: %s: %w", in.line, in.name, err)
+		}
+	}
+	c, err := b.BuildCircuit()
+	if err != nil {
+		return nil, StimAnnotations{}, fmt.Errorf("interop: stim: %w", err)
+	}
+	return c, sp.ann, nil
+}
+
+// parseStimBlock reads instructions from lines[*pos:] up to the end, or up
+// to the closing brace when nested, unrolling REPEAT blocks.
+func parseStimBlock(lines []string, pos *int, nested bool) ([]stimInstr, error) {
+	var out []stimInstr
+	for *pos < len(lines) {
+		lineNo := *pos + 1
+		line, _, _ := strings.Cut(lines[*pos], "#")
+		line = strings.TrimSpace(line)
+		*pos++
+		if line == "" {
+			continue
+		}
+		if line == "}" {
+			if !nested {
+				return nil, fmt.Errorf("line %d: unexpected }", lineNo)
+			}
+			return out, nil
+		}
+		in, err := parseStimLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		in.line = lineNo
+		if in.name != "REPEAT" {
+			out = append(out, in)
+			continue
+		}
+		if len(in.targets) != 2 || in.targets[1] != "{" {
+			return nil, fmt.Errorf("line %d: REPEAT wants a count and {", lineNo)
+		}
+		count, err := strconv.Atoi(in.targets[0])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("line %d: REPEAT count %q", lineNo, in.targets[0])
+		}
+		body, err := parseStimBlock(lines, pos, true)
+		if err != nil {
+			return nil, err
+		}
+		for range count {
+			out = append(out, body...)
+		}
+	}
+	if nested {
+		return nil, fmt.Errorf("REPEAT block is not closed")
+	}
+	return out, nil
+}
+
+// parseStimLine splits "NAME(args) t1 t2 …".
+func parseStimLine(line string) (stimInstr, error) {
+	fields := strings.Fields(line)
+	head := fields[0]
+	in := stimInstr{targets: fields[1:]}
+	if name, rest, ok := strings.Cut(head, "("); ok {
+		// Arguments may contain spaces, so rejoin them.
+		args := strings.Join(append([]string{rest}, fields[1:]...), " ")
+		inner, after, ok := strings.Cut(args, ")")
+		if !ok {
+			return in, fmt.Errorf("missing ) in %q", line)
+		}
+		head = name
+		in.targets = strings.Fields(after)
+		for _, a := range strings.Split(inner, ",") {
+			if a = strings.TrimSpace(a); a == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(a, 64)
+			if err != nil {
+				return in, fmt.Errorf("argument %q: %w", a, err)
+			}
+			in.args = append(in.args, v)
+		}
+	}
+	in.name = strings.ToUpper(head)
+	return in, nil
+}
+
+func isStimMeasure(name string) bool {
+	switch name {
+	case "M", "MZ", "MR", "MRZ":
+		return true
+	}
+	return false
+}
+
+// stimPlayer adds parsed instructions to a builder.
+type stimPlayer struct {
+	b       builder.Builder
+	touched []bool // qubits that have been acted on, so are no longer |0⟩
+	records int
+	ann     StimAnnotations
+}
+
+// stimSingle are the single-qubit gates, as functions of the builder.
+var stimSingle = map[string]func(b builder.Builder, q int){
+	"I":          func(b builder.Builder, q int) {},
+	"H":          func(b builder.Builder, q int) { b.H(q) },
+	"H_XZ":       func(b builder.Builder, q int) { b.H(q) },
+	"X":          func(b builder.Builder, q int) { b.X(q) },
+	"Y":          func(b builder.Builder, q int) { b.Y(q) },
+	"Z":          func(b builder.Builder, q int) { b.Z(q) },
+	"S":          func(b builder.Builder, q int) { b.S(q) },
+	"SQRT_Z":     func(b builder.Builder, q int) { b.S(q) },
+	"S_DAG":      func(b builder.Builder, q int) { b.P(-math.Pi/2, q) },
+	"SQRT_Z_DAG": func(b builder.Builder, q int) { b.P(-math.Pi/2, q) },
+	"SQRT_X":     func(b builder.Builder, q int) { stimRoot(b, "X", 0.5, q) },
+	"SQRT_X_DAG": func(b builder.Builder, q int) { stimRoot(b, "X", -0.5, q) },
+	"SQRT_Y":     func(b builder.Builder, q int) { stimRoot(b, "Y", 0.5, q) },
+	"SQRT_Y_DAG": func(b builder.Builder, q int) { stimRoot(b, "Y", -0.5, q) },
+}
+
+// stimRoot applies the Pauli square root σ^t with its exact phase.
+func stimRoot(b builder.Builder, axis string, t float64, q int) {
+	g, _ := axisPower(axis, t)
+	b.Apply(g, q)
+}
+
+// stimPaulis names the Pauli each controlled gate applies to its target.
+var stimPaulis = map[string]string{
+	"CX": "X", "ZCX": "X", "CNOT": "X",
+	"CY": "Y", "ZCY": "Y",
+	"CZ": "Z", "ZCZ": "Z",
+}
+
+func (sp *stimPlayer) play(in stimInstr) error {
+	switch in.name {
+	case "TICK", "QUBIT_COORDS", "SHIFT_COORDS":
+		return nil
+	case "DETECTOR", "OBSERVABLE_INCLUDE":
+		bits, err := sp.recBits(in.targets)
+		if err != nil {
+			return err
+		}
+		if in.name == "DETECTOR" {
+			sp.ann.Detectors = append(sp.ann.Detectors, bits)
+			return nil
+		}
+		if len(in.args) != 1 || in.args[0] < 0 || in.args[0] != math.Trunc(in.args[0]) {
+			return fmt.Errorf("wants one observable index")
+		}
+		k := int(in.args[0])
+		for len(sp.ann.Observables) <= k {
+			sp.ann.Observables = append(sp.ann.Observables, nil)
+		}
+		sp.ann.Observables[k] = append(sp.ann.Observables[k], bits...)
+		return nil
+	}
+	if len(in.args) > 0 {
+		return fmt.Errorf("arguments (noise) are not supported")
+	}
+	qs, err := sp.qubits(in)
+	if err != nil {
+		return err
+	}
+	switch in.name {
+	case "M", "MZ", "MR", "MRZ":
+		for _, q := range qs {
+			cb := sp.records
+			sp.records++
+			sp.b.Measure(q, cb)
+			if in.name == "MR" || in.name == "MRZ" {
+				sp.b.If(builder.Bit(cb), func(b builder.Builder) { b.X(q) })
+			}
+		}
+		return nil
+	case "R", "RZ":
+		for _, q := range qs {
+			if sp.touched[q] {
+				return fmt.Errorf("qubit %d: mid-circuit reset without a measurement", q)
+			}
+		}
+		return nil
+	case "SWAP":
+		if len(qs)%2 != 0 {
+			return fmt.Errorf("odd number of targets")
+		}
+		for i := 0; i < len(qs); i += 2 {
+			sp.b.SWAP(qs[i], qs[i+1])
+		}
+		return nil
+	}
+	if f, ok := stimSingle[in.name]; ok {
+		for _, q := range qs {
+			f(sp.b, q)
+		}
+		return nil
+	}
+	if _, ok := stimPaulis[in.name]; ok {
+		return sp.controlled(in)
+	}
+	return fmt.Errorf("unsupported instruction")
+}
+
+// qubits parses in's targets as qubit indices and marks them touched.
+// Controlled gates, whose targets may be records, parse their own.
+func (sp *stimPlayer) qubits(in stimInstr) ([]int, error) {
+	if _, ok := stimPaulis[in.name]; ok {
+		return nil, nil
+	}
+	qs := make([]int, len(in.targets))
+	for i, t := range in.targets {
+		q, err := strconv.Atoi(t)
+		if err != nil || q < 0 {
+			return nil, fmt.Errorf("target %q is not a qubit", t)
+		}
+		qs[i] = q
+	}
+	if in.name != "R" && in.name != "RZ" {
+		for _, q := range qs {
+			sp.touched[q] = true
+		}
+	}
+	return qs, nil
+}
+
+// controlled applies CX, CY or CZ to each pair of targets; a control may
+// be a measurement record, which makes the Pauli conditional on it.
+func (sp *stimPlayer) controlled(in stimInstr) error {
+	if len(in.targets)%2 != 0 {
+		return fmt.Errorf("odd number of targets")
+	}
+	pauli := stimPaulis[in.name]
+	for i := 0; i < len(in.targets); i += 2 {
+		ctl, tgt := in.targets[i], in.targets[i+1]
+		if pauli == "Z" && strings.HasPrefix(tgt, "rec[") {
+			ctl, tgt = tgt, ctl // CZ is symmetric
+		}
+		t, err := strconv.Atoi(tgt)
+		if err != nil || t < 0 {
+			return fmt.Errorf("target %q is not a qubit", tgt)
+		}
+		sp.touched[t] = true
+		if strings.HasPrefix(ctl, "rec[") {
+			bits, err := sp.recBits([]string{ctl})
+			if err != nil {
+				return err
+			}
+			sp.b.If(builder.Bit(bits[0]), func(b builder.Builder) { stimSingle[pauli](b, t) })
+			continue
+		}
+		c, err := strconv.Atoi(ctl)
+		if err != nil || c < 0 {
+			return fmt.Errorf("control %q is not a qubit", ctl)
+		}
+		sp.touched[c] = true
+		switch pauli {
+		case "X":
+			sp.b.CNOT(c, t)
+		case "Z":
+			sp.b.CZ(c, t)
+		case "Y":
+			// CY = S·CX·S† on the target.
+			sp.b.P(-math.Pi/2, t).CNOT(c, t).S(t)
+		}
+	}
+	return nil
+}
+
+// recBits resolves rec[-k] targets to the classical bits of those records.
+func (sp *stimPlayer) recBits(targets []string) ([]int, error) {
+	bits := make([]int, len(targets))
+	for i, t := range targets {
+		inner, ok := strings.CutPrefix(t, "rec[")
+		inner, ok2 := strings.CutSuffix(inner, "]")
+		k, err := strconv.Atoi(inner)
+		if !ok || !ok2 || err != nil || k >= 0 {
+			return nil, fmt.Errorf("target %q is not a measurement record", t)
+		}
+		if sp.records+k < 0 {
+			return nil, fmt.Errorf("%s looks back past the first measurement", t)
+		}
+		bits[i] = sp.records + k
+	}
+	return bits, nil
+}
@@ -0,0 +1,148 @@
+package interop
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStim(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bell, err := builder.BuildGate("bell", 2, func(b builder.Builder, q []int) {
+		b.H(q[0]).CNOT(q[0], q[1])
+	})
+	require.NoError(err)
+	b := builder.New(builder.Q(3), builder.C(3))
+	b.Apply(bell, 0, 1).RX(-math.Pi/2, 2).P(2*math.Pi, 2).CP(math.Pi, 1, 2)
+	b.Measure(0, 0).Measure(1, 1)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.Z(2) })
+	b.Measure(2, 2)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	out, err := Stim(c, StimAnnotations{
+		Detectors:   [][]int{{0, 1}},
+		Observables: [][]int{{2}},
+	})
+	require.NoError(err)
+	assert.Equal(`H 0
+CX 0 1
+SQRT_X_DAG 2
+TICK
+M 0
+TICK
+CZ 1 2
+TICK
+M 1
+CZ rec[-2] 2
+TICK
+M 2
+DETECTOR rec[-3] rec[-2]
+OBSERVABLE_INCLUDE(0) rec[-1]
+`, out)
+
+	b = builder.New(builder.Q(1))
+	b.RZ(0.3, 0)
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	_, err = Stim(c, StimAnnotations{})
+	assert.ErrorContains(err, "not a Clifford gate")
+
+	b = builder.New(builder.Q(1), builder.C(2))
+	b.Measure(0, 0)
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	_, err = Stim(c, StimAnnotations{Detectors: [][]int{{1}}})
+	assert.ErrorContains(err, "cbit 1 is never measured")
+}
+
+func TestFromStim(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, _, err := FromStim("\nR 0 1 2 3 4\nX_ERROR(0) 0\n")
+	assert.ErrorContains(err, "line 3: X_ERROR: arguments (noise) are not supported")
+
+	// A distance-3 repetition code memory experiment, two rounds.
+	const rep = `
+# data 0 2 4, ancillas 1 3
+R 0 1 2 3 4
+X 2
+REPEAT 2 {
+    CX 0 1 2 3
+    CX 2 1 4 3
+    MR 1 3
+    TICK
+}
+DETECTOR(1, 0) rec[-2] rec[-4]
+DETECTOR(3, 0) rec[-1] rec[-3]
+M 0 2 4
+OBSERVABLE_INCLUDE(0) rec[-1]
+`
+	c, ann, err := FromStim(rep)
+	require.NoError(err)
+	assert.Equal(5, c.Qubits())
+	assert.Equal(7, c.Clbits())
+	assert.Equal([][]int{{2, 0}, {3, 1}}, ann.Detectors)
+	assert.Equal([][]int{{6}}, ann.Observables)
+
+	// The flipped middle qubit trips both checks in both rounds; the
+	// resets keep the second round's syndromes the same, so the
+	// detectors stay quiet.
+	r := qsim.NewQSimRunner()
+	key, err := r.RunOnce(c)
+	require.NoError(err)
+	assert.Equal("1111010", key)
+
+	// Exporting writes measurements in timestep order, so the bits come
+	// back renumbered, but every detector and observable reads the same.
+	out, err := Stim(c, ann)
+	require.NoError(err)
+	back, ann2, err := FromStim(out)
+	require.NoError(err)
+	key2, err := r.RunOnce(back)
+	require.NoError(err)
+	parities := func(key string, sets [][]int) []byte {
+		out := make([]byte, len(sets))
+		for i, bits := range sets {
+			for _, cb := range bits {
+				out[i] ^= key[cb] - '0'
+			}
+		}
+		return out
+	}
+	assert.Equal(parities(key, ann.Detectors), parities(key2, ann2.Detectors))
+	assert.Equal([]byte{0, 0}, parities(key2, ann2.Detectors))
+	assert.Equal(parities(key, ann.Observables), parities(key2, ann2.Observables))
+
+	_, _, err = FromStim("H 0\nR 0\n")
+	assert.ErrorContains(err, "mid-circuit reset")
+	_, _, err = FromStim("REPEAT 2 {\nH 0\n")
+	assert.ErrorContains(err, "not closed")
+	_, _, err = FromStim("DETECTOR rec[-1]\n")
+	assert.ErrorContains(err, "past the first measurement")
+}
+
+func TestFromStim_Gates(t *testing.T) {
+	h := complex(1/math.Sqrt2, 0)
+	stimState := func(src string) []complex128 {
+		c, _, err := FromStim(src)
+		require.NoError(t, err)
+		sv, err := qsim.NewQSimRunner().GetStatevector(c)
+		require.NoError(t, err)
+		return sv
+	}
+
+	// Stim's SQRT_X|0⟩ = ((1+i)|0⟩ + (1−i)|1⟩)/2, phase included.
+	assertState(t, []complex128{(1 + 1i) / 2, (1 - 1i) / 2}, stimState("SQRT_X 0"))
+	assertState(t, []complex128{(1 + 1i) / 2, (1 + 1i) / 2}, stimState("SQRT_Y 0"))
+	assertState(t, []complex128{h, -1i * h}, stimState("H 0\nS_DAG 0"))
+	// CY on |1⟩|0⟩ (qubit 0 the control) gives i|1⟩|1⟩.
+	assertState(t, []complex128{0, 0, 0, 1i}, stimState("X 0\nCY 0 1"))
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/fogleman/gg" // ✱ pure‑Go 2‑D vector lib :contentReference[oaicite:0]{index=0}
+	"github.com/kegliz/qcm/qc/bitorder"
 	"github.com/kegliz/qcm/qc/circuit"
 	"github.com/kegliz/qcm/qc/gate"
 )
@@ -16,19 +17,36 @@ import (
 // GGPNG is a renderer that uses the gg library to create PNG images of quantum circuits.
 // It draws the circuit operations and wires based on the provided circuit data.
 
-type GGPNG struct{ Cell float64 }
+type GGPNG struct {
+	Cell float64
+	// CollapseRepeats draws a block of layers repeated back to back (Grover
+	// iterations, Trotter steps) once, framed and labelled "xN". Blocks
+	// are found among the layers of the layout, so iterations only match
+	// when they line up; circuit.LayoutOptions.AlignMeasurements helps.
+	CollapseRepeats bool
+
+	top float64 // margin above the first qubit, for repeat labels
+}
 
 // NewRenderer returns a renderer that emits lossless PNGs using gg.
 func NewRenderer(cellPx int) GGPNG { return GGPNG{Cell: float64(cellPx)} }
 
 func (r GGPNG) Render(c circuit.Circuit) (image.Image, error) {
+	cl := collapse(c.Depth(), nil)
+	if r.CollapseRepeats {
+		cl = collapse(c.Depth(), findRepeats(layerKeys(c)))
+	}
+	if len(cl.repeats) > 0 {
+		r.top = r.Cell / 3
+	}
+
 	// Ensure minimum width for drawing wires even if circuit is empty (MaxStep = -1)
-	steps := c.MaxStep() + 1
+	steps := cl.width
 	if steps < 1 {
 		steps = 1 // Minimum 1 step width to show wires
 	}
 	w := int(float64(steps) * r.Cell)
-	h := int(float64(c.Qubits()) * r.Cell)
+	h := int(r.top + float64(c.Qubits())*r.Cell + float64(c.Clbits())*r.rail())
 
 	// Handle edge cases
 	if h <= 0 {
@@ -47,12 +65,28 @@ func (r GGPNG) Render(c circuit.Circuit) (image.Image, error) {
 		dc.DrawLine(0, y, float64(w), y)
 		dc.Stroke()
 	}
+	for cb := range c.Clbits() {
+		r.drawDoubleLine(dc, 0, r.cy(c, cb), float64(w), r.cy(c, cb))
+	}
 
 	// Process operations using calculated TimeStep and Line
-	for _, op := range c.Operations() {
+	for _, op := range c.OpsIter() {
+		if cl.hidden[op.TimeStep] {
+			continue
+		}
+		op.TimeStep = cl.column[op.TimeStep]
+
+		// Classical connectors first, so the gate symbols cover their ends
+		if op.Cond != nil {
+			r.drawCondition(dc, c, op)
+		}
+		if op.G.Name() == "MEASURE" && op.Cbit >= 0 {
+			r.drawMeasureArrow(dc, c, op)
+		}
+
 		// Handle standard single-qubit box gates first
 		switch op.G.Name() {
-		case "H", "X", "Y", "Z", "S":
+		case "H", "X", "Y", "Z", "S", "P", "RX", "RY", "RZ":
 			r.drawBoxGate(dc, op)
 			continue // Move to next operation
 		}
@@ -61,7 +95,7 @@ func (r GGPNG) Render(c circuit.Circuit) (image.Image, error) {
 		switch op.G.Name() {
 		case "CNOT":
 			r.drawCNOT(dc, op)
-		case "CZ": // Added CZ case
+		case "CZ", "CP": // CP is symmetric like CZ, so it shares the two-dot symbol
 			r.drawCZ(dc, op)
 		case "FREDKIN":
 			r.drawFredkin(dc, op)
@@ -73,7 +107,13 @@ func (r GGPNG) Render(c circuit.Circuit) (image.Image, error) {
 			r.drawToffoli(dc, op)
 		case "MEASURE":
 			r.drawMeasurement(dc, op)
+		case "LOOP":
+			r.drawSpanBox(dc, op)
 		default:
+			if _, ok := op.G.(*gate.Composite); ok {
+				r.drawSpanBox(dc, op)
+				continue
+			}
 			// Attempt to draw any other unrecognized single-qubit gate as a box
 			if g, ok := op.G.(gate.Gate); ok && g.QubitSpan() == 1 {
 				fmt.Printf("Renderer warning: Drawing unknown gate '%s' as a default box.\n", g.Name())
@@ -83,6 +123,7 @@ func (r GGPNG) Render(c circuit.Circuit) (image.Image, error) {
 			}
 		}
 	}
+	r.drawRepeats(dc, c, cl)
 
 	return dc.Image(), nil
 }
@@ -103,7 +144,113 @@ func (r GGPNG) Save(path string, c circuit.Circuit) error { // Changed CircuitSt
 // ─── helpers ──────────────────────────────────────────────────────────────
 
 func (r GGPNG) x(step int) float64 { return float64(step)*r.Cell + r.Cell/2 }
-func (r GGPNG) y(line int) float64 { return float64(line)*r.Cell + r.Cell/2 }
+func (r GGPNG) y(line int) float64 { return r.top + float64(line)*r.Cell + r.Cell/2 }
+
+// rail is the height of one classical bit row, drawn below the qubits.
+func (r GGPNG) rail() float64 { return r.Cell / 2 }
+
+// cy returns the y coordinate of classical bit cb's rail.
+func (r GGPNG) cy(c circuit.Circuit, cb int) float64 {
+	return r.top + float64(c.Qubits())*r.Cell + (float64(cb)+0.5)*r.rail()
+}
+
+// drawDoubleLine draws the double line used for classical wires.
+func (r GGPNG) drawDoubleLine(dc *gg.Context, x1, y1, x2, y2 float64) {
+	gap := math.Max(r.Cell*0.025, 1)
+	// Offset perpendicular to the line; classical lines are axis-aligned.
+	dx, dy := 0.0, gap
+	if x1 == x2 {
+		dx, dy = gap, 0
+	}
+	dc.SetRGB(0, 0, 0)
+	dc.SetLineWidth(1)
+	dc.DrawLine(x1-dx, y1-dy, x2-dx, y2-dy)
+	dc.DrawLine(x1+dx, y1+dy, x2+dx, y2+dy)
+	dc.Stroke()
+}
+
+// drawRepeats frames the first copy of every collapsed block with a
+// dashed box over the qubits it touches and labels it with its count.
+func (r GGPNG) drawRepeats(dc *gg.Context, c circuit.Circuit, cl collapsed) {
+	for _, rp := range cl.repeats {
+		top, bottom := -1, -1
+		for _, op := range c.OpsIter() {
+			if op.TimeStep < rp.Start || op.TimeStep >= rp.Start+rp.Len || len(op.Qubits) == 0 {
+				continue
+			}
+			lo, hi := min(op.Qubits...), max(op.Qubits...)
+			if top < 0 || lo < top {
+				top = lo
+			}
+			bottom = max(bottom, hi)
+		}
+		if top < 0 {
+			continue
+		}
+		pad := r.Cell * 0.08
+		left := r.x(cl.column[rp.Start]) - r.Cell/2 + pad
+		right := r.x(cl.column[rp.Start]+rp.Len-1) + r.Cell/2 - pad
+		y0, y1 := r.y(top)-r.Cell*0.42, r.y(bottom)+r.Cell*0.42
+		dc.SetRGB(0, 0, 0)
+		dc.SetLineWidth(1)
+		dc.SetDash(4, 3)
+		dc.DrawRectangle(left, y0, right-left, y1-y0)
+		dc.Stroke()
+		dc.SetDash()
+		// gg's built-in face is ASCII only, so "×" is spelled "x".
+		dc.DrawStringAnchored(fmt.Sprintf("x%d", rp.Times), right, y0-2, 1, 0)
+	}
+}
+
+// drawMeasureArrow connects a measurement to its classical bit with a
+// double line ending in an arrowhead on the bit's rail.
+func (r GGPNG) drawMeasureArrow(dc *gg.Context, c circuit.Circuit, op circuit.Operation) {
+	if op.Line < 0 || op.Cbit >= c.Clbits() {
+		return
+	}
+	x, y, cy := r.x(op.TimeStep), r.y(op.Line), r.cy(c, op.Cbit)
+	head := r.Cell * 0.08
+	r.drawDoubleLine(dc, x, y, x, cy-head)
+	dc.MoveTo(x-head, cy-head)
+	dc.LineTo(x+head, cy-head)
+	dc.LineTo(x, cy)
+	dc.ClosePath()
+	dc.Fill()
+	dc.DrawStringAnchored(fmt.Sprint(op.Cbit), x+head*1.5, cy-head, 0, 0.5)
+}
+
+// drawCondition marks a classically controlled operation: a double line
+// runs from its lowest qubit down to the last bit it reads, with a dot on
+// every such bit's rail, filled where the condition expects 1 and open
+// where it expects 0. Negated conditions get a "!=" next to the last dot.
+func (r GGPNG) drawCondition(dc *gg.Context, c circuit.Circuit, op circuit.Operation) {
+	if len(op.Qubits) == 0 || len(op.Cond.Cbits) == 0 {
+		return
+	}
+	x := r.x(op.TimeStep)
+	last := max(op.Cond.Cbits...)
+	if last >= c.Clbits() {
+		return
+	}
+	r.drawDoubleLine(dc, x, r.y(max(op.Qubits...)), x, r.cy(c, last))
+	rad := r.Cell * 0.07
+	// Value holds the bit for Cbits[i] at position i.
+	want := bitorder.Format(uint64(op.Cond.Value), len(op.Cond.Cbits), bitorder.LSBFirst)
+	for i, cb := range op.Cond.Cbits {
+		dc.DrawCircle(x, r.cy(c, cb), rad)
+		if want[i] == '1' {
+			dc.Fill()
+			continue
+		}
+		dc.SetRGB(1, 1, 1)
+		dc.FillPreserve()
+		dc.SetRGB(0, 0, 0)
+		dc.Stroke()
+	}
+	if op.Cond.Negate {
+		dc.DrawStringAnchored("!=", x+rad*2, r.cy(c, last), 0, 0.5)
+	}
+}
 
 func (r GGPNG) drawBoxGate(dc *gg.Context, op circuit.Operation) {
 	// Assumes op.Line is the target qubit for single-qubit gates
@@ -122,6 +269,25 @@ func (r GGPNG) drawBoxGate(dc *gg.Context, op circuit.Operation) {
 	dc.DrawStringAnchored(op.G.DrawSymbol(), x, y, 0.5, 0.5)
 }
 
+// drawSpanBox draws a composite gate or loop as one labelled box covering every wire
+// between its lowest and highest qubit.
+func (r GGPNG) drawSpanBox(dc *gg.Context, op circuit.Operation) {
+	if len(op.Qubits) == 0 {
+		return
+	}
+	top, bottom := min(op.Qubits...), max(op.Qubits...)
+	x := r.x(op.TimeStep)
+	width := r.Cell * .7
+	height := r.y(bottom) - r.y(top) + width
+	dc.DrawRectangle(x-width/2, r.y(top)-width/2, width, height)
+	dc.SetRGB(1, 1, 1) // White fill
+	dc.FillPreserve()
+	dc.SetRGB(0, 0, 0) // Black stroke
+	dc.SetLineWidth(1)
+	dc.Stroke()
+	dc.DrawStringAnchored(op.G.DrawSymbol(), x, (r.y(top)+r.y(bottom))/2, 0.5, 0.5)
+}
+
 func (r GGPNG) drawToffoli(dc *gg.Context, op circuit.Operation) {
 	if len(op.Qubits) != 3 {
 		fmt.Printf("Renderer warning: TOFFOLI gate at step %d does not have 3 qubits: %v\n", op.TimeStep, op.Qubits)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/circuit"
+	rtest "github.com/kegliz/qcm/qc/renderer/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -149,3 +150,43 @@ func TestGGPNG_Save(t *testing.T) {
 	_, err = png.Decode(f2)
 	assert.NoError(err, "file %s should be a valid PNG", filePath2)
 }
+
+// TestGGPNG_Golden guards the look of a Bell circuit. Font rasterisation
+// varies a little between platforms, so the comparison is perceptual.
+func TestGGPNG_Golden(t *testing.T) {
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+
+	img, err := NewRenderer(defaultCellSize).Render(c)
+	require.NoError(t, err)
+	rtest.AssertGolden(t, filepath.Join("testdata", "bell.png"), img, rtest.Options{MaxHashDistance: 4})
+}
+
+func TestGGPNG_ClassicalWires(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.H(0).Measure(0, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(1) })
+	b.Measure(1, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	img, err := NewRenderer(defaultCellSize).Render(c)
+	require.NoError(err)
+	// Each classical bit adds a half-cell rail below the qubits.
+	assert.Equal(2*defaultCellSize+defaultCellSize, img.Bounds().Dy())
+
+	// The rail of cbit 1 is a dark double line across the image.
+	railY := 2*defaultCellSize + defaultCellSize*3/4
+	dark := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r < 0x8000
+	}
+	assert.True(dark(2, railY-1) || dark(2, railY-2), "upper line of the rail")
+	assert.True(dark(2, railY+1) || dark(2, railY+2), "lower line of the rail")
+	assert.False(dark(2, railY), "gap between the lines")
+}
@@ -0,0 +1,113 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// repeat is a run of Times identical copies of the Len layers starting at
+// Start.
+type repeat struct {
+	Start, Len, Times int
+}
+
+// end returns the first layer after the run.
+func (rp repeat) end() int { return rp.Start + rp.Len*rp.Times }
+
+// layerKeys describes every layer of c as a string; two layers draw the
+// same when their keys are equal.
+func layerKeys(c circuit.Circuit) []string {
+	keys := make([]strings.Builder, c.Depth())
+	for _, op := range c.OpsIter() {
+		k := &keys[op.TimeStep]
+		fmt.Fprintf(k, "%s%v", op.G.Name(), op.Qubits)
+		if p, ok := op.G.(gate.Parametric); ok {
+			fmt.Fprintf(k, "%v", p.Params())
+		}
+		if op.Cbit >= 0 {
+			fmt.Fprintf(k, "→%d", op.Cbit)
+		}
+		if op.Cond != nil {
+			fmt.Fprintf(k, "?%v=%d!%t", op.Cond.Cbits, op.Cond.Value, op.Cond.Negate)
+		}
+		if op.Loop != nil {
+			// Loops are never collapsed: their bodies are not part of the key.
+			fmt.Fprintf(k, "loop%p", op.Loop)
+		}
+		k.WriteByte(';')
+	}
+	out := make([]string, len(keys))
+	for i := range keys {
+		out[i] = keys[i].String()
+	}
+	return out
+}
+
+// findRepeats scans the layers left to right for runs of a block repeated
+// back to back. At each layer it takes the run hiding the most layers,
+// preferring shorter blocks on ties, and continues after it.
+func findRepeats(keys []string) []repeat {
+	var out []repeat
+	for i := 0; i < len(keys); {
+		best := repeat{Start: i, Len: 1, Times: 1}
+		for k := 1; i+2*k <= len(keys); k++ {
+			times := 1
+			for i+(times+1)*k <= len(keys) && sameBlock(keys, i, i+times*k, k) {
+				times++
+			}
+			if times > 1 && k*(times-1) > best.Len*(best.Times-1) {
+				best = repeat{Start: i, Len: k, Times: times}
+			}
+		}
+		if best.Times > 1 {
+			out = append(out, best)
+		}
+		i = best.end()
+	}
+	return out
+}
+
+func sameBlock(keys []string, a, b, k int) bool {
+	for j := range k {
+		if keys[a+j] != keys[b+j] {
+			return false
+		}
+	}
+	return true
+}
+
+// collapsed maps the layers of a circuit to drawn columns once repeats
+// are folded into their first copy.
+type collapsed struct {
+	repeats []repeat
+	column  []int  // column of each layer's first copy
+	hidden  []bool // layers belonging to a later copy
+	width   int    // number of drawn columns
+}
+
+func collapse(depth int, repeats []repeat) collapsed {
+	cl := collapsed{repeats: repeats, column: make([]int, depth), hidden: make([]bool, depth)}
+	col := 0
+	next := 0
+	for l := 0; l < depth; {
+		if next < len(repeats) && repeats[next].Start == l {
+			rp := repeats[next]
+			for j := range rp.Len * rp.Times {
+				cl.column[l+j] = col + j%rp.Len
+				cl.hidden[l+j] = j >= rp.Len
+			}
+			col += rp.Len
+			l = rp.end()
+			next++
+			continue
+		}
+		cl.column[l] = col
+		col++
+		l++
+	}
+	cl.width = col
+	return cl
+}
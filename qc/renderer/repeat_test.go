@@ -0,0 +1,63 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRepeats(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(findRepeats([]string{"a", "b", "c"}))
+	assert.Equal([]repeat{{Start: 0, Len: 1, Times: 4}}, findRepeats([]string{"a", "a", "a", "a"}))
+	// A longer block wins when it hides more layers.
+	assert.Equal([]repeat{{Start: 1, Len: 2, Times: 3}, {Start: 7, Len: 1, Times: 2}},
+		findRepeats([]string{"s", "a", "b", "a", "b", "a", "b", "c", "c"}))
+	assert.Equal([]repeat{{Start: 0, Len: 1, Times: 3}, {Start: 3, Len: 2, Times: 2}},
+		findRepeats([]string{"a", "a", "a", "b", "a", "b", "a"}))
+
+	cl := collapse(9, []repeat{{Start: 1, Len: 2, Times: 3}, {Start: 7, Len: 1, Times: 2}})
+	assert.Equal([]int{0, 1, 2, 1, 2, 1, 2, 3, 3}, cl.column)
+	assert.Equal([]bool{false, false, false, true, true, true, true, false, true}, cl.hidden)
+	assert.Equal(4, cl.width)
+}
+
+func TestGGPNG_CollapseRepeats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.H(0).H(1)
+	for range 3 { // Grover-like iterations
+		b.CZ(0, 1).H(0).H(1).RZ(0.3, 0)
+	}
+	b.Measure(0, 0).Measure(1, 1)
+	dr, err := b.BuildDAG()
+	require.NoError(err)
+	c := circuit.FromDAGWithLayout(dr, circuit.LayoutOptions{AlignMeasurements: true})
+
+	keys := layerKeys(c)
+	assert.Equal([]repeat{{Start: 1, Len: 3, Times: 3}}, findRepeats(keys))
+
+	r := NewRenderer(defaultCellSize)
+	full, err := r.Render(c)
+	require.NoError(err)
+	r.CollapseRepeats = true
+	small, err := r.Render(c)
+	require.NoError(err)
+	// H, one iteration, measurements: 5 of 11 columns, plus a label margin.
+	assert.Equal(11*defaultCellSize, full.Bounds().Dx())
+	assert.Equal(5*defaultCellSize, small.Bounds().Dx())
+	assert.Greater(small.Bounds().Dy(), full.Bounds().Dy())
+
+	// Different angles break the repetition.
+	b = builder.New(builder.Q(1))
+	b.RZ(0.1, 0).RZ(0.2, 0)
+	c2, err := b.BuildCircuit()
+	require.NoError(err)
+	assert.Empty(findRepeats(layerKeys(c2)))
+}
@@ -0,0 +1,283 @@
+// Package testutil helps write rendering regression tests: it compares
+// images pixel by pixel with a per-channel tolerance, computes perceptual
+// hashes that survive anti-aliasing and font differences, and checks
+// rendered images against golden PNG files.
+//
+// Goldens are rewritten instead of compared when the environment variable
+// UpdateEnv is set to a non-empty value:
+//
+//	QCM_UPDATE_GOLDEN=1 go test ./...
+package testutil
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UpdateEnv names the environment variable that makes AssertGolden write
+// the golden files instead of comparing against them.
+const UpdateEnv = "QCM_UPDATE_GOLDEN"
+
+// DiffResult summarises a pixel comparison of two equally sized images.
+type DiffResult struct {
+	// Pixels counts the pixels where some channel differs by more than the
+	// tolerance.
+	Pixels int
+	// Total is the number of pixels compared.
+	Total int
+	// MaxDelta is the largest channel difference seen, in 8-bit units.
+	MaxDelta uint8
+}
+
+// Fraction returns the share of differing pixels, 0 for empty images.
+func (d DiffResult) Fraction() float64 {
+	if d.Total == 0 {
+		return 0
+	}
+	return float64(d.Pixels) / float64(d.Total)
+}
+
+// Diff compares a and b pixel by pixel. A pixel counts as different when
+// any of its R, G, B or A channels (in 8-bit, non-premultiplied units)
+// differs by more than tol. Images of different sizes are an error.
+func Diff(a, b image.Image, tol uint8) (DiffResult, error) {
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Dx() != rb.Dx() || ra.Dy() != rb.Dy() {
+		return DiffResult{}, fmt.Errorf("testutil: image sizes differ: %dx%d vs %dx%d", ra.Dx(), ra.Dy(), rb.Dx(), rb.Dy())
+	}
+	d := DiffResult{Total: ra.Dx() * ra.Dy()}
+	for y := range ra.Dy() {
+		for x := range ra.Dx() {
+			delta := pixelDelta(a.At(ra.Min.X+x, ra.Min.Y+y), b.At(rb.Min.X+x, rb.Min.Y+y))
+			d.MaxDelta = max(d.MaxDelta, delta)
+			if delta > tol {
+				d.Pixels++
+			}
+		}
+	}
+	return d, nil
+}
+
+// DiffImage returns an image of a's size showing where a and b differ by
+// more than tol: differing pixels are red, matching ones a faded copy of a.
+// It is meant to be saved next to a failing test's output.
+func DiffImage(a, b image.Image, tol uint8) (image.Image, error) {
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Dx() != rb.Dx() || ra.Dy() != rb.Dy() {
+		return nil, fmt.Errorf("testutil: image sizes differ: %dx%d vs %dx%d", ra.Dx(), ra.Dy(), rb.Dx(), rb.Dy())
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, ra.Dx(), ra.Dy()))
+	for y := range ra.Dy() {
+		for x := range ra.Dx() {
+			ca := a.At(ra.Min.X+x, ra.Min.Y+y)
+			if pixelDelta(ca, b.At(rb.Min.X+x, rb.Min.Y+y)) > tol {
+				out.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+				continue
+			}
+			g := gray(ca)
+			out.SetNRGBA(x, y, color.NRGBA{R: g, G: g, B: g, A: 64})
+		}
+	}
+	return out, nil
+}
+
+func pixelDelta(a, b color.Color) uint8 {
+	na := color.NRGBAModel.Convert(a).(color.NRGBA)
+	nb := color.NRGBAModel.Convert(b).(color.NRGBA)
+	absDiff := func(x, y uint8) uint8 {
+		if x > y {
+			return x - y
+		}
+		return y - x
+	}
+	return max(absDiff(na.R, nb.R), absDiff(na.G, nb.G), absDiff(na.B, nb.B), absDiff(na.A, nb.A))
+}
+
+// gray returns the luma of c composited over white, so that transparent
+// backgrounds hash like the white canvas the renderers draw on.
+func gray(c color.Color) uint8 {
+	r, g, b, a := c.RGBA()
+	white := 0xffff - a
+	r, g, b = r+white, g+white, b+white
+	return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+}
+
+// hashGrid scales img down to w×h by averaging the luma of each cell.
+func hashGrid(img image.Image, w, h int) []float64 {
+	r := img.Bounds()
+	grid := make([]float64, w*h)
+	if r.Empty() {
+		return grid
+	}
+	counts := make([]int, w*h)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		gy := (y - r.Min.Y) * h / r.Dy()
+		for x := r.Min.X; x < r.Max.X; x++ {
+			gx := (x - r.Min.X) * w / r.Dx()
+			grid[gy*w+gx] += float64(gray(img.At(x, y)))
+			counts[gy*w+gx]++
+		}
+	}
+	for i, n := range counts {
+		if n > 0 {
+			grid[i] /= float64(n)
+		}
+	}
+	return grid
+}
+
+// AverageHash returns the 64-bit average hash of img: it is shrunk to 8×8
+// gray cells and bit i is set when cell i is brighter than the mean.
+// Visually similar images have hashes a small Hamming distance apart.
+func AverageHash(img image.Image) uint64 {
+	grid := hashGrid(img, 8, 8)
+	mean := 0.0
+	for _, v := range grid {
+		mean += v
+	}
+	mean /= float64(len(grid))
+	var h uint64
+	for i, v := range grid {
+		if v > mean {
+			h |= 1 << i
+		}
+	}
+	return h
+}
+
+// DifferenceHash returns the 64-bit difference hash of img: it is shrunk
+// to 9×8 gray cells and each bit records whether a cell is brighter than
+// its right neighbour. It tracks edges, so it is more sensitive than
+// AverageHash to gates moving around and less to overall shading.
+func DifferenceHash(img image.Image) uint64 {
+	grid := hashGrid(img, 9, 8)
+	var h uint64
+	for y := range 8 {
+		for x := range 8 {
+			if grid[y*9+x] > grid[y*9+x+1] {
+				h |= 1 << (y*8 + x)
+			}
+		}
+	}
+	return h
+}
+
+// HammingDistance returns the number of bits in which a and b differ.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Options sets how far an image may drift from its golden. The zero value
+// requires an exact pixel match.
+type Options struct {
+	// Tolerance is the largest per-channel difference, in 8-bit units, a
+	// pixel may show and still count as matching.
+	Tolerance uint8
+	// MaxDiffFraction is the share of pixels allowed to differ beyond
+	// Tolerance.
+	MaxDiffFraction float64
+	// MaxHashDistance, if positive, switches to a perceptual comparison:
+	// the images match when both their average and difference hashes are
+	// at most this many bits apart, whatever their sizes. The pixel
+	// options are then ignored.
+	MaxHashDistance int
+}
+
+// Compare reports whether got matches want under opts, with a description
+// of the mismatch if not.
+func Compare(got, want image.Image, opts Options) (bool, string) {
+	if opts.MaxHashDistance > 0 {
+		da := HammingDistance(AverageHash(got), AverageHash(want))
+		dd := HammingDistance(DifferenceHash(got), DifferenceHash(want))
+		if da > opts.MaxHashDistance || dd > opts.MaxHashDistance {
+			return false, fmt.Sprintf("perceptual hashes differ by %d (average) and %d (difference) bits, max %d", da, dd, opts.MaxHashDistance)
+		}
+		return true, ""
+	}
+	d, err := Diff(got, want, opts.Tolerance)
+	if err != nil {
+		return false, err.Error()
+	}
+	if d.Fraction() > opts.MaxDiffFraction {
+		return false, fmt.Sprintf("%d of %d pixels (%.2f%%) differ by more than %d, max delta %d",
+			d.Pixels, d.Total, 100*d.Fraction(), opts.Tolerance, d.MaxDelta)
+	}
+	return true, ""
+}
+
+// LoadPNG reads a PNG file.
+func LoadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("testutil: decoding %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// SavePNG writes img to path as a PNG, creating parent directories.
+func SavePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// AssertGolden compares img with the golden PNG at path under opts and
+// fails t if they do not match. On a mismatch the rendered image and, for
+// equally sized images, a DiffImage are written to a fresh directory
+// under os.TempDir, which outlives the test, and their paths logged. With UpdateEnv set the golden is
+// (re)written instead and the test passes.
+func AssertGolden(t testing.TB, path string, img image.Image, opts Options) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := SavePNG(path, img); err != nil {
+			t.Fatalf("updating golden %s: %v", path, err)
+		}
+		t.Logf("updated golden %s", path)
+		return
+	}
+	want, err := LoadPNG(path)
+	if err != nil {
+		t.Fatalf("loading golden (set %s=1 to create it): %v", UpdateEnv, err)
+	}
+	ok, msg := Compare(img, want, opts)
+	if ok {
+		return
+	}
+	dir, err := os.MkdirTemp("", "qcm-golden-")
+	if err != nil {
+		t.Errorf("image does not match golden %s: %s", path, msg)
+		return
+	}
+	base := filepath.Base(path)
+	actual := filepath.Join(dir, "actual_"+base)
+	if err := SavePNG(actual, img); err == nil {
+		t.Logf("rendered image written to %s", actual)
+	}
+	if diff, err := DiffImage(img, want, opts.Tolerance); err == nil {
+		diffPath := filepath.Join(dir, "diff_"+base)
+		if err := SavePNG(diffPath, diff); err == nil {
+			t.Logf("diff image written to %s", diffPath)
+		}
+	}
+	t.Errorf("image does not match golden %s: %s", path, msg)
+}
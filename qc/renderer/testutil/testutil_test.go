@@ -0,0 +1,142 @@
+package testutil
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// boxImage draws a black w×h box at (x, y) on a white canvas.
+func boxImage(x, y, w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for py := range 48 {
+		for px := range 64 {
+			c := color.NRGBA{255, 255, 255, 255}
+			if px >= x && px < x+w && py >= y && py < y+h {
+				c = color.NRGBA{0, 0, 0, 255}
+			}
+			img.SetNRGBA(px, py, c)
+		}
+	}
+	return img
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := boxImage(10, 10, 20, 10)
+	b := boxImage(10, 10, 20, 10)
+	d, err := Diff(a, b, 0)
+	require.NoError(err)
+	assert.Equal(DiffResult{Pixels: 0, Total: 64 * 48}, d)
+
+	// Anti-aliasing-like noise stays within the tolerance.
+	b.SetNRGBA(5, 5, color.NRGBA{250, 250, 250, 255})
+	d, err = Diff(a, b, 8)
+	require.NoError(err)
+	assert.Equal(0, d.Pixels)
+	assert.Equal(uint8(5), d.MaxDelta)
+	d, err = Diff(a, b, 4)
+	require.NoError(err)
+	assert.Equal(1, d.Pixels)
+
+	// Moving the box by one pixel changes two of its columns.
+	d, err = Diff(a, boxImage(11, 10, 20, 10), 8)
+	require.NoError(err)
+	assert.Equal(20, d.Pixels)
+	assert.InDelta(20.0/(64*48), d.Fraction(), 1e-12)
+
+	diff, err := DiffImage(a, boxImage(11, 10, 20, 10), 8)
+	require.NoError(err)
+	assert.Equal(color.NRGBA{R: 255, A: 255}, diff.At(10, 12))
+	assert.Equal(uint8(64), diff.At(0, 0).(color.NRGBA).A)
+
+	_, err = Diff(a, image.NewNRGBA(image.Rect(0, 0, 10, 10)), 0)
+	assert.Error(err)
+	_, err = DiffImage(a, image.NewNRGBA(image.Rect(0, 0, 10, 10)), 0)
+	assert.Error(err)
+}
+
+func TestHashes(t *testing.T) {
+	assert := assert.New(t)
+
+	a := boxImage(8, 8, 24, 16)
+	assert.Equal(AverageHash(a), AverageHash(boxImage(8, 8, 24, 16)))
+
+	// A one-pixel shift or a scaled copy is perceptually close…
+	near := boxImage(9, 8, 24, 16)
+	assert.LessOrEqual(HammingDistance(AverageHash(a), AverageHash(near)), 4)
+	assert.LessOrEqual(HammingDistance(DifferenceHash(a), DifferenceHash(near)), 4)
+	big := image.NewNRGBA(image.Rect(0, 0, 128, 96))
+	for y := range 96 {
+		for x := range 128 {
+			big.Set(x, y, a.At(x/2, y/2))
+		}
+	}
+	assert.LessOrEqual(HammingDistance(AverageHash(a), AverageHash(big)), 2)
+
+	// …while a box elsewhere is not.
+	far := boxImage(36, 24, 24, 16)
+	assert.Greater(HammingDistance(AverageHash(a), AverageHash(far)), 10)
+	assert.Greater(HammingDistance(DifferenceHash(a), DifferenceHash(far)), 4)
+
+	assert.Equal(0, HammingDistance(5, 5))
+	assert.Equal(64, HammingDistance(0, ^uint64(0)))
+}
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	a := boxImage(10, 10, 20, 10)
+	shifted := boxImage(11, 10, 20, 10)
+	ok, msg := Compare(a, shifted, Options{})
+	assert.False(ok)
+	assert.Contains(msg, "20 of 3072 pixels")
+	ok, _ = Compare(a, shifted, Options{MaxDiffFraction: 0.01})
+	assert.True(ok)
+	ok, _ = Compare(a, shifted, Options{MaxHashDistance: 4})
+	assert.True(ok)
+	ok, msg = Compare(a, boxImage(36, 24, 20, 10), Options{MaxHashDistance: 4})
+	assert.False(ok)
+	assert.Contains(msg, "perceptual hashes")
+	ok, msg = Compare(a, image.NewNRGBA(image.Rect(0, 0, 1, 1)), Options{})
+	assert.False(ok)
+	assert.Contains(msg, "sizes differ")
+}
+
+func TestAssertGolden(t *testing.T) {
+	require := require.New(t)
+
+	golden := filepath.Join(t.TempDir(), "testdata", "box.png")
+	img := boxImage(10, 10, 20, 10)
+
+	t.Setenv(UpdateEnv, "1")
+	AssertGolden(t, golden, img, Options{})
+	loaded, err := LoadPNG(golden)
+	require.NoError(err)
+	d, err := Diff(img, loaded, 0)
+	require.NoError(err)
+	require.Zero(d.Pixels)
+
+	t.Setenv(UpdateEnv, "")
+	AssertGolden(t, golden, img, Options{})
+	AssertGolden(t, golden, boxImage(11, 10, 20, 10), Options{MaxHashDistance: 4})
+
+	ft := &fakeT{TB: t}
+	AssertGolden(ft, golden, boxImage(30, 30, 20, 10), Options{})
+	require.True(ft.failed, "a different image must fail")
+}
+
+// fakeT records failures instead of failing the enclosing test.
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeT) Errorf(string, ...any) { f.failed = true }
+func (f *fakeT) Logf(string, ...any)   {}
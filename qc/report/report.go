@@ -0,0 +1,224 @@
+// Package report prints the analysis blocks of algorithm demos: tables of
+// measured outcomes, success or failure verdicts backed by confidence
+// intervals, and listings of the expected states, so that examples only
+// build their circuits and say what a correct run looks like.
+package report
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Options configures a Reporter. The zero value is usable.
+type Options struct {
+	// Keys is how outcomes are shown, and how Case.Expected is written;
+	// raw keys, lowest cbit first, by default.
+	Keys simulator.KeyFormat
+	// Confidence is the level of the intervals behind verdicts; 0 => 0.99.
+	Confidence float64
+	// Threshold is the probability the expected outcomes must be shown to
+	// exceed; 0 => 0.5.
+	Threshold float64
+	// MaxRows limits tables to the most frequent outcomes; 0 lists all.
+	MaxRows int
+	// Intervals adds the confidence interval of every row to tables.
+	Intervals bool
+	// ASCII replaces the marks ✓, ✗ and → by plain text.
+	ASCII bool
+}
+
+// Case is one run to report on.
+type Case struct {
+	// Title heads the block, e.g. `Results for hidden string "01":`.
+	Title  string
+	Result *simulator.Result
+	// Expected are the outcomes of a correct run, written as Options.Keys
+	// formats them. Without any the block has no verdict.
+	Expected []string
+	// ListExpected prints Expected under the table.
+	ListExpected bool
+	// Success and Failure describe the verdict; "Expected outcomes" and
+	// "Unexpected outcomes" if empty.
+	Success, Failure string
+	// Classify marks a verdict that tells two answers apart, such as
+	// constant and balanced oracles, rather than judging the run: it is
+	// printed with an arrow instead of ✓ or ✗.
+	Classify bool
+	// Notes are printed after the verdict, one per line.
+	Notes []string
+}
+
+// Verdict is the statistical test of a Case: whether the confidence
+// interval of the probability of its expected outcomes lies above the
+// threshold (Pass), below it, or straddles it (not Conclusive).
+type Verdict struct {
+	Pass, Conclusive bool
+	// P is the fraction of shots that gave an expected outcome and
+	// [Lo, Hi] its confidence interval.
+	P, Lo, Hi float64
+}
+
+// Reporter writes report blocks to W.
+type Reporter struct {
+	W io.Writer
+	Options
+}
+
+// New returns a Reporter writing to w.
+func New(w io.Writer, o Options) *Reporter {
+	return &Reporter{W: w, Options: o}
+}
+
+func (r *Reporter) confidence() float64 {
+	if r.Confidence == 0 {
+		return 0.99
+	}
+	return r.Confidence
+}
+
+func (r *Reporter) threshold() float64 {
+	if r.Threshold == 0 {
+		return 0.5
+	}
+	return r.Threshold
+}
+
+// mark returns the symbol or its ASCII replacement.
+func (r *Reporter) mark(s string) string {
+	if !r.ASCII {
+		return s
+	}
+	switch s {
+	case "✓":
+		return "[ok]"
+	case "✗":
+		return "[fail]"
+	case "?":
+		return "[?]"
+	}
+	return "->"
+}
+
+// Section prints a heading between groups of cases.
+func (r *Reporter) Section(title string) {
+	fmt.Fprintf(r.W, "\n=== %s ===\n", title)
+}
+
+// Case prints the block of c: its title, the outcome table, the expected
+// states, the verdict and the notes. Problems with the statistics, such
+// as a result without shots, are printed as an inconclusive verdict.
+func (r *Reporter) Case(c Case) Verdict {
+	if c.Title != "" {
+		fmt.Fprintln(r.W, c.Title)
+	}
+	r.Table(c.Result)
+	if c.ListExpected && len(c.Expected) > 0 {
+		fmt.Fprintf(r.W, "  Expected states: %s\n", kets(c.Expected))
+	}
+	var v Verdict
+	if len(c.Expected) > 0 {
+		v = r.verdict(c)
+	}
+	for _, n := range c.Notes {
+		fmt.Fprintf(r.W, "  %s %s\n", r.mark("→"), n)
+	}
+	return v
+}
+
+// Table prints the outcomes of res, most frequent first, with their counts
+// and percentages.
+func (r *Reporter) Table(res *simulator.Result) {
+	counts := res.Format(r.Keys)
+	keys := slices.Sorted(maps.Keys(counts))
+	slices.SortStableFunc(keys, func(a, b string) int { return counts[b] - counts[a] })
+	shown := keys
+	if r.MaxRows > 0 && len(keys) > r.MaxRows {
+		shown = keys[:r.MaxRows]
+	}
+	for _, k := range shown {
+		n := counts[k]
+		fmt.Fprintf(r.W, "  |%s⟩: %d counts (%.2f%%", k, n, percent(n, res.Shots))
+		if r.Intervals {
+			lo, hi, err := ci(n, res.Shots, r.confidence())
+			if err == nil {
+				fmt.Fprintf(r.W, ", %.0f%% CI [%.3f, %.3f]", r.confidence()*100, lo, hi)
+			}
+		}
+		fmt.Fprintln(r.W, ")")
+	}
+	if rest := keys[len(shown):]; len(rest) > 0 {
+		n := 0
+		for _, k := range rest {
+			n += counts[k]
+		}
+		fmt.Fprintf(r.W, "  … %d more outcomes: %d counts (%.2f%%)\n", len(rest), n, percent(n, res.Shots))
+	}
+}
+
+// verdict tests and prints whether the expected outcomes of c dominate.
+func (r *Reporter) verdict(c Case) Verdict {
+	res := c.Result
+	hits := 0
+	for k, n := range res.Format(r.Keys) {
+		if slices.Contains(c.Expected, k) {
+			hits += n
+		}
+	}
+	conf, thr := r.confidence(), r.threshold()
+	lo, hi, err := ci(hits, res.Shots, conf)
+	if err != nil {
+		fmt.Fprintf(r.W, "  %s Inconclusive (%v)\n", r.mark("?"), err)
+		return Verdict{}
+	}
+	v := Verdict{P: float64(hits) / float64(res.Shots), Lo: lo, Hi: hi}
+	success, failure := c.Success, c.Failure
+	if success == "" {
+		success = "Expected outcomes"
+	}
+	if failure == "" {
+		failure = "Unexpected outcomes"
+	}
+	pass, fail := r.mark("✓"), r.mark("✗")
+	if c.Classify {
+		pass, fail = r.mark("→"), r.mark("→")
+	}
+	stats := fmt.Sprintf("P = %.3f, %.0f%% CI [%.3f, %.3f]", v.P, conf*100, lo, hi)
+	switch {
+	case lo > thr:
+		v.Pass, v.Conclusive = true, true
+		fmt.Fprintf(r.W, "  %s %s (%s > %g)\n", pass, success, stats, thr)
+	case hi < thr:
+		v.Conclusive = true
+		fmt.Fprintf(r.W, "  %s %s (%s < %g)\n", fail, failure, stats, thr)
+	default:
+		fmt.Fprintf(r.W, "  %s Inconclusive, take more shots (%s includes %g)\n", r.mark("?"), stats, thr)
+	}
+	return v
+}
+
+// kets writes keys as a list of basis states.
+func kets(keys []string) string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = "|" + k + "⟩"
+	}
+	return strings.Join(out, " ")
+}
+
+// ci is the Wilson interval of k successes in n shots.
+func ci(k, n int, confidence float64) (lo, hi float64, err error) {
+	res := simulator.Result{Counts: map[string]int{"": k}, Shots: n}
+	return res.ProbabilityCI("", confidence)
+}
+
+func percent(n, shots int) float64 {
+	if shots == 0 {
+		return 0
+	}
+	return float64(n) / float64(shots) * 100
+}
@@ -0,0 +1,82 @@
+package report
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+// result returns a two-cbit result with raw keys, cbit 0 first.
+func result(counts map[string]int) *simulator.Result {
+	shots := 0
+	for _, n := range counts {
+		shots += n
+	}
+	return &simulator.Result{
+		Counts:    counts,
+		Shots:     shots,
+		Cbits:     []int{0, 1},
+		Registers: []circuit.Register{{Name: "c", Start: 0, Size: 2}},
+	}
+}
+
+func TestCase(t *testing.T) {
+	assert := assert.New(t)
+
+	var sb strings.Builder
+	r := New(&sb, Options{Keys: simulator.KeyFormat{Order: simulator.MSBFirst}})
+	// Raw "10" is cbit 0 set, written "01" most significant bit first.
+	v := r.Case(Case{
+		Title:        "Results:",
+		Result:       result(map[string]int{"10": 900, "00": 100}),
+		Expected:     []string{"01"},
+		ListExpected: true,
+		Notes:        []string{"done"},
+	})
+	assert.True(v.Pass)
+	assert.True(v.Conclusive)
+	assert.InDelta(0.9, v.P, 1e-12)
+	assert.Less(v.Lo, 0.9)
+	assert.Greater(v.Hi, 0.9)
+	assert.Equal("Results:\n"+
+		"  |01⟩: 900 counts (90.00%)\n"+
+		"  |00⟩: 100 counts (10.00%)\n"+
+		"  Expected states: |01⟩\n"+
+		"  ✓ Expected outcomes (P = 0.900, 99% CI [0.873, 0.922] > 0.5)\n"+
+		"  → done\n", sb.String())
+
+	sb.Reset()
+	v = r.Case(Case{Result: result(map[string]int{"10": 10, "00": 990}), Expected: []string{"01"}, Failure: "Wrong"})
+	assert.False(v.Pass)
+	assert.True(v.Conclusive)
+	assert.Contains(sb.String(), "✗ Wrong (P = 0.010")
+
+	sb.Reset()
+	v = r.Case(Case{Result: result(map[string]int{"10": 5, "00": 5}), Expected: []string{"01"}})
+	assert.False(v.Conclusive)
+	assert.Contains(sb.String(), "Inconclusive, take more shots")
+
+	sb.Reset()
+	r.ASCII = true
+	r.Case(Case{Result: result(map[string]int{"00": 10}), Expected: []string{"00"}, Classify: true})
+	assert.Contains(sb.String(), "  -> Expected outcomes (P = 1.000")
+
+	sb.Reset()
+	v = r.Case(Case{Result: result(nil), Expected: []string{"00"}})
+	assert.False(v.Conclusive)
+	assert.Contains(sb.String(), "[?] Inconclusive (simulator: result has no shots)")
+}
+
+func TestTable(t *testing.T) {
+	var sb strings.Builder
+	r := New(&sb, Options{MaxRows: 2, Intervals: true, Confidence: 0.95})
+	r.Table(result(map[string]int{"00": 50, "11": 30, "01": 10, "10": 10}))
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "  |00⟩: 50 counts (50.00%, 95% CI ["), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "  |11⟩: 30 counts"), lines[1])
+	assert.Equal(t, "  … 2 more outcomes: 20 counts (20.00%)", lines[2])
+}
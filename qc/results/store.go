@@ -0,0 +1,176 @@
+// Package results persists simulation results with the manifests that
+// produced them, so that campaigns of runs can be compared later.
+package results
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kegliz/qcm/qc/experiment"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// ErrNotFound is returned by Get for an unknown ID.
+var ErrNotFound = errors.New("results: record not found")
+
+// Record is one saved result.
+type Record struct {
+	ID       string               `json:"id"`
+	Saved    time.Time            `json:"saved"`
+	Result   *simulator.Result    `json:"result"`
+	Manifest *experiment.Manifest `json:"manifest,omitempty"`
+}
+
+// Filter selects records; zero fields match everything.
+type Filter struct {
+	CircuitHash    string
+	Backend        string
+	BackendVersion string
+	Seed           int64
+	MinShots       int
+	Since, Until   time.Time // Saved in [Since, Until)
+	Limit          int       // at most this many, oldest first; 0: no limit
+}
+
+// Match reports whether r passes every set field of f except Limit.
+// Fields taken from the manifest never match a record without one.
+func (f Filter) Match(r Record) bool {
+	m := r.Manifest
+	switch {
+	case f.CircuitHash != "" && (m == nil || m.CircuitHash != f.CircuitHash),
+		f.Backend != "" && (m == nil || m.Backend.Name != f.Backend),
+		f.BackendVersion != "" && (m == nil || m.Backend.Version != f.BackendVersion),
+		f.Seed != 0 && (m == nil || m.Seed != f.Seed),
+		f.MinShots > 0 && (r.Result == nil || r.Result.Shots < f.MinShots),
+		!f.Since.IsZero() && r.Saved.Before(f.Since),
+		!f.Until.IsZero() && !r.Saved.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Store saves results and queries them back.
+type Store interface {
+	// Save stores res with the manifest it was run from (which may be nil)
+	// and returns the new record's ID.
+	Save(res *simulator.Result, m *experiment.Manifest) (string, error)
+	// Get returns the record with the given ID, or ErrNotFound.
+	Get(id string) (Record, error)
+	// Query returns the records matching f, oldest first.
+	Query(f Filter) ([]Record, error)
+}
+
+// FileStore keeps one JSON file per record in a directory. It is safe for
+// concurrent use within a process; files are written atomically, so
+// several processes may also save into one directory.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+var _ Store = (*FileStore)(nil)
+
+// OpenFileStore returns a store in dir, creating the directory if needed.
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("results: %w", err)
+	}
+	return &FileStore{dir: dir, now: time.Now}, nil
+}
+
+// Save implements Store. IDs sort in the order records were saved.
+func (s *FileStore) Save(res *simulator.Result, m *experiment.Manifest) (string, error) {
+	if res == nil {
+		return "", fmt.Errorf("results: nil result")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := s.now().UTC()
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", fmt.Errorf("results: %w", err)
+	}
+	id := saved.Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix[:])
+	data, err := json.MarshalIndent(Record{ID: id, Saved: saved, Result: res, Manifest: m}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("results: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("results: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("results: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("results: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(id)); err != nil {
+		return "", fmt.Errorf("results: %w", err)
+	}
+	return id, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Get implements Store.
+func (s *FileStore) Get(id string) (Record, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return Record{}, ErrNotFound
+	}
+	return s.read(s.path(id))
+}
+
+func (s *FileStore) read(path string) (Record, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("results: %w", err)
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Record{}, fmt.Errorf("results: %s: %w", filepath.Base(path), err)
+	}
+	return r, nil
+}
+
+// Query implements Store. It reads every record, so its cost grows with
+// the size of the store.
+func (s *FileStore) Query(f Filter) ([]Record, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("results: %w", err)
+	}
+	slices.Sort(paths) // IDs, hence file names, sort by save time
+	var out []Record
+	for _, p := range paths {
+		r, err := s.read(p)
+		if err != nil {
+			return nil, err
+		}
+		if !f.Match(r) {
+			continue
+		}
+		out = append(out, r)
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package results
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/experiment"
+	"github.com/kegliz/qcm/qc/simulator"
+	_ "github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := filepath.Join(t.TempDir(), "campaign")
+	s, err := OpenFileStore(dir)
+	require.NoError(err)
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { clock = clock.Add(time.Hour); return clock }
+
+	bell := builder.New(builder.Q(2), builder.C(2))
+	bell.H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1)
+	c, err := bell.BuildCircuit()
+	require.NoError(err)
+	flip := builder.New(builder.Q(1), builder.C(1))
+	flip.X(0).Measure(0, 0)
+	c2, err := flip.BuildCircuit()
+	require.NoError(err)
+
+	var ids []string
+	for i, shots := range []int{100, 200, 300} {
+		circ := c
+		if i == 2 {
+			circ = c2
+		}
+		m, err := experiment.NewManifest(circ, "qsim", simulator.SimulatorOptions{Shots: shots, Seed: int64(i + 1)}, nil)
+		require.NoError(err)
+		sim, err := m.Simulator()
+		require.NoError(err)
+		res, err := sim.RunResult(circ)
+		require.NoError(err)
+		id, err := s.Save(res, m)
+		require.NoError(err)
+		ids = append(ids, id)
+	}
+	_, err = s.Save(&simulator.Result{Counts: map[string]int{"0": 1}, Shots: 1}, nil)
+	require.NoError(err)
+
+	r, err := s.Get(ids[1])
+	require.NoError(err)
+	assert.Equal(200, r.Result.Shots)
+	assert.Equal(int64(2), r.Manifest.Seed)
+	assert.Equal(clock.Add(-2*time.Hour), r.Saved)
+	_, err = s.Get("nope")
+	assert.ErrorIs(err, ErrNotFound)
+
+	all, err := s.Query(Filter{})
+	require.NoError(err)
+	require.Len(all, 4)
+	assert.Equal(ids, []string{all[0].ID, all[1].ID, all[2].ID}, "oldest first")
+
+	query := func(f Filter) []string {
+		rs, err := s.Query(f)
+		require.NoError(err)
+		var out []string
+		for _, r := range rs {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	assert.Equal(ids[:2], query(Filter{CircuitHash: all[0].Manifest.CircuitHash}))
+	assert.Equal(ids[1:], query(Filter{Backend: "qsim", MinShots: 150}))
+	assert.Equal(ids[:1], query(Filter{Backend: "qsim", Limit: 1}))
+	assert.Equal(ids[1:2], query(Filter{Since: all[1].Saved, Until: all[2].Saved}))
+	assert.Equal(ids[2:], query(Filter{Seed: 3}))
+	assert.Empty(query(Filter{BackendVersion: "v0"}))
+
+	// A second store on the same directory sees the same records.
+	other, err := OpenFileStore(dir)
+	require.NoError(err)
+	rs, err := other.Query(Filter{})
+	require.NoError(err)
+	assert.Len(rs, 4)
+
+	require.NoError(os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o644))
+	_, err = s.Query(Filter{})
+	assert.ErrorContains(err, "bad.json")
+}
@@ -0,0 +1,111 @@
+package simulator
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// LoopObserver is told how many times the body of a repeat-until-success
+// loop ran each time a runner finishes the loop; op is the loop operation
+// as it appears in the circuit the runner executes, nested loops
+// included. Runners may call it from several goroutines at once.
+type LoopObserver interface {
+	ObserveLoop(op circuit.Operation, runs int)
+}
+
+// LoopCountingRunner is implemented by runners that can report the loops
+// they run to a LoopObserver.
+type LoopCountingRunner interface {
+	// WithLoopObserver returns a runner that shares this one's
+	// configuration and metrics and reports every loop it runs to o.
+	WithLoopObserver(o LoopObserver) OneShotRunner
+}
+
+// LoopAttempts is how often the body of one repeat-until-success loop ran.
+type LoopAttempts struct {
+	TimeStep int // of the loop operation
+	Max      int // the loop's bound
+	// Counts maps the number of body runs, 1 to Max, to shots; shots
+	// whose condition skipped the loop count as 0. A shot at Max may have
+	// succeeded on its last attempt or given up.
+	Counts map[int]int
+}
+
+// Mean returns the average number of body runs per shot.
+func (l LoopAttempts) Mean() float64 {
+	sum, shots := 0, 0
+	for k, n := range l.Counts {
+		sum += k * n
+		shots += n
+	}
+	if shots == 0 {
+		return 0
+	}
+	return float64(sum) / float64(shots)
+}
+
+// RunAttempts is RunResult that also records, in Result.Attempts, how many
+// times every top-level repeat-until-success loop ran its body. The runner
+// counts the runs as it executes the loops, so circuits with loops need a
+// runner implementing LoopCountingRunner; a loop skipped by its condition
+// counts as 0 runs. The circuit is run as is, without Taper or LightCone.
+// With PostSelect, the counts include the discarded shots.
+func (s *Simulator) RunAttempts(c circuit.Circuit) (*Result, error) {
+	a := &attemptCounter{index: map[*circuit.Loop]int{}}
+	for _, op := range c.OpsIter() {
+		if op.Loop != nil {
+			a.index[op.Loop] = len(a.loops)
+			a.loops = append(a.loops, LoopAttempts{TimeStep: op.TimeStep, Max: op.Loop.Max, Counts: map[int]int{}})
+		}
+	}
+	sub := *s
+	if len(a.loops) > 0 {
+		lr, ok := s.runner.(LoopCountingRunner)
+		if !ok {
+			return nil, fmt.Errorf("simulator: runner %T cannot count loop attempts", s.runner)
+		}
+		sub.runner = lr.WithLoopObserver(a)
+		// Keep c's own loop operations, which a counts by identity.
+		sub.NoTaper, sub.NoLightCone = true, true
+	}
+	res, err := sub.RunResult(c)
+	if err != nil {
+		return nil, err
+	}
+	shots := 0
+	for _, n := range res.Counts {
+		shots += n
+	}
+	for i := range a.loops {
+		ran := 0
+		for _, n := range a.loops[i].Counts {
+			ran += n
+		}
+		if ran < shots {
+			a.loops[i].Counts[0] += shots - ran
+		}
+	}
+	res.Attempts = a.loops
+	return res, nil
+}
+
+// attemptCounter is the LoopObserver of RunAttempts: it tallies the body
+// runs of the loops in index, ignoring nested ones.
+type attemptCounter struct {
+	index map[*circuit.Loop]int // read-only while the run lasts
+	mu    sync.Mutex
+	loops []LoopAttempts
+}
+
+// ObserveLoop implements LoopObserver.
+func (a *attemptCounter) ObserveLoop(op circuit.Operation, runs int) {
+	i, ok := a.index[op.Loop]
+	if !ok {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.loops[i].Counts[runs]++
+}
@@ -0,0 +1,84 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// DefaultMaxShots caps the shots chosen by SimulatorOptions.MinCounts when
+// MaxShots is 0.
+const DefaultMaxShots = 1 << 20
+
+// ShotPlan is the shot count chosen for a circuit by
+// SimulatorOptions.MinCounts, with the reasoning behind it.
+type ShotPlan struct {
+	Shots int
+	// Bits is the number of measured bits that can vary independently:
+	// the measured cbits, but no more than the measured qubits.
+	Bits int
+	// Outcomes is 2^Bits, the plausible outcomes when none is ruled out.
+	Outcomes int
+	// MinCounts is the expected count per outcome asked for; Shots gives
+	// every outcome at least that many under a uniform distribution.
+	MinCounts int
+	// Capped reports that MaxShots bounded Shots, so outcomes expect fewer
+	// than MinCounts counts.
+	Capped bool
+}
+
+// String explains the plan for people.
+func (p ShotPlan) String() string {
+	s := fmt.Sprintf("%d shots for %d measured bits: ≥%d expected counts for each of %d outcomes",
+		p.Shots, p.Bits, p.MinCounts, p.Outcomes)
+	if p.Capped {
+		s = fmt.Sprintf("%d shots for %d measured bits (capped): %.3g expected counts for each of 2^%d outcomes, %d asked",
+			p.Shots, p.Bits, float64(p.Shots)/float64(p.Outcomes), p.Bits, p.MinCounts)
+	}
+	return s
+}
+
+// PlanShots chooses the shots for c from MinCounts: enough for every one
+// of the 2^m outcomes of its m measured bits to be expected MinCounts
+// times if all are equally likely, which is the worst case, but never
+// fewer than Shots nor more than MaxShots. Without MinCounts the plan is
+// Shots.
+func (s *Simulator) PlanShots(c circuit.Circuit) ShotPlan {
+	bits := min(len(measuredCbits(c)), len(measurements(c)))
+	p := ShotPlan{Shots: s.Shots, Bits: bits, MinCounts: s.MinCounts}
+	if bits < 62 {
+		p.Outcomes = 1 << bits
+	}
+	if s.MinCounts <= 0 {
+		return p
+	}
+	limit := s.MaxShots
+	if limit <= 0 {
+		limit = DefaultMaxShots
+	}
+	limit = max(limit, s.Shots)
+	if p.Outcomes == 0 || p.Outcomes > limit/s.MinCounts {
+		p.Shots, p.Capped = limit, true
+		return p
+	}
+	p.Shots = max(s.Shots, s.MinCounts*p.Outcomes)
+	return p
+}
+
+// planned returns s, or a copy running PlanShots(c) shots when MinCounts
+// is set.
+func (s *Simulator) planned(c circuit.Circuit) (*Simulator, *ShotPlan) {
+	if s.MinCounts <= 0 {
+		return s, nil
+	}
+	p := s.PlanShots(c)
+	s.log.Info().
+		Int("shots", p.Shots).
+		Int("measured_bits", p.Bits).
+		Int("min_counts", p.MinCounts).
+		Bool("capped", p.Capped).
+		Msg("simulator: Chose the shot count")
+	sub := *s
+	sub.Shots, sub.MinCounts = p.Shots, 0
+	return &sub, &p
+}
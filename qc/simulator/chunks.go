@@ -0,0 +1,166 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// defaultChunkShots is the chunk size of chunked runs when
+// SimulatorOptions.ChunkShots is not set.
+const defaultChunkShots = 64
+
+// RandRunner is implemented by runners that can draw all the randomness of
+// a shot from a given source. Seeded runs need it to be reproducible.
+type RandRunner interface {
+	RunOnceRand(c circuit.Circuit, rng *rand.Rand) (string, error)
+}
+
+// ChunkResult is the histogram of one chunk of a run.
+type ChunkResult struct {
+	Index  int   // position of the chunk; chunks are merged in this order
+	Worker int   // worker that ran the chunk, for debugging only
+	Seed   int64 // seed of the chunk's random source; 0 if it had none
+	Shots  int
+	Counts map[string]int
+}
+
+// chunkSeed derives the seed of chunk i from the run seed (SplitMix64).
+func chunkSeed(seed int64, i int) int64 {
+	z := uint64(seed) + uint64(i+1)*0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return int64(z ^ z>>31)
+}
+
+// RunChunks runs c with s.Seed set and returns the histogram of every chunk
+// of ChunkShots shots, in order. Each chunk draws from its own source
+// seeded from Seed and its index, so a chunk's counts do not depend on
+// which worker ran it or when; Run merges the same chunks. Comparing the
+// chunks of two runs shows where their randomness diverged.
+func (s *Simulator) RunChunks(c circuit.Circuit) ([]ChunkResult, error) {
+	if s.Seed == 0 {
+		return nil, fmt.Errorf("simulator: RunChunks needs a non-zero Seed")
+	}
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	c, project := s.plan(c)
+	return s.idealChunks(c, project)
+}
+
+// runChunked is the path of the Run* methods for seeded runs and for runs
+// reporting Progress: shots are counted in chunks, each drawing from its
+// own seeded source when Seed is set.
+func (s *Simulator) runChunked(c circuit.Circuit, project func(string) string) (map[string]int, error) {
+	var chunks []ChunkResult
+	var err error
+	if s.Seed != 0 {
+		chunks, err = s.idealChunks(c, project)
+	} else {
+		chunks, err = s.runChunks(func(*rand.Rand) (string, error) {
+			key, err := s.runner.RunOnce(c)
+			return project(key), err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mergeChunks(chunks), nil
+}
+
+func (s *Simulator) idealChunks(c circuit.Circuit, project func(string) string) ([]ChunkResult, error) {
+	rr, ok := s.runner.(RandRunner)
+	if !ok {
+		return nil, fmt.Errorf("simulator: seeded runs need a runner implementing RandRunner")
+	}
+	return s.runChunks(func(rng *rand.Rand) (string, error) {
+		key, err := rr.RunOnceRand(c, rng)
+		return project(key), err
+	})
+}
+
+// runChunks splits s.Shots into chunks, hands them to s.Workers workers in
+// turn and counts the keys shot returns; in unseeded runs shot gets a nil
+// source. On failure it reports the error of the lowest failing chunk.
+func (s *Simulator) runChunks(shot func(rng *rand.Rand) (string, error)) ([]ChunkResult, error) {
+	size := s.chunkShots()
+	n := (s.Shots + size - 1) / size
+	chunks := make([]ChunkResult, n)
+	errs := make([]error, n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := range min(max(s.Workers, 1), n) {
+		wg.Add(1)
+		s.spawn(func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				ch := &chunks[i]
+				*ch = ChunkResult{Index: i, Worker: w, Shots: min(size, s.Shots-i*size), Counts: map[string]int{}}
+				var rng *rand.Rand
+				if s.Seed != 0 {
+					ch.Seed = chunkSeed(s.Seed, i)
+					rng = rand.New(rand.NewSource(ch.Seed))
+				}
+				for range ch.Shots {
+					key, err := s.meteredShot(shot, rng)
+					if err != nil {
+						errs[i] = err
+						break
+					}
+					ch.Counts[key]++
+				}
+				if errs[i] == nil && s.Progress != nil {
+					s.Progress(*ch)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return chunks, fmt.Errorf("chunk %d failed: %w", i, err)
+		}
+	}
+	s.log.Info().Int("shots", s.Shots).Int("chunks", n).Int64("seed", s.Seed).
+		Msg("simulator: Chunked run finished")
+	return chunks, nil
+}
+
+// chunkShots is the number of shots per chunk.
+func (s *Simulator) chunkShots() int {
+	if s.ChunkShots <= 0 {
+		return defaultChunkShots
+	}
+	return s.ChunkShots
+}
+
+// mergeChunks sums the chunks' counts in chunk order.
+func mergeChunks(chunks []ChunkResult) map[string]int {
+	hist := map[string]int{}
+	for _, ch := range chunks {
+		for k, n := range ch.Counts {
+			hist[k] += n
+		}
+	}
+	return hist
+}
+
+// meteredShot runs shot, charging it to the run's meter if it has one.
+func (s *Simulator) meteredShot(shot func(*rand.Rand) (string, error), rng *rand.Rand) (key string, err error) {
+	if s.meter == nil {
+		return shot(rng)
+	}
+	err = s.meter.shot(func() error {
+		key, err = shot(rng)
+		return err
+	})
+	return key, err
+}
@@ -0,0 +1,124 @@
+package simulator
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/stabilizer"
+)
+
+// DeterministicOutcome reports whether every shot of c gives the same
+// result, and if so which (one character per cbit, cbit 0 first, as
+// runners key shots). It decides this for Clifford circuits (H, S, X, Y,
+// Z, CNOT, CZ and SWAP, composites of them included) without control
+// flow, by tracking the stabilizers of the state as Aaronson and
+// Gottesman do; a measurement is deterministic when no stabilizer
+// anticommutes with Z on its qubit. Other circuits report false.
+func DeterministicOutcome(c circuit.Circuit) (string, bool) {
+	t := newTableau(c.Qubits())
+	key := make([]byte, c.Clbits())
+	for i := range key {
+		key[i] = '0'
+	}
+	for _, op := range c.OpsIter() {
+		if op.Cond != nil || op.Loop != nil {
+			return "", false
+		}
+		if op.G.Name() == "MEASURE" {
+			v, ok := t.measure(op.Qubits[0])
+			if !ok {
+				return "", false
+			}
+			if op.Cbit >= 0 && op.Cbit < len(key) {
+				key[op.Cbit] = '0' + byte(v)
+			}
+			continue
+		}
+		if err := gate.Expand(op.G, op.Qubits, t.apply); err != nil {
+			return "", false
+		}
+	}
+	return string(key), true
+}
+
+// shortcut runs a deterministic circuit once and credits every shot to
+// its result; ok reports whether it applied (see SimulatorOptions.NoShortcut).
+func (s *Simulator) shortcut(c circuit.Circuit, project func(string) string) (hist map[string]int, ok bool, err error) {
+	if s.NoShortcut || s.IncludeUnmeasured {
+		return nil, false, nil
+	}
+	if _, det := DeterministicOutcome(c); !det {
+		return nil, false, nil
+	}
+	key, err := s.runner.RunOnce(c)
+	if err != nil {
+		return nil, true, fmt.Errorf("shot 1 failed: %w", err)
+	}
+	s.log.Info().Int("shots", s.Shots).Msg("simulator: Deterministic circuit, ran a single shot")
+	hist = map[string]int{project(key): s.Shots}
+	if s.Progress != nil {
+		s.Progress(ChunkResult{Shots: s.Shots, Counts: maps.Clone(hist)})
+	}
+	return hist, true, nil
+}
+
+// newTableau returns the tableau of |0…0⟩ on n qubits: rows 0..n-1 are
+// destabilizers, n..2n-1 stabilizers and row 2n scratch.
+func newTableau(n int) *tableau {
+	t := &tableau{stabilizer.New(2*n+1, n)}
+	for q := range n {
+		t.X[q][q] = true   // destabilizer X_q
+		t.Z[n+q][q] = true // stabilizer Z_q
+	}
+	return t
+}
+
+type tableau struct{ *stabilizer.Tableau }
+
+// apply updates the tableau for a primitive gate; non-Clifford gates are
+// an error.
+func (t *tableau) apply(g gate.Gate, qs []int) error {
+	switch g.Name() {
+	case "H":
+		t.H(qs[0])
+	case "S":
+		t.S(qs[0])
+	case "X", "Y", "Z":
+		t.Pauli(qs[0], g.Name()[0])
+	case "CNOT":
+		t.CNOT(qs[0], qs[1])
+	case "CZ":
+		t.CZ(qs[0], qs[1])
+	case "SWAP":
+		t.SWAP(qs[0], qs[1])
+	default:
+		return fmt.Errorf("simulator: %s is not a Clifford gate", g.Name())
+	}
+	return nil
+}
+
+// measure returns the outcome of measuring q in the Z basis and whether it
+// is deterministic; random outcomes leave the tableau untouched.
+func (t *tableau) measure(q int) (int, bool) {
+	n := t.N
+	for p := n; p < 2*n; p++ {
+		if t.X[p][q] {
+			return 0, false
+		}
+	}
+	s := 2 * n
+	clear(t.X[s])
+	clear(t.Z[s])
+	t.R[s] = false
+	for i := range n {
+		if t.X[i][q] {
+			t.Rowsum(s, i+n)
+		}
+	}
+	if t.R[s] {
+		return 1, true
+	}
+	return 0, true
+}
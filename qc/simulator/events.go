@@ -0,0 +1,84 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// MeasurementEvent identifies one measurement of a circuit.
+type MeasurementEvent struct {
+	Qubit, Cbit, TimeStep int
+}
+
+// RunEvents is RunResult that also records the outcome of every
+// measurement event, not just the final value of each classical bit, so
+// e.g. repeated syndrome measurements into the same cbits can be analysed
+// jointly; see Result.EventCounts.
+//
+// Every measurement is followed by a second measurement of the same qubit
+// into a fresh classical bit. A projective measurement repeated at once
+// gives the same outcome, so this works with any runner. Conditional
+// measurements that do not fire record 0. Circuits with loops are not
+// supported, as their events vary from shot to shot.
+func (s *Simulator) RunEvents(c circuit.Circuit) (*Result, error) {
+	inst, events, err := instrumentEvents(c)
+	if err != nil {
+		return nil, err
+	}
+	hist, err := s.Run(inst)
+	if err != nil {
+		return nil, err
+	}
+	// Keys of inst hold c's measured cbits followed by the event cbits.
+	res := s.newResult(c, map[string]int{})
+	n := len(res.Cbits)
+	res.Events = events
+	res.eventCounts = map[string]int{}
+	for k, cnt := range hist {
+		if len(k) != n+len(events) {
+			return nil, fmt.Errorf("simulator: runner key %q does not match %d cbits and %d events", k, n, len(events))
+		}
+		res.Counts[k[:n]] += cnt
+		res.eventCounts[k[n:]] += cnt
+	}
+	return res, nil
+}
+
+// EventCounts returns the joint histogram of all measurement events:
+// character i of each key is the outcome of Events[i]. It is nil unless
+// the result came from RunEvents.
+func (r *Result) EventCounts() map[string]int {
+	return r.eventCounts
+}
+
+// instrumentEvents copies c, duplicating every measurement into an extra
+// classical bit (Clbits()+i for event i, in TimeStep order).
+func instrumentEvents(c circuit.Circuit) (circuit.Circuit, []MeasurementEvent, error) {
+	var events []MeasurementEvent
+	for _, op := range c.OpsIter() {
+		if op.Loop != nil {
+			return nil, nil, fmt.Errorf("simulator: measurement events are not supported for circuits with loops")
+		}
+		if op.G.Name() == "MEASURE" {
+			events = append(events, MeasurementEvent{Qubit: op.Qubits[0], Cbit: op.Cbit, TimeStep: op.TimeStep})
+		}
+	}
+	out := circuit.NewIncremental(c.Qubits(), c.Clbits()+len(events))
+	ev := 0
+	for _, op := range c.OpsIter() {
+		if _, err := out.Append(dag.Op{G: op.G, Qubits: op.Qubits, Cbit: op.Cbit, Cond: op.Cond, Meta: op.Meta}); err != nil {
+			return nil, nil, err
+		}
+		if op.G.Name() != "MEASURE" {
+			continue
+		}
+		if _, err := out.Append(dag.Op{G: gate.Measure(), Qubits: op.Qubits, Cbit: c.Clbits() + ev, Cond: op.Cond}); err != nil {
+			return nil, nil, err
+		}
+		ev++
+	}
+	return out, events, nil
+}
@@ -0,0 +1,26 @@
+package simulator
+
+import "github.com/kegliz/qcm/qc/circuit"
+
+// OpHook is called by a runner after every operation it applies, for
+// custom tracing, counting and step-through tools. shot numbers the shots
+// the runner started since the hook was set, from 0 in the order they
+// started; work outside shots, such as computing a statevector to sample
+// from (see Run), reports -1. Conditional operations whose condition fails
+// are not reported, and loops report the operations of their body.
+// Runners may call it from several goroutines at once.
+type OpHook interface {
+	OnGateApplied(op circuit.Operation, shot int)
+}
+
+// OpHookFunc adapts a function to an OpHook.
+type OpHookFunc func(op circuit.Operation, shot int)
+
+// OnGateApplied implements OpHook.
+func (f OpHookFunc) OnGateApplied(op circuit.Operation, shot int) { f(op, shot) }
+
+// HookingRunner is implemented by runners that can call an OpHook;
+// SetHook(nil) removes it.
+type HookingRunner interface {
+	SetHook(h OpHook)
+}
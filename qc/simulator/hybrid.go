@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Callback is classical Go code run in the middle of a shot, for adaptive
+// protocols. It is called right after a measurement writes a bit of its
+// classical register, with the register's bits as an integer (the
+// register's first bit in bit 0), and the value it returns is written
+// back to the register, so conditions of later operations see it. A
+// condition on any bit of a register is ordered after every earlier
+// measurement into that register (see dag.Condition), so it sees the values
+// callbacks wrote even for bits no measurement targets. Callbacks may be
+// called from several workers at once.
+type Callback func(value uint64) uint64
+
+// HybridRunner is implemented by runners that can call Callbacks during a
+// shot. RunOnceHybrid runs c once with cbs keyed by register name, drawing
+// measurements from rng (nil: the global source).
+type HybridRunner interface {
+	RunOnceHybrid(c circuit.Circuit, cbs map[string]Callback, rng *rand.Rand) (string, error)
+}
+
+// BoundCallback is a Callback bound to its register, as runners use it.
+type BoundCallback struct {
+	Register circuit.Register
+	Fn       Callback
+}
+
+// BindCallbacks resolves cbs against the registers of c, for runners
+// implementing HybridRunner. Registers must exist and hold at most 64
+// bits.
+func BindCallbacks(c circuit.Circuit, cbs map[string]Callback) ([]BoundCallback, error) {
+	regs := map[string]circuit.Register{}
+	for _, r := range c.CRegs() {
+		regs[r.Name] = r
+	}
+	var out []BoundCallback
+	for _, name := range slices.Sorted(maps.Keys(cbs)) {
+		r, ok := regs[name]
+		if !ok {
+			return nil, fmt.Errorf("simulator: callback on unknown register %q", name)
+		}
+		if r.Size > 64 {
+			return nil, fmt.Errorf("simulator: callback register %s has %d bits, more than 64", name, r.Size)
+		}
+		out = append(out, BoundCallback{Register: r, Fn: cbs[name]})
+	}
+	return out, nil
+}
+
+// Written runs the callback if cbit, just written, is in its register.
+func (b BoundCallback) Written(cbit int, bits []bool) {
+	r := b.Register
+	if cbit < r.Start || cbit >= r.Start+r.Size {
+		return
+	}
+	var v uint64
+	for i := range r.Size {
+		if bits[r.Start+i] {
+			v |= 1 << i
+		}
+	}
+	v = b.Fn(v)
+	for i := range r.Size {
+		bits[r.Start+i] = v>>i&1 == 1
+	}
+}
+
+// RunHybrid runs c calling cbs, keyed by classical register name (see
+// Callback). Every shot plays the whole circuit on a runner implementing
+// HybridRunner, in chunks as for RunChunks; unseeded runs draw a fresh
+// seed. Histogram keys also list the bits of the
+// callbacks' registers that are never measured. PostSelect, UniformNoise
+// and the automatic circuit simplifications do not apply.
+func (s *Simulator) RunHybrid(c circuit.Circuit, cbs map[string]Callback) (map[string]int, error) {
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	hr, ok := s.runner.(HybridRunner)
+	if !ok {
+		return nil, fmt.Errorf("simulator: hybrid runs need a runner implementing HybridRunner")
+	}
+	bound, err := BindCallbacks(c, cbs)
+	if err != nil {
+		return nil, err
+	}
+	written := measuredCbits(c)
+	for _, b := range bound {
+		for i := range b.Register.Size {
+			written = append(written, b.Register.Start+i)
+		}
+	}
+	slices.Sort(written)
+	project := projectKeys(slices.Compact(written), c.Clbits())
+
+	run := *s
+	if run.Seed == 0 {
+		run.Seed = rand.Int63() + 1
+	}
+	chunks, err := run.runChunks(func(rng *rand.Rand) (string, error) {
+		key, err := hr.RunOnceHybrid(c, cbs, rng)
+		return project(key), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mergeChunks(chunks), nil
+}
@@ -90,6 +90,19 @@ type StatevectorGetter interface {
 	GetStatevector(c circuit.Circuit) ([]complex128, error)
 }
 
+// AllocStats counts the per-shot states a runner allocated and the ones it
+// reused from a pool.
+type AllocStats struct {
+	StateAllocs int64 `json:"state_allocs"`
+	StateReuses int64 `json:"state_reuses"`
+}
+
+// AllocStatsProvider is implemented by runners that pool per-shot state.
+// The counts are cumulative, so callers compare two snapshots.
+type AllocStatsProvider interface {
+	AllocStats() AllocStats
+}
+
 // FullFeaturedRunner combines all optional interfaces.
 // Implementations can choose which interfaces to implement based on their capabilities.
 type FullFeaturedRunner interface {
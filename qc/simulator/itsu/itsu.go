@@ -3,6 +3,9 @@ package itsu
 import (
 	"context"
 	"fmt"
+	"iter"
+	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,13 +14,22 @@ import (
 	"slices"
 
 	"github.com/itsubaki/q"
+	"github.com/kegliz/qcm/qc/bitorder"
 	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
 	"github.com/kegliz/qcm/qc/logger"
 	"github.com/kegliz/qcm/qc/simulator"
 	"github.com/rs/zerolog"
 )
 
 type ItsuOneShotRunner struct {
+	*runnerState
+	loops simulator.LoopObserver // told of every loop run; nil: off
+}
+
+// runnerState is what a runner shares with the copies WithLoopObserver
+// returns.
+type runnerState struct {
 	log     logger.Logger
 	config  map[string]interface{}
 	mu      sync.RWMutex
@@ -35,16 +47,23 @@ type ItsuMetrics struct {
 
 // Supported gates for the Itsu backend
 var supportedGates = []string{
-	"H", "X", "Y", "S", "Z", "CNOT", "CZ", "SWAP", "TOFFOLI", "FREDKIN", "MEASURE",
+	"H", "X", "Y", "S", "Z", "P", "RX", "RY", "RZ", "CNOT", "CZ", "CP", "SWAP", "TOFFOLI", "FREDKIN", "MEASURE",
 }
 
 func NewItsuOneShotRunner() *ItsuOneShotRunner {
-	return &ItsuOneShotRunner{
+	return &ItsuOneShotRunner{runnerState: &runnerState{
 		log: *logger.NewLogger(logger.LoggerOptions{
 			Debug: false,
 		}),
 		config: make(map[string]any),
-	}
+	}}
+}
+
+// WithLoopObserver implements simulator.LoopCountingRunner.
+func (s *ItsuOneShotRunner) WithLoopObserver(o simulator.LoopObserver) simulator.OneShotRunner {
+	v := *s
+	v.loops = o
+	return &v
 }
 
 // BackendProvider implementation
@@ -62,6 +81,7 @@ func (s *ItsuOneShotRunner) GetBackendInfo() simulator.BackendInfo {
 			"metrics_collection": true,
 			"configuration":      true,
 			"reset":              true,
+			"control_flow":       true,
 		},
 		Metadata: map[string]string{
 			"backend_type": "statevector_simulator",
@@ -125,7 +145,7 @@ func (s *ItsuOneShotRunner) RunOnce(c circuit.Circuit) (string, error) {
 	}()
 
 	sim := q.New()
-	result, err := runOnce(sim, c)
+	result, err := runOnce(sim, c, s.loops)
 
 	if err != nil {
 		s.metrics.failedRuns.Add(1)
@@ -138,8 +158,12 @@ func (s *ItsuOneShotRunner) RunOnce(c circuit.Circuit) (string, error) {
 }
 
 // runOnce plays the circuit exactly one time on the provided simulator,
-// returning the measured classical bit‑string.
-func runOnce(sim *q.Q, c circuit.Circuit) (string, error) {
+// returning the measured classical bit‑string. loops, if not nil, is told
+// of every loop run.
+func runOnce(sim *q.Q, c circuit.Circuit, loops simulator.LoopObserver) (string, error) {
+	if err := simulator.CheckStatevectorWidth(c.Qubits()); err != nil {
+		return "", err
+	}
 	qs := sim.Zeros(c.Qubits())
 	//cbits := bytes.Repeat([]byte{'0'}, c.Clbits())
 	cbits := make([]byte, c.Clbits())
@@ -147,59 +171,130 @@ func runOnce(sim *q.Q, c circuit.Circuit) (string, error) {
 		cbits[i] = '0' // Explicitly initialize to '0'
 	}
 
-	for i, op := range c.Operations() {
+	if err := execute(sim, qs, cbits, c.OpsIter(), loops); err != nil {
+		if located := simulator.CheckGates("itsu", c, supportedGates); located != nil {
+			return "", located
+		}
+		return "", err
+	}
+	// Return the final classical bit string (little-endian)
+	return string(cbits), nil
+}
+
+// execute plays ops, skipping those whose condition does not hold and
+// replaying loop bodies until their exit condition holds or the bound is hit.
+func execute(sim *q.Q, qs []q.Qubit, cbits []byte, ops iter.Seq2[int, circuit.Operation], loops simulator.LoopObserver) error {
+	bit := func(c int) bool { return cbits[c] == '1' }
+	for i, op := range ops {
 		// Check qubit indices are valid for the gate's operation before applying
 		// (This is defensive programming; circuit/DAG validation should catch this)
 		for _, qIndex := range op.Qubits {
 			if qIndex < 0 || qIndex >= len(qs) {
 				// Add operation index to error message
-				return "", fmt.Errorf("itsu: invalid qubit index %d for gate %s (op %d) in runOnce", qIndex, op.G.Name(), i)
+				return fmt.Errorf("itsu: invalid qubit index %d for gate %s (op %d) in runOnce", qIndex, op.G.Name(), i)
 			}
 		}
 		if op.G.Name() == "MEASURE" && (op.Cbit < 0 || op.Cbit >= len(cbits)) {
 			// Add operation index to error message
-			return "", fmt.Errorf("itsu: invalid classical bit index %d for MEASURE (op %d) in runOnce", op.Cbit, i)
+			return fmt.Errorf("itsu: invalid classical bit index %d for MEASURE (op %d) in runOnce", op.Cbit, i)
 		}
 
-		switch op.G.Name() {
-		case "H":
-			sim.H(qs[op.Qubits[0]])
-		case "X":
-			sim.X(qs[op.Qubits[0]])
-		case "Y":
-			sim.Y(qs[op.Qubits[0]])
-		case "S":
-			sim.S(qs[op.Qubits[0]])
-		case "Z":
-			sim.Z(qs[op.Qubits[0]])
-		case "CNOT":
-			sim.CNOT(qs[op.Qubits[0]], qs[op.Qubits[1]])
-		case "CZ":
-			sim.CZ(qs[op.Qubits[0]], qs[op.Qubits[1]])
-		case "SWAP":
-			sim.Swap(qs[op.Qubits[0]], qs[op.Qubits[1]])
-		case "TOFFOLI":
-			sim.Toffoli(qs[op.Qubits[0]], qs[op.Qubits[1]], qs[op.Qubits[2]])
-		case "FREDKIN":
-			ctrl, a, b := qs[op.Qubits[0]], qs[op.Qubits[1]], qs[op.Qubits[2]]
-			// Standard decomposition: CNOT(b,a) Toffoli(ctrl,a,b) CNOT(b,a)
-			sim.CNOT(b, a)
-			sim.Toffoli(ctrl, a, b)
-			sim.CNOT(b, a)
-		case "MEASURE":
+		if op.Cond != nil && !op.Cond.Eval(bit) {
+			continue
+		}
+		if op.Loop != nil {
+			runs := 0
+			for runs < op.Loop.Max {
+				runs++
+				if err := execute(sim, qs, cbits, slices.All(op.Loop.Body), loops); err != nil {
+					return err
+				}
+				if op.Loop.Until.Eval(bit) {
+					break
+				}
+			}
+			if loops != nil {
+				loops.ObserveLoop(op, runs)
+			}
+			continue
+		}
+		if op.G.Name() == "MEASURE" {
 			m := sim.Measure(qs[op.Qubits[0]]) // collapses state & returns result
 			if m.IsOne() {
 				cbits[op.Cbit] = '1'
 			} else {
 				cbits[op.Cbit] = '0'
 			}
-		default:
+			continue
+		}
+		if err := applyGate(sim, qs, op.G, op.Qubits); err != nil {
 			// Add operation index to error message
-			return "", fmt.Errorf("itsu: unsupported gate %s (op %d) encountered in runOnce", op.G.Name(), i)
+			return fmt.Errorf("itsu: %w (op %d) encountered in runOnce", err, i)
 		}
 	}
-	// Return the final classical bit string (little-endian)
-	return string(cbits), nil
+	return nil
+}
+
+// applyGate applies one unitary gate, expanding composites into their steps.
+func applyGate(sim *q.Q, qs []q.Qubit, g gate.Gate, qubits []int) error {
+	switch g.Name() {
+	case "H":
+		sim.H(qs[qubits[0]])
+	case "X":
+		sim.X(qs[qubits[0]])
+	case "Y":
+		sim.Y(qs[qubits[0]])
+	case "S":
+		sim.S(qs[qubits[0]])
+	case "Z":
+		sim.Z(qs[qubits[0]])
+	case "CNOT":
+		sim.CNOT(qs[qubits[0]], qs[qubits[1]])
+	case "CZ":
+		sim.CZ(qs[qubits[0]], qs[qubits[1]])
+	case "SWAP":
+		sim.Swap(qs[qubits[0]], qs[qubits[1]])
+	case "TOFFOLI":
+		sim.Toffoli(qs[qubits[0]], qs[qubits[1]], qs[qubits[2]])
+	case "FREDKIN":
+		ctrl, a, b := qs[qubits[0]], qs[qubits[1]], qs[qubits[2]]
+		// Standard decomposition: CNOT(b,a) Toffoli(ctrl,a,b) CNOT(b,a)
+		sim.CNOT(b, a)
+		sim.Toffoli(ctrl, a, b)
+		sim.CNOT(b, a)
+	case "P", "CP":
+		pg, ok := g.(gate.Parametric)
+		if !ok {
+			return fmt.Errorf("gate %s carries no angle", g.Name())
+		}
+		if g.Name() == "P" {
+			sim.R(pg.Params()[0], qs[qubits[0]])
+		} else {
+			sim.CR(pg.Params()[0], qs[qubits[0]], qs[qubits[1]])
+		}
+	case "RX", "RY", "RZ":
+		pg, ok := g.(gate.Parametric)
+		if !ok {
+			return fmt.Errorf("gate %s carries no angle", g.Name())
+		}
+		theta, qb := pg.Params()[0], qs[qubits[0]]
+		switch g.Name() {
+		case "RX":
+			sim.RX(theta, qb)
+		case "RY":
+			sim.RY(theta, qb)
+		default:
+			sim.RZ(theta, qb)
+		}
+	default:
+		if _, ok := g.(*gate.Composite); ok {
+			return gate.Expand(g, qubits, func(p gate.Gate, pq []int) error {
+				return applyGate(sim, qs, p, pq)
+			})
+		}
+		return fmt.Errorf("unsupported gate %s", g.Name())
+	}
+	return nil
 }
 
 // ResettableRunner implementation
@@ -242,13 +337,10 @@ func (s *ItsuOneShotRunner) ResetMetrics() {
 
 // ValidatingRunner implementation
 func (s *ItsuOneShotRunner) ValidateCircuit(c circuit.Circuit) error {
-	for i, op := range c.Operations() {
-		// Check if gate is supported
-		supported := slices.Contains(supportedGates, op.G.Name())
-		if !supported {
-			return fmt.Errorf("itsu: unsupported gate %s at operation %d", op.G.Name(), i)
-		}
-
+	if err := simulator.CheckGates("itsu", c, supportedGates); err != nil {
+		return err
+	}
+	for i, op := range flatten(c.Operations()) {
 		// Check qubit indices
 		for _, qIndex := range op.Qubits {
 			if qIndex < 0 || qIndex >= c.Qubits() {
@@ -264,6 +356,19 @@ func (s *ItsuOneShotRunner) ValidateCircuit(c circuit.Circuit) error {
 	return nil
 }
 
+// flatten lists ops with every loop replaced by its body.
+func flatten(ops []circuit.Operation) []circuit.Operation {
+	var out []circuit.Operation
+	for _, op := range ops {
+		if op.Loop != nil {
+			out = append(out, flatten(op.Loop.Body)...)
+			continue
+		}
+		out = append(out, op)
+	}
+	return out
+}
+
 func (s *ItsuOneShotRunner) GetSupportedGates() []string {
 	gates := make([]string, len(supportedGates))
 	copy(gates, supportedGates)
@@ -294,7 +399,7 @@ func (s *ItsuOneShotRunner) RunOnceWithContext(ctx context.Context, c circuit.Ci
 
 	go func() {
 		sim := q.New()
-		result, err := runOnce(sim, c)
+		result, err := runOnce(sim, c, s.loops)
 		resultChan <- struct {
 			result string
 			err    error
@@ -317,11 +422,97 @@ func (s *ItsuOneShotRunner) RunOnceWithContext(ctx context.Context, c circuit.Ci
 	}
 }
 
-// BatchRunner implementation
+// StatevectorGetter implementation: the final state of c with measurements
+// skipped, indexed so that qubit q is bit q (the library puts qubit 0 in the
+// most significant bit).
+func (s *ItsuOneShotRunner) GetStatevector(c circuit.Circuit) ([]complex128, error) {
+	if circuit.HasControlFlow(c) {
+		return nil, fmt.Errorf("itsu: circuit with classical control flow has no single final state")
+	}
+	if err := simulator.CheckStatevectorWidth(c.Qubits()); err != nil {
+		return nil, err
+	}
+	if err := simulator.CheckGates("itsu", c, supportedGates); err != nil {
+		return nil, err
+	}
+	sim := q.New()
+	qs := sim.Zeros(c.Qubits())
+	for i, op := range c.OpsIter() {
+		if op.G.Name() == "MEASURE" {
+			continue
+		}
+		if err := applyGate(sim, qs, op.G, op.Qubits); err != nil {
+			return nil, fmt.Errorf("itsu: %w (op %d) encountered in GetStatevector", err, i)
+		}
+	}
+	return bitorder.Statevector(sim.Amplitude()), nil
+}
+
+// terminal reports whether every measurement of c comes after the last
+// gate on its qubit and c has no control flow, so that all shots can be
+// drawn from one final state.
+func terminal(c circuit.Circuit) bool {
+	measured := map[int]bool{}
+	for _, op := range c.OpsIter() {
+		if op.Cond != nil || op.Loop != nil {
+			return false
+		}
+		if op.G.Name() == "MEASURE" {
+			measured[op.Qubits[0]] = true
+			continue
+		}
+		if slices.ContainsFunc(op.Qubits, func(q int) bool { return measured[q] }) {
+			return false
+		}
+	}
+	return true
+}
+
+// sampleBatch evolves c once and draws shots keys from its final state.
+func (s *ItsuOneShotRunner) sampleBatch(c circuit.Circuit, shots int) ([]string, error) {
+	start := time.Now()
+	sv, err := s.GetStatevector(c)
+	s.metrics.totalExecutions.Add(1)
+	s.metrics.totalTime.Add(int64(time.Since(start)))
+	s.metrics.lastRunTime.Store(start)
+	if err != nil {
+		s.metrics.failedRuns.Add(1)
+		s.metrics.lastError.Store(err.Error())
+		return nil, err
+	}
+	s.metrics.successfulRuns.Add(1)
+
+	cum := make([]float64, len(sv))
+	total := 0.0
+	for i, a := range sv {
+		total += real(a)*real(a) + imag(a)*imag(a)
+		cum[i] = total
+	}
+	src := simulator.CbitSources(c.Clbits(), c.OpsIter())
+	keys := map[int]string{}
+	results := make([]string, shots)
+	for i := range results {
+		idx := min(sort.SearchFloat64s(cum, rand.Float64()*total), len(cum)-1)
+		key, ok := keys[idx]
+		if !ok {
+			key = simulator.OutcomeKey(src, idx)
+			keys[idx] = key
+		}
+		results[i] = key
+	}
+	return results, nil
+}
+
+// BatchRunner implementation. Circuits whose measurements are all terminal
+// are evolved once and every shot is sampled from the final state; others
+// are replayed shot by shot.
 func (s *ItsuOneShotRunner) RunBatch(c circuit.Circuit, shots int) ([]string, error) {
 	if shots <= 0 {
 		return nil, fmt.Errorf("shots must be positive, got %d", shots)
 	}
+	if terminal(c) {
+		return s.sampleBatch(c, shots)
+	}
 
 	results := make([]string, shots)
 	for i := range shots {
@@ -351,4 +542,9 @@ func init() {
 }
 
 // check that ItsuOneShotRunner implements the OneShotRunner interface
-var _ simulator.OneShotRunner = (*ItsuOneShotRunner)(nil)
+var (
+	_ simulator.OneShotRunner      = (*ItsuOneShotRunner)(nil)
+	_ simulator.BatchRunner        = (*ItsuOneShotRunner)(nil)
+	_ simulator.StatevectorGetter  = (*ItsuOneShotRunner)(nil)
+	_ simulator.LoopCountingRunner = (*ItsuOneShotRunner)(nil)
+)
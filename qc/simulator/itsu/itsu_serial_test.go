@@ -1,11 +1,13 @@
 package itsu
 
 import (
+	"math"
 	"sort"
 	"testing"
 
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/reference"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -118,3 +120,108 @@ func TestGrover3QubitSerial(t *testing.T) {
 
 	assert.Greater(t, hist["111"], int(0.75*float64(shots)), "Grover did not amplify |111⟩ sufficiently")
 }
+
+// TestControlFlowSerial checks mid-circuit feedback: a conditional X resets
+// qubit 0 after it is measured, and a repeat-until-success loop re-prepares
+// qubit 1 until it reads 1.
+func TestControlFlowSerial(t *testing.T) {
+	shots := 256
+	b := builder.New(builder.Q(2), builder.C(3))
+	b.H(0).Measure(0, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(0) })
+	b.Measure(0, 1)
+	b.RepeatUntil(builder.Bit(2), 40, func(b builder.Builder) {
+		b.H(1).Measure(1, 2)
+	})
+
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: shots, Runner: NewItsuOneShotRunner()})
+	hist, err := sim.RunSerial(c)
+	require.NoError(t, err)
+
+	prettySerial(t, hist, shots)
+
+	assert.Equal(t, shots, hist["001"]+hist["101"], "reset qubit must read 0 and the loop must exit on 1")
+	assert.Greater(t, hist["001"], 0)
+	assert.Greater(t, hist["101"], 0)
+
+	// The runner counts the loop's attempts as it runs them.
+	res, err := sim.RunAttempts(c)
+	require.NoError(t, err)
+	require.Len(t, res.Attempts, 1)
+	total := 0
+	for k, n := range res.Attempts[0].Counts {
+		assert.True(t, k >= 1 && k <= 40, "attempt count %d", k)
+		total += n
+	}
+	assert.Equal(t, shots, total)
+	assert.InDelta(t, 2, res.Attempts[0].Mean(), 0.4)
+}
+
+// TestStatevectorAndBatch checks the qubit order of GetStatevector and that
+// RunBatch samples terminal circuits from the final state.
+func TestStatevectorAndBatch(t *testing.T) {
+	r := NewItsuOneShotRunner()
+
+	c, err := builder.New(builder.Q(3), builder.C(3)).X(0).H(2).Measure(0, 0).Measure(2, 2).BuildCircuit()
+	require.NoError(t, err)
+	sv, err := r.GetStatevector(c)
+	require.NoError(t, err)
+	require.Len(t, sv, 8)
+	assert.InDelta(t, 0.5, real(sv[0b001]*sv[0b001]), 1e-9)
+	assert.InDelta(t, 0.5, real(sv[0b101]*sv[0b101]), 1e-9)
+
+	shots, err := r.RunBatch(c, 1000)
+	require.NoError(t, err)
+	require.Len(t, shots, 1000)
+	count := map[string]int{}
+	for _, k := range shots {
+		count[k]++
+	}
+	assert.Equal(t, 1000, count["100"]+count["101"], "unexpected keys %v", count)
+	assert.InDelta(t, 500, count["101"], 100)
+	assert.Equal(t, int64(1), r.GetMetrics().TotalExecutions, "terminal circuit evolved more than once")
+
+	// A mid-circuit measurement still replays every shot.
+	c, err = builder.New(builder.Q(1), builder.C(1)).H(0).Measure(0, 0).X(0).BuildCircuit()
+	require.NoError(t, err)
+	r.ResetMetrics()
+	_, err = r.RunBatch(c, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), r.GetMetrics().TotalExecutions)
+
+	// A cbit measured twice keeps the last outcome: qubit 0 always reads 1,
+	// but the key follows qubit 1.
+	c, err = builder.New(builder.Q(2), builder.C(1)).X(0).H(1).Measure(0, 0).Measure(1, 0).BuildCircuit()
+	require.NoError(t, err)
+	shots, err = r.RunBatch(c, 1000)
+	require.NoError(t, err)
+	count = map[string]int{}
+	for _, k := range shots {
+		count[k]++
+	}
+	assert.InDelta(t, 500, count["0"], 100, "%v", count)
+}
+
+// TestRotationGates checks RX, RY and RZ against the reference evaluator.
+func TestRotationGates(t *testing.T) {
+	// Rotations on every qubit, entangled between layers, against the exact
+	// reference evaluation, global phase included.
+	b := builder.New(builder.Q(3), builder.C(3))
+	for i, theta := range []float64{0.3, -1.2, math.Pi / 4, 2.5} {
+		q := i % 3
+		b.RX(theta, q).RY(theta/2, (q+1)%3).RZ(-theta, (q+2)%3).CNOT(q, (q+1)%3)
+	}
+	c, err := b.Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	require.NoError(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Runner: NewItsuOneShotRunner()})
+	v, err := reference.Verify(sim, c, 0)
+	require.NoError(t, err)
+	assert.Less(t, v.MaxError, 1e-12, "%v", v)
+
+	hist, err := sim.Run(c)
+	require.NoError(t, err)
+	assert.Greater(t, len(hist), 1)
+}
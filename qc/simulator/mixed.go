@@ -0,0 +1,135 @@
+package simulator
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Mixture is a mixed initial state ρ = Σ Weights[k] |ψk⟩⟨ψk|, an ensemble
+// of pure states. States[k] is ψk, indexed like a statevector (qubit q is
+// bit q); if States is nil the ensemble is diagonal and ψk is the basis
+// state |k⟩, so Weights has one entry per basis state. Any density matrix
+// can be given this way through its eigendecomposition, see
+// synth.Eigenstates.
+type Mixture struct {
+	Weights []float64
+	States  [][]complex128
+}
+
+// ThermalState returns the Gibbs state e^{-βH}/Z of independent qubits,
+// H = Σ omegas[q]·|1⟩⟨1|_q, so qubit q is excited with probability
+// 1/(1+e^{β·omegas[q]}). β = +Inf is the ground state, β = 0 the maximally
+// mixed state; negative β inverts the populations.
+func ThermalState(beta float64, omegas []float64) (Mixture, error) {
+	if math.IsNaN(beta) {
+		return Mixture{}, fmt.Errorf("simulator: inverse temperature is NaN")
+	}
+	if err := CheckStatevectorWidth(len(omegas)); err != nil {
+		return Mixture{}, err
+	}
+	weights := make([]float64, 1<<len(omegas))
+	weights[0] = 1
+	for q, w := range omegas {
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return Mixture{}, fmt.Errorf("simulator: qubit %d has frequency %v", q, w)
+		}
+		p1 := 0.5
+		if w != 0 {
+			p1 = 1 / (1 + math.Exp(beta*w))
+		}
+		for k := range 1 << q {
+			weights[k|1<<q] = weights[k] * p1
+			weights[k] *= 1 - p1
+		}
+	}
+	return Mixture{Weights: weights}, nil
+}
+
+// check validates m as a mixed state on qubits qubits, its weights summing
+// to 1 within tol.
+func (m Mixture) check(qubits int, tol float64) error {
+	if m.States == nil {
+		if len(m.Weights) != 1<<qubits {
+			return fmt.Errorf("simulator: diagonal mixture has %d weights, want %d for %d qubit(s)",
+				len(m.Weights), 1<<qubits, qubits)
+		}
+	} else if len(m.States) != len(m.Weights) {
+		return fmt.Errorf("simulator: mixture has %d weights for %d states", len(m.Weights), len(m.States))
+	}
+	for k, w := range m.Weights {
+		if w < 0 || math.IsNaN(w) {
+			return fmt.Errorf("simulator: mixture weight %d is %v", k, w)
+		}
+	}
+	if t := sum(m.Weights); math.Abs(t-1) > tol {
+		return fmt.Errorf("simulator: mixture weights sum to %.9g, want 1", t)
+	}
+	return nil
+}
+
+// state returns member k of m.
+func (m Mixture) state(k, qubits int) []complex128 {
+	if m.States != nil {
+		return m.States[k]
+	}
+	sv := make([]complex128, 1<<qubits)
+	sv[k] = 1
+	return sv
+}
+
+// RunMixed runs c starting from the mixed state m, for open-system and
+// algorithmic-cooling studies. Every shot starts from a pure state drawn
+// from the ensemble, which gives the statistics of a density-matrix run:
+// the shots are split over the members by a multinomial draw and each
+// member runs its share with RunFrom, whose conditions apply.
+func (s *Simulator) RunMixed(m Mixture, c circuit.Circuit) (map[string]int, error) {
+	if err := CheckStatevectorWidth(c.Qubits()); err != nil {
+		return nil, err
+	}
+	if err := m.check(c.Qubits(), s.tolerance()); err != nil {
+		return nil, err
+	}
+
+	cum := make([]float64, len(m.Weights))
+	total := 0.0
+	for k, w := range m.Weights {
+		total += w
+		cum[k] = total
+	}
+	draw := rand.Float64
+	if s.Seed != 0 {
+		draw = rand.New(rand.NewSource(chunkSeed(s.Seed, -3))).Float64
+	}
+	counts := map[int]int{}
+	for range s.Shots {
+		k := min(sort.SearchFloat64s(cum, draw()*total), len(cum)-1)
+		// Skip zero-weight members sharing the cumulative value.
+		for m.Weights[k] == 0 && k < len(cum)-1 {
+			k++
+		}
+		counts[k]++
+	}
+
+	sub := *s
+	hist := map[string]int{}
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		sub.Shots, sub.Workers = counts[k], min(max(s.Workers, 1), counts[k])
+		if s.Seed != 0 {
+			sub.Seed = chunkSeed(^s.Seed, k)
+		}
+		got, err := sub.RunFrom(m.state(k, c.Qubits()), c)
+		if err != nil {
+			return nil, fmt.Errorf("simulator: mixture member %d: %w", k, err)
+		}
+		for key, n := range got {
+			hist[key] += n
+		}
+	}
+	return hist, nil
+}
@@ -0,0 +1,319 @@
+package simulator
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// NoiseModel describes simple, runner-independent noise. Gate errors are
+// simulated by inserting random Pauli gates into a per-shot copy of the
+// circuit; readout errors flip measured bits in the resulting keys.
+type NoiseModel struct {
+	// Depolarizing is the probability that each qubit of a gate suffers an
+	// X, Y or Z error (chosen uniformly) right after the gate.
+	Depolarizing float64
+	// Readout is the probability that a measured classical bit is flipped.
+	Readout float64
+}
+
+// Validate checks that both probabilities lie in [0, 1].
+func (nm NoiseModel) Validate() error {
+	for name, p := range map[string]float64{"Depolarizing": nm.Depolarizing, "Readout": nm.Readout} {
+		if p < 0 || p > 1 || math.IsNaN(p) {
+			return fmt.Errorf("simulator: noise %s probability %v out of [0,1]", name, p)
+		}
+	}
+	return nil
+}
+
+// noiseTable is the gate noise of one circuit, compiled once per run and
+// shared read-only by every worker. It lays out c with an error slot after
+// every gate on each of its qubits, so a shot only draws which slots fire
+// and fills them in, instead of building and laying out a noisy copy of
+// the circuit per shot.
+type noiseTable struct {
+	c      circuit.Circuit
+	p      float64
+	ops    []circuit.Operation // c and its slots, in execution order
+	slot   []int               // slot[i]: slot number of ops[i], -1 for c's operations
+	slots  int
+	depth  int
+	paulis [3]gate.Gate
+}
+
+// compile lays out the error slots of c.
+func (nm NoiseModel) compile(c circuit.Circuit) (*noiseTable, error) {
+	t := &noiseTable{c: c, p: nm.Depolarizing, paulis: [3]gate.Gate{gate.X(), gate.Y(), gate.Z()}}
+	// Slots hold X until a shot fills them; they are numbered in program
+	// order, the order shots draw them in.
+	out := circuit.NewIncremental(c.Qubits(), c.Clbits())
+	var program []circuit.Operation
+	var slot []int
+	for _, op := range c.OpsIter() {
+		laid, err := out.Append(dag.Op{G: op.G, Qubits: op.Qubits, Cbit: op.Cbit, Cond: op.Cond, Meta: op.Meta})
+		if err != nil {
+			return nil, err
+		}
+		program, slot = append(program, laid), append(slot, -1)
+		if op.G.Name() == "MEASURE" {
+			continue
+		}
+		for _, q := range op.Qubits {
+			// An error on a skipped conditional gate would not happen either.
+			laid, err := out.Append(dag.Op{G: t.paulis[0], Qubits: []int{q}, Cond: op.Cond})
+			if err != nil {
+				return nil, err
+			}
+			program, slot = append(program, laid), append(slot, t.slots)
+			t.slots++
+		}
+	}
+	// Execution order is Incremental's: by TimeStep, then Line, ties in
+	// program order.
+	order := make([]int, len(program))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		if d := program[a].TimeStep - program[b].TimeStep; d != 0 {
+			return d
+		}
+		return program[a].Line - program[b].Line
+	})
+	for _, i := range order {
+		t.ops, t.slot = append(t.ops, program[i]), append(t.slot, slot[i])
+	}
+	t.depth = out.Depth()
+	return t, nil
+}
+
+// sample returns c with Pauli errors drawn after every gate: c itself if
+// none fired.
+func (t *noiseTable) sample(rng *rand.Rand) circuit.Circuit {
+	var fired []gate.Gate // by slot; nil while none fired
+	for i := range t.slots {
+		if rng.Float64() >= t.p {
+			continue
+		}
+		if fired == nil {
+			fired = make([]gate.Gate, t.slots)
+		}
+		fired[i] = t.paulis[rng.Intn(3)]
+	}
+	if fired == nil {
+		return t.c
+	}
+	ops := make([]circuit.Operation, 0, len(t.ops)-t.slots)
+	for i, op := range t.ops {
+		if s := t.slot[i]; s >= 0 {
+			if fired[s] == nil {
+				continue
+			}
+			op.G = fired[s]
+		}
+		ops = append(ops, op)
+	}
+	return &noisyCircuit{t: t, ops: ops}
+}
+
+// noisyCircuit is one shot's circuit drawn from a noiseTable. Its layout is
+// the table's, with the slots that did not fire left out.
+type noisyCircuit struct {
+	t   *noiseTable
+	ops []circuit.Operation
+}
+
+func (c *noisyCircuit) Qubits() int                  { return c.t.c.Qubits() }
+func (c *noisyCircuit) Clbits() int                  { return c.t.c.Clbits() }
+func (c *noisyCircuit) CRegs() []circuit.Register    { return c.t.c.CRegs() }
+func (c *noisyCircuit) Depth() int                   { return c.t.depth }
+func (c *noisyCircuit) MaxStep() int                 { return c.t.depth - 1 }
+func (c *noisyCircuit) OpAt(i int) circuit.Operation { return c.ops[i] }
+func (c *noisyCircuit) NumOps() int                  { return len(c.ops) }
+func (c *noisyCircuit) Operations() []circuit.Operation {
+	return append([]circuit.Operation(nil), c.ops...)
+}
+func (c *noisyCircuit) OpsIter() iter.Seq2[int, circuit.Operation] { return slices.All(c.ops) }
+
+// flipReadout applies readout errors to one key; a "|…" suffix is kept as is.
+func (nm NoiseModel) flipReadout(key string, rng *rand.Rand) string {
+	if nm.Readout == 0 {
+		return key
+	}
+	b := []byte(key)
+	for i, ch := range b {
+		if ch == '|' {
+			break
+		}
+		if rng.Float64() < nm.Readout {
+			b[i] ^= '0' ^ '1'
+		}
+	}
+	return string(b)
+}
+
+// RunNoisy runs c under nm. Without gate errors the shots come from Run and
+// only readout errors are added; otherwise every shot executes its own
+// noisy copy of the circuit, serially unless s.Seed is set, when the shots
+// run in chunks as for RunChunks. Gate errors are not supported for
+// circuits with loops. Progress reports the chunks of Run without readout
+// errors, which are drawn once the run is done.
+func (s *Simulator) RunNoisy(c circuit.Circuit, nm NoiseModel) (map[string]int, error) {
+	if err := nm.Validate(); err != nil {
+		return nil, err
+	}
+	if nm.Depolarizing == 0 {
+		ideal, err := s.Run(c)
+		if err != nil {
+			return nil, err
+		}
+		return nm.applyReadout(ideal, s.noiseRand()), nil
+	}
+	return s.runNoisyShots(c, nm)
+}
+
+// applyReadout flips the bits of every shot in hist independently. Keys
+// are visited in sorted order so that a seeded rng gives a reproducible
+// result.
+func (nm NoiseModel) applyReadout(hist map[string]int, rng *rand.Rand) map[string]int {
+	out := make(map[string]int, len(hist))
+	for _, k := range slices.Sorted(maps.Keys(hist)) {
+		for range hist[k] {
+			out[nm.flipReadout(k, rng)]++
+		}
+	}
+	return out
+}
+
+// noiseRand returns the source of the noise drawn outside chunks: seeded
+// from s.Seed if set, from the global source otherwise.
+func (s *Simulator) noiseRand() *rand.Rand {
+	seed := rand.Int63()
+	if s.Seed != 0 {
+		seed = chunkSeed(s.Seed, -2)
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+func (s *Simulator) runNoisyShots(c circuit.Circuit, nm NoiseModel) (map[string]int, error) {
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	for _, op := range c.OpsIter() {
+		if op.Loop != nil {
+			return nil, fmt.Errorf("simulator: gate noise is not supported for circuits with loops")
+		}
+	}
+	table, err := nm.compile(c)
+	if err != nil {
+		return nil, err
+	}
+	project := keyProjector(c)
+	if s.Seed != 0 {
+		rr, ok := s.runner.(RandRunner)
+		if !ok {
+			return nil, fmt.Errorf("simulator: seeded runs need a runner implementing RandRunner")
+		}
+		chunks, err := s.runChunks(func(rng *rand.Rand) (string, error) {
+			key, err := rr.RunOnceRand(table.sample(rng), rng)
+			return nm.flipReadout(project(key), rng), err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mergeChunks(chunks), nil
+	}
+	rng := s.noiseRand()
+	hist := make(map[string]int)
+	size := s.chunkShots()
+	// Shots are counted in chunks only to report Progress.
+	for start := 0; start < s.Shots; start += size {
+		ch := ChunkResult{Index: start / size, Shots: min(size, s.Shots-start), Counts: map[string]int{}}
+		for i := start; i < start+ch.Shots; i++ {
+			key, err := s.runner.RunOnce(table.sample(rng))
+			if err != nil {
+				return hist, fmt.Errorf("shot %d failed: %w", i+1, err)
+			}
+			key = nm.flipReadout(project(key), rng)
+			hist[key]++
+			ch.Counts[key]++
+		}
+		if s.Progress != nil {
+			s.Progress(ch)
+		}
+	}
+	s.log.Info().Int("shots", s.Shots).Float64("depolarizing", nm.Depolarizing).
+		Float64("readout", nm.Readout).Msg("simulator: RunNoisy finished")
+	return hist, nil
+}
+
+// Comparison holds an ideal and a noisy run of the same circuit.
+type Comparison struct {
+	Ideal, Noisy map[string]int
+	Shots        int
+	// TVD is the total variation distance between the two empirical
+	// distributions: 0 for identical, 1 for disjoint.
+	TVD float64
+	// Fidelity is the classical (Bhattacharyya) fidelity (Σ√(p·q))²: 1 for
+	// identical, 0 for disjoint.
+	Fidelity float64
+}
+
+// CompareRuns runs c once without and once with noise and reports how far
+// the noisy histogram drifts from the ideal one.
+func (s *Simulator) CompareRuns(c circuit.Circuit, nm NoiseModel) (*Comparison, error) {
+	if err := nm.Validate(); err != nil {
+		return nil, err
+	}
+	ideal, err := s.Run(c)
+	if err != nil {
+		return nil, err
+	}
+	var noisy map[string]int
+	if nm.Depolarizing == 0 {
+		// Readout errors act per shot, so the ideal shots can be reused.
+		noisy = nm.applyReadout(ideal, s.noiseRand())
+	} else if noisy, err = s.runNoisyShots(c, nm); err != nil {
+		return nil, err
+	}
+	tvd, fid := divergence(ideal, noisy)
+	return &Comparison{Ideal: ideal, Noisy: noisy, Shots: s.Shots, TVD: tvd, Fidelity: fid}, nil
+}
+
+// divergence returns the total variation distance and classical fidelity
+// of two histograms, each normalised by its own total.
+func divergence(a, b map[string]int) (tvd, fidelity float64) {
+	total := func(h map[string]int) float64 {
+		t := 0
+		for _, n := range h {
+			t += n
+		}
+		return float64(t)
+	}
+	ta, tb := total(a), total(b)
+	if ta == 0 || tb == 0 {
+		return 0, 0
+	}
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	bc := 0.0
+	for k := range keys {
+		p, q := float64(a[k])/ta, float64(b[k])/tb
+		tvd += math.Abs(p - q)
+		bc += math.Sqrt(p * q)
+	}
+	return tvd / 2, bc * bc
+}
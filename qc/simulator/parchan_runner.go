@@ -1,6 +1,7 @@
 package simulator
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
@@ -10,6 +11,26 @@ import (
 // RunParallelChan executes the circuit and returns a histogram mapping classical
 // bit‑strings (little‑endian) to counts.
 func (s *Simulator) RunParallelChan(c circuit.Circuit) (map[string]int, error) {
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	if len(s.PostSelect) > 0 {
+		hist, _, err := s.postSelected(c, (*Simulator).RunParallelChan)
+		return hist, err
+	}
+	if s.UniformNoise != 0 {
+		return s.withUniformNoise(c, (*Simulator).RunParallelChan)
+	}
+	c, project := s.plan(c)
+	if hist, ok, err := s.shortcut(c, project); ok {
+		return hist, err
+	}
+	if hist, ok, err := s.sample(c, project); ok {
+		return hist, err
+	}
+	if s.Seed != 0 || s.Progress != nil {
+		return s.runChunked(c, project)
+	}
 
 	// shots and workers are now initialized in New
 	s.log.Info().
@@ -20,8 +41,8 @@ func (s *Simulator) RunParallelChan(c circuit.Circuit) (map[string]int, error) {
 		Int("depth", c.Depth()).
 		Msg("simulator: Starting RunParallelChan")
 
-	hist := make(map[string]int)
-	var mu sync.Mutex
+	// Each worker counts into its own tally; they are merged once at the end.
+	tallies := make([]*tally, s.Workers)
 	wg := sync.WaitGroup{}
 	errChan := make(chan error, s.Workers) // Channel to collect the first error from each worker
 
@@ -33,8 +54,10 @@ func (s *Simulator) RunParallelChan(c circuit.Circuit) (map[string]int, error) {
 	close(jobs)
 
 	for wid := range s.Workers {
+		tallies[wid] = s.newTally(c)
 		wg.Add(1)
-		go func(id int) {
+		id, t := wid, tallies[wid]
+		s.spawn(func() {
 			defer wg.Done()
 			var workerErr error // Track first error for this worker
 
@@ -44,18 +67,14 @@ func (s *Simulator) RunParallelChan(c circuit.Circuit) (map[string]int, error) {
 					continue
 				}
 
-				key, err := s.runner.RunOnce(c) // Run the circuit once
-
-				if err != nil {
+				if err := t.shot(s, c); err != nil { // Run the circuit once
 					// Record the first error encountered by this worker
 					workerErr = fmt.Errorf("worker %d failed: %w", id, err)
 					s.log.Error().Err(workerErr).Int("worker_id", id).Msg("simulator: Shot failed")
-					continue // Continue to allow other workers to finish
+					if errors.Is(err, ErrResourceLimit) {
+						break // every later shot would fail the same way
+					}
 				}
-
-				mu.Lock()
-				hist[key]++
-				mu.Unlock()
 			}
 
 			// Report the first error encountered by this worker, if any
@@ -68,13 +87,15 @@ func (s *Simulator) RunParallelChan(c circuit.Circuit) (map[string]int, error) {
 					s.log.Warn().Err(workerErr).Int("worker_id", id).Msg("simulator: Worker failed to send error (channel full?)")
 				}
 			}
-		}(wid)
+		})
 	}
 
 	s.log.Debug().Msg("simulator: Waiting for workers to finish...")
 	wg.Wait()
 	s.log.Info().Msg("simulator: Workers finished.")
 	close(errChan) // Close channel after all workers are done
+	hist := mergeTallies(tallies, c.Clbits(), project)
+	s.releaseTallies(tallies)
 
 	// Check if any errors were reported
 	var firstErr error
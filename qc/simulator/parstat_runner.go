@@ -9,6 +9,26 @@ import (
 
 // RunParallelStatic  (static partition) – workers get equal shot counts, no channels.
 func (s *Simulator) RunParallelStatic(c circuit.Circuit) (map[string]int, error) {
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	if len(s.PostSelect) > 0 {
+		hist, _, err := s.postSelected(c, (*Simulator).RunParallelStatic)
+		return hist, err
+	}
+	if s.UniformNoise != 0 {
+		return s.withUniformNoise(c, (*Simulator).RunParallelStatic)
+	}
+	c, project := s.plan(c)
+	if hist, ok, err := s.shortcut(c, project); ok {
+		return hist, err
+	}
+	if hist, ok, err := s.sample(c, project); ok {
+		return hist, err
+	}
+	if s.Seed != 0 || s.Progress != nil {
+		return s.runChunked(c, project)
+	}
 	shots := s.Shots
 	if shots <= 0 {
 		shots = 1024
@@ -36,8 +56,8 @@ func (s *Simulator) RunParallelStatic(c circuit.Circuit) (map[string]int, error)
 		Int("depth", c.Depth()).
 		Msgf("simulator %s: Starting RunParallelStatic", backend)
 
-	hist := make(map[string]int, shots)
-	var mu sync.Mutex
+	// Each worker counts into its own tally; they are merged once at the end.
+	tallies := make([]*tally, workers)
 	errChan := make(chan error, 1)
 
 	wg := sync.WaitGroup{}
@@ -46,28 +66,27 @@ func (s *Simulator) RunParallelStatic(c circuit.Circuit) (map[string]int, error)
 		if w < extra {
 			cnt++
 		}
+		tallies[w] = s.newTally(c)
 		wg.Add(1)
-		go func(n int) {
+		t, n := tallies[w], cnt
+		s.spawn(func() {
 			defer wg.Done()
 			for range n {
-				key, err := s.runner.RunOnce(c) // Run the circuit once
-
-				if err != nil {
+				if err := t.shot(s, c); err != nil { // Run the circuit once
 					select { // capture first error
 					case errChan <- err:
 					default:
 					}
 					return
 				}
-				mu.Lock()
-				hist[key]++
-				mu.Unlock()
 			}
-		}(cnt)
+		})
 	}
 
 	wg.Wait()
 	close(errChan)
+	hist := mergeTallies(tallies, c.Clbits(), project)
+	s.releaseTallies(tallies)
 
 	// Check if any errors were reported
 	var firstErr error
@@ -0,0 +1,280 @@
+// Package pauliprop estimates expectation values in the Heisenberg
+// picture: instead of evolving a state forwards, it propagates the
+// observable backwards through the circuit as a sparse sum of Pauli
+// strings and reads off its expectation in |0…0⟩. The cost depends on the
+// number of strings, not on the width, so it suits very wide circuits of
+// Clifford gates, which map a string to a single string, and a few
+// non-Clifford rotations, each of which can split a string in two.
+//
+// Every gate is written as a product of Pauli rotations exp(−iφG/2); a
+// string P that anticommutes with G becomes cos φ·P + sin φ·(−iPG).
+// Strings whose coefficient falls below Options.MinCoeff, or whose weight
+// exceeds Options.MaxWeight, are dropped, and the sum of the dropped
+// coefficients' magnitudes bounds the error this causes.
+package pauliprop
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// Options controls truncation. The zero value propagates exactly.
+type Options struct {
+	MinCoeff  float64 // drop strings with |coefficient| below this
+	MaxWeight int     // drop strings acting on more qubits than this; 0: no limit
+}
+
+// Estimate is an expectation value and what truncation may have cost.
+type Estimate struct {
+	Value float64
+	// TruncationError bounds |Value − exact|: the summed magnitudes of
+	// every dropped coefficient, each of which can shift the expectation
+	// by at most itself.
+	TruncationError float64
+	MaxTerms        int // largest number of strings held at once
+}
+
+// rotation is exp(−iφG/2) for the Pauli string G, given by its
+// non-identity factors.
+type rotation struct {
+	qubits []int
+	paulis []byte
+	phi    float64
+}
+
+// Expectation returns ⟨0…0|U† h U|0…0⟩ for the unitary part U of c.
+// Measurements must come at the end and are ignored; circuits with
+// classical control flow are rejected.
+func Expectation(c circuit.Circuit, h gradient.Hamiltonian, opts Options) (Estimate, error) {
+	rots, err := rotations(c)
+	if err != nil {
+		return Estimate{}, err
+	}
+	n := c.Qubits()
+	terms := map[string]float64{}
+	id := strings.Repeat("I", n)
+	for i, t := range h {
+		if len(t.Paulis) > n || strings.Trim(t.Paulis, "IXYZ") != "" {
+			return Estimate{}, fmt.Errorf("pauliprop: term %d %q is not a Pauli string on %d qubits", i, t.Paulis, n)
+		}
+		terms[t.Paulis+id[len(t.Paulis):]] += t.Coeff
+	}
+
+	var est Estimate
+	est.MaxTerms = len(terms)
+	for i := len(rots) - 1; i >= 0; i-- {
+		terms = est.conjugate(terms, rots[i], opts)
+		est.MaxTerms = max(est.MaxTerms, len(terms))
+	}
+	for p, v := range terms {
+		if strings.Trim(p, "IZ") == "" {
+			est.Value += v
+		}
+	}
+	return est, nil
+}
+
+// conjugate returns U† terms U for U = exp(−iφG/2), truncating the
+// strings it changed.
+func (est *Estimate) conjugate(terms map[string]float64, r rotation, opts Options) map[string]float64 {
+	cos, sin := cosSin(r.phi)
+	next := make(map[string]float64, len(terms))
+	var touched []string
+	for p, v := range terms {
+		if !anticommutes(p, r) {
+			next[p] += v
+			continue
+		}
+		q, sign := rotate(p, r)
+		if cos != 0 {
+			next[p] += cos * v
+			touched = append(touched, p)
+		}
+		next[q] += sin * sign * v
+		touched = append(touched, q)
+	}
+	for _, p := range touched {
+		v, ok := next[p]
+		if !ok {
+			continue
+		}
+		if v == 0 {
+			delete(next, p)
+			continue
+		}
+		if math.Abs(v) < opts.MinCoeff || opts.MaxWeight > 0 && len(p)-strings.Count(p, "I") > opts.MaxWeight {
+			est.TruncationError += math.Abs(v)
+			delete(next, p)
+		}
+	}
+	return next
+}
+
+// cosSin returns cos φ and sin φ, exact at multiples of π/2 so that
+// Clifford rotations never leave near-zero strings behind.
+func cosSin(phi float64) (float64, float64) {
+	k := phi / (math.Pi / 2)
+	if r := math.Round(k); math.Abs(k-r) < 1e-12 {
+		return [4]float64{1, 0, -1, 0}[int(r)&3], [4]float64{0, 1, 0, -1}[int(r)&3]
+	}
+	return math.Cos(phi), math.Sin(phi)
+}
+
+// anticommutes reports whether the string p anticommutes with r's G: an
+// odd number of qubits carry two different non-identity factors.
+func anticommutes(p string, r rotation) bool {
+	odd := false
+	for k, q := range r.qubits {
+		if a := p[q]; a != 'I' && a != r.paulis[k] {
+			odd = !odd
+		}
+	}
+	return odd
+}
+
+// rotate returns the string Q and sign s with −iPG = s·Q, for p and G
+// anticommuting.
+func rotate(p string, r rotation) (string, float64) {
+	q := []byte(p)
+	phase := 3 // −i = i³
+	for k, qb := range r.qubits {
+		var ph int
+		q[qb], ph = mul(p[qb], r.paulis[k])
+		phase += ph
+	}
+	// The product of anticommuting Hermitian strings times −i is
+	// Hermitian, so the phase is real.
+	if phase%4 == 0 {
+		return string(q), 1
+	}
+	return string(q), -1
+}
+
+// mul returns the single-qubit product ab as c·i^ph.
+func mul(a, b byte) (byte, int) {
+	switch {
+	case a == 'I':
+		return b, 0
+	case b == 'I':
+		return a, 0
+	case a == b:
+		return 'I', 0
+	}
+	// XY = iZ, YZ = iX, ZX = iY; the reverse orders carry −i.
+	third := byte('X' + 'Y' + 'Z' - int(a) - int(b))
+	if a == 'X' && b == 'Y' || a == 'Y' && b == 'Z' || a == 'Z' && b == 'X' {
+		return third, 1
+	}
+	return third, 3
+}
+
+// rotations lists the Pauli rotations of c's gates in time order.
+func rotations(c circuit.Circuit) ([]rotation, error) {
+	if circuit.HasControlFlow(c) {
+		return nil, fmt.Errorf("pauliprop: circuits with classical control flow are not supported")
+	}
+	var rots []rotation
+	rot := func(p byte, phi float64, q int) {
+		rots = append(rots, rotation{qubits: []int{q}, paulis: []byte{p}, phi: phi})
+	}
+	measured := make([]bool, c.Qubits())
+	var op circuit.Operation // the operation being added
+	var opIndex int
+	var add func(g gate.Gate, qs []int) error
+	add = func(g gate.Gate, qs []int) error {
+		angle := func() (float64, error) {
+			pg, ok := g.(gate.Parametric)
+			if !ok {
+				return 0, fmt.Errorf("pauliprop: gate %s carries no angle", g.Name())
+			}
+			return pg.Params()[0], nil
+		}
+		switch g.Name() {
+		case "X", "Y", "Z":
+			rot(g.Name()[0], math.Pi, qs[0])
+		case "S":
+			rot('Z', math.Pi/2, qs[0])
+		case "H":
+			// H = RY(π/2)·Z up to phase.
+			rot('Z', math.Pi, qs[0])
+			rot('Y', math.Pi/2, qs[0])
+		case "P", "RX", "RY", "RZ":
+			theta, err := angle()
+			if err != nil {
+				return err
+			}
+			// P(θ) is RZ(θ) up to phase.
+			rot(map[string]byte{"P": 'Z', "RX": 'X', "RY": 'Y', "RZ": 'Z'}[g.Name()], theta, qs[0])
+		case "CZ":
+			rots = append(rots, phaseGadget(qs, "ZZ", math.Pi)...)
+		case "CP":
+			theta, err := angle()
+			if err != nil {
+				return err
+			}
+			rots = append(rots, phaseGadget(qs, "ZZ", theta)...)
+		case "CNOT":
+			rots = append(rots, phaseGadget(qs, "ZX", math.Pi)...)
+		case "TOFFOLI":
+			rots = append(rots, phaseGadget(qs, "ZZX", math.Pi)...)
+		case "SWAP":
+			for _, pair := range [][]int{{qs[0], qs[1]}, {qs[1], qs[0]}, {qs[0], qs[1]}} {
+				rots = append(rots, phaseGadget(pair, "ZX", math.Pi)...)
+			}
+		case "FREDKIN":
+			rots = append(rots, phaseGadget([]int{qs[2], qs[1]}, "ZX", math.Pi)...)
+			rots = append(rots, phaseGadget(qs, "ZZX", math.Pi)...)
+			rots = append(rots, phaseGadget([]int{qs[2], qs[1]}, "ZX", math.Pi)...)
+		default:
+			e := &simulator.UnsupportedGateError{Runner: "pauliprop", Gate: g.Name(), Qubits: qs, Op: opIndex}
+			if g.Name() != op.G.Name() {
+				e.Composite = op.G.Name()
+			}
+			return e
+		}
+		return nil
+	}
+	for opIndex, op = range c.Operations() {
+		if op.G.Name() == "MEASURE" {
+			measured[op.Qubits[0]] = true
+			continue
+		}
+		for _, q := range op.Qubits {
+			if measured[q] {
+				return nil, fmt.Errorf("pauliprop: gate %s acts on qubit %d after it was measured", op.G.Name(), q)
+			}
+		}
+		if err := gate.Expand(op.G, op.Qubits, add); err != nil {
+			return nil, err
+		}
+	}
+	return rots, nil
+}
+
+// phaseGadget writes exp(iθ·Π_k (1−σ_k)/2), σ_k the factor paulis[k] on
+// qs[k], as commuting Pauli rotations: expanding the product gives the
+// string of every non-empty subset S of the factors with coefficient
+// (−1)^|S|/2^n, that is a rotation by φ = −θ(−1)^|S|/2^(n−1). CZ and CP
+// are the case ZZ, CNOT is ZX and Toffoli ZZX.
+func phaseGadget(qs []int, paulis string, theta float64) []rotation {
+	n := len(qs)
+	var rots []rotation
+	for s := 1; s < 1<<n; s++ {
+		r := rotation{phi: -theta / float64(int(1)<<(n-1))}
+		for k := range n {
+			if s&(1<<k) != 0 {
+				r.qubits = append(r.qubits, qs[k])
+				r.paulis = append(r.paulis, paulis[k])
+				r.phi = -r.phi
+			}
+		}
+		rots = append(rots, r)
+	}
+	return rots
+}
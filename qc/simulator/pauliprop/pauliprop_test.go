@@ -0,0 +1,138 @@
+package pauliprop
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/algorithms/gradient"
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exact returns ⟨ψ|P|ψ⟩ from a little-endian statevector.
+func exact(sv []complex128, p string) float64 {
+	var sum complex128
+	for j, a := range sv {
+		k, ph := j, complex(1, 0)
+		for q, f := range p {
+			bit := j >> q & 1
+			switch f {
+			case 'X':
+				k ^= 1 << q
+			case 'Y':
+				k ^= 1 << q
+				ph *= [2]complex128{1i, -1i}[bit]
+			case 'Z':
+				ph *= [2]complex128{1, -1}[bit]
+			}
+		}
+		sum += cmplx.Conj(sv[k]) * ph * a
+	}
+	return real(sum)
+}
+
+func TestExpectationMatchesStatevector(t *testing.T) {
+	mcx, err := decompose.MCX(2, decompose.Recursive)
+	require.NoError(t, err)
+	c, err := builder.New(builder.Q(4), builder.C(4)).
+		H(0).RY(0.7, 1).RX(1.3, 2).Y(3).
+		CNOT(0, 2).CZ(1, 3).CP(0.9, 3, 0).S(2).P(-0.4, 1).RZ(2.1, 1).
+		Toffoli(3, 1, 2).SWAP(1, 3).Z(0).X(2).H(1).
+		Apply(mcx, 0, 2, 1).RX(0.3, 3).
+		Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(t, err)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+
+	for _, p := range []string{"ZIII", "XYZI", "IIXX", "YZYZ", "ZZ"} {
+		est, err := Expectation(c, gradient.Hamiltonian{{Coeff: 1, Paulis: p}}, Options{})
+		require.NoError(t, err)
+		padded := p + "IIII"[len(p):]
+		assert.InDelta(t, exact(sv, padded), est.Value, 1e-9, p)
+		assert.Zero(t, est.TruncationError)
+	}
+
+	h := gradient.Hamiltonian{{Coeff: 0.5, Paulis: "ZZII"}, {Coeff: -2, Paulis: "IXIY"}}
+	est, err := Expectation(c, h, Options{})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5*exact(sv, "ZZII")-2*exact(sv, "IXIY"), est.Value, 1e-9)
+}
+
+func TestFredkin(t *testing.T) {
+	// |110⟩ becomes |101⟩: ⟨Z1⟩ = 1, ⟨Z2⟩ = −1.
+	c, err := builder.New(builder.Q(3), builder.C(0)).X(0).X(1).Fredkin(0, 1, 2).BuildCircuit()
+	require.NoError(t, err)
+	for p, want := range map[string]float64{"IZI": 1, "IIZ": -1, "ZIZ": 1} {
+		est, err := Expectation(c, gradient.Hamiltonian{{Coeff: 1, Paulis: p}}, Options{})
+		require.NoError(t, err)
+		assert.InDelta(t, want, est.Value, 1e-12, p)
+	}
+}
+
+// ghz prepares a GHZ state on n qubits and rotates the last one.
+func ghz(t *testing.T, n int, theta float64) circuit.Circuit {
+	b := builder.New(builder.Q(n), builder.C(0)).H(0)
+	for q := range n - 1 {
+		b.CNOT(q, q+1)
+	}
+	b.RY(theta, n-1)
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+	return c
+}
+
+func TestWide(t *testing.T) {
+	const n = 500
+	c := ghz(t, n, 0.6)
+	zz := make([]byte, n)
+	for q := range zz {
+		zz[q] = 'I'
+	}
+	zz[0], zz[n-1] = 'Z', 'Z'
+	est, err := Expectation(c, gradient.Hamiltonian{{Coeff: 1, Paulis: string(zz)}}, Options{})
+	require.NoError(t, err)
+	assert.InDelta(t, math.Cos(0.6), est.Value, 1e-9)
+	assert.LessOrEqual(t, est.MaxTerms, 2)
+}
+
+func TestTruncation(t *testing.T) {
+	b := builder.New(builder.Q(6), builder.C(0))
+	for q := range 6 {
+		b.H(q).RZ(0.3+0.2*float64(q), q)
+	}
+	for q := range 5 {
+		b.CNOT(q, q+1).RX(0.7, q+1)
+	}
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+	h := gradient.Hamiltonian{{Coeff: 1, Paulis: "IIXIIZ"}, {Coeff: 1, Paulis: "ZZZZZZ"}}
+
+	full, err := Expectation(c, h, Options{})
+	require.NoError(t, err)
+	for _, opts := range []Options{{MinCoeff: 0.05}, {MaxWeight: 2}} {
+		est, err := Expectation(c, h, opts)
+		require.NoError(t, err)
+		assert.Positive(t, est.TruncationError)
+		assert.LessOrEqual(t, math.Abs(est.Value-full.Value), est.TruncationError+1e-12)
+		assert.Less(t, est.MaxTerms, full.MaxTerms)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).X(0).BuildCircuit()
+	require.NoError(t, err)
+	_, err = Expectation(c, gradient.Hamiltonian{{Coeff: 1, Paulis: "Z"}}, Options{})
+	assert.Error(t, err)
+
+	c, err = builder.New(builder.Q(1), builder.C(0)).H(0).BuildCircuit()
+	require.NoError(t, err)
+	for _, p := range []string{"ZZ", "A"} {
+		_, err = Expectation(c, gradient.Hamiltonian{{Coeff: 1, Paulis: p}}, Options{})
+		assert.Error(t, err, p)
+	}
+}
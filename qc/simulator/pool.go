@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Pool is a long-lived set of worker goroutines shared by the simulators
+// it creates, for services that run many circuits: shots run on the pool's
+// workers instead of goroutines started and stopped by every Run call, and
+// per-worker count buffers are recycled between runs. It is safe for
+// concurrent use; runs from several goroutines share the workers.
+type Pool struct {
+	proto Simulator // copied by Simulator
+	tasks chan func()
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex // held for reading while submitting, for writing by Close
+	closed bool
+
+	bufMu sync.Mutex
+	bufs  map[int][][]int // free dense tally buffers by length
+}
+
+// NewPool starts opts.Workers (0 => NumCPU) workers. Simulators from the
+// pool use opts, with Workers set to the pool's size.
+func NewPool(opts SimulatorOptions) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	p := &Pool{tasks: make(chan func()), bufs: map[int][][]int{}}
+	p.proto = *NewSimulator(opts)
+	p.proto.Workers = opts.Workers
+	p.proto.pool = p
+	for range opts.Workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Simulator returns a simulator running on the pool's workers. It is cheap
+// to create; its exported fields (Shots, Seed, ...) may be changed before
+// running.
+func (p *Pool) Simulator() *Simulator {
+	s := p.proto
+	return &s
+}
+
+// Run runs c with the pool's options, like Simulator.Run.
+func (p *Pool) Run(c circuit.Circuit) (map[string]int, error) {
+	return p.Simulator().Run(c)
+}
+
+// Close stops the workers once the tasks already submitted finish.
+// Simulators from a closed pool start goroutines of their own.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// submit runs f on a pool worker, or on a new goroutine once the pool is
+// closed. It blocks while every worker is busy.
+func (p *Pool) submit(f func()) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		go f()
+		return
+	}
+	p.tasks <- f
+}
+
+// dense returns a zeroed buffer of n counts.
+func (p *Pool) dense(n int) []int {
+	p.bufMu.Lock()
+	defer p.bufMu.Unlock()
+	free := p.bufs[n]
+	if len(free) == 0 {
+		return make([]int, n)
+	}
+	buf := free[len(free)-1]
+	p.bufs[n] = free[:len(free)-1]
+	clear(buf)
+	return buf
+}
+
+// release returns the tallies' buffers for reuse.
+func (p *Pool) release(ts []*tally) {
+	p.bufMu.Lock()
+	defer p.bufMu.Unlock()
+	for _, t := range ts {
+		if t != nil && t.dense != nil {
+			p.bufs[len(t.dense)] = append(p.bufs[len(t.dense)], t.dense)
+			t.dense = nil
+		}
+	}
+}
+
+// spawn runs f on the simulator's pool, if it has one, or on a new
+// goroutine.
+func (s *Simulator) spawn(f func()) {
+	if s.pool != nil {
+		s.pool.submit(f)
+		return
+	}
+	go f()
+}
+
+// releaseTallies hands the tallies' buffers back to the pool, if any, once
+// they are merged.
+func (s *Simulator) releaseTallies(ts []*tally) {
+	if s.pool != nil {
+		s.pool.release(ts)
+	}
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// maxPostSelectFactor bounds the attempts of a post-selected run to this
+// many times the requested shots.
+const maxPostSelectFactor = 1000
+
+// postSelected runs c with run until s.Shots shots satisfy s.PostSelect,
+// re-running batches sized from the acceptance rate seen so far. It returns
+// the accepted histogram and the acceptance rate.
+func (s *Simulator) postSelected(c circuit.Circuit, run func(*Simulator, circuit.Circuit) (map[string]int, error)) (map[string]int, float64, error) {
+	cbits := measuredCbits(c)
+	type want struct {
+		pos int
+		bit byte
+	}
+	var wants []want
+	for cb, v := range s.PostSelect {
+		pos := slices.Index(cbits, cb)
+		if pos < 0 {
+			return nil, 0, fmt.Errorf("simulator: post-selected cbit %d is never measured", cb)
+		}
+		if v != 0 && v != 1 {
+			return nil, 0, fmt.Errorf("simulator: post-selected value %d for cbit %d is not 0 or 1", v, cb)
+		}
+		wants = append(wants, want{pos, byte('0' + v)})
+	}
+	accept := func(key string) bool {
+		for _, w := range wants {
+			if key[w.pos] != w.bit {
+				return false
+			}
+		}
+		return true
+	}
+
+	sub := *s
+	sub.PostSelect = nil
+	hist := map[string]int{}
+	accepted, matched, attempts := 0, 0, 0
+	shuffle := rand.Shuffle
+	if s.Seed != 0 {
+		shuffle = rand.New(rand.NewSource(s.Seed)).Shuffle
+	}
+	for batchNo := 0; accepted < s.Shots; batchNo++ {
+		need := s.Shots - accepted
+		batch := need
+		if attempts > 0 {
+			rate := float64(matched) / float64(attempts)
+			batch = int(math.Ceil(float64(need) / max(rate, 1/float64(maxPostSelectFactor)) * 1.1))
+		}
+		batch = min(batch, maxPostSelectFactor*s.Shots-attempts)
+		if batch <= 0 {
+			return nil, 0, fmt.Errorf("simulator: post-selection accepted %d of %d shots, needed %d", matched, attempts, s.Shots)
+		}
+		sub.Shots, sub.Workers = batch, min(max(s.Workers, 1), batch)
+		if s.Seed != 0 {
+			// A fresh seed per batch, or every batch would repeat the first.
+			sub.Seed = chunkSeed(^s.Seed, batchNo)
+		}
+		got, err := run(&sub, c)
+		if err != nil {
+			return nil, 0, err
+		}
+		attempts += batch
+
+		var keys []string
+		for k, n := range got {
+			if accept(k) {
+				for range n {
+					keys = append(keys, k)
+				}
+			}
+		}
+		matched += len(keys)
+		if len(keys) > need {
+			// Keep a random subset so the overshoot does not bias the counts.
+			slices.Sort(keys) // map order must not leak into seeded runs
+			shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+			keys = keys[:need]
+		}
+		for _, k := range keys {
+			hist[k]++
+		}
+		accepted += len(keys)
+	}
+	rate := float64(matched) / float64(attempts)
+	s.log.Info().Int("shots", accepted).Int("attempts", attempts).Float64("acceptance", rate).
+		Msg("simulator: Post-selected run finished")
+	return hist, rate, nil
+}
@@ -0,0 +1,245 @@
+package simulator
+
+import (
+	"fmt"
+	"math/cmplx"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// MaxProcessQubits bounds the width of Process: its matrix has 16^n
+// entries and every gate costs a 4^n×4^n product.
+const MaxProcessQubits = 4
+
+// Process is a quantum channel on Qubits qubits as its Pauli transfer
+// matrix: PTM[i][j] = Tr(P_i·E(P_j))/2^n, real for any channel. Pauli
+// indices hold one base-4 digit per qubit, qubit 0 the lowest, with digits
+// 0–3 for I, X, Y and Z (see PauliLabel). PTM[i][j] is what process
+// tomography measures: the expectation of P_i after preparing P_j.
+type Process struct {
+	Qubits int
+	PTM    [][]float64
+}
+
+// Process computes the channel of c's gates under nm's depolarizing noise,
+// composing the PTM of every gate with that of its errors. Measurements
+// must be terminal and are left out, as are readout errors, which act on
+// classical bits. The runner must implement WarmStartRunner.
+func (s *Simulator) Process(c circuit.Circuit, nm NoiseModel) (*Process, error) {
+	if err := nm.Validate(); err != nil {
+		return nil, err
+	}
+	if !terminalMeasurements(c) {
+		return nil, fmt.Errorf("simulator: process matrices need terminal measurements and no control flow")
+	}
+	n := c.Qubits()
+	if n > MaxProcessQubits {
+		return nil, fmt.Errorf("simulator: process matrix of %d qubits exceeds the maximum of %d", n, MaxProcessQubits)
+	}
+	runner, ok := s.runner.(WarmStartRunner)
+	if !ok {
+		return nil, fmt.Errorf("simulator: runner cannot start from a given state")
+	}
+	d, dim := 1<<n, 1<<(2*n)
+	p := &Process{Qubits: n, PTM: identityMatrix(dim)}
+	// Each Pauli component survives a depolarizing error on its qubit
+	// with factor 1−4p/3: one of the three errors commutes with it.
+	keep := 1 - 4*nm.Depolarizing/3
+	for _, op := range c.OpsIter() {
+		if op.G.Name() == "MEASURE" {
+			continue
+		}
+		single := circuit.NewIncremental(n, 0)
+		if _, err := single.Append(dag.Op{G: op.G, Qubits: op.Qubits, Cbit: -1, Meta: op.Meta}); err != nil {
+			return nil, err
+		}
+		u := make([][]complex128, d) // u[k] is column k
+		for k := range d {
+			basis := make([]complex128, d)
+			basis[k] = 1
+			col, err := runner.StatevectorFrom(basis, single)
+			if err != nil {
+				return nil, err
+			}
+			u[k] = col
+		}
+		r := unitaryPTM(u, n)
+		if nm.Depolarizing != 0 {
+			for i := range dim {
+				for _, q := range op.Qubits {
+					if i>>(2*q)&3 != 0 {
+						for j := range r[i] {
+							r[i][j] *= keep
+						}
+					}
+				}
+			}
+		}
+		p.PTM = mulReal(r, p.PTM)
+	}
+	return p, nil
+}
+
+// PauliLabel returns the Pauli string of index i on qubits qubits, qubit 0
+// first, e.g. "XI" for i = 1 on two qubits.
+func PauliLabel(i, qubits int) string {
+	b := make([]byte, qubits)
+	for q := range b {
+		b[q] = "IXYZ"[i>>(2*q)&3]
+	}
+	return string(b)
+}
+
+// ProcessFidelity returns Tr(R_idealᵀ·R)/4^n, the fidelity of the Choi
+// states of p and ideal; for a unitary ideal it is 1 exactly when p is
+// that unitary.
+func (p *Process) ProcessFidelity(ideal *Process) (float64, error) {
+	if ideal.Qubits != p.Qubits {
+		return 0, fmt.Errorf("simulator: cannot compare processes of %d and %d qubits", p.Qubits, ideal.Qubits)
+	}
+	f := 0.0
+	for i, row := range p.PTM {
+		for j, v := range row {
+			f += ideal.PTM[i][j] * v
+		}
+	}
+	return f / float64(len(p.PTM)), nil
+}
+
+// AverageGateFidelity returns the fidelity of p with a unitary ideal,
+// averaged over pure input states: (d·F_pro + 1)/(d + 1) for d = 2^n.
+func (p *Process) AverageGateFidelity(ideal *Process) (float64, error) {
+	f, err := p.ProcessFidelity(ideal)
+	if err != nil {
+		return 0, err
+	}
+	d := float64(int(1) << p.Qubits)
+	return (d*f + 1) / (d + 1), nil
+}
+
+// Chi returns the process matrix in the Pauli basis, E(ρ) = Σ χ_ab P_a ρ P_b,
+// obtained from the PTM through the Choi matrix:
+// χ_ab = Σ_i R_ki·c/4^n where P_a P_i P_b = c·P_k.
+func (p *Process) Chi() [][]complex128 {
+	dim := len(p.PTM)
+	chi := make([][]complex128, dim)
+	for a := range dim {
+		chi[a] = make([]complex128, dim)
+		for b := range dim {
+			var sum complex128
+			for i := range dim {
+				k1, c1 := pauliMul(a, i, p.Qubits)
+				k, c2 := pauliMul(k1, b, p.Qubits)
+				sum += complex(p.PTM[k][i], 0) * c1 * c2
+			}
+			chi[a][b] = sum / complex(float64(dim), 0)
+		}
+	}
+	return chi
+}
+
+// unitaryPTM returns Tr(P_i U P_j U†)/d for the unitary with columns u.
+func unitaryPTM(u [][]complex128, n int) [][]float64 {
+	d, dim := 1<<n, 1<<(2*n)
+	r := make([][]float64, dim)
+	for i := range r {
+		r[i] = make([]float64, dim)
+	}
+	m := make([][]complex128, d) // U P_j U†, row-major
+	for i := range m {
+		m[i] = make([]complex128, d)
+	}
+	for j := range dim {
+		flip, phase := pauliAction(j, n)
+		for row := range d {
+			for col := range d {
+				var v complex128
+				for k := range d {
+					// (U P_j)[row][k] · U†[k][col]
+					v += phase(k) * u[k^flip][row] * cmplx.Conj(u[k][col])
+				}
+				m[row][col] = v
+			}
+		}
+		for i := range dim {
+			fi, ph := pauliAction(i, n)
+			var tr complex128
+			for k := range d {
+				tr += ph(k) * m[k][k^fi]
+			}
+			r[i][j] = real(tr) / float64(d)
+		}
+	}
+	return r
+}
+
+// pauliAction describes the Pauli of index i as P|k⟩ = phase(k)|k^flip⟩.
+func pauliAction(i, n int) (int, func(int) complex128) {
+	flip := 0
+	for q := range n {
+		if dq := i >> (2 * q) & 3; dq == 1 || dq == 2 {
+			flip |= 1 << q
+		}
+	}
+	return flip, func(k int) complex128 {
+		ph := complex(1, 0)
+		for q := range n {
+			bit := k >> q & 1
+			switch i >> (2 * q) & 3 {
+			case 2: // Y|0⟩ = i|1⟩, Y|1⟩ = −i|0⟩
+				ph *= [2]complex128{1i, -1i}[bit]
+			case 3:
+				ph *= [2]complex128{1, -1}[bit]
+			}
+		}
+		return ph
+	}
+}
+
+// pauliMul returns k and c with P_a·P_b = c·P_k.
+func pauliMul(a, b, n int) (int, complex128) {
+	// single[x][y]: product of single-qubit Paulis x·y as digit and phase.
+	type prod struct {
+		d int
+		c complex128
+	}
+	single := [4][4]prod{
+		{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
+		{{1, 1}, {0, 1}, {3, 1i}, {2, -1i}},
+		{{2, 1}, {3, -1i}, {0, 1}, {1, 1i}},
+		{{3, 1}, {2, 1i}, {1, -1i}, {0, 1}},
+	}
+	k, c := 0, complex(1, 0)
+	for q := range n {
+		p := single[a>>(2*q)&3][b>>(2*q)&3]
+		k |= p.d << (2 * q)
+		c *= p.c
+	}
+	return k, c
+}
+
+func identityMatrix(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+func mulReal(a, b [][]float64) [][]float64 {
+	out := make([][]float64, len(a))
+	for i, row := range a {
+		out[i] = make([]float64, len(b[0]))
+		for k, v := range row {
+			if v == 0 {
+				continue
+			}
+			for j, w := range b[k] {
+				out[i][j] += v * w
+			}
+		}
+	}
+	return out
+}
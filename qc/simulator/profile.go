@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// OpProfiler receives the time a runner spent on each operation it
+// executed. Runners may call it from several goroutines at once.
+type OpProfiler interface {
+	ObserveOp(op circuit.Operation, d time.Duration)
+}
+
+// ProfilingRunner is implemented by runners that can time every operation
+// they execute.
+type ProfilingRunner interface {
+	// WithProfiler returns a runner that shares this one's configuration
+	// and metrics and reports every operation it executes to p, so runs
+	// sharing a runner each profile only their own operations.
+	WithProfiler(p OpProfiler) OneShotRunner
+}
+
+// GateStats is the time spent on one gate type.
+type GateStats struct {
+	Count int64
+	Time  time.Duration
+}
+
+// Profile accumulates operation timings by gate name and by layer
+// (TimeStep of the operation in the circuit the runner executed). It is
+// an OpProfiler and safe for concurrent use.
+type Profile struct {
+	mu     sync.Mutex
+	gates  map[string]GateStats
+	layers []time.Duration
+}
+
+// NewProfile returns an empty Profile.
+func NewProfile() *Profile {
+	return &Profile{gates: map[string]GateStats{}}
+}
+
+// ObserveOp implements OpProfiler.
+func (p *Profile) ObserveOp(op circuit.Operation, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g := p.gates[op.G.Name()]
+	g.Count++
+	g.Time += d
+	p.gates[op.G.Name()] = g
+	if op.TimeStep >= 0 {
+		for len(p.layers) <= op.TimeStep {
+			p.layers = append(p.layers, 0)
+		}
+		p.layers[op.TimeStep] += d
+	}
+}
+
+// Gates returns the time spent per gate name.
+func (p *Profile) Gates() map[string]GateStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.gates)
+}
+
+// Layers returns the time spent per layer, indexed by TimeStep.
+func (p *Profile) Layers() []time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.layers)
+}
+
+// Total returns the time spent on all operations.
+func (p *Profile) Total() time.Duration {
+	var t time.Duration
+	for _, g := range p.Gates() {
+		t += g.Time
+	}
+	return t
+}
+
+// Table formats the profile as two plain-text tables: gate types by
+// descending time, then layers in order, each with its share of the total.
+func (p *Profile) Table() string {
+	gates, layers, total := p.Gates(), p.Layers(), p.Total()
+	share := func(d time.Duration) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(d) / float64(total)
+	}
+	names := slices.SortedFunc(maps.Keys(gates), func(a, b string) int {
+		if c := gates[b].Time - gates[a].Time; c != 0 {
+			return int(max(min(c, 1), -1))
+		}
+		return strings.Compare(a, b)
+	})
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-12s %10s %14s %14s %7s\n", "GATE", "COUNT", "TOTAL", "PER OP", "SHARE")
+	for _, name := range names {
+		g := gates[name]
+		fmt.Fprintf(&sb, "%-12s %10d %14v %14v %6.1f%%\n", name, g.Count, g.Time, g.Time/time.Duration(g.Count), share(g.Time))
+	}
+	fmt.Fprintf(&sb, "\n%-12s %14s %7s\n", "LAYER", "TOTAL", "SHARE")
+	for i, d := range layers {
+		fmt.Fprintf(&sb, "%-12d %14v %6.1f%%\n", i, d, share(d))
+	}
+	return sb.String()
+}
@@ -0,0 +1,201 @@
+package qsim
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// maxFused bounds the qubits of one fused layer, so its blocks of
+// 2^maxFused amplitudes stay in L1 cache.
+const maxFused = 8
+
+// single returns the unitary of op if it is an unconditional built-in
+// single-qubit gate. Fixed gates must be the built-in singletons and
+// parametric ones must carry their angle, so other gates named like them
+// are left to ApplyGate.
+func single(op circuit.Operation) ([2][2]complex128, bool) {
+	if op.Cond != nil || op.Loop != nil || len(op.Qubits) != 1 {
+		return [2][2]complex128{}, false
+	}
+	r := complex(1/math.Sqrt2, 0)
+	switch op.G {
+	case gate.H():
+		return [2][2]complex128{{r, r}, {r, -r}}, true
+	case gate.X():
+		return [2][2]complex128{{0, 1}, {1, 0}}, true
+	case gate.Y():
+		return [2][2]complex128{{0, -1i}, {1i, 0}}, true
+	case gate.Z():
+		return [2][2]complex128{{1, 0}, {0, -1}}, true
+	case gate.S():
+		return [2][2]complex128{{1, 0}, {0, 1i}}, true
+	}
+	pg, ok := op.G.(gate.Parametric)
+	if !ok || len(pg.Params()) != 1 {
+		return [2][2]complex128{}, false
+	}
+	theta := pg.Params()[0]
+	switch op.G.Name() {
+	case "P":
+		return [2][2]complex128{{1, 0}, {0, cmplx.Exp(complex(0, theta))}}, true
+	case "RX":
+		c, s := complex(math.Cos(theta/2), 0), math.Sin(theta/2)
+		return [2][2]complex128{{c, complex(0, -s)}, {complex(0, -s), c}}, true
+	case "RY":
+		c, s := complex(math.Cos(theta/2), 0), math.Sin(theta/2)
+		return [2][2]complex128{{c, complex(-s, 0)}, {complex(s, 0), c}}, true
+	case "RZ":
+		return [2][2]complex128{{cmplx.Exp(complex(0, -theta/2)), 0}, {0, cmplx.Exp(complex(0, theta/2))}}, true
+	}
+	return [2][2]complex128{}, false
+}
+
+// fuser collects runs of consecutive operations applying one single-qubit
+// gate to distinct qubits, such as the H⊗n layers of Grover and
+// Deutsch-Jozsa circuits, and applies each run in one sweep of the
+// statevector (see applyLayer) instead of one sweep per qubit. Operations
+// are fed to add in execution order; flush must be called before anything
+// else touches the state. A fuser that is off fuses nothing, for profilers
+// and hooks that observe every operation.
+type fuser struct {
+	state *QuantumState
+	off   bool
+	m     [2][2]complex128
+	ops   [maxFused]circuit.Operation // the run is ops[:n]
+	n     int
+	mask  int // qubits of the run
+}
+
+// add appends op to the pending run, flushing the run first if op cannot
+// join it. It reports false, leaving the run as is, for operations that
+// cannot be fused at all.
+func (f *fuser) add(op circuit.Operation) (bool, error) {
+	if f.off {
+		return false, nil
+	}
+	m, ok := single(op)
+	if !ok || op.Qubits[0] >= f.state.numQubits {
+		return false, nil
+	}
+	bit := 1 << op.Qubits[0]
+	if f.n > 0 && (m != f.m || f.mask&bit != 0 || f.n == maxFused) {
+		if err := f.flush(); err != nil {
+			return false, err
+		}
+	}
+	f.m, f.mask = m, f.mask|bit
+	f.ops[f.n] = op
+	f.n++
+	return true, nil
+}
+
+// flush applies the pending run.
+func (f *fuser) flush() error {
+	n := f.n
+	f.n, f.mask = 0, 0
+	switch n {
+	case 0:
+		return nil
+	case 1:
+		op := f.ops[0]
+		if err := f.state.ApplyGate(op.G, op.Qubits); err != nil {
+			return fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
+		}
+		return nil
+	}
+	var qubits [maxFused]int
+	for i, op := range f.ops[:n] {
+		qubits[i] = op.Qubits[0]
+	}
+	f.state.applyLayer(f.m, qubits[:n])
+	return nil
+}
+
+// applyLayer applies m to each of qubits (distinct, at most maxFused) in a
+// single pass: every block of the 2^k amplitudes that differ only in those
+// qubits is gathered, transformed once per qubit while in cache, and
+// written back.
+func (qs *QuantumState) applyLayer(m [2][2]complex128, qubits []int) {
+	k := len(qubits)
+	mask := 0
+	var offset [1 << maxFused]int // offset[j]: amplitude index bits of local index j
+	for i, q := range qubits {
+		mask |= 1 << q
+		for j := range 1 << k {
+			if j>>i&1 == 1 {
+				offset[j] |= 1 << q
+			}
+		}
+	}
+	var block [1 << maxFused]complex128
+	b, off, amps := block[:1<<k], offset[:1<<k], qs.amplitudes
+	// H⊗k is a Walsh-Hadamard transform scaled by 2^(-k/2) once at the
+	// end; other real matrices (X, Z, RY) take half the multiplications.
+	hadamard := m[0][0] == m[0][1] && m[0][0] == m[1][0] && m[1][1] == -m[0][0] && imag(m[0][0]) == 0
+	isReal := imag(m[0][0]) == 0 && imag(m[0][1]) == 0 && imag(m[1][0]) == 0 && imag(m[1][1]) == 0
+	scale := complex(math.Pow(real(m[0][0]), float64(k)), 0)
+	// Bases are the indices with all the qubits' bits clear, in order.
+	for base := 0; base < len(amps); base = ((base | mask) + 1) &^ mask {
+		for j, o := range off {
+			b[j] = amps[base|o]
+		}
+		switch {
+		case hadamard:
+			walshHadamard(b)
+			for j, o := range off {
+				amps[base|o] = b[j] * scale
+			}
+			continue
+		case isReal:
+			butterflyReal(b, m)
+		default:
+			butterfly(b, m)
+		}
+		for j, o := range off {
+			amps[base|o] = b[j]
+		}
+	}
+}
+
+// walshHadamard applies the unnormalised H⊗k to the block b.
+func walshHadamard(b []complex128) {
+	for bit := 1; bit < len(b); bit <<= 1 {
+		for lo := 0; lo < len(b); lo += 2 * bit {
+			for j := lo; j < lo+bit; j++ {
+				b[j], b[j+bit] = b[j]+b[j+bit], b[j]-b[j+bit]
+			}
+		}
+	}
+}
+
+// butterfly applies m to every qubit of the block b.
+func butterfly(b []complex128, m [2][2]complex128) {
+	m00, m01, m10, m11 := m[0][0], m[0][1], m[1][0], m[1][1]
+	for bit := 1; bit < len(b); bit <<= 1 {
+		for lo := 0; lo < len(b); lo += 2 * bit {
+			for j := lo; j < lo+bit; j++ {
+				a0, a1 := b[j], b[j+bit]
+				b[j] = m00*a0 + m01*a1
+				b[j+bit] = m10*a0 + m11*a1
+			}
+		}
+	}
+}
+
+// butterflyReal is butterfly for a real m.
+func butterflyReal(b []complex128, m [2][2]complex128) {
+	m00, m01, m10, m11 := real(m[0][0]), real(m[0][1]), real(m[1][0]), real(m[1][1])
+	for bit := 1; bit < len(b); bit <<= 1 {
+		for lo := 0; lo < len(b); lo += 2 * bit {
+			for j := lo; j < lo+bit; j++ {
+				x0, y0, x1, y1 := real(b[j]), imag(b[j]), real(b[j+bit]), imag(b[j+bit])
+				b[j] = complex(m00*x0+m01*x1, m00*y0+m01*y1)
+				b[j+bit] = complex(m10*x0+m11*x1, m10*y0+m11*y1)
+			}
+		}
+	}
+}
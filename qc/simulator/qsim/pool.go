@@ -0,0 +1,63 @@
+package qsim
+
+import (
+	"sync"
+
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// statePools recycles the states of finished shots, one sync.Pool per
+// width ([2]int{qubits, clbits}), so that many-shot runs reuse the same
+// few statevectors instead of allocating 2^n amplitudes per shot.
+var statePools sync.Map
+
+// acquireState returns a state in |0…0⟩ with all classical bits clear,
+// taken from the pool when one is free. Each state starts a shot for the
+// hook.
+func (r *QSimRunner) acquireState(numQubits, numClassical int) *QuantumState {
+	key := [2]int{numQubits, numClassical}
+	if p, ok := statePools.Load(key); ok {
+		if qs, ok := p.(*sync.Pool).Get().(*QuantumState); ok {
+			r.metrics.stateReuses.Add(1)
+			qs.reset()
+			qs.profiler = r.profiler
+			qs.hook, qs.shot = r.shotHook()
+			qs.loops = r.loops
+			return qs
+		}
+	}
+	r.metrics.stateAllocs.Add(1)
+	qs := NewQuantumState(numQubits, numClassical)
+	qs.profiler = r.profiler
+	qs.hook, qs.shot = r.shotHook()
+	qs.loops = r.loops
+	return qs
+}
+
+// releaseState hands qs back for reuse. It must not be used afterwards.
+func releaseState(qs *QuantumState) {
+	key := [2]int{qs.numQubits, qs.numClassical}
+	p, _ := statePools.LoadOrStore(key, &sync.Pool{})
+	p.(*sync.Pool).Put(qs)
+}
+
+// reset returns qs to |0…0⟩ with all classical bits clear.
+func (qs *QuantumState) reset() {
+	clear(qs.amplitudes)
+	qs.amplitudes[0] = 1
+	clear(qs.classicalBits)
+	qs.StateVector = nil
+	qs.rng = nil
+	qs.profiler = nil
+	qs.hook, qs.shot = nil, -1
+	qs.loops = nil
+	qs.callbacks = nil
+}
+
+// AllocStats implements simulator.AllocStatsProvider.
+func (r *QSimRunner) AllocStats() simulator.AllocStats {
+	return simulator.AllocStats{
+		StateAllocs: r.metrics.stateAllocs.Load(),
+		StateReuses: r.metrics.stateReuses.Load(),
+	}
+}
@@ -2,12 +2,22 @@ package qsim
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
 	"math"
+	"math/cmplx"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/gate"
 	"github.com/kegliz/qcm/qc/simulator"
 	_ "github.com/kegliz/qcm/qc/simulator/itsu" // Import reference implementation
 )
@@ -307,6 +317,17 @@ func TestQSimRunner_GateImplementations(t *testing.T) {
 			},
 			expected: map[string]float64{"10": 1.0}, // |1⟩|0⟩ becomes |0⟩|1⟩
 		},
+		{
+			name: "FREDKIN gate",
+			builder: func() circuit.Circuit {
+				b := builder.New(builder.Q(3), builder.C(3))
+				b.X(0).X(1)        // Control on, targets |1⟩|0⟩
+				b.Fredkin(0, 1, 2) // Swap qubits 1 and 2
+				c, _ := b.BuildCircuit()
+				return c
+			},
+			expected: map[string]float64{"101": 1.0},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -459,3 +480,1164 @@ func BenchmarkQSimRunner_vs_Itsubaki(b *testing.B) {
 		}
 	})
 }
+
+func TestFusedLayers(t *testing.T) {
+	// Layers of one gate on every qubit, more than maxFused of them, mixed
+	// with entangling gates, conditions and rotations on repeated qubits,
+	// against the same gates applied one at a time.
+	const n = 11
+	bld := builder.New(builder.Q(n), builder.C(1))
+	for _, layer := range []func(q int){
+		func(q int) { bld.H(q) },
+		func(q int) { bld.RY(0.4, q) },
+		func(q int) { bld.RY(0.4, q) },
+		func(q int) { bld.RZ(float64(q)/3, q) },
+		func(q int) { bld.S(q).X(q) },
+	} {
+		for q := range n {
+			layer(q)
+		}
+		bld.CNOT(0, n-1).P(0.3, 4).Y(2)
+	}
+	c, err := bld.BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	want := NewQuantumState(n, 0)
+	for _, op := range c.OpsIter() {
+		if err := want.ApplyGate(op.G, op.Qubits); err != nil {
+			t.Fatalf("ApplyGate failed: %v", err)
+		}
+	}
+	got, err := NewQSimRunner().GetStatevector(c)
+	if err != nil {
+		t.Fatalf("GetStatevector failed: %v", err)
+	}
+	for i, a := range want.amplitudes {
+		if cmplx.Abs(got[i]-a) > 1e-12 {
+			t.Fatalf("amplitude %d is %v, want %v", i, got[i], a)
+		}
+	}
+
+	// Hooks see every operation, so they turn fusion off.
+	runner := NewQSimRunner()
+	seen := 0
+	runner.SetHook(simulator.OpHookFunc(func(circuit.Operation, int) { seen++ }))
+	if _, err := runner.GetStatevector(c); err != nil {
+		t.Fatalf("GetStatevector failed: %v", err)
+	}
+	if seen != c.NumOps() {
+		t.Errorf("hook saw %d operations, want %d", seen, c.NumOps())
+	}
+
+	// A custom gate named like a built-in rotation but carrying no angle is
+	// not fused; ApplyGate reports it.
+	c, err = builder.New(builder.Q(2)).H(0).Apply(namedGate("RX"), 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	if _, err := NewQSimRunner().GetStatevector(c); err == nil || !strings.Contains(err.Error(), "carries no angle") {
+		t.Errorf("GetStatevector with an angle-less RX: err = %v", err)
+	}
+}
+
+// namedGate is a custom single-qubit gate with the given name.
+type namedGate string
+
+func (g namedGate) Name() string       { return string(g) }
+func (g namedGate) QubitSpan() int     { return 1 }
+func (g namedGate) DrawSymbol() string { return string(g) }
+func (g namedGate) Targets() []int     { return []int{0} }
+func (g namedGate) Controls() []int    { return []int{} }
+
+func BenchmarkHadamardLayer(b *testing.B) {
+	for _, n := range []int{12, 20} {
+		qubits := make([]int, n)
+		for q := range qubits {
+			qubits[q] = q
+		}
+		h := [2][2]complex128{{complex(1/math.Sqrt2, 0), complex(1/math.Sqrt2, 0)}, {complex(1/math.Sqrt2, 0), complex(-1/math.Sqrt2, 0)}}
+		b.Run(fmt.Sprintf("sequential/%d", n), func(b *testing.B) {
+			state := NewQuantumState(n, 0)
+			for range b.N {
+				for _, q := range qubits {
+					state.applyHadamard(q)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("fused/%d", n), func(b *testing.B) {
+			state := NewQuantumState(n, 0)
+			for range b.N {
+				for i := 0; i < n; i += maxFused {
+					state.applyLayer(h, qubits[i:min(i+maxFused, n)])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRunNoisy(b *testing.B) {
+	// 8 qubits, 200 gates: at 0.1% depolarizing most shots see no error,
+	// at 1% most see a few.
+	bld := builder.New(builder.Q(8), builder.C(8))
+	for i := range 100 {
+		bld.H(i%8).CNOT(i%8, (i+3)%8)
+	}
+	for q := range 8 {
+		bld.Measure(q, q)
+	}
+	c, err := bld.BuildCircuit()
+	if err != nil {
+		b.Fatalf("Failed to build circuit: %v", err)
+	}
+	for _, p := range []float64{0.001, 0.01} {
+		b.Run(fmt.Sprint(p), func(b *testing.B) {
+			sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 256, Runner: NewQSimRunner(), Seed: 1})
+			for range b.N {
+				if _, err := sim.RunNoisy(c, simulator.NoiseModel{Depolarizing: p}); err != nil {
+					b.Fatalf("RunNoisy failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestQSimRunner_CompositeGate(t *testing.T) {
+	body := func(g builder.Builder, q []int) {
+		g.H(q[0]).CNOT(q[0], q[1]).S(q[1]).SWAP(q[1], q[2])
+	}
+	comp, err := builder.BuildGate("Block", 3, body)
+	if err != nil {
+		t.Fatalf("BuildGate failed: %v", err)
+	}
+
+	boxed, err := builder.New(builder.Q(3)).Apply(comp, 1, 2, 0).BuildCircuit()
+	if err != nil {
+		t.Fatalf("boxed circuit failed: %v", err)
+	}
+	inline, err := builder.New(builder.Q(3), builder.InlineComposites()).Apply(comp, 1, 2, 0).BuildCircuit()
+	if err != nil {
+		t.Fatalf("inline circuit failed: %v", err)
+	}
+
+	runner := NewQSimRunner()
+	if err := runner.ValidateCircuit(boxed); err != nil {
+		t.Fatalf("composite should validate: %v", err)
+	}
+	want, err := runner.GetStatevector(inline)
+	if err != nil {
+		t.Fatalf("inline statevector failed: %v", err)
+	}
+	got, err := runner.GetStatevector(boxed)
+	if err != nil {
+		t.Fatalf("boxed statevector failed: %v", err)
+	}
+	for i := range want {
+		if cmplx.Abs(want[i]-got[i]) > 1e-12 {
+			t.Errorf("amplitude %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestQSimRunner_DefinedMatrixGate(t *testing.T) {
+	body, err := builder.BuildGate("Block", 3, func(g builder.Builder, q []int) {
+		g.H(q[0]).CNOT(q[0], q[1]).RY(0.3, q[1]).SWAP(q[1], q[2]).CP(1.1, q[2], q[0])
+	})
+	if err != nil {
+		t.Fatalf("BuildGate failed: %v", err)
+	}
+	u, err := gate.Matrix(body)
+	if err != nil {
+		t.Fatalf("Matrix failed: %v", err)
+	}
+	g, err := gate.Define(gate.Custom{Name: "DenseBlock", Qubits: 3, Steps: body.Steps(), Matrix: u})
+	if err != nil {
+		t.Fatalf("Define failed: %v", err)
+	}
+	defer gate.Unregister("DenseBlock")
+
+	// The boxed gate is applied as one matrix, the inlined one step by step.
+	build := func(opts ...builder.Option) circuit.Circuit {
+		c, err := builder.New(append([]builder.Option{builder.Q(3)}, opts...)...).
+			H(1).RX(0.7, 2).Apply(g, 2, 0, 1).BuildCircuit()
+		if err != nil {
+			t.Fatalf("circuit failed: %v", err)
+		}
+		return c
+	}
+	runner := NewQSimRunner()
+	want, err := runner.GetStatevector(build(builder.InlineComposites()))
+	if err != nil {
+		t.Fatalf("inline statevector failed: %v", err)
+	}
+	got, err := runner.GetStatevector(build())
+	if err != nil {
+		t.Fatalf("boxed statevector failed: %v", err)
+	}
+	for i := range want {
+		if cmplx.Abs(want[i]-got[i]) > 1e-12 {
+			t.Errorf("amplitude %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestQSimRunner_ControlFlow(t *testing.T) {
+	b := builder.New(builder.Q(2), builder.C(3))
+	b.H(0).Measure(0, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(0) })
+	b.Measure(0, 1)
+	b.RepeatUntil(builder.Bit(2), 40, func(b builder.Builder) {
+		b.H(1).Measure(1, 2)
+	})
+	c, err := b.BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+
+	runner := NewQSimRunner()
+	if err := runner.ValidateCircuit(c); err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 256, Runner: runner})
+	hist, err := sim.Run(c)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Result strings list cbit 0 first: c0 c1 c2.
+	for k := range hist {
+		if k != "001" && k != "101" {
+			t.Errorf("Unexpected outcome %s: reset qubit must read 0 and the loop must exit on 1", k)
+		}
+	}
+	if _, err := runner.GetStatevector(c); err == nil {
+		t.Error("Expected GetStatevector to reject a circuit with control flow")
+	}
+}
+
+func TestQSimRunner_PhaseGates(t *testing.T) {
+	theta := 0.7
+	// P(θ)·P(θ) on |1⟩ and CP(θ) on |11⟩ should multiply |11⟩ by e^{3iθ}.
+	c, err := builder.New(builder.Q(2)).X(0).X(1).P(theta, 0).P(theta, 1).CP(theta, 0, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	sv, err := NewQSimRunner().GetStatevector(c)
+	if err != nil {
+		t.Fatalf("GetStatevector failed: %v", err)
+	}
+	want := cmplx.Exp(complex(0, 3*theta))
+	if cmplx.Abs(sv[3]-want) > 1e-12 {
+		t.Errorf("amplitude of |11⟩: got %v, want %v", sv[3], want)
+	}
+}
+
+func TestQSimRunner_Rotations(t *testing.T) {
+	theta := 0.9
+	c, s := math.Cos(theta/2), math.Sin(theta/2)
+	cases := []struct {
+		name string
+		b    builder.Builder
+		want []complex128
+	}{
+		{"RX", builder.New(builder.Q(1)).RX(theta, 0), []complex128{complex(c, 0), complex(0, -s)}},
+		{"RY", builder.New(builder.Q(1)).RY(theta, 0), []complex128{complex(c, 0), complex(s, 0)}},
+		{"RZ", builder.New(builder.Q(1)).X(0).RZ(theta, 0), []complex128{0, cmplx.Exp(complex(0, theta/2))}},
+	}
+	for _, tc := range cases {
+		circ, err := tc.b.BuildCircuit()
+		if err != nil {
+			t.Fatalf("%s: failed to build circuit: %v", tc.name, err)
+		}
+		sv, err := NewQSimRunner().GetStatevector(circ)
+		if err != nil {
+			t.Fatalf("%s: GetStatevector failed: %v", tc.name, err)
+		}
+		for i, w := range tc.want {
+			if cmplx.Abs(sv[i]-w) > 1e-12 {
+				t.Errorf("%s: amplitude %d: got %v, want %v", tc.name, i, sv[i], w)
+			}
+		}
+	}
+}
+
+// TestQSimRunner_Fredkin compares FREDKIN with its decomposition
+// CNOT(t2,t1)·TOFFOLI(c,t1,t2)·CNOT(t2,t1) on a state with every amplitude
+// non-zero and distinct, for every ordering of the qubits. FREDKIN used to
+// swap each amplitude pair twice and so act as the identity.
+func TestQSimRunner_Fredkin(t *testing.T) {
+	for _, qs := range [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}} {
+		prep := func() builder.Builder {
+			return builder.New(builder.Q(3)).RY(0.4, 0).RY(1.1, 1).RY(2.3, 2).RX(0.8, 0).CNOT(2, 0)
+		}
+		got, err := prep().Fredkin(qs[0], qs[1], qs[2]).BuildCircuit()
+		if err != nil {
+			t.Fatalf("Failed to build circuit: %v", err)
+		}
+		want, err := prep().CNOT(qs[2], qs[1]).Toffoli(qs[0], qs[1], qs[2]).CNOT(qs[2], qs[1]).BuildCircuit()
+		if err != nil {
+			t.Fatalf("Failed to build circuit: %v", err)
+		}
+		gotSV, err := NewQSimRunner().GetStatevector(got)
+		if err != nil {
+			t.Fatalf("GetStatevector failed: %v", err)
+		}
+		wantSV, err := NewQSimRunner().GetStatevector(want)
+		if err != nil {
+			t.Fatalf("GetStatevector failed: %v", err)
+		}
+		for i := range wantSV {
+			if cmplx.Abs(gotSV[i]-wantSV[i]) > 1e-12 {
+				t.Errorf("FREDKIN%v: amplitude %d: got %v, want %v", qs, i, gotSV[i], wantSV[i])
+			}
+		}
+	}
+}
+
+// svOnly hides NewStepper so simulator.NewStepper falls back to prefixes.
+type svOnly struct{ r *QSimRunner }
+
+func (s svOnly) RunOnce(c circuit.Circuit) (string, error) { return s.r.RunOnce(c) }
+func (s svOnly) GetStatevector(c circuit.Circuit) ([]complex128, error) {
+	return s.r.GetStatevector(c)
+}
+
+func TestStepper(t *testing.T) {
+	c, err := builder.New(builder.Q(3), builder.C(3)).
+		H(0).CNOT(0, 1).CNOT(1, 2).Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	// Probability of |000⟩ after each layer; the last layer only measures.
+	want := []float64{0.5, 0.5, 0.5, 0.5}
+
+	for name, runner := range map[string]simulator.OneShotRunner{"native": NewQSimRunner(), "prefix": svOnly{NewQSimRunner()}} {
+		st, err := simulator.NewStepper(runner, c)
+		if err != nil {
+			t.Fatalf("%s: NewStepper failed: %v", name, err)
+		}
+		if st.Layers() != c.Depth() || st.Probabilities()[0] != 1 {
+			t.Fatalf("%s: bad initial stepper: %d layers, P(000)=%v", name, st.Layers(), st.Probabilities()[0])
+		}
+		for i, p := range want {
+			ops, err := st.Step()
+			if err != nil {
+				t.Fatalf("%s: step %d failed: %v", name, i, err)
+			}
+			if len(ops) == 0 || st.Layer() != i+1 {
+				t.Errorf("%s: step %d applied %d ops, layer %d", name, i, len(ops), st.Layer())
+			}
+			if got := st.Probabilities()[0]; math.Abs(got-p) > 1e-12 {
+				t.Errorf("%s: step %d: P(000) = %v, want %v", name, i, got, p)
+			}
+		}
+		if got := st.Statevector()[7]; cmplx.Abs(got-complex(1/math.Sqrt2, 0)) > 1e-12 {
+			t.Errorf("%s: final amplitude of |111⟩ = %v", name, got)
+		}
+		if _, err := st.Step(); err != simulator.ErrStepperDone {
+			t.Errorf("%s: expected ErrStepperDone, got %v", name, err)
+		}
+	}
+
+	mid, _ := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).H(0).BuildCircuit()
+	if _, err := simulator.NewStepper(NewQSimRunner(), mid); err == nil {
+		t.Error("mid-circuit measurement should be rejected")
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	// Two rounds measured into the same cbit: the final register only keeps
+	// the second outcome, the events keep both.
+	c, err := builder.New(builder.Q(2), builder.C(1)).
+		H(0).Measure(0, 0).CNOT(0, 1).H(0).Measure(0, 0).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	const shots = 2000
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: shots, Runner: NewQSimRunner()})
+	res, err := sim.RunEvents(c)
+	if err != nil {
+		t.Fatalf("RunEvents failed: %v", err)
+	}
+	if len(res.Events) != 2 || res.Events[0].Cbit != 0 || res.Events[1].TimeStep <= res.Events[0].TimeStep {
+		t.Fatalf("unexpected events %+v", res.Events)
+	}
+	if len(res.Counts) != 2 || res.Counts["0"]+res.Counts["1"] != shots {
+		t.Errorf("final counts should only cover cbit 0: %v", res.Counts)
+	}
+	ev := res.EventCounts()
+	total := 0
+	for _, k := range []string{"00", "01", "10", "11"} {
+		total += ev[k]
+		if ev[k] < shots/4-150 || ev[k] > shots/4+150 {
+			t.Errorf("event %s: %d shots, want about %d", k, ev[k], shots/4)
+		}
+	}
+	if total != shots {
+		t.Errorf("event counts cover %d shots, want %d", total, shots)
+	}
+
+	plain, err := sim.RunResult(c)
+	if err != nil {
+		t.Fatalf("RunResult failed: %v", err)
+	}
+	if plain.EventCounts() != nil {
+		t.Error("RunResult should not record events")
+	}
+}
+
+func TestTaperedRunMatches(t *testing.T) {
+	// Qubit 1 is idle and qubit 2 only sees phases; both are tapered away.
+	// The second circuit measures mid-circuit, so it is run shot by shot.
+	terminal, err := builder.New(builder.Q(3), builder.C(3)).
+		X(0).Z(2).CZ(2, 0).Measure(0, 0).Measure(2, 2).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	midCircuit, err := builder.New(builder.Q(3), builder.C(3)).
+		X(0).Z(2).Measure(0, 0).CZ(2, 0).X(0).Measure(2, 2).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	for _, noTaper := range []bool{false, true} {
+		sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 50, Runner: NewQSimRunner(), NoTaper: noTaper})
+		for name, c := range map[string]circuit.Circuit{"terminal": terminal, "mid-circuit": midCircuit} {
+			hist, err := sim.Run(c)
+			if err != nil {
+				t.Fatalf("%s (NoTaper=%v) failed: %v", name, noTaper, err)
+			}
+			if hist["10"] != 50 {
+				t.Errorf("%s (NoTaper=%v): got %v, want all shots on 10", name, noTaper, hist)
+			}
+		}
+	}
+}
+
+func TestLightConeRunMatches(t *testing.T) {
+	// Only q0 and q1 reach the measurement; the entangled q2..q4 and the
+	// trailing H on q0 are outside the light cone.
+	c, err := builder.New(builder.Q(5), builder.C(1)).
+		X(1).H(2).CNOT(2, 3).CNOT(3, 4).CNOT(1, 0).Measure(0, 0).H(0).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	for _, off := range []bool{false, true} {
+		sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 50, Runner: NewQSimRunner(), NoLightCone: off})
+		for name, run := range map[string]func(circuit.Circuit) (map[string]int, error){"Run": sim.Run, "RunSerial": sim.RunSerial} {
+			hist, err := run(c)
+			if err != nil {
+				t.Fatalf("%s (NoLightCone=%v) failed: %v", name, off, err)
+			}
+			if hist["1"] != 50 {
+				t.Errorf("%s (NoLightCone=%v): got %v, want all shots on 1", name, off, hist)
+			}
+		}
+	}
+}
+
+func TestWideCircuit(t *testing.T) {
+	// 100 qubits, of which only q0 and q99 are used: the reduced circuit
+	// fits in a statevector, the full one does not.
+	c, err := builder.New(builder.Q(100), builder.C(2)).
+		H(0).CNOT(0, 99).Measure(0, 0).Measure(99, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 100, Runner: NewQSimRunner()})
+	hist, err := sim.Run(c)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if hist["00"]+hist["11"] != 100 {
+		t.Errorf("got %v, want only 00 and 11", hist)
+	}
+
+	sim = simulator.NewSimulator(simulator.SimulatorOptions{Shots: 10, Runner: NewQSimRunner(),
+		NoTaper: true, NoLightCone: true})
+	for name, run := range map[string]func(circuit.Circuit) (map[string]int, error){"Run": sim.Run, "RunSerial": sim.RunSerial} {
+		var werr *simulator.WidthError
+		if _, err := run(c); !errors.As(err, &werr) || werr.Qubits != 100 {
+			t.Errorf("%s: got error %v, want a WidthError for 100 qubits", name, err)
+		}
+	}
+	if _, err := sim.GetStatevector(c); err == nil {
+		t.Error("GetStatevector of 100 qubits succeeded")
+	}
+}
+
+func TestInitializeRun(t *testing.T) {
+	// W state on qubits 0..2: each of 100, 010, 001 with probability 1/3.
+	s := complex(1/math.Sqrt(3), 0)
+	c, err := builder.New(builder.Q(3), builder.C(3)).
+		Initialize([]complex128{0, s, s, 0, s, 0, 0, 0}, 0, 1, 2).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 3000, Runner: NewQSimRunner()})
+	hist, err := sim.Run(c)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	for _, key := range []string{"100", "010", "001"} {
+		if n := hist[key]; n < 850 || n > 1150 {
+			t.Errorf("%s: got %d of 3000 shots, want about 1000 (%v)", key, n, hist)
+		}
+	}
+	if len(hist) != 3 {
+		t.Errorf("got outcomes %v, want only the three W-state terms", hist)
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	build := func(t *testing.T, extra bool) *circuit.Stream {
+		store, err := circuit.NewFileStore(filepath.Join(t.TempDir(), "ops"))
+		if err != nil {
+			t.Fatalf("NewFileStore failed: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		s := circuit.NewStream(3, 3, store)
+		ops := []dag.Op{
+			{G: gate.H(), Qubits: []int{0}},
+			{G: gate.CNOT(), Qubits: []int{0, 1}},
+			{G: gate.CNOT(), Qubits: []int{1, 2}},
+			{G: gate.Measure(), Qubits: []int{0}, Cbit: 0},
+			{G: gate.Measure(), Qubits: []int{2}, Cbit: 2},
+		}
+		if extra {
+			// Flip q2 after measuring it and record it again in cbit 1.
+			ops = append(ops, dag.Op{G: gate.X(), Qubits: []int{2}}, dag.Op{G: gate.Measure(), Qubits: []int{2}, Cbit: 1})
+		}
+		for _, op := range ops {
+			if _, err := s.Append(op); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+		}
+		return s
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 200, Runner: NewQSimRunner()})
+
+	hist, err := sim.RunStream(build(t, false))
+	if err != nil {
+		t.Fatalf("RunStream failed: %v", err)
+	}
+	if hist["00"]+hist["11"] != 200 || hist["00"] == 0 || hist["11"] == 0 {
+		t.Errorf("terminal stream: got %v, want GHZ outcomes 00 and 11", hist)
+	}
+
+	hist, err = sim.RunStream(build(t, true))
+	if err != nil {
+		t.Fatalf("RunStream failed: %v", err)
+	}
+	if hist["010"]+hist["101"] != 200 || hist["010"] == 0 || hist["101"] == 0 {
+		t.Errorf("replayed stream: got %v, want outcomes 010 and 101", hist)
+	}
+
+	sv, err := NewQSimRunner().StreamStatevector(build(t, false))
+	if err != nil {
+		t.Fatalf("StreamStatevector failed: %v", err)
+	}
+	if math.Abs(real(sv[0])-1/math.Sqrt2) > 1e-9 || math.Abs(real(sv[7])-1/math.Sqrt2) > 1e-9 {
+		t.Errorf("StreamStatevector: got %v, want GHZ", sv)
+	}
+}
+
+func TestStatePooling(t *testing.T) {
+	// The X after the measurement rules out statevector sampling, so every
+	// shot runs on its own state.
+	c, err := builder.New(builder.Q(3), builder.C(2)).
+		H(0).CNOT(0, 1).Measure(0, 0).X(0).Measure(0, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 1000, Workers: 2, Runner: NewQSimRunner()})
+	res, err := sim.RunResult(c)
+	if err != nil {
+		t.Fatalf("RunResult failed: %v", err)
+	}
+	if res.Counts["01"]+res.Counts["10"] != 1000 {
+		t.Errorf("got %v, want outcomes 01 and 10 only", res.Counts)
+	}
+	if res.Alloc == nil {
+		t.Fatal("Result.Alloc is nil for the qsim runner")
+	}
+	if n := res.Alloc.StateAllocs + res.Alloc.StateReuses; n != 1000 {
+		t.Errorf("states allocated plus reused = %d, want one per shot", n)
+	}
+	if res.Alloc.StateReuses == 0 {
+		t.Errorf("no state was reused: %+v", *res.Alloc)
+	}
+}
+
+func TestSeededRuns(t *testing.T) {
+	// The X after the first measurement forces per-shot runs.
+	c, err := builder.New(builder.Q(3), builder.C(3)).
+		H(0).H(1).CNOT(1, 2).Measure(0, 0).X(0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	newSim := func(seed int64, workers int) *simulator.Simulator {
+		return simulator.NewSimulator(simulator.SimulatorOptions{
+			Shots: 500, Workers: workers, Runner: NewQSimRunner(), Seed: seed, ChunkShots: 50})
+	}
+
+	ref, err := newSim(7, 1).RunChunks(c)
+	if err != nil {
+		t.Fatalf("RunChunks failed: %v", err)
+	}
+	if len(ref) != 10 {
+		t.Fatalf("got %d chunks, want 10", len(ref))
+	}
+	got, err := newSim(7, 8).RunChunks(c)
+	if err != nil {
+		t.Fatalf("RunChunks failed: %v", err)
+	}
+	for i := range ref {
+		if ref[i].Seed != got[i].Seed || !maps.Equal(ref[i].Counts, got[i].Counts) {
+			t.Errorf("chunk %d differs between 1 and 8 workers: %+v vs %+v", i, ref[i], got[i])
+		}
+	}
+
+	runs := map[string]func(*simulator.Simulator) (map[string]int, error){
+		"Run":       func(s *simulator.Simulator) (map[string]int, error) { return s.Run(c) },
+		"RunSerial": func(s *simulator.Simulator) (map[string]int, error) { return s.RunSerial(c) },
+		"RunNoisy": func(s *simulator.Simulator) (map[string]int, error) {
+			return s.RunNoisy(c, simulator.NoiseModel{Depolarizing: 0.1, Readout: 0.05})
+		},
+	}
+	for name, run := range runs {
+		a, err := run(newSim(7, 1))
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		b, err := run(newSim(7, 6))
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if !maps.Equal(a, b) {
+			t.Errorf("%s with the same seed: %v vs %v", name, a, b)
+		}
+		other, err := run(newSim(8, 6))
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if maps.Equal(a, other) {
+			t.Errorf("%s: seeds 7 and 8 gave the same histogram %v", name, a)
+		}
+	}
+}
+
+func TestRunFrom(t *testing.T) {
+	// Prepare a Bell pair once, then measure it in two bases.
+	prep, err := builder.New(builder.Q(2)).H(0).CNOT(0, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 400, Workers: 3, Runner: NewQSimRunner()})
+	bell, err := sim.GetStatevector(prep)
+	if err != nil {
+		t.Fatalf("GetStatevector failed: %v", err)
+	}
+
+	zz, err := builder.New(builder.Q(2), builder.C(2)).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	// X basis, with a gate after a measurement so every shot replays.
+	xx, err := builder.New(builder.Q(2), builder.C(2)).H(0).H(1).Measure(0, 0).Measure(1, 1).X(0).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	for name, c := range map[string]circuit.Circuit{"ZZ": zz, "XX": xx} {
+		hist, err := sim.RunFrom(bell, c)
+		if err != nil {
+			t.Fatalf("%s: RunFrom failed: %v", name, err)
+		}
+		if hist["00"]+hist["11"] != 400 || hist["00"] == 0 || hist["11"] == 0 {
+			t.Errorf("%s: got %v, want correlated outcomes 00 and 11", name, hist)
+		}
+	}
+
+	if _, err := sim.RunFrom(bell[:2], zz); err == nil {
+		t.Error("RunFrom accepted a state of the wrong size")
+	}
+	if _, err := sim.RunFrom([]complex128{1, 1, 0, 0}, zz); err == nil {
+		t.Error("RunFrom accepted an unnormalised state")
+	}
+	rounded := []complex128{0.7071, 0, 0, 0.7071}
+	if _, err := sim.RunFrom(rounded, zz); err == nil {
+		t.Error("RunFrom accepted a state rounded to 4 digits at the default tolerance")
+	}
+	loose := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 10, Runner: NewQSimRunner(), Tolerance: 1e-3})
+	if _, err := loose.RunFrom(rounded, zz); err != nil {
+		t.Errorf("RunFrom with tolerance 1e-3: %v", err)
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	// RY(2·1e-4) leaves P(1) = sin²(1e-4) ≈ 1e-8, above the default pruning
+	// tolerance of 1e-10 and below a configured 1e-6.
+	c, err := builder.New(builder.Q(1)).RY(2e-4, 0).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	runner := NewQSimRunner()
+	probs, err := runner.GetResultProbabilities(c)
+	if err != nil {
+		t.Fatalf("GetResultProbabilities failed: %v", err)
+	}
+	if len(probs) != 2 {
+		t.Errorf("got %v, want both outcomes", probs)
+	}
+	// The simulator's norm tolerance is its own and leaves the runner alone.
+	simulator.NewSimulator(simulator.SimulatorOptions{Runner: runner, Tolerance: 1e-6})
+	if probs, _ = runner.GetResultProbabilities(c); len(probs) != 2 {
+		t.Errorf("got %v after NewSimulator, want both outcomes", probs)
+	}
+	if err := runner.Configure(map[string]any{"prune_tolerance": 1e-6}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if got := runner.GetConfiguration()["prune_tolerance"]; got != 1e-6 {
+		t.Errorf("prune_tolerance option is %v, want 1e-6", got)
+	}
+	if probs, _ = runner.GetResultProbabilities(c); len(probs) != 1 {
+		t.Errorf("got %v, want the outcome 1 pruned", probs)
+	}
+	if err := runner.Configure(map[string]any{"prune_tolerance": -1.0}); err == nil {
+		t.Error("Configure accepted a negative prune_tolerance")
+	}
+}
+
+func TestRunMixed(t *testing.T) {
+	measure, err := builder.New(builder.Q(2), builder.C(2)).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 4000, Workers: 3, Seed: 5, Runner: NewQSimRunner()})
+
+	// Qubit 0 at βω = ln 3 is excited a quarter of the time; qubit 1 is
+	// frozen in its ground state.
+	if _, err := simulator.ThermalState(1, []float64{math.Log(3), math.Inf(1)}); err == nil {
+		t.Fatal("ThermalState accepted an infinite frequency")
+	}
+	thermal, err := simulator.ThermalState(math.Log(3), []float64{1, 100})
+	if err != nil {
+		t.Fatalf("ThermalState failed: %v", err)
+	}
+	hist, err := sim.RunMixed(thermal, measure)
+	if err != nil {
+		t.Fatalf("RunMixed failed: %v", err)
+	}
+	if hist["00"]+hist["10"] != 4000 || math.Abs(float64(hist["10"])/4000-0.25) > 0.03 {
+		t.Errorf("thermal: got %v, want 10 a quarter of the time", hist)
+	}
+	again, err := sim.RunMixed(thermal, measure)
+	if err != nil {
+		t.Fatalf("RunMixed failed: %v", err)
+	}
+	if !maps.Equal(hist, again) {
+		t.Errorf("same seed gave %v and %v", hist, again)
+	}
+
+	// An equal mixture of the Bell states Φ+ and Φ- is classically
+	// correlated: H on both qubits decorrelates it, unlike either state.
+	r := complex(1/math.Sqrt2, 0)
+	mix := simulator.Mixture{
+		Weights: []float64{0.5, 0.5},
+		States:  [][]complex128{{r, 0, 0, r}, {r, 0, 0, -r}},
+	}
+	xx, err := builder.New(builder.Q(2), builder.C(2)).H(0).H(1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+	hist, err = sim.RunMixed(mix, xx)
+	if err != nil {
+		t.Fatalf("RunMixed failed: %v", err)
+	}
+	for _, k := range []string{"00", "01", "10", "11"} {
+		if math.Abs(float64(hist[k])/4000-0.25) > 0.03 {
+			t.Errorf("Bell mixture: got %v, want uniform outcomes", hist)
+			break
+		}
+	}
+
+	if _, err := sim.RunMixed(simulator.Mixture{Weights: []float64{0.5, 0.5}}, measure); err == nil {
+		t.Error("RunMixed accepted a diagonal mixture of the wrong size")
+	}
+	if _, err := sim.RunMixed(simulator.Mixture{Weights: []float64{0.5, 0.6}, States: mix.States}, measure); err == nil {
+		t.Error("RunMixed accepted weights that do not sum to 1")
+	}
+}
+
+func TestQSimRunner_RepeatUntilAttempts(t *testing.T) {
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.RepeatUntil(builder.Bit(0), 3, func(b builder.Builder) {
+		b.H(0).Measure(0, 0)
+	})
+	b.RepeatUntil(builder.Bit(1), 20, func(b builder.Builder) {
+		b.H(1).Measure(1, 1)
+	})
+	c, err := b.BuildCircuit()
+	if err != nil {
+		t.Fatalf("Failed to build circuit: %v", err)
+	}
+
+	const shots = 4000
+	runner := NewQSimRunner()
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: shots, Runner: runner, Seed: 9})
+	res, err := sim.RunAttempts(c)
+	if err != nil {
+		t.Fatalf("RunAttempts failed: %v", err)
+	}
+	if runner.loops != nil {
+		t.Error("RunAttempts left a loop observer on the runner")
+	}
+	if len(res.Attempts) != 2 {
+		t.Fatalf("Expected 2 loops, got %d", len(res.Attempts))
+	}
+	for k := range res.Counts {
+		if len(k) != 2 {
+			t.Errorf("Key %q should only hold the circuit's own cbits", k)
+		}
+	}
+
+	// Each attempt succeeds with probability ½: P(k) = 2^-k below the
+	// bound, and the bound takes the rest.
+	first := res.Attempts[0]
+	if first.Max != 3 {
+		t.Errorf("Expected bound 3, got %d", first.Max)
+	}
+	for k, want := range map[int]float64{1: 0.5, 2: 0.25, 3: 0.25} {
+		if got := float64(first.Counts[k]) / shots; math.Abs(got-want) > 0.03 {
+			t.Errorf("P(%d attempts) = %.3f, want %.3f", k, got, want)
+		}
+	}
+	second := res.Attempts[1]
+	for k := range second.Counts {
+		if k < 1 || k > 20 {
+			t.Errorf("Attempt count %d out of range", k)
+		}
+	}
+	if m := second.Mean(); math.Abs(m-2) > 0.1 {
+		t.Errorf("Mean attempts %.3f, want about 2", m)
+	}
+	// The first loop gives up in 1/8 of the shots, the second practically never.
+	if got := float64(res.Counts["01"]) / shots; math.Abs(got-0.125) > 0.03 {
+		t.Errorf("Expected 1/8 of the shots to exhaust the first loop, got %v", res.Counts)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 1, Runner: NewQSimRunner()})
+
+	h, _ := builder.New(builder.Q(1), builder.C(1)).H(0).Measure(0, 0).BuildCircuit()
+	p, err := sim.Process(h, simulator.NoiseModel{Readout: 0.3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// H maps X to Z, Z to X and Y to −Y.
+	want := [4][4]float64{{1, 0, 0, 0}, {0, 0, 0, 1}, {0, 0, -1, 0}, {0, 1, 0, 0}}
+	for i := range 4 {
+		for j := range 4 {
+			if math.Abs(p.PTM[i][j]-want[i][j]) > 1e-12 {
+				t.Errorf("H: PTM[%s][%s] = %v, want %v", simulator.PauliLabel(i, 1), simulator.PauliLabel(j, 1), p.PTM[i][j], want[i][j])
+			}
+		}
+	}
+
+	// A depolarized X: χ has 1−p on X and p/3 on the other Paulis.
+	x, _ := builder.New(builder.Q(1), builder.C(0)).X(0).BuildCircuit()
+	const prob = 0.09
+	ideal, err := sim.Process(x, simulator.NoiseModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noisy, err := sim.Process(x, simulator.NoiseModel{Depolarizing: prob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chi := noisy.Chi()
+	for a, want := range []float64{prob / 3, 1 - prob, prob / 3, prob / 3} {
+		if cmplx.Abs(chi[a][a]-complex(want, 0)) > 1e-12 {
+			t.Errorf("χ[%s][%s] = %v, want %v", simulator.PauliLabel(a, 1), simulator.PauliLabel(a, 1), chi[a][a], want)
+		}
+	}
+	if f, _ := noisy.AverageGateFidelity(ideal); math.Abs(f-(1-2*prob/3)) > 1e-12 {
+		t.Errorf("average gate fidelity = %v, want %v", f, 1-2*prob/3)
+	}
+
+	// A two-qubit circuit is exactly itself and loses fidelity under noise.
+	bell, _ := builder.New(builder.Q(2), builder.C(0)).H(0).CNOT(0, 1).RY(0.4, 1).CP(1.1, 1, 0).BuildCircuit()
+	ideal, err = sim.Process(bell, simulator.NoiseModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := ideal.ProcessFidelity(ideal); math.Abs(f-1) > 1e-9 {
+		t.Errorf("ideal process fidelity = %v, want 1", f)
+	}
+	tr := complex(0, 0)
+	for a, row := range ideal.Chi() {
+		tr += row[a]
+	}
+	if cmplx.Abs(tr-1) > 1e-9 {
+		t.Errorf("Tr χ = %v, want 1", tr)
+	}
+	noisy, err = sim.Process(bell, simulator.NoiseModel{Depolarizing: 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := noisy.ProcessFidelity(ideal); f >= 0.99 || f < 0.7 {
+		t.Errorf("noisy process fidelity = %v", f)
+	}
+
+	wide, _ := builder.New(builder.Q(5), builder.C(0)).H(0).BuildCircuit()
+	if _, err := sim.Process(wide, simulator.NoiseModel{}); err == nil {
+		t.Error("expected an error for a 5-qubit process")
+	}
+	if _, err := noisy.ProcessFidelity(p); err == nil {
+		t.Error("expected an error comparing 2- and 1-qubit processes")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	c, _ := builder.New(builder.Q(3), builder.C(3)).H(0).CNOT(0, 1).CNOT(1, 2).RY(0.3, 2).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+
+	runner := NewQSimRunner()
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 200, Runner: runner, Profile: true})
+	res, err := sim.RunResult(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Profile == nil {
+		t.Fatal("expected a profile")
+	}
+	gates := res.Profile.Gates()
+	for _, name := range []string{"H", "CNOT", "RY"} {
+		if gates[name].Count == 0 {
+			t.Errorf("no %s recorded: %v", name, gates)
+		}
+	}
+	if gates["CNOT"].Count != 2*gates["H"].Count {
+		t.Errorf("CNOT count %d, want twice H's %d", gates["CNOT"].Count, gates["H"].Count)
+	}
+	if len(res.Profile.Layers()) < 4 {
+		t.Errorf("layers = %v, want at least 4", res.Profile.Layers())
+	}
+	table := res.Profile.Table()
+	for _, s := range []string{"GATE", "CNOT", "LAYER"} {
+		if !strings.Contains(table, s) {
+			t.Errorf("table lacks %q:\n%s", s, table)
+		}
+	}
+
+	// The runner itself is left unprofiled, and shot-by-shot execution is
+	// profiled too.
+	if runner.profiler != nil {
+		t.Error("profiler left installed")
+	}
+	mid, _ := builder.New(builder.Q(1), builder.C(2)).H(0).Measure(0, 0).H(0).Measure(0, 1).BuildCircuit()
+	res, err = sim.RunResult(mid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := res.Profile.Gates(); g["H"].Count != 2*200 || g["MEASURE"].Count != 2*200 {
+		t.Errorf("per-shot profile = %v", g)
+	}
+
+	// Concurrent runs on one runner each profile their own operations.
+	hs, _ := builder.New(builder.Q(1), builder.C(1)).H(0).Measure(0, 0).H(0).Measure(0, 0).BuildCircuit()
+	xs, _ := builder.New(builder.Q(1), builder.C(1)).X(0).Measure(0, 0).X(0).Measure(0, 0).BuildCircuit()
+	var wg sync.WaitGroup
+	profiles := make([]*simulator.Profile, 2)
+	for i, circ := range []circuit.Circuit{hs, xs} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := sim.RunResult(circ)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			profiles[i] = res.Profile
+		}()
+	}
+	wg.Wait()
+	for i, only := range []string{"H", "X"} {
+		if profiles[i] == nil {
+			continue
+		}
+		for name := range profiles[i].Gates() {
+			if name != only && name != "MEASURE" {
+				t.Errorf("profile of the %s circuit records %s", only, name)
+			}
+		}
+	}
+
+	sim.Profile = false
+	if res, _ := sim.RunResult(c); res.Profile != nil {
+		t.Error("unexpected profile")
+	}
+}
+
+func TestHook(t *testing.T) {
+	const shots = 100
+	c, err := builder.New(builder.Q(2), builder.C(2)).
+		H(0).Measure(0, 0).
+		If(builder.Bit(0), func(b builder.Builder) { b.X(1) }).
+		Measure(1, 1).BuildCircuit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	seen := map[int][]string{}
+	runner := NewQSimRunner()
+	runner.SetHook(simulator.OpHookFunc(func(op circuit.Operation, shot int) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[shot] = append(seen[shot], op.G.Name())
+	}))
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: shots, Runner: runner})
+	if _, err := sim.Run(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every shot reports its operations in order; the X only when applied.
+	if len(seen) != shots {
+		t.Fatalf("%d shots reported, want %d", len(seen), shots)
+	}
+	flips := 0
+	for shot := range shots {
+		switch got := strings.Join(seen[shot], " "); got {
+		case "H MEASURE X MEASURE":
+			flips++
+		case "H MEASURE MEASURE":
+		default:
+			t.Fatalf("shot %d reported %q", shot, got)
+		}
+	}
+	if flips == 0 || flips == shots {
+		t.Errorf("X applied in %d of %d shots", flips, shots)
+	}
+
+	// Statevectors are computed outside any shot.
+	clear(seen)
+	bell, _ := builder.New(builder.Q(2)).H(0).CNOT(0, 1).BuildCircuit()
+	if _, err := runner.GetStatevector(bell); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(seen[-1], " "); len(seen) != 1 || got != "H CNOT" {
+		t.Errorf("statevector reported %v", seen)
+	}
+
+	runner.SetHook(nil)
+	clear(seen)
+	if _, err := sim.Run(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 0 {
+		t.Errorf("removed hook still called: %v", seen)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	b := builder.New(builder.Q(22), builder.C(22))
+	for q := range 22 {
+		b.H(q).Measure(q, q)
+	}
+	c, err := b.BuildCircuit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 10, Runner: NewQSimRunner()})
+	r, err := sim.Validate(c)
+	if err == nil || !strings.Contains(err.Error(), "too many qubits") {
+		t.Errorf("err = %v, want qsim's qubit limit", err)
+	}
+	if r.Runner != "qsim" || !r.Sampled || r.Time <= 0 {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestRunHybrid(t *testing.T) {
+	// The callback copies m[0] into m[1], which controls the X on qubit 1;
+	// conditions on a register follow every measurement into it, so the X
+	// comes after the callback. m[1] is never measured but shows up in the
+	// keys.
+	c, err := builder.New(builder.Q(2), builder.CReg("m", 2), builder.CReg("out", 1)).
+		H(0).Measure(0, 0).
+		If(builder.Bit(1), func(b builder.Builder) { b.X(1) }).
+		Measure(1, 2).BuildCircuit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int64
+	cbs := map[string]simulator.Callback{"m": func(v uint64) uint64 {
+		calls.Add(1)
+		return v | (v&1)<<1
+	}}
+
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 300, Runner: NewQSimRunner(), Seed: 3})
+	hist, err := sim.RunHybrid(c, cbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hist["000"]+hist["111"] != 300 || hist["000"] == 0 || hist["111"] == 0 {
+		t.Errorf("histogram = %v, want only 000 and 111", hist)
+	}
+	if calls.Load() != 300 {
+		t.Errorf("callback called %d times, want once per shot", calls.Load())
+	}
+	again, err := sim.RunHybrid(c, cbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(hist, again) {
+		t.Errorf("seeded runs differ: %v vs %v", hist, again)
+	}
+
+	sim.Seed = 0
+	if hist, err := sim.RunHybrid(c, cbs); err != nil || hist["000"]+hist["111"] != 300 {
+		t.Errorf("unseeded run = %v, %v", hist, err)
+	}
+	if _, err := sim.RunHybrid(c, map[string]simulator.Callback{"nope": nil}); err == nil ||
+		!strings.Contains(err.Error(), `unknown register "nope"`) {
+		t.Errorf("unknown register: err = %v", err)
+	}
+}
+
+// opaqueGate is a gate qsim has no kernel for.
+type opaqueGate struct{}
+
+func (opaqueGate) Name() string       { return "FOO" }
+func (opaqueGate) QubitSpan() int     { return 1 }
+func (opaqueGate) DrawSymbol() string { return "F" }
+func (opaqueGate) Targets() []int     { return []int{0} }
+func (opaqueGate) Controls() []int    { return []int{} }
+
+func TestUnsupportedGate(t *testing.T) {
+	c, err := builder.New(builder.Q(2), builder.C(2)).
+		H(0).CNOT(0, 1).Apply(opaqueGate{}, 1).Measure(1, 1).BuildCircuit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewQSimRunner()
+	check := func(what string, err error) {
+		t.Helper()
+		var ue *simulator.UnsupportedGateError
+		if !errors.As(err, &ue) {
+			t.Fatalf("%s: want an UnsupportedGateError, got %v", what, err)
+		}
+		if ue.Runner != "qsim" || ue.Gate != "FOO" || ue.Op != 2 || fmt.Sprint(ue.Qubits) != "[1]" {
+			t.Errorf("%s: %+v", what, *ue)
+		}
+	}
+	_, err = runner.RunOnce(c)
+	check("RunOnce", err)
+	if last := runner.GetMetrics().LastError; !strings.Contains(last, "at operation 2") {
+		t.Errorf("last error %q", last)
+	}
+	_, err = runner.GetStatevector(c)
+	check("GetStatevector", err)
+	check("ValidateCircuit", runner.ValidateCircuit(c))
+}
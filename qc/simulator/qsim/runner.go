@@ -4,7 +4,9 @@ package qsim
 import (
 	"context"
 	"fmt"
+	"iter"
 	"maps"
+	"math/rand"
 	"strings"
 	"time"
 
@@ -16,7 +18,7 @@ import (
 
 // Supported gates for the QSim backend
 var supportedGates = []string{
-	"H", "X", "Y", "Z", "S", "CNOT", "CZ", "SWAP", "TOFFOLI", "FREDKIN", "MEASURE",
+	"H", "X", "Y", "Z", "S", "P", "RX", "RY", "RZ", "CNOT", "CZ", "CP", "SWAP", "TOFFOLI", "FREDKIN", "MEASURE",
 }
 
 // OneShotRunner implementation
@@ -26,6 +28,88 @@ func (r *QSimRunner) RunOnce(c circuit.Circuit) (string, error) {
 
 // ContextualRunner implementation
 func (r *QSimRunner) RunOnceWithContext(ctx context.Context, c circuit.Circuit) (string, error) {
+	state, err := r.shot(ctx, c, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer releaseState(state)
+
+	// Convert classical bits to result string
+	result := r.formatResult(state.classicalBits)
+
+	if r.verbose {
+		fmt.Printf("QSim: Circuit executed successfully, result: %s\n", result)
+	}
+
+	return result, nil
+}
+
+// RunOnceOutcome implements simulator.OutcomeRunner: the shot's classical
+// bits as an integer, cbit i in bit i, without formatting a key.
+func (r *QSimRunner) RunOnceOutcome(c circuit.Circuit) (uint64, error) {
+	if c.Clbits() > 64 {
+		return 0, fmt.Errorf("%d classical bits do not fit in a uint64 outcome", c.Clbits())
+	}
+	state, err := r.shot(context.Background(), c, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer releaseState(state)
+	var outcome uint64
+	for i, b := range state.classicalBits {
+		if b {
+			outcome |= 1 << i
+		}
+	}
+	return outcome, nil
+}
+
+// RunOnceRand implements simulator.RandRunner: measurement outcomes are
+// drawn from rng.
+func (r *QSimRunner) RunOnceRand(c circuit.Circuit, rng *rand.Rand) (string, error) {
+	state, err := r.shot(context.Background(), c, nil, rng, nil)
+	if err != nil {
+		return "", err
+	}
+	defer releaseState(state)
+	return r.formatResult(state.classicalBits), nil
+}
+
+// RunOnceHybrid implements simulator.HybridRunner.
+func (r *QSimRunner) RunOnceHybrid(c circuit.Circuit, cbs map[string]simulator.Callback, rng *rand.Rand) (string, error) {
+	bound, err := simulator.BindCallbacks(c, cbs)
+	if err != nil {
+		return "", err
+	}
+	state, err := r.shot(context.Background(), c, nil, rng, bound)
+	if err != nil {
+		return "", err
+	}
+	defer releaseState(state)
+	return r.formatResult(state.classicalBits), nil
+}
+
+// RunOnceFrom implements simulator.WarmStartRunner: the shot starts from
+// the given statevector instead of |0…0⟩.
+func (r *QSimRunner) RunOnceFrom(init []complex128, c circuit.Circuit) (string, error) {
+	if err := simulator.CheckStatevectorWidth(c.Qubits()); err != nil {
+		return "", err
+	}
+	if len(init) != 1<<c.Qubits() {
+		return "", fmt.Errorf("initial state has %d amplitudes, want %d", len(init), 1<<c.Qubits())
+	}
+	state, err := r.shot(context.Background(), c, init, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer releaseState(state)
+	return r.formatResult(state.classicalBits), nil
+}
+
+// shot runs c once from init (nil: |0…0⟩), drawing measurements from rng
+// (nil: the global source) and running callbacks after measurements, and
+// records the metrics. The caller releases the returned state.
+func (r *QSimRunner) shot(ctx context.Context, c circuit.Circuit, init []complex128, rng *rand.Rand, callbacks []simulator.BoundCallback) (*QuantumState, error) {
 	start := time.Now()
 	r.metrics.totalExecutions.Add(1)
 	r.metrics.lastRunTime.Store(start)
@@ -40,72 +124,178 @@ func (r *QSimRunner) RunOnceWithContext(ctx context.Context, c circuit.Circuit)
 	case <-ctx.Done():
 		r.metrics.failedRuns.Add(1)
 		r.metrics.lastError.Store("context cancelled")
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
+	if err := simulator.CheckStatevectorWidth(c.Qubits()); err != nil {
+		r.metrics.failedRuns.Add(1)
+		r.metrics.lastError.Store(err.Error())
+		return nil, err
+	}
 
-	// Initialize quantum state
-	state := NewQuantumState(c.Qubits(), c.Clbits())
+	// Initialize quantum state, reusing the buffers of an earlier shot
+	state := r.acquireState(c.Qubits(), c.Clbits())
+	state.rng = rng
+	state.callbacks = callbacks
+	if init != nil {
+		copy(state.amplitudes, init)
+	}
 
 	// Execute circuit operations
-	for _, op := range c.Operations() {
+	if err := execute(ctx, state, c.OpsIter()); err != nil {
+		releaseState(state)
+		r.metrics.failedRuns.Add(1)
+		if err == ctx.Err() {
+			r.metrics.lastError.Store("context cancelled during execution")
+		} else {
+			// Shots do not validate up front; if a gate failed to
+			// apply, say which operation it was.
+			if located := simulator.CheckGates("qsim", c, supportedGates); located != nil {
+				err = located
+			}
+			r.metrics.lastError.Store(err.Error())
+		}
+		return nil, err
+	}
+
+	r.metrics.successfulRuns.Add(1)
+	r.metrics.lastError.Store("")
+	return state, nil
+}
+
+// execute plays ops on state. Conditions are evaluated against the
+// classical bits measured so far; loops replay their body until the exit
+// condition holds or the bound is reached.
+// Runs of one single-qubit gate are fused (see fuser) unless a profiler or
+// hook observes every operation.
+func execute(ctx context.Context, state *QuantumState, ops iter.Seq2[int, circuit.Operation]) error {
+	f := fuser{state: state, off: state.profiler != nil || state.hook != nil}
+	for _, op := range ops {
 		// Check context cancellation during execution
 		select {
 		case <-ctx.Done():
-			r.metrics.failedRuns.Add(1)
-			r.metrics.lastError.Store("context cancelled during execution")
-			return "", ctx.Err()
+			return ctx.Err()
 		default:
 		}
 
-		if op.G.Name() == "MEASURE" {
-			// Perform measurement
-			if len(op.Qubits) != 1 {
-				err := fmt.Errorf("measurement requires exactly one qubit, got %d", len(op.Qubits))
-				r.metrics.failedRuns.Add(1)
-				r.metrics.lastError.Store(err.Error())
-				return "", err
-			}
-
-			qubit := op.Qubits[0]
-			result := state.Measure(qubit)
+		if fused, err := f.add(op); err != nil {
+			return err
+		} else if fused {
+			continue
+		}
+		if err := f.flush(); err != nil {
+			return err
+		}
+		if err := executeOp(ctx, state, op); err != nil {
+			return err
+		}
+	}
+	return f.flush()
+}
 
-			// Store classical bit if specified
-			if op.Cbit >= 0 && op.Cbit < len(state.classicalBits) {
-				state.classicalBits[op.Cbit] = result
+// executeOp plays a single operation of execute.
+func executeOp(ctx context.Context, state *QuantumState, op circuit.Operation) error {
+	bit := func(c int) bool { return state.classicalBits[c] }
+	if op.Cond != nil && !op.Cond.Eval(bit) {
+		return nil
+	}
+	if state.profiler != nil && op.Loop == nil {
+		start := time.Now()
+		defer func() { state.profiler.ObserveOp(op, time.Since(start)) }()
+	}
+	switch {
+	case op.Loop != nil:
+		runs := 0
+		for runs < op.Loop.Max {
+			runs++
+			if err := execute(ctx, state, slices.All(op.Loop.Body)); err != nil {
+				return err
 			}
-		} else {
-			// Apply quantum gate
-			if err := state.ApplyGate(op.G, op.Qubits); err != nil {
-				r.metrics.failedRuns.Add(1)
-				r.metrics.lastError.Store(err.Error())
-				return "", fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
+			if op.Loop.Until.Eval(bit) {
+				break
 			}
 		}
-	}
-
-	// Convert classical bits to result string
-	result := r.formatResult(state.classicalBits)
-
-	r.metrics.successfulRuns.Add(1)
-	r.metrics.lastError.Store("")
+		if state.loops != nil {
+			state.loops.ObserveLoop(op, runs)
+		}
+	case op.G.Name() == "MEASURE":
+		if len(op.Qubits) != 1 {
+			return fmt.Errorf("measurement requires exactly one qubit, got %d", len(op.Qubits))
+		}
+		result := state.Measure(op.Qubits[0])
 
-	if r.verbose {
-		fmt.Printf("QSim: Circuit executed successfully, result: %s\n", result)
+		// Store classical bit if specified
+		if op.Cbit >= 0 && op.Cbit < len(state.classicalBits) {
+			state.classicalBits[op.Cbit] = result
+			for _, cb := range state.callbacks {
+				cb.Written(op.Cbit, state.classicalBits)
+			}
+		}
+	default:
+		// Apply quantum gate
+		if err := state.ApplyGate(op.G, op.Qubits); err != nil {
+			return fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
+		}
+	}
+	if state.hook != nil && op.Loop == nil {
+		state.hook.OnGateApplied(op, state.shot)
 	}
+	return nil
+}
 
-	return result, nil
+// RunStream implements simulator.StreamRunner, reading the operations one
+// at a time from the stream's store.
+func (r *QSimRunner) RunStream(ctx context.Context, s *circuit.Stream) (string, error) {
+	if err := simulator.CheckStatevectorWidth(s.Qubits()); err != nil {
+		return "", err
+	}
+	state := r.acquireState(s.Qubits(), s.Clbits())
+	defer releaseState(state)
+	for op, err := range s.Ops() {
+		if err != nil {
+			return "", err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		default:
+		}
+		if err := executeOp(ctx, state, op); err != nil {
+			return "", err
+		}
+	}
+	return r.formatResult(state.classicalBits), nil
 }
 
-// formatResult converts classical bits to string representation
-func (r *QSimRunner) formatResult(bits []bool) string {
-	if len(bits) == 0 {
-		return "0" // Default result for circuits without measurements
+// StreamStatevector implements simulator.StreamRunner.
+func (r *QSimRunner) StreamStatevector(s *circuit.Stream) ([]complex128, error) {
+	if s.HasControlFlow() {
+		return nil, fmt.Errorf("circuit with classical control flow has no single final state")
+	}
+	if err := simulator.CheckStatevectorWidth(s.Qubits()); err != nil {
+		return nil, err
 	}
+	state := NewQuantumState(s.Qubits(), s.Clbits())
+	for op, err := range s.Ops() {
+		if err != nil {
+			return nil, err
+		}
+		if op.G.Name() == "MEASURE" {
+			continue
+		}
+		if err := state.ApplyGate(op.G, op.Qubits); err != nil {
+			return nil, fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
+		}
+	}
+	return state.amplitudes, nil
+}
 
+// formatResult converts classical bits to the simulator's key format:
+// one character per cbit, cbit 0 first (the same order the itsu runner uses).
+func (r *QSimRunner) formatResult(bits []bool) string {
 	var result strings.Builder
-	for i := len(bits) - 1; i >= 0; i-- { // MSB first
-		if bits[i] {
+	for _, b := range bits {
+		if b {
 			result.WriteByte('1')
 		} else {
 			result.WriteByte('0')
@@ -129,6 +319,7 @@ func (r *QSimRunner) GetBackendInfo() simulator.BackendInfo {
 			"metrics_collection": true,
 			"configuration":      true,
 			"reset":              true,
+			"control_flow":       true,
 		},
 		Metadata: map[string]string{
 			"backend_type":   "statevector_simulator",
@@ -139,6 +330,45 @@ func (r *QSimRunner) GetBackendInfo() simulator.BackendInfo {
 	}
 }
 
+// WithProfiler implements simulator.ProfilingRunner.
+func (r *QSimRunner) WithProfiler(p simulator.OpProfiler) simulator.OneShotRunner {
+	v := *r
+	v.profiler = p
+	return &v
+}
+
+// WithLoopObserver implements simulator.LoopCountingRunner.
+func (r *QSimRunner) WithLoopObserver(o simulator.LoopObserver) simulator.OneShotRunner {
+	v := *r
+	v.loops = o
+	return &v
+}
+
+// SetHook implements simulator.HookingRunner.
+func (r *QSimRunner) SetHook(h simulator.OpHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hook = h
+	r.shots.Store(0)
+}
+
+func (r *QSimRunner) currentHook() simulator.OpHook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hook
+}
+
+// shotHook returns the hook and the number of a shot about to start, or
+// nil and -1 when no hook is set.
+func (r *QSimRunner) shotHook() (simulator.OpHook, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.hook == nil {
+		return nil, -1
+	}
+	return r.hook, int(r.shots.Add(1) - 1)
+}
+
 // ConfigurableRunner implementation
 func (r *QSimRunner) SetVerbose(verbose bool) {
 	r.mu.Lock()
@@ -165,6 +395,13 @@ func (r *QSimRunner) Configure(options map[string]any) error {
 			} else {
 				return fmt.Errorf("invalid type for 'log_level' option: expected string, got %T", value)
 			}
+		case "prune_tolerance":
+			if tol, ok := value.(float64); ok && tol > 0 {
+				r.pruneTolerance = tol
+				r.config[key] = value
+			} else {
+				return fmt.Errorf("invalid 'prune_tolerance' option: expected a positive float64, got %v (%T)", value, value)
+			}
 		case "seed":
 			if _, ok := value.(int64); ok {
 				r.config[key] = value
@@ -200,6 +437,8 @@ func (r *QSimRunner) Reset() {
 	r.metrics.totalTime.Store(0)
 	r.metrics.lastError.Store("")
 	r.metrics.lastRunTime.Store(time.Time{})
+	r.metrics.stateAllocs.Store(0)
+	r.metrics.stateReuses.Store(0)
 }
 
 // MetricsCollector implementation
@@ -242,6 +481,8 @@ func (r *QSimRunner) ResetMetrics() {
 	r.metrics.totalTime.Store(0)
 	r.metrics.lastError.Store("")
 	r.metrics.lastRunTime.Store(time.Time{})
+	r.metrics.stateAllocs.Store(0)
+	r.metrics.stateReuses.Store(0)
 }
 
 // ValidatingRunner implementation
@@ -254,14 +495,10 @@ func (r *QSimRunner) ValidateCircuit(c circuit.Circuit) error {
 		return fmt.Errorf("circuit is too deep: %d layers (max 1000)", c.Depth())
 	}
 
-	// Check all gates are supported
-	for _, op := range c.Operations() {
-		supported := slices.Contains(supportedGates, op.G.Name())
-
-		if !supported {
-			return fmt.Errorf("unsupported gate: %s", op.G.Name())
-		}
-
+	if err := simulator.CheckGates("qsim", c, supportedGates); err != nil {
+		return err
+	}
+	for _, op := range flatten(c.Operations()) {
 		// Validate qubit indices
 		for _, qubit := range op.Qubits {
 			if qubit < 0 || qubit >= c.Qubits() {
@@ -278,6 +515,19 @@ func (r *QSimRunner) ValidateCircuit(c circuit.Circuit) error {
 	return nil
 }
 
+// flatten lists ops with every loop replaced by its body.
+func flatten(ops []circuit.Operation) []circuit.Operation {
+	var out []circuit.Operation
+	for _, op := range ops {
+		if op.Loop != nil {
+			out = append(out, flatten(op.Loop.Body)...)
+			continue
+		}
+		out = append(out, op)
+	}
+	return out
+}
+
 func (r *QSimRunner) GetSupportedGates() []string {
 	result := make([]string, len(supportedGates))
 	copy(result, supportedGates)
@@ -306,11 +556,17 @@ func (r *QSimRunner) RunBatch(c circuit.Circuit, shots int) ([]string, error) {
 // GetResultProbabilities analyzes a circuit and returns theoretical probabilities
 // This is useful for validation against known quantum states
 func (r *QSimRunner) GetResultProbabilities(c circuit.Circuit) (map[string]float64, error) {
+	if circuit.HasControlFlow(c) {
+		return nil, fmt.Errorf("circuit with classical control flow has no single final state")
+	}
+	if err := simulator.CheckGates("qsim", c, supportedGates); err != nil {
+		return nil, err
+	}
 	// Create a copy of the state without measurements
 	state := NewQuantumState(c.Qubits(), c.Clbits())
 
 	// Apply all non-measurement operations
-	for _, op := range c.Operations() {
+	for _, op := range c.OpsIter() {
 		if op.G.Name() != "MEASURE" {
 			if err := state.ApplyGate(op.G, op.Qubits); err != nil {
 				return nil, fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
@@ -321,10 +577,16 @@ func (r *QSimRunner) GetResultProbabilities(c circuit.Circuit) (map[string]float
 	// Get probabilities for each computational basis state
 	probs := state.GetProbabilities()
 	result := make(map[string]float64)
+	r.mu.RLock()
+	tol := r.pruneTolerance
+	r.mu.RUnlock()
+	if tol == 0 {
+		tol = defaultPruneTolerance
+	}
 
 	// Convert to string representation
 	for i, prob := range probs {
-		if prob > 1e-10 { // Only include non-zero probabilities
+		if prob > tol { // Only include non-zero probabilities
 			bitString := fmt.Sprintf("%0*b", state.numQubits, i)
 			result[bitString] = prob
 		}
@@ -335,23 +597,134 @@ func (r *QSimRunner) GetResultProbabilities(c circuit.Circuit) (map[string]float
 
 // GetStatevector computes the final statevector of a circuit
 func (r *QSimRunner) GetStatevector(c circuit.Circuit) ([]complex128, error) {
+	return r.StatevectorFrom(nil, c)
+}
+
+// StatevectorFrom implements simulator.WarmStartRunner: GetStatevector
+// starting from init instead of |0…0⟩ (nil: |0…0⟩).
+func (r *QSimRunner) StatevectorFrom(init []complex128, c circuit.Circuit) ([]complex128, error) {
+	if circuit.HasControlFlow(c) {
+		return nil, fmt.Errorf("circuit with classical control flow has no single final state")
+	}
+	if err := simulator.CheckStatevectorWidth(c.Qubits()); err != nil {
+		return nil, err
+	}
+	if init != nil && len(init) != 1<<c.Qubits() {
+		return nil, fmt.Errorf("initial state has %d amplitudes, want %d", len(init), 1<<c.Qubits())
+	}
+	if err := simulator.CheckGates("qsim", c, supportedGates); err != nil {
+		return nil, err
+	}
 	// Initialize quantum state
 	state := NewQuantumState(c.Qubits(), c.Clbits())
+	if init != nil {
+		copy(state.amplitudes, init)
+	}
+	profiler := r.profiler
+	hook := r.currentHook()
+	f := fuser{state: state, off: profiler != nil || hook != nil}
 
 	// Execute circuit operations
-	for _, op := range c.Operations() {
+	for _, op := range c.OpsIter() {
 		if op.G.Name() == "MEASURE" {
 			continue // Skip measurements
 		}
+		if fused, err := f.add(op); err != nil {
+			return nil, err
+		} else if fused {
+			continue
+		}
+		if err := f.flush(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
 		// Apply quantum gate
 		if err := state.ApplyGate(op.G, op.Qubits); err != nil {
 			return nil, fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
 		}
+		if profiler != nil {
+			profiler.ObserveOp(op, time.Since(start))
+		}
+		if hook != nil {
+			hook.OnGateApplied(op, -1)
+		}
+	}
+	if err := f.flush(); err != nil {
+		return nil, err
 	}
 
 	return state.amplitudes, nil
 }
 
+// NewStepper implements simulator.StepperProvider: each step applies one
+// layer to a single evolving state. Measurements are skipped.
+func (r *QSimRunner) NewStepper(c circuit.Circuit) (simulator.Stepper, error) {
+	if circuit.HasControlFlow(c) {
+		return nil, fmt.Errorf("circuit with classical control flow has no single final state")
+	}
+	if err := simulator.CheckStatevectorWidth(c.Qubits()); err != nil {
+		return nil, err
+	}
+	if err := simulator.CheckGates("qsim", c, supportedGates); err != nil {
+		return nil, err
+	}
+	return &stepper{state: NewQuantumState(c.Qubits(), c.Clbits()), layers: simulator.Layers(c)}, nil
+}
+
+type stepper struct {
+	state   *QuantumState
+	layers  [][]circuit.Operation
+	applied int
+}
+
+func (s *stepper) Step() ([]circuit.Operation, error) {
+	if s.applied == len(s.layers) {
+		return nil, simulator.ErrStepperDone
+	}
+	layer := s.layers[s.applied]
+	f := fuser{state: s.state}
+	for _, op := range layer {
+		if op.G.Name() == "MEASURE" {
+			continue
+		}
+		if fused, err := f.add(op); err != nil {
+			return nil, err
+		} else if fused {
+			continue
+		}
+		if err := f.flush(); err != nil {
+			return nil, err
+		}
+		if err := s.state.ApplyGate(op.G, op.Qubits); err != nil {
+			return nil, fmt.Errorf("failed to apply gate %s: %w", op.G.Name(), err)
+		}
+	}
+	if err := f.flush(); err != nil {
+		return nil, err
+	}
+	s.applied++
+	return layer, nil
+}
+
+func (s *stepper) Layer() int  { return s.applied }
+func (s *stepper) Layers() int { return len(s.layers) }
+func (s *stepper) Statevector() []complex128 {
+	return append([]complex128(nil), s.state.amplitudes...)
+}
+func (s *stepper) Probabilities() []float64 { return s.state.GetProbabilities() }
+
+var (
+	_ simulator.StepperProvider    = (*QSimRunner)(nil)
+	_ simulator.StreamRunner       = (*QSimRunner)(nil)
+	_ simulator.AllocStatsProvider = (*QSimRunner)(nil)
+	_ simulator.OutcomeRunner      = (*QSimRunner)(nil)
+	_ simulator.RandRunner         = (*QSimRunner)(nil)
+	_ simulator.WarmStartRunner    = (*QSimRunner)(nil)
+	_ simulator.ProfilingRunner    = (*QSimRunner)(nil)
+	_ simulator.HookingRunner      = (*QSimRunner)(nil)
+	_ simulator.LoopCountingRunner = (*QSimRunner)(nil)
+)
+
 // Factory function for the plugin system
 func init() {
 	// Register the QSim runner with the plugin system
@@ -13,16 +13,35 @@ import (
 	"time"
 
 	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
 )
 
 // QSimRunner is a quantum circuit simulator built from scratch
 type QSimRunner struct {
+	*runnerState
+	profiler simulator.OpProfiler   // times every operation; nil: off
+	loops    simulator.LoopObserver // told of every loop run; nil: off
+}
+
+// runnerState is what a runner shares with the copies WithProfiler and
+// WithLoopObserver return.
+type runnerState struct {
 	config  map[string]any
 	mu      sync.RWMutex
 	metrics QSimMetrics
 	verbose bool
+	hook    simulator.OpHook
+	shots   atomic.Int64 // shots started since the hook was set
+	// pruneTolerance is the probability below which
+	// GetResultProbabilities drops outcomes; 0 => defaultPruneTolerance.
+	// Set through Configure as "prune_tolerance".
+	pruneTolerance float64
 }
 
+// defaultPruneTolerance is the pruning tolerance of runners that configure
+// none.
+const defaultPruneTolerance = 1e-10
+
 // QSimMetrics tracks execution statistics
 type QSimMetrics struct {
 	totalExecutions atomic.Int64
@@ -31,23 +50,31 @@ type QSimMetrics struct {
 	totalTime       atomic.Int64 // nanoseconds
 	lastError       atomic.Value // string
 	lastRunTime     atomic.Value // time.Time
+	stateAllocs     atomic.Int64 // per-shot states allocated (see acquireState)
+	stateReuses     atomic.Int64 // per-shot states taken from the pool
 }
 
 // QuantumState represents the statevector of a quantum system
 type QuantumState struct {
 	numQubits     int
-	amplitudes    []complex128 // State vector amplitudes
-	numClassical  int          // Number of classical bits
-	classicalBits []bool       // Classical bit values
-	StateVector   []complex128 // Populated when StateVector option is true
+	amplitudes    []complex128              // State vector amplitudes
+	numClassical  int                       // Number of classical bits
+	classicalBits []bool                    // Classical bit values
+	StateVector   []complex128              // Populated when StateVector option is true
+	rng           *rand.Rand                // source of measurement outcomes; nil: global
+	profiler      simulator.OpProfiler      // times every operation; nil: off
+	hook          simulator.OpHook          // told of every operation; nil: off
+	loops         simulator.LoopObserver    // told of every loop run; nil: off
+	shot          int                       // shot number reported to hook
+	callbacks     []simulator.BoundCallback // run after measurements (see RunOnceHybrid)
 }
 
 // NewQSimRunner creates a new quantum simulator instance
 func NewQSimRunner() *QSimRunner {
-	runner := &QSimRunner{
+	runner := &QSimRunner{runnerState: &runnerState{
 		config:  make(map[string]any),
 		verbose: false,
-	}
+	}}
 
 	// Initialize metrics
 	runner.metrics.lastRunTime.Store(time.Time{})
@@ -136,7 +163,11 @@ func (qs *QuantumState) Measure(qubit int) bool {
 	}
 
 	// Perform measurement
-	result := rand.Float64() < probOne
+	draw := rand.Float64
+	if qs.rng != nil {
+		draw = qs.rng.Float64
+	}
+	result := draw() < probOne
 
 	// Collapse the state - optimized normalization
 	var norm float64
@@ -199,11 +230,66 @@ func (qs *QuantumState) ApplyGate(g gate.Gate, qubits []int) error {
 		return qs.applyToffoli(qubits[0], qubits[1], qubits[2])
 	case "FREDKIN":
 		return qs.applyFredkin(qubits[0], qubits[1], qubits[2])
+	case "P", "CP":
+		pg, ok := g.(gate.Parametric)
+		if !ok {
+			return fmt.Errorf("gate %s carries no angle", g.Name())
+		}
+		return qs.applyPhase(pg.Params()[0], qubits...)
+	case "RX", "RY", "RZ":
+		pg, ok := g.(gate.Parametric)
+		if !ok {
+			return fmt.Errorf("gate %s carries no angle", g.Name())
+		}
+		return qs.applyRotation(g.Name(), pg.Params()[0], qubits[0])
 	default:
+		if c, ok := g.(*gate.Composite); ok {
+			// Gates defined with a matrix apply it in one pass.
+			if u := c.Unitary(); u != nil {
+				return qs.applyMatrix(u, qubits)
+			}
+			return gate.Expand(g, qubits, qs.ApplyGate)
+		}
 		return fmt.Errorf("unsupported gate: %s", g.Name())
 	}
 }
 
+// applyMatrix applies the dense unitary u, indexed as gate.Matrix returns
+// it, with qubits[i] bit i of its indices.
+func (qs *QuantumState) applyMatrix(u [][]complex128, qubits []int) error {
+	mask := 0
+	for _, q := range qubits {
+		if q >= qs.numQubits {
+			return fmt.Errorf("invalid qubit %d for %d-qubit system", q, qs.numQubits)
+		}
+		mask |= 1 << q
+	}
+	idx := make([]int, len(u))
+	in := make([]complex128, len(u))
+	for base := range qs.amplitudes {
+		if base&mask != 0 {
+			continue
+		}
+		for j := range idx {
+			idx[j] = base
+			for i, q := range qubits {
+				if j>>i&1 == 1 {
+					idx[j] |= 1 << q
+				}
+			}
+			in[j] = qs.amplitudes[idx[j]]
+		}
+		for row, r := range u {
+			var sum complex128
+			for col, a := range in {
+				sum += r[col] * a
+			}
+			qs.amplitudes[idx[row]] = sum
+		}
+	}
+	return nil
+}
+
 // Single-qubit gate implementations
 
 func (qs *QuantumState) applyHadamard(qubit int) error {
@@ -300,6 +386,58 @@ func (qs *QuantumState) applyS(qubit int) error {
 	return nil
 }
 
+// applyPhase multiplies every basis state in which all the given qubits are
+// |1⟩ by e^{iθ}; one qubit is P(θ), two are CP(θ).
+func (qs *QuantumState) applyPhase(theta float64, qubits ...int) error {
+	mask := 0
+	for _, q := range qubits {
+		if q >= qs.numQubits {
+			return fmt.Errorf("invalid qubit %d for %d-qubit system", q, qs.numQubits)
+		}
+		mask |= 1 << q
+	}
+	ph := cmplx.Exp(complex(0, theta))
+
+	for idx := range qs.amplitudes {
+		if idx&mask == mask {
+			qs.amplitudes[idx] *= ph
+		}
+	}
+
+	return nil
+}
+
+// applyRotation applies RX, RY or RZ (exp(-iθσ/2)) to one qubit.
+func (qs *QuantumState) applyRotation(axis string, theta float64, qubit int) error {
+	if qubit >= qs.numQubits {
+		return fmt.Errorf("invalid qubit %d for %d-qubit system", qubit, qs.numQubits)
+	}
+	c, s := complex(math.Cos(theta/2), 0), math.Sin(theta/2)
+	var m [2][2]complex128
+	switch axis {
+	case "RX":
+		m = [2][2]complex128{{c, complex(0, -s)}, {complex(0, -s), c}}
+	case "RY":
+		m = [2][2]complex128{{c, complex(-s, 0)}, {complex(s, 0), c}}
+	case "RZ":
+		m = [2][2]complex128{{cmplx.Exp(complex(0, -theta/2)), 0}, {0, cmplx.Exp(complex(0, theta/2))}}
+	default:
+		return fmt.Errorf("unknown rotation axis %s", axis)
+	}
+
+	mask := 1 << qubit
+	for i := range qs.amplitudes {
+		if i&mask == 0 {
+			j := i | mask
+			a0, a1 := qs.amplitudes[i], qs.amplitudes[j]
+			qs.amplitudes[i] = m[0][0]*a0 + m[0][1]*a1
+			qs.amplitudes[j] = m[1][0]*a0 + m[1][1]*a1
+		}
+	}
+
+	return nil
+}
+
 // Two-qubit gate implementations
 
 func (qs *QuantumState) applyCNOT(control, target int) error {
@@ -391,17 +529,10 @@ func (qs *QuantumState) applyFredkin(control, target1, target2 int) error {
 
 	for i := range qs.amplitudes {
 		if (i & controlMask) != 0 { // Control is |1⟩
-			bit1 := (i & mask1) != 0
-			bit2 := (i & mask2) != 0
-
-			if bit1 != bit2 { // Only swap if bits are different
-				j := i
-				if bit1 { // target1 is 1, target2 is 0
-					j = (i &^ mask1) | mask2 // Set target1 to 0, target2 to 1
-				} else { // target1 is 0, target2 is 1
-					j = (i &^ mask2) | mask1 // Set target1 to 1, target2 to 0
-				}
-
+			// Visit each swapped pair once, from the index with target1
+			// set and target2 clear.
+			if (i&mask1) != 0 && (i&mask2) == 0 {
+				j := (i &^ mask1) | mask2
 				qs.amplitudes[i], qs.amplitudes[j] = qs.amplitudes[j], qs.amplitudes[i]
 			}
 		}
@@ -0,0 +1,207 @@
+package reference
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// arith does complex arithmetic with prec-bit mantissas.
+type arith struct {
+	prec uint
+}
+
+func (a arith) f() *big.Float {
+	return new(big.Float).SetPrec(a.prec)
+}
+
+func (a arith) num(x float64) *big.Float {
+	return a.f().SetFloat64(x)
+}
+
+// re and im return x and ix. The matrices only read their entries, so
+// they may share them.
+func (a arith) re(x *big.Float) Complex { return Complex{x, a.num(0)} }
+func (a arith) im(x *big.Float) Complex { return Complex{a.num(0), x} }
+
+// mulAdd adds x·y to acc.
+func (a arith) mulAdd(acc, x, y Complex) {
+	t := a.f()
+	acc.Re.Add(acc.Re, t.Mul(x.Re, y.Re))
+	acc.Re.Sub(acc.Re, t.Mul(x.Im, y.Im))
+	acc.Im.Add(acc.Im, t.Mul(x.Re, y.Im))
+	acc.Im.Add(acc.Im, t.Mul(x.Im, y.Re))
+}
+
+// expi returns e^{iθ}.
+func (a arith) expi(theta float64) Complex {
+	s, c := a.sincos(theta)
+	return Complex{c, s}
+}
+
+// matrix returns the row-major unitary of the primitive gate g on its own
+// qubits, qubit i bit i, as gate.Matrix orders it.
+func (a arith) matrix(g gate.Gate) ([]Complex, error) {
+	angle := func() float64 { return g.(gate.Parametric).Params()[0] }
+	switch g.Name() {
+	case "H":
+		r := a.f().Quo(a.num(1), a.f().Sqrt(a.num(2)))
+		return []Complex{a.re(r), a.re(r), a.re(r), a.re(a.f().Neg(r))}, nil
+	case "P", "CP":
+		m := identity(a, 1<<g.QubitSpan())
+		m[len(m)-1] = a.expi(angle())
+		return m, nil
+	case "RX":
+		s, c := a.sincos(angle() / 2)
+		return []Complex{a.re(c), a.im(a.f().Neg(s)), a.im(a.f().Neg(s)), a.re(c)}, nil
+	case "RY":
+		s, c := a.sincos(angle() / 2)
+		return []Complex{a.re(c), a.re(a.f().Neg(s)), a.re(s), a.re(c)}, nil
+	case "RZ":
+		return []Complex{a.expi(-angle() / 2), a.re(a.num(0)), a.re(a.num(0)), a.expi(angle() / 2)}, nil
+	}
+	// The remaining built-in gates have entries 0, ±1 and ±i, exact in
+	// complex128.
+	u, err := gate.Matrix(g)
+	if err != nil {
+		return nil, fmt.Errorf("reference: %w", err)
+	}
+	m := make([]Complex, 0, len(u)*len(u))
+	for _, row := range u {
+		for _, z := range row {
+			for _, x := range []float64{real(z), imag(z)} {
+				if x != 0 && math.Abs(x) != 1 {
+					return nil, fmt.Errorf("reference: no exact matrix for %s", g.Name())
+				}
+			}
+			m = append(m, Complex{a.num(real(z)), a.num(imag(z))})
+		}
+	}
+	return m, nil
+}
+
+func identity(a arith, dim int) []Complex {
+	m := make([]Complex, dim*dim)
+	for i := range m {
+		m[i] = Complex{a.num(0), a.num(0)}
+	}
+	for i := range dim {
+		m[i*dim+i].Re.SetInt64(1)
+	}
+	return m
+}
+
+// apply multiplies the amplitudes of sv on qubits qs by the row-major
+// unitary u, qs[i] bit i of u's indices.
+func (a arith) apply(sv []Complex, u []Complex, qs []int) {
+	k := len(qs)
+	mask := 0
+	for _, q := range qs {
+		mask |= 1 << q
+	}
+	idx := make([]int, 1<<k)
+	in := make([]Complex, 1<<k)
+	for base := range sv {
+		if base&mask != 0 {
+			continue
+		}
+		for j := range idx {
+			idx[j] = base
+			for i, q := range qs {
+				if j>>i&1 == 1 {
+					idx[j] |= 1 << q
+				}
+			}
+			in[j] = sv[idx[j]]
+		}
+		for row := range idx {
+			acc := Complex{a.num(0), a.num(0)}
+			for col, z := range in {
+				a.mulAdd(acc, u[row<<k|col], z)
+			}
+			sv[idx[row]] = acc
+		}
+	}
+}
+
+// sincos returns sin x and cos x. x is reduced by multiples of π/2 with a
+// π of extra precision, then both series are summed to below the last bit.
+func (a arith) sincos(x float64) (sin, cos *big.Float) {
+	w := a.prec + 64
+	k := math.Round(x / (math.Pi / 2))
+	r := new(big.Float).SetPrec(w).SetFloat64(x)
+	halfPi := new(big.Float).SetPrec(w).Quo(pi(w), big.NewFloat(2))
+	r.Sub(r, new(big.Float).SetPrec(w).Mul(halfPi, new(big.Float).SetPrec(w).SetFloat64(k)))
+
+	sin = new(big.Float).SetPrec(w)
+	cos = new(big.Float).SetPrec(w)
+	eps := new(big.Float).SetPrec(w).SetMantExp(big.NewFloat(1), -int(w))
+	// term is ±r^n/n!, the sign flipping every other n: it goes to cos
+	// for even n and to sin for odd n. |r| ≤ π/4, so the terms shrink.
+	term := new(big.Float).SetPrec(w).SetInt64(1)
+	for n := 0; term.Sign() != 0 && new(big.Float).Abs(term).Cmp(eps) > 0; n++ {
+		if n%2 == 0 {
+			cos.Add(cos, term)
+		} else {
+			sin.Add(sin, term)
+		}
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetPrec(w).SetInt64(int64(n+1)))
+		if n%2 == 1 {
+			term.Neg(term)
+		}
+	}
+	switch int(math.Mod(math.Mod(k, 4)+4, 4)) {
+	case 1:
+		sin, cos = cos, sin.Neg(sin)
+	case 2:
+		sin, cos = sin.Neg(sin), cos.Neg(cos)
+	case 3:
+		sin, cos = cos.Neg(cos), sin
+	}
+	return sin.SetPrec(a.prec), cos.SetPrec(a.prec)
+}
+
+var (
+	piMu    sync.Mutex
+	piCache = map[uint]*big.Float{}
+)
+
+// pi returns π to prec bits by Machin's formula, π = 16·atan(1/5) −
+// 4·atan(1/239).
+func pi(prec uint) *big.Float {
+	piMu.Lock()
+	defer piMu.Unlock()
+	if p, ok := piCache[prec]; ok {
+		return p
+	}
+	w := prec + 32
+	p := new(big.Float).SetPrec(w).Mul(big.NewFloat(16), atanInv(5, w))
+	p.Sub(p, new(big.Float).SetPrec(w).Mul(big.NewFloat(4), atanInv(239, w)))
+	p.SetPrec(prec)
+	piCache[prec] = p
+	return p
+}
+
+// atanInv returns atan(1/n) = Σ (−1)^k / ((2k+1)·n^(2k+1)).
+func atanInv(n int64, prec uint) *big.Float {
+	sum := new(big.Float).SetPrec(prec)
+	pow := new(big.Float).SetPrec(prec).Quo(big.NewFloat(1), new(big.Float).SetPrec(prec).SetInt64(n))
+	n2 := new(big.Float).SetPrec(prec).SetInt64(n * n)
+	eps := new(big.Float).SetPrec(prec).SetMantExp(big.NewFloat(1), -int(prec))
+	for k := int64(0); ; k++ {
+		term := new(big.Float).SetPrec(prec).Quo(pow, new(big.Float).SetPrec(prec).SetInt64(2*k+1))
+		if term.Cmp(eps) < 0 {
+			return sum
+		}
+		if k%2 == 0 {
+			sum.Add(sum, term)
+		} else {
+			sum.Sub(sum, term)
+		}
+		pow.Quo(pow, n2)
+	}
+}
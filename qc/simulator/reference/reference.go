@@ -0,0 +1,143 @@
+// Package reference evaluates small circuits in arbitrary-precision
+// arithmetic (math/big), as a slow reference to certify the numerical
+// accuracy of the fast backends: Verify runs a circuit on both and reports
+// how far the backend's amplitudes are from the reference, exposing
+// rounding error that accumulates in deep circuits.
+//
+// Gate parameters are float64 and taken as exact, so the reference is the
+// exact evaluation of the circuit as built; constants such as 1/√2 and
+// the sines and cosines of rotations are computed to the full precision.
+package reference
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// MaxQubits bounds the circuits the reference evaluates; every amplitude
+// is a pair of big.Floats.
+const MaxQubits = 14
+
+// DefaultPrecision is the mantissa size, in bits, used when 0 is given.
+const DefaultPrecision = 256
+
+// Complex is an arbitrary-precision complex number.
+type Complex struct {
+	Re, Im *big.Float
+}
+
+// Complex128 rounds z to the nearest complex128.
+func (z Complex) Complex128() complex128 {
+	re, _ := z.Re.Float64()
+	im, _ := z.Im.Float64()
+	return complex(re, im)
+}
+
+// Statevector returns the final state of c computed with prec-bit
+// mantissas (DefaultPrecision if 0), indexed like a statevector (qubit q
+// is bit q). Measurements are skipped and must be terminal; classical
+// control flow is not supported.
+func Statevector(c circuit.Circuit, prec uint) ([]Complex, error) {
+	if prec == 0 {
+		prec = DefaultPrecision
+	}
+	n := c.Qubits()
+	if n > MaxQubits {
+		return nil, fmt.Errorf("reference: circuit has %d qubits, more than %d", n, MaxQubits)
+	}
+	a := arith{prec: prec}
+	sv := make([]Complex, 1<<n)
+	for i := range sv {
+		sv[i] = Complex{a.num(0), a.num(0)}
+	}
+	sv[0].Re.SetInt64(1)
+
+	measured := map[int]bool{}
+	for _, op := range c.Operations() {
+		if op.Cond != nil || op.Loop != nil {
+			return nil, fmt.Errorf("reference: classical control flow is not supported")
+		}
+		if op.G.Name() == "MEASURE" {
+			measured[op.Qubits[0]] = true
+			continue
+		}
+		if slices.ContainsFunc(op.Qubits, func(q int) bool { return measured[q] }) {
+			return nil, fmt.Errorf("reference: %s after a measurement; measurements must be terminal", op.G.Name())
+		}
+		err := gate.Expand(op.G, op.Qubits, func(g gate.Gate, qs []int) error {
+			u, err := a.matrix(g)
+			if err != nil {
+				return err
+			}
+			a.apply(sv, u, qs)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sv, nil
+}
+
+// Verification compares a backend's statevector with the reference.
+type Verification struct {
+	Qubits, Operations int
+	Precision          uint
+	// MaxError is the largest |backend − reference| over the amplitudes,
+	// at Index.
+	MaxError float64
+	Index    int
+	// NormError is |1 − Σ|a|²| of the backend's statevector.
+	NormError float64
+}
+
+// Verify evaluates c on the simulator's runner, which must implement
+// simulator.StatevectorGetter, and in prec-bit arithmetic (DefaultPrecision
+// if 0), and compares the two statevectors.
+func Verify(sim *simulator.Simulator, c circuit.Circuit, prec uint) (Verification, error) {
+	if prec == 0 {
+		prec = DefaultPrecision
+	}
+	v := Verification{Qubits: c.Qubits(), Operations: c.NumOps(), Precision: prec}
+	ref, err := Statevector(c, prec)
+	if err != nil {
+		return v, err
+	}
+	got, err := sim.GetStatevector(c)
+	if err != nil {
+		return v, err
+	}
+	if len(got) != len(ref) {
+		return v, fmt.Errorf("reference: backend returned %d amplitudes, want %d", len(got), len(ref))
+	}
+	a := arith{prec: prec}
+	norm := a.num(0)
+	for i, z := range got {
+		re := a.num(real(z))
+		im := a.num(imag(z))
+		norm.Add(norm, a.f().Mul(re, re))
+		norm.Add(norm, a.f().Mul(im, im))
+		re.Sub(re, ref[i].Re)
+		im.Sub(im, ref[i].Im)
+		dr, _ := re.Float64()
+		di, _ := im.Float64()
+		if e := math.Hypot(dr, di); e > v.MaxError {
+			v.MaxError, v.Index = e, i
+		}
+	}
+	norm.Sub(norm, a.num(1))
+	v.NormError, _ = norm.Abs(norm).Float64()
+	return v, nil
+}
+
+// String formats the verification for people.
+func (v Verification) String() string {
+	return fmt.Sprintf("%d qubits, %d operations, %d-bit reference: max amplitude error %.3g (index %d), norm error %.3g",
+		v.Qubits, v.Operations, v.Precision, v.MaxError, v.Index, v.NormError)
+}
@@ -0,0 +1,87 @@
+package reference
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSincos(t *testing.T) {
+	a := arith{prec: 128}
+	want, _ := new(big.Float).SetPrec(128).SetString("3.14159265358979323846264338327950288419716939937510")
+	diff, _ := new(big.Float).Sub(pi(128), want).Float64()
+	assert.InDelta(t, 0, diff, 1e-37)
+
+	for _, x := range []float64{0, 0.3, -0.3, 1, math.Pi / 2, 2.5, -3, 7.25, 100} {
+		s, c := a.sincos(x)
+		sf, _ := s.Float64()
+		cf, _ := c.Float64()
+		assert.InDelta(t, math.Sin(x), sf, 1e-15, "sin %v", x)
+		assert.InDelta(t, math.Cos(x), cf, 1e-15, "cos %v", x)
+		// sin² + cos² = 1 to the working precision.
+		one := new(big.Float).SetPrec(128).Mul(s, s)
+		one.Add(one, new(big.Float).SetPrec(128).Mul(c, c))
+		d, _ := one.Sub(one, big.NewFloat(1)).Float64()
+		assert.InDelta(t, 0, d, 1e-35, "x = %v", x)
+	}
+}
+
+func TestStatevector(t *testing.T) {
+	c, err := builder.New(builder.Q(3), builder.C(3)).
+		H(0).CNOT(0, 1).Toffoli(0, 1, 2).S(2).Y(1).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	require.NoError(t, err)
+	sv, err := Statevector(c, 0)
+	require.NoError(t, err)
+	// H, CNOT, Toffoli: (|000⟩ + |111⟩)/√2; S: i on |111⟩; Y on qubit 1:
+	// |000⟩ → i|010⟩ and i|111⟩ → i·(−i)|101⟩.
+	r := 1 / math.Sqrt2
+	want := []complex128{0, 0, complex(0, r), 0, 0, complex(r, 0), 0, 0}
+	for i, z := range sv {
+		assert.InDelta(t, real(want[i]), real(z.Complex128()), 1e-16, "re %d", i)
+		assert.InDelta(t, imag(want[i]), imag(z.Complex128()), 1e-16, "im %d", i)
+	}
+
+	mid, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).H(0).BuildCircuit()
+	require.NoError(t, err)
+	_, err = Statevector(mid, 0)
+	assert.ErrorContains(t, err, "terminal")
+
+	wide, err := builder.New(builder.Q(MaxQubits + 1)).BuildCircuit()
+	require.NoError(t, err)
+	_, err = Statevector(wide, 0)
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	// A deep circuit of rotations: the backend accumulates rounding error,
+	// which must stay near the float64 epsilon per operation.
+	b := builder.New(builder.Q(4), builder.C(4))
+	for i := range 50 {
+		x := 0.1 + 0.37*float64(i)
+		b.RX(x, i%4).RY(x/3, (i+1)%4).RZ(-x, (i+2)%4).P(x/7, (i+3)%4).
+			H(i%4).CNOT(i%4, (i+1)%4).CP(x/5, (i+2)%4, (i+3)%4).SWAP(i%4, (i+2)%4)
+	}
+	for q := range 4 {
+		b.Measure(q, q)
+	}
+	c, err := b.BuildCircuit()
+	require.NoError(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Runner: qsim.NewQSimRunner()})
+
+	v, err := Verify(sim, c, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 4, v.Qubits)
+	assert.Equal(t, 404, v.Operations)
+	assert.Equal(t, uint(DefaultPrecision), v.Precision)
+	assert.Less(t, v.MaxError, 1e-12)
+	assert.Greater(t, v.MaxError, 0.0, "float64 kernels cannot be exact")
+	assert.Less(t, v.NormError, 1e-12)
+	assert.Contains(t, v.String(), "256-bit reference")
+}
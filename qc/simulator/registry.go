@@ -2,16 +2,46 @@ package simulator
 
 import (
 	"fmt"
+	"slices"
 	"sync"
 )
 
 // RunnerFactory is a function that creates a new OneShotRunner instance.
 type RunnerFactory func() OneShotRunner
 
+// LazyFactory prepares a backend on first use (loading libraries, probing
+// devices, …) and returns the factory for its runners. It runs at most
+// once per registration.
+type LazyFactory func() (RunnerFactory, error)
+
 // RunnerRegistry manages the registration and creation of quantum backend runners.
+// All methods are safe for concurrent use.
 type RunnerRegistry struct {
-	mu        sync.RWMutex
-	factories map[string]RunnerFactory
+	mu      sync.RWMutex
+	entries map[string]*registration
+	order   []string // names in registration order
+}
+
+// registration is one registered backend; lazy ones resolve factory on
+// the first Create.
+type registration struct {
+	factory RunnerFactory
+	lazy    LazyFactory
+	once    sync.Once
+	err     error
+}
+
+// resolve returns the factory, running a lazy initialiser if needed.
+func (e *registration) resolve() (RunnerFactory, error) {
+	if e.lazy != nil {
+		e.once.Do(func() {
+			e.factory, e.err = e.lazy()
+			if e.err == nil && e.factory == nil {
+				e.err = fmt.Errorf("lazy initialiser returned a nil factory")
+			}
+		})
+	}
+	return e.factory, e.err
 }
 
 // Global registry instance
@@ -20,29 +50,60 @@ var defaultRegistry = NewRunnerRegistry()
 // NewRunnerRegistry creates a new runner registry.
 func NewRunnerRegistry() *RunnerRegistry {
 	return &RunnerRegistry{
-		factories: make(map[string]RunnerFactory),
+		entries: make(map[string]*registration),
 	}
 }
 
 // Register registers a runner factory with the given name.
 // This function is thread-safe and can be called from init() functions.
 func (r *RunnerRegistry) Register(name string, factory RunnerFactory) error {
-	if name == "" {
-		return fmt.Errorf("runner name cannot be empty")
-	}
 	if factory == nil {
 		return fmt.Errorf("runner factory cannot be nil")
 	}
+	_, err := r.add(name, &registration{factory: factory}, false)
+	return err
+}
+
+// RegisterLazy registers a backend whose initialiser runs only when the
+// runner is first created. A failing initialiser makes every Create of
+// that name fail with its error.
+func (r *RunnerRegistry) RegisterLazy(name string, init LazyFactory) error {
+	if init == nil {
+		return fmt.Errorf("runner initialiser cannot be nil")
+	}
+	_, err := r.add(name, &registration{lazy: init}, false)
+	return err
+}
+
+// Override registers factory under name, replacing any runner already
+// registered there; a replaced runner keeps its place in the
+// registration order. It reports whether one was replaced.
+func (r *RunnerRegistry) Override(name string, factory RunnerFactory) (bool, error) {
+	if factory == nil {
+		return false, fmt.Errorf("runner factory cannot be nil")
+	}
+	return r.add(name, &registration{factory: factory}, true)
+}
+
+// add stores e under name and reports whether it replaced an entry, which
+// only override allows.
+func (r *RunnerRegistry) add(name string, e *registration, override bool) (bool, error) {
+	if name == "" {
+		return false, fmt.Errorf("runner name cannot be empty")
+	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.factories[name]; exists {
-		return fmt.Errorf("runner %q is already registered", name)
+	_, exists := r.entries[name]
+	switch {
+	case exists && !override:
+		return false, fmt.Errorf("runner %q is already registered", name)
+	case !exists:
+		r.order = append(r.order, name)
 	}
-
-	r.factories[name] = factory
-	return nil
+	r.entries[name] = e
+	return exists, nil
 }
 
 // MustRegister is like Register but panics if the registration fails.
@@ -57,13 +118,17 @@ func (r *RunnerRegistry) MustRegister(name string, factory RunnerFactory) {
 // Create creates a new runner instance using the factory registered under the given name.
 func (r *RunnerRegistry) Create(name string) (OneShotRunner, error) {
 	r.mu.RLock()
-	factory, exists := r.factories[name]
+	e, exists := r.entries[name]
 	r.mu.RUnlock()
 
 	if !exists {
 		return nil, fmt.Errorf("unknown runner: %q", name)
 	}
 
+	factory, err := e.resolve()
+	if err != nil {
+		return nil, fmt.Errorf("initialising runner %q: %w", name, err)
+	}
 	runner := factory()
 	if runner == nil {
 		return nil, fmt.Errorf("runner factory for %q returned nil", name)
@@ -72,16 +137,13 @@ func (r *RunnerRegistry) Create(name string) (OneShotRunner, error) {
 	return runner, nil
 }
 
-// ListRunners returns a list of all registered runner names.
+// ListRunners returns the names of all registered runners in the order
+// they were registered.
 func (r *RunnerRegistry) ListRunners() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	names := make([]string, 0, len(r.factories))
-	for name := range r.factories {
-		names = append(names, name)
-	}
-	return names
+	return slices.Clone(r.order)
 }
 
 // Unregister removes a runner from the registry.
@@ -90,9 +152,10 @@ func (r *RunnerRegistry) Unregister(name string) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	_, exists := r.factories[name]
+	_, exists := r.entries[name]
 	if exists {
-		delete(r.factories, name)
+		delete(r.entries, name)
+		r.order = slices.DeleteFunc(r.order, func(n string) bool { return n == name })
 	}
 	return exists
 }
@@ -109,6 +172,24 @@ func MustRegisterRunner(name string, factory RunnerFactory) {
 	defaultRegistry.MustRegister(name, factory)
 }
 
+// RegisterLazyRunner registers a lazily initialised backend with the
+// default registry; see RunnerRegistry.RegisterLazy.
+func RegisterLazyRunner(name string, init LazyFactory) error {
+	return defaultRegistry.RegisterLazy(name, init)
+}
+
+// OverrideRunner replaces or adds a runner in the default registry; see
+// RunnerRegistry.Override.
+func OverrideRunner(name string, factory RunnerFactory) (bool, error) {
+	return defaultRegistry.Override(name, factory)
+}
+
+// UnregisterRunner removes a runner from the default registry, e.g. to
+// undo a test registration.
+func UnregisterRunner(name string) bool {
+	return defaultRegistry.Unregister(name)
+}
+
 // CreateRunner creates a runner using the default registry.
 func CreateRunner(name string) (OneShotRunner, error) {
 	return defaultRegistry.Create(name)
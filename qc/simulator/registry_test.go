@@ -2,6 +2,9 @@ package simulator
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"maps"
@@ -158,6 +161,67 @@ func TestRunnerRegistry(t *testing.T) {
 		assert.False(t, removed)
 	})
 
+	t.Run("Registration Order", func(t *testing.T) {
+		reg := NewRunnerRegistry()
+		factory := func() OneShotRunner { return newMockOneShotRunner(nil) }
+		for _, name := range []string{"c", "a", "b"} {
+			require.NoError(t, reg.Register(name, factory))
+		}
+		assert.Equal(t, []string{"c", "a", "b"}, reg.ListRunners())
+		reg.Unregister("a")
+		assert.Equal(t, []string{"c", "b"}, reg.ListRunners())
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		reg := NewRunnerRegistry()
+		require.NoError(t, reg.Register("x", func() OneShotRunner { return newMockOneShotRunner(nil) }))
+		require.NoError(t, reg.Register("y", func() OneShotRunner { return newMockOneShotRunner(nil) }))
+		replaced, err := reg.Override("x", func() OneShotRunner { return newMockFullFeaturedRunner() })
+		require.NoError(t, err)
+		assert.True(t, replaced)
+		runner, err := reg.Create("x")
+		require.NoError(t, err)
+		assert.IsType(t, &mockFullFeaturedRunner{}, runner)
+		assert.Equal(t, []string{"x", "y"}, reg.ListRunners())
+
+		replaced, err = reg.Override("z", func() OneShotRunner { return newMockOneShotRunner(nil) })
+		require.NoError(t, err)
+		assert.False(t, replaced)
+		assert.Equal(t, []string{"x", "y", "z"}, reg.ListRunners())
+	})
+
+	t.Run("Lazy", func(t *testing.T) {
+		reg := NewRunnerRegistry()
+		var inits atomic.Int32
+		require.NoError(t, reg.RegisterLazy("heavy", func() (RunnerFactory, error) {
+			inits.Add(1)
+			return func() OneShotRunner { return newMockOneShotRunner(nil) }, nil
+		}))
+		require.NoError(t, reg.RegisterLazy("broken", func() (RunnerFactory, error) {
+			inits.Add(1)
+			return nil, fmt.Errorf("no device")
+		}))
+		assert.Equal(t, int32(0), inits.Load(), "registration must not initialise")
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := reg.Create("heavy")
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), inits.Load())
+
+		for range 2 {
+			_, err := reg.Create("broken")
+			assert.ErrorContains(t, err, "no device")
+		}
+		assert.Equal(t, int32(2), inits.Load())
+	})
+
 	t.Run("MustRegister Panic", func(t *testing.T) {
 		assert.Panics(t, func() {
 			registry.MustRegister("", func() OneShotRunner { return newMockOneShotRunner(nil) })
@@ -0,0 +1,214 @@
+package simulator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/bitorder"
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Result is a histogram together with what is needed to interpret its keys.
+type Result struct {
+	// Counts maps raw keys to shot counts. Raw keys hold one character per
+	// measured classical bit, in the order of Cbits (lowest cbit first).
+	Counts map[string]int
+	Shots  int
+	// Cbits lists the absolute classical bit behind each raw key position.
+	Cbits []int
+	// Registers are the circuit's named classical registers. Circuits without
+	// any are treated as a single register "c" spanning every cbit.
+	Registers []circuit.Register
+	// Acceptance is the fraction of shots kept by SimulatorOptions.PostSelect
+	// (1 without post-selection).
+	Acceptance float64
+	// Events lists every measurement in execution order; only RunEvents
+	// fills it.
+	Events []MeasurementEvent
+	// Attempts lists the body runs of every top-level repeat-until-success
+	// loop, in circuit order; only RunAttempts fills it.
+	Attempts []LoopAttempts
+	// Alloc holds the runner's state allocations during this run, when the
+	// runner implements AllocStatsProvider; nil otherwise.
+	Alloc *AllocStats
+	// Profile holds the runner's operation timings during this run when
+	// SimulatorOptions.Profile is set and the runner implements
+	// ProfilingRunner; nil otherwise.
+	Profile *Profile
+	// ShotPlan explains how Shots was chosen when SimulatorOptions.MinCounts
+	// is set; nil otherwise.
+	ShotPlan    *ShotPlan
+	eventCounts map[string]int
+}
+
+// BitOrder selects how bits are written inside a formatted key.
+type BitOrder = bitorder.Order
+
+const (
+	// LSBFirst writes the lowest cbit first; this is the raw key order.
+	LSBFirst = bitorder.LSBFirst
+	// MSBFirst writes the highest cbit first, so keys read as binary
+	// numbers. With GroupRegisters the registers are also listed last to
+	// first, as in most other toolkits.
+	MSBFirst = bitorder.MSBFirst
+)
+
+// KeyFormat configures Result.Format.
+type KeyFormat struct {
+	Order          BitOrder
+	GroupRegisters bool // separate registers with a space
+}
+
+// RunResult is Run returning a Result instead of a bare histogram.
+func (s *Simulator) RunResult(c circuit.Circuit) (*Result, error) {
+	s, plan := s.planned(c)
+	alloc := s.allocTracker()
+	s, profile := s.profiled()
+	if len(s.PostSelect) > 0 {
+		hist, rate, err := s.postSelected(c, (*Simulator).Run)
+		if err != nil {
+			return nil, err
+		}
+		res := s.newResult(c, hist)
+		res.Acceptance = rate
+		res.Alloc = alloc()
+		res.Profile = profile()
+		res.ShotPlan = plan
+		return res, nil
+	}
+	hist, err := s.Run(c)
+	if err != nil {
+		return nil, err
+	}
+	res := s.newResult(c, hist)
+	res.Alloc = alloc()
+	res.Profile = profile()
+	res.ShotPlan = plan
+	return res, nil
+}
+
+// profiled returns a copy of s whose runner times every operation into a
+// fresh Profile if s.Profile is set, and a function returning that
+// Profile, or nil if there is none.
+func (s *Simulator) profiled() (*Simulator, func() *Profile) {
+	pr, ok := s.runner.(ProfilingRunner)
+	if !s.Profile || !ok {
+		return s, func() *Profile { return nil }
+	}
+	p := NewProfile()
+	sub := *s
+	sub.runner = pr.WithProfiler(p)
+	return &sub, func() *Profile { return p }
+}
+
+// allocTracker snapshots the runner's AllocStats; the returned function
+// reports the change since then, or nil if the runner keeps no stats.
+func (s *Simulator) allocTracker() func() *AllocStats {
+	p, ok := s.runner.(AllocStatsProvider)
+	if !ok {
+		return func() *AllocStats { return nil }
+	}
+	before := p.AllocStats()
+	return func() *AllocStats {
+		after := p.AllocStats()
+		return &AllocStats{
+			StateAllocs: after.StateAllocs - before.StateAllocs,
+			StateReuses: after.StateReuses - before.StateReuses,
+		}
+	}
+}
+
+func (s *Simulator) newResult(c circuit.Circuit, hist map[string]int) *Result {
+	regs := c.CRegs()
+	if len(regs) == 0 && c.Clbits() > 0 {
+		regs = []circuit.Register{{Name: "c", Start: 0, Size: c.Clbits()}}
+	}
+	return &Result{Counts: hist, Shots: s.Shots, Cbits: measuredCbits(c), Registers: regs, Acceptance: 1}
+}
+
+// Format re-keys the histogram according to f.
+func (r *Result) Format(f KeyFormat) map[string]int {
+	out := make(map[string]int, len(r.Counts))
+	for k, n := range r.Counts {
+		out[r.FormatKey(k, f)] += n
+	}
+	return out
+}
+
+// FormatKey rewrites one raw key. Within each register only the measured
+// bits are written; registers with none are left out. Keys that do not
+// match Cbits (e.g. from runners with their own conventions) and any
+// "|…" debugging suffix are passed through unchanged.
+func (r *Result) FormatKey(key string, f KeyFormat) string {
+	raw, suffix, hasSuffix := strings.Cut(key, "|")
+	if len(raw) != len(r.Cbits) {
+		return key
+	}
+	bit := make(map[int]byte, len(raw))
+	for i, cb := range r.Cbits {
+		bit[cb] = raw[i]
+	}
+
+	type group struct {
+		start int
+		bits  string
+	}
+	var gs []group
+	for _, reg := range r.Registers {
+		var sb strings.Builder
+		for i := range reg.Size {
+			if v, ok := bit[reg.Start+i]; ok {
+				sb.WriteByte(v)
+			}
+		}
+		if sb.Len() > 0 {
+			gs = append(gs, group{reg.Start, sb.String()})
+		}
+	}
+	// Measured bits outside every register form one anonymous group.
+	var rest strings.Builder
+	restStart := -1
+	for i, cb := range r.Cbits {
+		if !r.inRegister(cb) {
+			if restStart < 0 {
+				restStart = cb
+			}
+			rest.WriteByte(raw[i])
+		}
+	}
+	if rest.Len() > 0 {
+		gs = append(gs, group{restStart, rest.String()})
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].start < gs[j].start })
+	groups := make([]string, len(gs))
+	for i, g := range gs {
+		groups[i] = g.bits
+	}
+
+	if f.Order == MSBFirst {
+		for i, g := range groups {
+			groups[i] = bitorder.Reverse(g)
+		}
+		for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+			groups[i], groups[j] = groups[j], groups[i]
+		}
+	}
+	sep := ""
+	if f.GroupRegisters {
+		sep = " "
+	}
+	out := strings.Join(groups, sep)
+	if hasSuffix {
+		out += "|" + suffix
+	}
+	return out
+}
+
+func (r *Result) inRegister(cb int) bool {
+	for _, reg := range r.Registers {
+		if cb >= reg.Start && cb < reg.Start+reg.Size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package simulator
+
+import (
+	"fmt"
+	"iter"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// measuredCbits returns, in ascending order, the classical bits that some
+// measurement of c writes (loop bodies included).
+func measuredCbits(c circuit.Circuit) []int {
+	seen := map[int]bool{}
+	var walk func([]circuit.Operation)
+	walk = func(ops []circuit.Operation) {
+		for _, op := range ops {
+			if op.Loop != nil {
+				walk(op.Loop.Body)
+			}
+			if op.G.Name() == "MEASURE" && op.Cbit >= 0 {
+				seen[op.Cbit] = true
+			}
+		}
+	}
+	walk(c.Operations())
+	cs := make([]int, 0, len(seen))
+	for cb := range seen {
+		cs = append(cs, cb)
+	}
+	sort.Ints(cs)
+	return cs
+}
+
+// keyProjector returns a function turning a full-width runner key (cbit 0
+// first) into a histogram key covering only the cbits c actually writes.
+// Keys of any other width are passed through untouched, so runners with
+// their own conventions keep working.
+func keyProjector(c circuit.Circuit) func(string) string {
+	return projectKeys(measuredCbits(c), c.Clbits())
+}
+
+// projectKeys is keyProjector for the ascending written cbits of a
+// circuit with clbits classical bits.
+func projectKeys(written []int, clbits int) func(string) string {
+	if len(written) == clbits {
+		return func(k string) string { return k }
+	}
+	return func(k string) string {
+		if len(k) != clbits {
+			return k
+		}
+		b := make([]byte, len(written))
+		for i, cb := range written {
+			b[i] = k[cb]
+		}
+		return string(b)
+	}
+}
+
+// terminalMeasurements reports whether every measurement of c comes after
+// the last gate on its qubit and c has no control flow, i.e. whether all
+// shots can be drawn from one final statevector.
+func terminalMeasurements(c circuit.Circuit) bool {
+	measured := map[int]bool{}
+	for _, op := range c.OpsIter() {
+		if op.Cond != nil || op.Loop != nil {
+			return false
+		}
+		if op.G.Name() == "MEASURE" {
+			measured[op.Qubits[0]] = true
+			continue
+		}
+		if slices.ContainsFunc(op.Qubits, func(q int) bool { return measured[q] }) {
+			return false
+		}
+	}
+	return true
+}
+
+// sample draws all shots from the final statevector instead of replaying
+// the circuit once per shot. It only applies when the runner can return a
+// statevector and every measurement is terminal; ok reports whether it did.
+// project maps full-width keys of c to histogram keys (see plan).
+//
+// The statevector is marginalised onto the measured qubits before
+// sampling, so the cost per shot is a binary search over the distinct
+// outcomes rather than a full simulation.
+func (s *Simulator) sample(c circuit.Circuit, project func(string) string) (hist map[string]int, ok bool, err error) {
+	getter, isGetter := s.runner.(StatevectorGetter)
+	if !isGetter || !terminalMeasurements(c) {
+		if s.IncludeUnmeasured {
+			return nil, true, fmt.Errorf("simulator: IncludeUnmeasured needs a statevector runner and terminal measurements")
+		}
+		return nil, false, nil
+	}
+	sv, err := getter.GetStatevector(c)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return s.sampleState(sv, CbitSources(c.Clbits(), c.OpsIter()), unmeasured(c.Qubits(), measurements(c)), project), true, nil
+}
+
+// measurements maps each qubit c measures to the cbits it is measured into.
+func measurements(c circuit.Circuit) map[int][]int {
+	meas := map[int][]int{}
+	for _, op := range c.OpsIter() {
+		if op.G.Name() == "MEASURE" {
+			meas[op.Qubits[0]] = append(meas[op.Qubits[0]], op.Cbit)
+		}
+	}
+	return meas
+}
+
+// unmeasured lists, in ascending order, the qubits out of qubits that meas
+// does not measure.
+func unmeasured(qubits int, meas map[int][]int) []int {
+	var out []int
+	for q := range qubits {
+		if len(meas[q]) == 0 {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// CbitSources maps each of clbits classical bits to the qubit whose
+// measurement among ops writes it last, or -1 if none does. When several
+// measurements write one cbit the last one wins, as it does when shots are
+// replayed, so keys of shots drawn from a final state are read through it
+// (see OutcomeKey).
+func CbitSources(clbits int, ops iter.Seq2[int, circuit.Operation]) []int {
+	src := make([]int, clbits)
+	for i := range src {
+		src[i] = -1
+	}
+	for _, op := range ops {
+		if op.G.Name() == "MEASURE" && op.Cbit >= 0 {
+			src[op.Cbit] = op.Qubits[0]
+		}
+	}
+	return src
+}
+
+// OutcomeKey returns the full-width key (cbit 0 first) of the basis state
+// idx, reading cbit cb from qubit src[cb] as CbitSources maps them.
+func OutcomeKey(src []int, idx int) string {
+	key := make([]byte, len(src))
+	for cb, q := range src {
+		key[cb] = '0'
+		if q >= 0 && idx>>q&1 == 1 {
+			key[cb] = '1'
+		}
+	}
+	return string(key)
+}
+
+// sampleState draws s.Shots keys from the final statevector sv, reading
+// the cbits through src (see CbitSources). With IncludeUnmeasured the
+// unmeasured qubits are appended.
+func (s *Simulator) sampleState(sv []complex128, src, unmeasured []int, project func(string) string) map[string]int {
+	// Marginalise: accumulate probability per distinct key.
+	marginal := map[string]float64{}
+	for idx, amp := range sv {
+		p := real(amp)*real(amp) + imag(amp)*imag(amp)
+		if p == 0 {
+			continue
+		}
+		key := project(OutcomeKey(src, idx))
+		if s.IncludeUnmeasured {
+			var sb strings.Builder
+			sb.WriteString(key)
+			sb.WriteByte('|')
+			for _, q := range unmeasured {
+				sb.WriteByte('0' + byte(idx>>q&1))
+			}
+			key = sb.String()
+		}
+		marginal[key] += p
+	}
+
+	keys := make([]string, 0, len(marginal))
+	for k := range marginal {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cum := make([]float64, len(keys))
+	total := 0.0
+	for i, k := range keys {
+		total += marginal[k]
+		cum[i] = total
+	}
+
+	draw := rand.Float64
+	if s.Seed != 0 {
+		draw = rand.New(rand.NewSource(s.Seed)).Float64
+	}
+	hist := make(map[string]int, len(keys))
+	size := s.chunkShots()
+	// Shots are drawn in chunks only to report Progress.
+	for start := 0; start < s.Shots; start += size {
+		ch := ChunkResult{Index: start / size, Seed: s.Seed, Shots: min(size, s.Shots-start), Counts: map[string]int{}}
+		for range ch.Shots {
+			r := draw() * total
+			i := sort.SearchFloat64s(cum, r)
+			if i == len(keys) {
+				i--
+			}
+			hist[keys[i]]++
+			if s.Progress != nil {
+				ch.Counts[keys[i]]++
+			}
+		}
+		if s.Progress != nil {
+			s.Progress(ch)
+		}
+	}
+	s.log.Info().Int("shots", s.Shots).Int("outcomes", len(keys)).Msg("simulator: Sampled shots from the final statevector")
+	return hist
+}
@@ -0,0 +1,196 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// ErrQueueFull is returned by Scheduler.Run when MaxQueued jobs are
+// already waiting.
+var ErrQueueFull = errors.New("simulator: scheduler queue is full")
+
+// MemoryError reports a run whose estimated memory exceeds a scheduler
+// limit, so it could never start.
+type MemoryError struct {
+	Need  int64 // estimated bytes of the run
+	Limit int64
+}
+
+func (e *MemoryError) Error() string {
+	return fmt.Sprintf("simulator: run needs about %d bytes, over the limit of %d", e.Need, e.Limit)
+}
+
+// EstimateMemory returns an upper bound on the bytes a statevector backend
+// uses to run c with the given number of workers: one statevector of
+// 2^qubits complex128 amplitudes per worker. Tapering and light cones
+// often shrink the circuit first, so actual use may be far lower.
+func EstimateMemory(c circuit.Circuit, workers int) int64 {
+	workers = max(workers, 1)
+	if c.Qubits() > 58 || int64(16)<<c.Qubits() > math.MaxInt64/int64(workers) {
+		return math.MaxInt64
+	}
+	return int64(16) << c.Qubits() * int64(workers)
+}
+
+// SchedulerOptions bound the simulations a Scheduler runs.
+type SchedulerOptions struct {
+	MaxConcurrent int   // runs at once (0 => NumCPU)
+	MaxQueued     int   // runs waiting to start (0 => unbounded)
+	MaxRunMemory  int64 // estimated bytes of one run (0 => unbounded)
+	MaxMemory     int64 // estimated bytes of all running runs (0 => unbounded)
+}
+
+// Scheduler admits simulations for a service running circuits on behalf
+// of several tenants. Runs over the limits wait in a queue per tenant;
+// whenever capacity frees up, tenants take turns starting their oldest
+// run, so one tenant submitting many jobs does not starve the others. A
+// run that does not fit blocks the tenants behind it rather than being
+// overtaken indefinitely by smaller ones. It is safe for concurrent use.
+type Scheduler struct {
+	opts SchedulerOptions
+
+	mu      sync.Mutex
+	running int
+	memory  int64
+	queued  int
+	queues  map[string][]*ticket
+	order   []string // tenants with queued runs, next to start first
+}
+
+// ticket is a queued run; ready is closed once it may start.
+type ticket struct {
+	mem     int64
+	ready   chan struct{}
+	granted bool
+}
+
+// NewScheduler returns a scheduler enforcing opts.
+func NewScheduler(opts SchedulerOptions) *Scheduler {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = runtime.NumCPU()
+	}
+	return &Scheduler{opts: opts, queues: map[string][]*ticket{}}
+}
+
+// SchedulerStats is a snapshot of a scheduler's load.
+type SchedulerStats struct {
+	Running int
+	Queued  int
+	Memory  int64 // estimated bytes of the running runs
+}
+
+// Stats returns the scheduler's current load.
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SchedulerStats{Running: s.running, Queued: s.queued, Memory: s.memory}
+}
+
+// Run runs c with sim once the scheduler admits it, waiting in tenant's
+// queue until then. It fails with a *MemoryError if c can never fit,
+// ErrQueueFull if the queue is full, or ctx's error if ctx ends first; a
+// run that has started is not interrupted.
+func (s *Scheduler) Run(ctx context.Context, tenant string, sim *Simulator, c circuit.Circuit) (map[string]int, error) {
+	release, err := s.acquire(ctx, tenant, EstimateMemory(c, sim.Workers))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return sim.Run(c)
+}
+
+// acquire waits until a run of mem bytes may start and returns the
+// function that ends it.
+func (s *Scheduler) acquire(ctx context.Context, tenant string, mem int64) (func(), error) {
+	for _, limit := range []int64{s.opts.MaxRunMemory, s.opts.MaxMemory} {
+		if limit > 0 && mem > limit {
+			return nil, &MemoryError{Need: mem, Limit: limit}
+		}
+	}
+	release := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.running--
+		s.memory -= mem
+		s.dispatch()
+	}
+
+	s.mu.Lock()
+	if s.queued == 0 && s.fits(mem) {
+		s.running++
+		s.memory += mem
+		s.mu.Unlock()
+		return release, nil
+	}
+	if s.opts.MaxQueued > 0 && s.queued >= s.opts.MaxQueued {
+		s.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	t := &ticket{mem: mem, ready: make(chan struct{})}
+	if len(s.queues[tenant]) == 0 {
+		s.order = append(s.order, tenant)
+	}
+	s.queues[tenant] = append(s.queues[tenant], t)
+	s.queued++
+	s.mu.Unlock()
+
+	select {
+	case <-t.ready:
+		return release, nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.granted {
+		// Admitted while giving up: hand the capacity on.
+		s.running--
+		s.memory -= mem
+		s.dispatch()
+		return nil, ctx.Err()
+	}
+	q := slices.DeleteFunc(s.queues[tenant], func(o *ticket) bool { return o == t })
+	s.queues[tenant] = q
+	s.queued--
+	if len(q) == 0 {
+		delete(s.queues, tenant)
+		s.order = slices.DeleteFunc(s.order, func(o string) bool { return o == tenant })
+	}
+	s.dispatch() // t may have been blocking the head of the line
+	return nil, ctx.Err()
+}
+
+func (s *Scheduler) fits(mem int64) bool {
+	return s.running < s.opts.MaxConcurrent && (s.opts.MaxMemory <= 0 || s.memory+mem <= s.opts.MaxMemory)
+}
+
+// dispatch starts queued runs while they fit, one per tenant in turn. The
+// caller holds s.mu.
+func (s *Scheduler) dispatch() {
+	for len(s.order) > 0 {
+		tenant := s.order[0]
+		q := s.queues[tenant]
+		t := q[0]
+		if !s.fits(t.mem) {
+			return
+		}
+		s.running++
+		s.memory += t.mem
+		s.queued--
+		t.granted = true
+		close(t.ready)
+		s.order = s.order[1:]
+		if len(q) == 1 {
+			delete(s.queues, tenant)
+		} else {
+			s.queues[tenant] = q[1:]
+			s.order = append(s.order, tenant)
+		}
+	}
+}
@@ -10,6 +10,26 @@ import (
 // a histogram mapping classical bit-strings (little-endian) to counts.
 // This method provides a simpler, non-concurrent alternative to Run.
 func (s *Simulator) RunSerial(c circuit.Circuit) (map[string]int, error) {
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	if len(s.PostSelect) > 0 {
+		hist, _, err := s.postSelected(c, (*Simulator).RunSerial)
+		return hist, err
+	}
+	if s.UniformNoise != 0 {
+		return s.withUniformNoise(c, (*Simulator).RunSerial)
+	}
+	c, project := s.plan(c)
+	if hist, ok, err := s.shortcut(c, project); ok {
+		return hist, err
+	}
+	if hist, ok, err := s.sample(c, project); ok {
+		return hist, err
+	}
+	if s.Seed != 0 || s.Progress != nil {
+		return s.runChunked(c, project)
+	}
 
 	s.log.Info().
 		Int("shots", s.Shots).
@@ -18,17 +38,15 @@ func (s *Simulator) RunSerial(c circuit.Circuit) (map[string]int, error) {
 		Int("depth", c.Depth()).
 		Msg("simulator: Starting RunSerial")
 
-	hist := make(map[string]int)
-
+	t := s.newTally(c)
 	for i := range s.Shots {
-		key, err := s.runner.RunOnce(c) // Run the circuit once
-		if err != nil {
+		if err := t.shot(s, c); err != nil { // Run the circuit once
 			err = fmt.Errorf("shot %d failed: %w", i+1, err)
 			s.log.Error().Err(err).Int("shot", i+1).Msg("simulator: Serial shot failed")
-			return hist, err
+			return mergeTallies([]*tally{t}, c.Clbits(), project), err
 		}
-		hist[key]++
 	}
+	hist := mergeTallies([]*tally{t}, c.Clbits(), project)
 
 	s.log.Info().Int("shots", s.Shots).Msg("simulator: RunSerial finished successfully")
 	return hist, nil
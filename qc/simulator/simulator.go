@@ -15,8 +15,67 @@ type SimulatorOptions struct {
 	Workers     int // number of concurrent workers (0 => NumCPU)
 	Runner      OneShotRunner
 	StateVector bool // if true, the simulator returns the state vector instead of measurement outcomes
+	// IncludeUnmeasured appends "|" and the sampled values of never-measured
+	// qubits (ascending) to every key. It is a debugging aid and needs the
+	// statevector sampling path (see Run).
+	IncludeUnmeasured bool
+	// PostSelect maps classical bits to the value (0 or 1) every kept shot
+	// must have measured into them. Other shots are discarded and replaced
+	// until Shots shots are kept; RunResult reports the acceptance rate.
+	PostSelect map[int]int
+	// NoTaper turns off the automatic removal of trivial qubits (see Taper)
+	// before the circuit is handed to the runner.
+	NoTaper bool
+	// NoLightCone turns off the automatic restriction to the operations in
+	// the measurements' light cone (see LightCone).
+	NoLightCone bool
+	// Seed, when non-zero, makes runs reproducible: shots are split into
+	// chunks of ChunkShots (0 => 64), each drawing from its own source
+	// seeded from Seed and its index, and merged in chunk order (see
+	// RunChunks). It needs a runner implementing RandRunner.
+	Seed       int64
+	ChunkShots int
+	// Progress, if set, is called with every chunk of a run as it
+	// completes, from the worker that ran it, so calls may be concurrent
+	// and out of order. Shot-by-shot runs are then split into chunks even
+	// when unseeded; runs sampling the final statevector report a chunk as
+	// its shots are drawn, and deterministic circuits (see NoShortcut) all
+	// shots in one chunk.
+	Progress func(ChunkResult)
+	// NoShortcut turns off running deterministic circuits (see
+	// DeterministicOutcome) only once.
+	NoShortcut bool
+	// UniformNoise, in [0, 1], replaces each shot with that probability by
+	// a uniformly random outcome, mixing the ideal distribution with the
+	// uniform one. It is a teaching aid for showing how robust an
+	// algorithm's answer is, without setting up a NoiseModel. Shots are
+	// perturbed before post-selection.
+	UniformNoise float64
+	// Profile makes RunResult time every operation the runner executes,
+	// by gate type and by layer, into Result.Profile. It needs a runner
+	// implementing ProfilingRunner.
+	Profile bool
+	// Calibration, if set, replaces the runner's built-in cost model in
+	// the time estimates of Validate.
+	Calibration *Calibration
+	// MinCounts, if positive, makes Run and RunResult choose the shots per
+	// circuit so each outcome of its measured bits is expected at least
+	// MinCounts times, Shots being the minimum and MaxShots (0 =>
+	// DefaultMaxShots) the maximum; see PlanShots. The choice is logged
+	// and reported in Result.ShotPlan.
+	MinCounts int
+	MaxShots  int
+	// Tolerance is how far the norm of a RunFrom initial state or the
+	// total weight of a RunMixed mixture may be from 1; 0 =>
+	// DefaultTolerance. Runners are not configured with it: the
+	// probability below which qsim prunes outcomes is its own
+	// "prune_tolerance" option.
+	Tolerance float64
 }
 
+// DefaultTolerance is the Tolerance of simulators that set none.
+const DefaultTolerance = 1e-9
+
 // Simulator executes an immutable circuit for a given number of shots.
 // It uses a pool of worker goroutines (Workers==0 → NumCPU) to run shots
 // in parallel.  The implementation relies only on public symbols that
@@ -27,7 +86,24 @@ type Simulator struct {
 	Workers int // number of concurrent workers (0 => NumCPU)
 	runner  OneShotRunner
 
-	log logger.Logger
+	IncludeUnmeasured bool
+	PostSelect        map[int]int
+	NoTaper           bool
+	NoLightCone       bool
+	Seed              int64
+	ChunkShots        int
+	Progress          func(ChunkResult)
+	NoShortcut        bool
+	UniformNoise      float64
+	Profile           bool
+	Calibration       *Calibration
+	MinCounts         int
+	MaxShots          int
+	Tolerance         float64
+
+	pool  *Pool  // nil: start goroutines per run
+	meter *meter // set by RunMetered
+	log   logger.Logger
 }
 
 func (s *Simulator) Runner() OneShotRunner {
@@ -50,11 +126,24 @@ func NewSimulator(options SimulatorOptions) *Simulator {
 	}
 
 	return &Simulator{Shots: shots, Workers: workers, runner: options.Runner,
+		IncludeUnmeasured: options.IncludeUnmeasured, PostSelect: options.PostSelect,
+		NoTaper: options.NoTaper, NoLightCone: options.NoLightCone,
+		Seed: options.Seed, ChunkShots: options.ChunkShots, Progress: options.Progress, NoShortcut: options.NoShortcut,
+		UniformNoise: options.UniformNoise, Profile: options.Profile, Calibration: options.Calibration,
+		MinCounts: options.MinCounts, MaxShots: options.MaxShots, Tolerance: options.Tolerance,
 		log: *logger.NewLogger(logger.LoggerOptions{
 			Debug: false,
 		})}
 }
 
+// tolerance returns Tolerance, or DefaultTolerance if it is not positive.
+func (s *Simulator) tolerance() float64 {
+	if s.Tolerance <= 0 {
+		return DefaultTolerance
+	}
+	return s.Tolerance
+}
+
 // SetVerbose make the simulator log all messages (debug level).
 func (s *Simulator) SetVerbose(verbose bool) {
 	if verbose {
@@ -71,7 +160,14 @@ type OneShotRunner interface {
 }
 
 // Run defaults to RunParallelStatic.
+//
+// Histogram keys list only the classical bits the circuit measures into,
+// lowest cbit first. When the runner implements StatevectorGetter and all
+// measurements are terminal, every Run* method computes the final state once
+// and samples the shots from it instead of replaying the circuit per shot.
+// With MinCounts set it runs PlanShots(c) shots instead of Shots.
 func (s *Simulator) Run(c circuit.Circuit) (map[string]int, error) {
+	s, _ = s.planned(c)
 	return s.RunParallelStatic(c)
 }
 
@@ -84,6 +180,25 @@ func (s *Simulator) GetStatevector(c circuit.Circuit) ([]complex128, error) {
 	return nil, fmt.Errorf("runner does not support getting the state vector")
 }
 
+// checkCapabilities rejects circuits the runner declares it cannot execute:
+// control flow without the capability, and gates outside those a
+// ValidatingRunner supports, reported as an *UnsupportedGateError before
+// any shot runs. Runners that do not describe themselves are trusted.
+func (s *Simulator) checkCapabilities(c circuit.Circuit) error {
+	name := fmt.Sprintf("%T", s.runner)
+	if bp, ok := s.runner.(BackendProvider); ok {
+		info := bp.GetBackendInfo()
+		name = info.ShortName
+		if circuit.HasControlFlow(c) && !info.Capabilities["control_flow"] {
+			return fmt.Errorf("simulator: runner %s does not support classical control flow", info.ShortName)
+		}
+	}
+	if vr, ok := s.runner.(ValidatingRunner); ok {
+		return CheckGates(name, c, vr.GetSupportedGates())
+	}
+	return nil
+}
+
 // NewSimulatorWithRunner creates a simulator using a named runner from the plugin registry.
 func NewSimulatorWithRunner(runnerName string, options SimulatorOptions) (*Simulator, error) {
 	runner, err := CreateRunner(runnerName)
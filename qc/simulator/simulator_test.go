@@ -1,14 +1,20 @@
 package simulator
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/rand"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/kegliz/qcm/qc/builder"
 	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -251,3 +257,913 @@ func TestSimulator_RunParallelChan(t *testing.T) {
 		t.Logf("RunParallelChan with error completed %d calls out of %d shots. Hist: %v, Err: %v", mockRunner.CallCount(), shots, hist, err)
 	})
 }
+
+// svRunner is a mock runner that also hands out a fixed final statevector.
+type svRunner struct {
+	*mockOneShotRunner
+	sv []complex128
+}
+
+func (r svRunner) GetStatevector(circuit.Circuit) ([]complex128, error) { return r.sv, nil }
+
+func TestSimulator_MeasuredSubset(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// 3 qubits, only qubit 2 is measured, into cbit 1 of 3.
+	b := builder.New(builder.Q(3), builder.C(3))
+	b.X(0).H(2).Measure(2, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	t.Run("PerShotKeysAreProjected", func(t *testing.T) {
+		mock := newMockOneShotRunner(func(circuit.Circuit, int) (string, error) { return "010", nil })
+		sim := NewSimulator(SimulatorOptions{Shots: 10, Workers: 2, Runner: mock})
+		for _, run := range []func(circuit.Circuit) (map[string]int, error){sim.RunSerial, sim.RunParallelStatic, sim.RunParallelChan} {
+			hist, err := run(c)
+			require.NoError(err)
+			assert.Equal(map[string]int{"1": 10}, hist, "only the written cbit should appear in keys")
+		}
+	})
+
+	// |q2 q1 q0⟩ = (|001⟩ + |101⟩)/√2
+	amp := complex(1/math.Sqrt2, 0)
+	sv := make([]complex128, 8)
+	sv[0b001], sv[0b101] = amp, amp
+
+	t.Run("SampledFromStatevector", func(t *testing.T) {
+		mock := newMockOneShotRunner(nil)
+		// The canned statevector is for all 3 qubits, so keep every qubit.
+		sim := NewSimulator(SimulatorOptions{Shots: 2000, Runner: svRunner{mock, sv}, NoTaper: true, NoLightCone: true})
+		hist, err := sim.Run(c)
+		require.NoError(err)
+		assert.Equal(0, mock.CallCount(), "terminal measurements should not replay the circuit")
+		assert.Equal(2000, hist["0"]+hist["1"])
+		assert.InDelta(1000, hist["1"], 150)
+	})
+
+	t.Run("IncludeUnmeasured", func(t *testing.T) {
+		sim := NewSimulator(SimulatorOptions{Shots: 200, Runner: svRunner{newMockOneShotRunner(nil), sv}, IncludeUnmeasured: true})
+		hist, err := sim.Run(c)
+		require.NoError(err)
+		for k := range hist {
+			assert.Contains([]string{"0|10", "1|10"}, k, "unmeasured qubits 0 and 1 should read 1 and 0")
+		}
+
+		sim = NewSimulator(SimulatorOptions{Shots: 10, Runner: newMockOneShotRunner(nil), IncludeUnmeasured: true})
+		_, err = sim.Run(c)
+		assert.Error(err, "per-shot runners cannot report unmeasured qubits")
+	})
+
+	t.Run("LastMeasurementWins", func(t *testing.T) {
+		// Qubit 1's measurement overwrites qubit 0's: cbit 0 is the H
+		// qubit's coin, not 1 whenever either qubit reads 1.
+		c, err := builder.New(builder.Q(2), builder.C(1)).X(0).H(1).Measure(0, 0).Measure(1, 0).BuildCircuit()
+		require.NoError(err)
+		src := CbitSources(c.Clbits(), c.OpsIter())
+		assert.Equal([]int{1}, src)
+		assert.Equal("0", OutcomeKey(src, 0b01))
+		assert.Equal("1", OutcomeKey(src, 0b11))
+
+		sv := make([]complex128, 4)
+		sv[0b01], sv[0b11] = amp, amp
+		sim := NewSimulator(SimulatorOptions{Shots: 2000, Runner: svRunner{newMockOneShotRunner(nil), sv}, NoTaper: true, NoLightCone: true})
+		hist, err := sim.Run(c)
+		require.NoError(err)
+		assert.InDelta(1000, hist["1"], 150)
+		assert.InDelta(1000, hist["0"], 150)
+	})
+}
+
+func TestResult_Format(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// a[2] is cbits 0-1, b[1] is cbit 2.
+	b := builder.New(builder.Q(3), builder.CReg("a", 2), builder.CReg("b", 1))
+	b.Measure(0, 0).Measure(1, 1).Measure(2, 2)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+	assert.Equal([]circuit.Register{{Name: "a", Start: 0, Size: 2}, {Name: "b", Start: 2, Size: 1}}, c.CRegs())
+
+	// a[0]=1, a[1]=0, b[0]=1
+	mock := newMockOneShotRunner(func(circuit.Circuit, int) (string, error) { return "101", nil })
+	res, err := NewSimulator(SimulatorOptions{Shots: 4, Runner: mock}).RunResult(c)
+	require.NoError(err)
+	assert.Equal(map[string]int{"101": 4}, res.Counts)
+	assert.Equal([]int{0, 1, 2}, res.Cbits)
+
+	assert.Equal("10 1", res.FormatKey("101", KeyFormat{GroupRegisters: true}))
+	assert.Equal("1 01", res.FormatKey("101", KeyFormat{Order: MSBFirst, GroupRegisters: true}))
+	assert.Equal("101", res.FormatKey("101", KeyFormat{Order: MSBFirst}))
+	assert.Equal(map[string]int{"1 01": 4}, res.Format(KeyFormat{Order: MSBFirst, GroupRegisters: true}))
+	assert.Equal("10 1|01", res.FormatKey("101|01", KeyFormat{GroupRegisters: true}), "debug suffix is kept")
+	assert.Equal("1", res.FormatKey("1", KeyFormat{GroupRegisters: true}), "foreign keys pass through")
+
+	_, err = builder.New(builder.Q(1), builder.CReg("a", 1), builder.CReg("a", 1)).BuildCircuit()
+	assert.Error(err, "register names must be unique")
+}
+
+func TestSimulator_CompareRuns(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	// The mock reports how many operations the executed circuit had, so
+	// inserted Pauli errors are visible in the keys.
+	mock := newMockOneShotRunner(func(c circuit.Circuit, _ int) (string, error) {
+		if len(c.Operations()) > 4 {
+			return "11", nil
+		}
+		return "00", nil
+	})
+	sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 2, Runner: mock})
+
+	cmp, err := sim.CompareRuns(c, NoiseModel{})
+	require.NoError(err)
+	assert.Equal(map[string]int{"00": 100}, cmp.Ideal)
+	assert.Equal(cmp.Ideal, cmp.Noisy)
+	assert.Zero(cmp.TVD)
+	assert.InDelta(1, cmp.Fidelity, 1e-12)
+
+	cmp, err = sim.CompareRuns(c, NoiseModel{Readout: 1})
+	require.NoError(err)
+	assert.Equal(map[string]int{"11": 100}, cmp.Noisy, "every bit flips")
+	assert.InDelta(1, cmp.TVD, 1e-12)
+	assert.Zero(cmp.Fidelity)
+
+	cmp, err = sim.CompareRuns(c, NoiseModel{Depolarizing: 1})
+	require.NoError(err)
+	assert.Equal(map[string]int{"11": 100}, cmp.Noisy, "every gate gets an error")
+	assert.Equal(map[string]int{"00": 100}, cmp.Ideal)
+
+	_, err = sim.CompareRuns(c, NoiseModel{Readout: 1.5})
+	assert.Error(err)
+
+	tvd, fid := divergence(map[string]int{"0": 50, "1": 50}, map[string]int{"0": 100})
+	assert.InDelta(0.5, tvd, 1e-12)
+	assert.InDelta(0.5, fid, 1e-12)
+}
+
+func TestResult_ProbabilityCI(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := &Result{Counts: map[string]int{"0": 81, "1": 182}, Shots: 263}
+	assert.InDelta(182.0/263, r.Probability("1"), 1e-12)
+
+	// Reference values: the Wilson formula evaluated directly, and the exact
+	// bounds where the binomial tails equal 2.5%.
+	lo, hi, err := r.ProbabilityCI("1", 0.95)
+	require.NoError(err)
+	assert.InDelta(0.63379, lo, 1e-5)
+	assert.InDelta(0.74471, hi, 1e-5)
+
+	lo, hi, err = r.ProbabilityCIWith("1", 0.95, ClopperPearson)
+	require.NoError(err)
+	assert.InDelta(0.63238, lo, 1e-5)
+	assert.InDelta(0.74726, hi, 1e-5)
+
+	// A never-seen outcome still gets a non-trivial upper bound.
+	lo, hi, err = r.ProbabilityCIWith("2", 0.95, ClopperPearson)
+	require.NoError(err)
+	assert.Zero(lo)
+	assert.InDelta(1-math.Pow(0.025, 1.0/263), hi, 1e-9)
+
+	_, _, err = r.ProbabilityCI("1", 1)
+	assert.Error(err)
+	_, _, err = (&Result{}).ProbabilityCI("1", 0.95)
+	assert.Error(err)
+
+	n, err := SufficientShots(0.01, 0.95)
+	require.NoError(err)
+	assert.Equal(9604, n)
+	_, err = SufficientShots(0, 0.95)
+	assert.Error(err)
+}
+
+func TestSimulator_PostSelect(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(2), builder.C(2))
+	b.H(0).H(1).Measure(0, 0).Measure(1, 1)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	keys := []string{"00", "01", "10", "11"}
+	mock := newMockOneShotRunner(func(_ circuit.Circuit, n int) (string, error) { return keys[n%4], nil })
+	sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 3, Runner: mock, PostSelect: map[int]int{0: 1}})
+
+	for _, run := range []func(circuit.Circuit) (map[string]int, error){sim.RunSerial, sim.RunParallelStatic, sim.RunParallelChan} {
+		hist, err := run(c)
+		require.NoError(err)
+		total := 0
+		for k, n := range hist {
+			assert.Equal(byte('1'), k[0], "key %s violates post-selection", k)
+			total += n
+		}
+		assert.Equal(100, total, "post-selection keeps exactly Shots shots")
+	}
+
+	res, err := sim.RunResult(c)
+	require.NoError(err)
+	assert.InDelta(0.5, res.Acceptance, 0.05)
+
+	sim.PostSelect = map[int]int{0: 1, 1: 0}
+	mock = newMockOneShotRunner(func(circuit.Circuit, int) (string, error) { return "11", nil })
+	sim.runner = mock
+	_, err = sim.Run(c)
+	assert.ErrorContains(err, "accepted 0", "unsatisfiable post-selection gives up")
+
+	sim.PostSelect = map[int]int{5: 1}
+	_, err = sim.Run(c)
+	assert.ErrorContains(err, "never measured")
+}
+
+func TestTaper(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// q1 idle, q3 only sees diagonal gates, q4 shares cbit 2 with q2.
+	b := builder.New(builder.Q(5), builder.C(4))
+	b.H(0).CNOT(0, 2).Z(3).CZ(3, 0).S(3).Measure(0, 0).Measure(3, 1)
+	b.Measure(4, 2).Measure(2, 2)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	reduced, kept, err := Taper(c)
+	require.NoError(err)
+	assert.Equal([]int{0, 2, 4}, kept)
+	assert.Equal(3, reduced.Qubits())
+	assert.Equal(c.Clbits(), reduced.Clbits())
+	for _, op := range reduced.Operations() {
+		assert.NotContains([]string{"Z", "CZ", "S"}, op.G.Name(), "ops on tapered qubits are dropped")
+	}
+
+	same, kept, err := Taper(newTestCircuit(t))
+	require.NoError(err)
+	assert.Equal([]int{0}, kept)
+	assert.Equal(1, same.Qubits())
+
+	// The runner sees the tapered circuit; keys still cover every measured cbit.
+	var widths []int
+	mock := newMockOneShotRunner(func(c circuit.Circuit, _ int) (string, error) {
+		widths = append(widths, c.Qubits())
+		return "1001", nil
+	})
+	sim := NewSimulator(SimulatorOptions{Shots: 4, Workers: 1, Runner: mock})
+	hist, err := sim.RunSerial(c)
+	require.NoError(err)
+	assert.Equal(map[string]int{"100": 4}, hist)
+	assert.Equal([]int{3, 3, 3, 3}, widths)
+
+	sim = NewSimulator(SimulatorOptions{Shots: 1, Runner: mock, NoTaper: true, NoLightCone: true})
+	widths = nil
+	_, err = sim.RunSerial(c)
+	require.NoError(err)
+	assert.Equal([]int{5}, widths)
+}
+
+func TestLightCone(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Only q0 is measured. q1 feeds it through the CNOT; q2 and q3 are
+	// spectators, and the H on q0 after the measurement is irrelevant.
+	b := builder.New(builder.Q(4), builder.C(1))
+	b.H(1).H(2).CNOT(2, 3).CNOT(1, 0).X(3).Measure(0, 0).H(0)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	cone, kept, err := LightCone(c)
+	require.NoError(err)
+	assert.Equal([]int{0, 1}, kept)
+	var names []string
+	for _, op := range cone.Operations() {
+		names = append(names, op.G.Name())
+	}
+	assert.Equal([]string{"H", "CNOT", "MEASURE"}, names)
+	assert.Equal([]int{1, 0}, cone.Operations()[1].Qubits, "qubits are renumbered densely")
+
+	var widths []int
+	mock := newMockOneShotRunner(func(c circuit.Circuit, _ int) (string, error) {
+		widths = append(widths, c.Qubits())
+		return "1", nil
+	})
+	for _, off := range []bool{false, true} {
+		widths = nil
+		sim := NewSimulator(SimulatorOptions{Shots: 1, Runner: mock, NoLightCone: off, NoTaper: true})
+		_, err := sim.RunSerial(c)
+		require.NoError(err)
+		if off {
+			assert.Equal([]int{4}, widths)
+		} else {
+			assert.Equal([]int{2}, widths)
+		}
+	}
+}
+
+// outcomeRunner reports integer outcomes only; RunOnce must not be used.
+type outcomeRunner struct {
+	calls atomic.Int32
+}
+
+func (r *outcomeRunner) RunOnce(circuit.Circuit) (string, error) {
+	return "", fmt.Errorf("RunOnce called on an OutcomeRunner")
+}
+
+func (r *outcomeRunner) RunOnceOutcome(circuit.Circuit) (uint64, error) {
+	if r.calls.Add(1)%2 == 0 {
+		return 0b101, nil
+	}
+	return 0, nil
+}
+
+func TestTallyOutcomes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// cbit 1 is never written, so keys list cbits 0 and 2.
+	c, err := builder.New(builder.Q(2), builder.C(3)).H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 2).BuildCircuit()
+	require.NoError(err)
+	sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 4, Runner: &outcomeRunner{}})
+	for name, run := range map[string]func(circuit.Circuit) (map[string]int, error){
+		"Static": sim.RunParallelStatic, "Chan": sim.RunParallelChan, "Serial": sim.RunSerial,
+	} {
+		hist, err := run(c)
+		require.NoError(err, name)
+		assert.Equal(map[string]int{"00": 50, "11": 50}, hist, name)
+	}
+
+	// Mixed tallies merge into one histogram.
+	keyed := &tally{keys: map[string]int{"101": 2, "000": 1}}
+	dense := &tally{dense: []int{0: 3, 5: 4, 7: 1}}
+	project := projectKeys([]int{0, 2}, 3)
+	assert.Equal(map[string]int{"00": 4, "11": 7}, mergeTallies([]*tally{keyed, dense}, 3, project))
+}
+
+func TestRunChunks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := newTestCircuit(t)
+	_, err := NewSimulator(SimulatorOptions{Shots: 10, Runner: newMockOneShotRunner(nil)}).RunChunks(c)
+	assert.ErrorContains(err, "non-zero Seed")
+	_, err = NewSimulator(SimulatorOptions{Shots: 10, Runner: newMockOneShotRunner(nil), Seed: 1}).Run(c)
+	assert.ErrorContains(err, "RandRunner")
+
+	sim := NewSimulator(SimulatorOptions{Shots: 10, Workers: 3, Seed: 1, ChunkShots: 4})
+	chunks, err := sim.runChunks(func(rng *rand.Rand) (string, error) { return fmt.Sprint(rng.Intn(2)), nil })
+	require.NoError(err)
+	require.Len(chunks, 3)
+	for i, ch := range chunks {
+		assert.Equal(i, ch.Index)
+		assert.Equal(chunkSeed(1, i), ch.Seed)
+		assert.Equal(min(4, 10-4*i), ch.Shots)
+	}
+	assert.Equal(10, mergeChunks(chunks)["0"]+mergeChunks(chunks)["1"])
+
+	var mu sync.Mutex
+	reported := 0
+	sim.Progress = func(ch ChunkResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported += ch.Shots
+	}
+	_, err = sim.runChunks(func(rng *rand.Rand) (string, error) { return "0", nil })
+	require.NoError(err)
+	assert.Equal(10, reported, "every chunk is reported")
+	sim.Progress = nil
+
+	calls := atomic.Int32{}
+	_, err = sim.runChunks(func(*rand.Rand) (string, error) {
+		if calls.Add(1) > 2 {
+			return "", fmt.Errorf("boom")
+		}
+		return "0", nil
+	})
+	assert.ErrorContains(err, "boom")
+}
+
+func TestProgress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// progress returns a Progress callback and the shots it has been
+	// reported so far.
+	progress := func() (func(ChunkResult), func() int) {
+		var mu sync.Mutex
+		shots := 0
+		return func(ch ChunkResult) {
+				mu.Lock()
+				defer mu.Unlock()
+				shots += ch.Shots
+			}, func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return shots
+			}
+	}
+	bell, err := builder.New(builder.Q(2), builder.C(2)).H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	det, err := builder.New(builder.Q(1), builder.C(1)).X(0).Measure(0, 0).BuildCircuit()
+	require.NoError(err)
+	sv := []complex128{complex(1/math.Sqrt2, 0), 0, 0, complex(1/math.Sqrt2, 0)}
+
+	// Unseeded shot-by-shot runs report every shot without being seeded.
+	sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 3, ChunkShots: 16, Runner: newMockOneShotRunner(nil)})
+	for name, run := range map[string]func(circuit.Circuit) (map[string]int, error){
+		"serial": sim.RunSerial, "static": sim.RunParallelStatic, "chan": sim.RunParallelChan,
+	} {
+		report, reported := progress()
+		sim.Progress = report
+		hist, err := run(newTestCircuit(t))
+		require.NoError(err, name)
+		assert.Equal(map[string]int{"0": 100}, hist, name)
+		assert.Equal(100, reported(), name)
+		assert.Zero(sim.Seed, name)
+	}
+
+	// Sampled, deterministic and noisy runs report too.
+	report, reported := progress()
+	sampled := NewSimulator(SimulatorOptions{Shots: 100, ChunkShots: 16, Runner: svRunner{newMockOneShotRunner(nil), sv},
+		NoTaper: true, NoLightCone: true, Progress: report})
+	_, err = sampled.Run(bell)
+	require.NoError(err)
+	assert.Equal(100, reported(), "sampled")
+
+	report, reported = progress()
+	_, err = NewSimulator(SimulatorOptions{Shots: 100, Runner: newMockOneShotRunner(nil), Progress: report}).Run(det)
+	require.NoError(err)
+	assert.Equal(100, reported(), "deterministic")
+
+	report, reported = progress()
+	_, err = NewSimulator(SimulatorOptions{Shots: 100, ChunkShots: 16, Runner: newMockOneShotRunner(nil), Progress: report}).
+		RunNoisy(newTestCircuit(t), NoiseModel{Depolarizing: 0.1})
+	require.NoError(err)
+	assert.Equal(100, reported(), "noisy")
+}
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := builder.New(builder.Q(2), builder.C(3)).H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 2).BuildCircuit()
+	require.NoError(err)
+	p := NewPool(SimulatorOptions{Shots: 100, Workers: 3, Runner: &outcomeRunner{}})
+	before := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sim := p.Simulator()
+			assert.Equal(3, sim.Workers)
+			for _, run := range []func(circuit.Circuit) (map[string]int, error){sim.RunParallelStatic, sim.RunParallelChan} {
+				hist, err := run(c)
+				assert.NoError(err)
+				assert.Equal(100, hist["00"]+hist["11"], "the runner alternates across all runs")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(runtime.NumGoroutine(), before, "runs start no goroutines of their own")
+	assert.NotEmpty(p.bufs[8], "count buffers are recycled")
+
+	sim := p.Simulator()
+	sim.Seed, sim.ChunkShots = 1, 7
+	chunks, err := sim.runChunks(func(rng *rand.Rand) (string, error) { return fmt.Sprint(rng.Intn(2)), nil })
+	require.NoError(err)
+	assert.Len(chunks, 15)
+
+	// A closed pool's simulators still run.
+	p.Close()
+	p.Close()
+	hist, err := p.Run(c)
+	require.NoError(err)
+	assert.Equal(100, hist["00"]+hist["11"])
+}
+
+func TestScheduler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	s := NewScheduler(SchedulerOptions{MaxConcurrent: 1, MaxQueued: 3})
+	release, err := s.acquire(ctx, "a", 0)
+	require.NoError(err)
+
+	// Queue a2, a3 then b1 behind the running job; tenants take turns.
+	var mu sync.Mutex
+	var started []string
+	var wg sync.WaitGroup
+	for i, job := range []string{"a2", "a3", "b1"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := s.acquire(ctx, job[:1], 0)
+			assert.NoError(err)
+			mu.Lock()
+			started = append(started, job)
+			mu.Unlock()
+			r()
+		}()
+		require.Eventually(func() bool { return s.Stats().Queued == i+1 }, time.Second, time.Millisecond)
+	}
+	_, err = s.acquire(ctx, "c", 0)
+	assert.ErrorIs(err, ErrQueueFull)
+
+	// A cancelled wait leaves the queue.
+	cctx, cancel := context.WithCancel(ctx)
+	s.opts.MaxQueued = 0
+	done := make(chan error)
+	go func() { _, err := s.acquire(cctx, "c", 0); done <- err }()
+	require.Eventually(func() bool { return s.Stats().Queued == 4 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(<-done, context.Canceled)
+	assert.Equal(SchedulerStats{Running: 1, Queued: 3}, s.Stats())
+
+	release()
+	wg.Wait()
+	assert.Equal([]string{"a2", "b1", "a3"}, started)
+	assert.Equal(SchedulerStats{}, s.Stats())
+
+	// Memory limits.
+	c, err := builder.New(builder.Q(3), builder.C(3)).H(0).Measure(0, 0).BuildCircuit()
+	require.NoError(err)
+	assert.Equal(int64(16*8*2), EstimateMemory(c, 2))
+	sim := NewSimulator(SimulatorOptions{Shots: 10, Workers: 2, Runner: newMockOneShotRunner(nil)})
+	_, err = NewScheduler(SchedulerOptions{MaxRunMemory: 255}).Run(ctx, "a", sim, c)
+	var memErr *MemoryError
+	require.ErrorAs(err, &memErr)
+	assert.Equal(int64(256), memErr.Need)
+	hist, err := NewScheduler(SchedulerOptions{MaxRunMemory: 256, MaxMemory: 300}).Run(ctx, "a", sim, c)
+	require.NoError(err)
+	assert.Equal(10, hist["0"])
+
+	s = NewScheduler(SchedulerOptions{MaxConcurrent: 4, MaxMemory: 300})
+	release, err = s.acquire(ctx, "a", 200)
+	require.NoError(err)
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = s.acquire(tctx, "b", 200)
+	assert.ErrorIs(err, context.DeadlineExceeded, "waits for memory, not a slot")
+	release()
+}
+
+func TestRunMetered(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := newTestCircuit(t)
+	slow := newMockOneShotRunner(func(circuit.Circuit, int) (string, error) {
+		time.Sleep(time.Millisecond)
+		return "0", nil
+	})
+	sim := NewSimulator(SimulatorOptions{Shots: 20, Workers: 2, Runner: slow})
+	hist, u, err := sim.RunMetered(c, ResourceLimits{})
+	require.NoError(err)
+	assert.Equal(20, hist["0"])
+	assert.GreaterOrEqual(u.CPUTime, 20*time.Millisecond)
+	assert.Equal(int64(2*32), u.PeakMemory)
+	assert.Nil(sim.meter, "the simulator itself is not metered")
+
+	slow.Reset()
+	sim.Shots = 1000
+	_, u, err = sim.RunMetered(c, ResourceLimits{CPUTime: 10 * time.Millisecond})
+	assert.ErrorIs(err, ErrResourceLimit)
+	assert.Less(slow.CallCount(), 100, "the run stops soon after the limit")
+	assert.GreaterOrEqual(u.CPUTime, 10*time.Millisecond)
+
+	_, u, err = sim.RunMetered(c, ResourceLimits{Memory: 63})
+	assert.ErrorIs(err, ErrResourceLimit)
+	assert.Equal(int64(64), u.PeakMemory)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// A mid-circuit measurement runs shot by shot.
+	c, err := builder.New(builder.Q(2), builder.C(2)).
+		H(0).Measure(0, 0).CNOT(0, 1).Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	runner := newMockOneShotRunner(nil)
+	sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 4, Runner: runner})
+	r, err := sim.Validate(c)
+	require.NoError(err)
+	assert.Equal("*simulator.mockOneShotRunner", r.Runner)
+	assert.Equal(2, r.Qubits)
+	assert.Equal(4, r.Operations)
+	assert.False(r.Sampled)
+	assert.Equal(int64(4*64), r.Memory)
+	assert.Zero(r.Time, "no calibration for the mock")
+	assert.Contains(r.String(), "unknown (no calibration)")
+	assert.Zero(runner.CallCount(), "nothing runs")
+
+	sim.Calibration = &Calibration{PerOp: time.Millisecond, Qubits: 1, Growth: 2}
+	r, err = sim.Validate(c)
+	require.NoError(err)
+	assert.Equal(4*2*time.Millisecond*25, r.Time, "4 ops at 2 ms, 25 shots per worker")
+	assert.Contains(r.String(), "status:     ok")
+
+	// Statevector runners sample terminal measurements once.
+	bell, err := builder.New(builder.Q(2), builder.C(2)).
+		H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	sim = NewSimulator(SimulatorOptions{Shots: 100, Workers: 1, Runner: svRunner{mockOneShotRunner: runner},
+		Calibration: &Calibration{PerOp: time.Millisecond, Qubits: 2, Growth: 2}, PostSelect: map[int]int{0: 1, 5: 0}})
+	r, err = sim.Validate(bell)
+	assert.True(r.Sampled)
+	assert.Equal(4*time.Millisecond, r.Time)
+	assert.ErrorContains(err, "cbit 5 is never measured")
+	require.Len(r.Problems, 1)
+	assert.Contains(r.String(), "problem:")
+
+	b := builder.New(builder.Q(MaxStatevectorQubits+1), builder.C(MaxStatevectorQubits+1))
+	for q := range MaxStatevectorQubits + 1 {
+		b.H(q).Measure(q, q)
+	}
+	wide, err := b.BuildCircuit()
+	require.NoError(err)
+	sim.PostSelect = nil
+	r, err = sim.Validate(wide)
+	var we *WidthError
+	assert.ErrorAs(err, &we)
+	assert.Equal("32.0 GiB", formatBytes(r.Memory))
+}
+
+func TestDeterministicOutcome(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cases := []struct {
+		name  string
+		build func(b builder.Builder)
+		key   string
+		ok    bool
+	}{
+		{"empty", func(b builder.Builder) {}, "000", true},
+		{"X", func(b builder.Builder) { b.X(0).Measure(0, 0).Measure(1, 1) }, "100", true},
+		{"HSSH", func(b builder.Builder) { b.H(1).S(1).S(1).H(1).Measure(1, 2) }, "001", true},
+		{"Y", func(b builder.Builder) { b.Y(2).Measure(2, 0) }, "100", true},
+		{"CNOT", func(b builder.Builder) { b.X(0).CNOT(0, 1).Measure(1, 1) }, "010", true},
+		{"CZ", func(b builder.Builder) { b.X(0).H(1).CZ(0, 1).H(1).Measure(1, 0) }, "100", true},
+		{"SWAP", func(b builder.Builder) { b.X(0).SWAP(0, 2).Measure(2, 2).Measure(0, 1) }, "001", true},
+		// Bernstein–Vazirani for s = 10 on qubits 0 and 1, ancilla on 2.
+		{"BV", func(b builder.Builder) {
+			b.X(2).H(0).H(1).H(2).CNOT(0, 2).H(0).H(1).Measure(0, 0).Measure(1, 1)
+		}, "100", true},
+		{"Bell", func(b builder.Builder) { b.H(0).CNOT(0, 1).Measure(0, 0).Measure(1, 1) }, "", false},
+		{"re-measure", func(b builder.Builder) { b.H(0).Measure(0, 0).Measure(0, 1) }, "", false},
+		{"non-Clifford", func(b builder.Builder) { b.RX(0.1, 0).Measure(0, 0) }, "", false},
+		{"conditional", func(b builder.Builder) {
+			b.X(0).Measure(0, 0).If(builder.Bit(0), func(b builder.Builder) { b.X(1) })
+		}, "", false},
+	}
+	for _, tc := range cases {
+		b := builder.New(builder.Q(3), builder.C(3))
+		tc.build(b)
+		c, err := b.BuildCircuit()
+		require.NoError(err, tc.name)
+		key, ok := DeterministicOutcome(c)
+		assert.Equal(tc.ok, ok, tc.name)
+		assert.Equal(tc.key, key, tc.name)
+	}
+
+	// The tableau has no statevector width limit.
+	c, err := builder.New(builder.Q(120), builder.C(2)).X(0).CNOT(0, 119).Measure(119, 1).BuildCircuit()
+	require.NoError(err)
+	key, ok := DeterministicOutcome(c)
+	assert.True(ok)
+	assert.Equal("01", key)
+}
+
+func TestDeterministicShortcut(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := builder.New(builder.Q(2), builder.C(2)).X(1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	for _, off := range []bool{false, true} {
+		runner := newMockOneShotRunner(func(circuit.Circuit, int) (string, error) { return "01", nil })
+		sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 4, Runner: runner, NoShortcut: off,
+			NoTaper: true, NoLightCone: true})
+		hist, err := sim.Run(c)
+		require.NoError(err)
+		assert.Equal(map[string]int{"01": 100}, hist)
+		if off {
+			assert.Equal(100, runner.CallCount())
+		} else {
+			assert.Equal(1, runner.CallCount())
+		}
+	}
+}
+
+func TestMetaSurvivesPasses(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := builder.New(builder.Q(3), builder.C(1)).
+		X(2).Annotate(map[string]string{"cal": "x2"}).Measure(2, 0).BuildCircuit()
+	require.NoError(err)
+	for name, pass := range map[string]func(circuit.Circuit) (circuit.Circuit, []int, error){"Taper": Taper, "LightCone": LightCone} {
+		out, _, err := pass(c)
+		require.NoError(err)
+		assert.Equal(circuit.Meta{"cal": "x2"}, out.Operations()[0].Meta, name)
+	}
+	table, err := NoiseModel{Depolarizing: 1}.compile(c)
+	require.NoError(err)
+	noisy := table.sample(rand.New(rand.NewSource(1)))
+	assert.Equal(circuit.Meta{"cal": "x2"}, noisy.Operations()[0].Meta)
+}
+
+func TestNoiseTable(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := builder.New(builder.Q(3), builder.C(2)).
+		H(0).CNOT(0, 1).Measure(1, 0).Toffoli(0, 1, 2).Measure(2, 1).BuildCircuit()
+	require.NoError(err)
+	rng := rand.New(rand.NewSource(1))
+
+	quiet, err := NoiseModel{}.compile(c)
+	require.NoError(err)
+	assert.Same(c, quiet.sample(rng), "shots without errors run the circuit itself")
+
+	// Every gate is followed by an error on each of its qubits, before
+	// anything else touches that qubit; measurements are not.
+	loud, err := NoiseModel{Depolarizing: 1}.compile(c)
+	require.NoError(err)
+	noisy := loud.sample(rng)
+	assert.Equal(c.NumOps()+1+2+3, noisy.NumOps())
+	assert.Equal(c.Qubits(), noisy.Qubits())
+	assert.Equal(c.Clbits(), noisy.Clbits())
+	pending := map[int]bool{} // qubits owing an error
+	for _, op := range noisy.OpsIter() {
+		switch name := op.G.Name(); {
+		case len(op.Qubits) == 1 && pending[op.Qubits[0]] && (name == "X" || name == "Y" || name == "Z"):
+			delete(pending, op.Qubits[0])
+		default:
+			for _, q := range op.Qubits {
+				assert.False(pending[q], "%s on qubit %d before its error", name, q)
+				pending[q] = name != "MEASURE"
+			}
+		}
+	}
+}
+
+func TestUniformNoise(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c, err := builder.New(builder.Q(2), builder.C(2)).X(1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	run := func(eps float64) map[string]int {
+		runner := newMockOneShotRunner(func(circuit.Circuit, int) (string, error) { return "01", nil })
+		sim := NewSimulator(SimulatorOptions{Shots: 4000, Workers: 4, Runner: runner, Seed: 7,
+			UniformNoise: eps, NoTaper: true, NoLightCone: true})
+		hist, err := sim.Run(c)
+		require.NoError(err)
+		return hist
+	}
+
+	assert.Equal(map[string]int{"01": 4000}, run(0))
+	assert.Equal(run(0.5), run(0.5), "seeded runs are reproducible")
+
+	// ε=1 spreads the shots evenly over all four outcomes.
+	hist := run(1)
+	assert.Len(hist, 4)
+	for k, n := range hist {
+		assert.InDelta(1000, n, 150, k)
+	}
+
+	// ε=0.4 keeps 60% of the shots and spreads the rest: p(01) = 0.7.
+	assert.InDelta(2800, run(0.4)["01"], 150)
+
+	sim := NewSimulator(SimulatorOptions{Shots: 10, UniformNoise: 1.5, Runner: newMockOneShotRunner(nil)})
+	_, err = sim.Run(c)
+	assert.Error(err)
+}
+
+func TestPlanShots(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(4), builder.C(5))
+	for q := range 4 {
+		b.H(q).Measure(q, q)
+	}
+	// A second copy of qubit 3 adds a cbit but no outcome.
+	c, err := b.Measure(3, 4).BuildCircuit()
+	require.NoError(err)
+
+	runner := newMockOneShotRunner(nil)
+	sim := NewSimulator(SimulatorOptions{Shots: 100, Workers: 2, Runner: runner})
+	assert.Equal(ShotPlan{Shots: 100, Bits: 4, Outcomes: 16}, sim.PlanShots(c), "no MinCounts")
+
+	sim.MinCounts = 50
+	p := sim.PlanShots(c)
+	assert.Equal(ShotPlan{Shots: 800, Bits: 4, Outcomes: 16, MinCounts: 50}, p)
+	assert.Contains(p.String(), "≥50 expected counts for each of 16 outcomes")
+
+	res, err := sim.RunResult(c)
+	require.NoError(err)
+	assert.Equal(800, res.Shots)
+	assert.Equal(800, runner.CallCount())
+	require.NotNil(res.ShotPlan)
+	assert.Equal(p, *res.ShotPlan)
+	assert.Equal(100, sim.Shots, "the simulator keeps its setting")
+	runner.Reset()
+	_, err = sim.Run(c)
+	require.NoError(err)
+	assert.Equal(800, runner.CallCount())
+
+	sim.MinCounts = 1
+	assert.Equal(100, sim.PlanShots(c).Shots, "never fewer than Shots")
+
+	sim.MinCounts, sim.MaxShots = 50, 500
+	p = sim.PlanShots(c)
+	assert.Equal(500, p.Shots)
+	assert.True(p.Capped)
+	assert.Contains(p.String(), "31.2 expected counts")
+}
+
+// opaqueGate is a gate no runner knows how to apply.
+type opaqueGate struct{}
+
+func (opaqueGate) Name() string       { return "FOO" }
+func (opaqueGate) QubitSpan() int     { return 2 }
+func (opaqueGate) DrawSymbol() string { return "F" }
+func (opaqueGate) Targets() []int     { return []int{0, 1} }
+func (opaqueGate) Controls() []int    { return []int{} }
+
+func TestUnsupportedGate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	supported := []string{"H", "X", "CNOT", "MEASURE"}
+
+	c, err := builder.New(builder.Q(3), builder.C(1)).
+		H(0).CNOT(0, 1).Apply(opaqueGate{}, 2, 0).Measure(0, 0).BuildCircuit()
+	require.NoError(err)
+	err = CheckGates("mock", c, supported)
+	var ue *UnsupportedGateError
+	require.ErrorAs(err, &ue)
+	assert.Equal(UnsupportedGateError{Runner: "mock", Gate: "FOO", Qubits: []int{2, 0}, Op: 2, Supported: supported}, *ue)
+	assert.Contains(err.Error(), "mock: unsupported gate FOO on qubits [2 0] at operation 2")
+	assert.Contains(err.Error(), "mock runs H, X, CNOT, MEASURE")
+	assert.Contains(err.Error(), "transpile.Basis(...)")
+
+	// Steps of composites are located by the qubits they act on.
+	wrap, err := gate.NewComposite("WRAP", 3, []gate.Step{{G: gate.H(), Qubits: []int{0}}, {G: opaqueGate{}, Qubits: []int{2, 1}}})
+	require.NoError(err)
+	c, err = builder.New(builder.Q(3), builder.C(1)).
+		RepeatUntil(builder.Bit(0), 2, func(b builder.Builder) { b.H(0).Measure(0, 0) }).
+		RepeatUntil(builder.Bit(0), 2, func(b builder.Builder) { b.Apply(wrap, 1, 2, 0) }).BuildCircuit()
+	require.NoError(err)
+	require.ErrorAs(CheckGates("mock", c, supported), &ue)
+	assert.Equal("FOO", ue.Gate)
+	assert.Equal("WRAP", ue.Composite)
+	assert.Equal([]int{0, 2}, ue.Qubits)
+	assert.Equal(1, ue.Op, "loop bodies carry the loop's index")
+	assert.NoError(CheckGates("mock", c, append(supported, "WRAP")), "runners may apply composites by name")
+
+	// The simulator rejects the circuit before the first shot.
+	runner := newMockFullFeaturedRunner()
+	runner.backendInfo.ShortName = "mock"
+	runner.backendInfo.Capabilities["control_flow"] = true
+	sim := NewSimulator(SimulatorOptions{Shots: 10, Workers: 2, Runner: runner})
+	_, err = sim.Run(c)
+	assert.ErrorAs(err, &ue)
+	assert.Zero(runner.CallCount())
+	r, err := sim.Validate(c)
+	assert.ErrorAs(err, &ue)
+	assert.Len(r.Problems, 1, "reported once")
+}
+
+func TestRunAttempts_NeedsLoopCountingRunner(t *testing.T) {
+	runner := newMockOneShotRunner(func(c circuit.Circuit, _ int) (string, error) {
+		return strings.Repeat("0", c.Clbits()), nil
+	})
+	sim := NewSimulator(SimulatorOptions{Shots: 10, Workers: 1, Runner: runner})
+
+	c, err := builder.New(builder.Q(1), builder.C(1)).
+		RepeatUntil(builder.Bit(0), 3, func(b builder.Builder) { b.H(0).Measure(0, 0) }).BuildCircuit()
+	require.NoError(t, err)
+	_, err = sim.RunAttempts(c)
+	assert.ErrorContains(t, err, "cannot count loop attempts")
+	assert.Zero(t, runner.CallCount())
+
+	// Circuits without loops need no counting.
+	c, err = builder.New(builder.Q(1), builder.C(1)).H(0).Measure(0, 0).BuildCircuit()
+	require.NoError(t, err)
+	res, err := sim.RunAttempts(c)
+	require.NoError(t, err)
+	assert.Empty(t, res.Attempts)
+	assert.Equal(t, 10, res.Counts["0"])
+}
@@ -0,0 +1,162 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+)
+
+// CIMethod selects how ProbabilityCI computes a binomial confidence interval.
+type CIMethod int
+
+const (
+	// Wilson is the Wilson score interval: cheap, and accurate even for
+	// probabilities near 0 or 1.
+	Wilson CIMethod = iota
+	// ClopperPearson is the exact (conservative) interval from the beta
+	// distribution.
+	ClopperPearson
+)
+
+// Probability returns the observed frequency of a raw key.
+func (r *Result) Probability(outcome string) float64 {
+	if r.Shots == 0 {
+		return 0
+	}
+	return float64(r.Counts[outcome]) / float64(r.Shots)
+}
+
+// ProbabilityCI returns a Wilson confidence interval for the probability of
+// a raw key, e.g. ProbabilityCI("00", 0.95). Prefer it to comparing counts
+// with a fixed fraction of the shots: the interval shrinks as shots grow.
+func (r *Result) ProbabilityCI(outcome string, confidence float64) (lo, hi float64, err error) {
+	return r.ProbabilityCIWith(outcome, confidence, Wilson)
+}
+
+// ProbabilityCIWith is ProbabilityCI with an explicit method.
+func (r *Result) ProbabilityCIWith(outcome string, confidence float64, m CIMethod) (lo, hi float64, err error) {
+	if confidence <= 0 || confidence >= 1 {
+		return 0, 0, fmt.Errorf("simulator: confidence %v out of (0,1)", confidence)
+	}
+	if r.Shots <= 0 {
+		return 0, 0, fmt.Errorf("simulator: result has no shots")
+	}
+	k, n := r.Counts[outcome], r.Shots
+	switch m {
+	case Wilson:
+		lo, hi = wilson(k, n, confidence)
+	case ClopperPearson:
+		lo, hi = clopperPearson(k, n, confidence)
+	default:
+		return 0, 0, fmt.Errorf("simulator: unknown CI method %d", m)
+	}
+	return lo, hi, nil
+}
+
+// SufficientShots estimates how many shots make the confidence interval of
+// any outcome probability at most ±margin wide. It assumes the worst case
+// p = 1/2, so it is an upper bound.
+func SufficientShots(margin, confidence float64) (int, error) {
+	if margin <= 0 || margin >= 1 {
+		return 0, fmt.Errorf("simulator: margin %v out of (0,1)", margin)
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return 0, fmt.Errorf("simulator: confidence %v out of (0,1)", confidence)
+	}
+	z := zScore(confidence)
+	return int(math.Ceil(z * z / (4 * margin * margin))), nil
+}
+
+// zScore is the two-sided standard normal quantile for a confidence level.
+func zScore(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+func wilson(k, n int, confidence float64) (lo, hi float64) {
+	z := zScore(confidence)
+	p, nf := float64(k)/float64(n), float64(n)
+	denom := 1 + z*z/nf
+	centre := (p + z*z/(2*nf)) / denom
+	half := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denom
+	return max(0, centre-half), min(1, centre+half)
+}
+
+func clopperPearson(k, n int, confidence float64) (lo, hi float64) {
+	alpha := 1 - confidence
+	lo, hi = 0, 1
+	if k > 0 {
+		lo = betaQuantile(alpha/2, float64(k), float64(n-k+1))
+	}
+	if k < n {
+		hi = betaQuantile(1-alpha/2, float64(k+1), float64(n-k))
+	}
+	return lo, hi
+}
+
+// betaQuantile inverts the regularised incomplete beta function by
+// bisection; 60 halvings are well below float64 resolution.
+func betaQuantile(q, a, b float64) float64 {
+	lo, hi := 0.0, 1.0
+	for range 60 {
+		mid := (lo + hi) / 2
+		if betaInc(mid, a, b) < q {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// betaInc is the regularised incomplete beta function I_x(a, b).
+func betaInc(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges fast for x < (a+1)/(a+b+2); use the
+	// symmetry I_x(a,b) = 1 - I_{1-x}(b,a) otherwise.
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(x, a, b) / a
+	}
+	return 1 - front*betaCF(1-x, b, a)/b
+}
+
+// betaCF evaluates the continued fraction of the incomplete beta function
+// with the modified Lentz method.
+func betaCF(x, a, b float64) float64 {
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= 300; m++ {
+		mf := float64(m)
+		for _, num := range []float64{
+			mf * (b - mf) * x / ((a + 2*mf - 1) * (a + 2*mf)),
+			-(a + mf) * (a + b + mf) * x / ((a + 2*mf) * (a + 2*mf + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < 1e-15 {
+			break
+		}
+	}
+	return h
+}
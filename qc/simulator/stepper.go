@@ -0,0 +1,111 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// ErrStepperDone is returned by Stepper.Step once every layer is applied.
+var ErrStepperDone = fmt.Errorf("simulator: stepper has applied every layer")
+
+// Stepper plays a circuit one layer (TimeStep) at a time and exposes the
+// state in between, for animations, teaching and debugging deep circuits.
+// Measurements are skipped, so the state is the one just before measuring.
+type Stepper interface {
+	// Step applies the next layer and returns its operations.
+	Step() ([]circuit.Operation, error)
+	// Layer is the number of layers applied so far; Layers the total.
+	Layer() int
+	Layers() int
+	Statevector() []complex128
+	Probabilities() []float64
+}
+
+// StepperProvider is implemented by runners that can step through a circuit
+// natively, i.e. without recomputing the state from scratch per layer.
+type StepperProvider interface {
+	NewStepper(c circuit.Circuit) (Stepper, error)
+}
+
+// NewStepper returns a Stepper for c. Runners implementing StepperProvider
+// step natively; other StatevectorGetter runners are asked for the state of
+// each growing prefix of c. Measurements must be terminal and c must have
+// no control flow, since a mid-circuit measurement has no single outcome.
+func NewStepper(runner OneShotRunner, c circuit.Circuit) (Stepper, error) {
+	if !terminalMeasurements(c) {
+		return nil, fmt.Errorf("simulator: stepping needs terminal measurements and no control flow")
+	}
+	if p, ok := runner.(StepperProvider); ok {
+		return p.NewStepper(c)
+	}
+	getter, ok := runner.(StatevectorGetter)
+	if !ok {
+		return nil, fmt.Errorf("simulator: runner cannot return a statevector")
+	}
+	st := &prefixStepper{getter: getter, layers: Layers(c), prefix: circuit.NewIncremental(c.Qubits(), c.Clbits())}
+	sv, err := getter.GetStatevector(st.prefix)
+	if err != nil {
+		return nil, err
+	}
+	st.sv = sv
+	return st, nil
+}
+
+// Stepper is NewStepper with the simulator's runner.
+func (s *Simulator) Stepper(c circuit.Circuit) (Stepper, error) {
+	return NewStepper(s.runner, c)
+}
+
+// Layers groups the operations of c by TimeStep.
+func Layers(c circuit.Circuit) [][]circuit.Operation {
+	layers := make([][]circuit.Operation, c.Depth())
+	for _, op := range c.OpsIter() {
+		layers[op.TimeStep] = append(layers[op.TimeStep], op)
+	}
+	return layers
+}
+
+// Probabilities returns |a|² for every amplitude.
+func Probabilities(sv []complex128) []float64 {
+	ps := make([]float64, len(sv))
+	for i, a := range sv {
+		ps[i] = real(a)*real(a) + imag(a)*imag(a)
+	}
+	return ps
+}
+
+// prefixStepper recomputes the statevector of the circuit prefix after
+// every layer.
+type prefixStepper struct {
+	getter  StatevectorGetter
+	layers  [][]circuit.Operation
+	applied int
+	prefix  *circuit.Incremental
+	sv      []complex128
+}
+
+func (s *prefixStepper) Step() ([]circuit.Operation, error) {
+	if s.applied == len(s.layers) {
+		return nil, ErrStepperDone
+	}
+	layer := s.layers[s.applied]
+	for _, op := range layer {
+		if _, err := s.prefix.Append(dag.Op{G: op.G, Qubits: op.Qubits, Cbit: op.Cbit}); err != nil {
+			return nil, err
+		}
+	}
+	sv, err := s.getter.GetStatevector(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	s.sv = sv
+	s.applied++
+	return layer, nil
+}
+
+func (s *prefixStepper) Layer() int                { return s.applied }
+func (s *prefixStepper) Layers() int               { return len(s.layers) }
+func (s *prefixStepper) Statevector() []complex128 { return append([]complex128(nil), s.sv...) }
+func (s *prefixStepper) Probabilities() []float64  { return Probabilities(s.sv) }
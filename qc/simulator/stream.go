@@ -0,0 +1,71 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// StreamRunner is implemented by runners that can play a circuit.Stream
+// operation by operation, without loading it into memory.
+type StreamRunner interface {
+	// RunStream executes the stream for one shot, like RunOnce.
+	RunStream(ctx context.Context, s *circuit.Stream) (string, error)
+	// StreamStatevector returns the final state, measurements skipped.
+	StreamStatevector(s *circuit.Stream) ([]complex128, error)
+}
+
+// RunStream runs a streamed circuit and returns its histogram, keyed as for
+// Run. With terminal measurements the stream is read once and the shots
+// are sampled from the final state; otherwise every shot reads it again.
+// Taper, light cone and post-selection need the whole circuit and are not
+// applied.
+func (s *Simulator) RunStream(st *circuit.Stream) (map[string]int, error) {
+	runner, ok := s.runner.(StreamRunner)
+	if !ok {
+		return nil, fmt.Errorf("simulator: runner cannot consume a stream")
+	}
+	if len(s.PostSelect) > 0 {
+		return nil, fmt.Errorf("simulator: post-selection is not supported for streams")
+	}
+	if bp, ok := s.runner.(BackendProvider); ok && st.HasControlFlow() {
+		if info := bp.GetBackendInfo(); !info.Capabilities["control_flow"] {
+			return nil, fmt.Errorf("simulator: runner %s does not support classical control flow", info.ShortName)
+		}
+	}
+	meas := st.Measurements()
+	var written []int
+	for _, cbs := range meas {
+		written = append(written, cbs...)
+	}
+	slices.Sort(written)
+	project := projectKeys(slices.Compact(written), st.Clbits())
+
+	s.log.Info().
+		Int("shots", s.Shots).
+		Int("qubits", st.Qubits()).
+		Int("ops", st.NumOps()).
+		Msg("simulator: Starting RunStream")
+
+	if st.TerminalMeasurements() {
+		sv, err := runner.StreamStatevector(st)
+		if err != nil {
+			return nil, err
+		}
+		return s.sampleState(sv, st.CbitSources(), unmeasured(st.Qubits(), meas), project), nil
+	}
+	if s.IncludeUnmeasured {
+		return nil, fmt.Errorf("simulator: IncludeUnmeasured needs a statevector runner and terminal measurements")
+	}
+	hist := make(map[string]int)
+	for i := range s.Shots {
+		key, err := runner.RunStream(context.Background(), st)
+		if err != nil {
+			return hist, fmt.Errorf("shot %d failed: %w", i+1, err)
+		}
+		hist[project(key)]++
+	}
+	return hist, nil
+}
@@ -0,0 +1,90 @@
+package simulator
+
+import "github.com/kegliz/qcm/qc/circuit"
+
+// maxDenseCbits bounds the per-worker count arrays at 2^16 outcomes; wider
+// circuits are counted by key.
+const maxDenseCbits = 16
+
+// OutcomeRunner is implemented by runners that can report a shot's
+// classical bits as an integer (cbit i in bit i), for circuits of at most
+// 64 classical bits. Histograms are then counted in arrays and key strings
+// are built once per distinct outcome instead of once per shot.
+type OutcomeRunner interface {
+	RunOnceOutcome(c circuit.Circuit) (uint64, error)
+}
+
+// tally counts the shots of one worker without locking; mergeTallies
+// combines the workers' tallies at the end.
+type tally struct {
+	runner OutcomeRunner // nil: count the keys of RunOnce
+	dense  []int         // shots per outcome
+	keys   map[string]int
+}
+
+func (s *Simulator) newTally(c circuit.Circuit) *tally {
+	if r, ok := s.runner.(OutcomeRunner); ok && c.Clbits() <= maxDenseCbits {
+		if s.pool != nil {
+			return &tally{runner: r, dense: s.pool.dense(1 << c.Clbits())}
+		}
+		return &tally{runner: r, dense: make([]int, 1<<c.Clbits())}
+	}
+	return &tally{keys: map[string]int{}}
+}
+
+// shot runs c once and counts the outcome.
+func (t *tally) shot(s *Simulator, c circuit.Circuit) error {
+	if s.meter != nil {
+		return s.meter.shot(func() error { return t.run(s, c) })
+	}
+	return t.run(s, c)
+}
+
+func (t *tally) run(s *Simulator, c circuit.Circuit) error {
+	if t.runner != nil {
+		o, err := t.runner.RunOnceOutcome(c)
+		if err != nil {
+			return err
+		}
+		t.dense[o]++
+		return nil
+	}
+	key, err := s.runner.RunOnce(c)
+	if err != nil {
+		return err
+	}
+	t.keys[key]++
+	return nil
+}
+
+// mergeTallies sums ts into a histogram of projected keys for a circuit
+// with clbits classical bits.
+func mergeTallies(ts []*tally, clbits int, project func(string) string) map[string]int {
+	hist := map[string]int{}
+	var dense []int
+	for _, t := range ts {
+		for k, n := range t.keys {
+			hist[project(k)] += n
+		}
+		if t.dense == nil {
+			continue
+		}
+		if dense == nil {
+			dense = make([]int, len(t.dense))
+		}
+		for o, n := range t.dense {
+			dense[o] += n
+		}
+	}
+	key := make([]byte, clbits)
+	for o, n := range dense {
+		if n == 0 {
+			continue
+		}
+		for i := range key {
+			key[i] = '0' + byte(o>>i&1)
+		}
+		hist[project(string(key))] += n
+	}
+	return hist
+}
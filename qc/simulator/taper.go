@@ -0,0 +1,163 @@
+package simulator
+
+import (
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// diagonal lists the gates that only add phases in the computational
+// basis. A qubit in |0⟩ that only meets these stays in |0⟩.
+var diagonal = map[string]bool{"Z": true, "S": true, "P": true, "RZ": true, "CZ": true, "CP": true}
+
+// Taper removes trivial qubits from c: qubits that no gate touches, or
+// that only meet diagonal gates and measurements. Such a qubit stays in
+// |0⟩, so every operation on it is a phase or reads 0 and can be dropped,
+// shrinking the statevector by half per qubit. kept[i] is the original
+// index of qubit i of the result; when nothing can be removed, c itself is
+// returned.
+//
+// A dropped measurement leaves its cbit at 0, so a trivial qubit is only
+// removed if no other qubit is measured into the same cbits. Circuits with
+// loops are returned unchanged.
+func Taper(c circuit.Circuit) (circuit.Circuit, []int, error) {
+	ops := c.Operations()
+	trivial := make([]bool, c.Qubits())
+	for q := range trivial {
+		trivial[q] = true
+	}
+	for _, op := range ops {
+		if op.Loop != nil {
+			return c, identity(c.Qubits()), nil
+		}
+		if op.G.Name() != "MEASURE" && !diagonal[op.G.Name()] {
+			for _, q := range op.Qubits {
+				trivial[q] = false
+			}
+		}
+	}
+	// cbits shared with a non-trivial measurement keep their writers.
+	shared := map[int]bool{}
+	for _, op := range ops {
+		if op.G.Name() == "MEASURE" && !trivial[op.Qubits[0]] {
+			shared[op.Cbit] = true
+		}
+	}
+	for _, op := range ops {
+		if op.G.Name() == "MEASURE" && shared[op.Cbit] {
+			trivial[op.Qubits[0]] = false
+		}
+	}
+	return restrict(c, ops, trivial)
+}
+
+// restrict rebuilds c from ops, leaving out those touching a dropped qubit
+// and renumbering the remaining qubits densely. At least one qubit is kept.
+func restrict(c circuit.Circuit, ops []circuit.Operation, dropped []bool) (circuit.Circuit, []int, error) {
+	var kept []int
+	index := make([]int, c.Qubits())
+	for q, d := range dropped {
+		if !d {
+			index[q] = len(kept)
+			kept = append(kept, q)
+		}
+	}
+	if len(kept) == c.Qubits() && len(ops) == c.NumOps() {
+		return c, kept, nil
+	}
+	if len(kept) == 0 {
+		kept = []int{0}
+		dropped[0] = false
+	}
+
+	out := circuit.NewIncremental(len(kept), c.Clbits())
+next:
+	for _, op := range ops {
+		qs := make([]int, len(op.Qubits))
+		for i, q := range op.Qubits {
+			if dropped[q] {
+				continue next
+			}
+			qs[i] = index[q]
+		}
+		if _, err := out.Append(dag.Op{G: op.G, Qubits: qs, Cbit: op.Cbit, Cond: op.Cond, Meta: op.Meta}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, kept, nil
+}
+
+func identity(n int) []int {
+	qs := make([]int, n)
+	for i := range qs {
+		qs[i] = i
+	}
+	return qs
+}
+
+// plan returns the circuit the runner executes in place of c and the
+// projection from the runner's full-width keys onto c's histogram keys.
+// Optimised circuits keep c's classical bits, so the projection is c's own.
+func (s *Simulator) plan(c circuit.Circuit) (circuit.Circuit, func(string) string) {
+	project := keyProjector(c)
+	if s.IncludeUnmeasured {
+		return c, project
+	}
+	exec := c
+	for _, pass := range []struct {
+		name string
+		off  bool
+		run  func(circuit.Circuit) (circuit.Circuit, []int, error)
+	}{
+		{"light cone", s.NoLightCone, LightCone},
+		{"taper", s.NoTaper, Taper},
+	} {
+		if pass.off {
+			continue
+		}
+		reduced, kept, err := pass.run(exec)
+		if err != nil {
+			continue
+		}
+		s.log.Debug().Str("pass", pass.name).Int("qubits", exec.Qubits()).Int("kept", len(kept)).
+			Int("ops", reduced.NumOps()).Msg("simulator: Reduced circuit")
+		exec = reduced
+	}
+	return exec, project
+}
+
+// LightCone keeps only the operations that can influence a measurement:
+// walking backwards from the end, an operation belongs to the light cone
+// of the measurements if it shares a qubit with a later operation that
+// does. Qubits left without operations are removed as in Taper. Circuits
+// with loops are returned unchanged.
+func LightCone(c circuit.Circuit) (circuit.Circuit, []int, error) {
+	ops := c.Operations()
+	live := make([]bool, c.Qubits())
+	keep := make([]bool, len(ops))
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		if op.Loop != nil {
+			return c, identity(c.Qubits()), nil
+		}
+		keep[i] = op.G.Name() == "MEASURE"
+		for _, q := range op.Qubits {
+			keep[i] = keep[i] || live[q]
+		}
+		if keep[i] {
+			for _, q := range op.Qubits {
+				live[q] = true
+			}
+		}
+	}
+	var cone []circuit.Operation
+	for i, op := range ops {
+		if keep[i] {
+			cone = append(cone, op)
+		}
+	}
+	idle := make([]bool, c.Qubits())
+	for q := range idle {
+		idle[q] = !live[q]
+	}
+	return restrict(c, cone, idle)
+}
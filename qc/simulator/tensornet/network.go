@@ -0,0 +1,241 @@
+package tensornet
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Supported gates for the tensor-network backend; composites are expanded.
+var supportedGates = []string{
+	"H", "X", "Y", "Z", "S", "P", "RX", "RY", "RZ", "CNOT", "CZ", "CP", "SWAP", "TOFFOLI", "FREDKIN", "MEASURE",
+}
+
+// matrix returns the unitary of a primitive gate on k qubits as a 2^k×2^k
+// row-major matrix, the gate's first qubit the most significant bit.
+func matrix(g gate.Gate) ([]complex128, error) {
+	angle := func() (float64, error) {
+		pg, ok := g.(gate.Parametric)
+		if !ok {
+			return 0, fmt.Errorf("tensornet: gate %s carries no angle", g.Name())
+		}
+		return pg.Params()[0], nil
+	}
+	// permutation builds the matrix of a classical gate on k qubits.
+	permutation := func(k int, f func(int) int) []complex128 {
+		m := make([]complex128, 1<<(2*k))
+		for in := range 1 << k {
+			m[f(in)<<k|in] = 1
+		}
+		return m
+	}
+	r := complex(1/math.Sqrt2, 0)
+	switch g.Name() {
+	case "H":
+		return []complex128{r, r, r, -r}, nil
+	case "X":
+		return []complex128{0, 1, 1, 0}, nil
+	case "Y":
+		return []complex128{0, -1i, 1i, 0}, nil
+	case "Z":
+		return []complex128{1, 0, 0, -1}, nil
+	case "S":
+		return []complex128{1, 0, 0, 1i}, nil
+	case "P":
+		theta, err := angle()
+		if err != nil {
+			return nil, err
+		}
+		return []complex128{1, 0, 0, cmplx.Exp(complex(0, theta))}, nil
+	case "RX", "RY", "RZ":
+		theta, err := angle()
+		if err != nil {
+			return nil, err
+		}
+		c, s := complex(math.Cos(theta/2), 0), math.Sin(theta/2)
+		switch g.Name() {
+		case "RX":
+			return []complex128{c, complex(0, -s), complex(0, -s), c}, nil
+		case "RY":
+			return []complex128{c, complex(-s, 0), complex(s, 0), c}, nil
+		}
+		return []complex128{cmplx.Exp(complex(0, -theta/2)), 0, 0, cmplx.Exp(complex(0, theta/2))}, nil
+	case "CNOT":
+		return permutation(2, func(b int) int {
+			if b&2 != 0 {
+				return b ^ 1
+			}
+			return b
+		}), nil
+	case "CZ":
+		return []complex128{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, -1}, nil
+	case "CP":
+		theta, err := angle()
+		if err != nil {
+			return nil, err
+		}
+		return []complex128{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, cmplx.Exp(complex(0, theta))}, nil
+	case "SWAP":
+		return permutation(2, func(b int) int { return b>>1 | (b&1)<<1 }), nil
+	case "TOFFOLI":
+		return permutation(3, func(b int) int {
+			if b&6 == 6 {
+				return b ^ 1
+			}
+			return b
+		}), nil
+	case "FREDKIN":
+		return permutation(3, func(b int) int {
+			if b&4 != 0 {
+				return b&4 | (b&1)<<1 | (b&2)>>1
+			}
+			return b
+		}), nil
+	}
+	return nil, fmt.Errorf("tensornet: unsupported gate: %s", g.Name())
+}
+
+// network is a tensor network under construction over wires that carry
+// edge ids.
+type network struct {
+	tensors []*tensor
+	next    int   // next free edge id
+	wire    []int // current edge of every qubit, -1 for qubits not built
+}
+
+// newNetwork starts the qubits in build in |0⟩; other qubits get no wire.
+func newNetwork(qubits int, build []bool) *network {
+	n := &network{wire: make([]int, qubits)}
+	for q := range qubits {
+		n.wire[q] = -1
+		if build[q] {
+			n.wire[q] = n.edge()
+			n.tensors = append(n.tensors, &tensor{edges: []int{n.wire[q]}, data: []complex128{1, 0}})
+		}
+	}
+	return n
+}
+
+func (n *network) edge() int {
+	n.next++
+	return n.next - 1
+}
+
+// apply adds g on qubits, expanding composites.
+func (n *network) apply(g gate.Gate, qubits []int) error {
+	return gate.Expand(g, qubits, func(g gate.Gate, qubits []int) error {
+		m, err := matrix(g)
+		if err != nil {
+			return err
+		}
+		if len(m) != 1<<(2*len(qubits)) {
+			return fmt.Errorf("tensornet: gate %s does not act on %d qubits", g.Name(), len(qubits))
+		}
+		in := make([]int, len(qubits))
+		out := make([]int, len(qubits))
+		for k, q := range qubits {
+			if n.wire[q] < 0 {
+				return fmt.Errorf("tensornet: qubit %d is outside the network", q)
+			}
+			in[k] = n.wire[q]
+			out[k] = n.edge()
+			n.wire[q] = out[k]
+		}
+		n.tensors = append(n.tensors, &tensor{edges: append(out, in...), data: m})
+		return nil
+	})
+}
+
+// project caps the wire of q with ⟨b|.
+func (n *network) project(q, b int) {
+	t := &tensor{edges: []int{n.wire[q]}, data: []complex128{1, 0}}
+	if b == 1 {
+		t.data = []complex128{0, 1}
+	}
+	n.tensors = append(n.tensors, t)
+}
+
+// ket builds the network of c's final state on the qubits in build,
+// skipping measurements, which must all be terminal. Gates that also act
+// on qubits outside build lie after the light cone and are left out.
+func ket(c circuit.Circuit, build []bool) (*network, error) {
+	n := newNetwork(c.Qubits(), build)
+	for _, op := range c.OpsIter() {
+		if op.G.Name() == "MEASURE" {
+			continue
+		}
+		if slices.ContainsFunc(op.Qubits, func(q int) bool { return !build[q] }) {
+			continue
+		}
+		if err := n.apply(op.G, op.Qubits); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// lightCone marks the qubits whose gates can influence the reduced state
+// of qubits: walking backwards, an operation touching a marked qubit marks
+// all of its qubits.
+func lightCone(c circuit.Circuit, qubits []int) []bool {
+	in := make([]bool, c.Qubits())
+	for _, q := range qubits {
+		in[q] = true
+	}
+	ops := c.Operations()
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		if op.G.Name() == "MEASURE" || !slices.ContainsFunc(op.Qubits, func(q int) bool { return in[q] }) {
+			continue
+		}
+		for _, q := range op.Qubits {
+			in[q] = true
+		}
+	}
+	return in
+}
+
+// density builds ⟨ψ|…|ψ⟩ for the reduced state of qubits: the ket network
+// of their light cone, its complex conjugate with the wires of every other
+// qubit joined to the ket's (a partial trace), and the ket and bra legs of
+// qubits left open. It returns the tensors and the open legs, the kets of
+// qubits in order followed by their bras.
+func density(c circuit.Circuit, qubits []int) ([]*tensor, []int, error) {
+	build := lightCone(c, qubits)
+	k, err := ket(c, build)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The bra copy uses edge e+off for the ket's edge e.
+	off := k.next
+	keep := map[int]int{} // ket leg → bra leg of the open qubits
+	for _, q := range qubits {
+		keep[k.wire[q]] = k.wire[q] + off
+	}
+	ts := slices.Clone(k.tensors)
+	for _, t := range k.tensors {
+		bra := &tensor{edges: make([]int, len(t.edges)), data: make([]complex128, len(t.data))}
+		for i, e := range t.edges {
+			bra.edges[i] = e + off
+			if _, open := keep[e]; !open && slices.Contains(k.wire, e) {
+				bra.edges[i] = e // traced: share the ket's final leg
+			}
+		}
+		for i, v := range t.data {
+			bra.data[i] = cmplx.Conj(v)
+		}
+		ts = append(ts, bra)
+	}
+	open := make([]int, 0, 2*len(qubits))
+	for _, q := range qubits {
+		open = append(open, k.wire[q])
+	}
+	for _, q := range qubits {
+		open = append(open, k.wire[q]+off)
+	}
+	return ts, open, nil
+}
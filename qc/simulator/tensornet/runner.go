@@ -0,0 +1,280 @@
+// Package tensornet implements a backend that turns a circuit into a
+// tensor network and contracts it, so that single amplitudes and marginals
+// of a few qubits can be computed for circuits whose statevector would not
+// fit in memory. Its cost is set by the largest intermediate tensor of the
+// contraction, which stays small for shallow or loosely connected circuits
+// and for marginals with a narrow light cone, rather than by the width.
+package tensornet
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/simulator"
+)
+
+// TensorNetRunner runs circuits by tensor-network contraction. Shots
+// sample the measured qubits one at a time from conditional marginals,
+// which it caches for the last circuit it ran.
+type TensorNetRunner struct {
+	mu   sync.Mutex
+	plan *samplePlan
+}
+
+// NewTensorNetRunner creates a tensor-network runner.
+func NewTensorNetRunner() *TensorNetRunner {
+	return &TensorNetRunner{}
+}
+
+// Amplitude returns ⟨bits|ψ⟩ for the final state ψ of c, ignoring its
+// measurements; bits holds one character per qubit, qubit 0 first.
+func (r *TensorNetRunner) Amplitude(c circuit.Circuit, bits string) (complex128, error) {
+	if err := checkTerminal(c); err != nil {
+		return 0, err
+	}
+	if len(bits) != c.Qubits() || strings.Trim(bits, "01") != "" {
+		return 0, fmt.Errorf("tensornet: %q is not a basis state of %d qubits", bits, c.Qubits())
+	}
+	all := make([]bool, c.Qubits())
+	for q := range all {
+		all[q] = true
+	}
+	n, err := ket(c, all)
+	if err != nil {
+		return 0, err
+	}
+	for q := range c.Qubits() {
+		n.project(q, int(bits[q]-'0'))
+	}
+	t, err := contractAll(n.tensors, nil)
+	if err != nil {
+		return 0, err
+	}
+	return t.data[0], nil
+}
+
+// Marginal returns the distribution of the final state of c over qubits,
+// keyed by one character per listed qubit in the order given. Only the
+// light cone of those qubits is contracted.
+func (r *TensorNetRunner) Marginal(c circuit.Circuit, qubits []int) (map[string]float64, error) {
+	if err := checkTerminal(c); err != nil {
+		return nil, err
+	}
+	if err := checkQubits(c, qubits); err != nil {
+		return nil, err
+	}
+	if 2*len(qubits) > maxRank {
+		return nil, fmt.Errorf("tensornet: a marginal over %d qubits needs a rank-%d tensor, more than %d", len(qubits), 2*len(qubits), maxRank)
+	}
+	ts, open, err := density(c, qubits)
+	if err != nil {
+		return nil, err
+	}
+	t, err := contractAll(ts, open)
+	if err != nil {
+		return nil, err
+	}
+	k := len(qubits)
+	out := make(map[string]float64, 1<<k)
+	key := make([]byte, k)
+	for x := range 1 << k {
+		p := real(t.data[x<<k|x])
+		if p < 1e-12 {
+			continue
+		}
+		for j := range k {
+			key[j] = '0' + byte(x>>(k-1-j)&1)
+		}
+		out[string(key)] = p
+	}
+	return out, nil
+}
+
+// probability returns the probability that qubits read bits.
+func probability(c circuit.Circuit, qubits []int, bits string) (float64, error) {
+	ts, open, err := density(c, qubits)
+	if err != nil {
+		return 0, err
+	}
+	for j := range qubits {
+		b := int(bits[j] - '0')
+		for _, e := range []int{open[j], open[len(qubits)+j]} {
+			t := &tensor{edges: []int{e}, data: []complex128{1, 0}}
+			if b == 1 {
+				t.data = []complex128{0, 1}
+			}
+			ts = append(ts, t)
+		}
+	}
+	t, err := contractAll(ts, nil)
+	if err != nil {
+		return 0, err
+	}
+	return real(t.data[0]), nil
+}
+
+// samplePlan is what shots of one circuit share.
+type samplePlan struct {
+	c      circuit.Circuit
+	ops    int   // operations of c when planned, to notice appends
+	qubits []int // measured qubits, in order of first measurement
+	reads  []read
+	probs  map[string]float64 // by prefix of outcomes of qubits
+}
+
+// read is one measurement: cbit gets the outcome of qubits[index].
+type read struct{ index, cbit int }
+
+func newSamplePlan(c circuit.Circuit) (*samplePlan, error) {
+	if err := checkTerminal(c); err != nil {
+		return nil, err
+	}
+	p := &samplePlan{c: c, ops: len(c.Operations()), probs: map[string]float64{"": 1}}
+	for _, op := range c.Operations() {
+		if op.G.Name() != "MEASURE" || op.Cbit < 0 {
+			continue
+		}
+		q := op.Qubits[0]
+		i := slices.Index(p.qubits, q)
+		if i < 0 {
+			i = len(p.qubits)
+			p.qubits = append(p.qubits, q)
+		}
+		p.reads = append(p.reads, read{i, op.Cbit})
+	}
+	return p, nil
+}
+
+// prob returns, from the cache or by contraction, the probability that
+// the first len(prefix) measured qubits read prefix.
+func (p *samplePlan) prob(prefix string) (float64, error) {
+	if v, ok := p.probs[prefix]; ok {
+		return v, nil
+	}
+	v, err := probability(p.c, p.qubits[:len(prefix)], prefix)
+	if err != nil {
+		return 0, err
+	}
+	p.probs[prefix] = v
+	return v, nil
+}
+
+// RunOnce implements simulator.OneShotRunner.
+func (r *TensorNetRunner) RunOnce(c circuit.Circuit) (string, error) {
+	return r.RunOnceRand(c, nil)
+}
+
+// RunOnceRand implements simulator.RandRunner: measurement outcomes are
+// drawn from rng (nil: the global source).
+func (r *TensorNetRunner) RunOnceRand(c circuit.Circuit, rng *rand.Rand) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.plan == nil || r.plan.c != c || r.plan.ops != len(c.Operations()) {
+		p, err := newSamplePlan(c)
+		if err != nil {
+			return "", err
+		}
+		r.plan = p
+	}
+	p := r.plan
+	uniform := rand.Float64
+	if rng != nil {
+		uniform = rng.Float64
+	}
+	prefix := ""
+	for range p.qubits {
+		whole, err := p.prob(prefix)
+		if err != nil {
+			return "", err
+		}
+		zero, err := p.prob(prefix + "0")
+		if err != nil {
+			return "", err
+		}
+		if uniform()*whole < zero {
+			prefix += "0"
+		} else {
+			prefix += "1"
+		}
+	}
+	key := []byte(strings.Repeat("0", c.Clbits()))
+	for _, rd := range p.reads {
+		key[rd.cbit] = prefix[rd.index]
+	}
+	return string(key), nil
+}
+
+// checkTerminal rejects circuits this backend cannot contract: classical
+// control flow, gates on a qubit after it was measured and gates it has
+// no tensor for.
+func checkTerminal(c circuit.Circuit) error {
+	if circuit.HasControlFlow(c) {
+		return fmt.Errorf("tensornet: circuits with classical control flow are not supported")
+	}
+	measured := make([]bool, c.Qubits())
+	for _, op := range c.Operations() {
+		if op.G.Name() == "MEASURE" {
+			measured[op.Qubits[0]] = true
+			continue
+		}
+		for _, q := range op.Qubits {
+			if measured[q] {
+				return fmt.Errorf("tensornet: gate %s acts on qubit %d after it was measured", op.G.Name(), q)
+			}
+		}
+	}
+	return simulator.CheckGates("tensornet", c, supportedGates)
+}
+
+func checkQubits(c circuit.Circuit, qubits []int) error {
+	for i, q := range qubits {
+		if q < 0 || q >= c.Qubits() {
+			return fmt.Errorf("tensornet: invalid qubit %d for %d-qubit circuit", q, c.Qubits())
+		}
+		if slices.Contains(qubits[:i], q) {
+			return fmt.Errorf("tensornet: qubit %d is listed twice", q)
+		}
+	}
+	return nil
+}
+
+// ValidateCircuit implements simulator.ValidatingRunner.
+func (r *TensorNetRunner) ValidateCircuit(c circuit.Circuit) error {
+	return checkTerminal(c)
+}
+
+// GetSupportedGates implements simulator.ValidatingRunner.
+func (r *TensorNetRunner) GetSupportedGates() []string {
+	return slices.Clone(supportedGates)
+}
+
+// GetBackendInfo implements simulator.BackendProvider.
+func (r *TensorNetRunner) GetBackendInfo() simulator.BackendInfo {
+	return simulator.BackendInfo{
+		Name:        "Tensor Network Simulator",
+		Version:     "v1.0.0",
+		ShortName:   "tensornet",
+		Description: "Exact amplitudes and marginals by greedy tensor-network contraction",
+		Vendor:      "qplay",
+		Capabilities: map[string]bool{
+			"circuit_validation": true,
+			"control_flow":       false,
+		},
+		Metadata: map[string]string{
+			"backend_type":   "tensor_network",
+			"language":       "go",
+			"license":        "MIT",
+			"implementation": "from_scratch",
+		},
+	}
+}
+
+func init() {
+	simulator.MustRegisterRunner("tensornet", func() simulator.OneShotRunner {
+		return NewTensorNetRunner()
+	})
+}
@@ -0,0 +1,152 @@
+package tensornet
+
+import (
+	"fmt"
+	"slices"
+)
+
+// maxRank bounds the rank of any tensor a contraction may create: a rank-r
+// tensor holds 2^r amplitudes, so rank 26 is already a gigabyte.
+const maxRank = 26
+
+// tensor is a dense tensor whose legs all have dimension 2. edges names
+// the legs, the first one most significant in data.
+type tensor struct {
+	edges []int
+	data  []complex128
+}
+
+// transpose returns t with its legs in the given order, a permutation of
+// t.edges.
+func (t *tensor) transpose(edges []int) *tensor {
+	if slices.Equal(edges, t.edges) {
+		return t
+	}
+	r := len(edges)
+	// stride[k] is the step in t.data of leg edges[k].
+	stride := make([]int, r)
+	for k, e := range edges {
+		stride[k] = 1 << (r - 1 - slices.Index(t.edges, e))
+	}
+	out := &tensor{edges: edges, data: make([]complex128, len(t.data))}
+	for i := range out.data {
+		src := 0
+		for k := range r {
+			if i&(1<<(r-1-k)) != 0 {
+				src += stride[k]
+			}
+		}
+		out.data[i] = t.data[src]
+	}
+	return out
+}
+
+// shared returns the legs a and b have in common, in a's order.
+func shared(a, b *tensor) []int {
+	var s []int
+	for _, e := range a.edges {
+		if slices.Contains(b.edges, e) {
+			s = append(s, e)
+		}
+	}
+	return s
+}
+
+// contractedRank is the rank of the contraction of a and b.
+func contractedRank(a, b *tensor) int {
+	return len(a.edges) + len(b.edges) - 2*len(shared(a, b))
+}
+
+// contract sums a and b over their shared legs (an outer product when
+// there are none). The result keeps a's free legs, then b's.
+func contract(a, b *tensor) (*tensor, error) {
+	sh := shared(a, b)
+	var freeA, freeB []int
+	for _, e := range a.edges {
+		if !slices.Contains(sh, e) {
+			freeA = append(freeA, e)
+		}
+	}
+	for _, e := range b.edges {
+		if !slices.Contains(sh, e) {
+			freeB = append(freeB, e)
+		}
+	}
+	if r := len(freeA) + len(freeB); r > maxRank {
+		return nil, fmt.Errorf("tensornet: contraction needs a rank-%d tensor, more than %d", r, maxRank)
+	}
+	// As matrices: a is m×k, b is k×n.
+	am := a.transpose(append(slices.Clone(freeA), sh...))
+	bm := b.transpose(append(slices.Clone(sh), freeB...))
+	m, k, n := 1<<len(freeA), 1<<len(sh), 1<<len(freeB)
+	out := &tensor{edges: append(freeA, freeB...), data: make([]complex128, m*n)}
+	for i := range m {
+		row := out.data[i*n : (i+1)*n]
+		for l := range k {
+			x := am.data[i*k+l]
+			if x == 0 {
+				continue
+			}
+			for j, y := range bm.data[l*n : (l+1)*n] {
+				row[j] += x * y
+			}
+		}
+	}
+	return out, nil
+}
+
+// contractAll contracts a network down to one tensor with the legs open,
+// in that order. Every leg of the network other than open ones must join
+// exactly two tensors.
+//
+// The order is greedy: each step contracts the pair of neighbouring
+// tensors whose result grows the network least (size of the result minus
+// the sizes of the two inputs), which absorbs single-qubit gates and
+// projectors first and keeps intermediate tensors small on shallow or
+// narrow circuits. Disconnected pieces are joined by outer products,
+// smallest first, once nothing shares a leg.
+func contractAll(ts []*tensor, open []int) (*tensor, error) {
+	if len(ts) == 0 {
+		return &tensor{data: []complex128{1}}, nil
+	}
+	live := slices.Clone(ts)
+	for len(live) > 1 {
+		// owners maps each leg to the live tensors carrying it.
+		owners := map[int][]int{}
+		for i, t := range live {
+			for _, e := range t.edges {
+				owners[e] = append(owners[e], i)
+			}
+		}
+		bi, bj, best := -1, -1, 0
+		for i, t := range live {
+			for _, e := range t.edges {
+				for _, j := range owners[e] {
+					if j <= i {
+						continue
+					}
+					cost := 1<<contractedRank(t, live[j]) - len(t.data) - len(live[j].data)
+					if bi < 0 || cost < best {
+						bi, bj, best = i, j, cost
+					}
+				}
+			}
+		}
+		if bi < 0 {
+			// No shared legs left: join the two smallest pieces.
+			slices.SortStableFunc(live, func(a, b *tensor) int { return len(a.data) - len(b.data) })
+			bi, bj = 0, 1
+		}
+		t, err := contract(live[bi], live[bj])
+		if err != nil {
+			return nil, err
+		}
+		live[bi] = t
+		live = slices.Delete(live, bj, bj+1)
+	}
+	t := live[0]
+	if len(t.edges) != len(open) {
+		return nil, fmt.Errorf("tensornet: network has %d open legs, want %d", len(t.edges), len(open))
+	}
+	return t.transpose(open), nil
+}
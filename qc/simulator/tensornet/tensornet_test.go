@@ -0,0 +1,173 @@
+package tensornet
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mixed uses every supported gate, and a composite, on 5 qubits.
+func mixed(t *testing.T) circuit.Circuit {
+	mcx, err := decompose.MCX(3, decompose.Recursive)
+	require.NoError(t, err)
+	c, err := builder.New(builder.Q(5), builder.C(5)).
+		H(0).RY(0.7, 1).RX(1.3, 2).Y(3).H(4).
+		CNOT(0, 2).CZ(1, 4).CP(0.9, 3, 0).S(2).P(-0.4, 4).RZ(2.1, 1).
+		Toffoli(4, 1, 3).SWAP(1, 3).Fredkin(2, 0, 4).Z(0).X(4).
+		Apply(mcx, 0, 2, 4, 1).H(3).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).Measure(3, 3).Measure(4, 4).BuildCircuit()
+	require.NoError(t, err)
+	return c
+}
+
+func TestAmplitudeMatchesStatevector(t *testing.T) {
+	c := mixed(t)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+	r := NewTensorNetRunner()
+	for idx, want := range sv {
+		bits := make([]byte, c.Qubits())
+		for q := range bits {
+			bits[q] = '0' + byte(idx>>q&1)
+		}
+		got, err := r.Amplitude(c, string(bits))
+		require.NoError(t, err)
+		assert.InDelta(t, 0, cmplx.Abs(got-want), 1e-9, string(bits))
+	}
+}
+
+func TestFredkin(t *testing.T) {
+	c, err := builder.New(builder.Q(3), builder.C(0)).X(0).X(1).Fredkin(0, 1, 2).BuildCircuit()
+	require.NoError(t, err)
+	amp, err := NewTensorNetRunner().Amplitude(c, "101")
+	require.NoError(t, err)
+	assert.InDelta(t, 1, real(amp), 1e-12)
+}
+
+func TestMarginalMatchesStatevector(t *testing.T) {
+	c := mixed(t)
+	sv, err := qsim.NewQSimRunner().GetStatevector(c)
+	require.NoError(t, err)
+	qubits := []int{3, 0, 4}
+	want := map[string]float64{}
+	for idx, a := range sv {
+		var key strings.Builder
+		for _, q := range qubits {
+			key.WriteByte('0' + byte(idx>>q&1))
+		}
+		want[key.String()] += real(a * cmplx.Conj(a))
+	}
+	got, err := NewTensorNetRunner().Marginal(c, qubits)
+	require.NoError(t, err)
+	for k, p := range want {
+		assert.InDelta(t, p, got[k], 1e-9, k)
+	}
+}
+
+// TestMarginalAfterCone has gates after the light cone of the measured
+// qubits that touch qubits outside it: every CNOT of a GHZ chain past the
+// last measured qubit.
+func TestMarginalAfterCone(t *testing.T) {
+	for n := 3; n <= 6; n++ {
+		b := builder.New(builder.Q(n), builder.C(1)).H(0)
+		for q := range n - 1 {
+			b.CNOT(q, q+1)
+		}
+		c, err := b.BuildCircuit()
+		require.NoError(t, err)
+		for _, qubits := range [][]int{{0}, {1}, {n - 2}, {0, n - 2}, {1, 0, n - 1}} {
+			m, err := NewTensorNetRunner().Marginal(c, qubits)
+			require.NoError(t, err, "n=%d qubits=%v", n, qubits)
+			zeros, ones := strings.Repeat("0", len(qubits)), strings.Repeat("1", len(qubits))
+			assert.InDelta(t, 0.5, m[zeros], 1e-9, "n=%d qubits=%v", n, qubits)
+			assert.InDelta(t, 0.5, m[ones], 1e-9, "n=%d qubits=%v", n, qubits)
+		}
+	}
+}
+
+// TestWide works on 60 qubits, far beyond any statevector.
+func TestWide(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const n = 60
+	b := builder.New(builder.Q(n), builder.C(n)).H(0)
+	for q := range n - 1 {
+		b.CNOT(q, q+1)
+	}
+	for q := range n {
+		b.RY(0.1*float64(q%7), q)
+	}
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	r := NewTensorNetRunner()
+	amp, err := r.Amplitude(c, strings.Repeat("0", n))
+	require.NoError(err)
+	want := 1 / math.Sqrt2
+	for q := range n {
+		want *= math.Cos(0.05 * float64(q%7))
+	}
+	assert.InDelta(want, real(amp), 1e-9)
+
+	m, err := r.Marginal(c, []int{0, n - 1})
+	require.NoError(err)
+	total := 0.0
+	for _, p := range m {
+		total += p
+	}
+	assert.InDelta(1, total, 1e-9)
+	// Before the rotations the two ends agree; RY(0) leaves qubit 0 alone.
+	s := math.Sin(0.05 * float64((n-1)%7))
+	assert.InDelta(0.5*s*s, m["01"], 1e-9)
+}
+
+func TestSimulatorRun(t *testing.T) {
+	c, err := builder.New(builder.Q(3), builder.C(3)).
+		H(0).CNOT(0, 1).RY(math.Pi/3, 2).
+		Measure(0, 0).Measure(1, 1).Measure(2, 2).BuildCircuit()
+	require.NoError(t, err)
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 4000, Runner: NewTensorNetRunner(), Seed: 5})
+	hist, err := sim.Run(c)
+	require.NoError(t, err)
+	// P(qubit 2 = 1) = sin²(π/6) = 1/4.
+	assert.InDelta(t, 0.375, float64(hist["000"])/4000, 0.03)
+	assert.InDelta(t, 0.125, float64(hist["111"])/4000, 0.03)
+	assert.Zero(t, hist["100"]+hist["010"]+hist["101"]+hist["011"])
+
+	runner, err := simulator.CreateRunner("tensornet")
+	require.NoError(t, err)
+	assert.IsType(t, &TensorNetRunner{}, runner)
+}
+
+func TestUnsupported(t *testing.T) {
+	r := NewTensorNetRunner()
+	mid, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).X(0).BuildCircuit()
+	require.NoError(t, err)
+	_, err = r.RunOnce(mid)
+	assert.Error(t, err)
+
+	cf, err := builder.New(builder.Q(1), builder.C(1)).Measure(0, 0).
+		If(builder.Bit(0), func(b builder.Builder) { b.X(0) }).BuildCircuit()
+	require.NoError(t, err)
+	assert.Error(t, r.ValidateCircuit(cf))
+
+	c, err := builder.New(builder.Q(2), builder.C(0)).H(0).BuildCircuit()
+	require.NoError(t, err)
+	_, err = r.Marginal(c, []int{0, 0})
+	assert.Error(t, err)
+	_, err = r.Amplitude(c, "0")
+	assert.Error(t, err)
+	_, err = matrix(gate.Measure())
+	assert.Error(t, err)
+}
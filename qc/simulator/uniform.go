@@ -0,0 +1,52 @@
+package simulator
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// withUniformNoise runs c through run without SimulatorOptions.UniformNoise
+// and then replaces every shot, with probability UniformNoise, by an
+// outcome drawn uniformly from all values of the measured cbits. The
+// expected histogram is (1-ε)·p + ε/2^m for m measured cbits.
+func (s *Simulator) withUniformNoise(c circuit.Circuit, run func(*Simulator, circuit.Circuit) (map[string]int, error)) (map[string]int, error) {
+	eps := s.UniformNoise
+	if eps < 0 || eps > 1 || math.IsNaN(eps) {
+		return nil, fmt.Errorf("simulator: uniform noise %v out of [0,1]", eps)
+	}
+	sub := *s
+	sub.UniformNoise = 0
+	ideal, err := run(&sub, c)
+	if err != nil {
+		return ideal, err
+	}
+
+	width := len(measuredCbits(c))
+	rng := s.noiseRand()
+	hist := make(map[string]int, len(ideal))
+	key := make([]byte, width)
+	for _, k := range slices.Sorted(maps.Keys(ideal)) {
+		_, suffix, hasSuffix := strings.Cut(k, "|")
+		for range ideal[k] {
+			if rng.Float64() >= eps {
+				hist[k]++
+				continue
+			}
+			for i := range key {
+				key[i] = '0' + byte(rng.Intn(2))
+			}
+			out := string(key)
+			if hasSuffix {
+				out += "|" + suffix
+			}
+			hist[out]++
+		}
+	}
+	s.log.Info().Float64("uniform_noise", eps).Msg("simulator: Mixed in uniform shot noise")
+	return hist, nil
+}
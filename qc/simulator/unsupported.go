@@ -0,0 +1,98 @@
+package simulator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// UnsupportedGateError reports an operation a runner cannot apply, with
+// where it is in the circuit and what the runner runs instead.
+type UnsupportedGateError struct {
+	Runner string // the runner's short name
+	Gate   string // the gate the runner lacks
+	// Composite is the composite operation Gate is a step of; empty if
+	// the operation is Gate itself.
+	Composite string
+	Qubits    []int // the qubits Gate acts on
+	// Op is the index of the operation in the circuit's Operations; steps
+	// of a loop body carry the loop's index.
+	Op int
+	// Supported are the gates the runner runs, as GetSupportedGates lists
+	// them; composites of them run too.
+	Supported []string
+}
+
+func (e *UnsupportedGateError) Error() string {
+	var sb strings.Builder
+	runner := e.Runner
+	if runner == "" {
+		runner = "simulator"
+	}
+	fmt.Fprintf(&sb, "%s: unsupported gate %s on qubits %v at operation %d", runner, e.Gate, e.Qubits, e.Op)
+	if e.Composite != "" {
+		fmt.Fprintf(&sb, " (a step of %s)", e.Composite)
+	}
+	if len(e.Supported) == 0 {
+		fmt.Fprintf(&sb, "; define %s as a composite with gate.Define, or decompose the circuit with transpile.Basis(...)", e.Gate)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "; %s runs %s and composites of them: define %s as one with gate.Define, or decompose the circuit with transpile.Basis(...) to a target within those gates",
+		runner, strings.Join(e.Supported, ", "), e.Gate)
+	return sb.String()
+}
+
+// CheckGates returns an *UnsupportedGateError for the first operation of c
+// whose gate is neither in supported nor a composite of supported gates.
+// Loop bodies are checked too. Names match up to the angles gates defined
+// in OpenQASM carry in theirs, so "rzz" covers "rzz(0.7854)". Runners
+// call it to validate circuits and to locate the operation behind a
+// failed gate application.
+func CheckGates(runner string, c circuit.Circuit, supported []string) error {
+	for i, op := range c.Operations() {
+		if err := checkOp(runner, i, op, supported); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkOp(runner string, i int, op circuit.Operation, supported []string) error {
+	if op.Loop != nil {
+		for _, b := range op.Loop.Body {
+			if err := checkOp(runner, i, b, supported); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var check func(g gate.Gate, qubits []int, step bool) error
+	check = func(g gate.Gate, qubits []int, step bool) error {
+		name, _, _ := strings.Cut(g.Name(), "(")
+		if slices.Contains(supported, name) || slices.Contains(supported, g.Name()) {
+			return nil
+		}
+		comp, ok := g.(*gate.Composite)
+		if !ok {
+			e := &UnsupportedGateError{Runner: runner, Gate: g.Name(), Qubits: slices.Clone(qubits), Op: i, Supported: supported}
+			if step {
+				e.Composite = op.G.Name()
+			}
+			return e
+		}
+		for _, s := range comp.Steps() {
+			abs := make([]int, len(s.Qubits))
+			for j, q := range s.Qubits {
+				abs[j] = qubits[q]
+			}
+			if err := check(s.G, abs, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(op.G, op.Qubits, false)
+}
@@ -0,0 +1,80 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// ErrResourceLimit is wrapped by the errors of runs RunMetered stops for
+// exceeding their ResourceLimits.
+var ErrResourceLimit = errors.New("simulator: resource limit exceeded")
+
+// ResourceLimits bound one metered run; zero fields are unlimited.
+type ResourceLimits struct {
+	// CPUTime bounds the time spent running shots, summed over workers.
+	// It is checked before every shot, so a run overshoots it by at most
+	// one shot per worker.
+	CPUTime time.Duration
+	// Memory bounds EstimateMemory of the circuit the runner executes,
+	// after tapering and light cones. It is checked before the run starts;
+	// Go cannot cap the heap of a single run once it is going.
+	Memory int64
+}
+
+// Usage is what a metered run consumed.
+type Usage struct {
+	// CPUTime is the time spent running shots, summed over workers. Runs
+	// that evolve the circuit once and sample it report their wall time.
+	CPUTime    time.Duration
+	PeakMemory int64 // estimated, see EstimateMemory
+	Wall       time.Duration
+}
+
+// meter charges the time of every shot of a run.
+type meter struct {
+	limit time.Duration
+	busy  atomic.Int64 // nanoseconds
+}
+
+// shot runs f unless the run is already over its CPU time.
+func (m *meter) shot(f func() error) error {
+	if m.limit > 0 && time.Duration(m.busy.Load()) >= m.limit {
+		return fmt.Errorf("%w: CPU time over %s", ErrResourceLimit, m.limit)
+	}
+	start := time.Now()
+	err := f()
+	m.busy.Add(int64(time.Since(start)))
+	return err
+}
+
+// RunMetered runs c like Run while accounting for its CPU time and memory,
+// failing with an error wrapping ErrResourceLimit when it exceeds limits.
+// The usage is returned whether or not the run succeeds.
+func (s *Simulator) RunMetered(c circuit.Circuit, limits ResourceLimits) (map[string]int, Usage, error) {
+	exec, _ := s.plan(c)
+	u := Usage{PeakMemory: EstimateMemory(exec, s.Workers)}
+	if limits.Memory > 0 && u.PeakMemory > limits.Memory {
+		return nil, u, fmt.Errorf("%w: needs about %d bytes, over %d", ErrResourceLimit, u.PeakMemory, limits.Memory)
+	}
+	m := *s
+	m.meter = &meter{limit: limits.CPUTime}
+	start := time.Now()
+	hist, err := m.Run(c)
+	u.Wall = time.Since(start)
+	u.CPUTime = time.Duration(m.meter.busy.Load())
+	if u.CPUTime == 0 {
+		// Sampled or shortcut: no shots were run to check the limit against.
+		u.CPUTime = u.Wall
+		if err == nil && limits.CPUTime > 0 && u.CPUTime > limits.CPUTime {
+			err = fmt.Errorf("%w: CPU time %s over %s", ErrResourceLimit, u.CPUTime, limits.CPUTime)
+		}
+	}
+	if err != nil {
+		return nil, u, err
+	}
+	return hist, u, nil
+}
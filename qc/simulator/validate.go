@@ -0,0 +1,168 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// Calibration is the cost model Validate estimates run times with: one
+// operation on a circuit of Qubits qubits takes PerOp, and every further
+// qubit multiplies that by Growth (2 for a statevector).
+type Calibration struct {
+	PerOp  time.Duration
+	Qubits int
+	Growth float64
+}
+
+// opTime returns the estimated time of one operation on qubits qubits.
+func (cal Calibration) opTime(qubits int) time.Duration {
+	return time.Duration(float64(cal.PerOp) * math.Pow(cal.Growth, float64(qubits-cal.Qubits)))
+}
+
+// calibrations holds the cost models of the bundled runners by short
+// name, measured on a laptop core.
+var calibrations = map[string]Calibration{
+	"qsim": {PerOp: 2 * time.Microsecond, Qubits: 10, Growth: 2},
+	"itsu": {PerOp: 10 * time.Millisecond, Qubits: 10, Growth: 4},
+}
+
+// ValidationReport is what Validate found out about a run without running
+// it.
+type ValidationReport struct {
+	Runner string // the runner's short name, or its Go type
+	// Qubits, Clbits and Operations describe the circuit the runner would
+	// execute, after tapering and light cones.
+	Qubits, Clbits, Operations int
+	// Sampled reports whether the shots would be drawn from one final
+	// statevector instead of running the circuit once per shot.
+	Sampled bool
+	// Memory is the estimated peak memory in bytes, see EstimateMemory.
+	Memory int64
+	// Time is the estimated wall time from the runner's Calibration; 0 if
+	// the runner has none.
+	Time time.Duration
+	// Problems are the reasons the run would fail; none if it can go ahead.
+	Problems []error
+}
+
+// Err joins the problems into one error, nil if there are none.
+func (r ValidationReport) Err() error {
+	return errors.Join(r.Problems...)
+}
+
+// String formats the report for people.
+func (r ValidationReport) String() string {
+	var sb strings.Builder
+	mode := "per shot"
+	if r.Sampled {
+		mode = "sampled from one statevector"
+	}
+	fmt.Fprintf(&sb, "runner:     %s\n", r.Runner)
+	fmt.Fprintf(&sb, "circuit:    %d qubits, %d cbits, %d operations\n", r.Qubits, r.Clbits, r.Operations)
+	fmt.Fprintf(&sb, "execution:  %s\n", mode)
+	fmt.Fprintf(&sb, "memory:     ~%s\n", formatBytes(r.Memory))
+	if r.Time > 0 {
+		prec := time.Nanosecond
+		switch {
+		case r.Time >= time.Second:
+			prec = time.Millisecond
+		case r.Time >= time.Millisecond:
+			prec = time.Microsecond
+		}
+		fmt.Fprintf(&sb, "time:       ~%s\n", r.Time.Round(prec))
+	} else {
+		fmt.Fprintf(&sb, "time:       unknown (no calibration)\n")
+	}
+	if len(r.Problems) == 0 {
+		sb.WriteString("status:     ok\n")
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(&sb, "problem:    %v\n", p)
+	}
+	return sb.String()
+}
+
+// Validate checks c against the runner without running any shot, so
+// incompatibilities surface before a long run rather than during it: the
+// runner's capabilities, its own ValidateCircuit if it implements
+// ValidatingRunner, statevector width and post-selected bits. It also
+// estimates the run's memory and, for runners with a calibration (see
+// Simulator.Calibration), its time. The error joins the report's
+// problems.
+func (s *Simulator) Validate(c circuit.Circuit) (ValidationReport, error) {
+	exec, _ := s.plan(c)
+	r := ValidationReport{
+		Runner:     fmt.Sprintf("%T", s.runner),
+		Qubits:     exec.Qubits(),
+		Clbits:     exec.Clbits(),
+		Operations: exec.NumOps(),
+		Memory:     EstimateMemory(exec, s.Workers),
+	}
+	if bp, ok := s.runner.(BackendProvider); ok {
+		r.Runner = bp.GetBackendInfo().ShortName
+	}
+
+	capErr := s.checkCapabilities(c)
+	if capErr != nil {
+		r.Problems = append(r.Problems, capErr)
+	}
+	_, getter := s.runner.(StatevectorGetter)
+	if getter {
+		if err := CheckStatevectorWidth(exec.Qubits()); err != nil {
+			r.Problems = append(r.Problems, err)
+		}
+	}
+	if vr, ok := s.runner.(ValidatingRunner); ok {
+		// An unsupported gate found by checkCapabilities is reported once.
+		var unsupported *UnsupportedGateError
+		err := vr.ValidateCircuit(exec)
+		if err != nil && !(errors.As(capErr, &unsupported) && errors.As(err, &unsupported)) {
+			r.Problems = append(r.Problems, fmt.Errorf("simulator: runner %s rejects the circuit: %w", r.Runner, err))
+		}
+	}
+	measured := measuredCbits(c)
+	for _, cb := range slices.Sorted(maps.Keys(s.PostSelect)) {
+		if !slices.Contains(measured, cb) {
+			r.Problems = append(r.Problems, fmt.Errorf("simulator: post-selected cbit %d is never measured", cb))
+		}
+	}
+
+	r.Sampled = getter && terminalMeasurements(exec) && s.UniformNoise == 0
+	cal, ok := calibrations[r.Runner]
+	if s.Calibration != nil {
+		cal, ok = *s.Calibration, true
+	}
+	if ok {
+		t := float64(r.Operations) * float64(cal.opTime(r.Qubits))
+		if !r.Sampled {
+			workers := max(min(s.Workers, s.Shots), 1)
+			t *= math.Ceil(float64(s.Shots) / float64(workers))
+		}
+		r.Time = time.Duration(min(t, math.MaxInt64))
+	}
+	return r, r.Err()
+}
+
+// formatBytes prints n in binary units.
+func formatBytes(n int64) string {
+	if n == math.MaxInt64 {
+		return "unbounded"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/kegliz/qcm/qc/circuit"
+)
+
+// WarmStartRunner is implemented by runners that can start a circuit from
+// a given statevector instead of |0…0⟩.
+type WarmStartRunner interface {
+	RunOnceFrom(state []complex128, c circuit.Circuit) (string, error)
+	StatevectorFrom(state []complex128, c circuit.Circuit) ([]complex128, error)
+}
+
+// RunFrom runs c starting from state, typically the GetStatevector of a
+// preparation circuit, so that several measurement circuits can share one
+// expensive preparation. state is indexed like a statevector of c (qubit q
+// is bit q) and must be normalised. With terminal measurements the shots
+// are sampled from one final state; otherwise every shot replays c from
+// state. Taper, light cone and post-selection assume |0…0⟩ and are not
+// applied.
+func (s *Simulator) RunFrom(state []complex128, c circuit.Circuit) (map[string]int, error) {
+	runner, ok := s.runner.(WarmStartRunner)
+	if !ok {
+		return nil, fmt.Errorf("simulator: runner cannot start from a given state")
+	}
+	if err := CheckStatevectorWidth(c.Qubits()); err != nil {
+		return nil, err
+	}
+	if len(state) != 1<<c.Qubits() {
+		return nil, fmt.Errorf("simulator: initial state has %d amplitudes, want %d for %d qubit(s)",
+			len(state), 1<<c.Qubits(), c.Qubits())
+	}
+	if n := sum(Probabilities(state)); math.Abs(n-1) > s.tolerance() {
+		return nil, fmt.Errorf("simulator: initial state is not normalised (norm² %.9g)", n)
+	}
+	if len(s.PostSelect) > 0 {
+		return nil, fmt.Errorf("simulator: post-selection is not supported by RunFrom")
+	}
+	if err := s.checkCapabilities(c); err != nil {
+		return nil, err
+	}
+	project := keyProjector(c)
+	s.log.Info().
+		Int("shots", s.Shots).
+		Int("qubits", c.Qubits()).
+		Int("depth", c.Depth()).
+		Msg("simulator: Starting RunFrom")
+
+	if terminalMeasurements(c) {
+		sv, err := runner.StatevectorFrom(state, c)
+		if err != nil {
+			return nil, err
+		}
+		return s.sampleState(sv, CbitSources(c.Clbits(), c.OpsIter()), unmeasured(c.Qubits(), measurements(c)), project), nil
+	}
+	if s.IncludeUnmeasured {
+		return nil, fmt.Errorf("simulator: IncludeUnmeasured needs a statevector runner and terminal measurements")
+	}
+
+	workers := min(max(s.Workers, 1), s.Shots)
+	hists := make([]map[string]int, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		hists[w] = map[string]int{}
+		n := s.Shots / workers
+		if w < s.Shots%workers {
+			n++
+		}
+		wg.Add(1)
+		s.spawn(func() {
+			defer wg.Done()
+			for range n {
+				key, err := runner.RunOnceFrom(state, c)
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				hists[w][project(key)]++
+			}
+		})
+	}
+	wg.Wait()
+	hist := map[string]int{}
+	for w, h := range hists {
+		if errs[w] != nil {
+			return nil, fmt.Errorf("worker %d failed: %w", w, errs[w])
+		}
+		for k, n := range h {
+			hist[k] += n
+		}
+	}
+	return hist, nil
+}
+
+func sum(xs []float64) float64 {
+	t := 0.0
+	for _, x := range xs {
+		t += x
+	}
+	return t
+}
@@ -0,0 +1,30 @@
+package simulator
+
+import "fmt"
+
+// MaxStatevectorQubits bounds the circuits statevector backends accept: 2^30
+// amplitudes already take 16 GiB. Circuits, builders and the simulator's
+// own passes index qubits with plain ints and have no such limit, so wide
+// circuits can still be tapered or light-coned down to a simulable width,
+// or run by backends that do not store a statevector.
+const MaxStatevectorQubits = 30
+
+// WidthError reports a circuit too wide for a statevector backend.
+type WidthError struct {
+	Qubits int // width of the circuit
+	Max    int // widest circuit the backend accepts
+}
+
+func (e *WidthError) Error() string {
+	return fmt.Sprintf("simulator: %d qubit(s) exceed the statevector limit of %d", e.Qubits, e.Max)
+}
+
+// CheckStatevectorWidth returns a *WidthError if a statevector of qubits
+// qubits exceeds MaxStatevectorQubits. Backends call it before allocating
+// 2^qubits amplitudes, which would otherwise overflow or exhaust memory.
+func CheckStatevectorWidth(qubits int) error {
+	if qubits > MaxStatevectorQubits {
+		return &WidthError{Qubits: qubits, Max: MaxStatevectorQubits}
+	}
+	return nil
+}
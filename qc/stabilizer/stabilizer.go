@@ -0,0 +1,121 @@
+// Package stabilizer implements the stabilizer tableau of Aaronson and
+// Gottesman: Pauli strings on n qubits stored as X and Z bit rows with a
+// sign bit each, updated in place by Clifford gates. The simulator tracks
+// stabilizer states with it to spot deterministic circuits, and synth
+// reduces tableaus with it to prepare stabilizer states.
+package stabilizer
+
+// Tableau holds Pauli strings on N qubits: row i is the product over q of
+// X_q if X[i][q] and Z_q if Z[i][q] (both for Y), negated if R[i]. What
+// the rows mean, stabilizers, destabilizers or scratch, is up to the
+// caller.
+type Tableau struct {
+	N    int
+	X, Z [][]bool
+	R    []bool
+}
+
+// New returns a tableau of rows identity strings on n qubits.
+func New(rows, n int) *Tableau {
+	t := &Tableau{N: n, X: make([][]bool, rows), Z: make([][]bool, rows), R: make([]bool, rows)}
+	for i := range rows {
+		t.X[i], t.Z[i] = make([]bool, n), make([]bool, n)
+	}
+	return t
+}
+
+// H conjugates every row by a Hadamard on q.
+func (t *Tableau) H(q int) {
+	for i := range t.X {
+		t.R[i] = t.R[i] != (t.X[i][q] && t.Z[i][q])
+		t.X[i][q], t.Z[i][q] = t.Z[i][q], t.X[i][q]
+	}
+}
+
+// S conjugates every row by a phase gate on q.
+func (t *Tableau) S(q int) {
+	for i := range t.X {
+		t.R[i] = t.R[i] != (t.X[i][q] && t.Z[i][q])
+		t.Z[i][q] = t.Z[i][q] != t.X[i][q]
+	}
+}
+
+// Pauli applies the Pauli gate p ('X', 'Y' or 'Z') on q, which negates
+// the rows it anticommutes with: for X those with a Z on q, for Z those
+// with an X, and for Y those with one but not both.
+func (t *Tableau) Pauli(q int, p byte) {
+	onX, onZ := p != 'X', p != 'Z'
+	for i := range t.X {
+		t.R[i] = t.R[i] != ((onX && t.X[i][q]) != (onZ && t.Z[i][q]))
+	}
+}
+
+// CNOT conjugates every row by a CNOT with control a and target b.
+func (t *Tableau) CNOT(a, b int) {
+	for i := range t.X {
+		t.R[i] = t.R[i] != (t.X[i][a] && t.Z[i][b] && (t.X[i][b] == t.Z[i][a]))
+		t.X[i][b] = t.X[i][b] != t.X[i][a]
+		t.Z[i][a] = t.Z[i][a] != t.Z[i][b]
+	}
+}
+
+// CZ conjugates every row by a CZ on a and b.
+func (t *Tableau) CZ(a, b int) {
+	t.H(b)
+	t.CNOT(a, b)
+	t.H(b)
+}
+
+// SWAP exchanges qubits a and b in every row.
+func (t *Tableau) SWAP(a, b int) {
+	t.CNOT(a, b)
+	t.CNOT(b, a)
+	t.CNOT(a, b)
+}
+
+// Swap exchanges rows i and j.
+func (t *Tableau) Swap(i, j int) {
+	t.X[i], t.X[j] = t.X[j], t.X[i]
+	t.Z[i], t.Z[j] = t.Z[j], t.Z[i]
+	t.R[i], t.R[j] = t.R[j], t.R[i]
+}
+
+// Rowsum replaces row h by the product of rows h and i, tracking the sign
+// through the power of i each qubit contributes. The rows must commute
+// for the product to be Hermitian.
+func (t *Tableau) Rowsum(h, i int) {
+	e := 0
+	if t.R[h] {
+		e += 2
+	}
+	if t.R[i] {
+		e += 2
+	}
+	for q := range t.N {
+		e += phaseExp(t.X[i][q], t.Z[i][q], t.X[h][q], t.Z[h][q])
+		t.X[h][q] = t.X[h][q] != t.X[i][q]
+		t.Z[h][q] = t.Z[h][q] != t.Z[i][q]
+	}
+	t.R[h] = ((e%4)+4)%4 == 2
+}
+
+// phaseExp is the exponent of i in the product of the single-qubit Paulis
+// (x1,z1)·(x2,z2).
+func phaseExp(x1, z1, x2, z2 bool) int {
+	b := func(v bool) int {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case !x1 && !z1:
+		return 0
+	case x1 && z1:
+		return b(z2) - b(x2)
+	case x1:
+		return b(z2) * (2*b(x2) - 1)
+	default:
+		return b(x2) * (1 - 2*b(z2))
+	}
+}
@@ -0,0 +1,65 @@
+package stabilizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// row renders row i as a signed Pauli string, qubit 0 first.
+func row(t *Tableau, i int) string {
+	var sb strings.Builder
+	if t.R[i] {
+		sb.WriteByte('-')
+	} else {
+		sb.WriteByte('+')
+	}
+	for q := range t.N {
+		sb.WriteByte("IZXY"[b2i(t.X[i][q])*2+b2i(t.Z[i][q])])
+	}
+	return sb.String()
+}
+
+func b2i(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func TestTableau(t *testing.T) {
+	// |00⟩ is stabilised by ZI and IZ; the Bell circuit turns them into XX
+	// and ZZ.
+	tb := New(2, 2)
+	tb.Z[0][0], tb.Z[1][1] = true, true
+	tb.H(0)
+	tb.CNOT(0, 1)
+	assert.Equal(t, []string{"+XX", "+ZZ"}, []string{row(tb, 0), row(tb, 1)})
+
+	// XX·ZZ = (XZ)⊗(XZ) = (-iY)⊗(-iY) = -YY.
+	tb.Rowsum(0, 1)
+	assert.Equal(t, "-YY", row(tb, 0))
+
+	// X on qubit 0 anticommutes with Y and Z there.
+	tb.Pauli(0, 'X')
+	assert.Equal(t, []string{"+YY", "-ZZ"}, []string{row(tb, 0), row(tb, 1)})
+	tb.Pauli(0, 'Y')
+	assert.Equal(t, []string{"+YY", "+ZZ"}, []string{row(tb, 0), row(tb, 1)})
+	tb.Pauli(1, 'Z')
+	assert.Equal(t, []string{"-YY", "+ZZ"}, []string{row(tb, 0), row(tb, 1)})
+
+	// S maps Y to -X, and CZ is symmetric in its qubits.
+	tb.S(0)
+	assert.Equal(t, "+XY", row(tb, 0))
+	a, b := New(1, 2), New(1, 2)
+	a.X[0][0], b.X[0][0] = true, true
+	a.CZ(0, 1)
+	b.CZ(1, 0)
+	assert.Equal(t, row(a, 0), row(b, 0))
+	assert.Equal(t, "+XZ", row(a, 0))
+
+	tb.SWAP(0, 1)
+	tb.Swap(0, 1)
+	assert.Equal(t, []string{"+ZZ", "+YX"}, []string{row(tb, 0), row(tb, 1)})
+}
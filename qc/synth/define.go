@@ -0,0 +1,21 @@
+package synth
+
+import "github.com/kegliz/qcm/qc/gate"
+
+// Define registers a user gate given only by its unitary u, as Decompose
+// takes it: the decomposition into RY, RZ and CNOT gates serves runners
+// and exporters, while runners that apply dense matrices use u directly.
+// symbol is drawn by renderers; the name if empty. See gate.Define.
+func Define(name, symbol string, u [][]complex128) (*gate.Composite, error) {
+	c, err := Decompose(u, RotationBasis)
+	if err != nil {
+		return nil, err
+	}
+	return gate.Define(gate.Custom{
+		Name:   name,
+		Symbol: symbol,
+		Qubits: c.QubitSpan(),
+		Steps:  c.Steps(),
+		Matrix: u,
+	})
+}
@@ -0,0 +1,182 @@
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// matrix is a dense complex matrix indexed [row][col].
+type matrix [][]complex128
+
+func zeros(r, c int) matrix {
+	m := make(matrix, r)
+	for i := range m {
+		m[i] = make([]complex128, c)
+	}
+	return m
+}
+
+func eye(n int) matrix {
+	m := zeros(n, n)
+	for i := range m {
+		m[i][i] = 1
+	}
+	return m
+}
+
+func (m matrix) mul(o matrix) matrix {
+	out := zeros(len(m), len(o[0]))
+	for i := range m {
+		for k, a := range m[i] {
+			if a == 0 {
+				continue
+			}
+			for j, b := range o[k] {
+				out[i][j] += a * b
+			}
+		}
+	}
+	return out
+}
+
+func (m matrix) adj() matrix {
+	out := zeros(len(m[0]), len(m))
+	for i := range m {
+		for j, a := range m[i] {
+			out[j][i] = cmplx.Conj(a)
+		}
+	}
+	return out
+}
+
+// block returns the h×w sub-matrix starting at (r, c).
+func (m matrix) block(r, c, h, w int) matrix {
+	out := zeros(h, w)
+	for i := range h {
+		copy(out[i], m[r+i][c:c+w])
+	}
+	return out
+}
+
+func (m matrix) col(j int) []complex128 {
+	v := make([]complex128, len(m))
+	for i := range m {
+		v[i] = m[i][j]
+	}
+	return v
+}
+
+func (m matrix) setCol(j int, v []complex128) {
+	for i := range m {
+		m[i][j] = v[i]
+	}
+}
+
+// dist is the largest entry-wise difference between m and o.
+func (m matrix) dist(o matrix) float64 {
+	d := 0.0
+	for i := range m {
+		for j := range m[i] {
+			d = max(d, cmplx.Abs(m[i][j]-o[i][j]))
+		}
+	}
+	return d
+}
+
+func dot(a, b []complex128) complex128 {
+	var s complex128
+	for i := range a {
+		s += cmplx.Conj(a[i]) * b[i]
+	}
+	return s
+}
+
+func norm(v []complex128) float64 { return math.Sqrt(real(dot(v, v))) }
+
+func scale(v []complex128, f complex128) []complex128 {
+	out := make([]complex128, len(v))
+	for i := range v {
+		out[i] = v[i] * f
+	}
+	return out
+}
+
+// orthonormalize runs modified Gram-Schmidt over the columns of m in the
+// given order. Columns marked in keep are trusted and only cleaned up;
+// the others, and any that collapse, are replaced by the first standard
+// basis vector still independent of the columns before them.
+func orthonormalize(m matrix, order []int, keep []bool) {
+	n := len(m)
+	var done [][]complex128
+	project := func(v []complex128) []complex128 {
+		for _, u := range done {
+			d := dot(u, v)
+			for i := range v {
+				v[i] -= d * u[i]
+			}
+		}
+		return v
+	}
+	next := 0
+	for _, j := range order {
+		v := project(m.col(j))
+		if !keep[j] || norm(v) < 0.5 {
+			for ; ; next++ {
+				e := make([]complex128, n)
+				e[next] = 1
+				if v = project(e); norm(v) > 0.5 {
+					next++
+					break
+				}
+			}
+		}
+		v = scale(v, complex(1/norm(v), 0))
+		m.setCol(j, v)
+		done = append(done, v)
+	}
+}
+
+// eigh diagonalises the Hermitian matrix h with cyclic complex Jacobi
+// rotations and returns the unitary whose columns are the eigenvectors.
+func eigh(h matrix) matrix {
+	n := len(h)
+	a := h.mul(eye(n))
+	v := eye(n)
+	for range 100 {
+		off, scale := 0.0, 0.0
+		for p := range n {
+			scale = max(scale, cmplx.Abs(a[p][p]))
+			for q := p + 1; q < n; q++ {
+				off = max(off, cmplx.Abs(a[p][q]))
+			}
+		}
+		if off <= 1e-15*max(scale, 1) {
+			break
+		}
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				apq := cmplx.Abs(a[p][q])
+				if apq < 1e-300 {
+					continue
+				}
+				// Phase a[p][q] onto the real axis, then rotate as in the
+				// real symmetric case.
+				ph := a[p][q] / complex(apq, 0)
+				theta := (real(a[q][q]) - real(a[p][p])) / (2 * apq)
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				j := eye(n)
+				// J = diag(1, …, ph*, …)·P, so row q carries the phase.
+				j[p][p], j[p][q] = complex(c, 0), complex(s, 0)
+				j[q][p], j[q][q] = complex(-s, 0)*cmplx.Conj(ph), complex(c, 0)*cmplx.Conj(ph)
+				a = j.adj().mul(a).mul(j)
+				v = v.mul(j)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,63 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// Eigenstates decomposes the density matrix rho (indexed [row][col], qubit
+// q bit q) into the weights and normalised eigenvectors of its non-zero
+// eigenvalues, ρ = Σ weights[k] |states[k]⟩⟨states[k]|, as
+// simulator.Mixture takes them. rho must be Hermitian, positive
+// semidefinite and of unit trace.
+func Eigenstates(rho [][]complex128) (weights []float64, states [][]complex128, err error) {
+	n := len(rho)
+	if n < 2 || n&(n-1) != 0 {
+		return nil, nil, fmt.Errorf("synth: density matrix size %d is not a power of two ≥ 2", n)
+	}
+	for i, row := range rho {
+		if len(row) != n {
+			return nil, nil, fmt.Errorf("synth: density matrix row %d has %d entries, want %d", i, len(row), n)
+		}
+	}
+	trace := 0.0
+	for i := range n {
+		trace += real(rho[i][i])
+		for j := i; j < n; j++ {
+			if cmplx.Abs(rho[i][j]-cmplx.Conj(rho[j][i])) > tol {
+				return nil, nil, fmt.Errorf("synth: density matrix is not Hermitian at [%d][%d]", i, j)
+			}
+		}
+	}
+	if math.Abs(trace-1) > tol {
+		return nil, nil, fmt.Errorf("synth: density matrix has trace %.9g, want 1", trace)
+	}
+
+	v := eigh(matrix(rho))
+	d := v.adj().mul(matrix(rho)).mul(v)
+	for k := range n {
+		w := real(d[k][k])
+		if w < -tol {
+			return nil, nil, fmt.Errorf("synth: density matrix has negative eigenvalue %.9g", w)
+		}
+		if w <= tol {
+			continue
+		}
+		state := make([]complex128, n)
+		for i := range n {
+			state[i] = v[i][k]
+		}
+		weights = append(weights, w)
+		states = append(states, state)
+	}
+	// Renormalise the weights after dropping round-off eigenvalues.
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	for k := range weights {
+		weights[k] /= total
+	}
+	return weights, states, nil
+}
@@ -0,0 +1,80 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Random draws reproducible random angles, states and unitaries, as
+// randomized benchmarking, quantum volume and twirling need. The same
+// seed gives the same sequence of draws. A Random is not safe for
+// concurrent use.
+type Random struct {
+	rng *rand.Rand
+}
+
+// NewRandom returns a source of draws seeded with seed.
+func NewRandom(seed int64) *Random {
+	return &Random{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Angle returns an angle uniform in [0, 2π).
+func (r *Random) Angle() float64 {
+	return 2 * math.Pi * r.rng.Float64()
+}
+
+// Angles returns n angles uniform in [0, 2π).
+func (r *Random) Angles(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = r.Angle()
+	}
+	return out
+}
+
+// Unitary returns a Haar-random unitary on n qubits as a 2^n×2^n matrix
+// indexed [row][col], as Decompose takes it: the Gram-Schmidt
+// orthonormalisation of a complex Gaussian matrix.
+func (r *Random) Unitary(n int) ([][]complex128, error) {
+	if n < 1 || n > MaxQubits {
+		return nil, fmt.Errorf("synth: random unitary on %d qubits, want 1 to %d", n, MaxQubits)
+	}
+	m := zeros(1<<n, 1<<n)
+	for i := range m {
+		for j := range m[i] {
+			m[i][j] = complex(r.rng.NormFloat64(), r.rng.NormFloat64())
+		}
+	}
+	keep := make([]bool, len(m))
+	for i := range keep {
+		keep[i] = true
+	}
+	orthonormalize(m, span(len(m)), keep)
+	return m, nil
+}
+
+// Gate returns a Haar-random gate on n qubits, decomposed into RY, RZ and
+// CNOT gates, as used by quantum volume circuits on n = 2.
+func (r *Random) Gate(n int) (*gate.Composite, error) {
+	u, err := r.Unitary(n)
+	if err != nil {
+		return nil, err
+	}
+	return Decompose(u, RotationBasis)
+}
+
+// State returns the amplitudes of a Haar-random pure state on n qubits,
+// a normalised complex Gaussian vector.
+func (r *Random) State(n int) ([]complex128, error) {
+	if n < 1 || n > MaxQubits {
+		return nil, fmt.Errorf("synth: random state on %d qubits, want 1 to %d", n, MaxQubits)
+	}
+	v := make([]complex128, 1<<n)
+	for i := range v {
+		v[i] = complex(r.rng.NormFloat64(), r.rng.NormFloat64())
+	}
+	return scale(v, complex(1/norm(v), 0)), nil
+}
@@ -0,0 +1,207 @@
+package synth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/stabilizer"
+)
+
+// GraphState returns a composite preparing the graph state of the graph
+// with adjacency lists adj on len(adj) qubits: H on every qubit, then CZ
+// on every edge. Edges may be listed from either end or both.
+func GraphState(adj [][]int) (*gate.Composite, error) {
+	n := len(adj)
+	if n == 0 {
+		return nil, fmt.Errorf("synth: graph state needs at least one vertex")
+	}
+	var steps []gate.Step
+	for q := range n {
+		steps = append(steps, gate.Step{G: gate.H(), Qubits: []int{q}})
+	}
+	seen := map[[2]int]bool{}
+	for a, nbrs := range adj {
+		for _, b := range nbrs {
+			if b < 0 || b >= n || b == a {
+				return nil, fmt.Errorf("synth: invalid edge %d-%d in a graph of %d vertices", a, b, n)
+			}
+			e := [2]int{min(a, b), max(a, b)}
+			if !seen[e] {
+				seen[e] = true
+				steps = append(steps, gate.Step{G: gate.CZ(), Qubits: e[:]})
+			}
+		}
+	}
+	return gate.NewComposite("GRAPH", n, steps)
+}
+
+// StabilizerState returns a Clifford circuit (H, S, Z, X and CZ)
+// preparing the state stabilised by generators, n independent, commuting
+// Pauli strings on n qubits such as "+XX" and "-ZZ". Character i of each
+// string acts on qubit i; the optional sign prefix is + or -.
+//
+// The tableau is reduced to +Z on every qubit by Gaussian elimination, in
+// the manner of Aaronson and Gottesman, and the recorded gates are undone.
+func StabilizerState(generators []string) (*gate.Composite, error) {
+	t, err := parseTableau(generators)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.reduce(); err != nil {
+		return nil, err
+	}
+	// Undo the reduction: every recorded gate is its own inverse except S.
+	var steps []gate.Step
+	for i := len(t.gates) - 1; i >= 0; i-- {
+		s := t.gates[i]
+		if s.G.Name() == "S" {
+			steps = append(steps, gate.Step{G: gate.Z(), Qubits: s.Qubits})
+		}
+		steps = append(steps, s)
+	}
+	return gate.NewComposite("STABILIZER", t.N, steps)
+}
+
+// tableau holds stabilizer generators, one row each, plus the gates
+// applied to it so far.
+type tableau struct {
+	*stabilizer.Tableau
+	gates []gate.Step
+}
+
+func parseTableau(generators []string) (*tableau, error) {
+	n := len(generators)
+	if n == 0 {
+		return nil, fmt.Errorf("synth: stabilizer state needs at least one generator")
+	}
+	t := &tableau{Tableau: stabilizer.New(n, n)}
+	for i, g := range generators {
+		p := g
+		switch {
+		case strings.HasPrefix(p, "-"):
+			t.R[i], p = true, p[1:]
+		case strings.HasPrefix(p, "+"):
+			p = p[1:]
+		}
+		if len(p) != n {
+			return nil, fmt.Errorf("synth: generator %q acts on %d qubits, want %d", g, len(p), n)
+		}
+		for q, c := range strings.ToUpper(p) {
+			switch c {
+			case 'I':
+			case 'X':
+				t.X[i][q] = true
+			case 'Z':
+				t.Z[i][q] = true
+			case 'Y':
+				t.X[i][q], t.Z[i][q] = true, true
+			default:
+				return nil, fmt.Errorf("synth: generator %q: unknown Pauli %q", g, c)
+			}
+		}
+	}
+	for i := range n {
+		for j := range i {
+			anti := false
+			for q := range n {
+				term := (t.X[i][q] && t.Z[j][q]) != (t.Z[i][q] && t.X[j][q])
+				anti = anti != term
+			}
+			if anti {
+				return nil, fmt.Errorf("synth: generators %q and %q anticommute", generators[j], generators[i])
+			}
+		}
+	}
+	return t, nil
+}
+
+// reduce applies Clifford gates until every row is +Z on its own qubit.
+func (t *tableau) reduce() error {
+	n := t.N
+	// Reduced echelon form of the X block, bringing Z-only columns over with
+	// H; n independent generators leave a pivot in every column.
+	pivot := make([]int, 0, n)
+	for q := 0; q < n && len(pivot) < n; q++ {
+		k := len(pivot)
+		r := t.find(k, func(i int) bool { return t.X[i][q] })
+		if r < 0 {
+			if r = t.find(k, func(i int) bool { return t.Z[i][q] }); r < 0 {
+				continue
+			}
+			t.h(q)
+		}
+		t.Swap(r, k)
+		for i := range n {
+			if i != k && t.X[i][q] {
+				t.Rowsum(i, k)
+			}
+		}
+		pivot = append(pivot, q)
+	}
+	if len(pivot) < n {
+		return fmt.Errorf("synth: stabilizer generators are not independent")
+	}
+	// The X block is now the identity, so row k is X on qubit k times Z on
+	// a symmetric pattern (the rows commute), as for a graph state. CZ clears
+	// the pairs, S the Z on the qubit itself, and H turns X into Z.
+	for k, p := range pivot {
+		for l := k + 1; l < len(pivot); l++ {
+			if t.Z[k][pivot[l]] {
+				t.cz(p, pivot[l])
+			}
+		}
+		if t.Z[k][p] {
+			t.s(p)
+		}
+		t.h(p)
+	}
+	for i := range n {
+		if t.R[i] {
+			q := 0
+			for !t.Z[i][q] {
+				q++
+			}
+			t.xgate(q)
+		}
+	}
+	return nil
+}
+
+func (t *tableau) find(from int, ok func(int) bool) int {
+	for i := from; i < t.N; i++ {
+		if ok(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *tableau) record(g gate.Gate, qs ...int) {
+	t.gates = append(t.gates, gate.Step{G: g, Qubits: qs})
+}
+
+func (t *tableau) h(q int) {
+	t.H(q)
+	t.record(gate.H(), q)
+}
+
+func (t *tableau) s(q int) {
+	t.S(q)
+	t.record(gate.S(), q)
+}
+
+func (t *tableau) xgate(q int) {
+	t.Pauli(q, 'X')
+	t.record(gate.X(), q)
+}
+
+func (t *tableau) cnot(a, b int) {
+	t.CNOT(a, b)
+	t.record(gate.CNOT(), a, b)
+}
+
+func (t *tableau) cz(a, b int) {
+	t.CZ(a, b)
+	t.record(gate.CZ(), a, b)
+}
@@ -0,0 +1,77 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// PrepareState returns a composite gate on n qubits that maps |0…0⟩ to the
+// normalised state with the given 2^n amplitudes (qubit q is bit q of the
+// index), using RY, RZ and CNOT gates plus P gates for the global phase.
+//
+// This is the construction of Möttönen et al.: multiplexed RY rotations set
+// the magnitudes qubit by qubit from the highest down, each controlled by
+// the qubits above it, and a cascade of multiplexed RZ rotations then adds
+// the phases. Multiplexors whose angles do not depend on a control skip it,
+// so product and real states stay cheap.
+func PrepareState(amplitudes []complex128) (*gate.Composite, error) {
+	n := 0
+	for 1<<n < len(amplitudes) {
+		n++
+	}
+	if len(amplitudes) < 2 || 1<<n != len(amplitudes) {
+		return nil, fmt.Errorf("synth: %d amplitudes is not a power of two ≥ 2", len(amplitudes))
+	}
+	sum := 0.0
+	for _, a := range amplitudes {
+		sum += real(a)*real(a) + imag(a)*imag(a)
+	}
+	if math.Abs(sum-1) > tol {
+		return nil, fmt.Errorf("synth: state is not normalised (norm² %.9g)", sum)
+	}
+
+	var e emitter
+	qubits := span(n)
+	// Magnitudes: for each value i of the qubits above q, RY splits their
+	// probability between q = 0 and q = 1.
+	prob := make([]float64, len(amplitudes))
+	for i, a := range amplitudes {
+		prob[i] = real(a)*real(a) + imag(a)*imag(a)
+	}
+	for q := n - 1; q >= 0; q-- {
+		angles := make([]float64, 1<<(n-1-q))
+		for i := range angles {
+			var p0, p1 float64
+			for low := range 1 << q {
+				p0 += prob[i<<(q+1)|low]
+				p1 += prob[i<<(q+1)|1<<q|low]
+			}
+			angles[i] = 2 * math.Atan2(math.Sqrt(p1), math.Sqrt(p0))
+		}
+		e.ucr(gate.RY, angles, q, qubits[q+1:])
+	}
+
+	// Phases: diag(e^{iφ}) splits on qubit q into RZ(φ1-φ0) multiplexed by
+	// the qubits above and the mean phase left for them.
+	phases := make([]float64, len(amplitudes))
+	for i, a := range amplitudes {
+		if cmplx.Abs(a) > 1e-12 {
+			phases[i] = cmplx.Phase(a)
+		}
+	}
+	for q := range n {
+		h := len(phases) / 2
+		angles, mean := make([]float64, h), make([]float64, h)
+		for i := range h {
+			angles[i] = phases[2*i+1] - phases[2*i]
+			mean[i] = (phases[2*i+1] + phases[2*i]) / 2
+		}
+		e.ucr(gate.RZ, angles, q, qubits[q+1:])
+		phases = mean
+	}
+	e.phase += phases[0]
+	return gate.NewComposite("INIT", n, e.finish(RotationBasis))
+}
@@ -0,0 +1,321 @@
+// Package synth turns matrices and states into circuits of primitive gates.
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// MaxQubits bounds Decompose. The Shannon decomposition emits O(4^n)
+// gates, so it is meant for small blocks; about 4 qubits is practical.
+const MaxQubits = 6
+
+// tol is the accuracy expected of input matrices and of the synthesis.
+const tol = 1e-9
+
+// Basis names the primitive gates a synthesised circuit may use.
+type Basis int
+
+const (
+	// RotationBasis emits RY, RZ and CNOT, plus P gates for the global phase.
+	RotationBasis Basis = iota
+	// CZBasis emits RY, RZ and CZ, plus P gates for the global phase.
+	CZBasis
+	// PhaseBasis emits H, P and CNOT only.
+	PhaseBasis
+)
+
+func (b Basis) String() string {
+	switch b {
+	case RotationBasis:
+		return "rotation"
+	case CZBasis:
+		return "cz"
+	case PhaseBasis:
+		return "phase"
+	}
+	return fmt.Sprintf("Basis(%d)", int(b))
+}
+
+// Decompose synthesises the unitary u, given as a 2^n×2^n matrix indexed
+// [row][col], into a composite gate on n qubits using only the gates of
+// basis. Qubit q is bit q of the row and column indices, as in the
+// simulators' statevectors. The result is exact, global phase included,
+// so it can itself be controlled.
+//
+// The quantum Shannon decomposition is used: a cosine-sine decomposition
+// on the highest qubit splits u into two multiplexed (n-1)-qubit unitaries
+// around a multiplexed RY, and each multiplexed unitary is demultiplexed
+// into two plain ones around a multiplexed RZ, recursing down to ZYZ Euler
+// angles on a single qubit.
+func Decompose(u [][]complex128, basis Basis) (*gate.Composite, error) {
+	n := 0
+	for 1<<n < len(u) {
+		n++
+	}
+	if len(u) < 2 || 1<<n != len(u) {
+		return nil, fmt.Errorf("synth: matrix size %d is not a power of two ≥ 2", len(u))
+	}
+	if n > MaxQubits {
+		return nil, fmt.Errorf("synth: %d qubits exceed the maximum of %d", n, MaxQubits)
+	}
+	m := make(matrix, len(u))
+	for i, row := range u {
+		if len(row) != len(u) {
+			return nil, fmt.Errorf("synth: row %d has %d entries, want %d", i, len(row), len(u))
+		}
+		m[i] = append([]complex128(nil), row...)
+	}
+	if d := m.adj().mul(m).dist(eye(len(m))); d > tol {
+		return nil, fmt.Errorf("synth: matrix is not unitary (deviation %.3g)", d)
+	}
+	if basis < RotationBasis || basis > PhaseBasis {
+		return nil, fmt.Errorf("synth: unknown basis %v", basis)
+	}
+
+	var e emitter
+	e.unitary(m, span(n))
+	return gate.NewComposite("UNITARY", n, e.finish(basis))
+}
+
+// emitter collects RY, RZ and CNOT steps and the global phase they leave
+// out; finish rewrites them into the requested basis.
+type emitter struct {
+	steps []gate.Step
+	phase float64
+}
+
+func (e *emitter) add(g gate.Gate, qs ...int) {
+	e.steps = append(e.steps, gate.Step{G: g, Qubits: qs})
+}
+
+// rot emits a rotation unless it is the identity.
+func (e *emitter) rot(g func(float64) gate.SingleQubitGate, theta float64, q int) {
+	theta = math.Remainder(theta, 4*math.Pi)
+	if math.Abs(theta) > 1e-12 {
+		e.add(g(theta), q)
+	}
+}
+
+// unitary emits m acting on qubits, where qubits[i] is bit i of m's indices.
+func (e *emitter) unitary(m matrix, qubits []int) {
+	if len(qubits) == 1 {
+		e.zyz(m, qubits[0])
+		return
+	}
+	h := len(m) / 2
+	top, low := qubits[len(qubits)-1], qubits[:len(qubits)-1]
+
+	l0, l1, r0h, r1h, theta := csd(m)
+	e.multiplexed(r0h, r1h, top, low)
+	angles := make([]float64, h)
+	for i, t := range theta {
+		angles[i] = 2 * t
+	}
+	e.ucr(gate.RY, angles, top, low)
+	e.multiplexed(l0, l1, top, low)
+}
+
+// multiplexed emits a⊕b: a on low when top is 0, b when it is 1. With
+// a·b† = V·D²·V†, a⊕b = (I⊗V)·(D⊕D†)·(I⊗W) with W = D·V†·b, and D⊕D† is
+// an RZ on top multiplexed by low.
+func (e *emitter) multiplexed(a, b matrix, top int, low []int) {
+	v := eigu(a.mul(b.adj()))
+	d2 := v.adj().mul(a).mul(b.adj()).mul(v)
+	d := eye(len(a))
+	angles := make([]float64, len(a))
+	for i := range d {
+		d[i][i] = cmplx.Sqrt(d2[i][i])
+		d[i][i] /= complex(cmplx.Abs(d[i][i]), 0)
+		angles[i] = -2 * cmplx.Phase(d[i][i])
+	}
+	w := d.mul(v.adj()).mul(b)
+	e.unitary(w, low)
+	e.ucr(gate.RZ, angles, top, low)
+	e.unitary(v, low)
+}
+
+// ucr emits a rotation of target by angles[i] when the controls read i,
+// halving on the highest control: R(a) ⊕ R(b) = R((a+b)/2) followed by a
+// CNOT sandwich around R((a-b)/2), since X·R(φ)·X = R(-φ) for RY and RZ.
+func (e *emitter) ucr(g func(float64) gate.SingleQubitGate, angles []float64, target int, controls []int) {
+	if len(controls) == 0 {
+		e.rot(g, angles[0], target)
+		return
+	}
+	h := len(angles) / 2
+	sum, diff := make([]float64, h), make([]float64, h)
+	zero := true
+	for i := range h {
+		sum[i] = (angles[i] + angles[h+i]) / 2
+		diff[i] = (angles[i] - angles[h+i]) / 2
+		zero = zero && math.Abs(diff[i]) < 1e-12
+	}
+	rest, c := controls[:len(controls)-1], controls[len(controls)-1]
+	e.ucr(g, sum, target, rest)
+	if zero {
+		return
+	}
+	e.add(gate.CNOT(), c, target)
+	e.ucr(g, diff, target, rest)
+	e.add(gate.CNOT(), c, target)
+}
+
+// zyz emits the 2×2 unitary m = e^{iα}·RZ(β)·RY(γ)·RZ(δ) on q.
+func (e *emitter) zyz(m matrix, q int) {
+	det := m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	alpha := cmplx.Phase(det) / 2
+	ph := cmplx.Exp(complex(0, -alpha))
+	a, b := m[0][0]*ph, m[1][0]*ph
+	gamma := 2 * math.Atan2(cmplx.Abs(b), cmplx.Abs(a))
+	var sum, diff float64 // β+δ and β-δ
+	if cmplx.Abs(a) > 1e-12 {
+		sum = -2 * cmplx.Phase(a)
+	}
+	if cmplx.Abs(b) > 1e-12 {
+		diff = 2 * cmplx.Phase(b)
+	}
+	e.rot(gate.RZ, (sum-diff)/2, q)
+	e.rot(gate.RY, gamma, q)
+	e.rot(gate.RZ, (sum+diff)/2, q)
+	e.phase += alpha
+}
+
+// finish rewrites the collected steps into basis and appends the global
+// phase correction on qubit 0.
+func (e *emitter) finish(basis Basis) []gate.Step {
+	in, phase := e.steps, e.phase
+	e.steps = nil
+	for _, s := range in {
+		q := s.Qubits[len(s.Qubits)-1]
+		switch {
+		case basis == CZBasis && s.G.Name() == "CNOT":
+			e.add(gate.RY(-math.Pi/2), q)
+			e.add(gate.CZ(), s.Qubits...)
+			e.add(gate.RY(math.Pi/2), q)
+		case basis == PhaseBasis && s.G.Name() == "RZ":
+			// RZ(θ) = e^{-iθ/2}·P(θ)
+			theta := s.G.(gate.Parametric).Params()[0]
+			e.add(gate.P(theta), q)
+			phase -= theta / 2
+		case basis == PhaseBasis && s.G.Name() == "RY":
+			// RY(θ) = S·H·RZ(θ)·H·S†
+			theta := s.G.(gate.Parametric).Params()[0]
+			e.add(gate.P(-math.Pi/2), q)
+			e.add(gate.H(), q)
+			e.add(gate.P(theta), q)
+			e.add(gate.H(), q)
+			e.add(gate.P(math.Pi/2), q)
+			phase -= theta / 2
+		default:
+			e.steps = append(e.steps, s)
+		}
+	}
+	phase = math.Remainder(phase, 2*math.Pi)
+	if math.Abs(phase) < 1e-12 {
+		return e.steps
+	}
+	if basis == PhaseBasis {
+		// e^{iφ} = P(φ)·X·P(φ)·X with X = H·P(π)·H
+		for range 2 {
+			e.add(gate.P(phase), 0)
+			e.add(gate.H(), 0)
+			e.add(gate.P(math.Pi), 0)
+			e.add(gate.H(), 0)
+		}
+	} else {
+		// e^{iφ} = P(2φ)·RZ(-2φ)
+		e.add(gate.RZ(-2*phase), 0)
+		e.add(gate.P(2*phase), 0)
+	}
+	return e.steps
+}
+
+// csd computes the cosine-sine decomposition
+//
+//	m = (l0 ⊕ l1) · [C -S; S C] · (r0h ⊕ r1h)
+//
+// with C = diag(cos θ), S = diag(sin θ) and θ ∈ [0, π/2]. r0h† diagonalises
+// m00†·m00; the columns of l0 and l1 are then read off m00·r0h† and
+// m10·r0h†, completed to unitaries where they vanish, and
+// r1h = C·l1†·m11 - S·l0†·m01 follows without dividing by either.
+func csd(m matrix) (l0, l1, r0h, r1h matrix, theta []float64) {
+	h := len(m) / 2
+	m00, m01 := m.block(0, 0, h, h), m.block(0, h, h, h)
+	m10, m11 := m.block(h, 0, h, h), m.block(h, h, h, h)
+
+	r0 := eigh(m00.adj().mul(m00))
+	w, t := m00.mul(r0), m10.mul(r0)
+	l0, l1 = zeros(h, h), zeros(h, h)
+	theta = make([]float64, h)
+	keep0, keep1 := make([]bool, h), make([]bool, h)
+	var first0, first1, last0, last1 []int
+	for i := range h {
+		c, s := norm(w.col(i)), norm(t.col(i))
+		theta[i] = math.Atan2(s, c)
+		if keep0[i] = c > 1e-14; keep0[i] {
+			l0.setCol(i, scale(w.col(i), complex(1/c, 0)))
+		}
+		if keep1[i] = s > 1e-14; keep1[i] {
+			l1.setCol(i, scale(t.col(i), complex(1/s, 0)))
+		}
+		// Orthonormalise the well-conditioned columns first.
+		if c >= s {
+			first0, last1 = append(first0, i), append(last1, i)
+		} else {
+			first1, last0 = append(first1, i), append(last0, i)
+		}
+	}
+	orthonormalize(l0, append(first0, last0...), keep0)
+	orthonormalize(l1, append(first1, last1...), keep1)
+
+	y, x := l1.adj().mul(m11), l0.adj().mul(m01)
+	r1h = zeros(h, h)
+	for i := range h {
+		c, s := complex(math.Cos(theta[i]), 0), complex(math.Sin(theta[i]), 0)
+		for j := range h {
+			r1h[i][j] = c*y[i][j] - s*x[i][j]
+		}
+	}
+	return l0, l1, r0.adj(), r1h, theta
+}
+
+// eigu returns a unitary whose columns are eigenvectors of the unitary u.
+// The Hermitian and anti-Hermitian parts of u commute, so a generic real
+// combination of them shares u's eigenvectors; the weight is changed if it
+// happens to merge two of u's eigenvalues.
+func eigu(u matrix) matrix {
+	n := len(u)
+	ua := u.adj()
+	var v matrix
+	for _, k := range []float64{0.5772156649, 1.6180339887, 0.2718281828, 3.1415926536} {
+		h := zeros(n, n)
+		for i := range n {
+			for j := range n {
+				herm := (u[i][j] + ua[i][j]) / 2
+				anti := (u[i][j] - ua[i][j]) / 2i
+				h[i][j] = herm + complex(k, 0)*anti
+			}
+		}
+		v = eigh(h)
+		d := v.adj().mul(u).mul(v)
+		for i := range d {
+			d[i][i] = 0
+		}
+		if d.dist(zeros(n, n)) < tol {
+			break
+		}
+	}
+	return v
+}
+
+func span(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
@@ -0,0 +1,370 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/stabilizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unitaryOf multiplies out the primitive steps of g into a matrix with
+// qubit q as bit q of the indices.
+func unitaryOf(t *testing.T, g *gate.Composite) matrix {
+	n := g.QubitSpan()
+	u := eye(1 << n)
+	for _, s := range g.Steps() {
+		var theta float64
+		if p, ok := s.G.(gate.Parametric); ok {
+			theta = p.Params()[0]
+		}
+		c, sn := complex(math.Cos(theta/2), 0), complex(math.Sin(theta/2), 0)
+		var m [2][2]complex128
+		switch s.G.Name() {
+		case "H":
+			m = [2][2]complex128{{1 / math.Sqrt2, 1 / math.Sqrt2}, {1 / math.Sqrt2, -1 / math.Sqrt2}}
+		case "X", "CNOT":
+			m = [2][2]complex128{{0, 1}, {1, 0}}
+		case "Z", "CZ":
+			m = [2][2]complex128{{1, 0}, {0, -1}}
+		case "S":
+			m = [2][2]complex128{{1, 0}, {0, 1i}}
+		case "P":
+			m = [2][2]complex128{{1, 0}, {0, cmplx.Exp(complex(0, theta))}}
+		case "RY":
+			m = [2][2]complex128{{c, -sn}, {sn, c}}
+		case "RZ":
+			m = [2][2]complex128{{cmplx.Exp(complex(0, -theta/2)), 0}, {0, cmplx.Exp(complex(0, theta/2))}}
+		default:
+			t.Fatalf("unexpected gate %s", s.G.Name())
+		}
+		tq := s.Qubits[len(s.Qubits)-1]
+		step := zeros(1<<n, 1<<n)
+		for i := range step {
+			if len(s.Qubits) == 2 && i&(1<<s.Qubits[0]) == 0 {
+				step[i][i] = 1
+				continue
+			}
+			bit := i >> tq & 1
+			for out := range 2 {
+				step[i&^(1<<tq)|out<<tq][i] = m[out][bit]
+			}
+		}
+		u = step.mul(u)
+	}
+	return u
+}
+
+func TestDecompose(t *testing.T) {
+	r := NewRandom(7)
+	perm := func(n int, f func(int) int) matrix {
+		m := zeros(1<<n, 1<<n)
+		for i := range m {
+			m[f(i)][i] = 1
+		}
+		return m
+	}
+	cases := map[string]matrix{
+		"identity": eye(4),
+		"phase":    {{1i, 0}, {0, 1i}},
+		"cnot":     perm(2, func(i int) int { return i ^ (i & 1 << 1) }),
+		"toffoli":  perm(3, func(i int) int { return i ^ (i & 1 & (i >> 1) << 2) }),
+		"shift":    perm(3, func(i int) int { return (i + 1) % 8 }),
+		"diagonal": {{1, 0, 0, 0}, {0, 1i, 0, 0}, {0, 0, -1, 0}, {0, 0, 0, cmplx.Exp(0.3i)}},
+	}
+	for n := 1; n <= 4; n++ {
+		u, err := r.Unitary(n)
+		require.NoError(t, err)
+		cases[fmt.Sprintf("haar%d", n)] = u
+	}
+	allowed := map[Basis]map[string]bool{
+		RotationBasis: {"RY": true, "RZ": true, "CNOT": true, "P": true},
+		CZBasis:       {"RY": true, "RZ": true, "CZ": true, "P": true},
+		PhaseBasis:    {"H": true, "P": true, "CNOT": true},
+	}
+	for name, u := range cases {
+		for basis, gates := range allowed {
+			t.Run(fmt.Sprintf("%s/%v", name, basis), func(t *testing.T) {
+				g, err := Decompose(u, basis)
+				require.NoError(t, err)
+				for _, s := range g.Steps() {
+					assert.True(t, gates[s.G.Name()], "%s is not in the %v basis", s.G.Name(), basis)
+				}
+				assert.Less(t, unitaryOf(t, g).dist(u), 1e-8)
+			})
+		}
+	}
+}
+
+func TestDecompose_Errors(t *testing.T) {
+	_, err := Decompose([][]complex128{{1}}, RotationBasis)
+	assert.Error(t, err)
+	_, err = Decompose([][]complex128{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, RotationBasis)
+	assert.Error(t, err)
+	_, err = Decompose([][]complex128{{1, 1}, {0, 1}}, RotationBasis)
+	assert.ErrorContains(t, err, "not unitary")
+	_, err = Decompose([][]complex128{{1, 0}, {0, 1}}, Basis(7))
+	assert.ErrorContains(t, err, "Basis(7)")
+}
+
+func TestPrepareState(t *testing.T) {
+	r := NewRandom(11)
+	s := complex(1/math.Sqrt(3), 0)
+	h := complex(1/math.Sqrt2, 0)
+	cases := map[string][]complex128{
+		"plus":  {h, h},
+		"minus": {h, -h},
+		"basis": {0, 0, 0, 0, 0, 1i, 0, 0},
+		"ghz":   {h, 0, 0, 0, 0, 0, 0, h},
+		"w":     {0, s, s, 0, s, 0, 0, 0},
+	}
+	for n := 1; n <= 5; n++ {
+		amps, err := r.State(n)
+		require.NoError(t, err)
+		cases[fmt.Sprintf("random%d", n)] = amps
+	}
+	for name, amps := range cases {
+		t.Run(name, func(t *testing.T) {
+			g, err := PrepareState(amps)
+			require.NoError(t, err)
+			got := unitaryOf(t, g).col(0)
+			for i := range amps {
+				assert.InDelta(t, 0, cmplx.Abs(got[i]-amps[i]), 1e-9, "amplitude %d: got %v, want %v", i, got[i], amps[i])
+			}
+		})
+	}
+
+	// |+⟩|+⟩|+⟩ is a product state: three RYs and no CNOTs.
+	plus3 := make([]complex128, 8)
+	for i := range plus3 {
+		plus3[i] = complex(1/math.Sqrt(8), 0)
+	}
+	g, err := PrepareState(plus3)
+	require.NoError(t, err)
+	assert.Len(t, g.Steps(), 3)
+
+	_, err = PrepareState([]complex128{1, 1})
+	assert.ErrorContains(t, err, "normalised")
+	_, err = PrepareState([]complex128{1, 0, 0})
+	assert.Error(t, err)
+}
+
+// stabilises reports whether the Pauli string p (with optional sign, char q
+// acting on qubit q) leaves sv unchanged.
+func stabilises(p string, sv []complex128) bool {
+	sign := complex(1, 0)
+	switch p[0] {
+	case '-':
+		sign, p = -1, p[1:]
+	case '+':
+		p = p[1:]
+	}
+	out := make([]complex128, len(sv))
+	for i, a := range sv {
+		j, f := i, sign
+		for q, c := range p {
+			bit := i>>q&1 == 1
+			switch c {
+			case 'X':
+				j ^= 1 << q
+			case 'Y':
+				j ^= 1 << q
+				f *= 1i
+				if bit {
+					f = -f
+				}
+			case 'Z':
+				if bit {
+					f = -f
+				}
+			}
+		}
+		out[j] += f * a
+	}
+	for i := range sv {
+		if cmplx.Abs(out[i]-sv[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGraphState(t *testing.T) {
+	// Triangle plus a pendant vertex: K_a = X_a ∏ Z_neighbours.
+	adj := [][]int{{1, 2}, {0, 2}, {0, 1, 3}, {}}
+	g, err := GraphState(adj)
+	require.NoError(t, err)
+	sv := unitaryOf(t, g).col(0)
+	for _, k := range []string{"XZZI", "ZXZI", "ZZXZ", "IIZX"} {
+		assert.True(t, stabilises(k, sv), k)
+	}
+	cz := 0
+	for _, s := range g.Steps() {
+		if s.G.Name() == "CZ" {
+			cz++
+		}
+	}
+	assert.Equal(t, 4, cz, "edges listed from both ends are added once")
+
+	_, err = GraphState([][]int{{1}})
+	assert.Error(t, err)
+}
+
+func TestStabilizerState(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	cases := [][]string{
+		{"+XX", "+ZZ"},
+		{"-XX", "-ZZ"},
+		{"Y"},
+		{"-Y"},
+		{"XXX", "ZZI", "-IZZ"},
+		{"ZIII", "-IZII", "IIXI", "IIIY"},
+	}
+	// Random stabilizer states from random Clifford circuits on |0…0⟩.
+	for n := 2; n <= 5; n++ {
+		tb := &tableau{Tableau: stabilizer.New(n, n)}
+		for i := range n {
+			tb.Z[i][i] = true
+		}
+		for range 10 * n {
+			a, b := rng.Intn(n), rng.Intn(n)
+			switch rng.Intn(4) {
+			case 0:
+				tb.h(a)
+			case 1:
+				tb.s(a)
+			case 2:
+				tb.xgate(a)
+			default:
+				if a != b {
+					tb.cnot(a, b)
+				}
+			}
+		}
+		gens := make([]string, n)
+		for i := range n {
+			var sb strings.Builder
+			if tb.R[i] {
+				sb.WriteByte('-')
+			}
+			for q := range n {
+				sb.WriteByte("IZXY"[btoi(tb.X[i][q])*2+btoi(tb.Z[i][q])])
+			}
+			gens[i] = sb.String()
+		}
+		cases = append(cases, gens)
+	}
+	for _, gens := range cases {
+		t.Run(strings.Join(gens, ","), func(t *testing.T) {
+			g, err := StabilizerState(gens)
+			require.NoError(t, err)
+			sv := unitaryOf(t, g).col(0)
+			for _, p := range gens {
+				assert.True(t, stabilises(p, sv), p)
+			}
+		})
+	}
+
+	_, err := StabilizerState([]string{"XI", "ZI"})
+	assert.ErrorContains(t, err, "anticommute")
+	_, err = StabilizerState([]string{"ZZ", "-ZZ"})
+	assert.ErrorContains(t, err, "independent")
+	_, err = StabilizerState([]string{"XQ", "ZZ"})
+	assert.Error(t, err)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestRandom(t *testing.T) {
+	a, b := NewRandom(5), NewRandom(5)
+	assert.Equal(t, a.Angles(4), b.Angles(4), "same seed, same draws")
+	u, err := a.Unitary(2)
+	require.NoError(t, err)
+	v, err := b.Unitary(2)
+	require.NoError(t, err)
+	assert.Equal(t, u, v)
+	assert.InDelta(t, 0, matrix(u).adj().mul(u).dist(eye(4)), 1e-12, "unitary")
+
+	for _, x := range a.Angles(100) {
+		assert.True(t, x >= 0 && x < 2*math.Pi, "angle %v", x)
+	}
+
+	g, err := a.Gate(2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, g.QubitSpan())
+	sv, err := a.State(3)
+	require.NoError(t, err)
+	assert.InDelta(t, 1, norm(sv), 1e-12)
+
+	_, err = a.Unitary(MaxQubits + 1)
+	assert.ErrorContains(t, err, "synth: random unitary on 7 qubits")
+	_, err = a.State(0)
+	assert.Error(t, err)
+	_, err = a.State(64)
+	assert.ErrorContains(t, err, "synth: random state on 64 qubits, want 1 to 6")
+}
+
+func TestDefine(t *testing.T) {
+	u, err := NewRandom(5).Unitary(2)
+	require.NoError(t, err)
+	g, err := Define("Haar2", "U", u)
+	require.NoError(t, err)
+	defer gate.Unregister("Haar2")
+
+	assert.Equal(t, "U", g.DrawSymbol())
+	assert.Equal(t, 2, g.QubitSpan())
+	assert.Less(t, unitaryOf(t, g).dist(u), tol, "the steps implement u")
+	f, err := gate.Factory("haar2")
+	require.NoError(t, err)
+	assert.Same(t, g, f)
+
+	_, err = Define("NotUnitary", "", [][]complex128{{1, 1}, {0, 1}})
+	assert.ErrorContains(t, err, "not unitary")
+}
+
+func TestEigenstates(t *testing.T) {
+	// ρ = 3/4 |+⟩⟨+| + 1/4 |1⟩⟨1|, not diagonal in either basis.
+	rho := [][]complex128{{0.375, 0.375}, {0.375, 0.625}}
+	weights, states, err := Eigenstates(rho)
+	require.NoError(t, err)
+	require.Len(t, weights, 2)
+	got := make([][]complex128, 2)
+	for i := range got {
+		got[i] = make([]complex128, 2)
+	}
+	for k, w := range weights {
+		for i := range 2 {
+			for j := range 2 {
+				got[i][j] += complex(w, 0) * states[k][i] * cmplx.Conj(states[k][j])
+			}
+		}
+	}
+	for i := range 2 {
+		for j := range 2 {
+			assert.InDelta(t, 0, cmplx.Abs(got[i][j]-rho[i][j]), 1e-9, "[%d][%d]", i, j)
+		}
+	}
+
+	// A pure state has a single member.
+	weights, _, err = Eigenstates([][]complex128{{0.5, -0.5i}, {0.5i, 0.5}})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1}, weights)
+
+	_, _, err = Eigenstates([][]complex128{{1, 0}, {0, 1}})
+	assert.Error(t, err, "trace 2")
+	_, _, err = Eigenstates([][]complex128{{0.5, 1}, {0, 0.5}})
+	assert.Error(t, err, "not Hermitian")
+	_, _, err = Eigenstates([][]complex128{{1.5, 0}, {0, -0.5}})
+	assert.Error(t, err, "negative eigenvalue")
+}
@@ -0,0 +1,342 @@
+package transpile
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// Target is the native gate set of a family of devices. Gates are named
+// as in the gate package; a name covers every angle of a gate.
+type Target struct {
+	Name  string
+	Gates []string
+
+	// oneQubit emits a single-qubit unitary, known up to global phase by
+	// its ZYZ angles, in native gates.
+	oneQubit func(theta, phi, lambda float64, q int, emit emitFunc)
+	// cnot emits CNOT(c, t); its single-qubit gates are lowered further.
+	cnot func(c, t int, emit emitFunc)
+}
+
+type emitFunc func(g gate.Gate, qs ...int)
+
+var targets = []Target{
+	{Name: "ibm", Gates: []string{"RZ", "SX", "X", "ECR"}, oneQubit: ibmOneQubit, cnot: ibmCNOT},
+	{Name: "ionq", Gates: []string{"GPI", "GPI2", "MS"}, oneQubit: ionqOneQubit, cnot: ionqCNOT},
+	{Name: "rigetti", Gates: []string{"RX", "RZ", "CZ", "ISWAP"}, oneQubit: rigettiOneQubit, cnot: rigettiCNOT},
+}
+
+// Targets returns the preset targets Basis accepts.
+func Targets() []Target {
+	out := make([]Target, len(targets))
+	for i, t := range targets {
+		t.Gates = append([]string(nil), t.Gates...)
+		out[i] = t
+	}
+	return out
+}
+
+// Basis returns a pass rewriting circuits into the native gates of the
+// named preset target:
+//
+//	ibm      RZ, SX, X, ECR
+//	ionq     GPI, GPI2, MS
+//	rigetti  RX, RZ, CZ, ISWAP
+//
+// Native gates, measurements and classical control stay; composites are
+// expanded and every other gate is decomposed, single-qubit gates through
+// their Euler angles. The result is equivalent up to global phase.
+func Basis(name string) (Pass, error) {
+	for _, t := range targets {
+		if t.Name == strings.ToLower(name) {
+			return basis{t}, nil
+		}
+	}
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.Name
+	}
+	return nil, fmt.Errorf("transpile: unknown target %q (have %s)", name, strings.Join(names, ", "))
+}
+
+type basis struct{ t Target }
+
+func (b basis) Name() string { return "basis-" + b.t.Name }
+
+func (b basis) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	ops, err := b.lowerOps(c.Operations())
+	if err != nil {
+		return nil, err
+	}
+	return rebuild(c, ops)
+}
+
+// lowerOps lowers every operation, including loop bodies. The pieces of a
+// conditional gate keep its condition.
+func (b basis) lowerOps(in []circuit.Operation) ([]circuit.Operation, error) {
+	var out []circuit.Operation
+	for _, op := range in {
+		switch {
+		case op.Loop != nil:
+			body, err := b.lowerOps(op.Loop.Body)
+			if err != nil {
+				return nil, err
+			}
+			l := *op.Loop
+			l.Body = body
+			op.Loop = &l
+			out = append(out, op)
+		case op.G.Name() == "MEASURE":
+			out = append(out, op)
+		default:
+			emit := func(g gate.Gate, qs ...int) {
+				out = append(out, circuit.Operation{G: g, Qubits: qs, Cbit: -1, Cond: op.Cond, Meta: op.Meta})
+			}
+			if err := b.lower(op.G, op.Qubits, emit); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func (b basis) native(g gate.Gate) bool {
+	for _, n := range b.t.Gates {
+		if n == g.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// lower emits g on qs in native gates.
+func (b basis) lower(g gate.Gate, qs []int, emit emitFunc) error {
+	if b.native(g) {
+		emit(g, qs...)
+		return nil
+	}
+	if comp, ok := g.(*gate.Composite); ok {
+		for _, s := range comp.Steps() {
+			abs := make([]int, len(s.Qubits))
+			for i, q := range s.Qubits {
+				abs[i] = qs[q]
+			}
+			if err := b.lower(s.G, abs, emit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	// rec lowers the gates of a decomposition in turn.
+	rec := func(g gate.Gate, qs ...int) {
+		if err == nil {
+			err = b.lower(g, qs, emit)
+		}
+	}
+	switch g.Name() {
+	case "CNOT":
+		b.t.cnot(qs[0], qs[1], rec)
+	case "CZ":
+		rec(gate.H(), qs[1])
+		rec(gate.CNOT(), qs...)
+		rec(gate.H(), qs[1])
+	case "SWAP":
+		rec(gate.CNOT(), qs[0], qs[1])
+		rec(gate.CNOT(), qs[1], qs[0])
+		rec(gate.CNOT(), qs[0], qs[1])
+	case "CP":
+		theta := g.(gate.Parametric).Params()[0]
+		rec(gate.P(theta/2), qs[0])
+		rec(gate.CNOT(), qs...)
+		rec(gate.P(-theta/2), qs[1])
+		rec(gate.CNOT(), qs...)
+		rec(gate.P(theta/2), qs[1])
+	case "TOFFOLI":
+		a, c, t := qs[0], qs[1], qs[2]
+		tg, tdg := gate.P(math.Pi/4), gate.P(-math.Pi/4)
+		rec(gate.H(), t)
+		rec(gate.CNOT(), c, t)
+		rec(tdg, t)
+		rec(gate.CNOT(), a, t)
+		rec(tg, t)
+		rec(gate.CNOT(), c, t)
+		rec(tdg, t)
+		rec(gate.CNOT(), a, t)
+		rec(tg, c)
+		rec(tg, t)
+		rec(gate.H(), t)
+		rec(gate.CNOT(), a, c)
+		rec(tg, a)
+		rec(tdg, c)
+		rec(gate.CNOT(), a, c)
+	case "FREDKIN":
+		rec(gate.CNOT(), qs[2], qs[1])
+		rec(gate.Toffoli(), qs...)
+		rec(gate.CNOT(), qs[2], qs[1])
+	default:
+		if g.QubitSpan() != 1 {
+			return fmt.Errorf("gate %s has no decomposition into %s gates", g.Name(), b.t.Name)
+		}
+		m, err := unitary(g)
+		if err != nil {
+			return err
+		}
+		theta, phi, lambda := zyz(m)
+		b.t.oneQubit(theta, phi, lambda, qs[0], emit)
+		return nil
+	}
+	return err
+}
+
+// unitary returns the matrix of a single-qubit primitive, indexed
+// [row][col].
+func unitary(g gate.Gate) ([2][2]complex128, error) {
+	angle := func() float64 { return g.(gate.Parametric).Params()[0] }
+	s := complex(1/math.Sqrt2, 0)
+	switch g.Name() {
+	case "H":
+		return [2][2]complex128{{s, s}, {s, -s}}, nil
+	case "X":
+		return [2][2]complex128{{0, 1}, {1, 0}}, nil
+	case "Y":
+		return [2][2]complex128{{0, -1i}, {1i, 0}}, nil
+	case "Z":
+		return [2][2]complex128{{1, 0}, {0, -1}}, nil
+	case "S":
+		return [2][2]complex128{{1, 0}, {0, 1i}}, nil
+	case "P":
+		return [2][2]complex128{{1, 0}, {0, cmplx.Rect(1, angle())}}, nil
+	case "RX":
+		c, sn := math.Cos(angle()/2), math.Sin(angle()/2)
+		return [2][2]complex128{{complex(c, 0), complex(0, -sn)}, {complex(0, -sn), complex(c, 0)}}, nil
+	case "RY":
+		c, sn := math.Cos(angle()/2), math.Sin(angle()/2)
+		return [2][2]complex128{{complex(c, 0), complex(-sn, 0)}, {complex(sn, 0), complex(c, 0)}}, nil
+	case "RZ":
+		return [2][2]complex128{{cmplx.Rect(1, -angle()/2), 0}, {0, cmplx.Rect(1, angle()/2)}}, nil
+	}
+	return [2][2]complex128{}, fmt.Errorf("gate %s has no known matrix", g.Name())
+}
+
+// zyz returns the angles of m = e^{iα}·RZ(φ)·RY(θ)·RZ(λ).
+func zyz(m [2][2]complex128) (theta, phi, lambda float64) {
+	det := m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	ph := cmplx.Exp(complex(0, -cmplx.Phase(det)/2))
+	a, b := m[0][0]*ph, m[1][0]*ph
+	theta = 2 * math.Atan2(cmplx.Abs(b), cmplx.Abs(a))
+	var sum, diff float64 // φ+λ and φ-λ
+	if cmplx.Abs(a) > 1e-12 {
+		sum = -2 * cmplx.Phase(a)
+	}
+	if cmplx.Abs(b) > 1e-12 {
+		diff = 2 * cmplx.Phase(b)
+	}
+	return theta, (sum + diff) / 2, (sum - diff) / 2
+}
+
+// angleTol is how close an angle must be to count as a special one.
+const angleTol = 1e-9
+
+// near reports whether a and b are equal modulo 2π.
+func near(a, b float64) bool {
+	return math.Abs(math.Remainder(a-b, 2*math.Pi)) < angleTol
+}
+
+// rz emits RZ(θ) unless it is the identity up to global phase.
+func rz(theta float64, q int, emit emitFunc) {
+	if !near(theta, 0) {
+		emit(gate.RZ(math.Remainder(theta, 2*math.Pi)), q)
+	}
+}
+
+// ibmOneQubit uses RY(θ) = RZ(π/2)·RX(θ)·RZ(-π/2) with SX = RX(π/2) and,
+// for other θ, RZ(φ)·RY(θ)·RZ(λ) ∝ RZ(φ+π)·SX·RZ(θ+π)·SX·RZ(λ).
+func ibmOneQubit(theta, phi, lambda float64, q int, emit emitFunc) {
+	switch {
+	case near(theta, 0):
+		rz(phi+lambda, q, emit)
+	case near(theta, math.Pi):
+		emit(gate.X(), q)
+		rz(phi-lambda-math.Pi, q, emit)
+	case near(theta, math.Pi/2):
+		rz(lambda-math.Pi/2, q, emit)
+		emit(gate.SX(), q)
+		rz(phi+math.Pi/2, q, emit)
+	default:
+		rz(lambda, q, emit)
+		emit(gate.SX(), q)
+		rz(theta+math.Pi, q, emit)
+		emit(gate.SX(), q)
+		rz(phi+math.Pi, q, emit)
+	}
+}
+
+// ibmCNOT uses CNOT ∝ RZ(π/2)⊗RX(π/2)·exp(iπ/4 Z⊗X) and
+// ECR = exp(iπ/4 Z⊗X)·(X⊗I).
+func ibmCNOT(c, t int, emit emitFunc) {
+	emit(gate.X(), c)
+	emit(gate.ECR(), c, t)
+	emit(gate.RZ(math.Pi/2), c)
+	emit(gate.SX(), t)
+}
+
+// rigettiOneQubit uses RY(θ) = RZ(π/2)·RX(θ)·RZ(-π/2).
+func rigettiOneQubit(theta, phi, lambda float64, q int, emit emitFunc) {
+	if near(theta, 0) {
+		rz(phi+lambda, q, emit)
+		return
+	}
+	rz(lambda-math.Pi/2, q, emit)
+	emit(gate.RX(theta), q)
+	rz(phi+math.Pi/2, q, emit)
+}
+
+func rigettiCNOT(c, t int, emit emitFunc) {
+	emit(gate.H(), t)
+	emit(gate.CZ(), c, t)
+	emit(gate.H(), t)
+}
+
+// ionqOneQubit tracks Z rotations in software: a rotation about the axis
+// at angle α after RZ(z) is the rotation about α−z before it. Rotations by
+// π and π/2 are GPI and GPI2; RZ(2β) ∝ GPI(β)·GPI(0) settles what is left,
+// or is absorbed into a final GPI.
+func ionqOneQubit(theta, phi, lambda float64, q int, emit emitFunc) {
+	z := lambda
+	switch {
+	case near(theta, 0):
+	case near(theta, math.Pi):
+		// RZ(z)·GPI(α) = GPI(α+z/2)
+		emit(gate.GPI(math.Pi/2-lambda+(phi+lambda)/2), q)
+		return
+	case near(theta, math.Pi/2):
+		emit(gate.GPI2(math.Pi/2-z), q)
+	default:
+		emit(gate.GPI2(-z), q)
+		z += theta + math.Pi
+		emit(gate.GPI2(-z), q)
+		phi += math.Pi
+	}
+	z += phi
+	if !near(z, 0) {
+		emit(gate.GPI(0), q)
+		emit(gate.GPI(math.Remainder(z, 2*math.Pi)/2), q)
+	}
+}
+
+// ionqCNOT conjugates CNOT ∝ RZ(π/2)⊗RX(π/2)·exp(iπ/4 Z⊗X) into
+// exp(iπ/4 X⊗X) = MS(π, 0) with RY(π/2) on the control.
+func ionqCNOT(c, t int, emit emitFunc) {
+	emit(gate.RY(math.Pi/2), c)
+	emit(gate.MS(math.Pi, 0), c, t)
+	emit(gate.RY(-math.Pi/2), c)
+	emit(gate.RZ(math.Pi/2), c)
+	emit(gate.RX(math.Pi/2), t)
+}
@@ -0,0 +1,42 @@
+package transpile
+
+import "github.com/kegliz/qcm/qc/circuit"
+
+// DeadCode returns a pass removing operations with no path to a
+// measurement: walking backwards from the end, an operation is kept if it
+// is a measurement or a loop, or shares a qubit with a later kept
+// operation. Gates after a qubit's final measurement and gates on qubits
+// that are never measured (leftover oracle or ancilla work) go away.
+// Unlike simulator.LightCone, the circuit keeps its width.
+func DeadCode() Pass { return deadCode{} }
+
+type deadCode struct{}
+
+func (deadCode) Name() string { return "dead-code" }
+
+func (deadCode) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	live := make([]bool, c.Qubits())
+	keep := make([]bool, c.NumOps())
+	for i := c.NumOps() - 1; i >= 0; i-- {
+		op := c.OpAt(i)
+		keep[i] = op.Loop != nil || op.G.Name() == "MEASURE"
+		for _, q := range op.Qubits {
+			keep[i] = keep[i] || live[q]
+		}
+		if keep[i] {
+			for _, q := range op.Qubits {
+				live[q] = true
+			}
+		}
+	}
+	var ops []circuit.Operation
+	for i, op := range c.OpsIter() {
+		if keep[i] {
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == c.NumOps() {
+		return c, nil
+	}
+	return rebuild(c, ops)
+}
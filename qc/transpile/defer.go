@@ -0,0 +1,170 @@
+package transpile
+
+import (
+	"fmt"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/decompose"
+	"github.com/kegliz/qcm/qc/gate"
+)
+
+// DeferMeasurements returns a pass moving every measurement into a shared
+// final column by the principle of deferred measurement, for backends
+// without mid-circuit measurement or classical control. A measurement of
+// a qubit that is used again is replaced by a CNOT copying it onto a
+// fresh ancilla, appended after the existing qubits; the ancilla is
+// measured into the cbit at the end. Gates conditioned on classical bits
+// become gates controlled by the qubits holding those bits (negated
+// controls for bits that must be 0). A negated condition first records
+// whether the bits match in a flag ancilla, shared by all such conditions,
+// controls the gate on the flag being 0, and then resets the flag. Loops
+// and conditional measurements cannot be deferred and are rejected.
+func DeferMeasurements() Pass { return deferMeasurements{} }
+
+type deferMeasurements struct{}
+
+func (deferMeasurements) Name() string { return "defer-measurements" }
+
+func (deferMeasurements) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	ops := c.Operations()
+	// lastUse[q] is the index of the last operation on qubit q.
+	lastUse := make([]int, c.Qubits())
+	for i, op := range ops {
+		if op.Loop != nil {
+			return nil, fmt.Errorf("loops cannot be deferred")
+		}
+		if op.Cond != nil && op.G.Name() == "MEASURE" {
+			return nil, fmt.Errorf("conditional measurements cannot be deferred")
+		}
+		for _, q := range op.Qubits {
+			lastUse[q] = i
+		}
+	}
+
+	type step struct {
+		g  gate.Gate
+		qs []int
+	}
+	var steps []step
+	holder := make([]int, c.Clbits()) // qubit holding each cbit, -1 if unwritten
+	for b := range holder {
+		holder[b] = -1
+	}
+	ancillas := 0
+	flag := -1
+	// matching appends g on qs controlled by the cbit holders being in
+	// the wanted state, flipping those that must be 0 around it.
+	matching := func(g gate.Gate, controls, negated, qs []int) error {
+		cg, err := controlled(g, len(controls))
+		if err != nil {
+			return err
+		}
+		for _, q := range negated {
+			steps = append(steps, step{gate.X(), []int{q}})
+		}
+		steps = append(steps, step{cg, append(append([]int(nil), controls...), qs...)})
+		for _, q := range negated {
+			steps = append(steps, step{gate.X(), []int{q}})
+		}
+		return nil
+	}
+	for i, op := range ops {
+		if op.G.Name() == "MEASURE" {
+			q := op.Qubits[0]
+			if lastUse[q] == i {
+				holder[op.Cbit] = q // nothing changes q any more
+				continue
+			}
+			a := c.Qubits() + ancillas
+			ancillas++
+			steps = append(steps, step{gate.CNOT(), []int{q, a}})
+			holder[op.Cbit] = a
+			continue
+		}
+		if op.Cond == nil {
+			steps = append(steps, step{op.G, op.Qubits})
+			continue
+		}
+		var controls, negated []int
+		fires := true
+		for k, b := range op.Cond.Cbits {
+			want := op.Cond.Value>>k&1 == 1
+			switch {
+			case holder[b] >= 0 && want:
+				controls = append(controls, holder[b])
+			case holder[b] >= 0:
+				controls = append(controls, holder[b])
+				negated = append(negated, holder[b])
+			case want:
+				fires = false // an unwritten cbit reads 0
+			}
+		}
+		// With no controls left the match is decided: certain if fires,
+		// impossible otherwise.
+		switch {
+		case len(controls) == 0 || !fires:
+			if fires != op.Cond.Negate {
+				steps = append(steps, step{op.G, op.Qubits})
+			}
+			continue
+		case !op.Cond.Negate:
+			if err := matching(op.G, controls, negated, op.Qubits); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if flag < 0 {
+			flag = c.Qubits() + ancillas
+			ancillas++
+		}
+		if err := matching(gate.X(), controls, negated, []int{flag}); err != nil {
+			return nil, err
+		}
+		if err := matching(op.G, []int{flag}, []int{flag}, op.Qubits); err != nil {
+			return nil, err
+		}
+		if err := matching(gate.X(), controls, negated, []int{flag}); err != nil {
+			return nil, err
+		}
+	}
+
+	d := dag.New(c.Qubits()+ancillas, c.Clbits())
+	if err := d.SetCRegs(c.CRegs()); err != nil {
+		return nil, err
+	}
+	for _, s := range steps {
+		if err := d.AddGate(s.g, s.qs); err != nil {
+			return nil, err
+		}
+	}
+	for b, q := range holder {
+		if q >= 0 {
+			if err := d.AddMeasure(q, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return circuit.FromDAGWithLayout(d, circuit.LayoutOptions{AlignMeasurements: true}), nil
+}
+
+// controlled returns g with n extra controls first, using the native
+// gate when there is one.
+func controlled(g gate.Gate, n int) (gate.Gate, error) {
+	switch {
+	case g.Name() == "X" && n == 1:
+		return gate.CNOT(), nil
+	case g.Name() == "X" && n == 2, g.Name() == "CNOT" && n == 1:
+		return gate.Toffoli(), nil
+	case g.Name() == "Z" && n == 1:
+		return gate.CZ(), nil
+	case g.Name() == "SWAP" && n == 1:
+		return gate.Fredkin(), nil
+	case g.Name() == "P" && n == 1:
+		return gate.CP(g.(gate.Parametric).Params()[0]), nil
+	}
+	return decompose.Controlled(g, n)
+}
@@ -0,0 +1,79 @@
+package transpile
+
+import "github.com/kegliz/qcm/qc/circuit"
+
+// Layout maps the qubits of a circuit to the wires of its rewritten form
+// at the end of the circuit: wire Layout[q] holds what qubit q would.
+type Layout []int
+
+// Statevector reorders a statevector of the rewritten circuit into the
+// original's qubit order.
+func (l Layout) Statevector(sv []complex128) []complex128 {
+	out := make([]complex128, len(sv))
+	for j, a := range sv {
+		i := 0
+		for q, w := range l {
+			i |= (j >> w & 1) << q
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// EliminateSwaps removes unconditional SWAP gates by relabeling the wires
+// of every later operation instead. Measurements follow their qubits, so
+// histograms are unchanged; the returned layout maps anything read off the
+// final wires directly, such as the statevector, back to c's qubits.
+// SWAPs that are conditional or inside loops stay.
+func EliminateSwaps(c circuit.Circuit) (circuit.Circuit, Layout, error) {
+	wire := make(Layout, c.Qubits())
+	for q := range wire {
+		wire[q] = q
+	}
+	ops := make([]circuit.Operation, 0, c.NumOps())
+	for _, op := range c.OpsIter() {
+		if op.G.Name() == "SWAP" && op.Cond == nil {
+			a, b := op.Qubits[0], op.Qubits[1]
+			wire[a], wire[b] = wire[b], wire[a]
+			continue
+		}
+		ops = append(ops, relabel(op, wire))
+	}
+	if len(ops) == c.NumOps() {
+		return c, wire, nil
+	}
+	out, err := rebuild(c, ops)
+	return out, wire, err
+}
+
+// relabel returns op, including any loop body, on the wires holding its
+// qubits.
+func relabel(op circuit.Operation, wire Layout) circuit.Operation {
+	qs := make([]int, len(op.Qubits))
+	for i, q := range op.Qubits {
+		qs[i] = wire[q]
+	}
+	op.Qubits = qs
+	if op.Loop != nil {
+		l := *op.Loop
+		l.Body = make([]circuit.Operation, len(op.Loop.Body))
+		for i, b := range op.Loop.Body {
+			l.Body[i] = relabel(b, wire)
+		}
+		op.Loop = &l
+	}
+	return op
+}
+
+// SwapElimination returns EliminateSwaps as a pass, for circuits whose
+// results are read through measurements only.
+func SwapElimination() Pass { return swapElimination{} }
+
+type swapElimination struct{}
+
+func (swapElimination) Name() string { return "swap-elimination" }
+
+func (swapElimination) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	out, _, err := EliminateSwaps(c)
+	return out, err
+}
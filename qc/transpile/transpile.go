@@ -0,0 +1,166 @@
+// Package transpile rewrites circuits into equivalent ones that are
+// smaller or suit a backend better. A PassManager runs a list of passes
+// in order. Passes keep the circuit's classical bits and registers, so
+// histograms of the rewritten circuit read like the original's, and its
+// qubits, though some append ancillas after them.
+package transpile
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+)
+
+// Pass rewrites a circuit into an equivalent one.
+type Pass interface {
+	Name() string
+	Run(c circuit.Circuit) (circuit.Circuit, error)
+}
+
+// verifyProbes is how many inputs verified runs check each pass on.
+const verifyProbes = 3
+
+// PassManager runs passes in order, each on the output of the last.
+type PassManager struct {
+	Passes []Pass
+	// Verify checks that the output of every pass is Equivalent to its
+	// input and fails the run naming the first pass that is not, so
+	// aggressive rewrites can be trusted. It simulates the circuit a few
+	// times per pass, so it suits circuits of moderate width.
+	Verify bool
+	// Tolerance is the tolerance of the Verify check, see
+	// EquivalentWithin; 0 => DefaultTolerance.
+	Tolerance float64
+}
+
+// NewPassManager returns a manager running passes in order.
+func NewPassManager(passes ...Pass) *PassManager {
+	return &PassManager{Passes: passes}
+}
+
+// Run applies every pass to c.
+func (pm *PassManager) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	out, _, err := pm.RunReport(c)
+	return out, err
+}
+
+// RunReport is Run, also reporting what every pass did. On failure the
+// report covers the passes that succeeded.
+func (pm *PassManager) RunReport(c circuit.Circuit) (circuit.Circuit, *Report, error) {
+	r := &Report{}
+	for _, p := range pm.Passes {
+		start := time.Now()
+		out, err := p.Run(c)
+		elapsed := time.Since(start)
+		if err != nil {
+			return nil, r, fmt.Errorf("transpile: %s: %w", p.Name(), err)
+		}
+		if pm.Verify {
+			tol := pm.Tolerance
+			if tol == 0 {
+				tol = DefaultTolerance
+			}
+			if err := EquivalentWithin(c, out, verifyProbes, 1, tol); err != nil {
+				return nil, r, fmt.Errorf("transpile: %s: %w", p.Name(), err)
+			}
+		}
+		r.Passes = append(r.Passes, PassReport{Pass: p.Name(),
+			QubitsBefore: c.Qubits(), QubitsAfter: out.Qubits(),
+			GatesBefore: gates(c), GatesAfter: gates(out),
+			DepthBefore: c.Depth(), DepthAfter: out.Depth(),
+			Elapsed: elapsed})
+		c = out
+	}
+	return c, r, nil
+}
+
+// PassReport is what one pass did to the circuit. Gates counts the
+// operations other than measurements, a loop counting once.
+type PassReport struct {
+	Pass         string        `json:"pass"`
+	QubitsBefore int           `json:"qubits_before"`
+	QubitsAfter  int           `json:"qubits_after"`
+	GatesBefore  int           `json:"gates_before"`
+	GatesAfter   int           `json:"gates_after"`
+	DepthBefore  int           `json:"depth_before"`
+	DepthAfter   int           `json:"depth_after"`
+	Elapsed      time.Duration `json:"elapsed_ns"`
+}
+
+// Report lists the passes of a PassManager run in order.
+type Report struct {
+	Passes []PassReport `json:"passes"`
+}
+
+func gates(c circuit.Circuit) int {
+	n := 0
+	for _, op := range c.OpsIter() {
+		if op.G.Name() != "MEASURE" {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes r as an aligned table with one row per pass.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PASS\tQUBITS\tGATES\tDEPTH\tTIME")
+	for _, p := range r.Passes {
+		fmt.Fprintf(tw, "%s\t%d -> %d\t%d -> %d\t%d -> %d\t%s\n", p.Pass, p.QubitsBefore, p.QubitsAfter,
+			p.GatesBefore, p.GatesAfter, p.DepthBefore, p.DepthAfter, p.Elapsed.Round(time.Microsecond))
+	}
+	return tw.Flush()
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	r.WriteText(&sb)
+	return sb.String()
+}
+
+// rebuild returns a circuit with c's width and registers and the given
+// operations, in order.
+func rebuild(c circuit.Circuit, ops []circuit.Operation) (circuit.Circuit, error) {
+	d := dag.New(c.Qubits(), c.Clbits())
+	if err := d.SetCRegs(c.CRegs()); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.Loop != nil {
+			body := make([]*dag.Node, len(op.Loop.Body))
+			for i, b := range op.Loop.Body {
+				body[i] = node(b)
+			}
+			if err := d.AddLoop(body, op.Loop.Until, op.Loop.Max); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := d.Append(dag.Op{G: op.G, Qubits: op.Qubits, Cbit: op.Cbit, Cond: op.Cond, Meta: op.Meta}); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return circuit.FromDAG(d), nil
+}
+
+// node converts an operation, including any nested loop, back to a node.
+func node(op circuit.Operation) *dag.Node {
+	n := &dag.Node{G: op.G, Qubits: op.Qubits, Cbit: op.Cbit, Cond: op.Cond, Meta: op.Meta}
+	if op.Loop != nil {
+		l := &dag.Loop{Until: op.Loop.Until, Max: op.Loop.Max}
+		for _, b := range op.Loop.Body {
+			l.Body = append(l.Body, node(b))
+		}
+		n.Loop = l
+	}
+	return n
+}
@@ -0,0 +1,347 @@
+package transpile_test
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kegliz/qcm/qc/builder"
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/gate"
+	"github.com/kegliz/qcm/qc/simulator"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+	"github.com/kegliz/qcm/qc/transpile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// names lists the gate names of c in order, with their qubits.
+func names(c circuit.Circuit) []string {
+	var out []string
+	for _, op := range c.OpsIter() {
+		s := op.G.Name()
+		for _, q := range op.Qubits {
+			s += fmt.Sprintf(" %d", q)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestDeadCode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(4), builder.CReg("out", 2))
+	b.H(0).X(1).CNOT(1, 2).CNOT(3, 0).Measure(0, 0).H(0).S(2)
+	b.RepeatUntil(builder.Bit(1), 3, func(b builder.Builder) { b.H(3).Measure(3, 1) })
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	out, err := transpile.NewPassManager(transpile.DeadCode()).Run(c)
+	require.NoError(err)
+	assert.Equal(4, out.Qubits(), "width is kept")
+	assert.Equal(c.CRegs(), out.CRegs())
+	assert.ElementsMatch([]string{"H 0", "CNOT 3 0", "MEASURE 0", "LOOP 3"}, names(out))
+
+	same, err := transpile.DeadCode().Run(out)
+	require.NoError(err)
+	assert.Same(out, same, "nothing left to remove")
+}
+
+func TestDeferMeasurements(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// cbit 1 copies cbit 0 through feedback; cbit 2 resets qubit 0 and
+	// measures it again; cbit 3 is set only when cbit 0 read 0.
+	b := builder.New(builder.Q(3), builder.C(4))
+	b.H(0).Measure(0, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(1) }).Measure(1, 1)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(0) }).Measure(0, 2)
+	b.If(builder.Bits(0, 0), func(b builder.Builder) { b.X(2) }).Measure(2, 3)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	out, err := transpile.DeferMeasurements().Run(c)
+	require.NoError(err)
+	assert.Equal(4, out.Qubits(), "one ancilla for the reused qubit 0")
+	assert.False(circuit.HasControlFlow(out))
+	for _, op := range out.OpsIter() {
+		assert.Equal(op.G.Name() == "MEASURE", op.TimeStep == out.MaxStep(), "measurements come last")
+	}
+
+	sim := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 200, Runner: qsim.NewQSimRunner()})
+	hist, err := sim.Run(out)
+	require.NoError(err)
+	assert.Equal(200, hist["1100"]+hist["0001"], "%v", hist)
+	assert.NotZero(hist["1100"])
+	assert.NotZero(hist["0001"])
+
+	// The else branch of IfElse is a negated condition: it must fire when
+	// the bits differ from the value, here when cbit 0 read 0.
+	c, err = builder.New(builder.Q(2), builder.C(2)).Measure(0, 0).
+		IfElse(builder.Bit(0), func(b builder.Builder) { b.Z(1) }, func(b builder.Builder) { b.X(1) }).
+		Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	out, err = transpile.DeferMeasurements().Run(c)
+	require.NoError(err)
+	hist, err = sim.Run(out)
+	require.NoError(err)
+	assert.Equal(map[string]int{"01": 200}, hist)
+
+	// Over two bits the else branch takes the three other outcomes.
+	b = builder.New(builder.Q(4), builder.C(4))
+	b.H(0).H(1).Measure(0, 0).Measure(1, 1)
+	b.IfElse(builder.Bits(1, 0, 1), func(b builder.Builder) { b.X(2) }, func(b builder.Builder) { b.X(3) })
+	b.Measure(2, 2).Measure(3, 3)
+	c, err = b.BuildCircuit()
+	require.NoError(err)
+	out, err = transpile.DeferMeasurements().Run(c)
+	require.NoError(err)
+	hist, err = sim.Run(out)
+	require.NoError(err)
+	for key := range hist {
+		assert.Contains([]string{"1010", "0001", "0101", "1101"}, key)
+	}
+	assert.Len(hist, 4)
+
+	loop, err := builder.New(builder.Q(1), builder.C(1)).
+		RepeatUntil(builder.Bit(0), 3, func(b builder.Builder) { b.H(0).Measure(0, 0) }).BuildCircuit()
+	require.NoError(err)
+	_, err = transpile.NewPassManager(transpile.DeferMeasurements()).Run(loop)
+	assert.ErrorContains(err, "transpile: defer-measurements: loops")
+}
+
+func TestEliminateSwaps(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3))
+	b.H(0).X(2).SWAP(0, 1).SWAP(1, 2).CNOT(1, 0).RY(0.3, 2)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	out, layout, err := transpile.EliminateSwaps(c)
+	require.NoError(err)
+	assert.Equal(transpile.Layout{1, 2, 0}, layout)
+	assert.Less(out.Depth(), c.Depth())
+	for _, op := range out.OpsIter() {
+		assert.NotEqual("SWAP", op.G.Name())
+	}
+
+	runner := qsim.NewQSimRunner()
+	want, err := runner.GetStatevector(c)
+	require.NoError(err)
+	got, err := runner.GetStatevector(out)
+	require.NoError(err)
+	got = layout.Statevector(got)
+	for i := range want {
+		assert.InDelta(real(want[i]), real(got[i]), 1e-9, "amplitude %d", i)
+		assert.InDelta(imag(want[i]), imag(got[i]), 1e-9, "amplitude %d", i)
+	}
+
+	// Measurements follow their qubits.
+	m, err := builder.New(builder.Q(2), builder.C(2)).X(0).SWAP(0, 1).Measure(0, 0).Measure(1, 1).BuildCircuit()
+	require.NoError(err)
+	out, err = transpile.SwapElimination().Run(m)
+	require.NoError(err)
+	hist, err := simulator.NewSimulator(simulator.SimulatorOptions{Shots: 10, Runner: runner}).Run(out)
+	require.NoError(err)
+	assert.Equal(map[string]int{"01": 10}, hist)
+}
+
+// dropLast is a broken pass removing the last operation.
+type dropLast struct{}
+
+func (dropLast) Name() string { return "drop-last" }
+
+func (dropLast) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	b := builder.New(builder.Q(c.Qubits()), builder.C(c.Clbits()))
+	for _, op := range c.Operations()[:c.NumOps()-1] {
+		if op.G.Name() == "MEASURE" {
+			b.Measure(op.Qubits[0], op.Cbit)
+		} else {
+			b.Apply(op.G, op.Qubits...)
+		}
+	}
+	return b.BuildCircuit()
+}
+
+// dropNegate is a broken pass turning else branches into then branches,
+// as deferring measurements once did.
+type dropNegate struct{}
+
+func (dropNegate) Name() string { return "drop-negate" }
+
+func (dropNegate) Run(c circuit.Circuit) (circuit.Circuit, error) {
+	b := builder.New(builder.Q(c.Qubits()), builder.C(c.Clbits()))
+	for _, op := range c.OpsIter() {
+		switch {
+		case op.G.Name() == "MEASURE":
+			b.Measure(op.Qubits[0], op.Cbit)
+		case op.Cond != nil:
+			b.If(builder.Bits(op.Cond.Value, op.Cond.Cbits...), func(b builder.Builder) { b.Apply(op.G, op.Qubits...) })
+		default:
+			b.Apply(op.G, op.Qubits...)
+		}
+	}
+	return b.BuildCircuit()
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	build := func(f func(b builder.Builder), q, c int) circuit.Circuit {
+		b := builder.New(builder.Q(q), builder.C(c))
+		f(b)
+		out, err := b.BuildCircuit()
+		require.NoError(err)
+		return out
+	}
+	z := build(func(b builder.Builder) { b.H(0).Z(0) }, 1, 0)
+	rz := build(func(b builder.Builder) { b.H(0).RZ(math.Pi, 0) }, 1, 0)
+	x := build(func(b builder.Builder) { b.H(0).X(0) }, 1, 0)
+	assert.NoError(transpile.Equivalent(z, rz, 3, 1), "equal up to global phase")
+	assert.ErrorIs(transpile.Equivalent(z, x, 3, 1), transpile.ErrNotEquivalent)
+	dirty := build(func(b builder.Builder) { b.H(0).Z(0).CNOT(0, 1) }, 2, 0)
+	assert.ErrorIs(transpile.Equivalent(z, dirty, 3, 1), transpile.ErrNotEquivalent, "ancilla left entangled")
+	near := build(func(b builder.Builder) { b.H(0).RZ(math.Pi+1e-6, 0) }, 1, 0)
+	assert.ErrorIs(transpile.Equivalent(z, near, 3, 1), transpile.ErrNotEquivalent)
+	assert.NoError(transpile.EquivalentWithin(z, near, 3, 1, 1e-5), "within a looser tolerance")
+	assert.Error(transpile.EquivalentWithin(z, rz, 3, 1, 0))
+
+	// Measured circuits compare outcome distributions, so passes that add
+	// ancillas or relabel wires verify.
+	c := build(func(b builder.Builder) {
+		b.H(0).SWAP(0, 1).Measure(1, 0)
+		b.If(builder.Bit(0), func(b builder.Builder) { b.X(2) }).Measure(2, 1).H(0)
+	}, 3, 2)
+	pm := transpile.NewPassManager(transpile.DeadCode(), transpile.SwapElimination(), transpile.DeferMeasurements())
+	pm.Verify = true
+	_, err := pm.Run(c)
+	require.NoError(err)
+
+	pm.Passes = append(pm.Passes, dropLast{})
+	_, err = pm.Run(c)
+	assert.ErrorIs(err, transpile.ErrNotEquivalent)
+	assert.ErrorContains(err, "transpile: drop-last:")
+
+	// Measuring qubit 0 twice makes deferral add an ancilla, which checking
+	// the dead-code pass must start in |0⟩ rather than in a probe state.
+	reused := build(func(b builder.Builder) {
+		b.H(0).Measure(0, 0)
+		b.If(builder.Bit(0), func(b builder.Builder) { b.X(0) }).H(0).Measure(0, 1).H(0)
+	}, 1, 2)
+	pm = transpile.NewPassManager(transpile.DeadCode(), transpile.DeferMeasurements())
+	pm.Verify = true
+	out, err := pm.Run(reused)
+	require.NoError(err)
+	assert.Equal(2, out.Qubits())
+
+	// Outcomes are followed branch by branch, not deferred, so a pass that
+	// mishandles conditions is caught whether or not deferral shares the
+	// mistake.
+	ifElse := build(func(b builder.Builder) {
+		b.H(0).Measure(0, 0)
+		b.IfElse(builder.Bit(0), func(b builder.Builder) { b.H(1) }, func(b builder.Builder) { b.X(1) }).Measure(1, 1)
+	}, 2, 2)
+	assert.NoError(transpile.Equivalent(ifElse, ifElse, 2, 1))
+	pm = transpile.NewPassManager(dropNegate{})
+	pm.Verify = true
+	_, err = pm.Run(ifElse)
+	assert.ErrorIs(err, transpile.ErrNotEquivalent)
+	assert.ErrorContains(err, "transpile: drop-negate:")
+	pm = transpile.NewPassManager(transpile.DeferMeasurements())
+	pm.Verify = true
+	_, err = pm.Run(ifElse)
+	assert.NoError(err)
+
+	loop := build(func(b builder.Builder) {
+		b.RepeatUntil(builder.Bit(0), 3, func(b builder.Builder) { b.H(0).Measure(0, 0) })
+	}, 1, 1)
+	assert.ErrorContains(transpile.Equivalent(loop, loop, 1, 1), "circuits with loops")
+}
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	b := builder.New(builder.Q(3), builder.C(2))
+	b.H(0).X(2).SWAP(0, 1).Measure(1, 0)
+	b.If(builder.Bit(0), func(b builder.Builder) { b.X(1) }).Measure(1, 1).H(1)
+	c, err := b.BuildCircuit()
+	require.NoError(err)
+
+	pm := transpile.NewPassManager(transpile.DeadCode(), transpile.SwapElimination(), transpile.DeferMeasurements())
+	_, r, err := pm.RunReport(c)
+	require.NoError(err)
+	require.Len(r.Passes, 3)
+	dead, swap, deferred := r.Passes[0], r.Passes[1], r.Passes[2]
+	assert.Equal("dead-code", dead.Pass)
+	assert.Equal([]int{5, 3}, []int{dead.GatesBefore, dead.GatesAfter})
+	assert.Equal([]int{3, 2}, []int{swap.GatesBefore, swap.GatesAfter})
+	assert.Less(swap.DepthAfter, swap.DepthBefore)
+	assert.Equal([]int{3, 4}, []int{deferred.QubitsBefore, deferred.QubitsAfter})
+	assert.Equal(deferred.GatesBefore+1, deferred.GatesAfter, "CNOT onto an ancilla and the conditional X as a CNOT")
+
+	text := r.String()
+	assert.Contains(text, "PASS")
+	assert.Regexp(`dead-code\s+3 -> 3\s+5 -> 3\s+`, text)
+
+	pm.Passes = append(pm.Passes, dropLast{})
+	pm.Verify = true
+	_, r, err = pm.RunReport(c)
+	assert.ErrorContains(err, "drop-last")
+	assert.Len(r.Passes, 3, "the report covers the passes that succeeded")
+}
+
+func TestBasis(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	build := func(measure bool) circuit.Circuit {
+		b := builder.New(builder.Q(3), builder.C(2))
+		b.H(0).X(1).Y(2).Z(0).S(1).P(0.3, 2).RX(1.1, 0).RY(-0.7, 1).RZ(2.5, 2).RY(math.Pi/2, 0)
+		b.CNOT(0, 1).CZ(1, 2).SWAP(0, 2).CP(0.9, 2, 0).Toffoli(0, 1, 2).Fredkin(2, 0, 1)
+		b.Apply(gate.SX(), 1).Apply(gate.ECR(), 2, 1).Apply(gate.ISWAP(), 0, 1)
+		b.Apply(gate.GPI(0.4), 2).Apply(gate.GPI2(1.3), 0).Apply(gate.MS(0.2, -1), 1, 2)
+		if measure {
+			b.Measure(0, 0).If(builder.Bit(0), func(b builder.Builder) { b.H(1).CNOT(1, 2) }).Measure(2, 1)
+		}
+		c, err := b.BuildCircuit()
+		require.NoError(err)
+		return c
+	}
+	unitary, measured := build(false), build(true)
+
+	for _, target := range transpile.Targets() {
+		p, err := transpile.Basis(strings.ToUpper(target.Name))
+		require.NoError(err)
+		assert.Equal("basis-"+target.Name, p.Name())
+
+		out, err := p.Run(unitary)
+		require.NoError(err, target.Name)
+		assert.NoError(transpile.Equivalent(unitary, out, 3, 1), target.Name)
+
+		pm := transpile.NewPassManager(p)
+		pm.Verify = true
+		out, err = pm.Run(measured)
+		require.NoError(err, target.Name)
+		conditional := 0
+		for _, op := range out.OpsIter() {
+			if name := op.G.Name(); name != "MEASURE" {
+				assert.Contains(target.Gates, name, target.Name)
+			}
+			if op.Cond != nil {
+				conditional++
+			}
+		}
+		assert.Greater(conditional, 1, "%s: the pieces of conditional gates stay conditional", target.Name)
+	}
+
+	_, err := transpile.Basis("dwave")
+	assert.ErrorContains(err, "transpile: unknown target \"dwave\" (have ibm, ionq, rigetti)")
+}
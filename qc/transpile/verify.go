@@ -0,0 +1,229 @@
+package transpile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/kegliz/qcm/qc/circuit"
+	"github.com/kegliz/qcm/qc/dag"
+	"github.com/kegliz/qcm/qc/simulator/qsim"
+)
+
+// ErrNotEquivalent is wrapped by the errors of Equivalent, and so of
+// verified PassManager runs, when two circuits behave differently.
+var ErrNotEquivalent = errors.New("transpile: circuits are not equivalent")
+
+// DefaultTolerance bounds the difference of amplitudes or probabilities
+// that Equivalent still counts as equal.
+const DefaultTolerance = 1e-8
+
+// Equivalent checks that b behaves like a on probes random product input
+// states of a's qubits; qubits b adds after them start in |0⟩. Circuits
+// without measurements must map every input to the same state, up to one
+// global phase, and return b's extra qubits to |0⟩. Circuits with
+// measurements must give every outcome of the classical bits the same
+// probability. The probabilities are worked out by following both results
+// of every measurement in program order, conditions included, so the check
+// does not rely on DeferMeasurements, and its cost doubles with every
+// measurement whose result is not yet decided; loops cannot be checked.
+// The check is exact for the probes; random probes catch a non-equivalent
+// pair with probability one. Amplitudes and probabilities are compared to
+// within DefaultTolerance.
+func Equivalent(a, b circuit.Circuit, probes int, seed int64) error {
+	return EquivalentWithin(a, b, probes, seed, DefaultTolerance)
+}
+
+// EquivalentWithin is Equivalent comparing amplitudes and probabilities to
+// within tol, which deep circuits may need to loosen.
+func EquivalentWithin(a, b circuit.Circuit, probes int, seed int64, tol float64) error {
+	if tol <= 0 {
+		return fmt.Errorf("transpile: tolerance must be positive, got %v", tol)
+	}
+	if b.Qubits() < a.Qubits() || b.Clbits() != a.Clbits() {
+		return fmt.Errorf("%w: %d qubits and %d cbits against %d and %d",
+			ErrNotEquivalent, b.Qubits(), b.Clbits(), a.Qubits(), a.Clbits())
+	}
+	n := a.Qubits() // probed; b's extra qubits start in |0⟩
+	measured := hasMeasurements(a) || hasMeasurements(b)
+	for _, c := range []circuit.Circuit{a, b} {
+		for _, op := range c.OpsIter() {
+			if op.Loop != nil {
+				return fmt.Errorf("transpile: cannot check equivalence of circuits with loops")
+			}
+		}
+	}
+
+	runner := qsim.NewQSimRunner()
+	rng := rand.New(rand.NewSource(seed))
+	var phase complex128 // b's global phase relative to a's, from the first probe
+	for p := range max(probes, 1) {
+		probe := randomProduct(rng, n)
+		if measured {
+			pa, err := outcomes(runner, pad(probe, n, a.Qubits()), a)
+			if err != nil {
+				return err
+			}
+			pb, err := outcomes(runner, pad(probe, n, b.Qubits()), b)
+			if err != nil {
+				return err
+			}
+			for k, x := range pa {
+				if math.Abs(x-pb[k]) > tol {
+					return fmt.Errorf("%w: probe %d: P(%s) is %.6g, want %.6g", ErrNotEquivalent, p, k, pb[k], x)
+				}
+			}
+			continue
+		}
+		sa, err := runner.StatevectorFrom(pad(probe, n, a.Qubits()), a)
+		if err != nil {
+			return err
+		}
+		sb, err := runner.StatevectorFrom(pad(probe, n, b.Qubits()), b)
+		if err != nil {
+			return err
+		}
+		if p == 0 {
+			phase = relativePhase(sa, sb)
+		}
+		for i, x := range sb {
+			want := complex(0, 0)
+			if i < len(sa) {
+				want = sa[i] * phase
+			}
+			if cmplx.Abs(x-want) > tol {
+				return fmt.Errorf("%w: probe %d: amplitude %d is %.6g, want %.6g", ErrNotEquivalent, p, i, x, want)
+			}
+		}
+	}
+	return nil
+}
+
+func hasMeasurements(c circuit.Circuit) bool {
+	for _, op := range c.OpsIter() {
+		if op.G.Name() == "MEASURE" || op.Cond != nil || op.Loop != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// randomProduct returns a random product state of n qubits.
+func randomProduct(rng *rand.Rand, n int) []complex128 {
+	sv := []complex128{1}
+	for range n {
+		theta, phi := math.Acos(2*rng.Float64()-1), 2*math.Pi*rng.Float64()
+		zero, one := complex(math.Cos(theta/2), 0), cmplx.Rect(math.Sin(theta/2), phi)
+		next := make([]complex128, 2*len(sv))
+		for i, x := range sv {
+			next[i], next[i+len(sv)] = x*zero, x*one
+		}
+		sv = next
+	}
+	return sv
+}
+
+// pad embeds a state of n qubits into width qubits, the rest in |0⟩.
+func pad(sv []complex128, n, width int) []complex128 {
+	out := make([]complex128, 1<<width)
+	copy(out, sv[:1<<n])
+	return out
+}
+
+// relativePhase returns the unit phase taking a's largest amplitude to
+// b's.
+func relativePhase(a, b []complex128) complex128 {
+	best := 0
+	for i, x := range a {
+		if cmplx.Abs(x) > cmplx.Abs(a[best]) {
+			best = i
+		}
+	}
+	if best >= len(b) || cmplx.Abs(b[best]) == 0 {
+		return 1
+	}
+	r := b[best] / a[best]
+	return r / complex(cmplx.Abs(r), 0)
+}
+
+// branch is one history of a measured circuit: the state it leaves,
+// scaled by the square root of the history's probability, and the
+// classical bits it has written.
+type branch struct {
+	sv   []complex128
+	bits []bool
+}
+
+// outcomes returns the probabilities of the classical outcomes of c run
+// from init, keyed cbit 0 first. Every measurement splits each history in
+// two, so mid-circuit measurements and conditions are followed exactly
+// rather than deferred.
+func outcomes(runner *qsim.QSimRunner, init []complex128, c circuit.Circuit) (map[string]float64, error) {
+	branches := []branch{{sv: init, bits: make([]bool, c.Clbits())}}
+	for _, op := range c.OpsIter() {
+		if op.G.Name() == "MEASURE" {
+			q := op.Qubits[0]
+			var next []branch
+			for _, br := range branches {
+				for _, one := range []bool{false, true} {
+					sv := make([]complex128, len(br.sv))
+					for i, x := range br.sv {
+						if (i>>q&1 == 1) == one {
+							sv[i] = x
+						}
+					}
+					if norm(sv) == 0 {
+						continue
+					}
+					bits := append([]bool(nil), br.bits...)
+					bits[op.Cbit] = one
+					next = append(next, branch{sv, bits})
+				}
+			}
+			branches = next
+			continue
+		}
+		d := dag.New(c.Qubits(), 0)
+		if err := d.AddGate(op.G, op.Qubits); err != nil {
+			return nil, err
+		}
+		if err := d.Validate(); err != nil {
+			return nil, err
+		}
+		single := circuit.FromDAG(d)
+		for i, br := range branches {
+			if op.Cond != nil && !op.Cond.Eval(func(cb int) bool { return br.bits[cb] }) {
+				continue
+			}
+			sv, err := runner.StatevectorFrom(br.sv, single)
+			if err != nil {
+				return nil, err
+			}
+			branches[i].sv = sv
+		}
+	}
+
+	out := map[string]float64{}
+	key := make([]byte, c.Clbits())
+	for _, br := range branches {
+		for b, one := range br.bits {
+			key[b] = '0'
+			if one {
+				key[b] = '1'
+			}
+		}
+		out[string(key)] += norm(br.sv)
+	}
+	return out, nil
+}
+
+// norm returns the squared norm of sv.
+func norm(sv []complex128) float64 {
+	s := 0.0
+	for _, x := range sv {
+		s += real(x)*real(x) + imag(x)*imag(x)
+	}
+	return s
+}